@@ -0,0 +1,250 @@
+// Package bench drives load through plugin combinations and reports throughput, latency and resource use
+package bench
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+	bmemory "github.com/micro/go-micro/v2/broker/memory"
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/registry/memory"
+	"github.com/micro/go-micro/v2/server"
+	"github.com/micro/go-micro/v2/transport"
+)
+
+/*
+	Runs serve the client and the server, or the publisher and the subscriber, from
+	the same process so the numbers of different plugins are comparable on the same
+	machine. Workers drive load for the warmup and the duration, only the duration is
+	recorded. Rpc latency is the round trip of a call, broker latency the time from
+	publishing to receiving a message as measured by the subscriber.
+*/
+
+const (
+	// sentKey is the header holding when a message was published
+	sentKey = "Micro-Bench-Sent"
+	// service is the name the server is registered under
+	service = "go.micro.bench"
+)
+
+// Message is the request, response and broker body of runs
+type Message struct {
+	Data []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (m *Message) Reset()         { *m = Message{} }
+func (m *Message) String() string { return fmt.Sprintf("%d bytes", len(m.Data)) }
+func (*Message) ProtoMessage()    {}
+
+// Bench is the handler served in rpc runs
+type Bench struct{}
+
+// Echo responds with the request
+func (b *Bench) Echo(ctx context.Context, req *Message, rsp *Message) error {
+	rsp.Data = req.Data
+	return nil
+}
+
+type run struct {
+	opts Options
+
+	// start is when recording started in unix nanoseconds, 0 during the warmup
+	start int64
+	errs  uint64
+}
+
+func (r *run) recording() bool {
+	return atomic.LoadInt64(&r.start) > 0
+}
+
+// drive runs op from the workers for the warmup and the duration, failures
+// are counted once recording started
+func (r *run) drive(op func() error) (time.Duration, Resources) {
+	o := r.opts
+
+	var tick <-chan time.Time
+	if o.Rate > 0 && time.Second/time.Duration(o.Rate) > 0 {
+		t := time.NewTicker(time.Second / time.Duration(o.Rate))
+		defer t.Stop()
+		tick = t.C
+	}
+
+	// closed at the deadline, workers waiting for a tick stop rather than
+	// running op once more after it
+	done := make(chan struct{})
+	timer := time.AfterFunc(o.Warmup+o.Duration, func() { close(done) })
+	defer timer.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < o.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if tick != nil {
+					select {
+					case <-done:
+						return
+					case <-tick:
+					}
+				}
+				// a tick and the deadline may be ready at once
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if err := op(); err != nil && r.recording() {
+					atomic.AddUint64(&r.errs, 1)
+				}
+			}
+		}()
+	}
+
+	time.Sleep(o.Warmup)
+	s := newSampler(o.SampleInterval)
+	begin := time.Now()
+	atomic.StoreInt64(&r.start, begin.UnixNano())
+
+	wg.Wait()
+	return time.Since(begin), s.stop()
+}
+
+func payload(size int) []byte {
+	b := make([]byte, size)
+	rand.Read(b)
+	return b
+}
+
+// RunRPC serves the Bench handler and calls it from the workers, by default over
+// the http transport with protobuf requests
+func RunRPC(opts ...Option) (*Report, error) {
+	o := newOptions(opts...)
+
+	reg := o.Registry
+	if reg == nil {
+		reg = memory.NewRegistry()
+	}
+	tr := o.Transport
+	if tr == nil {
+		tr = transport.NewTransport()
+	}
+	// keep the default http broker out of rpc runs
+	br := bmemory.NewBroker()
+
+	sopts := []server.Option{
+		server.Name(service),
+		server.Transport(tr),
+		server.Registry(reg),
+		server.Broker(br),
+	}
+	copts := []client.Option{
+		client.Transport(tr),
+		client.Registry(reg),
+		client.Broker(br),
+		client.ContentType(o.ContentType),
+		client.Retries(0),
+	}
+	if o.Codec != nil {
+		sopts = append(sopts, server.Codec(o.ContentType, o.Codec))
+		copts = append(copts, client.Codec(o.ContentType, o.Codec))
+	}
+
+	srv := server.NewServer(sopts...)
+	if err := srv.Handle(srv.NewHandler(&Bench{})); err != nil {
+		return nil, err
+	}
+	if err := srv.Start(); err != nil {
+		return nil, err
+	}
+	defer srv.Stop()
+
+	c := client.NewClient(copts...)
+	req := c.NewRequest(service, "Bench.Echo", &Message{Data: payload(o.PayloadSize)})
+
+	r := &run{opts: o}
+	h := NewHistogram()
+
+	elapsed, res := r.drive(func() error {
+		begin := time.Now()
+		var rsp Message
+		if err := c.Call(context.Background(), req, &rsp); err != nil {
+			return err
+		}
+		if r.recording() {
+			h.Record(time.Since(begin))
+		}
+		return nil
+	})
+
+	name := o.Name
+	if len(name) == 0 {
+		name = fmt.Sprintf("%s %s", tr.String(), o.ContentType)
+	}
+	return newReport(name, "rpc", o, elapsed, h, atomic.LoadUint64(&r.errs), res), nil
+}
+
+// RunBroker subscribes to a topic and publishes to it from the workers, by default
+// on a memory broker. Throughput counts the messages received
+func RunBroker(opts ...Option) (*Report, error) {
+	o := newOptions(opts...)
+
+	b := o.Broker
+	if b == nil {
+		b = bmemory.NewBroker()
+	}
+	if err := b.Connect(); err != nil {
+		return nil, err
+	}
+	defer b.Disconnect()
+
+	r := &run{opts: o}
+	h := NewHistogram()
+
+	topic := fmt.Sprintf("go.micro.bench.%d", time.Now().UnixNano())
+	sub, err := b.Subscribe(topic, func(e broker.Event) error {
+		sent, err := strconv.ParseInt(e.Message().Header[sentKey], 10, 64)
+		if err != nil {
+			return nil
+		}
+		// messages published during the warmup aren't recorded
+		if start := atomic.LoadInt64(&r.start); start > 0 && sent >= start {
+			h.Record(time.Since(time.Unix(0, sent)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+
+	body := payload(o.PayloadSize)
+	elapsed, res := r.drive(func() error {
+		return b.Publish(topic, &broker.Message{
+			Header: map[string]string{sentKey: strconv.FormatInt(time.Now().UnixNano(), 10)},
+			Body:   body,
+		})
+	})
+
+	// wait for messages still in flight
+	for n := h.Count(); ; {
+		time.Sleep(500 * time.Millisecond)
+		if c := h.Count(); c > n {
+			n = c
+			continue
+		}
+		break
+	}
+
+	name := o.Name
+	if len(name) == 0 {
+		name = b.String()
+	}
+	return newReport(name, "broker", o, elapsed, h, atomic.LoadUint64(&r.errs), res), nil
+}
@@ -0,0 +1,49 @@
+package bench
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunRPC(t *testing.T) {
+	r, err := RunRPC(
+		Duration(200*time.Millisecond),
+		Warmup(50*time.Millisecond),
+		Concurrency(2),
+		Codec("application/json", nil),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Requests == 0 || r.Errors != 0 {
+		t.Fatalf("expected requests without errors, got %d requests and %d errors", r.Requests, r.Errors)
+	}
+	if r.Latency.P50 == 0 || r.Latency.P50 > r.Latency.Max {
+		t.Fatalf("unexpected latency %+v", r.Latency)
+	}
+}
+
+func TestRunBroker(t *testing.T) {
+	r, err := RunBroker(
+		Duration(200*time.Millisecond),
+		Rate(100),
+		PayloadSize(16),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the rate caps the messages at about 20
+	if r.Requests == 0 || r.Requests > 25 {
+		t.Fatalf("expected about 20 messages, got %d", r.Requests)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTable(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "memory") {
+		t.Fatalf("expected the report in the table, got %s", buf.String())
+	}
+}
@@ -0,0 +1,122 @@
+// Command bench compares the throughput, latency and resource use of plugin combinations.
+// Plugins register themselves on import, build a copy of this command importing
+// the plugins to compare e.g _ "github.com/micro/go-plugins/transport/tcp/v2"
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+	"github.com/micro/go-micro/v2/config/cmd"
+	"github.com/micro/go-micro/v2/transport"
+	"github.com/micro/go-plugins/bench/v2"
+)
+
+var (
+	kind         = flag.String("kind", "rpc", "rpc or broker")
+	transports   = flag.String("transport", "http", "comma separated transports to compare")
+	contentTypes = flag.String("content_type", "application/protobuf", "comma separated content types to compare")
+	brokers      = flag.String("broker", "memory", "comma separated brokers to compare")
+	address      = flag.String("address", "", "address of the transport or broker e.g for nats")
+	duration     = flag.Duration("duration", bench.DefaultDuration, "how long to drive load, use hours to soak")
+	warmup       = flag.Duration("warmup", time.Second, "how long to drive load before recording")
+	concurrency  = flag.Int("c", bench.DefaultConcurrency, "number of workers")
+	rate         = flag.Int("rate", 0, "max requests or messages per second, 0 is unlimited")
+	size         = flag.Int("size", bench.DefaultPayloadSize, "payload size in bytes")
+	jsonOut      = flag.Bool("json", false, "write the reports as json")
+)
+
+func split(s string) []string {
+	var parts []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); len(p) > 0 {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+func addrs() []string {
+	if len(*address) == 0 {
+		return nil
+	}
+	return split(*address)
+}
+
+func run() ([]*bench.Report, error) {
+	opts := []bench.Option{
+		bench.Duration(*duration),
+		bench.Warmup(*warmup),
+		bench.Concurrency(*concurrency),
+		bench.Rate(*rate),
+		bench.PayloadSize(*size),
+	}
+
+	var reports []*bench.Report
+
+	switch *kind {
+	case "rpc":
+		for _, t := range split(*transports) {
+			newTransport, ok := cmd.DefaultTransports[t]
+			if !ok {
+				return nil, fmt.Errorf("unknown transport %s", t)
+			}
+			for _, ct := range split(*contentTypes) {
+				fmt.Fprintf(os.Stderr, "running rpc over %s with %s\n", t, ct)
+				r, err := bench.RunRPC(append(opts,
+					bench.Name(t+" "+ct),
+					bench.Transport(newTransport(transport.Addrs(addrs()...))),
+					bench.Codec(ct, nil),
+				)...)
+				if err != nil {
+					return nil, fmt.Errorf("%s %s: %v", t, ct, err)
+				}
+				reports = append(reports, r)
+			}
+		}
+	case "broker":
+		for _, b := range split(*brokers) {
+			newBroker, ok := cmd.DefaultBrokers[b]
+			if !ok {
+				return nil, fmt.Errorf("unknown broker %s", b)
+			}
+			fmt.Fprintf(os.Stderr, "running broker %s\n", b)
+			r, err := bench.RunBroker(append(opts,
+				bench.Name(b),
+				bench.Broker(newBroker(broker.Addrs(addrs()...))),
+			)...)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", b, err)
+			}
+			reports = append(reports, r)
+		}
+	default:
+		return nil, fmt.Errorf("unknown kind %s", *kind)
+	}
+
+	return reports, nil
+}
+
+func main() {
+	flag.Parse()
+
+	reports, err := run()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *jsonOut {
+		err = bench.WriteJSON(os.Stdout, reports...)
+	} else {
+		err = bench.WriteTable(os.Stdout, reports...)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,127 @@
+package bench
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+/*
+	The histogram counts latencies in log-linear buckets, each bucket is about 2%
+	wider than the previous one, so memory stays constant over soak tests of any
+	length while percentiles stay within 2% of the recorded values.
+*/
+
+const (
+	bucketGrowth = 1.02
+	// minLatency is the upper bound of the first bucket
+	minLatency = time.Microsecond
+)
+
+var numBuckets = int(math.Ceil(math.Log(float64(time.Hour/minLatency))/math.Log(bucketGrowth))) + 1
+
+// Histogram records latencies
+type Histogram struct {
+	sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+// NewHistogram returns a histogram recording latencies up to an hour
+func NewHistogram() *Histogram {
+	return &Histogram{
+		counts: make([]uint64, numBuckets),
+	}
+}
+
+func bucket(d time.Duration) int {
+	if d <= minLatency {
+		return 0
+	}
+	i := int(math.Ceil(math.Log(float64(d)/float64(minLatency)) / math.Log(bucketGrowth)))
+	if i >= numBuckets {
+		return numBuckets - 1
+	}
+	return i
+}
+
+// upper returns the upper bound of the bucket
+func upper(i int) time.Duration {
+	return time.Duration(float64(minLatency) * math.Pow(bucketGrowth, float64(i)))
+}
+
+// Record records a latency
+func (h *Histogram) Record(d time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.counts[bucket(d)]++
+	h.count++
+	h.sum += d
+	if h.count == 1 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// Count returns the number of recorded latencies
+func (h *Histogram) Count() uint64 {
+	h.Lock()
+	defer h.Unlock()
+	return h.count
+}
+
+// Mean returns the mean latency
+func (h *Histogram) Mean() time.Duration {
+	h.Lock()
+	defer h.Unlock()
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// Max returns the highest latency
+func (h *Histogram) Max() time.Duration {
+	h.Lock()
+	defer h.Unlock()
+	return h.max
+}
+
+// Percentile returns the latency below which p percent of the latencies are
+func (h *Histogram) Percentile(p float64) time.Duration {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(p / 100 * float64(h.count)))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen < rank {
+			continue
+		}
+		// the bucket bound is an estimate, never report beyond what was seen
+		d := upper(i)
+		if d > h.max {
+			d = h.max
+		}
+		if d < h.min {
+			d = h.min
+		}
+		return d
+	}
+	return h.max
+}
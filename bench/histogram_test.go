@@ -0,0 +1,37 @@
+package bench
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram()
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	if h.Count() != 1000 {
+		t.Fatalf("expected 1000 latencies, got %d", h.Count())
+	}
+	if h.Max() != time.Second {
+		t.Fatalf("expected max of 1s, got %v", h.Max())
+	}
+
+	testData := []struct {
+		p      float64
+		expect time.Duration
+	}{
+		{50, 500 * time.Millisecond},
+		{90, 900 * time.Millisecond},
+		{99, 990 * time.Millisecond},
+		{100, time.Second},
+	}
+
+	for _, d := range testData {
+		got := h.Percentile(d.p)
+		if got < d.expect || float64(got) > float64(d.expect)*1.02 {
+			t.Fatalf("expected p%v within 2%% of %v, got %v", d.p, d.expect, got)
+		}
+	}
+}
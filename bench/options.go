@@ -0,0 +1,149 @@
+package bench
+
+import (
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+	"github.com/micro/go-micro/v2/codec"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/transport"
+)
+
+var (
+	// DefaultDuration is how long load is driven
+	DefaultDuration = 10 * time.Second
+	// DefaultConcurrency is how many workers drive load
+	DefaultConcurrency = 10
+	// DefaultPayloadSize is the size of request and message bodies
+	DefaultPayloadSize = 1024
+	// DefaultContentType is the content type of requests
+	DefaultContentType = "application/protobuf"
+	// DefaultSampleInterval is how often resources are sampled
+	DefaultSampleInterval = time.Second
+)
+
+type Options struct {
+	// Name describes the run in reports, by default the plugins used
+	Name string
+	// Transport carries requests between client and server
+	Transport transport.Transport
+	// Broker carries messages between publishers and subscribers
+	Broker broker.Broker
+	// Registry is where the server is registered, a memory registry by default
+	Registry registry.Registry
+	// ContentType is the content type of requests
+	ContentType string
+	// Codec encodes requests of the content type, for codecs the client and
+	// server don't know already
+	Codec codec.NewCodec
+	// Duration is how long load is driven
+	Duration time.Duration
+	// Warmup is how long load is driven before recording starts
+	Warmup time.Duration
+	// Concurrency is how many workers drive load
+	Concurrency int
+	// Rate limits the requests or messages per second across workers, 0 is unlimited
+	Rate int
+	// PayloadSize is the size of request and message bodies
+	PayloadSize int
+	// SampleInterval is how often resources are sampled
+	SampleInterval time.Duration
+}
+
+type Option func(*Options)
+
+// Name sets the name of the run in reports
+func Name(n string) Option {
+	return func(o *Options) {
+		o.Name = n
+	}
+}
+
+// Transport sets the transport rpc requests are sent over
+func Transport(t transport.Transport) Option {
+	return func(o *Options) {
+		o.Transport = t
+	}
+}
+
+// Broker sets the broker messages are published to
+func Broker(b broker.Broker) Option {
+	return func(o *Options) {
+		o.Broker = b
+	}
+}
+
+// Registry sets the registry the server is registered in
+func Registry(r registry.Registry) Option {
+	return func(o *Options) {
+		o.Registry = r
+	}
+}
+
+// Codec sets the content type of requests and the codec encoding them, pass a
+// nil codec for content types the client and server support already
+func Codec(contentType string, c codec.NewCodec) Option {
+	return func(o *Options) {
+		o.ContentType = contentType
+		o.Codec = c
+	}
+}
+
+// Duration sets how long load is driven, use hours for soak tests
+func Duration(d time.Duration) Option {
+	return func(o *Options) {
+		o.Duration = d
+	}
+}
+
+// Warmup sets how long load is driven before recording starts
+func Warmup(d time.Duration) Option {
+	return func(o *Options) {
+		o.Warmup = d
+	}
+}
+
+// Concurrency sets how many workers drive load
+func Concurrency(n int) Option {
+	return func(o *Options) {
+		o.Concurrency = n
+	}
+}
+
+// Rate limits the requests or messages per second across workers
+func Rate(n int) Option {
+	return func(o *Options) {
+		o.Rate = n
+	}
+}
+
+// PayloadSize sets the size of request and message bodies
+func PayloadSize(n int) Option {
+	return func(o *Options) {
+		o.PayloadSize = n
+	}
+}
+
+// SampleInterval sets how often resources are sampled
+func SampleInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.SampleInterval = d
+	}
+}
+
+func newOptions(opts ...Option) Options {
+	options := Options{
+		ContentType:    DefaultContentType,
+		Duration:       DefaultDuration,
+		Concurrency:    DefaultConcurrency,
+		PayloadSize:    DefaultPayloadSize,
+		SampleInterval: DefaultSampleInterval,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.Concurrency < 1 {
+		options.Concurrency = 1
+	}
+	return options
+}
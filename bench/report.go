@@ -0,0 +1,99 @@
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Latency summarises the recorded latencies
+type Latency struct {
+	Mean time.Duration `json:"mean"`
+	P50  time.Duration `json:"p50"`
+	P90  time.Duration `json:"p90"`
+	P99  time.Duration `json:"p99"`
+	P999 time.Duration `json:"p999"`
+	Max  time.Duration `json:"max"`
+}
+
+// Report is the outcome of a run
+type Report struct {
+	// Name describes the run
+	Name string `json:"name"`
+	// Kind is either rpc or broker
+	Kind string `json:"kind"`
+	// Duration is how long load was recorded
+	Duration time.Duration `json:"duration"`
+	// Concurrency is how many workers drove load
+	Concurrency int `json:"concurrency"`
+	// PayloadSize is the size of bodies
+	PayloadSize int `json:"payload_size"`
+	// Requests is the number of completed requests or received messages
+	Requests uint64 `json:"requests"`
+	// Errors is the number of failed requests or publishes
+	Errors uint64 `json:"errors"`
+	// Throughput is the number of requests or messages per second
+	Throughput float64   `json:"throughput"`
+	Latency    Latency   `json:"latency"`
+	Resources  Resources `json:"resources"`
+}
+
+func newReport(name, kind string, o Options, elapsed time.Duration, h *Histogram, errs uint64, res Resources) *Report {
+	n := h.Count()
+	return &Report{
+		Name:        name,
+		Kind:        kind,
+		Duration:    elapsed,
+		Concurrency: o.Concurrency,
+		PayloadSize: o.PayloadSize,
+		Requests:    n,
+		Errors:      errs,
+		Throughput:  float64(n) / elapsed.Seconds(),
+		Latency: Latency{
+			Mean: h.Mean(),
+			P50:  h.Percentile(50),
+			P90:  h.Percentile(90),
+			P99:  h.Percentile(99),
+			P999: h.Percentile(99.9),
+			Max:  h.Max(),
+		},
+		Resources: res,
+	}
+}
+
+// WriteJSON writes the reports as json e.g to compare them later
+func WriteJSON(w io.Writer, reports ...*Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reports)
+}
+
+// WriteTable writes the reports as a table, one row per report
+func WriteTable(w io.Writer, reports ...*Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "name\tkind\tops/s\terrors\tmean\tp50\tp99\tp99.9\tmax\tallocs/op\tmax heap\tgc pause\t")
+
+	for _, r := range reports {
+		var allocs uint64
+		if r.Requests > 0 {
+			allocs = r.Resources.Allocs / r.Requests
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.0f\t%d\t%v\t%v\t%v\t%v\t%v\t%d\t%.1fMB\t%v\t\n",
+			r.Name,
+			r.Kind,
+			r.Throughput,
+			r.Errors,
+			r.Latency.Mean.Round(time.Microsecond),
+			r.Latency.P50.Round(time.Microsecond),
+			r.Latency.P99.Round(time.Microsecond),
+			r.Latency.P999.Round(time.Microsecond),
+			r.Latency.Max.Round(time.Microsecond),
+			allocs,
+			float64(r.Resources.MaxHeapBytes)/(1<<20),
+			r.Resources.GCPause.Round(time.Microsecond),
+		)
+	}
+	return tw.Flush()
+}
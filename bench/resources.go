@@ -0,0 +1,94 @@
+package bench
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Resources describes the resources used during a run
+type Resources struct {
+	// MaxGoroutines is the highest number of goroutines seen
+	MaxGoroutines int `json:"max_goroutines"`
+	// MaxHeapBytes is the highest heap size seen
+	MaxHeapBytes uint64 `json:"max_heap_bytes"`
+	// Allocs is the number of heap allocations
+	Allocs uint64 `json:"allocs"`
+	// AllocBytes is the number of bytes allocated
+	AllocBytes uint64 `json:"alloc_bytes"`
+	// NumGC is the number of garbage collections
+	NumGC uint32 `json:"num_gc"`
+	// GCPause is the total garbage collection pause
+	GCPause time.Duration `json:"gc_pause"`
+}
+
+// sampler samples the resources of the process until stopped
+type sampler struct {
+	interval time.Duration
+	start    runtime.MemStats
+	exit     chan bool
+	wg       sync.WaitGroup
+
+	sync.Mutex
+	res Resources
+}
+
+func newSampler(interval time.Duration) *sampler {
+	s := &sampler{
+		interval: interval,
+		exit:     make(chan bool),
+	}
+	runtime.ReadMemStats(&s.start)
+	s.sample()
+
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+func (s *sampler) sample() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	n := runtime.NumGoroutine()
+
+	s.Lock()
+	defer s.Unlock()
+
+	if n > s.res.MaxGoroutines {
+		s.res.MaxGoroutines = n
+	}
+	if ms.HeapAlloc > s.res.MaxHeapBytes {
+		s.res.MaxHeapBytes = ms.HeapAlloc
+	}
+	s.res.Allocs = ms.Mallocs - s.start.Mallocs
+	s.res.AllocBytes = ms.TotalAlloc - s.start.TotalAlloc
+	s.res.NumGC = ms.NumGC - s.start.NumGC
+	s.res.GCPause = time.Duration(ms.PauseTotalNs - s.start.PauseTotalNs)
+}
+
+func (s *sampler) run() {
+	defer s.wg.Done()
+
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			s.sample()
+		case <-s.exit:
+			return
+		}
+	}
+}
+
+// stop stops sampling and returns the resources used since the sampler started
+func (s *sampler) stop() Resources {
+	close(s.exit)
+	s.wg.Wait()
+	s.sample()
+
+	s.Lock()
+	defer s.Unlock()
+	return s.res
+}
@@ -0,0 +1,19 @@
+// Package browser defines the interface of brokers which can inspect queues
+package browser
+
+import (
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+)
+
+// Browser is implemented by brokers which can inspect a queue without consuming it,
+// for use by admin tooling. What names a queue depends on the broker, e.g. the
+// queue of rabbitmq and sqs or the topic of a JetStream stream
+type Browser interface {
+	// Peek returns up to n pending messages without consuming them
+	Peek(queue string, n int) ([]*broker.Message, error)
+	// Depth returns the number of pending messages and the age of the oldest one,
+	// the age is zero when the broker can't tell
+	Depth(queue string) (int64, time.Duration, error)
+}
@@ -4,6 +4,7 @@ package googlepubsub
 import (
 	"context"
 	"os"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/pubsub"
@@ -16,9 +17,21 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+/*
+	The pubsub client is held at v1.5.0, the last release built against a grpc the
+	etcd registry of go-micro compiles with, which every service imports through
+	config/cmd. Exactly once delivery needs v1.25.0 and a grpc etcd doesn't build
+	with, so it isn't offered. Services replace github.com/coreos/etcd with the
+	ozonru fork like this module does, since v1.5.0 already needs grpc v1.29.
+*/
+
 type pubsubBroker struct {
 	client  *pubsub.Client
 	options broker.Options
+
+	// topics are reused so publishes are batched and ordering keys are honoured
+	sync.Mutex
+	topics map[string]*pubsub.Topic
 }
 
 // A pubsub subscriber that manages handling of messages
@@ -49,6 +62,9 @@ func (s *subscriber) run(hdlr broker.Handler) {
 		if max, ok := s.options.Context.Value(maxExtensionKey{}).(time.Duration); ok {
 			s.sub.ReceiveSettings.MaxExtension = max
 		}
+		if max, ok := s.options.Context.Value(maxOutstandingBytesKey{}).(int); ok {
+			s.sub.ReceiveSettings.MaxOutstandingBytes = max
+		}
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -136,6 +152,12 @@ func (b *pubsubBroker) Connect() error {
 }
 
 func (b *pubsubBroker) Disconnect() error {
+	b.Lock()
+	for name, t := range b.topics {
+		t.Stop()
+		delete(b.topics, name)
+	}
+	b.Unlock()
 	return b.client.Close()
 }
 
@@ -150,7 +172,14 @@ func (b *pubsubBroker) Options() broker.Options {
 
 // Publish checks if the topic exists and then publishes via google pubsub
 func (b *pubsubBroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) (err error) {
-	t := b.client.Topic(topic)
+	options := broker.PublishOptions{
+		Context: context.Background(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	t := b.topic(topic)
 	ctx := context.Background()
 
 	m := &pubsub.Message{
@@ -158,13 +187,21 @@ func (b *pubsubBroker) Publish(topic string, msg *broker.Message, opts ...broker
 		Data:       msg.Body,
 		Attributes: msg.Header,
 	}
+	if key, ok := options.Context.Value(orderingKey{}).(string); ok && len(key) > 0 {
+		t.EnableMessageOrdering = true
+		m.OrderingKey = key
+	}
 
 	pr := t.Publish(ctx, m)
 	if _, err = pr.Get(ctx); err != nil {
+		// a failed publish pauses the ordering key until resumed
+		if len(m.OrderingKey) > 0 {
+			t.ResumePublish(m.OrderingKey)
+		}
 		// create Topic if not exists
 		if status.Code(err) == codes.NotFound {
 			log.Infof("Topic not exists. creating Topic: %s", topic)
-			if t, err = b.client.CreateTopic(ctx, topic); err == nil {
+			if _, err = b.client.CreateTopic(ctx, topic); err == nil {
 				_, err = t.Publish(ctx, m).Get(ctx)
 			}
 		}
@@ -172,6 +209,34 @@ func (b *pubsubBroker) Publish(topic string, msg *broker.Message, opts ...broker
 	return
 }
 
+// topic returns the cached topic handle
+func (b *pubsubBroker) topic(name string) *pubsub.Topic {
+	b.Lock()
+	defer b.Unlock()
+	t, ok := b.topics[name]
+	if !ok {
+		t = b.client.Topic(name)
+		b.topics[name] = t
+	}
+	return t
+}
+
+// createTopic returns the topic, creating it if it doesn't exist
+func (b *pubsubBroker) createTopic(ctx context.Context, name string) (*pubsub.Topic, error) {
+	t := b.topic(name)
+	exists, err := t.Exists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return t, nil
+	}
+	if _, err := b.client.CreateTopic(ctx, name); err != nil && status.Code(err) != codes.AlreadyExists {
+		return nil, err
+	}
+	return t, nil
+}
+
 // Subscribe registers a subscription to the given topic against the google pubsub api
 func (b *pubsubBroker) Subscribe(topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
 	options := broker.SubscribeOptions{
@@ -195,10 +260,33 @@ func (b *pubsubBroker) Subscribe(topic string, h broker.Handler, opts ...broker.
 
 		if !exists {
 			tt := b.client.Topic(topic)
-			subb, err := b.client.CreateSubscription(ctx, options.Queue, pubsub.SubscriptionConfig{
+			cfg := pubsub.SubscriptionConfig{
 				Topic:       tt,
 				AckDeadline: time.Duration(0),
-			})
+			}
+			if d, ok := options.Context.Value(ackDeadlineKey{}).(time.Duration); ok {
+				cfg.AckDeadline = d
+			}
+			if v, ok := options.Context.Value(messageOrderingKey{}).(bool); ok {
+				cfg.EnableMessageOrdering = v
+			}
+			if p, ok := options.Context.Value(deadLetterKey{}).(deadLetterPolicy); ok {
+				dt, err := b.createTopic(ctx, p.topic)
+				if err != nil {
+					return nil, err
+				}
+				cfg.DeadLetterPolicy = &pubsub.DeadLetterPolicy{
+					DeadLetterTopic:     dt.String(),
+					MaxDeliveryAttempts: p.maxAttempts,
+				}
+			}
+			if p, ok := options.Context.Value(retryPolicyKey{}).(retryPolicy); ok {
+				cfg.RetryPolicy = &pubsub.RetryPolicy{
+					MinimumBackoff: p.min,
+					MaximumBackoff: p.max,
+				}
+			}
+			subb, err := b.client.CreateSubscription(ctx, options.Queue, cfg)
 			if err != nil {
 				return nil, err
 			}
@@ -252,5 +340,6 @@ func NewBroker(opts ...broker.Option) broker.Broker {
 	return &pubsubBroker{
 		client:  c,
 		options: options,
+		topics:  make(map[string]*pubsub.Topic),
 	}
 }
@@ -86,3 +86,93 @@ func MaxExtension(d time.Duration) broker.SubscribeOption {
 		o.Context = context.WithValue(o.Context, maxExtensionKey{}, d)
 	}
 }
+
+type orderingKey struct{}
+
+// OrderingKey publishes the message with an ordering key. Messages with the same key
+// are delivered in order to subscriptions with message ordering enabled
+func OrderingKey(key string) broker.PublishOption {
+	return func(o *broker.PublishOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, orderingKey{}, key)
+	}
+}
+
+type messageOrderingKey struct{}
+
+// EnableMessageOrdering delivers messages with the same ordering key in order, applies
+// when the subscription is created
+func EnableMessageOrdering() broker.SubscribeOption {
+	return func(o *broker.SubscribeOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, messageOrderingKey{}, true)
+	}
+}
+
+type ackDeadlineKey struct{}
+
+// AckDeadline is how long the server waits for an ack before redelivering a message,
+// between 10 seconds and 10 minutes. Applies when the subscription is created
+func AckDeadline(d time.Duration) broker.SubscribeOption {
+	return func(o *broker.SubscribeOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, ackDeadlineKey{}, d)
+	}
+}
+
+type maxOutstandingBytesKey struct{}
+
+// MaxOutstandingBytes sets the maximum size of unprocessed messages
+// (unacknowledged but not yet expired) to receive.
+func MaxOutstandingBytes(max int) broker.SubscribeOption {
+	return func(o *broker.SubscribeOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+
+		o.Context = context.WithValue(o.Context, maxOutstandingBytesKey{}, max)
+	}
+}
+
+type deadLetterKey struct{}
+
+type deadLetterPolicy struct {
+	topic       string
+	maxAttempts int
+}
+
+// DeadLetterTopic forwards messages which couldn't be delivered after maxAttempts,
+// between 5 and 100, to the given topic. The topic is created if it doesn't exist.
+// Applies when the subscription is created, the pubsub service account needs
+// permission to publish to the topic and to ack on the subscription
+func DeadLetterTopic(topic string, maxAttempts int) broker.SubscribeOption {
+	return func(o *broker.SubscribeOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, deadLetterKey{}, deadLetterPolicy{topic, maxAttempts})
+	}
+}
+
+type retryPolicyKey struct{}
+
+type retryPolicy struct {
+	min, max time.Duration
+}
+
+// RetryBackoff redelivers nacked messages with an exponential backoff between min and
+// max instead of immediately. Applies when the subscription is created
+func RetryBackoff(min, max time.Duration) broker.SubscribeOption {
+	return func(o *broker.SubscribeOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, retryPolicyKey{}, retryPolicy{min, max})
+	}
+}
@@ -0,0 +1,136 @@
+package kafka
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/micro/go-micro/v2/broker"
+	log "github.com/micro/go-micro/v2/logger"
+)
+
+// AsyncErrorHandler is called for every message an async producer failed to deliver
+type AsyncErrorHandler func(topic string, msg *broker.Message, err error)
+
+// Flusher is implemented by the kafka broker. Flush blocks until every message
+// queued by the async producer has been acknowledged or has failed
+type Flusher interface {
+	Flush() error
+}
+
+// asyncProducer batches messages through a sarama.AsyncProducer and tracks
+// the number of messages still in flight so they can be flushed
+type asyncProducer struct {
+	p       sarama.AsyncProducer
+	onError AsyncErrorHandler
+
+	mtx     sync.Mutex
+	cond    *sync.Cond
+	pending int
+
+	// closeMtx is held for reading while sending so close can't close the input under a send
+	closeMtx sync.RWMutex
+	closed   bool
+
+	done chan struct{}
+}
+
+// errProducerClosed is returned when publishing through a closed async producer
+var errProducerClosed = errors.New("async producer is closed")
+
+func newAsyncProducer(c sarama.Client, fn AsyncErrorHandler) (*asyncProducer, error) {
+	p, err := sarama.NewAsyncProducerFromClient(c)
+	if err != nil {
+		return nil, err
+	}
+	a := &asyncProducer{
+		p:       p,
+		onError: fn,
+		done:    make(chan struct{}),
+	}
+	a.cond = sync.NewCond(&a.mtx)
+	go a.run()
+	return a, nil
+}
+
+// run drains the success and error channels until the producer is closed
+func (a *asyncProducer) run() {
+	defer close(a.done)
+
+	successes := a.p.Successes()
+	errors := a.p.Errors()
+
+	for successes != nil || errors != nil {
+		select {
+		case _, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			a.release()
+		case perr, ok := <-errors:
+			if !ok {
+				errors = nil
+				continue
+			}
+			a.handleError(perr)
+			a.release()
+		}
+	}
+}
+
+func (a *asyncProducer) handleError(perr *sarama.ProducerError) {
+	msg, _ := perr.Msg.Metadata.(*broker.Message)
+	if a.onError != nil {
+		a.onError(perr.Msg.Topic, msg, perr.Err)
+		return
+	}
+	log.Errorf("[kafka]: failed to publish to %s: %v", perr.Msg.Topic, perr.Err)
+}
+
+func (a *asyncProducer) release() {
+	a.mtx.Lock()
+	a.pending--
+	if a.pending <= 0 {
+		a.cond.Broadcast()
+	}
+	a.mtx.Unlock()
+}
+
+func (a *asyncProducer) send(msg *sarama.ProducerMessage) error {
+	a.closeMtx.RLock()
+	defer a.closeMtx.RUnlock()
+
+	if a.closed {
+		return errProducerClosed
+	}
+
+	a.mtx.Lock()
+	a.pending++
+	a.mtx.Unlock()
+	a.p.Input() <- msg
+	return nil
+}
+
+// flush waits for all in flight messages to complete
+func (a *asyncProducer) flush() {
+	a.mtx.Lock()
+	for a.pending > 0 {
+		a.cond.Wait()
+	}
+	a.mtx.Unlock()
+}
+
+// close drains outstanding batches and shuts down the producer
+func (a *asyncProducer) close() {
+	a.closeMtx.Lock()
+	if a.closed {
+		a.closeMtx.Unlock()
+		return
+	}
+	a.closed = true
+	a.closeMtx.Unlock()
+
+	a.p.AsyncClose()
+	<-a.done
+}
@@ -3,7 +3,10 @@ package kafka
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/google/uuid"
@@ -11,13 +14,17 @@ import (
 	"github.com/micro/go-micro/v2/codec/json"
 	"github.com/micro/go-micro/v2/config/cmd"
 	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-plugins/broker/kafka/v2/internal/expiration"
+	"github.com/micro/go-plugins/broker/kafka/v2/internal/pool"
 )
 
 type kBroker struct {
 	addrs []string
 
-	c sarama.Client
-	p sarama.SyncProducer
+	c    sarama.Client
+	p    sarama.SyncProducer
+	ap   *asyncProducer
+	pool *pool.Pool
 
 	sc []sarama.Client
 
@@ -86,6 +93,10 @@ func (k *kBroker) Connect() error {
 		return nil
 	}
 
+	if err := k.Validate(); err != nil {
+		return err
+	}
+
 	k.scMutex.Lock()
 	if k.c != nil {
 		k.scMutex.Unlock()
@@ -100,19 +111,55 @@ func (k *kBroker) Connect() error {
 	pconfig.Producer.Return.Successes = true
 	pconfig.Producer.Return.Errors = true
 
+	onError, async := k.opts.Context.Value(asyncProducerKey{}).(AsyncErrorHandler)
+	if async {
+		if d, ok := k.opts.Context.Value(producerLingerKey{}).(time.Duration); ok {
+			pconfig.Producer.Flush.Frequency = d
+		}
+		if n, ok := k.opts.Context.Value(producerBatchSizeKey{}).(int); ok {
+			pconfig.Producer.Flush.Messages = n
+		}
+	}
+	if cc, ok := k.opts.Context.Value(producerCompressionKey{}).(sarama.CompressionCodec); ok {
+		pconfig.Producer.Compression = cc
+	}
+
 	c, err := sarama.NewClient(k.addrs, pconfig)
 	if err != nil {
 		return err
 	}
 
-	p, err := sarama.NewSyncProducerFromClient(c)
+	var (
+		p  sarama.SyncProducer
+		ap *asyncProducer
+	)
+	// the sync producer also serves dead lettering in async mode
+	p, err = sarama.NewSyncProducerFromClient(c)
 	if err != nil {
 		return err
 	}
+	if async {
+		if ap, err = newAsyncProducer(c, onError); err != nil {
+			p.Close()
+			return err
+		}
+	}
+
+	var pp *pool.Pool
+	if size, _ := k.opts.Context.Value(producerPoolKey{}).(int); size > 1 && !async {
+		if pp, err = pool.New(size, func() (pool.Member, error) {
+			return newPooledProducer(k.addrs, pconfig)
+		}); err != nil {
+			p.Close()
+			return err
+		}
+	}
 
 	k.scMutex.Lock()
 	k.c = c
 	k.p = p
+	k.ap = ap
+	k.pool = pp
 	k.sc = make([]sarama.Client, 0)
 	k.connected = true
 	defer k.scMutex.Unlock()
@@ -127,7 +174,15 @@ func (k *kBroker) Disconnect() error {
 		client.Close()
 	}
 	k.sc = nil
-	k.p.Close()
+	if k.ap != nil {
+		k.ap.close()
+	}
+	if k.pool != nil {
+		k.pool.Close()
+	}
+	if k.p != nil {
+		k.p.Close()
+	}
 	if err := k.c.Close(); err != nil {
 		return err
 	}
@@ -150,6 +205,37 @@ func (k *kBroker) Init(opts ...broker.Option) error {
 		cAddrs = []string{"127.0.0.1:9092"}
 	}
 	k.addrs = cAddrs
+	return k.Validate()
+}
+
+// Validate checks the options for mistakes which would otherwise only surface on
+// connect, such as addresses without a port or an invalid sarama config
+func (k *kBroker) Validate() error {
+	for _, addr := range k.addrs {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid address %q: %v", addr, err)
+		}
+	}
+
+	if n, ok := k.opts.Context.Value(producerPoolKey{}).(int); ok && n < 0 {
+		return fmt.Errorf("invalid producer pool size %d", n)
+	}
+
+	// the producer options are applied to a copy, as on connect
+	config := *k.getBrokerConfig()
+	if cc, ok := k.opts.Context.Value(producerCompressionKey{}).(sarama.CompressionCodec); ok {
+		config.Producer.Compression = cc
+	}
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid broker config: %v", err)
+	}
+
+	if c, ok := k.opts.Context.Value(clusterConfigKey{}).(*sarama.Config); ok {
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("invalid cluster config: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -158,6 +244,52 @@ func (k *kBroker) Options() broker.Options {
 }
 
 func (k *kBroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	options := broker.PublishOptions{
+		Context: context.Background(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	if d, ok := expiration.FromOptions(options); ok {
+		msg = expiration.SetHeader(msg, d)
+	}
+
+	b, err := k.opts.Codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if k.ap != nil {
+		if err := k.ap.send(&sarama.ProducerMessage{
+			Topic:    topic,
+			Value:    sarama.ByteEncoder(b),
+			Metadata: msg,
+		}); err != nil {
+			return err
+		}
+		if f, _ := options.Context.Value(flushOnPublishKey{}).(bool); f {
+			k.ap.flush()
+		}
+		return nil
+	}
+	if k.pool != nil {
+		return k.pool.Do(func(m pool.Member) error {
+			return m.(*pooledProducer).send(&sarama.ProducerMessage{
+				Topic: topic,
+				Value: sarama.ByteEncoder(b),
+			})
+		})
+	}
+	_, _, err = k.p.SendMessage(&sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(b),
+	})
+	return err
+}
+
+// publishSync publishes through the sync producer, which is also created along
+// with the async producer, returning once the message is delivered
+func (k *kBroker) publishSync(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
 	b, err := k.opts.Codec.Marshal(msg)
 	if err != nil {
 		return err
@@ -169,9 +301,30 @@ func (k *kBroker) Publish(topic string, msg *broker.Message, opts ...broker.Publ
 	return err
 }
 
-func (k *kBroker) getSaramaClusterClient(topic string) (sarama.Client, error) {
+// Flush waits until every message queued by the async producer is delivered
+func (k *kBroker) Flush() error {
+	if k.ap != nil {
+		k.ap.flush()
+	}
+	return nil
+}
+
+func (k *kBroker) getSaramaClusterClient(opt broker.SubscribeOptions) (sarama.Client, error) {
 	config := k.getClusterConfig()
-	cs, err := sarama.NewClient(k.addrs, config)
+	if c, ok := opt.Context.Value(subscribeConfigKey{}).(*sarama.Config); ok {
+		config = c
+	}
+
+	// copy the config so per subscriber settings don't leak into the shared one
+	cfg := *config
+	if s, ok := opt.Context.Value(rebalanceStrategyKey{}).(sarama.BalanceStrategy); ok {
+		cfg.Consumer.Group.Rebalance.Strategy = s
+	}
+	if o, ok := opt.Context.Value(initialOffsetKey{}).(int64); ok {
+		cfg.Consumer.Offsets.Initial = o
+	}
+
+	cs, err := sarama.NewClient(k.addrs, &cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -185,12 +338,13 @@ func (k *kBroker) Subscribe(topic string, handler broker.Handler, opts ...broker
 	opt := broker.SubscribeOptions{
 		AutoAck: true,
 		Queue:   uuid.New().String(),
+		Context: context.Background(),
 	}
 	for _, o := range opts {
 		o(&opt)
 	}
 	// we need to create a new client per consumer
-	c, err := k.getSaramaClusterClient(topic)
+	c, err := k.getSaramaClusterClient(opt)
 	if err != nil {
 		return nil, err
 	}
@@ -203,6 +357,7 @@ func (k *kBroker) Subscribe(topic string, handler broker.Handler, opts ...broker
 		subopts: opt,
 		kopts:   k.opts,
 		cg:      cg,
+		publish: k.publishSync,
 	}
 	ctx := context.Background()
 	topics := []string{topic}
@@ -255,10 +410,15 @@ func NewBroker(opts ...broker.Option) broker.Broker {
 		cAddrs = []string{"127.0.0.1:9092"}
 	}
 
-	return &kBroker{
+	k := &kBroker{
 		addrs: cAddrs,
 		opts:  options,
 	}
+	// the broker can't be returned with an error, Init and Connect return it
+	if err := k.Validate(); err != nil {
+		log.Errorf("[kafka] invalid options: %v", err)
+	}
+	return k
 }
 
 func (k *kBroker) getBrokerConfig() *sarama.Config {
@@ -2,10 +2,13 @@ package kafka
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/micro/go-micro/v2/broker"
 	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-plugins/broker/kafka/v2/internal/expiration"
 )
 
 var (
@@ -24,6 +27,51 @@ func ClusterConfig(c *sarama.Config) broker.Option {
 	return setBrokerOption(clusterConfigKey{}, c)
 }
 
+type asyncProducerKey struct{}
+type producerLingerKey struct{}
+type producerBatchSizeKey struct{}
+type producerCompressionKey struct{}
+
+// AsyncProducer enables batched asynchronous publishing. Publish returns as soon
+// as the message is queued and delivery failures are passed to fn. Use the Flusher
+// interface to wait for queued messages, Disconnect drains any outstanding batches
+func AsyncProducer(fn AsyncErrorHandler) broker.Option {
+	return setBrokerOption(asyncProducerKey{}, fn)
+}
+
+type flushOnPublishKey struct{}
+
+// FlushOnPublish makes a publish through the async producer block until all queued
+// messages, including this one, are delivered
+func FlushOnPublish() broker.PublishOption {
+	return setPublishOption(flushOnPublishKey{}, true)
+}
+
+type producerPoolKey struct{}
+
+// ProducerPool publishes through a pool of sync producers of the given size, each
+// with a client of its own, rather than a single producer so concurrent publishers
+// don't wait for each other. Producers which lost their brokers are replaced. The
+// async producer batches messages already and isn't pooled
+func ProducerPool(size int) broker.Option {
+	return setBrokerOption(producerPoolKey{}, size)
+}
+
+// ProducerLinger sets how long the async producer waits to fill a batch before sending it
+func ProducerLinger(d time.Duration) broker.Option {
+	return setBrokerOption(producerLingerKey{}, d)
+}
+
+// ProducerBatchSize sets the number of messages which triggers sending a batch
+func ProducerBatchSize(n int) broker.Option {
+	return setBrokerOption(producerBatchSizeKey{}, n)
+}
+
+// ProducerCompression sets the compression codec used for produced batches
+func ProducerCompression(c sarama.CompressionCodec) broker.Option {
+	return setBrokerOption(producerCompressionKey{}, c)
+}
+
 type subscribeContextKey struct{}
 
 // SubscribeContext set the context for broker.SubscribeOption
@@ -37,6 +85,71 @@ func SubscribeConfig(c *sarama.Config) broker.SubscribeOption {
 	return setSubscribeOption(subscribeConfigKey{}, c)
 }
 
+type rebalanceStrategyKey struct{}
+type initialOffsetKey struct{}
+type partitionsAssignedKey struct{}
+type partitionsRevokedKey struct{}
+
+// RebalanceFunc is called with the partitions claimed by a consumer, keyed by topic
+type RebalanceFunc func(claims map[string][]int32)
+
+// RebalanceStrategy sets the partition assignment strategy of the consumer group,
+// e.g sarama.BalanceStrategySticky, sarama.BalanceStrategyRoundRobin or sarama.BalanceStrategyRange
+func RebalanceStrategy(s sarama.BalanceStrategy) broker.SubscribeOption {
+	return setSubscribeOption(rebalanceStrategyKey{}, s)
+}
+
+// InitialOffset sets the offset used when the consumer group has no committed offset,
+// either sarama.OffsetOldest or sarama.OffsetNewest
+func InitialOffset(offset int64) broker.SubscribeOption {
+	return setSubscribeOption(initialOffsetKey{}, offset)
+}
+
+// PartitionsAssigned sets a callback invoked once partitions are assigned to the
+// subscriber, before any message is consumed
+func PartitionsAssigned(fn RebalanceFunc) broker.SubscribeOption {
+	return setSubscribeOption(partitionsAssignedKey{}, fn)
+}
+
+// PartitionsRevoked sets a callback invoked before partitions are revoked during a
+// rebalance, after all handlers for the claimed partitions have returned. Use it to
+// drain in-flight work before another member picks up the partitions
+func PartitionsRevoked(fn RebalanceFunc) broker.SubscribeOption {
+	return setSubscribeOption(partitionsRevokedKey{}, fn)
+}
+
+type maxRetriesKey struct{}
+type retryBackoffKey struct{}
+type deadLetterTopicKey struct{}
+
+// DefaultRetryBackoff is the delay before the first retry of a failed message
+var DefaultRetryBackoff = 100 * time.Millisecond
+
+// MaxRetries sets how many times a message is redelivered to the handler after it
+// returned an error. The delay between attempts starts at RetryBackoff and doubles
+func MaxRetries(n int) broker.SubscribeOption {
+	return setSubscribeOption(maxRetriesKey{}, n)
+}
+
+// RetryBackoff sets the delay before the first retry, defaults to DefaultRetryBackoff
+func RetryBackoff(d time.Duration) broker.SubscribeOption {
+	return setSubscribeOption(retryBackoffKey{}, d)
+}
+
+// DeadLetterTopic sets the topic messages are published to once the handler has
+// failed and all retries are exhausted. The original topic and the last error are
+// added to the message headers
+func DeadLetterTopic(topic string) broker.SubscribeOption {
+	return setSubscribeOption(deadLetterTopicKey{}, topic)
+}
+
+// Expiration sets a time to live for the published message. Kafka has no
+// per-message TTL so the deadline is sent as a message header and expired
+// messages are marked as consumed without being handled
+func Expiration(d time.Duration) broker.PublishOption {
+	return expiration.Expiration(d)
+}
+
 // consumerGroupHandler is the implementation of sarama.ConsumerGroupHandler
 type consumerGroupHandler struct {
 	handler broker.Handler
@@ -44,10 +157,23 @@ type consumerGroupHandler struct {
 	kopts   broker.Options
 	cg      sarama.ConsumerGroup
 	sess    sarama.ConsumerGroupSession
+	publish func(topic string, msg *broker.Message, opts ...broker.PublishOption) error
+}
+
+func (h *consumerGroupHandler) Setup(sess sarama.ConsumerGroupSession) error {
+	if fn, ok := h.subopts.Context.Value(partitionsAssignedKey{}).(RebalanceFunc); ok {
+		fn(sess.Claims())
+	}
+	return nil
+}
+
+func (h *consumerGroupHandler) Cleanup(sess sarama.ConsumerGroupSession) error {
+	if fn, ok := h.subopts.Context.Value(partitionsRevokedKey{}).(RebalanceFunc); ok {
+		fn(sess.Claims())
+	}
+	return nil
 }
 
-func (*consumerGroupHandler) Setup(_ sarama.ConsumerGroupSession) error   { return nil }
-func (*consumerGroupHandler) Cleanup(_ sarama.ConsumerGroupSession) error { return nil }
 func (h *consumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 	for msg := range claim.Messages() {
 		var m broker.Message
@@ -65,11 +191,28 @@ func (h *consumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, cl
 			continue
 		}
 
-		err := h.handler(p)
+		if expiration.Expired(m.Header) {
+			log.Debugf("[kafka]: dropping expired message on topic %s", msg.Topic)
+			sess.MarkMessage(msg, "")
+			continue
+		}
+
+		err := h.handle(sess.Context(), p)
 		if err == nil && h.subopts.AutoAck {
 			sess.MarkMessage(msg, "")
 		} else if err != nil {
 			p.err = err
+			if sess.Context().Err() != nil {
+				// the session ended during a retry, the message is redelivered to the next one
+				return nil
+			}
+			if topic, ok := h.subopts.Context.Value(deadLetterTopicKey{}).(string); ok {
+				// marking later messages would skip this one, end the session instead
+				if derr := h.deadLetter(topic, p); derr != nil {
+					return fmt.Errorf("failed to publish to dead letter topic %s: %v", topic, derr)
+				}
+				sess.MarkMessage(msg, "")
+			}
 			if eh != nil {
 				eh(p)
 			} else {
@@ -79,3 +222,38 @@ func (h *consumerGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, cl
 	}
 	return nil
 }
+
+// handle calls the handler, retrying with exponential backoff when configured until
+// the context is done
+func (h *consumerGroupHandler) handle(ctx context.Context, p *publication) error {
+	retries, _ := h.subopts.Context.Value(maxRetriesKey{}).(int)
+	backoff, ok := h.subopts.Context.Value(retryBackoffKey{}).(time.Duration)
+	if !ok {
+		backoff = DefaultRetryBackoff
+	}
+
+	err := h.handler(p)
+	for i := 0; err != nil && i < retries; i++ {
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		err = h.handler(p)
+	}
+	return err
+}
+
+// deadLetter publishes a message which could not be handled to the dead letter topic,
+// synchronously even with the async producer so the message is only marked once it's
+// delivered
+func (h *consumerGroupHandler) deadLetter(topic string, p *publication) error {
+	header := make(map[string]string, len(p.m.Header)+2)
+	for k, v := range p.m.Header {
+		header[k] = v
+	}
+	header["Micro-Topic"] = p.t
+	header["Micro-Error"] = p.err.Error()
+	return h.publish(topic, &broker.Message{Header: header, Body: p.m.Body})
+}
@@ -0,0 +1,50 @@
+package kafka
+
+import (
+	"sync/atomic"
+
+	"github.com/Shopify/sarama"
+)
+
+// pooledProducer is a sync producer of the producer pool with a client of its own,
+// so the producers of the pool don't share the connections to the brokers
+type pooledProducer struct {
+	sarama.SyncProducer
+	c sarama.Client
+	// broken is set once a publish failed as the brokers are unreachable
+	broken int32
+}
+
+func newPooledProducer(addrs []string, config *sarama.Config) (*pooledProducer, error) {
+	c, err := sarama.NewClient(addrs, config)
+	if err != nil {
+		return nil, err
+	}
+	p, err := sarama.NewSyncProducerFromClient(c)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &pooledProducer{SyncProducer: p, c: c}, nil
+}
+
+func (p *pooledProducer) send(msg *sarama.ProducerMessage) error {
+	_, _, err := p.SendMessage(msg)
+	switch err {
+	case sarama.ErrOutOfBrokers, sarama.ErrClosedClient, sarama.ErrNotConnected:
+		atomic.StoreInt32(&p.broken, 1)
+	}
+	return err
+}
+
+// Healthy reports whether the producer can still reach the brokers
+func (p *pooledProducer) Healthy() bool {
+	return atomic.LoadInt32(&p.broken) == 0 && !p.c.Closed()
+}
+
+// Close closes the producer along with its client, which producers created from a
+// client leave open
+func (p *pooledProducer) Close() error {
+	p.SyncProducer.Close()
+	return p.c.Close()
+}
@@ -0,0 +1,148 @@
+package kinesis
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+/*
+	The checkpointer keeps an item per queue and shard in a DynamoDB table holding
+	the sequence number of the last acknowledged record, the subscriber owning the
+	shard and when its lease expires. Leases are taken with conditional writes, a
+	subscriber only takes a shard which has no owner or whose lease expired, and
+	renews its lease with every checkpoint. Shards read to the end are
+	checkpointed as SHARD_END, so their children can be read.
+*/
+
+var errLeaseLost = errors.New("shard lease lost")
+
+type checkpointer struct {
+	db    *dynamodb.DynamoDB
+	table string
+	// prefix of the item ids, made of the queue and stream
+	prefix string
+	// owner identifies the subscriber
+	owner string
+	lease time.Duration
+}
+
+func (c *checkpointer) key(shard string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"id": {S: aws.String(c.prefix + "/" + shard)},
+	}
+}
+
+func expiry(t time.Time) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10))}
+}
+
+func conditionFailed(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
+
+// acquire takes the lease of the shard and returns its checkpoint, ok is false
+// when another subscriber holds the lease
+func (c *checkpointer) acquire(shard string) (string, bool, error) {
+	now := time.Now()
+	out, err := c.db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:           aws.String(c.table),
+		Key:                 c.key(shard),
+		UpdateExpression:    aws.String("SET #owner = :owner, #expires = :expires"),
+		ConditionExpression: aws.String("attribute_not_exists(id) OR #expires < :now OR #owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{
+			"#owner":   aws.String("owner"),
+			"#expires": aws.String("expires"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner":   {S: aws.String(c.owner)},
+			":expires": expiry(now.Add(c.lease)),
+			":now":     expiry(now),
+		},
+		ReturnValues: aws.String(dynamodb.ReturnValueAllNew),
+	})
+	if conditionFailed(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+
+	var seq string
+	if v, ok := out.Attributes["seq"]; ok && v.S != nil {
+		seq = *v.S
+	}
+	return seq, true, nil
+}
+
+// get returns the checkpoint of the shard without taking its lease
+func (c *checkpointer) get(shard string) (string, error) {
+	out, err := c.db.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(c.table),
+		Key:            c.key(shard),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	if v, ok := out.Item["seq"]; ok && v.S != nil {
+		return *v.S, nil
+	}
+	return "", nil
+}
+
+// save stores the checkpoint of the shard and renews the lease, an empty sequence
+// number only renews the lease
+func (c *checkpointer) save(shard, seq string) error {
+	update := "SET #expires = :expires"
+	values := map[string]*dynamodb.AttributeValue{
+		":owner":   {S: aws.String(c.owner)},
+		":expires": expiry(time.Now().Add(c.lease)),
+	}
+	if len(seq) > 0 {
+		update += ", seq = :seq"
+		values[":seq"] = &dynamodb.AttributeValue{S: aws.String(seq)}
+	}
+
+	_, err := c.db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:           aws.String(c.table),
+		Key:                 c.key(shard),
+		UpdateExpression:    aws.String(update),
+		ConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{
+			"#owner":   aws.String("owner"),
+			"#expires": aws.String("expires"),
+		},
+		ExpressionAttributeValues: values,
+	})
+	if conditionFailed(err) {
+		return errLeaseLost
+	}
+	return err
+}
+
+// release gives up the lease so another subscriber can take the shard right away
+func (c *checkpointer) release(shard string) error {
+	_, err := c.db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:           aws.String(c.table),
+		Key:                 c.key(shard),
+		UpdateExpression:    aws.String("SET #expires = :expires"),
+		ConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{
+			"#owner":   aws.String("owner"),
+			"#expires": aws.String("expires"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner":   {S: aws.String(c.owner)},
+			":expires": expiry(time.Unix(0, 0)),
+		},
+	})
+	if conditionFailed(err) {
+		return nil
+	}
+	return err
+}
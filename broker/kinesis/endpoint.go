@@ -0,0 +1,13 @@
+package kinesis
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/micro/go-plugins/broker/kinesis/v2/internal/awsendpoint"
+)
+
+// endpointConfig returns the aws config applying the endpoint options
+func (b *kBroker) endpointConfig() aws.Config {
+	endpoint, _ := b.options.Context.Value(endpointKey{}).(string)
+	insecure, _ := b.options.Context.Value(insecureSkipVerifyKey{}).(bool)
+	return awsendpoint.Config(endpoint, b.options.TLSConfig, insecure)
+}
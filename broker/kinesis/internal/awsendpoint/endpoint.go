@@ -0,0 +1,61 @@
+// Package awsendpoint configures the aws clients of the plugins for custom
+// endpoints, like localstack or a private VPC endpoint
+package awsendpoint
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Config returns the aws config using the endpoint, an empty endpoint keeps the
+// default of the service. The tls config is used for the connections, with
+// insecure set the certificate of the endpoint isn't verified
+func Config(endpoint string, tlsConfig *tls.Config, insecure bool) aws.Config {
+	var c aws.Config
+
+	if len(endpoint) > 0 {
+		c.Endpoint = aws.String(endpoint)
+	}
+
+	if insecure {
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		} else {
+			tlsConfig = tlsConfig.Clone()
+		}
+		tlsConfig.InsecureSkipVerify = true
+	}
+	if tlsConfig != nil {
+		c.HTTPClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		}
+	}
+
+	return c
+}
+
+// PathStyle points the url returned by the service, e.g. a queue url, at the
+// endpoint. Urls which can't be parsed are returned as they are
+func PathStyle(endpoint, u string) string {
+	if len(endpoint) == 0 {
+		return u
+	}
+
+	eu, err := url.Parse(endpoint)
+	if err != nil {
+		return u
+	}
+	pu, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	pu.Scheme = eu.Scheme
+	pu.Host = eu.Host
+	return pu.String()
+}
@@ -0,0 +1,732 @@
+// Package kinesis provides an AWS Kinesis Data Streams broker
+package kinesis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/micro/go-micro/v2/broker"
+	"github.com/micro/go-micro/v2/codec/json"
+	"github.com/micro/go-micro/v2/config/cmd"
+	log "github.com/micro/go-micro/v2/logger"
+)
+
+/*
+	Topics are Kinesis streams. Records carry the encoded broker message since
+	records have no headers. A subscriber reads every shard of the stream, either
+	by polling with the shared throughput of the shards or, with enhanced fan out,
+	through a registered stream consumer. Subscribers with a queue and a checkpoint
+	table lease the shards through the table, so the subscribers of a queue share
+	the shards and continue from the last acknowledged record after a restart.
+	A record whose handler fails is retried from the last checkpoint.
+
+	Resharding closes a shard and opens child shards continuing its partition
+	keys. Children are only read once their parents were read to the end, which
+	the checkpoint records for the other subscribers of the queue, and start at
+	the oldest record so the records of a key stay in order. Subscribers without
+	checkpoints start children at the time they subscribed unless TrimHorizon is
+	set, so a new subscriber doesn't replay the records of a child shard.
+*/
+
+var (
+	// DefaultPollInterval is how often shards are polled with shared throughput
+	DefaultPollInterval = time.Second
+	// DefaultLeaseDuration is how long a shard lease lasts without being renewed
+	DefaultLeaseDuration = time.Minute
+	// DefaultShardRefresh is how often the shards of a stream are listed to pick
+	// up new shards after resharding and shards whose lease expired
+	DefaultShardRefresh = 30 * time.Second
+	// DefaultRetryDelay is how long a shard waits before retrying a failed record
+	DefaultRetryDelay = time.Second
+)
+
+// shardEnd is checkpointed for shards read to the end
+const shardEnd = "SHARD_END"
+
+type kBroker struct {
+	options broker.Options
+	svc     *kinesis.Kinesis
+	db      *dynamodb.DynamoDB
+}
+
+type subscriber struct {
+	b       *kBroker
+	topic   string
+	options broker.SubscribeOptions
+	handler broker.Handler
+	id      string
+
+	ckpt         *checkpointer
+	consumerARN  string
+	unique       bool
+	pollInterval time.Duration
+	trimHorizon  bool
+	// when the subscriber started, children of shards without a checkpoint start there
+	started time.Time
+
+	exit chan bool
+	wg   sync.WaitGroup
+
+	sync.Mutex
+	shards map[string]bool
+	// closed shards which were read to the end
+	closed map[string]bool
+}
+
+// shardReader tracks the acknowledged position of a shard
+type shardReader struct {
+	// the shard is a child of shards which were read to the end
+	child bool
+
+	sync.Mutex
+	acked string
+
+	// the last checkpoint
+	saved   string
+	renewed time.Time
+}
+
+type publication struct {
+	topic string
+	m     *broker.Message
+	seq   string
+	r     *shardReader
+	err   error
+}
+
+func init() {
+	cmd.DefaultBrokers["kinesis"] = NewBroker
+}
+
+func randomID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (p *publication) Topic() string {
+	return p.topic
+}
+
+func (p *publication) Message() *broker.Message {
+	return p.m
+}
+
+// Ack marks the record as processed, the shard checkpoint moves past it
+func (p *publication) Ack() error {
+	p.r.Lock()
+	p.r.acked = p.seq
+	p.r.Unlock()
+	return nil
+}
+
+func (p *publication) Error() error {
+	return p.err
+}
+
+func (s *subscriber) Options() broker.SubscribeOptions {
+	return s.options
+}
+
+func (s *subscriber) Topic() string {
+	return s.topic
+}
+
+func (s *subscriber) Unsubscribe() error {
+	select {
+	case <-s.exit:
+		return nil
+	default:
+		close(s.exit)
+	}
+	s.wg.Wait()
+
+	if s.unique && len(s.consumerARN) > 0 {
+		_, err := s.b.svc.DeregisterStreamConsumer(&kinesis.DeregisterStreamConsumerInput{
+			ConsumerARN: aws.String(s.consumerARN),
+		})
+		return err
+	}
+	return nil
+}
+
+// run starts reading shards as they are discovered or their leases become available
+func (s *subscriber) run() {
+	defer s.wg.Done()
+
+	t := time.NewTicker(DefaultShardRefresh)
+	defer t.Stop()
+
+	for {
+		if err := s.refresh(); err != nil {
+			log.Errorf("[kinesis] failed to list shards of %s: %v", s.topic, err)
+		}
+
+		select {
+		case <-s.exit:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (s *subscriber) refresh() error {
+	shards, err := s.listShards()
+	if err != nil {
+		return err
+	}
+
+	listed := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		listed[*shard.ShardId] = true
+	}
+
+	for _, shard := range shards {
+		id := *shard.ShardId
+
+		s.Lock()
+		running := s.shards[id] || s.closed[id]
+		s.Unlock()
+		if running {
+			continue
+		}
+
+		// children wait for their parents to be read to the end, parents which
+		// are no longer listed expired with the retention of the stream
+		child, ready := false, true
+		for _, parent := range []*string{shard.ParentShardId, shard.AdjacentParentShardId} {
+			if parent == nil || !listed[*parent] {
+				continue
+			}
+			child = true
+			ended, err := s.ended(*parent)
+			if err != nil {
+				return err
+			}
+			if !ended {
+				ready = false
+			}
+		}
+		if !ready {
+			continue
+		}
+
+		var seq string
+		if s.ckpt != nil {
+			cs, ok, err := s.ckpt.acquire(id)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if cs == shardEnd {
+				s.ckpt.release(id)
+				s.markClosed(id)
+				continue
+			}
+			seq = cs
+		}
+
+		s.Lock()
+		s.shards[id] = true
+		s.Unlock()
+
+		s.wg.Add(1)
+		go s.read(id, seq, child)
+	}
+
+	return nil
+}
+
+func (s *subscriber) listShards() ([]*kinesis.Shard, error) {
+	var shards []*kinesis.Shard
+	input := &kinesis.ListShardsInput{StreamName: aws.String(s.topic)}
+
+	for {
+		out, err := s.b.svc.ListShards(input)
+		if err != nil {
+			return nil, err
+		}
+		shards = append(shards, out.Shards...)
+
+		if out.NextToken == nil {
+			return shards, nil
+		}
+		input = &kinesis.ListShardsInput{NextToken: out.NextToken}
+	}
+}
+
+// ended returns whether the shard was read to the end by the subscriber or, with
+// a checkpoint, by another subscriber of the queue
+func (s *subscriber) ended(shard string) (bool, error) {
+	s.Lock()
+	closed := s.closed[shard]
+	s.Unlock()
+	if closed || s.ckpt == nil {
+		return closed, nil
+	}
+
+	seq, err := s.ckpt.get(shard)
+	if err != nil {
+		return false, err
+	}
+	if seq != shardEnd {
+		return false, nil
+	}
+	s.markClosed(shard)
+	return true, nil
+}
+
+// read consumes the shard until it is closed, the lease is lost or the subscriber exits
+func (s *subscriber) read(shard, seq string, child bool) {
+	defer s.wg.Done()
+	defer func() {
+		s.Lock()
+		delete(s.shards, shard)
+		s.Unlock()
+	}()
+
+	r := &shardReader{child: child, acked: seq, saved: seq, renewed: time.Now()}
+
+	var err error
+	if len(s.consumerARN) > 0 {
+		err = s.subscribeShard(shard, r)
+	} else {
+		err = s.pollShard(shard, r)
+	}
+
+	if err != nil && err != errLeaseLost {
+		log.Errorf("[kinesis] stopped reading shard %s of %s: %v", shard, s.topic, err)
+	}
+
+	if s.ckpt != nil && err != errLeaseLost {
+		s.ckpt.release(shard)
+	}
+}
+
+func (s *subscriber) markClosed(shard string) {
+	s.Lock()
+	s.closed[shard] = true
+	s.Unlock()
+}
+
+// end marks the shard as read to the end, so its children are read
+func (s *subscriber) end(shard string) error {
+	if s.ckpt != nil {
+		if err := s.ckpt.save(shard, shardEnd); err != nil {
+			return err
+		}
+	}
+	s.markClosed(shard)
+	return nil
+}
+
+// position returns where to continue reading a shard
+func (s *subscriber) position(r *shardReader) *kinesis.StartingPosition {
+	r.Lock()
+	defer r.Unlock()
+
+	switch {
+	case len(r.acked) > 0:
+		return &kinesis.StartingPosition{
+			Type:           aws.String(kinesis.ShardIteratorTypeAfterSequenceNumber),
+			SequenceNumber: aws.String(r.acked),
+		}
+	case s.trimHorizon, r.child && s.ckpt != nil:
+		return &kinesis.StartingPosition{
+			Type: aws.String(kinesis.ShardIteratorTypeTrimHorizon),
+		}
+	case r.child:
+		return &kinesis.StartingPosition{
+			Type:      aws.String(kinesis.ShardIteratorTypeAtTimestamp),
+			Timestamp: aws.Time(s.started),
+		}
+	}
+	return &kinesis.StartingPosition{
+		Type: aws.String(kinesis.ShardIteratorTypeLatest),
+	}
+}
+
+// checkpoint saves the acknowledged position and renews the lease, unchanged
+// positions are only saved to renew the lease in time
+func (s *subscriber) checkpoint(shard string, r *shardReader) error {
+	if s.ckpt == nil {
+		return nil
+	}
+
+	r.Lock()
+	seq := r.acked
+	r.Unlock()
+
+	if seq == r.saved && time.Since(r.renewed) < s.ckpt.lease/3 {
+		return nil
+	}
+	if err := s.ckpt.save(shard, seq); err != nil {
+		return err
+	}
+	r.saved = seq
+	r.renewed = time.Now()
+	return nil
+}
+
+// handle passes the records to the handler, it returns false when a handler failed
+func (s *subscriber) handle(records []*kinesis.Record, r *shardReader) bool {
+	for _, rec := range records {
+		p := &publication{
+			topic: s.topic,
+			m:     new(broker.Message),
+			seq:   *rec.SequenceNumber,
+			r:     r,
+		}
+
+		// records which can't be decoded are skipped
+		if err := s.b.options.Codec.Unmarshal(rec.Data, p.m); err != nil {
+			log.Errorf("[kinesis] failed to decode record %s of %s: %v", p.seq, s.topic, err)
+			p.Ack()
+			continue
+		}
+
+		if p.err = s.handler(p); p.err != nil {
+			return false
+		}
+		if s.options.AutoAck {
+			p.Ack()
+		}
+	}
+	return true
+}
+
+func (s *subscriber) sleep(d time.Duration) bool {
+	select {
+	case <-s.exit:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// pollShard reads the shard with GetRecords
+func (s *subscriber) pollShard(shard string, r *shardReader) error {
+	var iterator *string
+
+	for {
+		if iterator == nil {
+			pos := s.position(r)
+			out, err := s.b.svc.GetShardIterator(&kinesis.GetShardIteratorInput{
+				StreamName:             aws.String(s.topic),
+				ShardId:                aws.String(shard),
+				ShardIteratorType:      pos.Type,
+				StartingSequenceNumber: pos.SequenceNumber,
+				Timestamp:              pos.Timestamp,
+			})
+			if err != nil {
+				return err
+			}
+			iterator = out.ShardIterator
+		}
+
+		out, err := s.b.svc.GetRecords(&kinesis.GetRecordsInput{
+			ShardIterator: iterator,
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == kinesis.ErrCodeExpiredIteratorException {
+				iterator = nil
+				continue
+			}
+			return err
+		}
+
+		ok := s.handle(out.Records, r)
+		if err := s.checkpoint(shard, r); err != nil {
+			return err
+		}
+
+		switch {
+		case !ok:
+			// retry from the last acknowledged record
+			iterator = nil
+		case out.NextShardIterator == nil:
+			// the shard was closed by resharding and is fully read
+			return s.end(shard)
+		default:
+			iterator = out.NextShardIterator
+		}
+
+		delay := s.pollInterval
+		if iterator == nil && delay < DefaultRetryDelay {
+			delay = DefaultRetryDelay
+		}
+		if !s.sleep(delay) {
+			return nil
+		}
+	}
+}
+
+// subscribeShard reads the shard with SubscribeToShard, subscriptions last five
+// minutes after which it resubscribes from where it left off
+func (s *subscriber) subscribeShard(shard string, r *shardReader) error {
+	for {
+		out, err := s.b.svc.SubscribeToShard(&kinesis.SubscribeToShardInput{
+			ConsumerARN:      aws.String(s.consumerARN),
+			ShardId:          aws.String(shard),
+			StartingPosition: s.position(r),
+		})
+		if err != nil {
+			return err
+		}
+
+		closed, err := s.readEvents(out.EventStream, shard, r)
+		out.EventStream.Close()
+		if err != nil {
+			return err
+		}
+		if closed {
+			return s.end(shard)
+		}
+
+		select {
+		case <-s.exit:
+			return nil
+		default:
+		}
+	}
+}
+
+// readEvents handles the events of a shard subscription until it ends, closed is
+// true when the shard was closed by resharding and is fully read
+func (s *subscriber) readEvents(stream *kinesis.SubscribeToShardEventStream, shard string, r *shardReader) (bool, error) {
+	for {
+		select {
+		case <-s.exit:
+			return false, nil
+		case ev, ok := <-stream.Events():
+			if !ok {
+				return false, stream.Err()
+			}
+			e, ok := ev.(*kinesis.SubscribeToShardEvent)
+			if !ok {
+				continue
+			}
+
+			if !s.handle(e.Records, r) {
+				// resubscribe from the last acknowledged record
+				if err := s.checkpoint(shard, r); err != nil {
+					return false, err
+				}
+				s.sleep(DefaultRetryDelay)
+				return false, nil
+			}
+			if err := s.checkpoint(shard, r); err != nil {
+				return false, err
+			}
+
+			if e.ContinuationSequenceNumber == nil {
+				return true, nil
+			}
+		}
+	}
+}
+
+// registerConsumer registers the stream consumer for enhanced fan out and waits until it is active
+func (s *subscriber) registerConsumer(name string) error {
+	summary, err := s.b.svc.DescribeStreamSummary(&kinesis.DescribeStreamSummaryInput{
+		StreamName: aws.String(s.topic),
+	})
+	if err != nil {
+		return err
+	}
+	streamARN := summary.StreamDescriptionSummary.StreamARN
+
+	_, err = s.b.svc.RegisterStreamConsumer(&kinesis.RegisterStreamConsumerInput{
+		StreamARN:    streamARN,
+		ConsumerName: aws.String(name),
+	})
+	if aerr, ok := err.(awserr.Error); err != nil && (!ok || aerr.Code() != kinesis.ErrCodeResourceInUseException) {
+		return err
+	}
+
+	for i := 0; i < 60; i++ {
+		out, err := s.b.svc.DescribeStreamConsumer(&kinesis.DescribeStreamConsumerInput{
+			StreamARN:    streamARN,
+			ConsumerName: aws.String(name),
+		})
+		if err != nil {
+			return err
+		}
+		if *out.ConsumerDescription.ConsumerStatus == kinesis.ConsumerStatusActive {
+			s.consumerARN = *out.ConsumerDescription.ConsumerARN
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+
+	return fmt.Errorf("stream consumer %s did not become active", name)
+}
+
+func (b *kBroker) Options() broker.Options {
+	return b.options
+}
+
+func (b *kBroker) Address() string {
+	return ""
+}
+
+func (b *kBroker) Connect() error {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+		Config:            b.endpointConfig(),
+	}))
+
+	if c, ok := b.options.Context.Value(kinesisClientKey{}).(*kinesis.Kinesis); ok {
+		b.svc = c
+	} else {
+		b.svc = kinesis.New(sess)
+	}
+	b.db = dynamodb.New(sess)
+
+	return nil
+}
+
+// Disconnect does nothing as there's no live connection to terminate
+func (b *kBroker) Disconnect() error {
+	return nil
+}
+
+func (b *kBroker) Init(opts ...broker.Option) error {
+	for _, o := range opts {
+		o(&b.options)
+	}
+	return nil
+}
+
+// Publish puts the message as a record on the stream named by the topic
+func (b *kBroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	if b.svc == nil {
+		return errors.New("not connected")
+	}
+
+	options := broker.PublishOptions{
+		Context: context.Background(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	data, err := b.options.Codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.svc.PutRecord(&kinesis.PutRecordInput{
+		StreamName:   aws.String(topic),
+		PartitionKey: aws.String(b.partitionKey(msg, options)),
+		Data:         data,
+	})
+	return err
+}
+
+func (b *kBroker) partitionKey(msg *broker.Message, options broker.PublishOptions) string {
+	if k, ok := options.Context.Value(partitionKeyKey{}).(string); ok && len(k) > 0 {
+		return k
+	}
+	if fn, ok := b.options.Context.Value(partitionKeyFunctionKey{}).(PartitionKeyFunc); ok {
+		if k := fn(msg); len(k) > 0 {
+			return k
+		}
+	}
+	return randomID()
+}
+
+// Subscribe reads the stream named by the topic
+func (b *kBroker) Subscribe(topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	if b.svc == nil {
+		return nil, errors.New("not connected")
+	}
+
+	options := broker.SubscribeOptions{
+		AutoAck: true,
+		Context: context.Background(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	s := &subscriber{
+		b:            b,
+		topic:        topic,
+		options:      options,
+		handler:      h,
+		id:           randomID(),
+		unique:       len(options.Queue) == 0,
+		pollInterval: DefaultPollInterval,
+		started:      time.Now(),
+		exit:         make(chan bool),
+		shards:       make(map[string]bool),
+		closed:       make(map[string]bool),
+	}
+
+	if d, ok := options.Context.Value(pollIntervalKey{}).(time.Duration); ok && d > 0 {
+		s.pollInterval = d
+	}
+	s.trimHorizon, _ = options.Context.Value(trimHorizonKey{}).(bool)
+
+	if table, ok := b.options.Context.Value(checkpointTableKey{}).(string); ok && !s.unique {
+		lease := DefaultLeaseDuration
+		if d, ok := options.Context.Value(leaseDurationKey{}).(time.Duration); ok && d > 0 {
+			lease = d
+		}
+		s.ckpt = &checkpointer{
+			db:     b.db,
+			table:  table,
+			prefix: options.Queue + "/" + topic,
+			owner:  s.id,
+			lease:  lease,
+		}
+	}
+
+	if v, ok := options.Context.Value(enhancedFanOutKey{}).(bool); ok && v {
+		name := options.Queue
+		if s.unique {
+			name = "micro-" + s.id
+		}
+		if err := s.registerConsumer(name); err != nil {
+			return nil, err
+		}
+	}
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s, nil
+}
+
+func (b *kBroker) String() string {
+	return "kinesis"
+}
+
+// NewBroker creates a new kinesis broker
+func NewBroker(opts ...broker.Option) broker.Broker {
+	options := broker.Options{
+		Codec:   json.Marshaler{},
+		Context: context.Background(),
+	}
+
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return &kBroker{
+		options: options,
+	}
+}
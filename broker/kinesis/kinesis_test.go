@@ -0,0 +1,65 @@
+package kinesis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/micro/go-micro/v2/broker"
+)
+
+func TestPartitionKey(t *testing.T) {
+	b := NewBroker(PartitionKeyFunction(func(m *broker.Message) string {
+		return m.Header["id"]
+	})).(*kBroker)
+
+	publish := func(opts ...broker.PublishOption) broker.PublishOptions {
+		o := broker.PublishOptions{Context: context.Background()}
+		for _, opt := range opts {
+			opt(&o)
+		}
+		return o
+	}
+
+	msg := &broker.Message{Header: map[string]string{"id": "1"}}
+
+	if k := b.partitionKey(msg, publish(PartitionKey("2"))); k != "2" {
+		t.Fatalf("expected partition key option to win, got %s", k)
+	}
+	if k := b.partitionKey(msg, publish()); k != "1" {
+		t.Fatalf("expected partition key from function, got %s", k)
+	}
+	if k := b.partitionKey(&broker.Message{}, publish()); len(k) == 0 {
+		t.Fatal("expected random partition key")
+	}
+}
+
+func TestPosition(t *testing.T) {
+	started := time.Now()
+
+	testData := []struct {
+		s        *subscriber
+		r        *shardReader
+		expected string
+	}{
+		{&subscriber{}, &shardReader{acked: "1"}, kinesis.ShardIteratorTypeAfterSequenceNumber},
+		{&subscriber{}, &shardReader{}, kinesis.ShardIteratorTypeLatest},
+		{&subscriber{trimHorizon: true}, &shardReader{}, kinesis.ShardIteratorTypeTrimHorizon},
+		// children of shards read to the end start at their oldest record
+		{&subscriber{ckpt: &checkpointer{}}, &shardReader{child: true}, kinesis.ShardIteratorTypeTrimHorizon},
+		{&subscriber{trimHorizon: true}, &shardReader{child: true}, kinesis.ShardIteratorTypeTrimHorizon},
+		// or when the subscriber started without a checkpoint
+		{&subscriber{started: started}, &shardReader{child: true}, kinesis.ShardIteratorTypeAtTimestamp},
+	}
+
+	for _, d := range testData {
+		pos := d.s.position(d.r)
+		if *pos.Type != d.expected {
+			t.Fatalf("expected %s got %s", d.expected, *pos.Type)
+		}
+		if *pos.Type == kinesis.ShardIteratorTypeAtTimestamp && !pos.Timestamp.Equal(started) {
+			t.Fatalf("expected to start at %v got %v", started, *pos.Timestamp)
+		}
+	}
+}
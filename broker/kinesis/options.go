@@ -0,0 +1,131 @@
+package kinesis
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/micro/go-micro/v2/broker"
+)
+
+type kinesisClientKey struct{}
+type checkpointTableKey struct{}
+type partitionKeyFunctionKey struct{}
+type partitionKeyKey struct{}
+type enhancedFanOutKey struct{}
+type trimHorizonKey struct{}
+type pollIntervalKey struct{}
+type leaseDurationKey struct{}
+type endpointKey struct{}
+type insecureSkipVerifyKey struct{}
+
+// PartitionKeyFunc returns the partition key of a message
+type PartitionKeyFunc func(m *broker.Message) string
+
+// Client sets the Kinesis client used instead of initialising a new client
+func Client(c *kinesis.Kinesis) broker.Option {
+	return func(o *broker.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, kinesisClientKey{}, c)
+	}
+}
+
+// CheckpointTable stores the position of subscribers with a queue in the given DynamoDB
+// table, which needs a string partition key named id. Shards are leased through the table
+// so the subscribers of a queue share the shards of a stream
+func CheckpointTable(name string) broker.Option {
+	return func(o *broker.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, checkpointTableKey{}, name)
+	}
+}
+
+// PartitionKeyFunction sets the function used to create the partition key of a message.
+// Messages without a partition key are spread randomly across shards
+func PartitionKeyFunction(fn PartitionKeyFunc) broker.Option {
+	return func(o *broker.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, partitionKeyFunctionKey{}, fn)
+	}
+}
+
+// Endpoint overrides the AWS endpoint e.g http://localhost:4566 to run against LocalStack
+func Endpoint(url string) broker.Option {
+	return func(o *broker.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, endpointKey{}, url)
+	}
+}
+
+// InsecureSkipVerify disables verification of the endpoint TLS certificate
+func InsecureSkipVerify() broker.Option {
+	return func(o *broker.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, insecureSkipVerifyKey{}, true)
+	}
+}
+
+// PartitionKey sets the partition key of the message, messages with the same key
+// go to the same shard and are read in order. Overrides the PartitionKeyFunction
+func PartitionKey(key string) broker.PublishOption {
+	return func(o *broker.PublishOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, partitionKeyKey{}, key)
+	}
+}
+
+// EnhancedFanOut reads through a registered stream consumer with dedicated throughput
+// pushed over HTTP/2 instead of polling the shared throughput of the shards
+func EnhancedFanOut() broker.SubscribeOption {
+	return func(o *broker.SubscribeOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, enhancedFanOutKey{}, true)
+	}
+}
+
+// TrimHorizon starts reading shards without a checkpoint at the oldest record
+// instead of the latest
+func TrimHorizon() broker.SubscribeOption {
+	return func(o *broker.SubscribeOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, trimHorizonKey{}, true)
+	}
+}
+
+// PollInterval sets how often shards are polled with shared throughput, each shard
+// allows five reads a second across all consumers. Defaults to a second
+func PollInterval(d time.Duration) broker.SubscribeOption {
+	return func(o *broker.SubscribeOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, pollIntervalKey{}, d)
+	}
+}
+
+// LeaseDuration sets how long a subscriber holds a shard without renewing its lease,
+// after which another subscriber of the queue takes it over. Defaults to a minute
+func LeaseDuration(d time.Duration) broker.SubscribeOption {
+	return func(o *broker.SubscribeOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, leaseDurationKey{}, d)
+	}
+}
@@ -2,15 +2,380 @@
 package memory
 
 import (
+	"context"
+	"errors"
+	"sync"
+
 	"github.com/micro/go-micro/v2/broker"
-	"github.com/micro/go-micro/v2/broker/memory"
 	"github.com/micro/go-micro/v2/config/cmd"
+	log "github.com/micro/go-micro/v2/logger"
 )
 
+/*
+	Every topic numbers its messages with offsets starting at 0 and retains the
+	last messages, so subscribers can replay them to catch up like they would on a
+	log based broker. Subscribers of a queue share the messages round robin in the
+	order they subscribed, which keeps delivery deterministic in tests.
+*/
+
+type memoryBroker struct {
+	opts broker.Options
+
+	sync.RWMutex
+	connected bool
+	topics    map[string]*topic
+}
+
+type topic struct {
+	// next is the offset of the next message
+	next     int64
+	retained []*event
+	subs     []*subscriber
+	// cursors of the queues sharing messages round robin
+	cursors map[string]int
+}
+
+type subscriber struct {
+	topic   string
+	queue   string
+	handler broker.Handler
+	opts    broker.SubscribeOptions
+	b       *memoryBroker
+
+	sync.Mutex
+	pending []*event
+	notify  chan bool
+	exit    chan bool
+	closed  bool
+}
+
+type event struct {
+	topic  string
+	offset int64
+	msg    *broker.Message
+	err    error
+}
+
 func init() {
 	cmd.DefaultBrokers["memory"] = NewBroker
 }
 
+func (e *event) Topic() string {
+	return e.topic
+}
+
+func (e *event) Message() *broker.Message {
+	return e.msg
+}
+
+func (e *event) Ack() error {
+	return nil
+}
+
+func (e *event) Error() error {
+	return e.err
+}
+
+// Offset returns the offset of the message of an event delivered by the memory broker
+func Offset(e broker.Event) (int64, bool) {
+	ev, ok := e.(*event)
+	if !ok {
+		return 0, false
+	}
+	return ev.offset, true
+}
+
+func (m *memoryBroker) synchronous() bool {
+	s, _ := m.opts.Context.Value(synchronousKey{}).(bool)
+	return s
+}
+
+func (m *memoryBroker) Options() broker.Options {
+	return m.opts
+}
+
+func (m *memoryBroker) Address() string {
+	if len(m.opts.Addrs) > 0 {
+		return m.opts.Addrs[0]
+	}
+	return "memory"
+}
+
+func (m *memoryBroker) Connect() error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.connected = true
+	return nil
+}
+
+func (m *memoryBroker) Disconnect() error {
+	m.Lock()
+	defer m.Unlock()
+
+	if !m.connected {
+		return nil
+	}
+	m.connected = false
+
+	for _, t := range m.topics {
+		for _, sub := range t.subs {
+			sub.close()
+		}
+		t.subs = nil
+	}
+	return nil
+}
+
+func (m *memoryBroker) Init(opts ...broker.Option) error {
+	for _, o := range opts {
+		o(&m.opts)
+	}
+	return nil
+}
+
+func (m *memoryBroker) Publish(name string, msg *broker.Message, opts ...broker.PublishOption) error {
+	header := make(map[string]string, len(msg.Header))
+	for k, v := range msg.Header {
+		header[k] = v
+	}
+
+	m.Lock()
+	if !m.connected {
+		m.Unlock()
+		return errors.New("not connected")
+	}
+
+	t := m.topic(name)
+	e := &event{
+		topic:  name,
+		offset: t.next,
+		msg:    &broker.Message{Header: header, Body: msg.Body},
+	}
+	t.next++
+
+	if retain, _ := m.opts.Context.Value(retainKey{}).(int); retain > 0 {
+		t.retained = append(t.retained, e)
+		if len(t.retained) > retain {
+			t.retained = t.retained[len(t.retained)-retain:]
+		}
+	}
+
+	subs := t.receivers()
+	if !m.synchronous() {
+		for _, sub := range subs {
+			sub.push(e)
+		}
+	}
+	m.Unlock()
+
+	if !m.synchronous() {
+		return nil
+	}
+
+	for _, sub := range subs {
+		if err := sub.handle(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryBroker) Subscribe(name string, handler broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	options := broker.NewSubscribeOptions(opts...)
+	if options.Context == nil {
+		options.Context = context.Background()
+	}
+
+	sub := &subscriber{
+		topic:   name,
+		queue:   options.Queue,
+		handler: handler,
+		opts:    options,
+		b:       m,
+		notify:  make(chan bool, 1),
+		exit:    make(chan bool),
+	}
+
+	m.Lock()
+	if !m.connected {
+		m.Unlock()
+		return nil, errors.New("not connected")
+	}
+
+	t := m.topic(name)
+	t.subs = append(t.subs, sub)
+
+	var replay []*event
+	if offset, ok := options.Context.Value(offsetKey{}).(int64); ok {
+		for _, e := range t.retained {
+			if e.offset >= offset {
+				replay = append(replay, e)
+			}
+		}
+	}
+
+	if !m.synchronous() {
+		// replay ahead of the messages published from now on
+		for _, e := range replay {
+			sub.push(e)
+		}
+		go sub.run()
+	}
+	m.Unlock()
+
+	if m.synchronous() {
+		for _, e := range replay {
+			if err := sub.handle(e); err != nil {
+				log.Errorf("[memory] failed to replay message %d of %s: %v", e.offset, name, err)
+			}
+		}
+	}
+
+	return sub, nil
+}
+
+func (m *memoryBroker) String() string {
+	return "memory"
+}
+
+// topic returns the topic with the given name, creating it if needed
+func (m *memoryBroker) topic(name string) *topic {
+	t, ok := m.topics[name]
+	if !ok {
+		t = &topic{cursors: make(map[string]int)}
+		m.topics[name] = t
+	}
+	return t
+}
+
+// receivers returns the subscribers receiving the next message, every subscriber
+// without a queue and the next subscriber of every queue
+func (t *topic) receivers() []*subscriber {
+	var subs []*subscriber
+	queues := make(map[string][]*subscriber)
+	var order []string
+
+	for _, sub := range t.subs {
+		if len(sub.queue) == 0 {
+			subs = append(subs, sub)
+			continue
+		}
+		if _, ok := queues[sub.queue]; !ok {
+			order = append(order, sub.queue)
+		}
+		queues[sub.queue] = append(queues[sub.queue], sub)
+	}
+
+	for _, q := range order {
+		members := queues[q]
+		subs = append(subs, members[t.cursors[q]%len(members)])
+		t.cursors[q]++
+	}
+	return subs
+}
+
+// handle calls the handler, the error is returned if there's no error handler
+func (s *subscriber) handle(e *event) error {
+	err := s.handler(e)
+	if err == nil {
+		return nil
+	}
+
+	// copy the event, it is shared by the subscribers
+	ev := &event{topic: e.topic, offset: e.offset, msg: e.msg, err: err}
+	if eh := s.b.opts.ErrorHandler; eh != nil {
+		eh(ev)
+		return nil
+	}
+	return err
+}
+
+// push queues the event for delivery
+func (s *subscriber) push(e *event) {
+	s.Lock()
+	s.pending = append(s.pending, e)
+	s.Unlock()
+
+	select {
+	case s.notify <- true:
+	default:
+	}
+}
+
+// run delivers queued events in order until the subscriber is closed
+func (s *subscriber) run() {
+	for {
+		select {
+		case <-s.exit:
+			return
+		case <-s.notify:
+		}
+
+		for {
+			s.Lock()
+			if len(s.pending) == 0 || s.closed {
+				s.Unlock()
+				break
+			}
+			e := s.pending[0]
+			s.pending = s.pending[1:]
+			s.Unlock()
+
+			if err := s.handle(e); err != nil {
+				log.Errorf("[memory] subscriber of %s failed to handle message %d: %v", s.topic, e.offset, err)
+			}
+		}
+	}
+}
+
+func (s *subscriber) close() {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.exit)
+}
+
+func (s *subscriber) Options() broker.SubscribeOptions {
+	return s.opts
+}
+
+func (s *subscriber) Topic() string {
+	return s.topic
+}
+
+func (s *subscriber) Unsubscribe() error {
+	s.b.Lock()
+	defer s.b.Unlock()
+
+	if t, ok := s.b.topics[s.topic]; ok {
+		for i, sub := range t.subs {
+			if sub == s {
+				t.subs = append(t.subs[:i], t.subs[i+1:]...)
+				break
+			}
+		}
+	}
+	s.close()
+	return nil
+}
+
+// NewBroker returns a memory broker. Messages are delivered asynchronously unless
+// Synchronous is set and only retained with Retain
 func NewBroker(opts ...broker.Option) broker.Broker {
-	return memory.NewBroker(opts...)
+	options := broker.Options{
+		Context: context.Background(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return &memoryBroker{
+		opts:   options,
+		topics: make(map[string]*topic),
+	}
 }
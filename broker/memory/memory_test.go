@@ -0,0 +1,129 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+)
+
+func publish(t *testing.T, b broker.Broker, topic string, n int) {
+	for i := 0; i < n; i++ {
+		if err := b.Publish(topic, &broker.Message{Body: []byte(fmt.Sprint(i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	b := NewBroker(Retain(3), Synchronous())
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	publish(t, b, "test", 5)
+
+	testData := []struct {
+		opts   []broker.SubscribeOption
+		expect []string
+	}{
+		{nil, nil},
+		{[]broker.SubscribeOption{ReplayAll()}, []string{"2", "3", "4"}},
+		{[]broker.SubscribeOption{FromOffset(4)}, []string{"4"}},
+	}
+
+	for _, d := range testData {
+		var got []string
+		var offsets []int64
+		sub, err := b.Subscribe("test", func(e broker.Event) error {
+			got = append(got, string(e.Message().Body))
+			o, _ := Offset(e)
+			offsets = append(offsets, o)
+			return nil
+		}, d.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub.Unsubscribe()
+
+		if !reflect.DeepEqual(got, d.expect) {
+			t.Fatalf("expected %v, got %v", d.expect, got)
+		}
+		for i, o := range offsets {
+			if fmt.Sprint(o) != d.expect[i] {
+				t.Fatalf("expected offset %s, got %d", d.expect[i], o)
+			}
+		}
+	}
+}
+
+func TestSynchronous(t *testing.T) {
+	b := NewBroker(Synchronous())
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	var a, c []string
+	b.Subscribe("test", func(e broker.Event) error {
+		a = append(a, string(e.Message().Body))
+		return nil
+	}, broker.Queue("q"))
+	b.Subscribe("test", func(e broker.Event) error {
+		c = append(c, string(e.Message().Body))
+		return nil
+	}, broker.Queue("q"))
+
+	publish(t, b, "test", 4)
+
+	if !reflect.DeepEqual(a, []string{"0", "2"}) || !reflect.DeepEqual(c, []string{"1", "3"}) {
+		t.Fatalf("expected the queue to share messages round robin, got %v and %v", a, c)
+	}
+
+	fail := errors.New("failed")
+	b.Subscribe("fail", func(broker.Event) error {
+		return fail
+	})
+	if err := b.Publish("fail", &broker.Message{}); err != fail {
+		t.Fatalf("expected the handler error, got %v", err)
+	}
+}
+
+func TestAsync(t *testing.T) {
+	b := NewBroker(Retain(10))
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	publish(t, b, "test", 2)
+
+	got := make(chan string, 10)
+	if _, err := b.Subscribe("test", func(e broker.Event) error {
+		got <- string(e.Message().Body)
+		return nil
+	}, ReplayAll()); err != nil {
+		t.Fatal(err)
+	}
+
+	publish(t, b, "test", 3)
+
+	for _, expect := range []string{"0", "1", "0", "1", "2"} {
+		select {
+		case s := <-got:
+			if s != expect {
+				t.Fatalf("expected %s, got %s", expect, s)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected message to be delivered")
+		}
+	}
+
+	if err := b.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Publish("test", &broker.Message{}); err == nil {
+		t.Fatal("expected publishing to fail once disconnected")
+	}
+}
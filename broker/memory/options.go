@@ -0,0 +1,29 @@
+package memory
+
+import (
+	"github.com/micro/go-micro/v2/broker"
+)
+
+// Retain keeps the last n messages of every topic so subscribers can replay them
+func Retain(n int) broker.Option {
+	return setBrokerOption(retainKey{}, n)
+}
+
+// Synchronous delivers messages within Publish, which returns once every handler
+// ran and returns the error of the first failing handler unless an ErrorHandler
+// is set. By default every subscription is delivered in order on a goroutine of
+// its own
+func Synchronous() broker.Option {
+	return setBrokerOption(synchronousKey{}, true)
+}
+
+// ReplayAll delivers the retained messages of the topic before new messages
+func ReplayAll() broker.SubscribeOption {
+	return setSubscribeOption(offsetKey{}, int64(0))
+}
+
+// FromOffset delivers the retained messages of the topic from the given offset
+// before new messages. The first message published to a topic has offset 0
+func FromOffset(offset int64) broker.SubscribeOption {
+	return setSubscribeOption(offsetKey{}, offset)
+}
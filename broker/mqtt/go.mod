@@ -3,6 +3,7 @@ module github.com/micro/go-plugins/broker/mqtt/v2
 go 1.13
 
 require (
+	github.com/eclipse/paho.golang v0.10.0
 	github.com/eclipse/paho.mqtt.golang v1.2.0
 	github.com/micro/go-micro/v2 v2.9.1
 )
@@ -127,6 +127,17 @@ func newClient(addrs []string, opts broker.Options) mqtt.Client {
 		cOpts.AddBroker(addr)
 	}
 
+	// last will, a message which can't be encoded is dropped
+	if opts.Context != nil {
+		if w, ok := opts.Context.Value(lastWillKey{}).(lastWill); ok {
+			if b, err := opts.Codec.Marshal(w.msg); err == nil {
+				cOpts.SetBinaryWill(w.topic, b, w.qos, w.retained)
+			} else {
+				log.Errorf("Failed to encode last will: %v", err)
+			}
+		}
+	}
+
 	return mqtt.NewClient(cOpts)
 }
 
@@ -197,12 +208,34 @@ func (m *mqttBroker) Publish(topic string, msg *broker.Message, opts ...broker.P
 		return errors.New("not connected")
 	}
 
-	b, err := m.opts.Codec.Marshal(msg)
-	if err != nil {
-		return err
+	var options broker.PublishOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	qos := DefaultQoS
+	var retained bool
+	if options.Context != nil {
+		if v, ok := options.Context.Value(qosKey{}).(byte); ok {
+			qos = v
+		}
+		retained, _ = options.Context.Value(retainKey{}).(bool)
+	}
+	if qos > 2 {
+		return fmt.Errorf("invalid qos %d", qos)
+	}
+
+	// an empty retained message clears the one kept by the server, which only
+	// happens for a zero length payload
+	var b []byte
+	if !retained || len(msg.Body) > 0 {
+		var err error
+		if b, err = m.opts.Codec.Marshal(msg); err != nil {
+			return err
+		}
 	}
 
-	t := m.client.Publish(topic, 1, false, b)
+	t := m.client.Publish(topic, qos, retained, b)
 	return t.Error()
 }
 
@@ -216,11 +249,24 @@ func (m *mqttBroker) Subscribe(topic string, h broker.Handler, opts ...broker.Su
 		o(&options)
 	}
 
-	t := m.client.Subscribe(topic, 1, func(c mqtt.Client, mq mqtt.Message) {
-		var msg broker.Message
-		if err := m.opts.Codec.Unmarshal(mq.Payload(), &msg); err != nil {
-			log.Error(err)
-			return
+	qos := DefaultQoS
+	if options.Context != nil {
+		if v, ok := options.Context.Value(qosKey{}).(byte); ok {
+			qos = v
+		}
+	}
+	if qos > 2 {
+		return nil, fmt.Errorf("invalid qos %d", qos)
+	}
+
+	t := m.client.Subscribe(topic, qos, func(c mqtt.Client, mq mqtt.Message) {
+		// a zero length payload clears a retained message and is delivered empty
+		msg := broker.Message{Header: map[string]string{}}
+		if len(mq.Payload()) > 0 {
+			if err := m.opts.Codec.Unmarshal(mq.Payload(), &msg); err != nil {
+				log.Error(err)
+				return
+			}
 		}
 
 		p := &mqttPub{topic: topic, msg: &msg}
@@ -245,6 +291,16 @@ func (m *mqttBroker) String() string {
 	return "mqtt"
 }
 
+// NewBroker returns an MQTT 3.1.1 broker or an MQTT 5 broker when the MQTT5 option is set
 func NewBroker(opts ...broker.Option) broker.Broker {
+	var options broker.Options
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.Context != nil {
+		if v, ok := options.Context.Value(mqtt5Key{}).(bool); ok && v {
+			return newMQTT5Broker(opts...)
+		}
+	}
 	return newBroker(opts...)
 }
@@ -0,0 +1,325 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/micro/go-micro/v2/broker"
+	log "github.com/micro/go-micro/v2/logger"
+)
+
+/*
+	With MQTT 5 the message body is published as the payload and the header
+	as user properties, so the broker codec isn't used and other MQTT clients
+	see the payload as is.
+
+	The paho MQTT 5 client doesn't reconnect on its own, a lost connection is
+	logged and publishing fails until Connect is called again.
+*/
+
+type mqtt5Broker struct {
+	sync.RWMutex
+	addrs     []string
+	opts      broker.Options
+	router    *paho.StandardRouter
+	client    *paho.Client
+	connected bool
+}
+
+// mqtt5Sub is a broker.Subscriber
+type mqtt5Sub struct {
+	opts   broker.SubscribeOptions
+	topic  string
+	broker *mqtt5Broker
+}
+
+func newMQTT5Broker(opts ...broker.Option) broker.Broker {
+	var options broker.Options
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return &mqtt5Broker{
+		opts:  options,
+		addrs: setAddrs(options.Addrs),
+	}
+}
+
+// userProperties maps the message header to user properties, sorted by key
+func userProperties(header map[string]string) paho.UserProperties {
+	if len(header) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	props := make(paho.UserProperties, 0, len(keys))
+	for _, k := range keys {
+		props = append(props, paho.UserProperty{Key: k, Value: header[k]})
+	}
+	return props
+}
+
+// messageHeader maps user properties to the message header, the last value of
+// a repeated key wins
+func messageHeader(props *paho.PublishProperties) map[string]string {
+	header := make(map[string]string)
+	if props == nil {
+		return header
+	}
+	for _, p := range props.User {
+		header[p.Key] = p.Value
+	}
+	return header
+}
+
+// dial connects to the first reachable address
+func (m *mqtt5Broker) dial() (net.Conn, error) {
+	var err error
+	for _, addr := range m.addrs {
+		var u *url.URL
+		if u, err = url.Parse(addr); err != nil {
+			continue
+		}
+
+		var conn net.Conn
+		switch u.Scheme {
+		case "ssl":
+			conn, err = tls.Dial("tcp", u.Host, m.opts.TLSConfig)
+		case "tcp":
+			conn, err = net.Dial("tcp", u.Host)
+		default:
+			err = fmt.Errorf("scheme %s is not supported with mqtt 5", u.Scheme)
+		}
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+func (m *mqtt5Broker) Options() broker.Options {
+	return m.opts
+}
+
+func (m *mqtt5Broker) Address() string {
+	return strings.Join(m.addrs, ",")
+}
+
+func (m *mqtt5Broker) Connect() error {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.connected {
+		return nil
+	}
+
+	conn, err := m.dial()
+	if err != nil {
+		return err
+	}
+
+	if m.router == nil {
+		m.router = paho.NewStandardRouter()
+	}
+	client := paho.NewClient(paho.ClientConfig{
+		Conn:   conn,
+		Router: m.router,
+		OnClientError: func(err error) {
+			log.Errorf("[mqtt] connection lost: %v", err)
+			m.disconnected()
+		},
+		OnServerDisconnect: func(d *paho.Disconnect) {
+			log.Errorf("[mqtt] disconnected by server with reason %d", d.ReasonCode)
+			m.disconnected()
+		},
+	})
+
+	cp := &paho.Connect{
+		ClientID:   fmt.Sprintf("%d%d", time.Now().UnixNano(), rand.Intn(10)),
+		KeepAlive:  30,
+		CleanStart: true,
+	}
+	if m.opts.Context != nil {
+		if w, ok := m.opts.Context.Value(lastWillKey{}).(lastWill); ok {
+			cp.WillMessage = &paho.WillMessage{
+				Topic:   w.topic,
+				QoS:     w.qos,
+				Retain:  w.retained,
+				Payload: w.msg.Body,
+			}
+			cp.WillProperties = &paho.WillProperties{User: userProperties(w.msg.Header)}
+		}
+	}
+
+	if _, err := client.Connect(context.Background(), cp); err != nil {
+		return err
+	}
+
+	m.client = client
+	m.connected = true
+	return nil
+}
+
+func (m *mqtt5Broker) disconnected() {
+	m.Lock()
+	m.connected = false
+	m.Unlock()
+}
+
+func (m *mqtt5Broker) Disconnect() error {
+	m.Lock()
+	defer m.Unlock()
+
+	if !m.connected {
+		return nil
+	}
+	m.connected = false
+	return m.client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+}
+
+func (m *mqtt5Broker) Init(opts ...broker.Option) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.connected {
+		return errors.New("cannot init while connected")
+	}
+
+	for _, o := range opts {
+		o(&m.opts)
+	}
+
+	m.addrs = setAddrs(m.opts.Addrs)
+	return nil
+}
+
+func (m *mqtt5Broker) conn() (*paho.Client, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	if !m.connected {
+		return nil, errors.New("not connected")
+	}
+	return m.client, nil
+}
+
+func (m *mqtt5Broker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	client, err := m.conn()
+	if err != nil {
+		return err
+	}
+
+	var options broker.PublishOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	qos := DefaultQoS
+	var retained bool
+	if options.Context != nil {
+		if v, ok := options.Context.Value(qosKey{}).(byte); ok {
+			qos = v
+		}
+		retained, _ = options.Context.Value(retainKey{}).(bool)
+	}
+	if qos > 2 {
+		return fmt.Errorf("invalid qos %d", qos)
+	}
+
+	// an empty body is a zero length payload, clearing a retained message
+	_, err = client.Publish(context.Background(), &paho.Publish{
+		Topic:      topic,
+		QoS:        qos,
+		Retain:     retained,
+		Payload:    msg.Body,
+		Properties: &paho.PublishProperties{User: userProperties(msg.Header)},
+	})
+	return err
+}
+
+func (m *mqtt5Broker) Subscribe(topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	client, err := m.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	var options broker.SubscribeOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	qos := DefaultQoS
+	if options.Context != nil {
+		if v, ok := options.Context.Value(qosKey{}).(byte); ok {
+			qos = v
+		}
+	}
+	if qos > 2 {
+		return nil, fmt.Errorf("invalid qos %d", qos)
+	}
+
+	m.router.RegisterHandler(topic, func(pb *paho.Publish) {
+		msg := &broker.Message{
+			Header: messageHeader(pb.Properties),
+			Body:   pb.Payload,
+		}
+
+		p := &mqttPub{topic: topic, msg: msg}
+		if err := h(p); err != nil {
+			p.err = err
+			log.Error(err)
+		}
+	})
+
+	if _, err := client.Subscribe(context.Background(), &paho.Subscribe{
+		Subscriptions: map[string]paho.SubscribeOptions{
+			topic: {QoS: qos},
+		},
+	}); err != nil {
+		m.router.UnregisterHandler(topic)
+		return nil, err
+	}
+
+	return &mqtt5Sub{
+		opts:   options,
+		topic:  topic,
+		broker: m,
+	}, nil
+}
+
+func (m *mqtt5Broker) String() string {
+	return "mqtt"
+}
+
+func (m *mqtt5Sub) Options() broker.SubscribeOptions {
+	return m.opts
+}
+
+func (m *mqtt5Sub) Topic() string {
+	return m.topic
+}
+
+func (m *mqtt5Sub) Unsubscribe() error {
+	m.broker.router.UnregisterHandler(m.topic)
+
+	client, err := m.broker.conn()
+	if err != nil {
+		return err
+	}
+	_, err = client.Unsubscribe(context.Background(), &paho.Unsubscribe{Topics: []string{m.topic}})
+	return err
+}
@@ -1,8 +1,10 @@
 package mqtt
 
 import (
+	"reflect"
 	"testing"
 
+	"github.com/eclipse/paho.golang/paho"
 	"github.com/eclipse/paho.mqtt.golang"
 	"github.com/micro/go-micro/v2/broker"
 )
@@ -87,3 +89,81 @@ func TestMQTT(t *testing.T) {
 
 	b.(*mqttBroker).client.Disconnect(0)
 }
+
+func TestMQTTPublishOptions(t *testing.T) {
+	b := NewBroker()
+
+	// use mock client
+	c := newMockClient()
+	b.(*mqttBroker).client = c
+	c.Connect()
+
+	var qos byte
+	var retained bool
+	c.Subscribe("mock", 2, func(cm mqtt.Client, m mqtt.Message) {
+		qos = m.Qos()
+		retained = m.Retained()
+	})
+
+	if err := b.Publish("mock", &broker.Message{Body: []byte(`hello`)}, PublishQoS(2), Retain()); err != nil {
+		t.Fatal(err)
+	}
+	if qos != 2 || !retained {
+		t.Fatalf("Expected retained message with qos 2 got qos %d retained %v", qos, retained)
+	}
+
+	if err := b.Publish("mock", &broker.Message{Body: []byte(`hello`)}, PublishQoS(3)); err == nil {
+		t.Fatal("Expected error for invalid qos")
+	}
+
+	c.Disconnect(0)
+}
+
+func TestMQTTEmptyRetained(t *testing.T) {
+	b := NewBroker()
+
+	// use mock client
+	c := newMockClient()
+	b.(*mqttBroker).client = c
+	c.Connect()
+
+	var payload []byte
+	c.Subscribe("mock", 1, func(cm mqtt.Client, m mqtt.Message) {
+		payload = m.Payload()
+	})
+
+	if err := b.Publish("mock", &broker.Message{Header: map[string]string{"foo": "bar"}}, Retain()); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) != 0 {
+		t.Fatalf("Expected a zero length payload clearing the retained message got %s", payload)
+	}
+
+	// without retain the message is encoded as usual
+	if err := b.Publish("mock", &broker.Message{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) == 0 {
+		t.Fatal("Expected an encoded message")
+	}
+
+	c.Disconnect(0)
+}
+
+func TestMQTT5UserProperties(t *testing.T) {
+	header := map[string]string{"Micro-Id": "1", "Content-Type": "application/json"}
+
+	props := userProperties(header)
+	if len(props) != 2 || props[0].Key != "Content-Type" || props[1].Key != "Micro-Id" {
+		t.Fatalf("Expected user properties sorted by key got %+v", props)
+	}
+
+	got := messageHeader(&paho.PublishProperties{User: props})
+	if !reflect.DeepEqual(got, header) {
+		t.Fatalf("Expected header %v got %v", header, got)
+	}
+
+	if got := messageHeader(nil); got == nil || len(got) != 0 {
+		t.Fatalf("Expected an empty header got %v", got)
+	}
+}
@@ -0,0 +1,76 @@
+package mqtt
+
+import (
+	"context"
+
+	"github.com/micro/go-micro/v2/broker"
+)
+
+type qosKey struct{}
+type retainKey struct{}
+type lastWillKey struct{}
+type mqtt5Key struct{}
+
+type lastWill struct {
+	topic    string
+	msg      *broker.Message
+	qos      byte
+	retained bool
+}
+
+// DefaultQoS is the quality of service used for publishing and subscribing
+var DefaultQoS byte = 1
+
+// PublishQoS sets the quality of service of the message, 0 for at most once,
+// 1 for at least once and 2 for exactly once
+func PublishQoS(qos byte) broker.PublishOption {
+	return func(o *broker.PublishOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, qosKey{}, qos)
+	}
+}
+
+// Retain makes the server keep the message and deliver it to future subscribers
+// of the topic. Publishing an empty retained message clears it
+func Retain() broker.PublishOption {
+	return func(o *broker.PublishOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, retainKey{}, true)
+	}
+}
+
+// SubscribeQoS sets the maximum quality of service messages are delivered with
+func SubscribeQoS(qos byte) broker.SubscribeOption {
+	return func(o *broker.SubscribeOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, qosKey{}, qos)
+	}
+}
+
+// LastWill sets a message the server publishes when the broker disconnects
+// without saying goodbye. The message is encoded with the broker codec
+func LastWill(topic string, msg *broker.Message, qos byte, retained bool) broker.Option {
+	return func(o *broker.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, lastWillKey{}, lastWill{topic, msg, qos, retained})
+	}
+}
+
+// MQTT5 connects with MQTT 5, publishing the message body as the payload and
+// the header as user properties rather than encoding the message with the codec
+func MQTT5() broker.Option {
+	return func(o *broker.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, mqtt5Key{}, true)
+	}
+}
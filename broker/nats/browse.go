@@ -0,0 +1,100 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+)
+
+const (
+	apiMsgGet = "$JS.API.STREAM.MSG.GET.%s"
+)
+
+type streamState struct {
+	Messages uint64    `json:"messages"`
+	FirstSeq uint64    `json:"first_seq"`
+	FirstTS  time.Time `json:"first_ts"`
+	LastSeq  uint64    `json:"last_seq"`
+}
+
+type streamInfo struct {
+	apiResponse
+	State streamState `json:"state"`
+}
+
+type msgGetRequest struct {
+	Seq uint64 `json:"seq"`
+}
+
+type msgGetResponse struct {
+	apiResponse
+	Message struct {
+		Data []byte `json:"data"`
+	} `json:"message"`
+}
+
+func (n *jsBroker) streamInfo(topic string) (*streamInfo, error) {
+	n.RLock()
+	conn := n.conn
+	n.RUnlock()
+	if conn == nil {
+		return nil, errors.New("not connected")
+	}
+
+	name := streamName(topic)
+
+	var info streamInfo
+	if err := n.request(fmt.Sprintf(apiStreamInfo, name), nil, &info); err != nil {
+		return nil, err
+	}
+	if info.Error != nil {
+		return nil, fmt.Errorf("stream %s: %s", name, info.Error.Description)
+	}
+	return &info, nil
+}
+
+// Peek reads up to n messages from the head of the topic's stream. Messages stay
+// in the stream, so what is pending for a particular consumer may start later
+func (n *jsBroker) Peek(topic string, count int) ([]*broker.Message, error) {
+	info, err := n.streamInfo(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []*broker.Message
+	for seq := info.State.FirstSeq; seq > 0 && seq <= info.State.LastSeq && len(msgs) < count; seq++ {
+		var rsp msgGetResponse
+		if err := n.request(fmt.Sprintf(apiMsgGet, streamName(topic)), msgGetRequest{seq}, &rsp); err != nil {
+			return nil, err
+		}
+		// deleted messages leave gaps in the sequence
+		if rsp.Error != nil {
+			if rsp.Error.Code == 404 {
+				continue
+			}
+			return nil, fmt.Errorf("stream %s: %s", streamName(topic), rsp.Error.Description)
+		}
+
+		m := new(broker.Message)
+		if err := n.opts.Codec.Unmarshal(rsp.Message.Data, m); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+
+	return msgs, nil
+}
+
+// Depth returns the number of messages in the topic's stream and the age of the first
+func (n *jsBroker) Depth(topic string) (int64, time.Duration, error) {
+	info, err := n.streamInfo(topic)
+	if err != nil {
+		return 0, 0, err
+	}
+	if info.State.Messages == 0 {
+		return 0, 0, nil
+	}
+	return int64(info.State.Messages), time.Since(info.State.FirstTS), nil
+}
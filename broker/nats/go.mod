@@ -2,4 +2,7 @@ module github.com/micro/go-plugins/broker/nats/v2
 
 go 1.13
 
-require github.com/micro/go-micro/v2 v2.9.1
+require (
+	github.com/micro/go-micro/v2 v2.9.1
+	github.com/nats-io/nats.go v1.9.2
+)
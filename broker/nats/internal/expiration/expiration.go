@@ -0,0 +1,79 @@
+// Package expiration provides the message time to live of the broker, the same
+// Micro-Expires header is used by the kafka, nats, rabbitmq and sqs brokers
+package expiration
+
+import (
+	"context"
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+)
+
+/*
+	Brokers with a native per-message TTL, like rabbitmq, pass the time to live
+	on to the server. The others carry the deadline in the Header of the message
+	and drop expired messages on the subscriber, so they are acknowledged without
+	being handled.
+*/
+
+// Header carries the deadline of the message
+const Header = "Micro-Expires"
+
+type expirationKey struct{}
+
+// Expiration sets a time to live for the published message, messages which aren't
+// handled in time are discarded
+func Expiration(d time.Duration) broker.PublishOption {
+	return func(o *broker.PublishOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, expirationKey{}, d)
+	}
+}
+
+// FromOptions returns the time to live set on publish, ok is false without one
+func FromOptions(o broker.PublishOptions) (time.Duration, bool) {
+	if o.Context == nil {
+		return 0, false
+	}
+	d, ok := o.Context.Value(expirationKey{}).(time.Duration)
+	return d, ok && d > 0
+}
+
+// Deadline returns when a message published now with the time to live expires,
+// formatted for the Header
+func Deadline(d time.Duration) string {
+	return time.Now().Add(d).Format(time.RFC3339Nano)
+}
+
+// SetHeader returns a copy of the message with the deadline of the time to live
+// in its header, the message itself isn't changed
+func SetHeader(msg *broker.Message, d time.Duration) *broker.Message {
+	header := make(map[string]string, len(msg.Header)+1)
+	for k, v := range msg.Header {
+		header[k] = v
+	}
+	header[Header] = Deadline(d)
+	return &broker.Message{Header: header, Body: msg.Body}
+}
+
+// Expired reports whether the deadline in the header has passed, headers without
+// a valid deadline never expire
+func Expired(header map[string]string) bool {
+	v, ok := header[Header]
+	if !ok {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return false
+	}
+	return time.Now().After(t)
+}
+
+// Milliseconds returns the time to live in whole milliseconds rounded up, so a
+// time to live below a millisecond doesn't expire the message right away
+func Milliseconds(d time.Duration) int64 {
+	return int64((d + time.Millisecond - 1) / time.Millisecond)
+}
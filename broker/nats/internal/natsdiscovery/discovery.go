@@ -0,0 +1,132 @@
+// Package natsdiscovery keeps track of the servers nats clusters announce
+package natsdiscovery
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+
+	"github.com/micro/go-micro/v2/logger"
+	"github.com/nats-io/nats.go"
+)
+
+/*
+	Servers announce the other servers of their cluster through the INFO protocol.
+	The nats client adds them to the pool of its connection, the pool below keeps
+	track of them so connections made later start from the current topology rather
+	than from the seed servers only, which may be long gone in an auto-scaling
+	cluster. Pinned pools never use discovered servers, the dialer refuses them so
+	connections fail over between the seed servers only.
+*/
+
+// Pool holds the seed servers and the servers discovered through them
+type Pool struct {
+	seeds []string
+	pin   bool
+
+	sync.RWMutex
+	discovered []string
+}
+
+// seedDialer refuses to dial servers other than the seed servers
+type seedDialer struct {
+	hosts  map[string]bool
+	dialer nats.CustomDialer
+}
+
+func (d *seedDialer) Dial(network, address string) (net.Conn, error) {
+	if !d.hosts[address] {
+		return nil, fmt.Errorf("%s is not a seed server", address)
+	}
+	return d.dialer.Dial(network, address)
+}
+
+// NewPool returns a pool of the seed servers, a pinned pool only connects to them
+func NewPool(seeds []string, pin bool) *Pool {
+	return &Pool{
+		seeds: seeds,
+		pin:   pin,
+	}
+}
+
+// Servers returns the seed servers followed by the discovered ones
+func (p *Pool) Servers() []string {
+	p.RLock()
+	defer p.RUnlock()
+
+	servers := append([]string{}, p.seeds...)
+	seen := make(map[string]bool, len(servers))
+	for _, s := range servers {
+		seen[s] = true
+	}
+	for _, s := range p.discovered {
+		if !seen[s] {
+			servers = append(servers, s)
+		}
+	}
+	return servers
+}
+
+// update refreshes the discovered servers from the pool of the connection
+func (p *Pool) update(c *nats.Conn) {
+	if p.pin {
+		return
+	}
+	discovered := c.DiscoveredServers()
+
+	p.Lock()
+	p.discovered = discovered
+	p.Unlock()
+
+	logger.Debugf("Discovered nats servers %v", discovered)
+}
+
+// Apply sets the servers of the pool on the options and hooks the callbacks
+// keeping the pool up to date, user callbacks are still called
+func (p *Pool) Apply(opts *nats.Options) {
+	opts.Servers = p.Servers()
+
+	discoveredCB := opts.DiscoveredServersCB
+	opts.DiscoveredServersCB = func(c *nats.Conn) {
+		p.update(c)
+		if discoveredCB != nil {
+			discoveredCB(c)
+		}
+	}
+
+	reconnectedCB := opts.ReconnectedCB
+	opts.ReconnectedCB = func(c *nats.Conn) {
+		p.update(c)
+		if reconnectedCB != nil {
+			reconnectedCB(c)
+		}
+	}
+
+	if !p.pin {
+		return
+	}
+
+	d := &seedDialer{
+		hosts:  make(map[string]bool, len(p.seeds)),
+		dialer: opts.CustomDialer,
+	}
+	if d.dialer == nil && opts.Dialer != nil {
+		d.dialer = opts.Dialer
+	}
+	if d.dialer == nil {
+		d.dialer = &net.Dialer{Timeout: opts.Timeout}
+	}
+	for _, s := range p.seeds {
+		u, err := url.Parse(s)
+		if err != nil {
+			continue
+		}
+		host := u.Host
+		if len(u.Port()) == 0 {
+			host = net.JoinHostPort(u.Hostname(), "4222")
+		}
+		d.hosts[host] = true
+	}
+	opts.CustomDialer = d
+}
@@ -0,0 +1,33 @@
+package natsdiscovery
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestPool(t *testing.T) {
+	p := NewPool([]string{"nats://10.0.0.1:4222", "nats://seed.example.com"}, false)
+	p.discovered = []string{"nats://10.0.0.1:4222", "nats://10.0.0.2:4222"}
+
+	expect := []string{"nats://10.0.0.1:4222", "nats://seed.example.com", "nats://10.0.0.2:4222"}
+	if servers := p.Servers(); !reflect.DeepEqual(servers, expect) {
+		t.Fatalf("expected %v, got %v", expect, servers)
+	}
+
+	p.pin = true
+	opts := nats.GetDefaultOptions()
+	p.Apply(&opts)
+
+	d, ok := opts.CustomDialer.(*seedDialer)
+	if !ok {
+		t.Fatal("expected pinned pool to set the seed dialer")
+	}
+	if !d.hosts["10.0.0.1:4222"] || !d.hosts["seed.example.com:4222"] || len(d.hosts) != 2 {
+		t.Fatalf("unexpected seed hosts %v", d.hosts)
+	}
+	if _, err := d.Dial("tcp", "10.0.0.2:4222"); err == nil {
+		t.Fatal("expected discovered server to be refused")
+	}
+}
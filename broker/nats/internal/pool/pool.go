@@ -0,0 +1,119 @@
+// Package pool provides the publisher pool of the broker, the same pool holds the
+// channels of the rabbitmq broker, the producers of the kafka broker and the
+// connections of the nats broker
+package pool
+
+import (
+	"errors"
+)
+
+/*
+	The pool holds a fixed number of members, publishers check one out for each
+	publish so concurrent publishers don't serialise on a single connection.
+	Members are checked for their health when they're checked out, a broken
+	member is replaced by a new one. If the replacement can't be dialed the
+	broken member is kept, so the pool doesn't shrink, and replaced on a later
+	checkout once the server is reachable again.
+*/
+
+// ErrClosed is returned when checking out a member of a closed pool
+var ErrClosed = errors.New("pool is closed")
+
+// Member is a publisher held by the pool
+type Member interface {
+	// Healthy reports whether the member can still publish
+	Healthy() bool
+	Close() error
+}
+
+// DialFunc creates a new member of the pool
+type DialFunc func() (Member, error)
+
+// Pool hands out its members to one publisher at a time
+type Pool struct {
+	dial    DialFunc
+	members chan Member
+	closed  chan struct{}
+}
+
+// New dials size members, all members are closed again if one can't be dialed
+func New(size int, dial DialFunc) (*Pool, error) {
+	if size < 1 {
+		size = 1
+	}
+	p := &Pool{
+		dial:    dial,
+		members: make(chan Member, size),
+		closed:  make(chan struct{}),
+	}
+	for i := 0; i < size; i++ {
+		m, err := dial()
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.members <- m
+	}
+	return p, nil
+}
+
+// Get checks out a member, waiting until one is returned when all are in use.
+// A broken member is replaced before it's handed out
+func (p *Pool) Get() (Member, error) {
+	var m Member
+	select {
+	case <-p.closed:
+		return nil, ErrClosed
+	case m = <-p.members:
+	}
+	if m.Healthy() {
+		return m, nil
+	}
+
+	nm, err := p.dial()
+	if err != nil {
+		p.members <- m
+		return nil, err
+	}
+	m.Close()
+	return nm, nil
+}
+
+// Put returns a checked out member, members returned to a closed pool are closed
+func (p *Pool) Put(m Member) {
+	select {
+	case <-p.closed:
+		m.Close()
+	default:
+		p.members <- m
+	}
+}
+
+// Do calls fn with a checked out member and returns it to the pool
+func (p *Pool) Do(fn func(Member) error) error {
+	m, err := p.Get()
+	if err != nil {
+		return err
+	}
+	defer p.Put(m)
+	return fn(m)
+}
+
+// Close closes the members in the pool, members checked out are closed once
+// they're returned
+func (p *Pool) Close() {
+	select {
+	case <-p.closed:
+		return
+	default:
+		close(p.closed)
+	}
+	for {
+		select {
+		case m := <-p.members:
+			m.Close()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,561 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+	jsoncodec "github.com/micro/go-micro/v2/codec/json"
+	"github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-plugins/broker/nats/v2/internal/expiration"
+	"github.com/micro/go-plugins/broker/nats/v2/internal/natsdiscovery"
+	"github.com/nats-io/nats.go"
+)
+
+/*
+	The JetStream broker talks to the JetStream API over core NATS request/reply.
+	Each topic is stored in a stream of its own and subscribers read from it through
+	push consumers. Subscriptions with a durable name or queue share a durable
+	consumer which keeps its position in the stream across restarts, other
+	subscriptions get an ephemeral consumer delivering new messages only.
+
+	Stream and consumer names can't hold the dots of topics and queues, names
+	are sanitized and suffixed with a hash of the original so topics like a.b
+	and a_b don't share a stream.
+*/
+
+const (
+	ackExplicit = "explicit"
+	ackNone     = "none"
+	ackAll      = "all"
+
+	deliverAll             = "all"
+	deliverLast            = "last"
+	deliverNew             = "new"
+	deliverByStartSequence = "by_start_sequence"
+	deliverByStartTime     = "by_start_time"
+
+	apiStreamInfo     = "$JS.API.STREAM.INFO.%s"
+	apiStreamCreate   = "$JS.API.STREAM.CREATE.%s"
+	apiConsumerCreate = "$JS.API.CONSUMER.CREATE.%s"
+	apiDurableCreate  = "$JS.API.CONSUMER.DURABLE.CREATE.%s.%s"
+)
+
+var (
+	// DefaultTimeout is the timeout of requests to the JetStream API
+	DefaultTimeout = 5 * time.Second
+
+	ackPayload = []byte("+ACK")
+	nakPayload = []byte("-NAK")
+)
+
+type deliverPolicy struct {
+	policy string
+	seq    uint64
+	time   time.Time
+}
+
+type apiError struct {
+	Code        int    `json:"code"`
+	Description string `json:"description,omitempty"`
+}
+
+type apiResponse struct {
+	Error *apiError `json:"error,omitempty"`
+}
+
+type pubAck struct {
+	apiResponse
+	Stream   string `json:"stream"`
+	Sequence uint64 `json:"seq"`
+}
+
+type streamConfig struct {
+	Name     string        `json:"name"`
+	Subjects []string      `json:"subjects"`
+	Storage  string        `json:"storage"`
+	MaxAge   time.Duration `json:"max_age,omitempty"`
+	Replicas int           `json:"num_replicas,omitempty"`
+}
+
+type consumerConfig struct {
+	Durable        string        `json:"durable_name,omitempty"`
+	DeliverSubject string        `json:"deliver_subject"`
+	DeliverPolicy  string        `json:"deliver_policy"`
+	OptStartSeq    uint64        `json:"opt_start_seq,omitempty"`
+	OptStartTime   *time.Time    `json:"opt_start_time,omitempty"`
+	AckPolicy      string        `json:"ack_policy"`
+	AckWait        time.Duration `json:"ack_wait,omitempty"`
+	MaxDeliver     int           `json:"max_deliver,omitempty"`
+	FilterSubject  string        `json:"filter_subject,omitempty"`
+	ReplayPolicy   string        `json:"replay_policy"`
+}
+
+type consumerRequest struct {
+	Stream string         `json:"stream_name"`
+	Config consumerConfig `json:"config"`
+}
+
+type jsBroker struct {
+	sync.RWMutex
+	addrs []string
+	conn  *nats.Conn
+	opts  broker.Options
+	nopts nats.Options
+	pool  *natsdiscovery.Pool
+
+	// streams which are known to exist
+	streams map[string]bool
+}
+
+type jsSubscriber struct {
+	s    *nats.Subscription
+	opts broker.SubscribeOptions
+}
+
+type jsPublication struct {
+	t    string
+	err  error
+	m    *broker.Message
+	msg  *nats.Msg
+	conn *nats.Conn
+	ack  string
+}
+
+func (p *jsPublication) Topic() string {
+	return p.t
+}
+
+func (p *jsPublication) Message() *broker.Message {
+	return p.m
+}
+
+func (p *jsPublication) Ack() error {
+	if p.ack == ackNone || len(p.msg.Reply) == 0 {
+		return nil
+	}
+	return p.conn.Publish(p.msg.Reply, ackPayload)
+}
+
+func (p *jsPublication) Error() error {
+	return p.err
+}
+
+// nak asks the server to redeliver the message
+func (p *jsPublication) nak() error {
+	if p.ack == ackNone || len(p.msg.Reply) == 0 {
+		return nil
+	}
+	return p.conn.Publish(p.msg.Reply, nakPayload)
+}
+
+func (s *jsSubscriber) Options() broker.SubscribeOptions {
+	return s.opts
+}
+
+func (s *jsSubscriber) Topic() string {
+	return s.s.Subject
+}
+
+func (s *jsSubscriber) Unsubscribe() error {
+	return s.s.Unsubscribe()
+}
+
+var nameReplacer = strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_", "\t", "_", "/", "_", "\\", "_")
+
+// name returns a valid stream or consumer name for the topic or queue, names
+// which had to be sanitized get a hash of the original to stay unique
+func name(s string) string {
+	n := nameReplacer.Replace(s)
+	if n == s {
+		return n
+	}
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return fmt.Sprintf("%s_%08x", n, h.Sum32())
+}
+
+// streamName returns the name of the stream holding the topic
+func streamName(topic string) string {
+	return name(topic)
+}
+
+// setAddrs prepends nats:// to addresses missing a scheme
+func setAddrs(addrs []string) []string {
+	var cAddrs []string
+	for _, addr := range addrs {
+		if len(addr) == 0 {
+			continue
+		}
+		if !strings.HasPrefix(addr, "nats://") {
+			addr = "nats://" + addr
+		}
+		cAddrs = append(cAddrs, addr)
+	}
+	if len(cAddrs) == 0 {
+		cAddrs = []string{nats.DefaultURL}
+	}
+	return cAddrs
+}
+
+func (n *jsBroker) Address() string {
+	n.RLock()
+	defer n.RUnlock()
+	if n.conn != nil && n.conn.IsConnected() {
+		return n.conn.ConnectedUrl()
+	}
+	if len(n.addrs) > 0 {
+		return n.addrs[0]
+	}
+	return ""
+}
+
+func (n *jsBroker) Connect() error {
+	n.Lock()
+	defer n.Unlock()
+
+	if n.conn != nil && (n.conn.IsConnected() || n.conn.IsReconnecting()) {
+		return nil
+	}
+
+	opts := n.nopts
+	opts.Servers = n.addrs
+	opts.Secure = n.opts.Secure
+	opts.TLSConfig = n.opts.TLSConfig
+
+	// secure might not be set
+	if n.opts.TLSConfig != nil {
+		opts.Secure = true
+	}
+
+	n.pool.Apply(&opts)
+
+	c, err := opts.Connect()
+	if err != nil {
+		return err
+	}
+	n.conn = c
+	n.streams = make(map[string]bool)
+	return nil
+}
+
+func (n *jsBroker) Disconnect() error {
+	n.Lock()
+	defer n.Unlock()
+	if n.conn == nil {
+		return nil
+	}
+	n.conn.Close()
+	n.conn = nil
+	return nil
+}
+
+func (n *jsBroker) Init(opts ...broker.Option) error {
+	n.setOption(opts...)
+	return nil
+}
+
+func (n *jsBroker) Options() broker.Options {
+	return n.opts
+}
+
+// request sends a request to the JetStream API and decodes the response into rsp
+func (n *jsBroker) request(subject string, req interface{}, rsp interface{}) error {
+	var b []byte
+	if req != nil {
+		var err error
+		if b, err = json.Marshal(req); err != nil {
+			return err
+		}
+	}
+
+	msg, err := n.conn.Request(subject, b, DefaultTimeout)
+	if err == nats.ErrTimeout {
+		return errors.New("jetstream api timed out, is jetstream enabled?")
+	} else if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(msg.Data, rsp)
+}
+
+// ensureStream creates the stream for the topic unless it exists
+func (n *jsBroker) ensureStream(topic string) (string, error) {
+	name := streamName(topic)
+
+	n.RLock()
+	ok := n.streams[name]
+	n.RUnlock()
+	if ok {
+		return name, nil
+	}
+
+	var info apiResponse
+	if err := n.request(fmt.Sprintf(apiStreamInfo, name), nil, &info); err != nil {
+		return "", err
+	}
+
+	if info.Error != nil {
+		if info.Error.Code != 404 {
+			return "", fmt.Errorf("stream %s: %s", name, info.Error.Description)
+		}
+
+		cfg := streamConfig{
+			Name:     name,
+			Subjects: []string{topic},
+			Storage:  "file",
+		}
+		if n.opts.Context != nil {
+			if v, ok := n.opts.Context.Value(streamMaxAgeKey{}).(time.Duration); ok {
+				cfg.MaxAge = v
+			}
+			if v, ok := n.opts.Context.Value(streamMemoryKey{}).(bool); ok && v {
+				cfg.Storage = "memory"
+			}
+			if v, ok := n.opts.Context.Value(streamReplicasKey{}).(int); ok {
+				cfg.Replicas = v
+			}
+		}
+
+		var rsp apiResponse
+		if err := n.request(fmt.Sprintf(apiStreamCreate, name), cfg, &rsp); err != nil {
+			return "", err
+		}
+		// another publisher may have created it in the mean time
+		if rsp.Error != nil && !strings.Contains(rsp.Error.Description, "already in use") {
+			return "", fmt.Errorf("stream %s: %s", name, rsp.Error.Description)
+		}
+	}
+
+	n.Lock()
+	n.streams[name] = true
+	n.Unlock()
+
+	return name, nil
+}
+
+func (n *jsBroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	n.RLock()
+	conn := n.conn
+	n.RUnlock()
+	if conn == nil {
+		return errors.New("not connected")
+	}
+
+	if _, err := n.ensureStream(topic); err != nil {
+		return err
+	}
+
+	var options broker.PublishOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	// streams only age out messages as a whole, so expired messages are dropped
+	// by the subscribers
+	if d, ok := expiration.FromOptions(options); ok {
+		msg = expiration.SetHeader(msg, d)
+	}
+
+	b, err := n.opts.Codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	// the server acknowledges once the message is persisted
+	rsp, err := conn.Request(topic, b, DefaultTimeout)
+	if err != nil {
+		return err
+	}
+
+	var ack pubAck
+	if err := json.Unmarshal(rsp.Data, &ack); err != nil {
+		return err
+	}
+	if ack.Error != nil {
+		return fmt.Errorf("publish to %s: %s", topic, ack.Error.Description)
+	}
+	return nil
+}
+
+func (n *jsBroker) Subscribe(topic string, handler broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	n.RLock()
+	conn := n.conn
+	n.RUnlock()
+	if conn == nil {
+		return nil, errors.New("not connected")
+	}
+
+	opt := broker.SubscribeOptions{
+		AutoAck: true,
+		Context: context.Background(),
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	stream, err := n.ensureStream(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, subject := consumer(topic, stream, opt)
+
+	fn := func(msg *nats.Msg) {
+		var m broker.Message
+		pub := &jsPublication{t: topic, msg: msg, conn: conn, ack: cfg.AckPolicy}
+		eh := n.opts.ErrorHandler
+		err := n.opts.Codec.Unmarshal(msg.Data, &m)
+		pub.err = err
+		pub.m = &m
+		if err != nil {
+			m.Body = msg.Data
+			if logger.V(logger.ErrorLevel, logger.DefaultLogger) {
+				logger.Error(err)
+			}
+			if eh != nil {
+				eh(pub)
+			}
+			return
+		}
+		if expiration.Expired(m.Header) {
+			pub.Ack()
+			return
+		}
+		if err := handler(pub); err != nil {
+			pub.err = err
+			if logger.V(logger.ErrorLevel, logger.DefaultLogger) {
+				logger.Error(err)
+			}
+			if eh != nil {
+				eh(pub)
+			}
+			if opt.AutoAck {
+				pub.nak()
+			}
+			return
+		}
+		if opt.AutoAck {
+			pub.Ack()
+		}
+	}
+
+	var sub *nats.Subscription
+	if len(cfg.Durable) > 0 {
+		sub, err = conn.QueueSubscribe(cfg.DeliverSubject, cfg.Durable, fn)
+	} else {
+		sub, err = conn.Subscribe(cfg.DeliverSubject, fn)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rsp apiResponse
+	if err := n.request(subject, consumerRequest{Stream: stream, Config: cfg}, &rsp); err != nil {
+		sub.Unsubscribe()
+		return nil, err
+	}
+	// subscribers sharing a durable consumer find it already created
+	if rsp.Error != nil && !strings.Contains(rsp.Error.Description, "already") {
+		sub.Unsubscribe()
+		return nil, fmt.Errorf("consumer %s: %s", cfg.Durable, rsp.Error.Description)
+	}
+
+	return &jsSubscriber{s: sub, opts: opt}, nil
+}
+
+// consumer returns the config of the consumer of the subscription and the API
+// subject creating it
+func consumer(topic, stream string, opt broker.SubscribeOptions) (consumerConfig, string) {
+	cfg := consumerConfig{
+		Durable:       opt.Queue,
+		AckPolicy:     ackExplicit,
+		FilterSubject: topic,
+		ReplayPolicy:  "instant",
+	}
+	if v, ok := opt.Context.Value(durableKey{}).(string); ok && len(v) > 0 {
+		cfg.Durable = v
+	}
+	if len(cfg.Durable) > 0 {
+		cfg.Durable = name(cfg.Durable)
+		// a new durable consumer starts at the beginning of the stream and
+		// keeps its position from there
+		cfg.DeliverPolicy = deliverAll
+	} else {
+		// ephemeral consumers only see what's published while they exist
+		cfg.DeliverPolicy = deliverNew
+	}
+	if v, ok := opt.Context.Value(ackPolicyKey{}).(string); ok {
+		cfg.AckPolicy = v
+	}
+	if v, ok := opt.Context.Value(ackWaitKey{}).(time.Duration); ok {
+		cfg.AckWait = v
+	}
+	if v, ok := opt.Context.Value(maxDeliverKey{}).(int); ok {
+		cfg.MaxDeliver = v
+	}
+	if v, ok := opt.Context.Value(deliverPolicyKey{}).(deliverPolicy); ok {
+		cfg.DeliverPolicy = v.policy
+		cfg.OptStartSeq = v.seq
+		if !v.time.IsZero() {
+			t := v.time
+			cfg.OptStartTime = &t
+		}
+	}
+	if v, ok := opt.Context.Value(replayOriginalKey{}).(bool); ok && v {
+		cfg.ReplayPolicy = "original"
+	}
+
+	if len(cfg.Durable) == 0 {
+		cfg.DeliverSubject = nats.NewInbox()
+		return cfg, fmt.Sprintf(apiConsumerCreate, stream)
+	}
+	// a durable consumer delivers to the same subject so subscribers
+	// sharing it are load balanced through a queue group
+	cfg.DeliverSubject = fmt.Sprintf("_micro.js.%s.%s", stream, cfg.Durable)
+	return cfg, fmt.Sprintf(apiDurableCreate, stream, cfg.Durable)
+}
+
+func (n *jsBroker) String() string {
+	return "nats"
+}
+
+func (n *jsBroker) setOption(opts ...broker.Option) {
+	for _, o := range opts {
+		o(&n.opts)
+	}
+
+	var pin bool
+	if n.opts.Context != nil {
+		if v, ok := n.opts.Context.Value(optionsKey{}).(nats.Options); ok {
+			n.nopts = v
+		}
+		pin, _ = n.opts.Context.Value(pinSeedServersKey{}).(bool)
+	}
+
+	n.Lock()
+	n.addrs = setAddrs(n.opts.Addrs)
+	n.pool = natsdiscovery.NewPool(n.addrs, pin)
+	n.Unlock()
+}
+
+func newJetStreamBroker(opts ...broker.Option) broker.Broker {
+	options := broker.Options{
+		Codec:   jsoncodec.Marshaler{},
+		Context: context.Background(),
+	}
+
+	n := &jsBroker{
+		opts:    options,
+		nopts:   nats.GetDefaultOptions(),
+		streams: make(map[string]bool),
+	}
+	n.setOption(opts...)
+
+	return n
+}
@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+)
+
+// browser is the Browser interface of the browser package, brokers implement it
+// without importing the package
+type browser interface {
+	Peek(queue string, n int) ([]*broker.Message, error)
+	Depth(queue string) (int64, time.Duration, error)
+}
+
+var _ browser = &jsBroker{}
+
+func TestStreamName(t *testing.T) {
+	if n := streamName("orders"); n != "orders" {
+		t.Fatalf("expected valid names to be kept got %s", n)
+	}
+
+	names := make(map[string]string)
+	for _, topic := range []string{"go.micro.orders", "go_micro_orders", "go.micro_orders", "go.micro.*", "go.micro.>"} {
+		n := streamName(topic)
+		if strings.ContainsAny(n, ".*> ") {
+			t.Fatalf("expected a valid stream name for %s got %s", topic, n)
+		}
+		if other, ok := names[n]; ok {
+			t.Fatalf("expected %s and %s to use different streams got %s", topic, other, n)
+		}
+		names[n] = topic
+	}
+}
+
+func TestConsumer(t *testing.T) {
+	subscribe := func(opts ...broker.SubscribeOption) broker.SubscribeOptions {
+		o := broker.SubscribeOptions{AutoAck: true, Context: context.Background()}
+		for _, opt := range opts {
+			opt(&o)
+		}
+		return o
+	}
+
+	// ephemeral consumers only see new messages
+	cfg, subject := consumer("orders", "orders", subscribe())
+	if len(cfg.Durable) > 0 || cfg.DeliverPolicy != deliverNew || subject != "$JS.API.CONSUMER.CREATE.orders" {
+		t.Fatalf("unexpected ephemeral consumer %+v at %s", cfg, subject)
+	}
+
+	// the queue names the durable consumer
+	cfg, subject = consumer("go.micro.orders", "go_micro_orders", subscribe(broker.Queue("go.micro.billing")))
+	if strings.Contains(cfg.Durable, ".") || cfg.DeliverPolicy != deliverAll {
+		t.Fatalf("unexpected durable consumer %+v", cfg)
+	}
+	if subject != "$JS.API.CONSUMER.DURABLE.CREATE.go_micro_orders."+cfg.Durable {
+		t.Fatalf("unexpected subject %s", subject)
+	}
+	if cfg.DeliverSubject != "_micro.js.go_micro_orders."+cfg.Durable {
+		t.Fatalf("unexpected deliver subject %s", cfg.DeliverSubject)
+	}
+
+	cfg, _ = consumer("orders", "orders", subscribe(broker.Queue("billing"), Durable("audit"), DeliverNew()))
+	if cfg.Durable != "audit" || cfg.DeliverPolicy != deliverNew {
+		t.Fatalf("expected the options to win got %+v", cfg)
+	}
+}
@@ -5,12 +5,44 @@ import (
 	"github.com/micro/go-micro/v2/broker"
 	"github.com/micro/go-micro/v2/broker/nats"
 	"github.com/micro/go-micro/v2/config/cmd"
+	"github.com/micro/go-plugins/broker/nats/v2/internal/natsdiscovery"
+	natsgo "github.com/nats-io/nats.go"
 )
 
 func init() {
 	cmd.DefaultBrokers["nats"] = NewBroker
 }
 
+// NewBroker returns a core NATS broker or a JetStream broker when the JetStream option is set
 func NewBroker(opts ...broker.Option) broker.Broker {
+	var options broker.Options
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.Context == nil {
+		return nats.NewBroker(opts...)
+	}
+	if v, ok := options.Context.Value(jetStreamKey{}).(bool); ok && v {
+		return newJetStreamBroker(opts...)
+	}
+
+	nopts := natsgo.GetDefaultOptions()
+	if v, ok := options.Context.Value(optionsKey{}).(natsgo.Options); ok {
+		nopts = v
+	}
+	// the core broker keeps its single connection, which follows discovered
+	// servers on its own, so only pinning needs to be passed on
+	if v, ok := options.Context.Value(pinSeedServersKey{}).(bool); ok && v {
+		natsdiscovery.NewPool(setAddrs(options.Addrs), true).Apply(&nopts)
+		opts = append(opts, nats.Options(nopts))
+	}
+
+	if size, _ := options.Context.Value(publisherPoolKey{}).(int); size > 1 {
+		return &pooledBroker{
+			Broker: nats.NewBroker(opts...),
+			size:   size,
+			nopts:  nopts,
+		}
+	}
 	return nats.NewBroker(opts...)
 }
@@ -0,0 +1,150 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+	"github.com/micro/go-plugins/broker/nats/v2/internal/expiration"
+	"github.com/nats-io/nats.go"
+)
+
+type jetStreamKey struct{}
+
+// JetStream publishes and subscribes through JetStream streams rather than
+// core NATS. A stream is created for each topic unless it already exists
+func JetStream() broker.Option {
+	return setBrokerOption(jetStreamKey{}, true)
+}
+
+type optionsKey struct{}
+
+// Options accepts nats.Options used by the JetStream broker, and by the core
+// broker when pinned to the seed servers
+func Options(opts nats.Options) broker.Option {
+	return setBrokerOption(optionsKey{}, opts)
+}
+
+type pinSeedServersKey struct{}
+
+// PinSeedServers only connects to the configured servers, servers of the cluster
+// discovered through the nats INFO protocol are ignored
+func PinSeedServers() broker.Option {
+	return setBrokerOption(pinSeedServersKey{}, true)
+}
+
+type publisherPoolKey struct{}
+
+// PublisherPool publishes through a pool of connections of the given size rather
+// than the single connection of the core broker, so concurrent publishers don't
+// wait for each other. Closed connections are replaced. JetStream publishes wait
+// for the server to store each message and aren't pooled
+func PublisherPool(size int) broker.Option {
+	return setBrokerOption(publisherPoolKey{}, size)
+}
+
+type flushOnPublishKey struct{}
+
+// FlushOnPublish makes a publish through the PublisherPool block until the server
+// processed the message, JetStream publishes always wait for the server
+func FlushOnPublish() broker.PublishOption {
+	return setPublishOption(flushOnPublishKey{}, true)
+}
+
+type streamMaxAgeKey struct{}
+
+// StreamMaxAge sets the max age of messages in streams created by the broker
+func StreamMaxAge(d time.Duration) broker.Option {
+	return setBrokerOption(streamMaxAgeKey{}, d)
+}
+
+type streamMemoryKey struct{}
+
+// StreamMemoryStorage keeps streams created by the broker in memory rather than on disk
+func StreamMemoryStorage() broker.Option {
+	return setBrokerOption(streamMemoryKey{}, true)
+}
+
+type streamReplicasKey struct{}
+
+// StreamReplicas sets the number of replicas of streams created by the broker
+func StreamReplicas(n int) broker.Option {
+	return setBrokerOption(streamReplicasKey{}, n)
+}
+
+type durableKey struct{}
+
+// Durable sets the name of the durable consumer. It defaults to the queue name,
+// subscriptions without either use an ephemeral consumer. Names with dots are
+// sanitized as consumer names can't hold them
+func Durable(name string) broker.SubscribeOption {
+	return setSubscribeOption(durableKey{}, name)
+}
+
+type ackPolicyKey struct{}
+
+// AckNone doesn't require messages to be acknowledged
+func AckNone() broker.SubscribeOption {
+	return setSubscribeOption(ackPolicyKey{}, ackNone)
+}
+
+// AckAll acknowledges all previous messages along with the acknowledged one
+func AckAll() broker.SubscribeOption {
+	return setSubscribeOption(ackPolicyKey{}, ackAll)
+}
+
+type ackWaitKey struct{}
+
+// AckWait sets how long the server waits for an ack before redelivering a message
+func AckWait(d time.Duration) broker.SubscribeOption {
+	return setSubscribeOption(ackWaitKey{}, d)
+}
+
+type maxDeliverKey struct{}
+
+// MaxDeliver sets the number of times a message is delivered before it is dropped
+func MaxDeliver(n int) broker.SubscribeOption {
+	return setSubscribeOption(maxDeliverKey{}, n)
+}
+
+type deliverPolicyKey struct{}
+
+// DeliverAll replays all messages in the stream, this is the default of durable
+// consumers
+func DeliverAll() broker.SubscribeOption {
+	return setSubscribeOption(deliverPolicyKey{}, deliverPolicy{policy: deliverAll})
+}
+
+// DeliverLast starts with the last message in the stream
+func DeliverLast() broker.SubscribeOption {
+	return setSubscribeOption(deliverPolicyKey{}, deliverPolicy{policy: deliverLast})
+}
+
+// DeliverNew only delivers messages published after the consumer was created,
+// this is the default of ephemeral consumers
+func DeliverNew() broker.SubscribeOption {
+	return setSubscribeOption(deliverPolicyKey{}, deliverPolicy{policy: deliverNew})
+}
+
+// StartSequence replays messages starting at the given stream sequence
+func StartSequence(seq uint64) broker.SubscribeOption {
+	return setSubscribeOption(deliverPolicyKey{}, deliverPolicy{policy: deliverByStartSequence, seq: seq})
+}
+
+// StartTime replays messages published since the given time
+func StartTime(t time.Time) broker.SubscribeOption {
+	return setSubscribeOption(deliverPolicyKey{}, deliverPolicy{policy: deliverByStartTime, time: t})
+}
+
+type replayOriginalKey struct{}
+
+// ReplayOriginal replays messages at the rate they were published rather than as fast as possible
+func ReplayOriginal() broker.SubscribeOption {
+	return setSubscribeOption(replayOriginalKey{}, true)
+}
+
+// Expiration sets a time to live for a message published through JetStream. The
+// max age of a stream applies to all its messages, so the deadline is sent as a
+// message header and expired messages are acked without being handled
+func Expiration(d time.Duration) broker.PublishOption {
+	return expiration.Expiration(d)
+}
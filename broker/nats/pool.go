@@ -0,0 +1,118 @@
+package memory
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/micro/go-micro/v2/broker"
+	"github.com/micro/go-plugins/broker/nats/v2/internal/pool"
+	natsgo "github.com/nats-io/nats.go"
+)
+
+// pooledBroker publishes through a pool of connections of its own, subscriptions
+// are made on the connection of the wrapped core broker
+type pooledBroker struct {
+	broker.Broker
+	size  int
+	nopts natsgo.Options
+
+	sync.RWMutex
+	pool *pool.Pool
+}
+
+type pooledConn struct {
+	*natsgo.Conn
+}
+
+// Healthy reports whether the connection is still open, connections reconnect on
+// their own until they run out of attempts and are closed
+func (c *pooledConn) Healthy() bool {
+	return !c.IsClosed()
+}
+
+func (c *pooledConn) Close() error {
+	c.Conn.Close()
+	return nil
+}
+
+func (b *pooledBroker) dial() (pool.Member, error) {
+	options := b.Broker.Options()
+
+	opts := b.nopts
+	opts.Servers = setAddrs(options.Addrs)
+	opts.Secure = options.Secure
+	opts.TLSConfig = options.TLSConfig
+
+	// secure might not be set
+	if options.TLSConfig != nil {
+		opts.Secure = true
+	}
+
+	c, err := opts.Connect()
+	if err != nil {
+		return nil, err
+	}
+	return &pooledConn{c}, nil
+}
+
+func (b *pooledBroker) Connect() error {
+	if err := b.Broker.Connect(); err != nil {
+		return err
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	if b.pool != nil {
+		return nil
+	}
+	p, err := pool.New(b.size, b.dial)
+	if err != nil {
+		return err
+	}
+	b.pool = p
+	return nil
+}
+
+func (b *pooledBroker) Disconnect() error {
+	b.Lock()
+	if b.pool != nil {
+		b.pool.Close()
+		b.pool = nil
+	}
+	b.Unlock()
+	return b.Broker.Disconnect()
+}
+
+func (b *pooledBroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	b.RLock()
+	p := b.pool
+	b.RUnlock()
+	if p == nil {
+		return errors.New("not connected")
+	}
+
+	var options broker.PublishOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	var flush bool
+	if options.Context != nil {
+		flush, _ = options.Context.Value(flushOnPublishKey{}).(bool)
+	}
+
+	buf, err := b.Broker.Options().Codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return p.Do(func(m pool.Member) error {
+		c := m.(*pooledConn)
+		if err := c.Publish(topic, buf); err != nil {
+			return err
+		}
+		if flush {
+			return c.Flush()
+		}
+		return nil
+	})
+}
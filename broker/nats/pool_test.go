@@ -0,0 +1,26 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/micro/go-micro/v2/broker"
+)
+
+func TestPublisherPool(t *testing.T) {
+	b := NewBroker(PublisherPool(4))
+	pb, ok := b.(*pooledBroker)
+	if !ok {
+		t.Fatalf("expected a pooled broker, got %T", b)
+	}
+	if pb.size != 4 {
+		t.Fatalf("expected a pool of 4, got %d", pb.size)
+	}
+	if err := b.Publish("foo", &broker.Message{}, FlushOnPublish()); err == nil {
+		t.Fatal("expected publishing before connecting to fail")
+	}
+
+	// a single connection isn't pooled
+	if _, ok := NewBroker(PublisherPool(1)).(*pooledBroker); ok {
+		t.Fatal("expected the core broker")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/micro/go-micro/v2/broker"
 	"github.com/micro/go-micro/v2/codec/json"
 	"github.com/micro/go-micro/v2/config/cmd"
+	log "github.com/micro/go-micro/v2/logger"
 	"github.com/nsqio/go-nsq"
 )
 
@@ -46,6 +47,12 @@ type subscriber struct {
 	n int
 }
 
+// requeue decides how messages whose handler failed are requeued
+type requeue struct {
+	min, max    time.Duration
+	maxAttempts int
+}
+
 var (
 	DefaultConcurrentHandlers = 1
 )
@@ -235,7 +242,17 @@ func (n *nsqBroker) Subscribe(topic string, handler broker.Handler, opts ...brok
 	}
 
 	concurrency, maxInFlight := DefaultConcurrentHandlers, DefaultConcurrentHandlers
+	var rq *requeue
 	if options.Context != nil {
+		if v, ok := options.Context.Value(requeueBackoffKey{}).([2]time.Duration); ok {
+			rq = &requeue{min: v[0], max: v[1]}
+		}
+		if v, ok := options.Context.Value(maxAttemptsKey{}).(int); ok {
+			if rq == nil {
+				rq = &requeue{}
+			}
+			rq.maxAttempts = v
+		}
 		if v, ok := options.Context.Value(concurrentHandlerKey{}).(int); ok {
 			maxInFlight, concurrency = v, v
 		}
@@ -256,18 +273,26 @@ func (n *nsqBroker) Subscribe(topic string, handler broker.Handler, opts ...brok
 	}
 
 	h := nsq.HandlerFunc(func(nm *nsq.Message) error {
-		if !options.AutoAck {
-			nm.DisableAutoResponse()
-		}
-
 		var m broker.Message
 
 		if err := n.opts.Codec.Unmarshal(nm.Body, &m); err != nil {
 			return err
 		}
 
-		p := &publication{topic: topic, m: &m}
+		if !options.AutoAck || rq != nil {
+			nm.DisableAutoResponse()
+		}
+
+		p := &publication{topic: topic, m: &m, nm: nm}
 		p.err = handler(p)
+
+		if rq != nil {
+			if p.err != nil {
+				rq.handle(topic, nm, p.err)
+			} else if options.AutoAck {
+				nm.Finish()
+			}
+		}
 		return p.err
 	})
 
@@ -295,6 +320,29 @@ func (n *nsqBroker) Subscribe(topic string, handler broker.Handler, opts ...brok
 	return sub, nil
 }
 
+// delay returns the requeue delay of the attempt, doubling from min up to max
+func (r *requeue) delay(attempts uint16) time.Duration {
+	d := r.min
+	for i := uint16(1); i < attempts && d < r.max; i++ {
+		d *= 2
+	}
+	if r.max > 0 && d > r.max {
+		d = r.max
+	}
+	return d
+}
+
+// handle requeues the message with backoff or finishes it after the max attempts
+func (r *requeue) handle(topic string, nm *nsq.Message, err error) {
+	if r.maxAttempts > 0 && int(nm.Attempts) >= r.maxAttempts {
+		log.Errorf("[nsq] giving up on message %s from %s after %d attempts: %v", nm.ID, topic, nm.Attempts, err)
+		nm.Finish()
+		return
+	}
+	// requeue without backoff so other messages aren't held up by this one
+	nm.RequeueWithoutBackoff(r.delay(nm.Attempts))
+}
+
 func (n *nsqBroker) String() string {
 	return "nsq"
 }
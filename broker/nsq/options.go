@@ -14,6 +14,8 @@ type asyncPublishKey struct{}
 type deferredPublishKey struct{}
 type lookupdAddrsKey struct{}
 type consumerOptsKey struct{}
+type requeueBackoffKey struct{}
+type maxAttemptsKey struct{}
 
 func WithConcurrentHandlers(n int) broker.SubscribeOption {
 	return func(o *broker.SubscribeOptions) {
@@ -33,6 +35,27 @@ func WithMaxInFlight(n int) broker.SubscribeOption {
 	}
 }
 
+// WithRequeueBackoff requeues messages whose handler failed with an exponential
+// delay, starting at min for the first attempt and doubling up to max
+func WithRequeueBackoff(min, max time.Duration) broker.SubscribeOption {
+	return func(o *broker.SubscribeOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, requeueBackoffKey{}, [2]time.Duration{min, max})
+	}
+}
+
+// WithMaxAttempts finishes messages whose handler failed n times instead of requeueing them
+func WithMaxAttempts(n int) broker.SubscribeOption {
+	return func(o *broker.SubscribeOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, maxAttemptsKey{}, n)
+	}
+}
+
 func WithAsyncPublish(doneChan chan *nsq.ProducerTransaction) broker.PublishOption {
 	return func(o *broker.PublishOptions) {
 		if o.Context == nil {
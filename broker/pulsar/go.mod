@@ -0,0 +1,8 @@
+module github.com/micro/go-plugins/broker/pulsar/v2
+
+go 1.13
+
+require (
+	github.com/apache/pulsar-client-go v0.6.0
+	github.com/micro/go-micro/v2 v2.9.1
+)
@@ -0,0 +1,67 @@
+package pulsar
+
+import (
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/micro/go-micro/v2/broker"
+)
+
+type clientOptionsKey struct{}
+type authTokenKey struct{}
+type trustCertsFileKey struct{}
+type subscriptionTypeKey struct{}
+type nackDelayKey struct{}
+type keyKey struct{}
+type deliverAfterKey struct{}
+
+// ClientOptions sets the options of the pulsar client, the URL is taken
+// from the broker addresses if set
+func ClientOptions(o pulsar.ClientOptions) broker.Option {
+	return setBrokerOption(clientOptionsKey{}, o)
+}
+
+// AuthToken authenticates with the given JWT token
+func AuthToken(token string) broker.Option {
+	return setBrokerOption(authTokenKey{}, token)
+}
+
+// TLSTrustCertsFile sets the file of trusted certificates for TLS connections
+func TLSTrustCertsFile(path string) broker.Option {
+	return setBrokerOption(trustCertsFileKey{}, path)
+}
+
+// Exclusive subscriptions allow a single consumer
+func Exclusive() broker.SubscribeOption {
+	return setSubscribeOption(subscriptionTypeKey{}, pulsar.Exclusive)
+}
+
+// Shared subscriptions distribute messages round robin across consumers
+func Shared() broker.SubscribeOption {
+	return setSubscribeOption(subscriptionTypeKey{}, pulsar.Shared)
+}
+
+// Failover subscriptions deliver to a single active consumer, the others take over on failure
+func Failover() broker.SubscribeOption {
+	return setSubscribeOption(subscriptionTypeKey{}, pulsar.Failover)
+}
+
+// KeyShared subscriptions distribute messages across consumers by their key, see Key
+func KeyShared() broker.SubscribeOption {
+	return setSubscribeOption(subscriptionTypeKey{}, pulsar.KeyShared)
+}
+
+// NackRedeliveryDelay sets how long messages are held back after a handler failed
+func NackRedeliveryDelay(d time.Duration) broker.SubscribeOption {
+	return setSubscribeOption(nackDelayKey{}, d)
+}
+
+// Key sets the message key, which orders messages on key shared subscriptions
+func Key(k string) broker.PublishOption {
+	return setPublishOption(keyKey{}, k)
+}
+
+// DeliverAfter delays the delivery of the message to shared subscriptions
+func DeliverAfter(d time.Duration) broker.PublishOption {
+	return setPublishOption(deliverAfterKey{}, d)
+}
@@ -0,0 +1,433 @@
+// Package pulsar provides an Apache Pulsar broker
+package pulsar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/micro/go-micro/v2/broker"
+	"github.com/micro/go-micro/v2/config/cmd"
+	log "github.com/micro/go-micro/v2/logger"
+)
+
+/*
+	Messages are published with their headers as pulsar properties and their body
+	as the payload, so they can be exchanged with non micro producers and consumers.
+	Subscribers with a queue share a durable shared subscription named after the
+	queue. Messages whose handler fails are negatively acknowledged and redelivered
+	after the nack redelivery delay.
+
+	Other subscribers read the topic through a reader per partition. Readers are
+	backed by non-durable subscriptions the broker removes once they disconnect, so
+	crashed processes don't leave subscriptions behind whose backlog keeps growing.
+	They only get messages published while they're connected and messages whose
+	handler fails aren't redelivered.
+*/
+
+type pulsarBroker struct {
+	addrs []string
+	opts  broker.Options
+
+	sync.RWMutex
+	client    pulsar.Client
+	producers map[string]pulsar.Producer
+}
+
+type subscriber struct {
+	topic  string
+	opts   broker.SubscribeOptions
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// the consumer of queue subscriptions
+	c pulsar.Consumer
+	// the readers of the partitions of other subscriptions
+	readers []pulsar.Reader
+}
+
+type publication struct {
+	topic string
+	m     *broker.Message
+	msg   pulsar.Message
+	c     pulsar.Consumer
+	err   error
+}
+
+func init() {
+	cmd.DefaultBrokers["pulsar"] = NewBroker
+}
+
+func (p *publication) Topic() string {
+	return p.topic
+}
+
+func (p *publication) Message() *broker.Message {
+	return p.m
+}
+
+func (p *publication) Ack() error {
+	// readers don't acknowledge messages
+	if p.c != nil {
+		p.c.Ack(p.msg)
+	}
+	return nil
+}
+
+func (p *publication) Error() error {
+	return p.err
+}
+
+func (s *subscriber) Options() broker.SubscribeOptions {
+	return s.opts
+}
+
+func (s *subscriber) Topic() string {
+	return s.topic
+}
+
+func (s *subscriber) Unsubscribe() error {
+	s.cancel()
+	s.wg.Wait()
+
+	if s.c != nil {
+		s.c.Close()
+	}
+	for _, r := range s.readers {
+		r.Close()
+	}
+	return nil
+}
+
+func (s *subscriber) run(h broker.Handler, ctx context.Context) {
+	defer s.wg.Done()
+
+	for {
+		msg, err := s.c.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Errorf("[pulsar] failed to receive from %s: %v", s.topic, err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		p := &publication{
+			topic: s.topic,
+			m: &broker.Message{
+				Header: msg.Properties(),
+				Body:   msg.Payload(),
+			},
+			msg: msg,
+			c:   s.c,
+		}
+
+		if p.err = h(p); p.err != nil {
+			s.c.Nack(msg)
+			continue
+		}
+		if s.opts.AutoAck {
+			p.Ack()
+		}
+	}
+}
+
+// read handles the messages of a reader, which can't be redelivered
+func (s *subscriber) read(r pulsar.Reader, h broker.Handler, ctx context.Context) {
+	defer s.wg.Done()
+
+	for {
+		msg, err := r.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Errorf("[pulsar] failed to read from %s: %v", r.Topic(), err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		p := &publication{
+			topic: s.topic,
+			m: &broker.Message{
+				Header: msg.Properties(),
+				Body:   msg.Payload(),
+			},
+			msg: msg,
+		}
+
+		if p.err = h(p); p.err != nil {
+			log.Errorf("[pulsar] subscriber error on %s: %v", s.topic, p.err)
+		}
+	}
+}
+
+// setAddrs prepends the pulsar scheme to addresses missing one
+func setAddrs(addrs []string, secure bool) []string {
+	scheme := "pulsar://"
+	port := "6650"
+	if secure {
+		scheme = "pulsar+ssl://"
+		port = "6651"
+	}
+
+	var cAddrs []string
+	for _, addr := range addrs {
+		if len(addr) == 0 {
+			continue
+		}
+		if !strings.Contains(addr, "://") {
+			addr = scheme + addr
+		}
+		cAddrs = append(cAddrs, addr)
+	}
+	if len(cAddrs) == 0 {
+		cAddrs = []string{scheme + "127.0.0.1:" + port}
+	}
+	return cAddrs
+}
+
+// serviceURL joins the hosts of the addresses under a single scheme, the form pulsar
+// takes for multiple brokers e.g pulsar://10.0.0.1:6650,10.0.0.2:6650
+func serviceURL(addrs []string) string {
+	var scheme string
+	hosts := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		parts := strings.SplitN(addr, "://", 2)
+		if len(scheme) == 0 {
+			scheme = parts[0]
+		}
+		hosts = append(hosts, parts[len(parts)-1])
+	}
+	return scheme + "://" + strings.Join(hosts, ",")
+}
+
+func (p *pulsarBroker) Address() string {
+	return strings.Join(p.addrs, ",")
+}
+
+func (p *pulsarBroker) Connect() error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.client != nil {
+		return nil
+	}
+
+	var opts pulsar.ClientOptions
+	if o, ok := p.opts.Context.Value(clientOptionsKey{}).(pulsar.ClientOptions); ok {
+		opts = o
+	}
+	if len(p.opts.Addrs) > 0 || len(opts.URL) == 0 {
+		opts.URL = serviceURL(p.addrs)
+	}
+	if token, ok := p.opts.Context.Value(authTokenKey{}).(string); ok {
+		opts.Authentication = pulsar.NewAuthenticationToken(token)
+	}
+	if path, ok := p.opts.Context.Value(trustCertsFileKey{}).(string); ok {
+		opts.TLSTrustCertsFilePath = path
+	}
+	if p.opts.TLSConfig != nil && p.opts.TLSConfig.InsecureSkipVerify {
+		opts.TLSAllowInsecureConnection = true
+	}
+
+	c, err := pulsar.NewClient(opts)
+	if err != nil {
+		return err
+	}
+	p.client = c
+	p.producers = make(map[string]pulsar.Producer)
+	return nil
+}
+
+func (p *pulsarBroker) Disconnect() error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.client == nil {
+		return nil
+	}
+	for _, pr := range p.producers {
+		pr.Close()
+	}
+	p.client.Close()
+	p.client = nil
+	p.producers = nil
+	return nil
+}
+
+func (p *pulsarBroker) Init(opts ...broker.Option) error {
+	for _, o := range opts {
+		o(&p.opts)
+	}
+	p.addrs = setAddrs(p.opts.Addrs, p.opts.Secure || p.opts.TLSConfig != nil)
+	return nil
+}
+
+func (p *pulsarBroker) Options() broker.Options {
+	return p.opts
+}
+
+// producer returns the producer of the topic, producers are created on first use
+func (p *pulsarBroker) producer(topic string) (pulsar.Producer, error) {
+	p.RLock()
+	if p.client == nil {
+		p.RUnlock()
+		return nil, errors.New("not connected")
+	}
+	pr, ok := p.producers[topic]
+	p.RUnlock()
+	if ok {
+		return pr, nil
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if pr, ok := p.producers[topic]; ok {
+		return pr, nil
+	}
+	pr, err := p.client.CreateProducer(pulsar.ProducerOptions{
+		Topic: topic,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.producers[topic] = pr
+	return pr, nil
+}
+
+func (p *pulsarBroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	options := broker.PublishOptions{
+		Context: context.Background(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	pr, err := p.producer(topic)
+	if err != nil {
+		return err
+	}
+
+	pm := &pulsar.ProducerMessage{
+		Payload:    msg.Body,
+		Properties: msg.Header,
+	}
+	if k, ok := options.Context.Value(keyKey{}).(string); ok {
+		pm.Key = k
+	}
+	if d, ok := options.Context.Value(deliverAfterKey{}).(time.Duration); ok {
+		pm.DeliverAfter = d
+	}
+
+	_, err = pr.Send(options.Context, pm)
+	return err
+}
+
+func (p *pulsarBroker) Subscribe(topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	options := broker.SubscribeOptions{
+		AutoAck: true,
+		Context: context.Background(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	p.RLock()
+	client := p.client
+	p.RUnlock()
+	if client == nil {
+		return nil, errors.New("not connected")
+	}
+
+	if len(options.Queue) == 0 {
+		return p.read(client, topic, h, options)
+	}
+
+	copts := pulsar.ConsumerOptions{
+		Topic:            topic,
+		SubscriptionName: options.Queue,
+		Type:             pulsar.Shared,
+	}
+	if t, ok := options.Context.Value(subscriptionTypeKey{}).(pulsar.SubscriptionType); ok {
+		copts.Type = t
+	}
+	if d, ok := options.Context.Value(nackDelayKey{}).(time.Duration); ok {
+		copts.NackRedeliveryDelay = d
+	}
+
+	c, err := client.Subscribe(copts)
+	if err != nil {
+		return nil, fmt.Errorf("subscribe to %s: %v", topic, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &subscriber{
+		topic:  topic,
+		opts:   options,
+		cancel: cancel,
+		c:      c,
+	}
+	s.wg.Add(1)
+	go s.run(h, ctx)
+
+	return s, nil
+}
+
+// read subscribes through a reader per partition of the topic, starting at the
+// latest message
+func (p *pulsarBroker) read(client pulsar.Client, topic string, h broker.Handler, options broker.SubscribeOptions) (broker.Subscriber, error) {
+	partitions, err := client.TopicPartitions(topic)
+	if err != nil {
+		return nil, fmt.Errorf("subscribe to %s: %v", topic, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &subscriber{
+		topic:  topic,
+		opts:   options,
+		cancel: cancel,
+	}
+	for _, partition := range partitions {
+		r, err := client.CreateReader(pulsar.ReaderOptions{
+			Topic:          partition,
+			StartMessageID: pulsar.LatestMessageID(),
+		})
+		if err != nil {
+			s.Unsubscribe()
+			return nil, fmt.Errorf("subscribe to %s: %v", partition, err)
+		}
+		s.readers = append(s.readers, r)
+	}
+
+	for _, r := range s.readers {
+		s.wg.Add(1)
+		go s.read(r, h, ctx)
+	}
+	return s, nil
+}
+
+func (p *pulsarBroker) String() string {
+	return "pulsar"
+}
+
+func NewBroker(opts ...broker.Option) broker.Broker {
+	options := broker.Options{
+		Context: context.Background(),
+	}
+
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return &pulsarBroker{
+		addrs: setAddrs(options.Addrs, options.Secure || options.TLSConfig != nil),
+		opts:  options,
+	}
+}
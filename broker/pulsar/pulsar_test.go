@@ -0,0 +1,42 @@
+package pulsar
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetAddrs(t *testing.T) {
+	testData := []struct {
+		addrs  []string
+		secure bool
+		expect []string
+	}{
+		{nil, false, []string{"pulsar://127.0.0.1:6650"}},
+		{nil, true, []string{"pulsar+ssl://127.0.0.1:6651"}},
+		{[]string{"10.0.0.1:6650", ""}, false, []string{"pulsar://10.0.0.1:6650"}},
+		{[]string{"pulsar+ssl://10.0.0.1:6651"}, false, []string{"pulsar+ssl://10.0.0.1:6651"}},
+	}
+
+	for _, d := range testData {
+		if addrs := setAddrs(d.addrs, d.secure); !reflect.DeepEqual(addrs, d.expect) {
+			t.Fatalf("expected %v, got %v", d.expect, addrs)
+		}
+	}
+}
+
+func TestServiceURL(t *testing.T) {
+	testData := []struct {
+		addrs  []string
+		expect string
+	}{
+		{[]string{"pulsar://10.0.0.1:6650"}, "pulsar://10.0.0.1:6650"},
+		{[]string{"pulsar://10.0.0.1:6650", "pulsar://10.0.0.2:6650"}, "pulsar://10.0.0.1:6650,10.0.0.2:6650"},
+		{[]string{"pulsar+ssl://10.0.0.1:6651", "10.0.0.2:6651"}, "pulsar+ssl://10.0.0.1:6651,10.0.0.2:6651"},
+	}
+
+	for _, d := range testData {
+		if url := serviceURL(d.addrs); url != d.expect {
+			t.Fatalf("expected %s, got %s", d.expect, url)
+		}
+	}
+}
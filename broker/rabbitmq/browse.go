@@ -0,0 +1,65 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+)
+
+// Peek gets up to n messages from the queue on a channel of its own and closes
+// the channel without acking, which returns them to the queue. Peeked messages
+// are marked as redelivered and count as a delivery on quorum queues
+func (r *rbroker) Peek(queue string, n int) ([]*broker.Message, error) {
+	if r.conn == nil || r.conn.Connection == nil {
+		return nil, errors.New("not connected")
+	}
+
+	ch, err := r.conn.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+	defer ch.Close()
+
+	var msgs []*broker.Message
+	for i := 0; i < n; i++ {
+		d, ok, err := ch.Get(queue, false)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+
+		header := make(map[string]string, len(d.Headers))
+		for k, v := range d.Headers {
+			header[k] = fmt.Sprintf("%v", v)
+		}
+		msgs = append(msgs, &broker.Message{Header: header, Body: d.Body})
+	}
+
+	return msgs, nil
+}
+
+// Depth returns the number of ready messages in the queue from a passive declare,
+// which doesn't touch the messages. The age is always zero as rabbitmq doesn't
+// report it, use the management API for it
+func (r *rbroker) Depth(queue string) (int64, time.Duration, error) {
+	if r.conn == nil || r.conn.Connection == nil {
+		return 0, 0, errors.New("not connected")
+	}
+
+	// a failed declare closes the channel
+	ch, err := r.conn.Connection.Channel()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer ch.Close()
+
+	q, err := ch.QueueDeclarePassive(queue, false, false, false, false, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int64(q.Messages), 0, nil
+}
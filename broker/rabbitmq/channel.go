@@ -6,6 +6,7 @@ package rabbitmq
 
 import (
 	"errors"
+	"sync"
 
 	"github.com/google/uuid"
 	"github.com/streadway/amqp"
@@ -15,6 +16,11 @@ type rabbitMQChannel struct {
 	uuid       string
 	connection *amqp.Connection
 	channel    *amqp.Channel
+
+	// publisher confirms, pending callbacks are keyed by delivery tag
+	mtx     sync.Mutex
+	seq     uint64
+	pending map[uint64]func(ack bool)
 }
 
 func newRabbitChannel(conn *amqp.Connection, prefetchCount int, prefetchGlobal bool) (*rabbitMQChannel, error) {
@@ -60,6 +66,66 @@ func (r *rabbitMQChannel) Publish(exchange, key string, message amqp.Publishing)
 	return r.channel.Publish(exchange, key, false, false, message)
 }
 
+// EnableConfirms puts the channel into confirm mode
+func (r *rabbitMQChannel) EnableConfirms() error {
+	if r.channel == nil {
+		return errors.New("Channel is nil")
+	}
+	if err := r.channel.Confirm(false); err != nil {
+		return err
+	}
+	r.mtx.Lock()
+	r.pending = make(map[uint64]func(bool))
+	r.mtx.Unlock()
+	go r.confirmLoop(r.channel.NotifyPublish(make(chan amqp.Confirmation, 64)))
+	return nil
+}
+
+// confirmLoop dispatches confirmations until the channel is closed, at which
+// point everything still pending is reported as nacked
+func (r *rabbitMQChannel) confirmLoop(confirms <-chan amqp.Confirmation) {
+	for c := range confirms {
+		r.mtx.Lock()
+		fn := r.pending[c.DeliveryTag]
+		delete(r.pending, c.DeliveryTag)
+		r.mtx.Unlock()
+		if fn != nil {
+			fn(c.Ack)
+		}
+	}
+
+	r.mtx.Lock()
+	pending := r.pending
+	r.pending = make(map[uint64]func(bool))
+	r.mtx.Unlock()
+	for _, fn := range pending {
+		fn(false)
+	}
+}
+
+// PublishConfirm publishes a message on a channel in confirm mode, fn is called
+// once the server acks or nacks it
+func (r *rabbitMQChannel) PublishConfirm(exchange, key string, message amqp.Publishing, fn func(ack bool)) error {
+	if r.channel == nil {
+		return errors.New("Channel is nil")
+	}
+
+	// delivery tags are assigned in publish order so hold the lock while publishing
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.pending == nil {
+		return errors.New("Channel is not in confirm mode")
+	}
+	r.seq++
+	tag := r.seq
+	r.pending[tag] = fn
+	if err := r.channel.Publish(exchange, key, false, false, message); err != nil {
+		delete(r.pending, tag)
+		return err
+	}
+	return nil
+}
+
 func (r *rabbitMQChannel) DeclareExchange(exchange string) error {
 	return r.channel.ExchangeDeclare(
 		exchange, // name
@@ -22,6 +22,7 @@ var (
 	DefaultPrefetchCount  = 0
 	DefaultPrefetchGlobal = false
 	DefaultRequeueOnError = false
+	DefaultRetryBackoff   = 100 * time.Millisecond
 
 	// The amqp library does not seem to set these when using amqp.DialConfig
 	// (even though it says so in the comments) so we set them manually to make
@@ -45,8 +46,21 @@ type rabbitMQConn struct {
 	ExchangeChannel *rabbitMQChannel
 	exchange        Exchange
 	url             string
-	prefetchCount   int
-	prefetchGlobal  bool
+	// what the connection was dialed with, to dial throwaway connections
+	dialURL        string
+	dialConfig     amqp.Config
+	prefetchCount  int
+	prefetchGlobal bool
+	confirm        bool
+
+	// publisher channel pool, used instead of the exchange channel when set
+	poolSize int
+	pool     *channelPool
+
+	// delayed publishing setup, detected on first use
+	delayMtx    sync.Mutex
+	delayMode   int
+	delayQueues map[int64]bool
 
 	sync.Mutex
 	connected bool
@@ -176,6 +190,9 @@ func (r *rabbitMQConn) Close() error {
 		r.connected = false
 	}
 
+	if r.pool != nil {
+		r.pool.Close()
+	}
 	return r.Connection.Close()
 }
 
@@ -198,12 +215,15 @@ func (r *rabbitMQConn) tryConnect(secure bool, config *amqp.Config) error {
 		url = strings.Replace(r.url, "amqp://", "amqps://", 1)
 	}
 
+	r.dialURL, r.dialConfig = url, *config
 	r.Connection, err = dialConfig(url, *config)
 
 	if err != nil {
 		return err
 	}
 
+	r.resetDelay()
+
 	if r.Channel, err = newRabbitChannel(r.Connection, r.prefetchCount, r.prefetchGlobal); err != nil {
 		return err
 	}
@@ -213,9 +233,25 @@ func (r *rabbitMQConn) tryConnect(secure bool, config *amqp.Config) error {
 	} else {
 		r.Channel.DeclareExchange(r.exchange.Name)
 	}
-	r.ExchangeChannel, err = newRabbitChannel(r.Connection, r.prefetchCount, r.prefetchGlobal)
+	if r.ExchangeChannel, err = newRabbitChannel(r.Connection, r.prefetchCount, r.prefetchGlobal); err != nil {
+		return err
+	}
+
+	if r.poolSize > 1 {
+		// the channels of the pool were closed along with the previous connection
+		if r.pool != nil {
+			r.pool.Close()
+		}
+		if r.pool, err = newChannelPool(r.Connection, r.poolSize, r.confirm); err != nil {
+			return err
+		}
+	}
 
-	return err
+	if r.confirm {
+		return r.ExchangeChannel.EnableConfirms()
+	}
+
+	return nil
 }
 
 func (r *rabbitMQConn) Consume(queue, key string, headers amqp.Table, qArgs amqp.Table, autoAck, durableQueue bool) (*rabbitMQChannel, <-chan amqp.Delivery, error) {
@@ -248,5 +284,15 @@ func (r *rabbitMQConn) Consume(queue, key string, headers amqp.Table, qArgs amqp
 }
 
 func (r *rabbitMQConn) Publish(exchange, key string, msg amqp.Publishing) error {
+	if r.pool != nil {
+		return r.pool.Publish(exchange, key, msg)
+	}
 	return r.ExchangeChannel.Publish(exchange, key, msg)
 }
+
+func (r *rabbitMQConn) PublishConfirm(exchange, key string, msg amqp.Publishing, fn func(ack bool)) error {
+	if r.pool != nil {
+		return r.pool.PublishConfirm(exchange, key, msg, fn)
+	}
+	return r.ExchangeChannel.PublishConfirm(exchange, key, msg, fn)
+}
@@ -0,0 +1,178 @@
+package rabbitmq
+
+import (
+	"strconv"
+	"time"
+
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-plugins/broker/rabbitmq/v2/internal/expiration"
+	"github.com/streadway/amqp"
+)
+
+const (
+	delayUnknown = iota
+	// delayPlugin uses the rabbitmq_delayed_message_exchange plugin
+	delayPlugin
+	// delayTTL parks messages in a queue with a TTL which dead letters them to the exchange
+	delayTTL
+)
+
+// delayHeader routes a message to the delay queue for its duration
+const delayHeader = "x-micro-delay"
+
+// resetDelay forgets the delay setup so it is declared again on a new connection
+func (r *rabbitMQConn) resetDelay() {
+	r.delayMtx.Lock()
+	r.delayMode = delayUnknown
+	r.delayQueues = make(map[int64]bool)
+	r.delayMtx.Unlock()
+}
+
+// delayBucket rounds the delay in milliseconds up to two significant digits, e.g.
+// 1234 to 1300, so computed delays like backoff with jitter share a fixed set of
+// delay queues, at most 90 per power of ten, and are delivered at most 10% late
+func delayBucket(ms int64) int64 {
+	unit := int64(1)
+	for ms >= 100*unit {
+		unit *= 10
+	}
+	return (ms + unit - 1) / unit * unit
+}
+
+// delayExchange prepares a message to be delivered after the given delay and returns
+// the exchange it must be published to. The delayed message exchange plugin is used
+// when the server supports it, otherwise a queue per bucket of delays is declared
+func (r *rabbitMQConn) delayExchange(delay time.Duration, msg *amqp.Publishing) (string, error) {
+	r.delayMtx.Lock()
+	defer r.delayMtx.Unlock()
+
+	if r.delayMode == delayUnknown {
+		mode, err := r.detectDelayMode()
+		if err != nil {
+			return "", err
+		}
+		r.delayMode = mode
+	}
+
+	if msg.Headers == nil {
+		msg.Headers = amqp.Table{}
+	}
+
+	// rounded up, a delay below a millisecond isn't a delay of zero
+	ms := expiration.Milliseconds(delay)
+
+	if r.delayMode == delayPlugin {
+		msg.Headers["x-delay"] = ms
+		return r.exchange.Name + ".delayed", nil
+	}
+
+	ms = delayBucket(ms)
+	key := strconv.FormatInt(ms, 10)
+	if !r.delayQueues[ms] {
+		if err := r.declareDelayQueue(key, ms); err != nil {
+			return "", err
+		}
+		r.delayQueues[ms] = true
+	}
+	msg.Headers[delayHeader] = key
+	return r.exchange.Name + ".delay", nil
+}
+
+// detectDelayMode declares the delayed message exchange and falls back to a
+// headers exchange for delay queues when that fails, e.g. as the plugin is not
+// installed
+func (r *rabbitMQConn) detectDelayMode() (int, error) {
+	err := r.declareDelayedExchange()
+	if err == nil {
+		return delayPlugin, nil
+	}
+	log.Infof("[rabbitmq] delaying messages with queues, the delayed message exchange failed: %v", err)
+
+	ch, err := r.Connection.Channel()
+	if err != nil {
+		return delayUnknown, err
+	}
+	defer ch.Close()
+
+	if err := ch.ExchangeDeclare(
+		r.exchange.Name+".delay", // name
+		"headers",                // kind
+		r.exchange.Durable,       // durable
+		false,                    // autoDelete
+		false,                    // internal
+		false,                    // noWait
+		nil,                      // args
+	); err != nil {
+		return delayUnknown, err
+	}
+	return delayTTL, nil
+}
+
+// declareDelayedExchange declares the delayed message exchange on a throwaway
+// connection, the server closes the whole connection on an unknown exchange
+// type which would take the subscriptions of the broker down with it
+func (r *rabbitMQConn) declareDelayedExchange() error {
+	conn, err := dialConfig(r.dialURL, r.dialConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	delayed := r.exchange.Name + ".delayed"
+	args := amqp.Table{"x-delayed-type": "topic"}
+	if err := ch.ExchangeDeclare(
+		delayed,             // name
+		"x-delayed-message", // kind
+		r.exchange.Durable,  // durable
+		false,               // autoDelete
+		false,               // internal
+		false,               // noWait
+		args,                // args
+	); err != nil {
+		return err
+	}
+
+	// forward messages into the exchange once they are due
+	return ch.ExchangeBind(r.exchange.Name, "#", delayed, false, nil)
+}
+
+// declareDelayQueue declares a queue holding messages for the given delay before
+// dead lettering them to the exchange with their original routing key
+func (r *rabbitMQConn) declareDelayQueue(key string, ms int64) error {
+	ch, err := r.Connection.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	queue := r.exchange.Name + ".delay." + key
+	args := amqp.Table{
+		"x-message-ttl":          ms,
+		"x-dead-letter-exchange": r.exchange.Name,
+	}
+	if _, err := ch.QueueDeclare(
+		queue, // name
+		true,  // durable
+		false, // autoDelete
+		false, // exclusive
+		false, // noWait
+		args,  // args
+	); err != nil {
+		return err
+	}
+
+	bindArgs := amqp.Table{"x-match": "all", delayHeader: key}
+	return ch.QueueBind(
+		queue,                    // name
+		"",                       // key
+		r.exchange.Name+".delay", // exchange
+		false,                    // noWait
+		bindArgs,                 // args
+	)
+}
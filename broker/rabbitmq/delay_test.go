@@ -0,0 +1,27 @@
+package rabbitmq
+
+import (
+	"testing"
+)
+
+func TestDelayBucket(t *testing.T) {
+	testData := []struct {
+		ms     int64
+		bucket int64
+	}{
+		{1, 1},
+		{99, 99},
+		{100, 100},
+		{101, 110},
+		{995, 1000},
+		{1234, 1300},
+		{60000, 60000},
+		{61001, 62000},
+	}
+
+	for _, d := range testData {
+		if b := delayBucket(d.ms); b != d.bucket {
+			t.Fatalf("expected the bucket %d for %d ms got %d", d.bucket, d.ms, b)
+		}
+	}
+}
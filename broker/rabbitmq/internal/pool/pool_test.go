@@ -0,0 +1,84 @@
+package pool
+
+import (
+	"errors"
+	"testing"
+)
+
+type member struct {
+	id     int
+	broken bool
+	closed bool
+}
+
+func (m *member) Healthy() bool {
+	return !m.broken
+}
+
+func (m *member) Close() error {
+	m.closed = true
+	return nil
+}
+
+func TestPool(t *testing.T) {
+	var dialed []*member
+	var fail bool
+	p, err := New(2, func() (Member, error) {
+		if fail {
+			return nil, errors.New("unreachable")
+		}
+		m := &member{id: len(dialed)}
+		dialed = append(dialed, m)
+		return m, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dialed) != 2 {
+		t.Fatalf("expected 2 members, got %d", len(dialed))
+	}
+
+	// a broken member is kept while no replacement can be dialed
+	dialed[0].broken = true
+	fail = true
+	if _, err := p.Get(); err == nil {
+		t.Fatal("expected the dial error")
+	}
+	if dialed[0].closed {
+		t.Fatal("expected the broken member to be kept")
+	}
+
+	// and replaced once the dial succeeds
+	fail = false
+	var used []int
+	for i := 0; i < 2; i++ {
+		if err := p.Do(func(m Member) error {
+			used = append(used, m.(*member).id)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !dialed[0].closed || len(dialed) != 3 {
+		t.Fatalf("expected the broken member to be replaced, dialed %d", len(dialed))
+	}
+	if used[0] != 1 || used[1] != 2 {
+		t.Fatalf("unexpected members used %v", used)
+	}
+
+	m, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+	if _, err := p.Get(); err != ErrClosed {
+		t.Fatalf("expected %v, got %v", ErrClosed, err)
+	}
+	if !dialed[2].closed || dialed[1].closed {
+		t.Fatal("expected only the members in the pool to be closed")
+	}
+	p.Put(m)
+	if !m.(*member).closed {
+		t.Fatal("expected the returned member to be closed")
+	}
+}
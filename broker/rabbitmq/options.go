@@ -2,8 +2,10 @@ package rabbitmq
 
 import (
 	"context"
+	"time"
 
 	"github.com/micro/go-micro/v2/broker"
+	"github.com/micro/go-plugins/broker/rabbitmq/v2/internal/expiration"
 )
 
 type durableQueueKey struct{}
@@ -15,8 +17,24 @@ type exchangeKey struct{}
 type requeueOnErrorKey struct{}
 type deliveryMode struct{}
 type priorityKey struct{}
+type delayKey struct{}
+type maxRetriesKey struct{}
+type retryBackoffKey struct{}
+type deadLetterExchangeKey struct{}
+type quorumQueueKey struct{}
+type lazyQueueKey struct{}
+type messageTTLKey struct{}
+type maxLengthKey struct{}
+type maxPriorityKey struct{}
 type externalAuth struct{}
 type durableExchange struct{}
+type publisherConfirmsKey struct{}
+type confirmCallbackKey struct{}
+type publisherPoolKey struct{}
+type waitForConfirmKey struct{}
+
+// ConfirmFunc is called with the outcome of a published message in confirm mode
+type ConfirmFunc func(topic string, msg *broker.Message, ack bool)
 
 // DurableQueue creates a durable queue when subscribing.
 func DurableQueue() broker.SubscribeOption {
@@ -28,6 +46,33 @@ func DurableExchange() broker.Option {
 	return setBrokerOption(durableExchange{}, true)
 }
 
+// PublisherConfirms puts the publishing channel into confirm mode. Publish blocks
+// until the server acknowledged the message and returns an error when it is nacked
+func PublisherConfirms() broker.Option {
+	return setBrokerOption(publisherConfirmsKey{}, true)
+}
+
+// ConfirmCallback puts the publishing channel into confirm mode. Publish returns
+// once the message is written and fn is called when the server acks or nacks it.
+// Messages still pending when the connection drops are reported as nacked
+func ConfirmCallback(fn ConfirmFunc) broker.Option {
+	return setBrokerOption(confirmCallbackKey{}, fn)
+}
+
+// PublisherPool publishes through a pool of channels of the given size rather than
+// a single channel, improving throughput of concurrent publishers. Channels closed
+// by the server are replaced
+func PublisherPool(size int) broker.Option {
+	return setBrokerOption(publisherPoolKey{}, size)
+}
+
+// WaitForConfirm overrides whether Publish blocks until the server confirmed the
+// message. PublisherConfirms waits by default and ConfirmCallback doesn't. Requires
+// either of them to be set
+func WaitForConfirm(wait bool) broker.PublishOption {
+	return setPublishOption(waitForConfirmKey{}, wait)
+}
+
 // Headers adds headers used by the headers exchange
 func Headers(h map[string]interface{}) broker.SubscribeOption {
 	return setSubscribeOption(headersKey{}, h)
@@ -38,6 +83,52 @@ func QueueArguments(h map[string]interface{}) broker.SubscribeOption {
 	return setSubscribeOption(queueArgumentsKey{}, h)
 }
 
+// MaxRetries sets how many times a message is redelivered to the handler after it
+// returned an error. The delay between attempts starts at RetryBackoff and doubles
+func MaxRetries(n int) broker.SubscribeOption {
+	return setSubscribeOption(maxRetriesKey{}, n)
+}
+
+// RetryBackoff sets the delay before the first retry, defaults to DefaultRetryBackoff
+func RetryBackoff(d time.Duration) broker.SubscribeOption {
+	return setSubscribeOption(retryBackoffKey{}, d)
+}
+
+// DeadLetterExchange declares the queue with the given dead letter exchange. Messages
+// are rejected to it once the handler has failed and all retries are exhausted. The
+// exchange must already exist. Dead lettering requires manual acknowledgement so
+// auto ack is replaced with AckOnSuccess
+func DeadLetterExchange(name string) broker.SubscribeOption {
+	return setSubscribeOption(deadLetterExchangeKey{}, name)
+}
+
+// QuorumQueue declares a replicated quorum queue when subscribing. Quorum queues
+// are always durable
+func QuorumQueue() broker.SubscribeOption {
+	return setSubscribeOption(quorumQueueKey{}, true)
+}
+
+// LazyQueue declares the queue in lazy mode, keeping messages on disk
+func LazyQueue() broker.SubscribeOption {
+	return setSubscribeOption(lazyQueueKey{}, true)
+}
+
+// MessageTTL sets the x-message-ttl of the queue
+func MessageTTL(d time.Duration) broker.SubscribeOption {
+	return setSubscribeOption(messageTTLKey{}, d)
+}
+
+// MaxLength sets the x-max-length of the queue
+func MaxLength(n int) broker.SubscribeOption {
+	return setSubscribeOption(maxLengthKey{}, n)
+}
+
+// MaxPriority declares a priority queue supporting priorities up to the given
+// level. Messages are published with a priority using the Priority option
+func MaxPriority(n uint8) broker.SubscribeOption {
+	return setSubscribeOption(maxPriorityKey{}, n)
+}
+
 // RequeueOnError calls Nack(muliple:false, requeue:true) on amqp delivery when handler returns error
 func RequeueOnError() broker.SubscribeOption {
 	return setSubscribeOption(requeueOnErrorKey{}, true)
@@ -63,11 +154,26 @@ func DeliveryMode(value uint8) broker.PublishOption {
 	return setPublishOption(deliveryMode{}, value)
 }
 
-// Priority sets a priority level for publishing
+// Priority sets a priority level for publishing. It only has an effect on queues
+// declared with MaxPriority
 func Priority(value uint8) broker.PublishOption {
 	return setPublishOption(priorityKey{}, value)
 }
 
+// Expiration sets the per-message TTL for publishing. Messages which are not
+// consumed within the given duration are discarded by the server
+func Expiration(d time.Duration) broker.PublishOption {
+	return expiration.Expiration(d)
+}
+
+// Delay schedules the message to be delivered after the given duration. The
+// rabbitmq_delayed_message_exchange plugin is used when installed, otherwise
+// delays are rounded up to two significant digits of milliseconds and a queue per
+// rounded delay holds messages until they are dead lettered back to the exchange
+func Delay(d time.Duration) broker.PublishOption {
+	return setPublishOption(delayKey{}, d)
+}
+
 func ExternalAuth() broker.Option {
 	return setBrokerOption(externalAuth{}, ExternalAuthentication{})
 }
@@ -0,0 +1,63 @@
+package rabbitmq
+
+import (
+	"github.com/micro/go-plugins/broker/rabbitmq/v2/internal/pool"
+	"github.com/streadway/amqp"
+)
+
+// channelPool spreads publishes across several channels so concurrent publishers
+// don't serialise on a single one. Members closed by the server, e.g. after a
+// channel level error, are replaced when they are next checked out
+type channelPool struct {
+	*pool.Pool
+}
+
+type pooledChannel struct {
+	*rabbitMQChannel
+	closed chan *amqp.Error
+}
+
+func newChannelPool(conn *amqp.Connection, size int, confirm bool) (*channelPool, error) {
+	p, err := pool.New(size, func() (pool.Member, error) {
+		ch, err := newRabbitChannel(conn, 0, false)
+		if err != nil {
+			return nil, err
+		}
+		if confirm {
+			if err := ch.EnableConfirms(); err != nil {
+				ch.Close()
+				return nil, err
+			}
+		}
+		return &pooledChannel{
+			rabbitMQChannel: ch,
+			closed:          ch.channel.NotifyClose(make(chan *amqp.Error, 1)),
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &channelPool{p}, nil
+}
+
+// Healthy reports whether the channel is still open
+func (c *pooledChannel) Healthy() bool {
+	select {
+	case <-c.closed:
+		return false
+	default:
+		return true
+	}
+}
+
+func (p *channelPool) Publish(exchange, key string, msg amqp.Publishing) error {
+	return p.Do(func(m pool.Member) error {
+		return m.(*pooledChannel).Publish(exchange, key, msg)
+	})
+}
+
+func (p *channelPool) PublishConfirm(exchange, key string, msg amqp.Publishing, fn func(ack bool)) error {
+	return p.Do(func(m pool.Member) error {
+		return m.(*pooledChannel).PublishConfirm(exchange, key, msg, fn)
+	})
+}
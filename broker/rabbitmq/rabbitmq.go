@@ -4,11 +4,17 @@ package rabbitmq
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/micro/go-micro/v2/broker"
 	"github.com/micro/go-micro/v2/config/cmd"
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-plugins/broker/rabbitmq/v2/internal/expiration"
 	"github.com/streadway/amqp"
 )
 
@@ -33,6 +39,8 @@ type subscriber struct {
 	r            *rbroker
 	fn           func(msg amqp.Delivery)
 	headers      map[string]interface{}
+	// cancel stops retries in progress on unsubscribe
+	cancel context.CancelFunc
 }
 
 type publication struct {
@@ -74,6 +82,7 @@ func (s *subscriber) Unsubscribe() error {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 	s.mayRun = false
+	s.cancel()
 	if s.ch != nil {
 		return s.ch.Close()
 	}
@@ -145,8 +154,9 @@ func (s *subscriber) resubscribe() {
 
 func (r *rbroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
 	m := amqp.Publishing{
-		Body:    msg.Body,
-		Headers: amqp.Table{},
+		Body:      msg.Body,
+		Headers:   amqp.Table{},
+		Timestamp: time.Now(),
 	}
 
 	options := broker.PublishOptions{}
@@ -162,6 +172,11 @@ func (r *rbroker) Publish(topic string, msg *broker.Message, opts ...broker.Publ
 		if value, ok := options.Context.Value(priorityKey{}).(uint8); ok {
 			m.Priority = value
 		}
+
+		// a time to live below a millisecond isn't truncated to expire right away
+		if value, ok := expiration.FromOptions(options); ok {
+			m.Expiration = strconv.FormatInt(expiration.Milliseconds(value), 10)
+		}
 	}
 
 	for k, v := range msg.Header {
@@ -172,7 +187,52 @@ func (r *rbroker) Publish(topic string, msg *broker.Message, opts ...broker.Publ
 		return errors.New("connection is nil")
 	}
 
-	return r.conn.Publish(r.conn.exchange.Name, topic, m)
+	exchange := r.conn.exchange.Name
+	if options.Context != nil {
+		if d, ok := options.Context.Value(delayKey{}).(time.Duration); ok && d > 0 {
+			ex, err := r.conn.delayExchange(d, &m)
+			if err != nil {
+				return err
+			}
+			exchange = ex
+		}
+	}
+
+	fn, callback := r.opts.Context.Value(confirmCallbackKey{}).(ConfirmFunc)
+	confirm, _ := r.opts.Context.Value(publisherConfirmsKey{}).(bool)
+
+	// confirmed publishes block unless only a callback was set
+	wait := confirm
+	if options.Context != nil {
+		if w, ok := options.Context.Value(waitForConfirmKey{}).(bool); ok {
+			if w && !confirm && !callback {
+				return errors.New("waiting for confirms requires publisher confirms")
+			}
+			wait = w
+		}
+	}
+
+	if !confirm && !callback {
+		return r.conn.Publish(exchange, topic, m)
+	}
+
+	acked := make(chan bool, 1)
+	if err := r.conn.PublishConfirm(exchange, topic, m, func(ack bool) {
+		if callback {
+			fn(topic, msg, ack)
+		}
+		acked <- ack
+	}); err != nil {
+		return err
+	}
+
+	if !wait {
+		return nil
+	}
+	if !<-acked {
+		return errors.New("message was nacked by the server")
+	}
+	return nil
 }
 
 func (r *rbroker) Subscribe(topic string, handler broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
@@ -206,9 +266,58 @@ func (r *rbroker) Subscribe(topic string, handler broker.Handler, opts ...broker
 	var durableQueue bool
 	durableQueue, _ = ctx.Value(durableQueueKey{}).(bool)
 
-	var qArgs map[string]interface{}
+	// copy the arguments so the typed options don't modify the caller's map
+	qArgs := make(map[string]interface{})
 	if qa, ok := ctx.Value(queueArgumentsKey{}).(map[string]interface{}); ok {
-		qArgs = qa
+		for k, v := range qa {
+			qArgs[k] = v
+		}
+	}
+
+	quorum, _ := ctx.Value(quorumQueueKey{}).(bool)
+	lazy, _ := ctx.Value(lazyQueueKey{}).(bool)
+	_, priority := ctx.Value(maxPriorityKey{}).(uint8)
+
+	// fail before declaring a queue the server would reject
+	if quorum && lazy {
+		return nil, errors.New("lazy mode is not supported by quorum queues")
+	}
+	if quorum && priority {
+		return nil, errors.New("max priority is not supported by quorum queues")
+	}
+
+	if quorum {
+		// quorum queues are always durable
+		qArgs["x-queue-type"] = "quorum"
+		durableQueue = true
+	}
+
+	if lazy {
+		qArgs["x-queue-mode"] = "lazy"
+	}
+
+	if ttl, ok := ctx.Value(messageTTLKey{}).(time.Duration); ok {
+		qArgs["x-message-ttl"] = int64(ttl / time.Millisecond)
+	}
+
+	if n, ok := ctx.Value(maxLengthKey{}).(int); ok {
+		qArgs["x-max-length"] = int64(n)
+	}
+
+	if n, ok := ctx.Value(maxPriorityKey{}).(uint8); ok {
+		qArgs["x-max-priority"] = n
+	}
+
+	var deadLetter bool
+	if dlx, ok := ctx.Value(deadLetterExchangeKey{}).(string); ok {
+		qArgs["x-dead-letter-exchange"] = dlx
+		deadLetter = true
+	}
+
+	retries, _ := ctx.Value(maxRetriesKey{}).(int)
+	backoff, ok := ctx.Value(retryBackoffKey{}).(time.Duration)
+	if !ok {
+		backoff = DefaultRetryBackoff
 	}
 
 	var headers map[string]interface{}
@@ -221,6 +330,13 @@ func (r *rbroker) Subscribe(topic string, handler broker.Handler, opts ...broker
 		ackSuccess = true
 	}
 
+	if deadLetter && opt.AutoAck {
+		opt.AutoAck = false
+		ackSuccess = true
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
 	fn := func(msg amqp.Delivery) {
 		header := make(map[string]string)
 		for k, v := range msg.Headers {
@@ -232,15 +348,29 @@ func (r *rbroker) Subscribe(topic string, handler broker.Handler, opts ...broker
 		}
 		p := &publication{d: msg, m: m, t: msg.RoutingKey}
 		p.err = handler(p)
+		for i, delay := 0, backoff; p.err != nil && i < retries; i++ {
+			select {
+			case <-ctx.Done():
+				// unsubscribed during a retry, hand the message back instead of dead lettering it
+				if !opt.AutoAck {
+					msg.Nack(false, true)
+				}
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+			p.err = handler(p)
+		}
 		if p.err == nil && ackSuccess && !opt.AutoAck {
 			msg.Ack(false)
 		} else if p.err != nil && !opt.AutoAck {
-			msg.Nack(false, requeueOnError)
+			// requeueing would keep the message away from the dead letter exchange
+			msg.Nack(false, requeueOnError && !deadLetter)
 		}
 	}
 
 	sret := &subscriber{topic: topic, opts: opt, mayRun: true, r: r,
-		durableQueue: durableQueue, fn: fn, headers: headers, queueArgs: qArgs}
+		durableQueue: durableQueue, fn: fn, headers: headers, queueArgs: qArgs, cancel: cancel}
 
 	go sret.resubscribe()
 
@@ -267,12 +397,54 @@ func (r *rbroker) Init(opts ...broker.Option) error {
 		o(&r.opts)
 	}
 	r.addrs = r.opts.Addrs
+	return r.Validate()
+}
+
+// Validate checks the options for mistakes which would otherwise surface as
+// obscure errors on connect, such as addresses which are not amqp urls and
+// are silently replaced by the default url
+func (r *rbroker) Validate() error {
+	for _, addr := range r.opts.Addrs {
+		if !strings.HasPrefix(addr, "amqp://") && !strings.HasPrefix(addr, "amqps://") {
+			return fmt.Errorf("invalid address %q: expected an amqp:// or amqps:// url", addr)
+		}
+		if _, err := amqp.ParseURI(addr); err != nil {
+			return fmt.Errorf("invalid address %q: %v", addr, err)
+		}
+	}
+
+	if n, ok := r.opts.Context.Value(prefetchCountKey{}).(int); ok && n < 0 {
+		return fmt.Errorf("invalid prefetch count %d", n)
+	}
+
+	if n, ok := r.opts.Context.Value(publisherPoolKey{}).(int); ok && n < 0 {
+		return fmt.Errorf("invalid publisher pool size %d", n)
+	}
+
+	if _, ok := r.opts.Context.Value(externalAuth{}).(ExternalAuthentication); ok {
+		tc := r.opts.TLSConfig
+		if tc == nil || (len(tc.Certificates) == 0 && tc.GetClientCertificate == nil) {
+			return errors.New("external auth requires a tls config with a client certificate")
+		}
+		for _, addr := range r.opts.Addrs {
+			if u, err := url.Parse(addr); err == nil && u.User != nil {
+				return fmt.Errorf("external auth conflicts with the credentials in address %q", addr)
+			}
+		}
+	}
+
 	return nil
 }
 
 func (r *rbroker) Connect() error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
 	if r.conn == nil {
 		r.conn = newRabbitMQConn(r.getExchange(), r.opts.Addrs, r.getPrefetchCount(), r.getPrefetchGlobal())
+		r.conn.confirm = r.getConfirm()
+		r.conn.poolSize, _ = r.opts.Context.Value(publisherPoolKey{}).(int)
 	}
 
 	conf := defaultAmqpConfig
@@ -304,10 +476,15 @@ func NewBroker(opts ...broker.Option) broker.Broker {
 		o(&options)
 	}
 
-	return &rbroker{
+	r := &rbroker{
 		addrs: options.Addrs,
 		opts:  options,
 	}
+	// the broker can't be returned with an error, Init and Connect return it
+	if err := r.Validate(); err != nil {
+		log.Errorf("[rabbitmq] invalid options: %v", err)
+	}
+	return r
 }
 
 func (r *rbroker) getExchange() Exchange {
@@ -338,3 +515,11 @@ func (r *rbroker) getPrefetchGlobal() bool {
 	}
 	return DefaultPrefetchGlobal
 }
+
+func (r *rbroker) getConfirm() bool {
+	if _, ok := r.opts.Context.Value(confirmCallbackKey{}).(ConfirmFunc); ok {
+		return true
+	}
+	confirm, _ := r.opts.Context.Value(publisherConfirmsKey{}).(bool)
+	return confirm
+}
@@ -13,6 +13,11 @@ var (
 	DefaultConnectTimeout = 5 * time.Second
 	DefaultReadTimeout    = 5 * time.Second
 	DefaultWriteTimeout   = 5 * time.Second
+	DefaultClaimIdle      = time.Minute
+	// DefaultMaxDeliveries is how often an entry is delivered before it's dead-lettered
+	DefaultMaxDeliveries int64 = 10
+	// DefaultDeadLetterSuffix names the stream entries are dead-lettered to after the topic
+	DefaultDeadLetterSuffix = ".dead-letter"
 
 	optionsKey = optionsKeyType{}
 )
@@ -25,6 +30,13 @@ type brokerOptions struct {
 	connectTimeout time.Duration
 	readTimeout    time.Duration
 	writeTimeout   time.Duration
+
+	// streams mode
+	streams      bool
+	streamMaxLen int64
+	claimIdle    time.Duration
+	// entries delivered this often are dead-lettered, 0 is unlimited
+	maxDeliveries int64
 }
 
 type optionsKeyType struct{}
@@ -70,3 +82,40 @@ func IdleTimeout(d time.Duration) broker.Option {
 		bo.idleTimeout = d
 	}
 }
+
+// Streams publishes to and consumes from Redis Streams instead of pub/sub. Subscribers
+// read through consumer groups so messages published while they were down are
+// delivered once they restart, subscribers sharing a queue share a group
+func Streams() broker.Option {
+	return func(o *broker.Options) {
+		bo := o.Context.Value(optionsKey).(*brokerOptions)
+		bo.streams = true
+	}
+}
+
+// StreamMaxLen trims streams to approximately n entries on publish
+func StreamMaxLen(n int64) broker.Option {
+	return func(o *broker.Options) {
+		bo := o.Context.Value(optionsKey).(*brokerOptions)
+		bo.streamMaxLen = n
+	}
+}
+
+// ClaimIdle is how long an entry must be pending, unacknowledged by a consumer
+// which crashed or failed to handle it, before another consumer claims it
+func ClaimIdle(d time.Duration) broker.Option {
+	return func(o *broker.Options) {
+		bo := o.Context.Value(optionsKey).(*brokerOptions)
+		bo.claimIdle = d
+	}
+}
+
+// MaxDeliveries is how often an entry is delivered before it's moved to the dead
+// letter stream, the topic with DefaultDeadLetterSuffix, instead of being claimed
+// again. 0 claims entries forever
+func MaxDeliveries(n int64) broker.Option {
+	return func(o *broker.Options) {
+		bo := o.Context.Value(optionsKey).(*brokerOptions)
+		bo.maxDeliveries = n
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/micro/go-micro/v2/broker"
 )
@@ -106,3 +107,112 @@ func TestBroker(t *testing.T) {
 		t.Fatalf("expected %v, got %v", exp, actual)
 	}
 }
+
+func TestStreamsBroker(t *testing.T) {
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		t.Skip("REDIS_URL not defined")
+	}
+
+	b := NewBroker(broker.Addrs(url), Streams(), StreamMaxLen(100))
+
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Disconnect()
+
+	msgs := make(chan string, 10)
+	handler := func(p broker.Event) error {
+		msgs <- string(p.Message().Body)
+		return nil
+	}
+
+	// the consumer group of a queue outlives its subscribers
+	s, err := b.Subscribe("test.streams", handler, broker.Queue("streams"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsubscribe(t, s)
+
+	publish(t, b, "test.streams", &broker.Message{
+		Body: []byte("missed"),
+	})
+
+	s, err = b.Subscribe("test.streams", handler, broker.Queue("streams"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe(t, s)
+
+	select {
+	case msg := <-msgs:
+		if msg != "missed" {
+			t.Fatalf("expected missed, got %s", msg)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected message published while unsubscribed")
+	}
+}
+
+func TestNextID(t *testing.T) {
+	testData := map[string]string{
+		"1526985054069-0":  "1526985054069-1",
+		"1526985054069-41": "1526985054069-42",
+		"invalid":          "invalid",
+	}
+	for id, expect := range testData {
+		if next := nextID(id); next != expect {
+			t.Fatalf("expected %s, got %s", expect, next)
+		}
+	}
+}
+
+func TestStreamsDeadLetter(t *testing.T) {
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		t.Skip("REDIS_URL not defined")
+	}
+
+	b := NewBroker(broker.Addrs(url), Streams(), ClaimIdle(100*time.Millisecond), MaxDeliveries(2))
+
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Disconnect()
+
+	attempts := make(chan bool, 10)
+	s, err := b.Subscribe("test.streams.failing", func(p broker.Event) error {
+		attempts <- true
+		return fmt.Errorf("failed")
+	}, broker.Queue("failing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe(t, s)
+
+	dead := make(chan string, 1)
+	ds, err := b.Subscribe("test.streams.failing"+DefaultDeadLetterSuffix, func(p broker.Event) error {
+		dead <- string(p.Message().Body)
+		return nil
+	}, broker.Queue("dead"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe(t, ds)
+
+	publish(t, b, "test.streams.failing", &broker.Message{
+		Body: []byte("poison"),
+	})
+
+	select {
+	case msg := <-dead:
+		if msg != "poison" {
+			t.Fatalf("expected poison, got %s", msg)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the message to be dead-lettered")
+	}
+	if len(attempts) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(attempts))
+	}
+}
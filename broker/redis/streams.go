@@ -0,0 +1,354 @@
+package redis
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/micro/go-micro/v2/broker"
+	"github.com/micro/go-micro/v2/codec"
+)
+
+/*
+	In streams mode messages are appended to a stream per topic with XADD and read
+	with XREADGROUP. Every subscriber is a consumer in a group, named after the queue
+	or, without a queue, unique to the subscriber. Entries stay pending until they
+	are acknowledged, entries pending for longer than the claim idle time, because
+	their consumer crashed or the handler failed, are claimed by another consumer.
+	Entries delivered max deliveries times are moved to the dead letter stream of
+	the topic instead, so a message failing every handler doesn't circle forever.
+
+	Consumers of queues are only deleted on unsubscribe when they have no pending
+	entries, deleting a consumer drops its pending entries which would then never
+	be claimed.
+*/
+
+const (
+	// streamField is the entry field holding the encoded message
+	streamField = "message"
+	// streamCount is the number of entries read or claimed at once
+	streamCount = 10
+)
+
+// streamSubscriber reads a stream through a consumer group
+type streamSubscriber struct {
+	codec    codec.Marshaler
+	pool     *redis.Pool
+	topic    string
+	group    string
+	consumer string
+	handle   broker.Handler
+	opts     broker.SubscribeOptions
+
+	block         time.Duration
+	claimIdle     time.Duration
+	maxDeliveries int64
+
+	// unique groups are destroyed on unsubscribe
+	unique bool
+
+	once sync.Once
+	exit chan bool
+	done chan bool
+}
+
+func randomID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// recv reads new entries and periodically claims stale pending ones
+func (s *streamSubscriber) recv() {
+	defer close(s.done)
+
+	lastClaim := time.Now()
+
+	for {
+		select {
+		case <-s.exit:
+			return
+		default:
+		}
+
+		if time.Since(lastClaim) >= s.claimIdle {
+			s.claim()
+			lastClaim = time.Now()
+		}
+
+		conn := s.pool.Get()
+		reply, err := redis.Values(conn.Do("XREADGROUP",
+			"GROUP", s.group, s.consumer,
+			"COUNT", streamCount,
+			"BLOCK", int64(s.block/time.Millisecond),
+			"STREAMS", s.topic, ">",
+		))
+		conn.Close()
+
+		if err == redis.ErrNil {
+			continue
+		} else if err != nil {
+			// the group is gone, e.g the stream was deleted
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				s.createGroup()
+			}
+			select {
+			case <-s.exit:
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		for _, stream := range reply {
+			// each stream is a pair of its name and entries
+			parts, err := redis.Values(stream, nil)
+			if err != nil || len(parts) != 2 {
+				continue
+			}
+			entries, _ := redis.Values(parts[1], nil)
+			s.handleEntries(entries)
+		}
+	}
+}
+
+// nextID returns the stream id following the id, XPENDING has no exclusive ranges
+// before Redis 6.2
+func nextID(id string) string {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return id
+	}
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return id
+	}
+	return parts[0] + "-" + strconv.FormatUint(seq+1, 10)
+}
+
+// claim takes over entries pending for longer than the claim idle time, paging
+// through the pending entries of the group
+func (s *streamSubscriber) claim() {
+	start := "-"
+	for {
+		select {
+		case <-s.exit:
+			return
+		default:
+		}
+
+		last, n := s.claimPage(start)
+		if n < streamCount || nextID(last) == start {
+			return
+		}
+		start = nextID(last)
+	}
+}
+
+// claimPage claims a page of pending entries from the start id, returning the id
+// of the last entry and the number of entries in the page
+func (s *streamSubscriber) claimPage(start string) (string, int) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	pending, err := redis.Values(conn.Do("XPENDING", s.topic, s.group, start, "+", streamCount))
+	if err != nil || len(pending) == 0 {
+		return "", 0
+	}
+
+	var last string
+	var claim, dead []string
+	for _, p := range pending {
+		// id, consumer, idle time and delivery count
+		fields, err := redis.Values(p, nil)
+		if err != nil || len(fields) < 4 {
+			continue
+		}
+		id, _ := redis.String(fields[0], nil)
+		last = id
+
+		idle, _ := redis.Int64(fields[2], nil)
+		if time.Duration(idle)*time.Millisecond < s.claimIdle {
+			continue
+		}
+		if count, _ := redis.Int64(fields[3], nil); s.maxDeliveries > 0 && count >= s.maxDeliveries {
+			dead = append(dead, id)
+			continue
+		}
+		claim = append(claim, id)
+	}
+
+	if len(dead) > 0 {
+		if entries, err := s.xclaim(conn, dead); err == nil {
+			s.deadLetter(conn, entries)
+		}
+	}
+	if len(claim) > 0 {
+		if entries, err := s.xclaim(conn, claim); err == nil {
+			s.handleEntries(entries)
+		}
+	}
+	return last, len(pending)
+}
+
+func (s *streamSubscriber) xclaim(conn redis.Conn, ids []string) ([]interface{}, error) {
+	args := redis.Args{s.topic, s.group, s.consumer, int64(s.claimIdle / time.Millisecond)}
+	for _, id := range ids {
+		args = args.Add(id)
+	}
+	return redis.Values(conn.Do("XCLAIM", args...))
+}
+
+// deadLetter moves the entries to the dead letter stream of the topic
+func (s *streamSubscriber) deadLetter(conn redis.Conn, entries []interface{}) {
+	for _, e := range entries {
+		entry, err := redis.Values(e, nil)
+		if err != nil || len(entry) != 2 {
+			continue
+		}
+		id, _ := redis.String(entry[0], nil)
+		fields, _ := redis.Values(entry[1], nil)
+
+		args := redis.Args{s.topic + DefaultDeadLetterSuffix, "*"}
+		if _, err := conn.Do("XADD", append(args, fields...)...); err != nil {
+			// stays pending, it's moved on the next claim
+			continue
+		}
+		conn.Do("XACK", s.topic, s.group, id)
+	}
+}
+
+func (s *streamSubscriber) handleEntries(entries []interface{}) {
+	for _, e := range entries {
+		// each entry is a pair of its id and fields
+		entry, err := redis.Values(e, nil)
+		if err != nil || len(entry) != 2 {
+			continue
+		}
+		id, _ := redis.String(entry[0], nil)
+		fields, _ := redis.ByteSlices(entry[1], nil)
+
+		var data []byte
+		for i := 0; i+1 < len(fields); i += 2 {
+			if string(fields[i]) == streamField {
+				data = fields[i+1]
+			}
+		}
+
+		ack := func() error {
+			conn := s.pool.Get()
+			defer conn.Close()
+			_, err := conn.Do("XACK", s.topic, s.group, id)
+			return err
+		}
+
+		var m broker.Message
+		if err := s.codec.Unmarshal(data, &m); err != nil {
+			// entries which can't be decoded would be claimed forever
+			ack()
+			continue
+		}
+
+		p := publication{
+			topic:   s.topic,
+			message: &m,
+			ack:     ack,
+		}
+
+		// failed entries stay pending and are claimed again later
+		if p.err = s.handle(&p); p.err != nil {
+			continue
+		}
+
+		if s.opts.AutoAck {
+			p.Ack()
+		}
+	}
+}
+
+// createGroup creates the consumer group, and the stream if it doesn't exist
+func (s *streamSubscriber) createGroup() error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("XGROUP", "CREATE", s.topic, s.group, "$", "MKSTREAM")
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// Options returns the subscriber options.
+func (s *streamSubscriber) Options() broker.SubscribeOptions {
+	return s.opts
+}
+
+// Topic returns the topic of the subscriber.
+func (s *streamSubscriber) Topic() string {
+	return s.topic
+}
+
+// Unsubscribe stops reading the stream. The consumer group of a subscriber
+// without a queue is destroyed, groups of queues are kept. The consumer is left
+// in the group while it has pending entries, so the other consumers claim them
+func (s *streamSubscriber) Unsubscribe() error {
+	s.once.Do(func() {
+		close(s.exit)
+	})
+	<-s.done
+
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	if s.unique {
+		_, err := conn.Do("XGROUP", "DESTROY", s.topic, s.group)
+		return err
+	}
+
+	pending, err := redis.Values(conn.Do("XPENDING", s.topic, s.group, "-", "+", 1, s.consumer))
+	if err != nil || len(pending) > 0 {
+		return err
+	}
+	_, err = conn.Do("XGROUP", "DELCONSUMER", s.topic, s.group, s.consumer)
+	return err
+}
+
+func (b *redisBroker) subscribeStream(topic string, handler broker.Handler, options broker.SubscribeOptions) (broker.Subscriber, error) {
+	// block for less than the read timeout
+	block := b.bopts.readTimeout / 2
+	if block <= 0 {
+		block = DefaultReadTimeout
+	}
+
+	s := &streamSubscriber{
+		codec:         b.opts.Codec,
+		pool:          b.pool,
+		topic:         topic,
+		group:         options.Queue,
+		consumer:      randomID(),
+		handle:        handler,
+		opts:          options,
+		block:         block,
+		claimIdle:     b.bopts.claimIdle,
+		maxDeliveries: b.bopts.maxDeliveries,
+		exit:          make(chan bool),
+		done:          make(chan bool),
+	}
+
+	if len(s.group) == 0 {
+		s.group = "subscriber-" + s.consumer
+		s.unique = true
+	}
+
+	if err := s.createGroup(); err != nil {
+		return nil, err
+	}
+
+	go s.recv()
+
+	return s, nil
+}
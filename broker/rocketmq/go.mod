@@ -0,0 +1,9 @@
+module github.com/micro/go-plugins/broker/rocketmq/v2
+
+go 1.13
+
+require (
+	github.com/apache/rocketmq-client-go/v2 v2.0.0
+	github.com/google/uuid v1.1.1
+	github.com/micro/go-micro/v2 v2.9.1
+)
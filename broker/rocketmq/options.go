@@ -0,0 +1,107 @@
+package rocketmq
+
+import (
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/micro/go-micro/v2/broker"
+)
+
+// TransactionState is the outcome of a local transaction
+type TransactionState int
+
+const (
+	// Unknown leaves the message pending, the checker is asked again later
+	Unknown TransactionState = iota
+	// Commit delivers the message
+	Commit
+	// Rollback discards the message
+	Rollback
+)
+
+// TransactionFunc runs the local transaction of a transactional message, the
+// message is delivered if it returns nil and discarded otherwise
+type TransactionFunc func(*broker.Message) error
+
+// TransactionCheckFunc resolves transactions whose outcome the broker didn't
+// learn e.g because the publisher crashed before reporting it
+type TransactionCheckFunc func(*broker.Message) TransactionState
+
+type credentialsKey struct{}
+type namespaceKey struct{}
+type producerGroupKey struct{}
+type retriesKey struct{}
+type transactionCheckKey struct{}
+type tagKey struct{}
+type keysKey struct{}
+type shardingKeyKey struct{}
+type delayLevelKey struct{}
+type transactionKey struct{}
+type tagsKey struct{}
+type orderedKey struct{}
+
+// Credentials sets the access key and secret key e.g of an aliyun instance
+func Credentials(accessKey, secretKey string) broker.Option {
+	return setBrokerOption(credentialsKey{}, primitive.Credentials{
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	})
+}
+
+// Namespace sets the instance namespace the topics and groups are in
+func Namespace(ns string) broker.Option {
+	return setBrokerOption(namespaceKey{}, ns)
+}
+
+// ProducerGroup sets the group of the producers, DefaultProducerGroup by default
+func ProducerGroup(name string) broker.Option {
+	return setBrokerOption(producerGroupKey{}, name)
+}
+
+// Retries sets how often sending a message is retried
+func Retries(n int) broker.Option {
+	return setBrokerOption(retriesKey{}, n)
+}
+
+// TransactionChecker sets the func resolving transactions whose outcome the
+// broker didn't learn, without one they're left pending
+func TransactionChecker(fn TransactionCheckFunc) broker.Option {
+	return setBrokerOption(transactionCheckKey{}, fn)
+}
+
+// Tag sets the tag of the message subscribers can filter on
+func Tag(tag string) broker.PublishOption {
+	return setPublishOption(tagKey{}, tag)
+}
+
+// Keys sets the keys of the message used to look it up
+func Keys(keys ...string) broker.PublishOption {
+	return setPublishOption(keysKey{}, keys)
+}
+
+// ShardingKey sends messages with the same key to the same queue, ordered
+// subscribers receive them in the order they were published
+func ShardingKey(key string) broker.PublishOption {
+	return setPublishOption(shardingKeyKey{}, key)
+}
+
+// DelayLevel delays the delivery by one of the broker's delay levels, by default
+// 1s 5s 10s 30s 1m 2m 3m 4m 5m 6m 7m 8m 9m 10m 20m 30m 1h 2h for levels 1 to 18
+func DelayLevel(level int) broker.PublishOption {
+	return setPublishOption(delayLevelKey{}, level)
+}
+
+// Transaction publishes a transactional message, the local transaction runs once
+// the message was stored and decides whether it is delivered
+func Transaction(fn TransactionFunc) broker.PublishOption {
+	return setPublishOption(transactionKey{}, fn)
+}
+
+// Tags only receives messages with one of the given tags
+func Tags(tags ...string) broker.SubscribeOption {
+	return setSubscribeOption(tagsKey{}, tags)
+}
+
+// Ordered receives the messages of a queue one at a time in order, use with
+// ShardingKey to order the messages of a key
+func Ordered() broker.SubscribeOption {
+	return setSubscribeOption(orderedKey{}, true)
+}
@@ -0,0 +1,441 @@
+// Package rocketmq provides an Apache RocketMQ broker
+package rocketmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/apache/rocketmq-client-go/v2"
+	"github.com/apache/rocketmq-client-go/v2/consumer"
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/apache/rocketmq-client-go/v2/producer"
+	"github.com/google/uuid"
+	"github.com/micro/go-micro/v2/broker"
+	"github.com/micro/go-micro/v2/codec/json"
+	"github.com/micro/go-micro/v2/config/cmd"
+)
+
+/*
+	Messages are sent with their headers as properties and their body as the body,
+	so they can be exchanged with non micro producers and consumers. Subscribers with
+	a queue join the consumer group named after the queue, other subscribers get a
+	group of their own and so receive every message. Messages whose handler failed
+	are consumed again later, ordered subscribers suspend the queue for a moment
+	instead so the order is kept.
+
+	Transactional messages are sent by a transaction producer whose listener looks
+	up the local transaction of the message by an id property. It's started on
+	connect so the broker can check back transactions left by a previous process
+	before anything is published.
+*/
+
+var (
+	// DefaultProducerGroup is the group of the producers
+	DefaultProducerGroup = "micro"
+
+	// txIDProperty holds the id of the local transaction of a message
+	txIDProperty = "MICRO_TX_ID"
+)
+
+type rmqBroker struct {
+	addrs []string
+	opts  broker.Options
+
+	sync.RWMutex
+	connected bool
+	p         rocketmq.Producer
+	tp        rocketmq.TransactionProducer
+	txs       *transactions
+}
+
+type subscriber struct {
+	topic string
+	opts  broker.SubscribeOptions
+	c     rocketmq.PushConsumer
+}
+
+type publication struct {
+	topic string
+	m     *broker.Message
+	err   error
+}
+
+type transaction struct {
+	fn  TransactionFunc
+	err error
+}
+
+// transactions implements the transaction listener of the transaction producer
+type transactions struct {
+	check TransactionCheckFunc
+
+	sync.Mutex
+	pending map[string]*transaction
+}
+
+func init() {
+	cmd.DefaultBrokers["rocketmq"] = NewBroker
+}
+
+func (p *publication) Topic() string {
+	return p.topic
+}
+
+func (p *publication) Message() *broker.Message {
+	return p.m
+}
+
+// Ack is a noop, messages are acknowledged when the handler returns
+func (p *publication) Ack() error {
+	return nil
+}
+
+func (p *publication) Error() error {
+	return p.err
+}
+
+func (s *subscriber) Options() broker.SubscribeOptions {
+	return s.opts
+}
+
+func (s *subscriber) Topic() string {
+	return s.topic
+}
+
+func (s *subscriber) Unsubscribe() error {
+	return s.c.Shutdown()
+}
+
+func (t *transactions) ExecuteLocalTransaction(m *primitive.Message) primitive.LocalTransactionState {
+	t.Lock()
+	tx, ok := t.pending[m.GetProperty(txIDProperty)]
+	t.Unlock()
+	if !ok {
+		return primitive.UnknowState
+	}
+
+	if tx.err = tx.fn(toBrokerMessage(m)); tx.err != nil {
+		return primitive.RollbackMessageState
+	}
+	return primitive.CommitMessageState
+}
+
+func (t *transactions) CheckLocalTransaction(m *primitive.MessageExt) primitive.LocalTransactionState {
+	t.Lock()
+	check := t.check
+	t.Unlock()
+	if check == nil {
+		return primitive.UnknowState
+	}
+
+	switch check(toBrokerMessage(&m.Message)) {
+	case Commit:
+		return primitive.CommitMessageState
+	case Rollback:
+		return primitive.RollbackMessageState
+	default:
+		return primitive.UnknowState
+	}
+}
+
+func toBrokerMessage(m *primitive.Message) *broker.Message {
+	header := make(map[string]string)
+	for k, v := range m.GetProperties() {
+		if k == txIDProperty {
+			continue
+		}
+		header[k] = v
+	}
+	return &broker.Message{
+		Header: header,
+		Body:   m.Body,
+	}
+}
+
+// setAddrs drops empty addresses and defaults to the local name server
+func setAddrs(addrs []string) []string {
+	var cAddrs []string
+	for _, addr := range addrs {
+		if len(addr) == 0 {
+			continue
+		}
+		cAddrs = append(cAddrs, addr)
+	}
+	if len(cAddrs) == 0 {
+		cAddrs = []string{"127.0.0.1:9876"}
+	}
+	return cAddrs
+}
+
+func (r *rmqBroker) producerOptions() []producer.Option {
+	group := DefaultProducerGroup
+	if g, ok := r.opts.Context.Value(producerGroupKey{}).(string); ok {
+		group = g
+	}
+
+	opts := []producer.Option{
+		producer.WithNameServer(r.addrs),
+		producer.WithGroupName(group),
+		// messages with a sharding key go to the same queue
+		producer.WithQueueSelector(producer.NewHashQueueSelector()),
+	}
+	if c, ok := r.opts.Context.Value(credentialsKey{}).(primitive.Credentials); ok {
+		opts = append(opts, producer.WithCredentials(c))
+	}
+	if ns, ok := r.opts.Context.Value(namespaceKey{}).(string); ok {
+		opts = append(opts, producer.WithNamespace(ns))
+	}
+	if n, ok := r.opts.Context.Value(retriesKey{}).(int); ok {
+		opts = append(opts, producer.WithRetry(n))
+	}
+	return opts
+}
+
+func (r *rmqBroker) Address() string {
+	return strings.Join(r.addrs, ",")
+}
+
+func (r *rmqBroker) Connect() error {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.connected {
+		return nil
+	}
+
+	p, err := rocketmq.NewProducer(r.producerOptions()...)
+	if err != nil {
+		return err
+	}
+	if err := p.Start(); err != nil {
+		return err
+	}
+
+	tp, err := rocketmq.NewTransactionProducer(r.txs, r.producerOptions()...)
+	if err != nil {
+		p.Shutdown()
+		return err
+	}
+	if err := tp.Start(); err != nil {
+		p.Shutdown()
+		return err
+	}
+
+	r.p = p
+	r.tp = tp
+	r.connected = true
+	return nil
+}
+
+func (r *rmqBroker) Disconnect() error {
+	r.Lock()
+	defer r.Unlock()
+
+	if !r.connected {
+		return nil
+	}
+
+	err := r.p.Shutdown()
+	if terr := r.tp.Shutdown(); terr != nil {
+		err = terr
+	}
+	r.p = nil
+	r.tp = nil
+	r.connected = false
+	return err
+}
+
+func (r *rmqBroker) Init(opts ...broker.Option) error {
+	for _, o := range opts {
+		o(&r.opts)
+	}
+	r.addrs = setAddrs(r.opts.Addrs)
+	if check, ok := r.opts.Context.Value(transactionCheckKey{}).(TransactionCheckFunc); ok {
+		r.txs.Lock()
+		r.txs.check = check
+		r.txs.Unlock()
+	}
+	return nil
+}
+
+func (r *rmqBroker) Options() broker.Options {
+	return r.opts
+}
+
+func (r *rmqBroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	options := broker.PublishOptions{
+		Context: context.Background(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	m := primitive.NewMessage(topic, msg.Body)
+	for k, v := range msg.Header {
+		m.WithProperty(k, v)
+	}
+	if tag, ok := options.Context.Value(tagKey{}).(string); ok {
+		m.WithTag(tag)
+	}
+	if keys, ok := options.Context.Value(keysKey{}).([]string); ok {
+		m.WithKeys(keys)
+	}
+	if key, ok := options.Context.Value(shardingKeyKey{}).(string); ok {
+		m.WithShardingKey(key)
+	}
+	if level, ok := options.Context.Value(delayLevelKey{}).(int); ok {
+		m.WithDelayTimeLevel(level)
+	}
+
+	if fn, ok := options.Context.Value(transactionKey{}).(TransactionFunc); ok {
+		return r.publishTransaction(options.Context, m, fn)
+	}
+
+	r.RLock()
+	p := r.p
+	r.RUnlock()
+	if p == nil {
+		return errors.New("not connected")
+	}
+
+	_, err := p.SendSync(options.Context, m)
+	return err
+}
+
+func (r *rmqBroker) publishTransaction(ctx context.Context, m *primitive.Message, fn TransactionFunc) error {
+	r.RLock()
+	tp := r.tp
+	r.RUnlock()
+	if tp == nil {
+		return errors.New("not connected")
+	}
+
+	id := uuid.New().String()
+	m.WithProperty(txIDProperty, id)
+
+	tx := &transaction{fn: fn}
+	r.txs.Lock()
+	r.txs.pending[id] = tx
+	r.txs.Unlock()
+
+	defer func() {
+		r.txs.Lock()
+		delete(r.txs.pending, id)
+		r.txs.Unlock()
+	}()
+
+	rsp, err := tp.SendMessageInTransaction(ctx, m)
+	if err != nil {
+		return err
+	}
+	if tx.err != nil {
+		return tx.err
+	}
+	if rsp.State != primitive.CommitMessageState {
+		return fmt.Errorf("transaction ended in state %v", rsp.State)
+	}
+	return nil
+}
+
+func (r *rmqBroker) Subscribe(topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	options := broker.SubscribeOptions{
+		AutoAck: true,
+		Context: context.Background(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	group := options.Queue
+	if len(group) == 0 {
+		group = "micro-" + uuid.New().String()
+	}
+	ordered, _ := options.Context.Value(orderedKey{}).(bool)
+
+	copts := []consumer.Option{
+		consumer.WithNameServer(r.addrs),
+		consumer.WithGroupName(group),
+		consumer.WithConsumerModel(consumer.Clustering),
+		consumer.WithConsumerOrder(ordered),
+	}
+	if c, ok := r.opts.Context.Value(credentialsKey{}).(primitive.Credentials); ok {
+		copts = append(copts, consumer.WithCredentials(c))
+	}
+	if ns, ok := r.opts.Context.Value(namespaceKey{}).(string); ok {
+		copts = append(copts, consumer.WithNamespace(ns))
+	}
+
+	c, err := rocketmq.NewPushConsumer(copts...)
+	if err != nil {
+		return nil, err
+	}
+
+	selector := consumer.MessageSelector{}
+	if tags, ok := options.Context.Value(tagsKey{}).([]string); ok && len(tags) > 0 {
+		selector = consumer.MessageSelector{
+			Type:       consumer.TAG,
+			Expression: strings.Join(tags, " || "),
+		}
+	}
+
+	retry := consumer.ConsumeRetryLater
+	if ordered {
+		retry = consumer.SuspendCurrentQueueAMoment
+	}
+
+	err = c.Subscribe(topic, selector, func(ctx context.Context, msgs ...*primitive.MessageExt) (consumer.ConsumeResult, error) {
+		for _, msg := range msgs {
+			p := &publication{
+				topic: topic,
+				m:     toBrokerMessage(&msg.Message),
+			}
+			if p.err = h(p); p.err != nil {
+				return retry, p.err
+			}
+		}
+		return consumer.ConsumeSuccess, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("subscribe to %s: %v", topic, err)
+	}
+
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+
+	return &subscriber{
+		topic: topic,
+		opts:  options,
+		c:     c,
+	}, nil
+}
+
+func (r *rmqBroker) String() string {
+	return "rocketmq"
+}
+
+func NewBroker(opts ...broker.Option) broker.Broker {
+	options := broker.Options{
+		// Default codec
+		Codec:   json.Marshaler{},
+		Context: context.Background(),
+	}
+
+	for _, o := range opts {
+		o(&options)
+	}
+
+	check, _ := options.Context.Value(transactionCheckKey{}).(TransactionCheckFunc)
+
+	return &rmqBroker{
+		addrs: setAddrs(options.Addrs),
+		opts:  options,
+		txs: &transactions{
+			check:   check,
+			pending: make(map[string]*transaction),
+		},
+	}
+}
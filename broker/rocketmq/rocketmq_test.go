@@ -0,0 +1,69 @@
+package rocketmq
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/apache/rocketmq-client-go/v2/primitive"
+	"github.com/micro/go-micro/v2/broker"
+)
+
+func TestSetAddrs(t *testing.T) {
+	testData := []struct {
+		addrs  []string
+		expect []string
+	}{
+		{nil, []string{"127.0.0.1:9876"}},
+		{[]string{"10.0.0.1:9876", ""}, []string{"10.0.0.1:9876"}},
+	}
+
+	for _, d := range testData {
+		if addrs := setAddrs(d.addrs); !reflect.DeepEqual(addrs, d.expect) {
+			t.Fatalf("expected %v, got %v", d.expect, addrs)
+		}
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	txs := &transactions{
+		check: func(m *broker.Message) TransactionState {
+			if m.Header["order"] == "1" {
+				return Commit
+			}
+			return Rollback
+		},
+		pending: map[string]*transaction{
+			"ok": {fn: func(*broker.Message) error { return nil }},
+			"failed": {fn: func(*broker.Message) error {
+				return errors.New("failed")
+			}},
+		},
+	}
+
+	testData := []struct {
+		id     string
+		expect primitive.LocalTransactionState
+	}{
+		{"ok", primitive.CommitMessageState},
+		{"failed", primitive.RollbackMessageState},
+		{"unknown", primitive.UnknowState},
+	}
+
+	for _, d := range testData {
+		m := primitive.NewMessage("orders", nil)
+		m.WithProperty(txIDProperty, d.id)
+		if state := txs.ExecuteLocalTransaction(m); state != d.expect {
+			t.Fatalf("expected %v for %s, got %v", d.expect, d.id, state)
+		}
+	}
+	if txs.pending["failed"].err == nil {
+		t.Fatal("expected the error of the local transaction to be kept")
+	}
+
+	m := &primitive.MessageExt{}
+	m.WithProperties(map[string]string{"order": "1"})
+	if state := txs.CheckLocalTransaction(m); state != primitive.CommitMessageState {
+		t.Fatalf("expected commit, got %v", state)
+	}
+}
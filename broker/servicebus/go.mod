@@ -0,0 +1,9 @@
+module github.com/micro/go-plugins/broker/servicebus/v2
+
+go 1.13
+
+require (
+	github.com/Azure/azure-service-bus-go v0.10.3
+	github.com/google/uuid v1.1.1
+	github.com/micro/go-micro/v2 v2.9.1
+)
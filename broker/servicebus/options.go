@@ -0,0 +1,68 @@
+package servicebus
+
+import (
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+)
+
+type connectionStringKey struct{}
+type queuesKey struct{}
+type autoCreateKey struct{}
+type maxDeliveryCountKey struct{}
+type sessionIDKey struct{}
+type scheduleAtKey struct{}
+type sessionsKey struct{}
+type deadLetterOnErrorKey struct{}
+type prefetchCountKey struct{}
+
+// ConnectionString sets the connection string of the namespace
+func ConnectionString(s string) broker.Option {
+	return setBrokerOption(connectionStringKey{}, s)
+}
+
+// Queues treats topics as queues, publishing sends to the queue and subscribers
+// compete for its messages. By default topics are topics and subscribers receive
+// from subscriptions
+func Queues() broker.Option {
+	return setBrokerOption(queuesKey{}, true)
+}
+
+// AutoCreate creates queues, topics and subscriptions which don't exist
+func AutoCreate() broker.Option {
+	return setBrokerOption(autoCreateKey{}, true)
+}
+
+// MaxDeliveryCount sets after how many deliveries messages are dead-lettered
+// on entities created by AutoCreate
+func MaxDeliveryCount(n int32) broker.Option {
+	return setBrokerOption(maxDeliveryCountKey{}, n)
+}
+
+// SessionID sets the session of the message, messages of a session are received
+// in order by a single subscriber with sessions enabled
+func SessionID(id string) broker.PublishOption {
+	return setPublishOption(sessionIDKey{}, id)
+}
+
+// ScheduleAt enqueues the message at the given time instead of right away
+func ScheduleAt(t time.Time) broker.PublishOption {
+	return setPublishOption(scheduleAtKey{}, t)
+}
+
+// Sessions receives from session enabled entities, the subscriber locks one session
+// at a time and moves on to the next once the session is idle
+func Sessions() broker.SubscribeOption {
+	return setSubscribeOption(sessionsKey{}, true)
+}
+
+// DeadLetterOnError dead-letters messages whose handler failed instead of
+// abandoning them for redelivery
+func DeadLetterOnError() broker.SubscribeOption {
+	return setSubscribeOption(deadLetterOnErrorKey{}, true)
+}
+
+// PrefetchCount sets how many messages are fetched ahead of the handler
+func PrefetchCount(n uint32) broker.SubscribeOption {
+	return setSubscribeOption(prefetchCountKey{}, n)
+}
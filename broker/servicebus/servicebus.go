@@ -0,0 +1,581 @@
+// Package servicebus provides an Azure Service Bus broker
+package servicebus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/google/uuid"
+	"github.com/micro/go-micro/v2/broker"
+	"github.com/micro/go-micro/v2/codec/json"
+	"github.com/micro/go-micro/v2/config/cmd"
+	log "github.com/micro/go-micro/v2/logger"
+)
+
+/*
+	By default topics are service bus topics. Subscribers with a queue share a
+	durable subscription named after the queue, other subscribers get a subscription
+	of their own which is deleted on unsubscribe. With the Queues option topics are
+	service bus queues instead and all subscribers compete for their messages.
+
+	Messages are completed once the handler succeeded. Messages whose handler failed
+	are abandoned and redelivered until the max delivery count of the entity is
+	reached, at which point service bus moves them to the dead-letter queue.
+*/
+
+var (
+	// DefaultSessionIdle is how long a session subscriber waits for messages
+	// before releasing the session and moving on to the next one
+	DefaultSessionIdle = time.Minute
+)
+
+// DeadLetterer is implemented by events of the broker, handlers use it to move
+// messages which can never be processed straight to the dead-letter queue
+type DeadLetterer interface {
+	DeadLetter(reason error) error
+}
+
+type sender interface {
+	Send(ctx context.Context, msg *servicebus.Message) error
+	Close(ctx context.Context) error
+}
+
+// topicSender is the sender of a topic, topics take send options queues don't
+type topicSender struct {
+	*servicebus.Topic
+}
+
+type receiver interface {
+	Receive(ctx context.Context, handler servicebus.Handler) error
+	Close(ctx context.Context) error
+}
+
+type sessionReceiver interface {
+	ReceiveOne(ctx context.Context, handler servicebus.SessionHandler) error
+	Close(ctx context.Context) error
+}
+
+type sbBroker struct {
+	opts broker.Options
+
+	sync.RWMutex
+	ns      *servicebus.Namespace
+	senders map[string]sender
+}
+
+type subscriber struct {
+	topic  string
+	opts   broker.SubscribeOptions
+	r      receiver
+	cancel context.CancelFunc
+	done   chan bool
+
+	// newSession returns a receiver for the next available session
+	newSession func() sessionReceiver
+
+	// unique subscriptions are deleted on unsubscribe
+	unique  func() error
+	deadLtr bool
+}
+
+type publication struct {
+	topic string
+	m     *broker.Message
+	msg   *servicebus.Message
+	err   error
+
+	// settled is set once the handler dead-lettered the message
+	settled bool
+}
+
+type sessionHandler struct {
+	handle func(ctx context.Context, msg *servicebus.Message) error
+	idle   *time.Timer
+}
+
+func init() {
+	cmd.DefaultBrokers["servicebus"] = NewBroker
+}
+
+func (p *publication) Topic() string {
+	return p.topic
+}
+
+func (p *publication) Message() *broker.Message {
+	return p.m
+}
+
+func (p *publication) Ack() error {
+	return p.msg.Complete(context.Background())
+}
+
+func (p *publication) Error() error {
+	return p.err
+}
+
+// DeadLetter moves the message to the dead-letter queue of the entity
+func (p *publication) DeadLetter(reason error) error {
+	if err := p.msg.DeadLetter(context.Background(), reason); err != nil {
+		return err
+	}
+	p.settled = true
+	return nil
+}
+
+func (s *sessionHandler) Start(ms *servicebus.MessageSession) error {
+	return nil
+}
+
+func (s *sessionHandler) Handle(ctx context.Context, msg *servicebus.Message) error {
+	s.idle.Reset(DefaultSessionIdle)
+	return s.handle(ctx, msg)
+}
+
+func (s *sessionHandler) End() {}
+
+func (t topicSender) Send(ctx context.Context, msg *servicebus.Message) error {
+	return t.Topic.Send(ctx, msg)
+}
+
+func (s *subscriber) Options() broker.SubscribeOptions {
+	return s.opts
+}
+
+func (s *subscriber) Topic() string {
+	return s.topic
+}
+
+func (s *subscriber) Unsubscribe() error {
+	s.cancel()
+	<-s.done
+
+	if err := s.r.Close(context.Background()); err != nil {
+		return err
+	}
+	if s.unique != nil {
+		return s.unique()
+	}
+	return nil
+}
+
+// handler settles the message itself and always returns nil, as errors
+// returned to service bus stop the receiver
+func (s *subscriber) handler(h broker.Handler) func(ctx context.Context, msg *servicebus.Message) error {
+	return func(ctx context.Context, msg *servicebus.Message) error {
+		header := make(map[string]string, len(msg.UserProperties))
+		for k, v := range msg.UserProperties {
+			header[k] = fmt.Sprintf("%v", v)
+		}
+
+		p := &publication{
+			topic: s.topic,
+			m: &broker.Message{
+				Header: header,
+				Body:   msg.Data,
+			},
+			msg: msg,
+		}
+
+		var err error
+		if p.err = h(p); p.settled {
+			return nil
+		} else if p.err != nil {
+			if s.deadLtr {
+				err = msg.DeadLetter(ctx, p.err)
+			} else {
+				err = msg.Abandon(ctx)
+			}
+		} else if s.opts.AutoAck {
+			err = msg.Complete(ctx)
+		}
+		if err != nil {
+			log.Errorf("[servicebus] failed to settle message %s on %s: %v", msg.ID, s.topic, err)
+		}
+		return nil
+	}
+}
+
+func (s *subscriber) run(h broker.Handler, ctx context.Context) {
+	defer close(s.done)
+
+	handle := s.handler(h)
+
+	for {
+		var err error
+		if s.newSession != nil {
+			err = s.receiveSession(ctx, handle)
+		} else {
+			err = s.r.Receive(ctx, servicebus.HandlerFunc(handle))
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Errorf("[servicebus] failed to receive from %s: %v", s.topic, err)
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// receiveSession locks the next available session and receives its messages
+// until it was idle for DefaultSessionIdle
+func (s *subscriber) receiveSession(ctx context.Context, handle func(context.Context, *servicebus.Message) error) error {
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sh := &sessionHandler{
+		handle: handle,
+		idle:   time.AfterFunc(DefaultSessionIdle, cancel),
+	}
+	defer sh.idle.Stop()
+
+	sr := s.newSession()
+	defer sr.Close(context.Background())
+
+	err := sr.ReceiveOne(sctx, sh)
+	if sctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// connectionString returns the connection string option or the first address
+func (b *sbBroker) connectionString() string {
+	if cs, ok := b.opts.Context.Value(connectionStringKey{}).(string); ok {
+		return cs
+	}
+	if len(b.opts.Addrs) > 0 {
+		return b.opts.Addrs[0]
+	}
+	return ""
+}
+
+func (b *sbBroker) queues() bool {
+	q, _ := b.opts.Context.Value(queuesKey{}).(bool)
+	return q
+}
+
+func (b *sbBroker) autoCreate() bool {
+	c, _ := b.opts.Context.Value(autoCreateKey{}).(bool)
+	return c
+}
+
+func (b *sbBroker) namespace() (*servicebus.Namespace, error) {
+	b.RLock()
+	defer b.RUnlock()
+	if b.ns == nil {
+		return nil, errors.New("not connected")
+	}
+	return b.ns, nil
+}
+
+// ensureQueue creates the queue if it doesn't exist
+func (b *sbBroker) ensureQueue(ctx context.Context, ns *servicebus.Namespace, name string, sessions bool) error {
+	qm := ns.NewQueueManager()
+	if _, err := qm.Get(ctx, name); err == nil {
+		return nil
+	} else if _, ok := err.(servicebus.ErrNotFound); !ok {
+		return err
+	}
+
+	var opts []servicebus.QueueManagementOption
+	if sessions {
+		opts = append(opts, servicebus.QueueEntityWithRequiredSessions())
+	}
+	if n, ok := b.opts.Context.Value(maxDeliveryCountKey{}).(int32); ok {
+		opts = append(opts, func(q *servicebus.QueueDescription) error {
+			q.MaxDeliveryCount = &n
+			return nil
+		})
+	}
+	_, err := qm.Put(ctx, name, opts...)
+	return err
+}
+
+// ensureTopic creates the topic if it doesn't exist
+func (b *sbBroker) ensureTopic(ctx context.Context, ns *servicebus.Namespace, name string) error {
+	tm := ns.NewTopicManager()
+	if _, err := tm.Get(ctx, name); err == nil {
+		return nil
+	} else if _, ok := err.(servicebus.ErrNotFound); !ok {
+		return err
+	}
+	_, err := tm.Put(ctx, name)
+	return err
+}
+
+// ensureSubscription creates the subscription if it doesn't exist
+func (b *sbBroker) ensureSubscription(ctx context.Context, sm *servicebus.SubscriptionManager, name string, sessions bool) error {
+	if _, err := sm.Get(ctx, name); err == nil {
+		return nil
+	} else if _, ok := err.(servicebus.ErrNotFound); !ok {
+		return err
+	}
+
+	var opts []servicebus.SubscriptionManagementOption
+	if sessions {
+		opts = append(opts, servicebus.SubscriptionWithRequiredSessions())
+	}
+	if n, ok := b.opts.Context.Value(maxDeliveryCountKey{}).(int32); ok {
+		opts = append(opts, func(s *servicebus.SubscriptionDescription) error {
+			s.MaxDeliveryCount = &n
+			return nil
+		})
+	}
+	_, err := sm.Put(ctx, name, opts...)
+	return err
+}
+
+func (b *sbBroker) Address() string {
+	// only report the endpoint, the connection string holds the access key
+	for _, part := range strings.Split(b.connectionString(), ";") {
+		if strings.HasPrefix(part, "Endpoint=") {
+			return strings.TrimPrefix(part, "Endpoint=")
+		}
+	}
+	return ""
+}
+
+func (b *sbBroker) Connect() error {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.ns != nil {
+		return nil
+	}
+
+	cs := b.connectionString()
+	if len(cs) == 0 {
+		return errors.New("servicebus requires a connection string")
+	}
+
+	ns, err := servicebus.NewNamespace(servicebus.NamespaceWithConnectionString(cs))
+	if err != nil {
+		return err
+	}
+	b.ns = ns
+	b.senders = make(map[string]sender)
+	return nil
+}
+
+func (b *sbBroker) Disconnect() error {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.ns == nil {
+		return nil
+	}
+	for _, s := range b.senders {
+		s.Close(context.Background())
+	}
+	b.ns = nil
+	b.senders = nil
+	return nil
+}
+
+func (b *sbBroker) Init(opts ...broker.Option) error {
+	for _, o := range opts {
+		o(&b.opts)
+	}
+	return nil
+}
+
+func (b *sbBroker) Options() broker.Options {
+	return b.opts
+}
+
+// sender returns the sender of the topic, senders are created on first use
+func (b *sbBroker) sender(ctx context.Context, topic string) (sender, error) {
+	b.RLock()
+	if b.ns == nil {
+		b.RUnlock()
+		return nil, errors.New("not connected")
+	}
+	s, ok := b.senders[topic]
+	b.RUnlock()
+	if ok {
+		return s, nil
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if s, ok := b.senders[topic]; ok {
+		return s, nil
+	}
+
+	var err error
+	if b.queues() {
+		if b.autoCreate() {
+			if err := b.ensureQueue(ctx, b.ns, topic, false); err != nil {
+				return nil, err
+			}
+		}
+		s, err = b.ns.NewQueue(topic)
+	} else {
+		if b.autoCreate() {
+			if err := b.ensureTopic(ctx, b.ns, topic); err != nil {
+				return nil, err
+			}
+		}
+		var t *servicebus.Topic
+		if t, err = b.ns.NewTopic(topic); err == nil {
+			s = topicSender{t}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	b.senders[topic] = s
+	return s, nil
+}
+
+func (b *sbBroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	options := broker.PublishOptions{
+		Context: context.Background(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	s, err := b.sender(options.Context, topic)
+	if err != nil {
+		return err
+	}
+
+	m := servicebus.NewMessage(msg.Body)
+	m.UserProperties = make(map[string]interface{}, len(msg.Header))
+	for k, v := range msg.Header {
+		m.UserProperties[k] = v
+	}
+	if id, ok := options.Context.Value(sessionIDKey{}).(string); ok {
+		m.SessionID = &id
+	}
+	if t, ok := options.Context.Value(scheduleAtKey{}).(time.Time); ok {
+		m.ScheduleAt(t)
+	}
+
+	return s.Send(options.Context, m)
+}
+
+func (b *sbBroker) Subscribe(topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	options := broker.SubscribeOptions{
+		AutoAck: true,
+		Context: context.Background(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	ns, err := b.namespace()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, _ := options.Context.Value(sessionsKey{}).(bool)
+	deadLtr, _ := options.Context.Value(deadLetterOnErrorKey{}).(bool)
+	prefetch, _ := options.Context.Value(prefetchCountKey{}).(uint32)
+
+	s := &subscriber{
+		topic:   topic,
+		opts:    options,
+		done:    make(chan bool),
+		deadLtr: deadLtr,
+	}
+
+	ctx := context.Background()
+
+	if b.queues() {
+		if b.autoCreate() {
+			if err := b.ensureQueue(ctx, ns, topic, sessions); err != nil {
+				return nil, err
+			}
+		}
+		var qopts []servicebus.QueueOption
+		if prefetch > 0 {
+			qopts = append(qopts, servicebus.QueueWithPrefetchCount(prefetch))
+		}
+		q, err := ns.NewQueue(topic, qopts...)
+		if err != nil {
+			return nil, err
+		}
+		s.r = q
+		if sessions {
+			s.newSession = func() sessionReceiver {
+				return q.NewSession(nil)
+			}
+		}
+	} else {
+		if b.autoCreate() {
+			if err := b.ensureTopic(ctx, ns, topic); err != nil {
+				return nil, err
+			}
+		}
+		sm, err := ns.NewSubscriptionManager(topic)
+		if err != nil {
+			return nil, err
+		}
+
+		name := options.Queue
+		if len(name) == 0 {
+			name = "micro-" + uuid.New().String()
+			s.unique = func() error {
+				return sm.Delete(context.Background(), name)
+			}
+		}
+		if s.unique != nil || b.autoCreate() {
+			if err := b.ensureSubscription(ctx, sm, name, sessions); err != nil {
+				return nil, fmt.Errorf("subscribe to %s: %v", topic, err)
+			}
+		}
+
+		t, err := ns.NewTopic(topic)
+		if err != nil {
+			return nil, err
+		}
+		var sopts []servicebus.SubscriptionOption
+		if prefetch > 0 {
+			sopts = append(sopts, servicebus.SubscriptionWithPrefetchCount(prefetch))
+		}
+		sub, err := t.NewSubscription(name, sopts...)
+		if err != nil {
+			return nil, err
+		}
+		s.r = sub
+		if sessions {
+			s.newSession = func() sessionReceiver {
+				return sub.NewSession(nil)
+			}
+		}
+	}
+
+	ctx, s.cancel = context.WithCancel(context.Background())
+	go s.run(h, ctx)
+
+	return s, nil
+}
+
+func (b *sbBroker) String() string {
+	return "servicebus"
+}
+
+func NewBroker(opts ...broker.Option) broker.Broker {
+	options := broker.Options{
+		// Default codec
+		Codec:   json.Marshaler{},
+		Context: context.Background(),
+	}
+
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return &sbBroker{
+		opts: options,
+	}
+}
@@ -0,0 +1,34 @@
+package servicebus
+
+import (
+	"testing"
+
+	"github.com/micro/go-micro/v2/broker"
+)
+
+var _ DeadLetterer = &publication{}
+
+func TestAddress(t *testing.T) {
+	cs := "Endpoint=sb://example.servicebus.windows.net/;SharedAccessKeyName=RootManageSharedAccessKey;SharedAccessKey=secret"
+
+	testData := []struct {
+		opts   []broker.Option
+		expect string
+	}{
+		{nil, ""},
+		{[]broker.Option{ConnectionString(cs)}, "sb://example.servicebus.windows.net/"},
+		{[]broker.Option{broker.Addrs(cs)}, "sb://example.servicebus.windows.net/"},
+	}
+
+	for _, d := range testData {
+		if addr := NewBroker(d.opts...).Address(); addr != d.expect {
+			t.Fatalf("expected %q, got %q", d.expect, addr)
+		}
+	}
+}
+
+func TestConnectRequiresConnectionString(t *testing.T) {
+	if err := NewBroker().Connect(); err == nil {
+		t.Fatal("expected connect without a connection string to fail")
+	}
+}
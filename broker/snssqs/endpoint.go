@@ -0,0 +1,22 @@
+package snssqs
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/micro/go-plugins/broker/snssqs/v2/internal/awsendpoint"
+)
+
+// endpointConfig returns the aws config applying the endpoint options
+func (b *awsServices) endpointConfig() aws.Config {
+	endpoint, _ := b.options.Context.Value(endpointKey{}).(string)
+	insecure, _ := b.options.Context.Value(insecureSkipVerifyKey{}).(bool)
+	return awsendpoint.Config(endpoint, b.options.TLSConfig, insecure)
+}
+
+// rewriteQueueURL points the queue URL at the endpoint when PathStyle is set
+func (b *awsServices) rewriteQueueURL(queueURL string) string {
+	if v, ok := b.options.Context.Value(pathStyleKey{}).(bool); !ok || !v {
+		return queueURL
+	}
+	endpoint, _ := b.options.Context.Value(endpointKey{}).(string)
+	return awsendpoint.PathStyle(endpoint, queueURL)
+}
@@ -0,0 +1,39 @@
+package awsendpoint
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	c := Config("", nil, false)
+	if c.Endpoint != nil || c.HTTPClient != nil {
+		t.Fatalf("expected the default config got %+v", c)
+	}
+
+	c = Config("http://localhost:4566", nil, true)
+	if c.Endpoint == nil || *c.Endpoint != "http://localhost:4566" {
+		t.Fatalf("expected the endpoint got %v", c.Endpoint)
+	}
+	tr := c.HTTPClient.Transport.(*http.Transport)
+	if !tr.TLSClientConfig.InsecureSkipVerify {
+		t.Fatal("expected the certificate not to be verified")
+	}
+}
+
+func TestPathStyle(t *testing.T) {
+	testData := []struct {
+		endpoint string
+		url      string
+		expected string
+	}{
+		{"", "https://sqs.eu-west-1.amazonaws.com/123/orders", "https://sqs.eu-west-1.amazonaws.com/123/orders"},
+		{"http://localhost:4566", "https://sqs.eu-west-1.amazonaws.com/123/orders", "http://localhost:4566/123/orders"},
+	}
+
+	for _, d := range testData {
+		if u := PathStyle(d.endpoint, d.url); u != d.expected {
+			t.Fatalf("expected %s got %s", d.expected, u)
+		}
+	}
+}
@@ -86,3 +86,43 @@ func HeaderWhitelistOnPublish(whitelist map[string]struct{}) broker.PublishOptio
 func ClientHeaderWhitelistOnPublish(whitelist map[string]struct{}) client.PublishOption {
 	return setClientPublishOption(headerWhitelistOnPublishKey{}, whitelist)
 }
+
+type endpointKey struct{}
+
+// Endpoint overrides the AWS endpoint of all clients e.g http://localhost:4566 to
+// run against LocalStack or ElasticMQ
+func Endpoint(url string) broker.Option {
+	return setBrokerOption(endpointKey{}, url)
+}
+
+type pathStyleKey struct{}
+
+// PathStyle rewrites the host of queue URLs returned by the service to the Endpoint,
+// for emulators which return URLs with a hostname unreachable from the client
+func PathStyle() broker.Option {
+	return setBrokerOption(pathStyleKey{}, true)
+}
+
+type insecureSkipVerifyKey struct{}
+
+// InsecureSkipVerify disables verification of the endpoint TLS certificate
+func InsecureSkipVerify() broker.Option {
+	return setBrokerOption(insecureSkipVerifyKey{}, true)
+}
+
+type autoProvisionKey struct{}
+
+// AutoProvision creates SNS topics on publish and, on subscribe, treats the topic
+// as an SNS topic: a queue named after the subscriber queue and topic is created
+// and subscribed to it, so every service receives its own copy of each message
+func AutoProvision() broker.Option {
+	return setBrokerOption(autoProvisionKey{}, true)
+}
+
+type filterPolicyKey struct{}
+
+// FilterPolicy sets the SNS filter policy of an auto provisioned subscription,
+// matched against the message headers e.g {"type": ["created", "updated"]}
+func FilterPolicy(policy map[string]interface{}) broker.SubscribeOption {
+	return setSubscribeOption(filterPolicyKey{}, policy)
+}
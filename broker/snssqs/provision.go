@@ -0,0 +1,143 @@
+package snssqs
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/micro/go-micro/v2/broker"
+)
+
+// maxQueueNameLength is the longest queue name SQS accepts
+const maxQueueNameLength = 80
+
+var invalidNameChars = regexp.MustCompile("[^a-zA-Z0-9_-]")
+
+func (b *awsServices) autoProvision() bool {
+	v, ok := b.options.Context.Value(autoProvisionKey{}).(bool)
+	return ok && v
+}
+
+// topicName returns a valid SNS topic or SQS queue name
+func topicName(name string) string {
+	name = invalidNameChars.ReplaceAllString(name, "_")
+	if len(name) > maxQueueNameLength {
+		name = name[:maxQueueNameLength]
+	}
+	return name
+}
+
+// createTopic creates the SNS topic unless it exists and returns its ARN
+func (b *awsServices) createTopic(topic string) (string, error) {
+	b.Lock()
+	arn, ok := b.topics[topic]
+	b.Unlock()
+	if ok {
+		return arn, nil
+	}
+
+	// CreateTopic is idempotent and returns the ARN of an existing topic
+	out, err := b.svcSns.CreateTopic(&sns.CreateTopicInput{
+		Name: aws.String(topicName(topic)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to create topic %s: %s", topic, err.Error())
+	}
+
+	b.Lock()
+	b.topics[topic] = *out.TopicArn
+	b.Unlock()
+
+	return *out.TopicArn, nil
+}
+
+// queuePolicy allows the topic to deliver to the queue
+func queuePolicy(queueArn, topicArn string) (string, error) {
+	policy := map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{{
+			"Effect":    "Allow",
+			"Principal": map[string]string{"Service": "sns.amazonaws.com"},
+			"Action":    "sqs:SendMessage",
+			"Resource":  queueArn,
+			"Condition": map[string]interface{}{
+				"ArnEquals": map[string]string{"aws:SourceArn": topicArn},
+			},
+		}},
+	}
+	b, err := json.Marshal(policy)
+	return string(b), err
+}
+
+// provision creates a queue for the subscriber, subscribes it to the topic and
+// returns the queue name and URL
+func (b *awsServices) provision(topic string, options broker.SubscribeOptions) (string, string, error) {
+	topicArn, err := b.createTopic(topic)
+	if err != nil {
+		return "", "", err
+	}
+
+	queueName := topic
+	if len(options.Queue) > 0 && options.Queue != topic {
+		queueName = options.Queue + "-" + topic
+	}
+	queueName = topicName(queueName)
+
+	q, err := b.svcSqs.CreateQueue(&sqs.CreateQueueInput{
+		QueueName: aws.String(queueName),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("unable to create queue %s: %s", queueName, err.Error())
+	}
+	queueURL := b.rewriteQueueURL(*q.QueueUrl)
+
+	attrs, err := b.svcSqs.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameQueueArn}),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("unable to get arn of queue %s: %s", queueName, err.Error())
+	}
+	queueArn := aws.StringValue(attrs.Attributes[sqs.QueueAttributeNameQueueArn])
+
+	policy, err := queuePolicy(queueArn, topicArn)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := b.svcSqs.SetQueueAttributes(&sqs.SetQueueAttributesInput{
+		QueueUrl: aws.String(queueURL),
+		Attributes: map[string]*string{
+			sqs.QueueAttributeNamePolicy: aws.String(policy),
+		},
+	}); err != nil {
+		return "", "", fmt.Errorf("unable to set policy of queue %s: %s", queueName, err.Error())
+	}
+
+	// raw delivery passes the body and headers through untouched
+	subAttrs := map[string]*string{
+		"RawMessageDelivery": aws.String("true"),
+	}
+	if fp, ok := options.Context.Value(filterPolicyKey{}).(map[string]interface{}); ok && len(fp) > 0 {
+		fb, err := json.Marshal(fp)
+		if err != nil {
+			return "", "", err
+		}
+		subAttrs["FilterPolicy"] = aws.String(string(fb))
+	}
+
+	// subscribing is idempotent for an identical subscription
+	if _, err := b.svcSns.Subscribe(&sns.SubscribeInput{
+		Protocol:   aws.String("sqs"),
+		Endpoint:   aws.String(queueArn),
+		TopicArn:   aws.String(topicArn),
+		Attributes: subAttrs,
+	}); err != nil && !strings.Contains(err.Error(), "already exists") {
+		return "", "", fmt.Errorf("unable to subscribe queue %s to topic %s: %s", queueName, topic, err.Error())
+	}
+
+	return queueName, queueURL, nil
+}
@@ -38,6 +38,10 @@ type awsServices struct {
 	sess      *session.Session
 	accountID string
 	options   broker.Options
+
+	// topic ARNs created by auto provisioning
+	sync.Mutex
+	topics map[string]string
 }
 
 // A subscriber (poller) to an SQS queue
@@ -209,7 +213,7 @@ func (b *awsServices) Connect() error {
 
 	b.sess = session.Must(session.NewSessionWithOptions(session.Options{
 		SharedConfigState: session.SharedConfigEnable,
-		Config:            aws.Config{},
+		Config:            b.endpointConfig(),
 	}))
 
 	sqsConfig := b.getSQSConfig()
@@ -274,6 +278,13 @@ func (b *awsServices) Publish(topic string, msg *broker.Message, opts ...broker.
 		Resource:  topic,
 	}.String()
 
+	if b.autoProvision() {
+		var err error
+		if topicArn, err = b.createTopic(topic); err != nil {
+			return err
+		}
+	}
+
 	input := &sns.PublishInput{
 		Message:  aws.String(string(msg.Body[:])),
 		TopicArn: &topicArn,
@@ -291,14 +302,8 @@ func (b *awsServices) Publish(topic string, msg *broker.Message, opts ...broker.
 
 // Subscribe subscribes to an SQS queue, starting a goroutine to poll for messages
 func (b *awsServices) Subscribe(queueName string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
-	queueURL, err := b.urlFromQueueName(queueName)
-	if err != nil {
-		return nil, err
-	}
-
 	options := broker.SubscribeOptions{
 		AutoAck: true,
-		Queue:   queueName,
 		Context: context.Background(),
 	}
 
@@ -306,6 +311,22 @@ func (b *awsServices) Subscribe(queueName string, h broker.Handler, opts ...brok
 		o(&options)
 	}
 
+	var queueURL string
+	var err error
+	if b.autoProvision() {
+		// the queue name is the topic to subscribe to
+		queueName, queueURL, err = b.provision(queueName, options)
+	} else {
+		queueURL, err = b.urlFromQueueName(queueName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(options.Queue) == 0 {
+		options.Queue = queueName
+	}
+
 	subscriber := &subscriber{
 		options:   options,
 		URL:       queueURL,
@@ -328,7 +349,7 @@ func (b *awsServices) urlFromQueueName(queueName string) (string, error) {
 		}
 		return "", fmt.Errorf("unable to determine URL for queue %s: %s", queueName, err.Error())
 	}
-	return *resultURL.QueueUrl, nil
+	return b.rewriteQueueURL(*resultURL.QueueUrl), nil
 }
 
 // String returns the name of the broker plugin
@@ -381,6 +402,7 @@ func NewBroker(opts ...broker.Option) broker.Broker {
 
 	return &awsServices{
 		options: options,
+		topics:  make(map[string]string),
 	}
 }
 
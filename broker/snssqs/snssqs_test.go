@@ -1,6 +1,7 @@
 package snssqs
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/micro/go-micro/v2/broker"
@@ -32,3 +33,19 @@ func TestValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestTopicName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"go.micro.srv.greeter", "go_micro_srv_greeter"},
+		{"orders-created", "orders-created"},
+		{strings.Repeat("a", 100), strings.Repeat("a", maxQueueNameLength)},
+	}
+	for _, tt := range tests {
+		if got := topicName(tt.name); got != tt.want {
+			t.Errorf("topicName(%s) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package sqs
+
+import (
+	"encoding/base64"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/micro/go-micro/v2/broker"
+)
+
+// receive returns up to n visible messages, leaving them visible to other consumers
+func (b *sqsBroker) receive(queueURL string, n int) ([]*sqs.Message, error) {
+	seen := make(map[string]bool)
+	var msgs []*sqs.Message
+
+	for len(msgs) < n {
+		max := n - len(msgs)
+		if max > maxReceiveMessages {
+			max = maxReceiveMessages
+		}
+
+		result, err := b.svc.ReceiveMessage(&sqs.ReceiveMessageInput{
+			QueueUrl:            &queueURL,
+			MaxNumberOfMessages: aws.Int64(int64(max)),
+			VisibilityTimeout:   aws.Int64(0),
+			MessageAttributeNames: aws.StringSlice([]string{
+				"All",
+			}),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// messages stay visible so a receive may return ones we've seen
+		var added bool
+		for _, m := range result.Messages {
+			if seen[*m.MessageId] {
+				continue
+			}
+			seen[*m.MessageId] = true
+			msgs = append(msgs, m)
+			added = true
+		}
+		if !added {
+			break
+		}
+	}
+
+	return msgs, nil
+}
+
+// Peek receives up to n messages with a visibility timeout of zero so they remain
+// available to subscribers. SQS samples a subset of its servers, so the messages
+// aren't necessarily the oldest. Each peek counts towards the receive count of a
+// redrive policy
+func (b *sqsBroker) Peek(queueName string, n int) ([]*broker.Message, error) {
+	queueURL, err := b.urlFromQueueName(queueName)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := b.receive(queueURL, n)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*broker.Message
+	for _, m := range msgs {
+		body, err := base64.StdEncoding.DecodeString(*m.Body)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, &broker.Message{
+			Header: buildMessageHeader(m.MessageAttributes),
+			Body:   body,
+		})
+	}
+	return res, nil
+}
+
+// Depth returns the approximate number of visible messages from the queue
+// attributes, which doesn't receive any message. The age is always zero as SQS
+// only reports it through the ApproximateAgeOfOldestMessage metric
+func (b *sqsBroker) Depth(queueName string) (int64, time.Duration, error) {
+	queueURL, err := b.urlFromQueueName(queueName)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	attrs, err := b.svc.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       &queueURL,
+		AttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameApproximateNumberOfMessages}),
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	count, err := strconv.ParseInt(aws.StringValue(attrs.Attributes[sqs.QueueAttributeNameApproximateNumberOfMessages]), 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, 0, nil
+}
@@ -0,0 +1,67 @@
+package sqs
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/micro/go-micro/v2/broker"
+)
+
+// browser is the Browser interface of the browser package, brokers implement it
+// without importing the package
+type browser interface {
+	Peek(queue string, n int) ([]*broker.Message, error)
+	Depth(queue string) (int64, time.Duration, error)
+}
+
+var _ browser = &sqsBroker{}
+
+func TestDepth(t *testing.T) {
+	var actions []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		action := r.Form.Get("Action")
+		actions = append(actions, action)
+
+		w.Header().Set("Content-Type", "text/xml")
+		switch action {
+		case "GetQueueUrl":
+			fmt.Fprintf(w, `<GetQueueUrlResponse><GetQueueUrlResult><QueueUrl>http://%s/123/orders</QueueUrl></GetQueueUrlResult></GetQueueUrlResponse>`, r.Host)
+		case "GetQueueAttributes":
+			fmt.Fprint(w, `<GetQueueAttributesResponse><GetQueueAttributesResult><Attribute><Name>ApproximateNumberOfMessages</Name><Value>42</Value></Attribute></GetQueueAttributesResult></GetQueueAttributesResponse>`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	svc := sqs.New(session.Must(session.NewSession(&aws.Config{
+		Endpoint:    aws.String(srv.URL),
+		Region:      aws.String("eu-west-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	})))
+	b := NewBroker(Client(svc))
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	count, age, err := b.(browser).Depth("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 42 || age != 0 {
+		t.Fatalf("expected 42 messages got %d aged %v", count, age)
+	}
+
+	// the depth is read from the attributes without receiving messages
+	if len(actions) != 2 || actions[0] != "GetQueueUrl" || actions[1] != "GetQueueAttributes" {
+		t.Fatalf("unexpected calls %v", actions)
+	}
+}
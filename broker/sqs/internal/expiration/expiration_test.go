@@ -0,0 +1,62 @@
+package expiration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+)
+
+func TestFromOptions(t *testing.T) {
+	var o broker.PublishOptions
+	if _, ok := FromOptions(o); ok {
+		t.Fatal("expected no time to live")
+	}
+
+	Expiration(time.Minute)(&o)
+	if d, ok := FromOptions(o); !ok || d != time.Minute {
+		t.Fatalf("expected a minute got %v", d)
+	}
+
+	Expiration(0)(&o)
+	if _, ok := FromOptions(o); ok {
+		t.Fatal("expected no time to live for zero")
+	}
+}
+
+func TestExpired(t *testing.T) {
+	msg := &broker.Message{Header: map[string]string{"foo": "bar"}}
+
+	m := SetHeader(msg, time.Hour)
+	if _, ok := msg.Header[Header]; ok {
+		t.Fatal("expected the message not to be changed")
+	}
+	if m.Header["foo"] != "bar" || Expired(m.Header) {
+		t.Fatalf("unexpected header %v", m.Header)
+	}
+
+	if !Expired(SetHeader(msg, -time.Second).Header) {
+		t.Fatal("expected the message to be expired")
+	}
+	if Expired(msg.Header) || Expired(map[string]string{Header: "soon"}) {
+		t.Fatal("expected messages without a valid deadline not to expire")
+	}
+}
+
+func TestMilliseconds(t *testing.T) {
+	testData := []struct {
+		d  time.Duration
+		ms int64
+	}{
+		{time.Microsecond, 1},
+		{time.Millisecond, 1},
+		{1500 * time.Microsecond, 2},
+		{time.Second, 1000},
+	}
+
+	for _, d := range testData {
+		if ms := Milliseconds(d.d); ms != d.ms {
+			t.Fatalf("expected %d ms for %v got %d", d.ms, d.d, ms)
+		}
+	}
+}
@@ -2,9 +2,11 @@ package sqs
 
 import (
 	"context"
+	"time"
 
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/micro/go-micro/v2/broker"
+	"github.com/micro/go-plugins/broker/sqs/v2/internal/expiration"
 )
 
 type sqsClientKey struct{}
@@ -13,6 +15,10 @@ type groupIdFunctionKey struct{}
 type maxMessagesKey struct{}
 type visiblityTimeoutKey struct{}
 type waitTimeSecondsKey struct{}
+type visibilityHeartbeatKey struct{}
+type messageGroupIDKey struct{}
+type deduplicationIDKey struct{}
+type delayKey struct{}
 
 type StringFromMessageFunc func(m *broker.Message) string
 
@@ -39,7 +45,7 @@ func GroupIDFunction(groupfunc StringFromMessageFunc) broker.Option {
 }
 
 // MaxReceiveMessages indicates how many messages a receive operation should pull
-// during any single call
+// during any single call, between 1 and 10
 func MaxReceiveMessages(max int64) broker.SubscribeOption {
 	return func(o *broker.SubscribeOptions) {
 		if o.Context == nil {
@@ -51,7 +57,7 @@ func MaxReceiveMessages(max int64) broker.SubscribeOption {
 
 // VisibilityTimeout controls how long a message is hidden from other queue consumers
 // before being put back. If a consumer does not delete the message, it will be put back
-// even if it was "processed"
+// even if it was "processed". Defaults to 30 seconds
 func VisibilityTimeout(seconds int64) broker.SubscribeOption {
 	return func(o *broker.SubscribeOptions) {
 		if o.Context == nil {
@@ -61,7 +67,20 @@ func VisibilityTimeout(seconds int64) broker.SubscribeOption {
 	}
 }
 
-// WaitTimeSeconds controls the length of long polling for available messages
+// VisibilityHeartbeat extends the visibility timeout of a message every interval
+// while the handler runs. Use an interval well below the VisibilityTimeout for
+// handlers which may take longer than it
+func VisibilityHeartbeat(interval time.Duration) broker.SubscribeOption {
+	return func(o *broker.SubscribeOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, visibilityHeartbeatKey{}, interval)
+	}
+}
+
+// WaitTimeSeconds controls the length of long polling for available messages, between 0 and 20.
+// Defaults to 20
 func WaitTimeSeconds(seconds int64) broker.SubscribeOption {
 	return func(o *broker.SubscribeOptions) {
 		if o.Context == nil {
@@ -80,3 +99,79 @@ func Client(c *sqs.SQS) broker.Option {
 		o.Context = context.WithValue(o.Context, sqsClientKey{}, c)
 	}
 }
+
+// Expiration sets a time to live for the published message. SQS has no per-message
+// TTL so the deadline is carried in a message attribute and expired messages are
+// deleted by the subscriber without being handled
+func Expiration(d time.Duration) broker.PublishOption {
+	return expiration.Expiration(d)
+}
+
+// MessageGroupID sets the message group of a message published to a FIFO queue.
+// Messages within a group are delivered in order. Overrides the GroupIDFunction
+func MessageGroupID(id string) broker.PublishOption {
+	return func(o *broker.PublishOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, messageGroupIDKey{}, id)
+	}
+}
+
+// DeduplicationID sets the deduplication id of a message published to a FIFO queue.
+// Overrides the DeduplicationFunction
+func DeduplicationID(id string) broker.PublishOption {
+	return func(o *broker.PublishOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, deduplicationIDKey{}, id)
+	}
+}
+
+// DeliverAfter delays the delivery of the message, up to 15 minutes. FIFO queues
+// only support a delay set on the queue
+func DeliverAfter(d time.Duration) broker.PublishOption {
+	return func(o *broker.PublishOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, delayKey{}, d)
+	}
+}
+
+type endpointKey struct{}
+type pathStyleKey struct{}
+type insecureSkipVerifyKey struct{}
+
+// Endpoint overrides the AWS endpoint e.g http://localhost:4566 to run against
+// LocalStack or ElasticMQ
+func Endpoint(url string) broker.Option {
+	return func(o *broker.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, endpointKey{}, url)
+	}
+}
+
+// PathStyle rewrites the host of queue URLs returned by the service to the Endpoint,
+// for emulators which return URLs with a hostname unreachable from the client
+func PathStyle() broker.Option {
+	return func(o *broker.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, pathStyleKey{}, true)
+	}
+}
+
+// InsecureSkipVerify disables verification of the endpoint TLS certificate
+func InsecureSkipVerify() broker.Option {
+	return func(o *broker.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, insecureSkipVerifyKey{}, true)
+	}
+}
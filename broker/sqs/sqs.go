@@ -2,9 +2,12 @@ package sqs
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -14,12 +17,19 @@ import (
 	"github.com/micro/go-micro/v2/broker"
 	"github.com/micro/go-micro/v2/config/cmd"
 	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-plugins/broker/sqs/v2/internal/expiration"
 )
 
 const (
 	defaultMaxMessages       = 1
-	defaultVisibilityTimeout = 3
-	defaultWaitSeconds       = 10
+	defaultVisibilityTimeout = 30
+	defaultWaitSeconds       = 20
+
+	// limits of the ReceiveMessage API
+	maxReceiveMessages = 10
+	maxWaitSeconds     = 20
+	// limit of the SendMessage DelaySeconds
+	maxDelay = 15 * time.Minute
 )
 
 // Amazon SQS Broker
@@ -55,12 +65,21 @@ func init() {
 // more than one message from a single poll depending on the options configured for the plugin
 func (s *subscriber) run(hdlr broker.Handler) {
 	log.Infof("SQS subscription started. Queue:%s, URL: %s", s.queueName, s.URL)
+
+	// cancel a pending long poll on unsubscribe
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-s.exit
+		cancel()
+	}()
+
 	for {
 		select {
 		case <-s.exit:
 			return
 		default:
-			result, err := s.svc.ReceiveMessage(&sqs.ReceiveMessageInput{
+			result, err := s.svc.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
 				QueueUrl:            &s.URL,
 				MaxNumberOfMessages: s.getMaxMessages(),
 				VisibilityTimeout:   s.getVisibilityTimeout(),
@@ -74,13 +93,19 @@ func (s *subscriber) run(hdlr broker.Handler) {
 			})
 
 			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
 				time.Sleep(time.Second)
 				log.Errorf("Error receiving SQS message: %s", err.Error())
 				continue
 			}
 
+			// long polling already waited for messages
 			if len(result.Messages) == 0 {
-				time.Sleep(time.Second)
+				if *s.getWaitSeconds() == 0 {
+					time.Sleep(time.Second)
+				}
 				continue
 			}
 
@@ -115,6 +140,41 @@ func (s *subscriber) getWaitSeconds() *int64 {
 	return aws.Int64(defaultWaitSeconds)
 }
 
+// heartbeat extends the visibility timeout of the message while it is handled so
+// slow handlers don't see it redelivered to another consumer. It returns a func
+// stopping the heartbeat
+func (s *subscriber) heartbeat(msg *sqs.Message) func() {
+	interval, ok := s.options.Context.Value(visibilityHeartbeatKey{}).(time.Duration)
+	if !ok || interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := s.svc.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+					QueueUrl:          &s.URL,
+					ReceiptHandle:     msg.ReceiptHandle,
+					VisibilityTimeout: s.getVisibilityTimeout(),
+				}); err != nil {
+					log.Errorf("Failed to extend SQS message visibility: %s", err.Error())
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
+
 func (s *subscriber) handleMessage(msg *sqs.Message, hdlr broker.Handler) {
 	log.Infof("Received SQS message: %d bytes", len(*msg.Body))
 
@@ -126,6 +186,17 @@ func (s *subscriber) handleMessage(msg *sqs.Message, hdlr broker.Handler) {
 			Body:   decodeBody,
 		}
 
+		if expiration.Expired(m.Header) {
+			log.Infof("Dropping expired SQS message from queue %s", s.queueName)
+			if _, err := s.svc.DeleteMessage(&sqs.DeleteMessageInput{
+				QueueUrl:      &s.URL,
+				ReceiptHandle: msg.ReceiptHandle,
+			}); err != nil {
+				log.Errorf("Failed to delete expired message: %s", err.Error())
+			}
+			return
+		}
+
 		p := &publication{
 			sMessage:  msg,
 			m:         m,
@@ -134,7 +205,10 @@ func (s *subscriber) handleMessage(msg *sqs.Message, hdlr broker.Handler) {
 			svc:       s.svc,
 		}
 
-		if p.err = hdlr(p); p.err != nil {
+		stop := s.heartbeat(msg)
+		p.err = hdlr(p)
+		stop()
+		if p.err != nil {
 			fmt.Println(p.err)
 		}
 		if s.options.AutoAck {
@@ -202,6 +276,7 @@ func (b *sqsBroker) Connect() error {
 
 	sess := session.Must(session.NewSessionWithOptions(session.Options{
 		SharedConfigState: session.SharedConfigEnable,
+		Config:            b.endpointConfig(),
 	}))
 
 	svc := sqs.New(sess)
@@ -231,6 +306,14 @@ func (b *sqsBroker) Publish(queueName string, msg *broker.Message, opts ...broke
 		return err
 	}
 
+	options := broker.PublishOptions{
+		Context: context.Background(),
+	}
+
+	for _, o := range opts {
+		o(&options)
+	}
+
 	messageBody := base64.StdEncoding.EncodeToString(msg.Body)
 
 	input := &sqs.SendMessageInput{
@@ -238,8 +321,45 @@ func (b *sqsBroker) Publish(queueName string, msg *broker.Message, opts ...broke
 		QueueUrl:    &queueURL,
 	}
 	input.MessageAttributes = copyMessageHeader(msg)
-	input.MessageDeduplicationId = b.generateDedupID(msg)
-	input.MessageGroupId = b.generateGroupID(msg)
+	if d, ok := expiration.FromOptions(options); ok {
+		input.MessageAttributes[expiration.Header] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(expiration.Deadline(d)),
+		}
+	}
+	if d, ok := options.Context.Value(delayKey{}).(time.Duration); ok && d > 0 {
+		if isFIFO(queueName) {
+			return fmt.Errorf("FIFO queue %s does not support per message delays", queueName)
+		}
+		if d > maxDelay {
+			return fmt.Errorf("delay %v exceeds the SQS maximum of %v", d, maxDelay)
+		}
+		// round up so the message is never delivered early
+		input.DelaySeconds = aws.Int64(int64((d + time.Second - 1) / time.Second))
+	}
+	if isFIFO(queueName) {
+		group := b.generateGroupID(msg)
+		if id, ok := options.Context.Value(messageGroupIDKey{}).(string); ok && len(id) > 0 {
+			group = &id
+		}
+		if group == nil {
+			return fmt.Errorf("publishing to FIFO queue %s requires a message group id", queueName)
+		}
+
+		dedup := b.generateDedupID(msg)
+		if id, ok := options.Context.Value(deduplicationIDKey{}).(string); ok && len(id) > 0 {
+			dedup = &id
+		}
+		if dedup == nil {
+			// hash the body like content-based deduplication does so queues
+			// without it enabled accept the message too
+			sum := sha256.Sum256(msg.Body)
+			dedup = aws.String(hex.EncodeToString(sum[:]))
+		}
+
+		input.MessageGroupId = group
+		input.MessageDeduplicationId = dedup
+	}
 
 	log.Infof("Publishing SQS message, %d bytes", len(msg.Body))
 	_, err = b.svc.SendMessage(input)
@@ -269,6 +389,13 @@ func (b *sqsBroker) Subscribe(queueName string, h broker.Handler, opts ...broker
 		o(&options)
 	}
 
+	if v, ok := options.Context.Value(maxMessagesKey{}).(int64); ok && (v < 1 || v > maxReceiveMessages) {
+		return nil, fmt.Errorf("max receive messages must be between 1 and %d", maxReceiveMessages)
+	}
+	if v, ok := options.Context.Value(waitTimeSecondsKey{}).(int64); ok && (v < 0 || v > maxWaitSeconds) {
+		return nil, fmt.Errorf("wait time seconds must be between 0 and %d", maxWaitSeconds)
+	}
+
 	subscriber := &subscriber{
 		options:   options,
 		URL:       queueURL,
@@ -291,7 +418,7 @@ func (b *sqsBroker) urlFromQueueName(queueName string) (string, error) {
 		}
 		return "", errors.New(fmt.Sprintf("Unable to determine URL for queue %s: %s", queueName, err.Error()))
 	}
-	return *resultURL.QueueUrl, nil
+	return b.rewriteQueueURL(*resultURL.QueueUrl), nil
 }
 
 // String returns the name of the broker plugin
@@ -319,6 +446,11 @@ func buildMessageHeader(attribs map[string]*sqs.MessageAttributeValue) map[strin
 	return res
 }
 
+// isFIFO reports whether the queue is a FIFO queue, their names must end in .fifo
+func isFIFO(queueName string) bool {
+	return strings.HasSuffix(queueName, ".fifo")
+}
+
 func (b *sqsBroker) getSQSClient() *sqs.SQS {
 	raw := b.options.Context.Value(sqsClientKey{})
 	if raw != nil {
@@ -331,8 +463,9 @@ func (b *sqsBroker) getSQSClient() *sqs.SQS {
 func (b *sqsBroker) generateGroupID(m *broker.Message) *string {
 	raw := b.options.Context.Value(groupIdFunctionKey{})
 	if raw != nil {
-		s := raw.(StringFromMessageFunc)(m)
-		return &s
+		if s := raw.(StringFromMessageFunc)(m); len(s) > 0 {
+			return &s
+		}
 	}
 	return nil
 }
@@ -340,8 +473,9 @@ func (b *sqsBroker) generateGroupID(m *broker.Message) *string {
 func (b *sqsBroker) generateDedupID(m *broker.Message) *string {
 	raw := b.options.Context.Value(dedupFunctionKey{})
 	if raw != nil {
-		s := raw.(StringFromMessageFunc)(m)
-		return &s
+		if s := raw.(StringFromMessageFunc)(m); len(s) > 0 {
+			return &s
+		}
 	}
 	return nil
 }
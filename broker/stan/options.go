@@ -74,3 +74,59 @@ type durableKey struct{}
 func DurableName(name string) broker.Option {
 	return setBrokerOption(durableKey{}, name)
 }
+
+// SubscribeDurableName sets the durable name of a single subscription, overriding
+// DurableName. The server keeps the position of durable subscriptions so they
+// resume where they left off after a restart
+func SubscribeDurableName(name string) broker.SubscribeOption {
+	return setSubscribeOption(durableKey{}, name)
+}
+
+type startAtKey struct{}
+
+// StartAtSequence starts the subscription at the given sequence
+func StartAtSequence(seq uint64) broker.SubscribeOption {
+	return setSubscribeOption(startAtKey{}, stan.StartAtSequence(seq))
+}
+
+// StartAtTime starts the subscription with messages published since the given time
+func StartAtTime(t time.Time) broker.SubscribeOption {
+	return setSubscribeOption(startAtKey{}, stan.StartAtTime(t))
+}
+
+// StartAtTimeDelta starts the subscription with messages published in the last delta
+func StartAtTimeDelta(d time.Duration) broker.SubscribeOption {
+	return setSubscribeOption(startAtKey{}, stan.StartAtTimeDelta(d))
+}
+
+// StartWithLastReceived starts the subscription with the last published message
+func StartWithLastReceived() broker.SubscribeOption {
+	return setSubscribeOption(startAtKey{}, stan.StartWithLastReceived())
+}
+
+// DeliverAllAvailable starts the subscription with the oldest message in the channel
+func DeliverAllAvailable() broker.SubscribeOption {
+	return setSubscribeOption(startAtKey{}, stan.DeliverAllAvailable())
+}
+
+type manualAckKey struct{}
+
+// ManualAckMode requires the handler to acknowledge messages with Event.Ack,
+// messages which are not acknowledged within AckWait are redelivered
+func ManualAckMode() broker.SubscribeOption {
+	return setSubscribeOption(manualAckKey{}, true)
+}
+
+type ackWaitKey struct{}
+
+// AckWait sets how long the server waits for an ack before redelivering a message
+func AckWait(td time.Duration) broker.SubscribeOption {
+	return setSubscribeOption(ackWaitKey{}, td)
+}
+
+type maxInflightKey struct{}
+
+// MaxInflight sets the number of unacknowledged messages the server delivers
+func MaxInflight(n int) broker.SubscribeOption {
+	return setSubscribeOption(maxInflightKey{}, n)
+}
@@ -326,6 +326,22 @@ func (n *stanBroker) Subscribe(topic string, handler broker.Handler, opts ...bro
 		ackSuccess = true
 	}
 
+	if bval, ok := ctx.Value(manualAckKey{}).(bool); ok && bval {
+		stanOpts = append(stanOpts, stan.SetManualAckMode())
+	}
+
+	if td, ok := ctx.Value(ackWaitKey{}).(time.Duration); ok && td > 0 {
+		stanOpts = append(stanOpts, stan.AckWait(td))
+	}
+
+	if n, ok := ctx.Value(maxInflightKey{}).(int); ok && n > 0 {
+		stanOpts = append(stanOpts, stan.MaxInflight(n))
+	}
+
+	if so, ok := ctx.Value(startAtKey{}).(stan.SubscriptionOption); ok {
+		stanOpts = append(stanOpts, so)
+	}
+
 	bopts := stan.DefaultSubscriptionOptions
 	for _, bopt := range stanOpts {
 		if err := bopt(&bopts); err != nil {
@@ -335,7 +351,12 @@ func (n *stanBroker) Subscribe(topic string, handler broker.Handler, opts ...bro
 
 	opt.AutoAck = !bopts.ManualAcks
 
-	if dn, ok := n.opts.Context.Value(durableKey{}).(string); ok && len(dn) > 0 {
+	// the subscribe option takes precedence over the broker wide durable name
+	dn, _ := ctx.Value(durableKey{}).(string)
+	if len(dn) == 0 {
+		dn, _ = n.opts.Context.Value(durableKey{}).(string)
+	}
+	if len(dn) > 0 {
 		stanOpts = append(stanOpts, stan.DurableName(dn))
 		bopts.DurableName = dn
 	}
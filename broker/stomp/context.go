@@ -11,6 +11,8 @@ type authKey struct{}
 type connectHeaderKey struct{}
 type connectTimeoutKey struct{}
 type durableQueueKey struct{}
+type persistentKey struct{}
+type ackModeKey struct{}
 type receiptKey struct{}
 type subscribeHeaderKey struct{}
 type suppressContentLengthKey struct{}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/go-stomp/stomp"
 	"github.com/micro/go-micro/v2/broker"
 )
 
@@ -31,6 +32,24 @@ func Durable() broker.SubscribeOption {
 	return setSubscribeOption(durableQueueKey{}, true)
 }
 
+// ClientAck acknowledges messages cumulatively, an ack acknowledges every message
+// delivered to the subscription before it. Messages are handled one at a time in
+// the order they are delivered. Implies manual acks unless AckOnSuccess is set
+func ClientAck() broker.SubscribeOption {
+	return setSubscribeOption(ackModeKey{}, stomp.AckClient)
+}
+
+// ClientIndividualAck acknowledges every message on its own. Implies manual acks
+// unless AckOnSuccess is set
+func ClientIndividualAck() broker.SubscribeOption {
+	return setSubscribeOption(ackModeKey{}, stomp.AckClientIndividual)
+}
+
+// Persistent asks the server to persist the message so it survives a restart
+func Persistent() broker.PublishOption {
+	return setPublishOption(persistentKey{}, true)
+}
+
 // Receipt requests a receipt for the delivery should be received
 func Receipt(ct time.Duration) broker.PublishOption {
 	return setPublishOption(receiptKey{}, true)
@@ -119,27 +119,37 @@ func (r *rbroker) Init(opts ...broker.Option) error {
 	return nil
 }
 
-func (r *rbroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
-	if r.stompConn == nil {
-		return errors.New("not connected")
-	}
-
-	// Set options
-	stompOpt := make([]func(*frame.Frame) error, 0, len(msg.Header))
+// sendOptions returns the frame options sending the message
+func sendOptions(msg *broker.Message, opts ...broker.PublishOption) []func(*frame.Frame) error {
+	stompOpt := make([]func(*frame.Frame) error, 0, len(msg.Header)+3)
 	for k, v := range msg.Header {
 		stompOpt = append(stompOpt, stomp.SendOpt.Header(k, v))
 	}
 
-	bOpt := broker.PublishOptions{}
+	bOpt := broker.PublishOptions{
+		Context: context.Background(),
+	}
 	for _, o := range opts {
 		o(&bOpt)
 	}
-	if withReceipt, ok := r.Options().Context.Value(receiptKey{}).(bool); ok && withReceipt {
+	if withReceipt, ok := bOpt.Context.Value(receiptKey{}).(bool); ok && withReceipt {
 		stompOpt = append(stompOpt, stomp.SendOpt.Receipt)
 	}
-	if withoutContentLength, ok := r.Options().Context.Value(suppressContentLengthKey{}).(bool); ok && withoutContentLength {
+	if withoutContentLength, ok := bOpt.Context.Value(suppressContentLengthKey{}).(bool); ok && withoutContentLength {
 		stompOpt = append(stompOpt, stomp.SendOpt.NoContentLength)
 	}
+	if persistent, ok := bOpt.Context.Value(persistentKey{}).(bool); ok && persistent {
+		stompOpt = append(stompOpt, stomp.SendOpt.Header("persistent", "true"))
+	}
+	return stompOpt
+}
+
+func (r *rbroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	if r.stompConn == nil {
+		return errors.New("not connected")
+	}
+
+	stompOpt := sendOptions(msg, opts...)
 
 	// Send
 	if err := r.stompConn.Send(
@@ -194,7 +204,11 @@ func (r *rbroker) Subscribe(topic string, handler broker.Handler, opts ...broker
 	}
 
 	var ackMode stomp.AckMode
-	if bOpt.AutoAck {
+	if mode, ok := ctx.Value(ackModeKey{}).(stomp.AckMode); ok {
+		ackMode = mode
+		// the handler or AckOnSuccess acks
+		bOpt.AutoAck = false
+	} else if bOpt.AutoAck {
 		ackMode = stomp.AckAuto
 	} else {
 		ackMode = stomp.AckClientIndividual
@@ -206,22 +220,29 @@ func (r *rbroker) Subscribe(topic string, handler broker.Handler, opts ...broker
 		return nil, err
 	}
 
+	handle := func(msg *stomp.Message) {
+		// Transform message
+		m := &broker.Message{
+			Header: stompHeaderToMap(msg.Header),
+			Body:   msg.Body,
+		}
+		p := &publication{msg: msg, m: m, topic: topic, broker: r}
+		// Handle the publication
+		p.err = handler(p)
+		if p.err == nil && !bOpt.AutoAck && ackSuccess {
+			msg.Conn.Ack(msg)
+		}
+	}
+
 	// Process messages
 	go func() {
 		for msg := range sub.C {
-			go func(msg *stomp.Message) {
-				// Transform message
-				m := &broker.Message{
-					Header: stompHeaderToMap(msg.Header),
-					Body:   msg.Body,
-				}
-				p := &publication{msg: msg, m: m, topic: topic, broker: r}
-				// Handle the publication
-				p.err = handler(p)
-				if p.err == nil && !bOpt.AutoAck && ackSuccess {
-					msg.Conn.Ack(msg)
-				}
-			}(msg)
+			// cumulative acks would acknowledge messages still being handled
+			if ackMode == stomp.AckClient {
+				handle(msg)
+				continue
+			}
+			go handle(msg)
 		}
 	}()
 
@@ -0,0 +1,46 @@
+package stomp
+
+import (
+	"testing"
+
+	"github.com/go-stomp/stomp/frame"
+	"github.com/micro/go-micro/v2/broker"
+)
+
+func TestSendOptions(t *testing.T) {
+	msg := &broker.Message{Header: map[string]string{"Foo": "Bar"}}
+
+	testData := []struct {
+		opts       []broker.PublishOption
+		persistent string
+	}{
+		{nil, ""},
+		{[]broker.PublishOption{Persistent()}, "true"},
+	}
+
+	for _, d := range testData {
+		f := frame.New(frame.SEND)
+		for _, o := range sendOptions(msg, d.opts...) {
+			if err := o(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if v := f.Header.Get("Foo"); v != "Bar" {
+			t.Fatalf("expected the message header to be sent, got %q", v)
+		}
+		if v := f.Header.Get("persistent"); v != d.persistent {
+			t.Fatalf("expected persistent header %q, got %q", d.persistent, v)
+		}
+	}
+}
+
+func TestTransactor(t *testing.T) {
+	b := NewBroker()
+	tr, ok := b.(Transactor)
+	if !ok {
+		t.Fatal("expected the broker to implement Transactor")
+	}
+	if _, err := tr.Begin(); err == nil {
+		t.Fatal("expected beginning a transaction to fail when not connected")
+	}
+}
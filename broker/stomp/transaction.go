@@ -0,0 +1,41 @@
+package stomp
+
+import (
+	"errors"
+
+	"github.com/go-stomp/stomp"
+	"github.com/micro/go-micro/v2/broker"
+)
+
+// Transactor is implemented by the STOMP broker to publish a batch of messages atomically
+type Transactor interface {
+	// Begin starts a transaction, messages published within it are delivered once it commits
+	Begin() (*Transaction, error)
+}
+
+// Transaction is a STOMP transaction, it must be committed or aborted
+type Transaction struct {
+	tx *stomp.Transaction
+}
+
+// Publish sends the message within the transaction
+func (t *Transaction) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	return t.tx.Send(topic, "", msg.Body, sendOptions(msg, opts...)...)
+}
+
+// Commit delivers the messages published within the transaction
+func (t *Transaction) Commit() error {
+	return t.tx.Commit()
+}
+
+// Abort discards the messages published within the transaction
+func (t *Transaction) Abort() error {
+	return t.tx.Abort()
+}
+
+func (r *rbroker) Begin() (*Transaction, error) {
+	if r.stompConn == nil {
+		return nil, errors.New("not connected")
+	}
+	return &Transaction{tx: r.stompConn.Begin()}, nil
+}
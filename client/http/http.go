@@ -5,6 +5,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -29,6 +30,9 @@ import (
 type httpClient struct {
 	once sync.Once
 	opts client.Options
+
+	// reused across calls to keep the connections alive
+	client *http.Client
 }
 
 func init() {
@@ -76,6 +80,14 @@ func (h *httpClient) next(request client.Request, opts client.CallOptions) (sele
 	return next, nil
 }
 
+// scheme returns https for the nodes registered as secure or with a TLS config
+func (h *httpClient) scheme(node *registry.Node) string {
+	if node.Metadata["secure"] == "true" || tlsConfig(h.opts) != nil {
+		return "https"
+	}
+	return "http"
+}
+
 func (h *httpClient) call(ctx context.Context, node *registry.Node, req client.Request, rsp interface{}, opts client.CallOptions) error {
 	// set the address
 	address := node.Address
@@ -109,7 +121,7 @@ func (h *httpClient) call(ctx context.Context, node *registry.Node, req client.R
 	hreq := &http.Request{
 		Method: "POST",
 		URL: &url.URL{
-			Scheme: "http",
+			Scheme: h.scheme(node),
 			Host:   address,
 			Path:   req.Endpoint(),
 		},
@@ -120,7 +132,7 @@ func (h *httpClient) call(ctx context.Context, node *registry.Node, req client.R
 	}
 
 	// make the request
-	hrsp, err := http.DefaultClient.Do(hreq.WithContext(ctx))
+	hrsp, err := h.client.Do(hreq.WithContext(ctx))
 	if err != nil {
 		return errors.InternalServerError("go.micro.client", err.Error())
 	}
@@ -161,7 +173,18 @@ func (h *httpClient) stream(ctx context.Context, node *registry.Node, req client
 		return nil, errors.InternalServerError("go.micro.client", err.Error())
 	}
 
-	cc, err := net.Dial("tcp", address)
+	dialer := &net.Dialer{Timeout: opts.DialTimeout}
+
+	var cc net.Conn
+	if h.scheme(node) == "https" {
+		config := tlsConfig(h.opts)
+		if config == nil {
+			config = &tls.Config{}
+		}
+		cc, err = tls.DialWithDialer(dialer, "tcp", address, config)
+	} else {
+		cc, err = dialer.DialContext(ctx, "tcp", address)
+	}
 	if err != nil {
 		return nil, errors.InternalServerError("go.micro.client", fmt.Sprintf("Error dialing: %v", err))
 	}
@@ -199,6 +222,8 @@ func (h *httpClient) Init(opts ...client.Option) error {
 	for _, o := range opts {
 		o(&h.opts)
 	}
+	h.client.CloseIdleConnections()
+	h.client = &http.Client{Transport: newTransport(h.opts)}
 	return nil
 }
 
@@ -502,8 +527,9 @@ func newClient(opts ...client.Option) client.Client {
 	}
 
 	rc := &httpClient{
-		once: sync.Once{},
-		opts: options,
+		once:   sync.Once{},
+		opts:   options,
+		client: &http.Client{Transport: newTransport(options)},
 	}
 
 	c := client.Client(rc)
@@ -8,7 +8,10 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/micro/go-micro/v2/client"
 	"github.com/micro/go-micro/v2/client/selector"
@@ -268,3 +271,123 @@ func TestHTTPClientStream(t *testing.T) {
 		}
 	}
 }
+
+func echo(w http.ResponseWriter, r *http.Request) {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+	w.Write(b)
+}
+
+func callEcho(t *testing.T, c client.Client) {
+	msg := &test.Message{Seq: 1, Data: "message 1"}
+	rsp := new(test.Message)
+	if err := c.Call(context.TODO(), c.NewRequest("test.service", "/foo/bar", msg), rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Seq != msg.Seq {
+		t.Fatalf("invalid seq %d for %d", rsp.Seq, msg.Seq)
+	}
+}
+
+func TestHTTPClientTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			http.Error(w, "expect tls", 500)
+			return
+		}
+		echo(w, r)
+	}))
+	defer ts.Close()
+
+	r := memory.NewRegistry()
+	if err := r.Register(&registry.Service{
+		Name: "test.service",
+		Nodes: []*registry.Node{
+			{
+				Id:      "test.service.1",
+				Address: ts.Listener.Addr().String(),
+				Metadata: map[string]string{
+					"protocol": "http",
+					"secure":   "true",
+				},
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(
+		client.Selector(selector.NewSelector(selector.Registry(r))),
+		TLSConfig(ts.Client().Transport.(*http.Transport).TLSClientConfig),
+	)
+	callEcho(t, c)
+}
+
+func TestHTTPClientProxy(t *testing.T) {
+	// the node is only reachable through the proxy
+	address := "10.255.255.1:8080"
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != address {
+			http.Error(w, "unexpected host "+r.URL.Host, 500)
+			return
+		}
+		echo(w, r)
+	}))
+	defer proxy.Close()
+
+	u, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := memory.NewRegistry()
+	if err := r.Register(&registry.Service{
+		Name: "test.service",
+		Nodes: []*registry.Node{
+			{
+				Id:      "test.service.1",
+				Address: address,
+				Metadata: map[string]string{
+					"protocol": "http",
+				},
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(
+		client.Selector(selector.NewSelector(selector.Registry(r))),
+		ProxyURL(u),
+	)
+	callEcho(t, c)
+}
+
+func TestNewTransport(t *testing.T) {
+	opts := client.Options{}
+	for _, o := range []client.Option{
+		client.DialTimeout(time.Second),
+		MaxIdleConns(10),
+		MaxIdleConnsPerHost(5),
+		IdleConnTimeout(time.Minute),
+		TLSHandshakeTimeout(2 * time.Second),
+	} {
+		o(&opts)
+	}
+
+	tr := newTransport(opts).(*http.Transport)
+	if tr.MaxIdleConns != 10 || tr.MaxIdleConnsPerHost != 5 || tr.IdleConnTimeout != time.Minute || tr.TLSHandshakeTimeout != 2*time.Second {
+		t.Fatalf("Expected the options to be applied, got %+v", tr)
+	}
+
+	rt := http.RoundTripper(&http.Transport{})
+	RoundTripper(rt)(&opts)
+	if newTransport(opts) != rt {
+		t.Fatal("Expected the round tripper to replace the transport")
+	}
+}
@@ -0,0 +1,138 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/micro/go-micro/v2/client"
+)
+
+var (
+	// DefaultMaxIdleConns is the max of idle connections kept across nodes
+	DefaultMaxIdleConns = 100
+
+	// DefaultMaxIdleConnsPerHost is the max of idle connections kept per node
+	DefaultMaxIdleConnsPerHost = 32
+
+	// DefaultIdleConnTimeout is how long idle connections are kept
+	DefaultIdleConnTimeout = 90 * time.Second
+)
+
+type maxIdleConnsKey struct{}
+type maxIdleConnsPerHostKey struct{}
+type idleConnTimeoutKey struct{}
+type proxyKey struct{}
+type tlsConfigKey struct{}
+type tlsHandshakeTimeoutKey struct{}
+type roundTripperKey struct{}
+
+// MaxIdleConns sets the max of idle connections kept across nodes
+func MaxIdleConns(n int) client.Option {
+	return setClientOption(maxIdleConnsKey{}, n)
+}
+
+// MaxIdleConnsPerHost sets the max of idle connections kept per node
+func MaxIdleConnsPerHost(n int) client.Option {
+	return setClientOption(maxIdleConnsPerHostKey{}, n)
+}
+
+// IdleConnTimeout sets how long idle connections are kept
+func IdleConnTimeout(d time.Duration) client.Option {
+	return setClientOption(idleConnTimeoutKey{}, d)
+}
+
+// Proxy sets the proxy of the requests, by default it's taken from the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+func Proxy(fn func(*http.Request) (*url.URL, error)) client.Option {
+	return setClientOption(proxyKey{}, fn)
+}
+
+// ProxyURL sends the requests through the proxy at the url
+func ProxyURL(u *url.URL) client.Option {
+	return Proxy(http.ProxyURL(u))
+}
+
+// TLSConfig sets the TLS config, requests are sent over https to every node
+// rather than to the nodes registered as secure only
+func TLSConfig(c *tls.Config) client.Option {
+	return setClientOption(tlsConfigKey{}, c)
+}
+
+// TLSHandshakeTimeout sets how long to wait for the TLS handshake
+func TLSHandshakeTimeout(d time.Duration) client.Option {
+	return setClientOption(tlsHandshakeTimeoutKey{}, d)
+}
+
+// RoundTripper replaces the transport of the calls, the other transport options are ignored
+func RoundTripper(rt http.RoundTripper) client.Option {
+	return setClientOption(roundTripperKey{}, rt)
+}
+
+func setClientOption(k, v interface{}) client.Option {
+	return func(o *client.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// tlsConfig returns the TLS config of the options, nil without
+func tlsConfig(opts client.Options) *tls.Config {
+	if opts.Context == nil {
+		return nil
+	}
+	c, _ := opts.Context.Value(tlsConfigKey{}).(*tls.Config)
+	return c
+}
+
+// newTransport returns the transport of the calls, shared so connections are reused
+func newTransport(opts client.Options) http.RoundTripper {
+	c := opts.Context
+	if c == nil {
+		c = context.Background()
+	}
+
+	if rt, ok := c.Value(roundTripperKey{}).(http.RoundTripper); ok && rt != nil {
+		return rt
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   opts.CallOptions.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig(opts),
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          DefaultMaxIdleConns,
+		MaxIdleConnsPerHost:   DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:       DefaultIdleConnTimeout,
+		ForceAttemptHTTP2:     true,
+	}
+
+	if fn, ok := c.Value(proxyKey{}).(func(*http.Request) (*url.URL, error)); ok {
+		t.Proxy = fn
+	}
+	if d, ok := c.Value(tlsHandshakeTimeoutKey{}).(time.Duration); ok {
+		t.TLSHandshakeTimeout = d
+	}
+	if n, ok := c.Value(maxIdleConnsKey{}).(int); ok {
+		t.MaxIdleConns = n
+	}
+	if n, ok := c.Value(maxIdleConnsPerHostKey{}).(int); ok {
+		t.MaxIdleConnsPerHost = n
+	}
+	if d, ok := c.Value(idleConnTimeoutKey{}).(time.Duration); ok {
+		t.IdleConnTimeout = d
+	}
+
+	return t
+}
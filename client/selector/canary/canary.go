@@ -0,0 +1,229 @@
+// Package canary provides a client wrapper splitting the calls of services between versions
+package canary
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/config"
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/metadata"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+/*
+	The wrapper decides which side of the split a call goes to and the filter keeps
+	the nodes of that side, the selector picks one of them with its strategy. Calls
+	with a key are hashed with the service into one of 10000 buckets and go to the
+	canary when the bucket is below the percent, so a key keeps its side and raising
+	the percent only moves keys to the canary. Calls without a key are split at random.
+
+	When one side has no nodes the calls go to the other, a canary scaled to zero or
+	a rollout completed doesn't fail calls.
+*/
+
+var (
+	// DefaultPath is where the rules are in the config without a path
+	DefaultPath = []string{"canary"}
+)
+
+// Filter keeps the services of the version, or all but them if canary is false.
+// All the services are kept when none would be
+func Filter(version string, canary bool) selector.Filter {
+	return func(old []*registry.Service) []*registry.Service {
+		var services []*registry.Service
+		for _, s := range old {
+			if (s.Version == version) == canary {
+				services = append(services, s)
+			}
+		}
+		if len(services) == 0 {
+			return old
+		}
+		return services
+	}
+}
+
+// bucket returns the bucket of the key, from 0 to 9999
+func bucket(service, key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(service))
+	h.Write([]byte{'/'})
+	h.Write([]byte(key))
+	return h.Sum32() % 10000
+}
+
+// canary returns whether the call goes to the canary of the rule
+func canary(r Rule, service, key string) bool {
+	switch {
+	case r.Percent <= 0:
+		return false
+	case r.Percent >= 100:
+		return true
+	case len(key) > 0:
+		return float64(bucket(service, key)) < r.Percent*100
+	default:
+		return rand.Float64()*100 < r.Percent
+	}
+}
+
+// split holds the rules, shared by the clients wrapped so the config is watched once
+type split struct {
+	header string
+
+	sync.RWMutex
+	rules map[string]Rule
+}
+
+func (s *split) rule(service string) (Rule, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	r, ok := s.rules[service]
+	return r, ok && len(r.Version) > 0
+}
+
+// key returns the key the call sticks by, the one passed to the call or the header
+func (s *split) key(ctx context.Context, opts []client.CallOption) string {
+	var options client.CallOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.Context != nil {
+		if key, ok := options.Context.Value(keyKey{}).(string); ok && len(key) > 0 {
+			return key
+		}
+	}
+	if len(s.header) == 0 {
+		return ""
+	}
+	key, _ := metadata.Get(ctx, s.header)
+	return key
+}
+
+// options filters the nodes of the side of the split the call goes to
+func (s *split) options(ctx context.Context, req client.Request, opts []client.CallOption) []client.CallOption {
+	r, ok := s.rule(req.Service())
+	if !ok {
+		return opts
+	}
+	filter := Filter(r.Version, canary(r, req.Service(), s.key(ctx, opts)))
+	return append(opts, client.WithSelectOption(selector.WithFilter(filter)))
+}
+
+// update sets the rules of the config
+func (s *split) update(rules map[string]Rule) {
+	s.Lock()
+	s.rules = rules
+	s.Unlock()
+}
+
+// watch applies the rules of the config as they change until the context is done
+func (s *split) watch(ctx context.Context, conf config.Config, path []string) {
+	var rules map[string]Rule
+	if err := conf.Get(path...).Scan(&rules); err != nil {
+		log.Errorf("[canary] failed to read rules: %v", err)
+	} else if rules != nil {
+		s.update(rules)
+	}
+
+	for {
+		w, err := conf.Watch(path...)
+		if err != nil {
+			log.Errorf("[canary] failed to watch rules: %v", err)
+		} else {
+			s.next(ctx, w, path)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// next applies the rules of the watcher until it fails or the context is done
+func (s *split) next(ctx context.Context, w config.Watcher, path []string) {
+	done := make(chan bool)
+	defer close(done)
+
+	// stopping the watcher unblocks Next
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		w.Stop()
+	}()
+
+	for {
+		v, err := w.Next()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Errorf("[canary] failed to watch rules: %v", err)
+			}
+			return
+		}
+		var rules map[string]Rule
+		if err := v.Scan(&rules); err != nil {
+			log.Errorf("[canary] failed to read rules, keeping the last ones: %v", err)
+			continue
+		}
+		s.update(rules)
+	}
+}
+
+type canaryWrapper struct {
+	client.Client
+	split *split
+}
+
+func (c *canaryWrapper) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	return c.Client.Call(ctx, req, rsp, c.split.options(ctx, req, opts)...)
+}
+
+func (c *canaryWrapper) Stream(ctx context.Context, req client.Request, opts ...client.CallOption) (client.Stream, error) {
+	return c.Client.Stream(ctx, req, c.split.options(ctx, req, opts)...)
+}
+
+// NewClientWrapper returns a client wrapper sending a share of the calls of services
+// to the nodes of their canary version, set with Split or read from a Config
+func NewClientWrapper(opts ...Option) client.Wrapper {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+
+	rules := make(map[string]Rule, len(options.Rules))
+	for service, r := range options.Rules {
+		rules[service] = r
+	}
+
+	s := &split{
+		header: options.Header,
+		rules:  rules,
+	}
+	if options.Config != nil {
+		path := options.Path
+		if len(path) == 0 {
+			path = DefaultPath
+		}
+		ctx := options.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		go s.watch(ctx, options.Config, path)
+	}
+
+	return func(c client.Client) client.Client {
+		return &canaryWrapper{
+			Client: c,
+			split:  s,
+		}
+	}
+}
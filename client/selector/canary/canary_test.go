@@ -0,0 +1,214 @@
+package canary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/config"
+	"github.com/micro/go-micro/v2/config/reader"
+	"github.com/micro/go-micro/v2/metadata"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+var services = []*registry.Service{
+	{Name: "foo", Version: "1.0.0", Nodes: []*registry.Node{{Id: "foo-1"}, {Id: "foo-2"}}},
+	{Name: "foo", Version: "1.1.0", Nodes: []*registry.Node{{Id: "foo-canary"}}},
+}
+
+type testRequest struct {
+	client.Request
+}
+
+func (r *testRequest) Service() string {
+	return "foo"
+}
+
+// testClient replies the version of the services left by the filters
+type testClient struct {
+	client.Client
+}
+
+func (c *testClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	var options client.CallOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	var so selector.SelectOptions
+	for _, o := range options.SelectOptions {
+		o(&so)
+	}
+	svcs := services
+	for _, f := range so.Filters {
+		svcs = f(svcs)
+	}
+	if len(svcs) != 1 {
+		return fmt.Errorf("expected a version got %d", len(svcs))
+	}
+	*(rsp.(*string)) = svcs[0].Version
+	return nil
+}
+
+func version(t *testing.T, c client.Client, ctx context.Context, opts ...client.CallOption) string {
+	t.Helper()
+	var v string
+	if err := c.Call(ctx, &testRequest{}, &v, opts...); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestFilter(t *testing.T) {
+	if s := Filter("1.1.0", true)(services); len(s) != 1 || s[0].Version != "1.1.0" {
+		t.Fatalf("expected the canary got %v", s)
+	}
+	if s := Filter("1.1.0", false)(services); len(s) != 1 || s[0].Version != "1.0.0" {
+		t.Fatalf("expected the stable version got %v", s)
+	}
+	// without canary nodes the calls go to the others
+	if s := Filter("2.0.0", true)(services); len(s) != 2 {
+		t.Fatalf("expected all the services got %v", s)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	c := NewClientWrapper(Split("foo", "1.1.0", 20))(&testClient{})
+
+	var n int
+	for i := 0; i < 1000; i++ {
+		if version(t, c, context.Background()) == "1.1.0" {
+			n++
+		}
+	}
+	if n < 100 || n > 300 {
+		t.Fatalf("expected about a fifth of the calls on the canary got %d", n)
+	}
+
+	c = NewClientWrapper(Split("foo", "1.1.0", 0))(&testClient{})
+	if v := version(t, c, context.Background()); v != "1.0.0" {
+		t.Fatalf("expected the stable version got %s", v)
+	}
+}
+
+func TestSticky(t *testing.T) {
+	low := NewClientWrapper(Split("foo", "1.1.0", 10), Header("X-User-Id"))(&testClient{})
+	high := NewClientWrapper(Split("foo", "1.1.0", 50), Header("X-User-Id"))(&testClient{})
+
+	var n int
+	for i := 0; i < 200; i++ {
+		ctx := metadata.Set(context.Background(), "X-User-Id", fmt.Sprintf("user-%d", i))
+		v := version(t, low, ctx)
+		for j := 0; j < 3; j++ {
+			if version(t, low, ctx) != v {
+				t.Fatal("expected the key to stick")
+			}
+		}
+		// raising the percent keeps the keys on the canary
+		if v == "1.1.0" {
+			n++
+			if version(t, high, ctx) != "1.1.0" {
+				t.Fatal("expected the key to stay on the canary")
+			}
+		}
+	}
+	if n == 0 || n > 60 {
+		t.Fatalf("expected about a tenth of the keys on the canary got %d", n)
+	}
+
+	// the key of the call takes precedence
+	ctx := metadata.Set(context.Background(), "X-User-Id", "user-1")
+	v := version(t, low, ctx, Key("other"))
+	if version(t, low, context.Background(), Key("other")) != v {
+		t.Fatal("expected the key of the call to be used")
+	}
+}
+
+type testValue struct {
+	reader.Value
+	data string
+}
+
+func (v *testValue) Scan(val interface{}) error {
+	return json.Unmarshal([]byte(v.data), val)
+}
+
+type testWatcher struct {
+	values chan string
+	stop   chan bool
+	once   sync.Once
+}
+
+func (w *testWatcher) Next() (reader.Value, error) {
+	select {
+	case v := <-w.values:
+		return &testValue{data: v}, nil
+	case <-w.stop:
+		return nil, errors.New("watcher stopped")
+	}
+}
+
+func (w *testWatcher) Stop() error {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+	return nil
+}
+
+type testConfig struct {
+	config.Config
+	data    string
+	watcher *testWatcher
+}
+
+func (c *testConfig) Get(path ...string) reader.Value {
+	return &testValue{data: c.data}
+}
+
+func (c *testConfig) Watch(path ...string) (config.Watcher, error) {
+	return c.watcher, nil
+}
+
+func TestConfig(t *testing.T) {
+	conf := &testConfig{
+		data:    `{"foo": {"version": "1.1.0", "percent": 100}}`,
+		watcher: &testWatcher{values: make(chan string), stop: make(chan bool)},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewClientWrapper(Split("foo", "1.1.0", 0), Config(conf), WithContext(ctx))(&testClient{})
+
+	expect := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for version(t, c, context.Background()) != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the calls to go to %s", want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// the rules of the config take the place of the others
+	expect("1.1.0")
+
+	conf.watcher.values <- `{"foo": {"version": "1.1.0", "percent": 0}}`
+	expect("1.0.0")
+
+	// invalid rules are skipped
+	conf.watcher.values <- `{"foo": []}`
+	conf.watcher.values <- `{"foo": {"version": "1.1.0", "percent": 100}}`
+	expect("1.1.0")
+
+	// the watch stops with the context
+	cancel()
+	select {
+	case <-conf.watcher.stop:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the watcher to be stopped")
+	}
+}
@@ -0,0 +1,80 @@
+package canary
+
+import (
+	"context"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/config"
+)
+
+// Rule sends a share of the calls of a service to the nodes of a version
+type Rule struct {
+	// Version is the version of the canary nodes
+	Version string `json:"version"`
+	// Percent is the share of calls sent to the canary, from 0 to 100
+	Percent float64 `json:"percent"`
+}
+
+type Options struct {
+	// Rules are keyed by service
+	Rules map[string]Rule
+	// Header is the metadata key holding the key calls stick by
+	Header string
+	// Config holds the rules changed at runtime
+	Config config.Config
+	// Path is where the rules are in the config
+	Path []string
+	// Context stops watching the config once done
+	Context context.Context
+}
+
+type Option func(*Options)
+
+// Split sends the percent of the calls of the service to the nodes of the version
+func Split(service, version string, percent float64) Option {
+	return func(o *Options) {
+		if o.Rules == nil {
+			o.Rules = make(map[string]Rule)
+		}
+		o.Rules[service] = Rule{Version: version, Percent: percent}
+	}
+}
+
+// Header sets the metadata key calls stick by, e.g X-User-Id. Calls with the same key
+// go to the same side of the split while the percent doesn't shrink
+func Header(h string) Option {
+	return func(o *Options) {
+		o.Header = h
+	}
+}
+
+// Config reads the rules from the config at the path, DefaultPath without, and
+// applies them as they change. They take the place of the rules set with Split
+// e.g {"canary": {"go.micro.srv.foo": {"version": "1.1.0", "percent": 5}}}
+func Config(c config.Config, path ...string) Option {
+	return func(o *Options) {
+		o.Config = c
+		o.Path = path
+	}
+}
+
+// WithContext stops watching the config once the context is done, e.g when the
+// service stops. Without it the config is watched for the life of the process
+func WithContext(ctx context.Context) Option {
+	return func(o *Options) {
+		o.Context = ctx
+	}
+}
+
+type keyKey struct{}
+
+// Key returns a call option making the call stick by the key, it takes precedence
+// over the header
+func Key(key string) client.CallOption {
+	return func(o *client.CallOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, keyKey{}, key)
+	}
+}
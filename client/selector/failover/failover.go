@@ -0,0 +1,238 @@
+// Package failover is a selector failing over between groups of nodes in order of priority
+package failover
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/config/cmd"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+/*
+	Nodes are grouped by a metadata label, e.g the local cluster and the remote DR
+	cluster. Calls go to the first group of the priority with a healthy node, round
+	robined within the group, and only fail over to the next group once every node
+	of the group is unhealthy. A node is unhealthy for a cooldown after a failed call.
+	Nodes outside the groups of the priority aren't called, without a priority every
+	node is in one group.
+
+	Retries of a call go to the other healthy nodes in order of priority, then to the
+	unhealthy ones. The priority can be overridden per call.
+*/
+
+var (
+	// DefaultGroupKey is the node metadata key of the group without GroupKey
+	DefaultGroupKey = "group"
+
+	// DefaultCooldown is how long a node is unhealthy without Cooldown
+	DefaultCooldown = 10 * time.Second
+)
+
+type failoverSelector struct {
+	so selector.Options
+	selector.Selector
+
+	sync.Mutex
+	key      string
+	priority []string
+	cooldown time.Duration
+	// failed nodes keyed by id, unhealthy until the time
+	failed map[string]time.Time
+	// round robin position keyed by service and group
+	turns map[string]map[string]int
+}
+
+func init() {
+	cmd.DefaultSelectors["failover"] = NewSelector
+}
+
+func (s *failoverSelector) configure() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.key = DefaultGroupKey
+	if k, ok := s.so.Context.Value(groupKeyKey{}).(string); ok && len(k) > 0 {
+		s.key = k
+	}
+	s.priority, _ = s.so.Context.Value(priorityKey{}).([]string)
+	s.cooldown = DefaultCooldown
+	if d, ok := s.so.Context.Value(cooldownKey{}).(time.Duration); ok && d > 0 {
+		s.cooldown = d
+	}
+}
+
+// groups returns the nodes of the groups in order of priority, the caller holds the lock
+func (s *failoverSelector) groups(services []*registry.Service, priority []string) ([]string, [][]*registry.Node) {
+	if len(priority) == 0 {
+		var nodes []*registry.Node
+		for _, svc := range services {
+			nodes = append(nodes, svc.Nodes...)
+		}
+		return []string{""}, [][]*registry.Node{nodes}
+	}
+
+	index := make(map[string]int, len(priority))
+	for i, g := range priority {
+		if _, ok := index[g]; !ok {
+			index[g] = i
+		}
+	}
+
+	groups := make([][]*registry.Node, len(priority))
+	for _, svc := range services {
+		for _, n := range svc.Nodes {
+			if i, ok := index[n.Metadata[s.key]]; ok {
+				groups[i] = append(groups[i], n)
+			}
+		}
+	}
+	return priority, groups
+}
+
+func (s *failoverSelector) next(service string, priority []string, services []*registry.Service) selector.Next {
+	s.Lock()
+	names, groups := s.groups(services, priority)
+	turns, ok := s.turns[service]
+	if !ok {
+		turns = make(map[string]int)
+		s.turns[service] = turns
+	}
+	s.Unlock()
+
+	tried := make(map[string]bool)
+
+	// pick returns the next node in order of priority not yet tried, the caller holds the lock
+	pick := func(skipFailed bool) *registry.Node {
+		now := time.Now()
+		for g, nodes := range groups {
+			turn := turns[names[g]]
+			for i := range nodes {
+				n := nodes[(turn+i)%len(nodes)]
+				if tried[n.Id] || (skipFailed && s.failed[n.Id].After(now)) {
+					continue
+				}
+				turns[names[g]] = (turn + i + 1) % len(nodes)
+				return n
+			}
+		}
+		return nil
+	}
+
+	return func() (*registry.Node, error) {
+		s.Lock()
+		defer s.Unlock()
+
+		node := pick(true)
+		if node == nil {
+			// every node is unhealthy, try them anyway
+			node = pick(false)
+		}
+		if node == nil {
+			return nil, selector.ErrNoneAvailable
+		}
+		tried[node.Id] = true
+		return node, nil
+	}
+}
+
+// Explain tells the group of the node
+func (s *failoverSelector) Explain(service string, node *registry.Node) string {
+	s.Lock()
+	defer s.Unlock()
+
+	reason := "in group " + node.Metadata[s.key]
+	if s.failed[node.Id].After(time.Now()) {
+		reason += ", unhealthy"
+	}
+	return reason
+}
+
+func (s *failoverSelector) Init(opts ...selector.Option) error {
+	for _, o := range opts {
+		o(&s.so)
+	}
+	s.configure()
+	return s.Selector.Init(opts...)
+}
+
+func (s *failoverSelector) Options() selector.Options {
+	return s.so
+}
+
+func (s *failoverSelector) Select(service string, opts ...selector.SelectOption) (selector.Next, error) {
+	var sopts selector.SelectOptions
+	for _, o := range opts {
+		o(&sopts)
+	}
+
+	s.Lock()
+	priority := s.priority
+	s.Unlock()
+
+	if sopts.Context != nil {
+		if p, ok := sopts.Context.Value(priorityKey{}).([]string); ok {
+			priority = p
+		}
+	}
+
+	strategy := func(services []*registry.Service) selector.Next {
+		return s.next(service, priority, services)
+	}
+
+	return s.Selector.Select(service, append(opts, selector.WithStrategy(strategy))...)
+}
+
+// Mark makes the node unhealthy for the cooldown after a failed call
+func (s *failoverSelector) Mark(service string, node *registry.Node, err error) {
+	s.Lock()
+	if err != nil {
+		now := time.Now()
+		for id, t := range s.failed {
+			if t.Before(now) {
+				delete(s.failed, id)
+			}
+		}
+		s.failed[node.Id] = now.Add(s.cooldown)
+	} else {
+		delete(s.failed, node.Id)
+	}
+	s.Unlock()
+
+	s.Selector.Mark(service, node, err)
+}
+
+func (s *failoverSelector) Reset(service string) {
+	s.Lock()
+	s.failed = make(map[string]time.Time)
+	delete(s.turns, service)
+	s.Unlock()
+
+	s.Selector.Reset(service)
+}
+
+func (s *failoverSelector) String() string {
+	return "failover"
+}
+
+func NewSelector(opts ...selector.Option) selector.Selector {
+	sopts := selector.Options{
+		Context:  context.TODO(),
+		Registry: registry.DefaultRegistry,
+	}
+
+	for _, opt := range opts {
+		opt(&sopts)
+	}
+
+	s := &failoverSelector{
+		so:       sopts,
+		Selector: selector.NewSelector(opts...),
+		failed:   make(map[string]time.Time),
+		turns:    make(map[string]map[string]int),
+	}
+	s.configure()
+	return s
+}
@@ -0,0 +1,103 @@
+package failover
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/registry/memory"
+)
+
+var errFailed = errors.New("failed")
+
+func newSelector(t *testing.T, opts ...selector.Option) selector.Selector {
+	r := memory.NewRegistry()
+	err := r.Register(&registry.Service{
+		Name: "foo",
+		Nodes: []*registry.Node{
+			{Id: "local-1", Metadata: map[string]string{"cluster": "local"}},
+			{Id: "local-2", Metadata: map[string]string{"cluster": "local"}},
+			{Id: "dr-1", Metadata: map[string]string{"cluster": "dr"}},
+			{Id: "other-1", Metadata: map[string]string{"cluster": "other"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSelector(append(opts, selector.Registry(r))...)
+}
+
+func selected(t *testing.T, s selector.Selector, calls int, opts ...selector.SelectOption) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	for i := 0; i < calls; i++ {
+		next, err := s.Select("foo", opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[n.Id]++
+	}
+	return counts
+}
+
+func TestFailover(t *testing.T) {
+	s := newSelector(t,
+		GroupKey("cluster"),
+		Priority("local", "dr"),
+		Cooldown(time.Minute),
+	)
+
+	if counts := selected(t, s, 10); counts["local-1"] != 5 || counts["local-2"] != 5 {
+		t.Fatalf("expected the calls on the local cluster, got %v", counts)
+	}
+
+	s.Mark("foo", &registry.Node{Id: "local-1"}, errFailed)
+	if counts := selected(t, s, 10); counts["local-2"] != 10 {
+		t.Fatalf("expected the calls on the healthy local node, got %v", counts)
+	}
+
+	s.Mark("foo", &registry.Node{Id: "local-2"}, errFailed)
+	if counts := selected(t, s, 10); counts["dr-1"] != 10 {
+		t.Fatalf("expected the calls to fail over to dr, got %v", counts)
+	}
+
+	// the call overrides the priority
+	if counts := selected(t, s, 10, WithPriority("other")); counts["other-1"] != 10 {
+		t.Fatalf("expected the calls on the other cluster, got %v", counts)
+	}
+
+	// retries in order of priority, unhealthy nodes last
+	next, err := s.Select("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for {
+		n, err := next()
+		if err == selector.ErrNoneAvailable {
+			break
+		}
+		order = append(order, n.Id)
+	}
+	if len(order) != 3 || order[0] != "dr-1" {
+		t.Fatalf("unexpected order %v", order)
+	}
+
+	s.Mark("foo", &registry.Node{Id: "local-1"}, nil)
+	if counts := selected(t, s, 10); counts["local-1"] != 10 {
+		t.Fatalf("expected the calls back on the local cluster, got %v", counts)
+	}
+}
+
+func TestNoPriority(t *testing.T) {
+	s := newSelector(t)
+	if counts := selected(t, s, 8); len(counts) != 4 {
+		t.Fatalf("expected the calls on every node, got %v", counts)
+	}
+}
@@ -0,0 +1,54 @@
+package failover
+
+import (
+	"context"
+	"time"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/client/selector"
+)
+
+type groupKeyKey struct{}
+type priorityKey struct{}
+type cooldownKey struct{}
+
+func setOption(k, v interface{}) selector.Option {
+	return func(o *selector.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// GroupKey sets the node metadata key holding the group of the node
+func GroupKey(key string) selector.Option {
+	return setOption(groupKeyKey{}, key)
+}
+
+// Priority sets the groups calls go to, the first group with a healthy node
+// takes the calls
+func Priority(groups ...string) selector.Option {
+	return setOption(priorityKey{}, groups)
+}
+
+// Cooldown sets how long a node is unhealthy after a failed call
+func Cooldown(d time.Duration) selector.Option {
+	return setOption(cooldownKey{}, d)
+}
+
+// WithPriority overrides the groups of the call
+func WithPriority(groups ...string) selector.SelectOption {
+	return func(o *selector.SelectOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, priorityKey{}, groups)
+	}
+}
+
+// Prefer is a call option overriding the groups of the call, e.g to send it to
+// the DR cluster
+func Prefer(groups ...string) client.CallOption {
+	return client.WithSelectOption(WithPriority(groups...))
+}
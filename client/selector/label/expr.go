@@ -0,0 +1,299 @@
+package label
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+/*
+	Expressions filter nodes by their metadata, similar to kubernetes label selectors.
+	Requirements are separated by commas and must all hold:
+
+		env=prod            env==prod         env!=prod
+		env in (prod,canary)                  env notin (dev)
+		version>=1.2        version<2         (also > and <=)
+		canary              !canary           (has the key or not)
+
+	Keys are looked up in the node metadata, then the service metadata. The version
+	falls back to the version of the service. Values are compared as dotted versions
+	by the ordering operators, which don't hold for values which aren't versions.
+	The value is everything after the first operator, so it may hold operators too.
+*/
+
+type operator string
+
+const (
+	opEquals    operator = "="
+	opNotEquals operator = "!="
+	opIn        operator = "in"
+	opNotIn     operator = "notin"
+	opExists    operator = "exists"
+	opNotExists operator = "!"
+	opGreater   operator = ">"
+	opGreaterEq operator = ">="
+	opLess      operator = "<"
+	opLessEq    operator = "<="
+)
+
+// the operators of key op value requirements, longest first
+var operators = []string{"!=", ">=", "<=", "==", "=", ">", "<"}
+
+type requirement struct {
+	key    string
+	op     operator
+	values []string
+}
+
+// Expr is a parsed expression
+type Expr []requirement
+
+// split returns the requirements of the expression, splitting on commas outside parentheses
+func split(expr string) ([]string, error) {
+	var parts []string
+	var depth, start int
+
+	for i, c := range expr {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unexpected ) at %d", i)
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, expr[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("missing )")
+	}
+
+	return append(parts, expr[start:]), nil
+}
+
+func validKey(key string) bool {
+	return len(key) > 0 && !strings.ContainsAny(key, " \t()!=<>,")
+}
+
+func parseRequirement(s string) (requirement, error) {
+	s = strings.TrimSpace(s)
+
+	// !key
+	if strings.HasPrefix(s, "!") && !strings.ContainsAny(s[1:], "=<>") {
+		key := strings.TrimSpace(s[1:])
+		if !validKey(key) {
+			return requirement{}, fmt.Errorf("invalid key in %q", s)
+		}
+		return requirement{key: key, op: opNotExists}, nil
+	}
+
+	// key in (a,b) and key notin (a,b)
+	if fields := strings.Fields(s); len(fields) >= 2 && validKey(fields[0]) && (fields[1] == "in" || fields[1] == "notin") {
+		key := fields[0]
+		rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s[len(key):]), fields[1]))
+		if !strings.HasPrefix(rest, "(") || !strings.HasSuffix(rest, ")") {
+			return requirement{}, fmt.Errorf("invalid set requirement %q", s)
+		}
+		var values []string
+		for _, v := range strings.Split(rest[1:len(rest)-1], ",") {
+			if v = strings.TrimSpace(v); len(v) > 0 {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			return requirement{}, fmt.Errorf("empty set in %q", s)
+		}
+		return requirement{key: key, op: operator(fields[1]), values: values}, nil
+	}
+
+	// key op value, split at the first operator only so the value may hold any
+	if i := strings.IndexAny(s, "!=<>"); i >= 0 {
+		for _, op := range operators {
+			if !strings.HasPrefix(s[i:], op) {
+				continue
+			}
+			parts := strings.SplitN(s[i:], op, 2)
+			key := strings.TrimSpace(s[:i])
+			value := strings.TrimSpace(parts[1])
+			if !validKey(key) {
+				return requirement{}, fmt.Errorf("invalid key in %q", s)
+			}
+			if op == "==" {
+				op = "="
+			}
+			return requirement{key: key, op: operator(op), values: []string{value}}, nil
+		}
+		return requirement{}, fmt.Errorf("invalid operator in %q", s)
+	}
+
+	// key
+	if !validKey(s) {
+		return requirement{}, fmt.Errorf("invalid requirement %q", s)
+	}
+	return requirement{key: s, op: opExists}, nil
+}
+
+// Parse parses the expression, an empty expression matches every node
+func Parse(expr string) (Expr, error) {
+	if len(strings.TrimSpace(expr)) == 0 {
+		return nil, nil
+	}
+
+	parts, err := split(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %v", expr, err)
+	}
+
+	var e Expr
+	for _, part := range parts {
+		r, err := parseRequirement(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression %q: %v", expr, err)
+		}
+		e = append(e, r)
+	}
+	return e, nil
+}
+
+// version returns the parts of a dotted version, e.g v1.2.3
+func version(s string) ([]int, bool) {
+	s = strings.TrimPrefix(s, "v")
+	if len(s) == 0 {
+		return nil, false
+	}
+	var parts []int
+	for _, p := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		parts = append(parts, n)
+	}
+	return parts, true
+}
+
+// compare returns the order of the versions, false if either isn't a version
+func compare(a, b string) (int, bool) {
+	va, ok := version(a)
+	if !ok {
+		return 0, false
+	}
+	vb, ok := version(b)
+	if !ok {
+		return 0, false
+	}
+	for i := 0; i < len(va) || i < len(vb); i++ {
+		var x, y int
+		if i < len(va) {
+			x = va[i]
+		}
+		if i < len(vb) {
+			y = vb[i]
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+	}
+	return 0, true
+}
+
+func lookup(s *registry.Service, n *registry.Node, key string) (string, bool) {
+	if v, ok := n.Metadata[key]; ok {
+		return v, true
+	}
+	if v, ok := s.Metadata[key]; ok {
+		return v, true
+	}
+	if key == "version" && len(s.Version) > 0 {
+		return s.Version, true
+	}
+	return "", false
+}
+
+func (r requirement) matches(s *registry.Service, n *registry.Node) bool {
+	value, ok := lookup(s, n, r.key)
+
+	switch r.op {
+	case opExists:
+		return ok
+	case opNotExists:
+		return !ok
+	case opEquals:
+		return ok && value == r.values[0]
+	case opNotEquals:
+		return !ok || value != r.values[0]
+	case opIn, opNotIn:
+		var in bool
+		for _, v := range r.values {
+			if ok && value == v {
+				in = true
+				break
+			}
+		}
+		return in == (r.op == opIn)
+	}
+
+	if !ok {
+		return false
+	}
+	c, ok := compare(value, r.values[0])
+	if !ok {
+		return false
+	}
+
+	switch r.op {
+	case opGreater:
+		return c > 0
+	case opGreaterEq:
+		return c >= 0
+	case opLess:
+		return c < 0
+	case opLessEq:
+		return c <= 0
+	}
+	return false
+}
+
+// Matches returns whether the node of the service meets every requirement
+func (e Expr) Matches(s *registry.Service, n *registry.Node) bool {
+	for _, r := range e {
+		if !r.matches(s, n) {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter returns a selector filter keeping the nodes matching the expression
+func (e Expr) Filter() selector.Filter {
+	return func(services []*registry.Service) []*registry.Service {
+		var filtered []*registry.Service
+		for _, s := range services {
+			var nodes []*registry.Node
+			for _, n := range s.Nodes {
+				if e.Matches(s, n) {
+					nodes = append(nodes, n)
+				}
+			}
+			if len(nodes) == 0 {
+				continue
+			}
+			// copy the service so we don't modify the registry cache
+			svc := *s
+			svc.Nodes = nodes
+			filtered = append(filtered, &svc)
+		}
+		return filtered
+	}
+}
@@ -0,0 +1,154 @@
+package label
+
+import (
+	"testing"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/registry/memory"
+)
+
+func TestParse(t *testing.T) {
+	valid := []string{
+		"",
+		"env=prod",
+		"env == prod",
+		"env!=prod",
+		"env in (prod, canary),version>=1.2",
+		"env notin (dev)",
+		"canary,!debug",
+		"version<2,version<=1.9,version>1",
+	}
+	for _, expr := range valid {
+		if _, err := Parse(expr); err != nil {
+			t.Errorf("expected %q to parse: %v", expr, err)
+		}
+	}
+
+	invalid := []string{
+		"env in (prod",
+		"env in prod",
+		"env in ()",
+		"=prod",
+		"env prod",
+		"a,,b",
+	}
+	for _, expr := range invalid {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("expected %q not to parse", expr)
+		}
+	}
+
+	// values are split off at the first operator only
+	values := []struct {
+		expr  string
+		key   string
+		op    operator
+		value string
+	}{
+		{"token=a=b", "token", opEquals, "a=b"},
+		{"query == a!=b", "query", opEquals, "a!=b"},
+		{"url!=http://host?a=1", "url", opNotEquals, "http://host?a=1"},
+		{"range>=1<=2", "range", opGreaterEq, "1<=2"},
+	}
+	for _, d := range values {
+		e, err := Parse(d.expr)
+		if err != nil {
+			t.Fatalf("expected %q to parse: %v", d.expr, err)
+		}
+		if len(e) != 1 || e[0].key != d.key || e[0].op != d.op || len(e[0].values) != 1 || e[0].values[0] != d.value {
+			t.Fatalf("unexpected requirement %+v parsed from %q", e, d.expr)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	service := &registry.Service{
+		Name:     "foo",
+		Version:  "1.2.3",
+		Metadata: map[string]string{"team": "payments"},
+	}
+	node := &registry.Node{
+		Id:       "1",
+		Metadata: map[string]string{"env": "canary"},
+	}
+
+	data := []struct {
+		expr  string
+		match bool
+	}{
+		{"env=canary", true},
+		{"env=prod", false},
+		{"env!=prod", true},
+		{"zone!=a", true},
+		{"env in (prod,canary)", true},
+		{"env notin (prod,canary)", false},
+		{"zone notin (a)", true},
+		{"env", true},
+		{"!env", false},
+		{"!zone", true},
+		{"team=payments", true},
+		{"version>=1.2", true},
+		{"version>=v1.3", false},
+		{"version<2", true},
+		{"version<=1.2.3", true},
+		{"version>1.2.3", false},
+		{"env>1", false},
+		{"env=canary,version>=1.2,team in (payments)", true},
+		{"env=canary,version>=2", false},
+	}
+
+	for _, d := range data {
+		e, err := Parse(d.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := e.Matches(service, node); m != d.match {
+			t.Errorf("expected %q to match %v, got %v", d.expr, d.match, m)
+		}
+	}
+}
+
+func TestExprSelector(t *testing.T) {
+	r := memory.NewRegistry()
+	r.Register(&registry.Service{
+		Name:    "foo",
+		Version: "1.0.0",
+		Nodes: []*registry.Node{
+			{Id: "1", Metadata: map[string]string{"env": "prod"}},
+			{Id: "2", Metadata: map[string]string{"env": "dev"}},
+		},
+	})
+	r.Register(&registry.Service{
+		Name:    "foo",
+		Version: "1.2.0",
+		Nodes: []*registry.Node{
+			{Id: "3", Metadata: map[string]string{"env": "canary"}},
+		},
+	})
+
+	ls := NewSelector(selector.Registry(r), Require("env notin (dev)"))
+
+	var opts client.CallOptions
+	Match("version>=1.2")(&opts)
+
+	next, err := ls.Select("foo", opts.SelectOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		node, err := next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if node.Id != "3" {
+			t.Fatalf("expected node 3, got %s", node.Id)
+		}
+	}
+
+	ls = NewSelector(selector.Registry(r), Require("env in (prod"))
+	if _, err := ls.Select("foo"); err == nil {
+		t.Fatal("expected the invalid expression to fail the select")
+	}
+}
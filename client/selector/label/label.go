@@ -7,6 +7,7 @@ import (
 
 	"github.com/micro/go-micro/v2/client/selector"
 	"github.com/micro/go-micro/v2/config/cmd"
+	log "github.com/micro/go-micro/v2/logger"
 	"github.com/micro/go-micro/v2/registry"
 )
 
@@ -16,10 +17,16 @@ import (
    nodes are still returned. The priority based label selector is useful for such things
    as rudimentary AZ based routing where requests made to other services should remain
    in the same AZ.
+
+   Nodes can be filtered by expressions on their metadata as well, for every call with
+   Require or per call with Match, e.g "env in (prod,canary),version>=1.2".
 */
 
 type labelSelector struct {
 	so selector.Options
+	// required of every node and the error parsing it
+	expr Expr
+	err  error
 }
 
 func init() {
@@ -82,11 +89,27 @@ func next(nodes []*registry.Node) func() (*registry.Node, error) {
 	}
 }
 
+// configure parses the required expressions
+func (r *labelSelector) configure() error {
+	r.expr, r.err = nil, nil
+
+	exprs, _ := r.so.Context.Value(requireKey{}).([]string)
+	for _, expr := range exprs {
+		e, err := Parse(expr)
+		if err != nil {
+			r.err = err
+			return err
+		}
+		r.expr = append(r.expr, e...)
+	}
+	return nil
+}
+
 func (r *labelSelector) Init(opts ...selector.Option) error {
 	for _, o := range opts {
 		o(&r.so)
 	}
-	return nil
+	return r.configure()
 }
 
 func (r *labelSelector) Options() selector.Options {
@@ -99,12 +122,22 @@ func (r *labelSelector) Select(service string, opts ...selector.SelectOption) (s
 		opt(&sopts)
 	}
 
+	// an invalid expression finds no node
+	if r.err != nil {
+		return nil, r.err
+	}
+
 	// get the service
 	services, err := r.so.Registry.GetService(service)
 	if err != nil {
 		return nil, err
 	}
 
+	// keep the nodes meeting the requirements
+	if len(r.expr) > 0 {
+		services = r.expr.Filter()(services)
+	}
+
 	// apply the filters
 	for _, filter := range sopts.Filters {
 		services = filter(services)
@@ -165,5 +198,9 @@ func NewSelector(opts ...selector.Option) selector.Selector {
 		opt(&sopts)
 	}
 
-	return &labelSelector{sopts}
+	ls := &labelSelector{so: sopts}
+	if err := ls.configure(); err != nil {
+		log.Errorf("[label] %v", err)
+	}
+	return ls
 }
@@ -3,7 +3,10 @@ package label
 import (
 	"context"
 
+	"github.com/micro/go-micro/v2/client"
 	"github.com/micro/go-micro/v2/client/selector"
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/registry"
 )
 
 type labelKey struct{}
@@ -24,3 +27,39 @@ func Label(k, v string) selector.Option {
 		o.Context = context.WithValue(o.Context, labelKey{}, l)
 	}
 }
+
+type requireKey struct{}
+
+// Require keeps the nodes matching the expression for every call, e.g "env in (prod,canary)"
+func Require(expr string) selector.Option {
+	return func(o *selector.Options) {
+		r, ok := o.Context.Value(requireKey{}).([]string)
+		if !ok {
+			r = []string{}
+		}
+		r = append(r, expr)
+		o.Context = context.WithValue(o.Context, requireKey{}, r)
+	}
+}
+
+// NewFilter returns a selector filter keeping the nodes matching the expression
+func NewFilter(expr string) (selector.Filter, error) {
+	e, err := Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return e.Filter(), nil
+}
+
+// Match is a call option keeping the nodes matching the expression, e.g "version>=1.2".
+// Calls with an invalid expression find no node
+func Match(expr string) client.CallOption {
+	filter, err := NewFilter(expr)
+	if err != nil {
+		log.Errorf("[label] %v", err)
+		filter = func([]*registry.Service) []*registry.Service {
+			return nil
+		}
+	}
+	return client.WithSelectOption(selector.WithFilter(filter))
+}
@@ -0,0 +1,291 @@
+// Package latency is a selector sending calls to the nodes responding fastest
+package latency
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/config/cmd"
+	"github.com/micro/go-micro/v2/errors"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+/*
+	The latency and error rate of each node are tracked as exponentially weighted
+	moving averages decaying over time. Each call gets its own copy of the node, so
+	the client marking that copy ends the very call it was returned for, however the
+	calls in flight to the node finish. Only transport errors, timeouts and 5xx
+	errors count against the node, an application error still is a valid sample.
+	Calls never marked are dropped after a while not to count in flight forever.
+
+	Calls go to the node of the lowest cost, its latency times the calls in flight to
+	it plus one, divided by its success rate. Slow or failing nodes shed traffic, and
+	as their averages decay while idle they're tried again once in a while. Nodes
+	without a call yet are assumed to be as fast as the average node and win ties.
+*/
+
+var (
+	// DefaultDecay is the time constant of the moving averages without Decay
+	DefaultDecay = 10 * time.Second
+
+	// calls in flight for longer are taken as never marked
+	abandoned = 10 * time.Minute
+)
+
+// stats of a node
+type stats struct {
+	// moving averages of the latency in seconds and of the error rate
+	latency float64
+	errors  float64
+	// when the averages were last updated, zero before the first call ended
+	last time.Time
+	// starts of the calls in flight keyed by the node returned for them
+	starts map[*registry.Node]time.Time
+}
+
+type latencySelector struct {
+	so selector.Options
+	selector.Selector
+
+	sync.Mutex
+	decay time.Duration
+	// stats keyed by service and node id
+	stats map[string]map[string]*stats
+}
+
+func init() {
+	cmd.DefaultSelectors["latency"] = NewSelector
+}
+
+// weight returns the weight of the average against a new sample after the time passed
+func (s *latencySelector) weight(d time.Duration) float64 {
+	return math.Exp(-float64(d) / float64(s.decay))
+}
+
+// get returns the stats of the node, the caller holds the lock
+func (s *latencySelector) get(service, id string) *stats {
+	nodes, ok := s.stats[service]
+	if !ok {
+		nodes = make(map[string]*stats)
+		s.stats[service] = nodes
+	}
+	st, ok := nodes[id]
+	if !ok {
+		st = &stats{starts: make(map[*registry.Node]time.Time)}
+		nodes[id] = st
+	}
+	return st
+}
+
+// cost of a node, the caller holds the lock
+func (s *latencySelector) cost(st *stats, avg float64, now time.Time) float64 {
+	latency, errors := avg, 0.0
+	if !st.last.IsZero() {
+		// the averages decay towards none while the node is idle
+		w := s.weight(now.Sub(st.last))
+		latency, errors = st.latency*w, st.errors*w
+	}
+	// a floor keeps the calls in flight counting before any call ended
+	latency = math.Max(latency, 1e-6)
+	success := math.Max(1-errors, 0.01)
+	return latency * float64(len(st.starts)+1) / success
+}
+
+func (s *latencySelector) next(service string, services []*registry.Service) selector.Next {
+	var nodes []*registry.Node
+	for _, svc := range services {
+		nodes = append(nodes, svc.Nodes...)
+	}
+	// break ties at random
+	rand.Shuffle(len(nodes), func(i, j int) {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	})
+
+	// forget the calls never marked and the nodes which are gone
+	s.Lock()
+	ids := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		ids[n.Id] = true
+	}
+	now := time.Now()
+	for id, st := range s.stats[service] {
+		for n, start := range st.starts {
+			if now.Sub(start) > abandoned {
+				delete(st.starts, n)
+			}
+		}
+		if !ids[id] && len(st.starts) == 0 {
+			delete(s.stats[service], id)
+		}
+	}
+	s.Unlock()
+
+	tried := make(map[string]bool, len(nodes))
+
+	return func() (*registry.Node, error) {
+		s.Lock()
+		defer s.Unlock()
+
+		now := time.Now()
+
+		// the average latency of the nodes with calls
+		var sum float64
+		var count int
+		for _, n := range nodes {
+			if st := s.get(service, n.Id); !st.last.IsZero() {
+				sum += st.latency * s.weight(now.Sub(st.last))
+				count++
+			}
+		}
+		var avg float64
+		if count > 0 {
+			avg = sum / float64(count)
+		}
+
+		var best *registry.Node
+		var min float64
+		for _, n := range nodes {
+			if tried[n.Id] {
+				continue
+			}
+			st := s.get(service, n.Id)
+			c := s.cost(st, avg, now)
+			// nodes without a call yet win ties to be measured
+			if best == nil || c < min || (c == min && st.last.IsZero()) {
+				best, min = n, c
+			}
+		}
+
+		if best == nil {
+			return nil, selector.ErrNoneAvailable
+		}
+
+		tried[best.Id] = true
+		// the copy identifies the call when marked
+		node := *best
+		s.get(service, best.Id).starts[&node] = now
+		return &node, nil
+	}
+}
+
+// Explain tells the averages of the node
+func (s *latencySelector) Explain(service string, node *registry.Node) string {
+	s.Lock()
+	defer s.Unlock()
+
+	st, ok := s.stats[service][node.Id]
+	if !ok || st.last.IsZero() {
+		return "no calls ended yet"
+	}
+	w := s.weight(time.Since(st.last))
+	latency := time.Duration(st.latency * w * float64(time.Second))
+	return fmt.Sprintf("latency %v, errors %.0f%%, %d calls in flight", latency, st.errors*w*100, len(st.starts))
+}
+
+func (s *latencySelector) Init(opts ...selector.Option) error {
+	for _, o := range opts {
+		o(&s.so)
+	}
+	s.configure()
+	return s.Selector.Init(opts...)
+}
+
+func (s *latencySelector) configure() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.decay = DefaultDecay
+	if d, ok := s.so.Context.Value(decayKey{}).(time.Duration); ok && d > 0 {
+		s.decay = d
+	}
+}
+
+func (s *latencySelector) Options() selector.Options {
+	return s.so
+}
+
+func (s *latencySelector) Select(service string, opts ...selector.SelectOption) (selector.Next, error) {
+	strategy := func(services []*registry.Service) selector.Next {
+		return s.next(service, services)
+	}
+	return s.Selector.Select(service, append(opts, selector.WithStrategy(strategy))...)
+}
+
+// failed tells if the error is the node's fault rather than the application's
+func failed(err error) bool {
+	if err == nil {
+		return false
+	}
+	e := errors.Parse(err.Error())
+	return e.Code == 0 || e.Code == 408 || e.Code >= 500
+}
+
+// Mark ends the call the node was returned for, updating its averages
+func (s *latencySelector) Mark(service string, node *registry.Node, err error) {
+	s.Lock()
+	if st, ok := s.stats[service][node.Id]; ok {
+		if start, ok := st.starts[node]; ok {
+			s.sample(st, start, failed(err))
+			delete(st.starts, node)
+		}
+	}
+	s.Unlock()
+
+	s.Selector.Mark(service, node, err)
+}
+
+// sample adds a call to the averages of the node, the caller holds the lock
+func (s *latencySelector) sample(st *stats, start time.Time, fail bool) {
+	now := time.Now()
+	sample := now.Sub(start).Seconds()
+
+	var failed float64
+	if fail {
+		failed = 1
+	}
+
+	if st.last.IsZero() {
+		st.latency, st.errors = sample, failed
+	} else {
+		w := s.weight(now.Sub(st.last))
+		st.latency = st.latency*w + sample*(1-w)
+		st.errors = st.errors*w + failed*(1-w)
+	}
+	st.last = now
+}
+
+func (s *latencySelector) Reset(service string) {
+	s.Lock()
+	delete(s.stats, service)
+	s.Unlock()
+
+	s.Selector.Reset(service)
+}
+
+func (s *latencySelector) String() string {
+	return "latency"
+}
+
+func NewSelector(opts ...selector.Option) selector.Selector {
+	sopts := selector.Options{
+		Context:  context.TODO(),
+		Registry: registry.DefaultRegistry,
+	}
+
+	for _, opt := range opts {
+		opt(&sopts)
+	}
+
+	s := &latencySelector{
+		so:       sopts,
+		Selector: selector.NewSelector(opts...),
+		stats:    make(map[string]map[string]*stats),
+	}
+	s.configure()
+	return s
+}
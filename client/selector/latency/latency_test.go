@@ -0,0 +1,176 @@
+package latency
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	merrors "github.com/micro/go-micro/v2/errors"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/registry/memory"
+)
+
+func newSelector(t *testing.T, opts ...selector.Option) selector.Selector {
+	r := memory.NewRegistry()
+	err := r.Register(&registry.Service{
+		Name: "foo",
+		Nodes: []*registry.Node{
+			{Id: "fast"},
+			{Id: "slow"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSelector(append(opts, selector.Registry(r))...)
+}
+
+// call selects a node and marks the call after the latency of the node
+func call(t *testing.T, s selector.Selector, latency map[string]time.Duration, errs map[string]error) string {
+	t.Helper()
+	next, err := s.Select("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(latency[n.Id])
+	s.Mark("foo", n, errs[n.Id])
+	return n.Id
+}
+
+func TestLatency(t *testing.T) {
+	s := newSelector(t)
+	latency := map[string]time.Duration{
+		"fast": time.Millisecond,
+		"slow": 20 * time.Millisecond,
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 40; i++ {
+		counts[call(t, s, latency, nil)]++
+	}
+	if counts["slow"] > 2 {
+		t.Fatalf("expected the slow node to shed the calls, got %v", counts)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s := newSelector(t)
+	latency := map[string]time.Duration{
+		"fast": time.Millisecond,
+		"slow": 3 * time.Millisecond,
+	}
+	errs := map[string]error{
+		"fast": errors.New("failed"),
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 40; i++ {
+		counts[call(t, s, latency, errs)]++
+	}
+	if counts["fast"] > 4 {
+		t.Fatalf("expected the failing node to shed the calls, got %v", counts)
+	}
+}
+
+func TestApplicationErrors(t *testing.T) {
+	s := newSelector(t)
+	latency := map[string]time.Duration{
+		"fast": time.Millisecond,
+		"slow": 20 * time.Millisecond,
+	}
+	errs := map[string]error{
+		"fast": merrors.BadRequest("foo", "invalid"),
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 40; i++ {
+		counts[call(t, s, latency, errs)]++
+	}
+	if counts["slow"] > 2 {
+		t.Fatalf("expected application errors not to count, got %v", counts)
+	}
+}
+
+func TestMarkCall(t *testing.T) {
+	r := memory.NewRegistry()
+	if err := r.Register(&registry.Service{Name: "bar", Nodes: []*registry.Node{{Id: "only"}}}); err != nil {
+		t.Fatal(err)
+	}
+	s := NewSelector(selector.Registry(r))
+
+	// two calls in flight to the same node, the later ending first
+	next, _ := s.Select("bar")
+	first, _ := next()
+	time.Sleep(20 * time.Millisecond)
+	next, _ = s.Select("bar")
+	second, _ := next()
+	s.Mark("bar", second, nil)
+
+	ls := s.(*latencySelector)
+	ls.Lock()
+	st := ls.stats["bar"]["only"]
+	latency, inFlight := st.latency, len(st.starts)
+	ls.Unlock()
+	if latency > 0.01 {
+		t.Fatalf("expected the latency of the later call, got %vs", latency)
+	}
+	if inFlight != 1 {
+		t.Fatalf("expected the first call in flight, got %d calls", inFlight)
+	}
+
+	// the slower first call raises the average
+	s.Mark("bar", first, nil)
+	ls.Lock()
+	after, inFlight := st.latency, len(st.starts)
+	ls.Unlock()
+	if after <= latency || inFlight != 0 {
+		t.Fatalf("expected the first call to end, got %vs with %d calls", after, inFlight)
+	}
+}
+
+func TestDecay(t *testing.T) {
+	s := newSelector(t, Decay(10*time.Millisecond))
+	latency := map[string]time.Duration{
+		"slow": 20 * time.Millisecond,
+	}
+
+	for i := 0; i < 4; i++ {
+		call(t, s, latency, nil)
+	}
+
+	// the slow node is tried again once idle for a while
+	time.Sleep(100 * time.Millisecond)
+	seen := make(map[string]bool)
+	for i := 0; i < 10; i++ {
+		seen[call(t, s, nil, nil)] = true
+	}
+	if !seen["slow"] {
+		t.Fatal("expected the slow node to be tried again")
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	s := newSelector(t)
+
+	// calls in flight are spread before any call ended
+	next, _ := s.Select("foo")
+	first, _ := next()
+	next, _ = s.Select("foo")
+	second, _ := next()
+	if first.Id == second.Id {
+		t.Fatalf("expected the calls in flight on both nodes, got %s twice", first.Id)
+	}
+
+	// retries go to the other node
+	next, _ = s.Select("foo")
+	next()
+	next()
+	if _, err := next(); err != selector.ErrNoneAvailable {
+		t.Fatalf("expected %v, got %v", selector.ErrNoneAvailable, err)
+	}
+}
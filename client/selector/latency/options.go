@@ -0,0 +1,21 @@
+package latency
+
+import (
+	"context"
+	"time"
+
+	"github.com/micro/go-micro/v2/client/selector"
+)
+
+type decayKey struct{}
+
+// Decay sets the time constant of the moving averages, samples older than the decay
+// weigh about a third of a new one
+func Decay(d time.Duration) selector.Option {
+	return func(o *selector.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, decayKey{}, d)
+	}
+}
@@ -0,0 +1,53 @@
+package outlier
+
+import (
+	"context"
+	"time"
+
+	"github.com/micro/go-micro/v2/client/selector"
+)
+
+type thresholdKey struct{}
+type windowKey struct{}
+type backoffKey struct{}
+type maxBackoffKey struct{}
+type rampKey struct{}
+type maxEjectedKey struct{}
+
+func setOption(k, v interface{}) selector.Option {
+	return func(o *selector.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// Threshold sets the failed calls within the window ejecting a node
+func Threshold(n int) selector.Option {
+	return setOption(thresholdKey{}, n)
+}
+
+// Window sets the time the failed calls are counted over
+func Window(d time.Duration) selector.Option {
+	return setOption(windowKey{}, d)
+}
+
+// Backoff sets how long a node is ejected the first time, doubling with every
+// ejection up to the max backoff
+func Backoff(d, max time.Duration) selector.Option {
+	return func(o *selector.Options) {
+		setOption(backoffKey{}, d)(o)
+		setOption(maxBackoffKey{}, max)(o)
+	}
+}
+
+// Ramp sets how long an ejected node takes to get its full share of calls again
+func Ramp(d time.Duration) selector.Option {
+	return setOption(rampKey{}, d)
+}
+
+// MaxEjected sets the share of the nodes of a service which may be ejected at once
+func MaxEjected(f float64) selector.Option {
+	return setOption(maxEjectedKey{}, f)
+}
@@ -0,0 +1,301 @@
+// Package outlier is a selector ejecting nodes whose calls keep failing
+package outlier
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/config/cmd"
+	"github.com/micro/go-micro/v2/errors"
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+/*
+	Passive health checking on top of the registry selector. The calls marked failed
+	are counted per node, a node failing the threshold within the window is ejected
+	and left out of the nodes of its service. The ejection lasts the backoff, doubled
+	with every ejection in a row, after which the node is readmitted over the ramp:
+	its share of calls grows from none to full, so a node which is still half dead
+	fails few calls before being ejected again.
+
+	Only failures of the node count: transport errors, timeouts and 5xx errors.
+	Errors the handler returns to the caller, such as a 404 or a bad request, say
+	nothing about the health of the node.
+
+	No more than the max share of the nodes of a service is ejected at once, and if
+	every node would be left out they're all kept, the registry remains the judge of
+	which nodes exist.
+*/
+
+var (
+	// DefaultThreshold is the failed calls ejecting a node without Threshold
+	DefaultThreshold = 5
+	// DefaultWindow is the time failed calls are counted over without Window
+	DefaultWindow = 10 * time.Second
+	// DefaultBackoff is the first ejection without Backoff
+	DefaultBackoff = 30 * time.Second
+	// DefaultMaxBackoff is the longest ejection without Backoff
+	DefaultMaxBackoff = 5 * time.Minute
+	// DefaultRamp is the readmission without Ramp
+	DefaultRamp = 30 * time.Second
+	// DefaultMaxEjected is the share of nodes ejected at most without MaxEjected
+	DefaultMaxEjected = 0.5
+)
+
+// health of a node
+type health struct {
+	// failed calls within the window
+	failures []time.Time
+	// ejections in a row
+	ejections int
+	// the node is ejected until readmitted
+	readmitted time.Time
+}
+
+type outlierSelector struct {
+	so selector.Options
+	selector.Selector
+
+	sync.Mutex
+	threshold  int
+	window     time.Duration
+	backoff    time.Duration
+	maxBackoff time.Duration
+	ramp       time.Duration
+	maxEjected float64
+	// health keyed by service and node id
+	health map[string]map[string]*health
+	// nodes last seen keyed by service
+	nodes map[string]int
+}
+
+func init() {
+	cmd.DefaultSelectors["outlier"] = NewSelector
+}
+
+func (s *outlierSelector) configure() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.threshold = DefaultThreshold
+	if n, ok := s.so.Context.Value(thresholdKey{}).(int); ok && n > 0 {
+		s.threshold = n
+	}
+	s.window = DefaultWindow
+	if d, ok := s.so.Context.Value(windowKey{}).(time.Duration); ok && d > 0 {
+		s.window = d
+	}
+	s.backoff = DefaultBackoff
+	if d, ok := s.so.Context.Value(backoffKey{}).(time.Duration); ok && d > 0 {
+		s.backoff = d
+	}
+	s.maxBackoff = DefaultMaxBackoff
+	if d, ok := s.so.Context.Value(maxBackoffKey{}).(time.Duration); ok && d > 0 {
+		s.maxBackoff = d
+	}
+	s.ramp = DefaultRamp
+	if d, ok := s.so.Context.Value(rampKey{}).(time.Duration); ok && d >= 0 {
+		s.ramp = d
+	}
+	s.maxEjected = DefaultMaxEjected
+	if f, ok := s.so.Context.Value(maxEjectedKey{}).(float64); ok && f >= 0 {
+		s.maxEjected = f
+	}
+}
+
+// ejected returns the nodes of the service ejected at the time, the caller holds the lock
+func (s *outlierSelector) ejected(service string, now time.Time) int {
+	var n int
+	for _, h := range s.health[service] {
+		if h.readmitted.After(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// keep returns whether the node gets the call, the caller holds the lock
+func (s *outlierSelector) keep(h *health, now time.Time) bool {
+	switch {
+	case h == nil || h.readmitted.IsZero():
+		return true
+	case h.readmitted.After(now):
+		return false
+	case s.ramp > 0 && now.Sub(h.readmitted) < s.ramp:
+		// the share of calls grows over the ramp
+		return rand.Float64() < float64(now.Sub(h.readmitted))/float64(s.ramp)
+	}
+	return true
+}
+
+// filter leaves out the nodes ejected
+func (s *outlierSelector) filter(service string) selector.Filter {
+	return func(services []*registry.Service) []*registry.Service {
+		s.Lock()
+		defer s.Unlock()
+
+		now := time.Now()
+		ids := make(map[string]bool)
+
+		var filtered []*registry.Service
+		for _, svc := range services {
+			var nodes []*registry.Node
+			for _, n := range svc.Nodes {
+				ids[n.Id] = true
+				if s.keep(s.health[service][n.Id], now) {
+					nodes = append(nodes, n)
+				}
+			}
+			if len(nodes) == 0 {
+				continue
+			}
+			// copy the service so we don't modify the registry cache
+			cp := *svc
+			cp.Nodes = nodes
+			filtered = append(filtered, &cp)
+		}
+
+		// forget the nodes which are gone
+		s.nodes[service] = len(ids)
+		for id := range s.health[service] {
+			if !ids[id] {
+				delete(s.health[service], id)
+			}
+		}
+
+		// every node left out, keep them all
+		if len(filtered) == 0 {
+			return services
+		}
+		return filtered
+	}
+}
+
+func (s *outlierSelector) Init(opts ...selector.Option) error {
+	for _, o := range opts {
+		o(&s.so)
+	}
+	s.configure()
+	return s.Selector.Init(opts...)
+}
+
+func (s *outlierSelector) Options() selector.Options {
+	return s.so
+}
+
+func (s *outlierSelector) Select(service string, opts ...selector.SelectOption) (selector.Next, error) {
+	// ejected nodes are left out before any other filter
+	opts = append([]selector.SelectOption{selector.WithFilter(s.filter(service))}, opts...)
+	return s.Selector.Select(service, opts...)
+}
+
+// Mark counts the failed calls of the node, ejecting it past the threshold
+// failed returns whether the error is a failure of the node rather than of the call
+func failed(err error) bool {
+	if err == nil {
+		return false
+	}
+	// errors which aren't micro errors come from the transport
+	e := errors.Parse(err.Error())
+	return e.Code == 0 || e.Code == 408 || e.Code >= 500
+}
+
+func (s *outlierSelector) Mark(service string, node *registry.Node, err error) {
+	defer s.Selector.Mark(service, node, err)
+
+	if !failed(err) {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+
+	if s.health[service] == nil {
+		s.health[service] = make(map[string]*health)
+	}
+	h, ok := s.health[service][node.Id]
+	if !ok {
+		h = new(health)
+		s.health[service][node.Id] = h
+	}
+
+	// already ejected, calls in flight may still fail
+	if h.readmitted.After(now) {
+		return
+	}
+
+	var failures []time.Time
+	for _, t := range h.failures {
+		if now.Sub(t) < s.window {
+			failures = append(failures, t)
+		}
+	}
+	h.failures = append(failures, now)
+
+	if len(h.failures) < s.threshold {
+		return
+	}
+
+	// keep enough nodes for the calls
+	if float64(s.ejected(service, now)+1) > s.maxEjected*float64(s.nodes[service]) {
+		log.Debugf("[outlier] not ejecting %s of %s, too many nodes ejected", node.Id, service)
+		return
+	}
+
+	// the node behaved since its last readmission, start over
+	if !h.readmitted.IsZero() && now.Sub(h.readmitted) > s.maxBackoff {
+		h.ejections = 0
+	}
+
+	backoff := s.backoff
+	for i := 0; i < h.ejections && backoff < s.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > s.maxBackoff {
+		backoff = s.maxBackoff
+	}
+
+	h.ejections++
+	h.failures = nil
+	h.readmitted = now.Add(backoff)
+
+	log.Infof("[outlier] ejected %s of %s for %v after %d failed calls", node.Id, service, backoff, s.threshold)
+}
+
+func (s *outlierSelector) Reset(service string) {
+	s.Lock()
+	delete(s.health, service)
+	s.Unlock()
+
+	s.Selector.Reset(service)
+}
+
+func (s *outlierSelector) String() string {
+	return "outlier"
+}
+
+func NewSelector(opts ...selector.Option) selector.Selector {
+	sopts := selector.Options{
+		Context:  context.TODO(),
+		Registry: registry.DefaultRegistry,
+	}
+
+	for _, opt := range opts {
+		opt(&sopts)
+	}
+
+	s := &outlierSelector{
+		so:       sopts,
+		Selector: selector.NewSelector(opts...),
+		health:   make(map[string]map[string]*health),
+		nodes:    make(map[string]int),
+	}
+	s.configure()
+	return s
+}
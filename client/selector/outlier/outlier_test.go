@@ -0,0 +1,143 @@
+package outlier
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	merrors "github.com/micro/go-micro/v2/errors"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/registry/memory"
+)
+
+var errFailed = errors.New("failed")
+
+func newSelector(t *testing.T, opts ...selector.Option) selector.Selector {
+	r := memory.NewRegistry()
+	err := r.Register(&registry.Service{
+		Name: "foo",
+		Nodes: []*registry.Node{
+			{Id: "1"},
+			{Id: "2"},
+			{Id: "3"},
+			{Id: "4"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSelector(append(opts, selector.Registry(r))...)
+}
+
+// selected returns the nodes selected by a number of calls
+func selected(t *testing.T, s selector.Selector, calls int) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	for i := 0; i < calls; i++ {
+		next, err := s.Select("foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[n.Id]++
+	}
+	return counts
+}
+
+func TestEject(t *testing.T) {
+	s := newSelector(t,
+		Threshold(3),
+		Backoff(50*time.Millisecond, time.Second),
+		Ramp(0),
+	)
+	selected(t, s, 1)
+
+	node := &registry.Node{Id: "1"}
+	s.Mark("foo", node, errFailed)
+	s.Mark("foo", node, errFailed)
+	if counts := selected(t, s, 100); counts["1"] == 0 {
+		t.Fatal("expected the node to be kept below the threshold")
+	}
+
+	s.Mark("foo", node, errFailed)
+	if counts := selected(t, s, 100); counts["1"] > 0 {
+		t.Fatalf("expected the node to be ejected, got %v", counts)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if counts := selected(t, s, 100); counts["1"] == 0 {
+		t.Fatal("expected the node to be readmitted")
+	}
+
+	// ejected again for twice as long
+	for i := 0; i < 3; i++ {
+		s.Mark("foo", node, errFailed)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if counts := selected(t, s, 100); counts["1"] > 0 {
+		t.Fatalf("expected the node to be ejected for longer, got %v", counts)
+	}
+}
+
+func TestMaxEjected(t *testing.T) {
+	s := newSelector(t, Threshold(1), MaxEjected(0.5))
+	selected(t, s, 1)
+
+	for _, id := range []string{"1", "2", "3", "4"} {
+		s.Mark("foo", &registry.Node{Id: id}, errFailed)
+	}
+
+	counts := selected(t, s, 100)
+	if len(counts) != 2 {
+		t.Fatalf("expected half the nodes ejected, got %v", counts)
+	}
+}
+
+func TestRamp(t *testing.T) {
+	s := newSelector(t,
+		Threshold(1),
+		Backoff(time.Millisecond, time.Millisecond),
+		Ramp(time.Hour),
+	)
+	selected(t, s, 1)
+
+	s.Mark("foo", &registry.Node{Id: "1"}, errFailed)
+	time.Sleep(5 * time.Millisecond)
+
+	// readmitted but only just
+	if counts := selected(t, s, 400); counts["1"] > 5 {
+		t.Fatalf("expected the node to get few calls while ramping up, got %v", counts)
+	}
+}
+
+func TestFailed(t *testing.T) {
+	testData := []struct {
+		err    error
+		failed bool
+	}{
+		{nil, false},
+		{errFailed, true},
+		{merrors.Timeout("foo", "timed out"), true},
+		{merrors.InternalServerError("foo", "panic"), true},
+		{merrors.New("foo", "unavailable", 503), true},
+		{merrors.NotFound("foo", "no such user"), false},
+		{merrors.BadRequest("foo", "invalid id"), false},
+	}
+
+	for _, d := range testData {
+		if f := failed(d.err); f != d.failed {
+			t.Fatalf("expected %v to fail the node %v, got %v", d.err, d.failed, f)
+		}
+	}
+
+	// application errors never eject the node
+	s := newSelector(t, Threshold(1), Ramp(0))
+	s.Mark("foo", &registry.Node{Id: "1"}, merrors.NotFound("foo", "no such user"))
+	if counts := selected(t, s, 100); counts["1"] == 0 {
+		t.Fatal("expected the node to be kept")
+	}
+}
@@ -0,0 +1,88 @@
+// Package partition routes calls by a partition key modulo the nodes of a service
+package partition
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+/*
+	For services partitioning their state by tenant or user, the nodes are ordered by
+	id, the same on every client, and a key is routed to the node at the key modulo
+	the number of nodes. Numeric keys are used as they are, so tenant 7 of 4 nodes
+	lands on the fourth, other keys are hashed. Unlike the consistent hashing of the
+	shard and ringhash selectors most keys move when the nodes change, services are
+	expected to rebalance their partitions then.
+
+	Retries go to the next nodes in order.
+*/
+
+// index returns the position of the key in nodes
+func index(key string, nodes int) int {
+	if n, err := strconv.ParseUint(key, 10, 64); err == nil {
+		return int(n % uint64(nodes))
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return int(h.Sum64() % uint64(nodes))
+}
+
+// Next returns the node of the key followed by the next nodes in order
+func Next(key string, services []*registry.Service) selector.Next {
+	var nodes []*registry.Node
+	seen := make(map[string]bool)
+	for _, s := range services {
+		for _, n := range s.Nodes {
+			if seen[n.Id] {
+				continue
+			}
+			seen[n.Id] = true
+			nodes = append(nodes, n)
+		}
+	}
+
+	// the same order on every client
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Id < nodes[j].Id
+	})
+
+	var i, tries int
+	var mtx sync.Mutex
+	if len(nodes) > 0 {
+		i = index(key, len(nodes))
+	}
+
+	return func() (*registry.Node, error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		if tries >= len(nodes) {
+			return nil, selector.ErrNoneAvailable
+		}
+		node := nodes[(i+tries)%len(nodes)]
+		tries++
+		return node, nil
+	}
+}
+
+// NewStrategy returns a select option routing by the key
+func NewStrategy(key string) selector.SelectOption {
+	return selector.WithStrategy(func(services []*registry.Service) selector.Next {
+		return Next(key, services)
+	})
+}
+
+// Key returns a call option routing the call by the key, e.g the tenant id
+//
+// Usage:
+//
+//	`myClient.MyCall(ctx, req, partition.Key(req.TenantId))`
+func Key(key string) client.CallOption {
+	return client.WithSelectOption(NewStrategy(key))
+}
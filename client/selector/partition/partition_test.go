@@ -0,0 +1,104 @@
+package partition
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/metadata"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+var services = []*registry.Service{
+	{
+		Name:    "foo",
+		Version: "1",
+		Nodes:   []*registry.Node{{Id: "node-3"}, {Id: "node-1"}},
+	},
+	{
+		Name:    "foo",
+		Version: "2",
+		Nodes:   []*registry.Node{{Id: "node-4"}, {Id: "node-2"}},
+	},
+}
+
+func TestNext(t *testing.T) {
+	// numeric keys modulo the nodes ordered by id
+	next := Next("7", services)
+	var order []string
+	for {
+		n, err := next()
+		if err == selector.ErrNoneAvailable {
+			break
+		}
+		order = append(order, n.Id)
+	}
+	if len(order) != 4 || order[0] != "node-4" || order[1] != "node-1" || order[3] != "node-3" {
+		t.Fatalf("unexpected order %v", order)
+	}
+
+	// other keys are hashed, the same on every client
+	reversed := []*registry.Service{services[1], services[0]}
+	a, _ := Next("tenant-a", services)()
+	b, _ := Next("tenant-a", reversed)()
+	if a.Id != b.Id {
+		t.Fatalf("expected the key on the same node, got %s and %s", a.Id, b.Id)
+	}
+
+	if _, err := Next("1", nil)(); err != selector.ErrNoneAvailable {
+		t.Fatalf("expected %v, got %v", selector.ErrNoneAvailable, err)
+	}
+}
+
+type testClient struct {
+	client.Client
+	opts client.CallOptions
+}
+
+func (c *testClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	c.opts = client.CallOptions{}
+	for _, o := range opts {
+		o(&c.opts)
+	}
+	return nil
+}
+
+// selected returns the node the call options select
+func selected(t *testing.T, opts client.CallOptions) string {
+	t.Helper()
+	var sopts selector.SelectOptions
+	for _, o := range opts.SelectOptions {
+		o(&sopts)
+	}
+	if sopts.Strategy == nil {
+		return ""
+	}
+	n, err := sopts.Strategy(services)()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n.Id
+}
+
+func TestWrapper(t *testing.T) {
+	c := &testClient{}
+	w := NewClientWrapper("X-Tenant-Id")(c)
+
+	ctx := metadata.NewContext(context.Background(), metadata.Metadata{"X-Tenant-Id": "5"})
+	w.Call(ctx, nil, nil)
+	if id := selected(t, c.opts); id != "node-2" {
+		t.Fatalf("expected node-2, got %s", id)
+	}
+
+	// a key passed to the call takes precedence
+	w.Call(ctx, nil, nil, Key("6"))
+	if id := selected(t, c.opts); id != "node-3" {
+		t.Fatalf("expected node-3, got %s", id)
+	}
+
+	w.Call(context.Background(), nil, nil)
+	if id := selected(t, c.opts); len(id) > 0 {
+		t.Fatalf("expected no strategy without the header, got %s", id)
+	}
+}
@@ -0,0 +1,41 @@
+package partition
+
+import (
+	"context"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/metadata"
+)
+
+type partitionWrapper struct {
+	client.Client
+	header string
+}
+
+// options routes the request by the header, a key passed to the call takes precedence
+func (p *partitionWrapper) options(ctx context.Context, opts []client.CallOption) []client.CallOption {
+	key, ok := metadata.Get(ctx, p.header)
+	if !ok || len(key) == 0 {
+		return opts
+	}
+	return append([]client.CallOption{Key(key)}, opts...)
+}
+
+func (p *partitionWrapper) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	return p.Client.Call(ctx, req, rsp, p.options(ctx, opts)...)
+}
+
+func (p *partitionWrapper) Stream(ctx context.Context, req client.Request, opts ...client.CallOption) (client.Stream, error) {
+	return p.Client.Stream(ctx, req, p.options(ctx, opts)...)
+}
+
+// NewClientWrapper returns a client wrapper routing calls by the partition key in
+// the metadata header, e.g X-Tenant-Id
+func NewClientWrapper(header string) client.Wrapper {
+	return func(c client.Client) client.Client {
+		return &partitionWrapper{
+			Client: c,
+			header: header,
+		}
+	}
+}
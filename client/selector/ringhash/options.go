@@ -0,0 +1,53 @@
+package ringhash
+
+import (
+	"context"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/client/selector"
+)
+
+type replicasKey struct{}
+type loadFactorKey struct{}
+type hashKey struct{}
+
+// Replicas sets the number of virtual nodes placed on the ring per node
+func Replicas(n int) selector.Option {
+	return func(o *selector.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, replicasKey{}, n)
+	}
+}
+
+// LoadFactor bounds the requests in flight to a node to the factor times the average,
+// requests over the bound move on to the next node of the ring. A factor below 1
+// disables the bound
+func LoadFactor(f float64) selector.Option {
+	return func(o *selector.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, loadFactorKey{}, f)
+	}
+}
+
+// WithKey sets the key hashed onto the ring
+func WithKey(key string) selector.SelectOption {
+	return func(o *selector.SelectOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, hashKey{}, key)
+	}
+}
+
+// Key is a call option routing the request by the key, e.g the id of the entity requested
+//
+// Usage:
+//
+//	`myClient.MyCall(ctx, req, ringhash.Key(req.UserId))`
+func Key(key string) client.CallOption {
+	return client.WithSelectOption(WithKey(key))
+}
@@ -0,0 +1,101 @@
+package ringhash
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+type point struct {
+	hash uint32
+	node *registry.Node
+}
+
+// ring holds the virtual nodes of the nodes ordered by hash
+type ring struct {
+	points []point
+	nodes  []*registry.Node
+}
+
+func hash(key string) uint32 {
+	return crc32.ChecksumIEEE([]byte(key))
+}
+
+// signature identifies the nodes of the services, to tell whether a ring is still current
+func signature(services []*registry.Service) string {
+	var ids []string
+	for _, s := range services {
+		for _, n := range s.Nodes {
+			ids = append(ids, n.Id+"@"+n.Address)
+		}
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ";")
+}
+
+func newRing(services []*registry.Service, replicas int) *ring {
+	r := new(ring)
+	seen := make(map[string]bool)
+
+	for _, s := range services {
+		for _, n := range s.Nodes {
+			if seen[n.Id] {
+				continue
+			}
+			seen[n.Id] = true
+			r.nodes = append(r.nodes, n)
+
+			// the virtual nodes are placed by id, so a node keeps its place when others come and go
+			for i := 0; i < replicas; i++ {
+				r.points = append(r.points, point{hash(strconv.Itoa(i) + n.Id), n})
+			}
+		}
+	}
+
+	sort.Slice(r.points, func(i, j int) bool {
+		if r.points[i].hash == r.points[j].hash {
+			return r.points[i].node.Id < r.points[j].node.Id
+		}
+		return r.points[i].hash < r.points[j].hash
+	})
+
+	return r
+}
+
+// walk returns the nodes in the order met walking the ring clockwise from the key
+func (r *ring) walk(key string) []*registry.Node {
+	if len(r.points) == 0 {
+		return nil
+	}
+
+	h := hash(key)
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= h
+	})
+
+	nodes := make([]*registry.Node, 0, len(r.nodes))
+	seen := make(map[string]bool, len(r.nodes))
+
+	for j := 0; j < len(r.points) && len(nodes) < len(r.nodes); j++ {
+		p := r.points[(i+j)%len(r.points)]
+		if seen[p.node.Id] {
+			continue
+		}
+		seen[p.node.Id] = true
+		nodes = append(nodes, p.node)
+	}
+
+	return nodes
+}
+
+func (r *ring) has(id string) bool {
+	for _, n := range r.nodes {
+		if n.Id == id {
+			return true
+		}
+	}
+	return false
+}
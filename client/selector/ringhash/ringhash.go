@@ -0,0 +1,231 @@
+// Package ringhash is a consistent hash selector routing requests by key
+package ringhash
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/config/cmd"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+/*
+	The nodes of a service are placed on a hash ring with a number of virtual nodes
+	each. A request carrying a key is sent to the first node met walking the ring
+	from the hash of the key, so requests for the same entity reach the same node
+	and its caches stay warm. Nodes coming and going only move the keys next to
+	them on the ring.
+
+	Hot keys would overload their node, so the requests in flight to a node are
+	bounded to a factor of the average as in "Consistent Hashing with Bounded Loads".
+	Requests over the bound move on to the next node of the ring. The load is counted
+	from the node returned until the client marks the call.
+
+	Requests without a key are left to the registry selector.
+*/
+
+var (
+	// DefaultReplicas is the number of virtual nodes per node without Replicas
+	DefaultReplicas = 100
+
+	// DefaultLoadFactor bounds the load without LoadFactor
+	DefaultLoadFactor = 1.25
+)
+
+type hashSelector struct {
+	so selector.Options
+	selector.Selector
+
+	sync.Mutex
+	replicas int
+	factor   float64
+	// rings and their signature keyed by service
+	rings map[string]*ring
+	sigs  map[string]string
+	// requests in flight keyed by service and node id
+	load map[string]map[string]int
+}
+
+func init() {
+	cmd.DefaultSelectors["ringhash"] = NewSelector
+}
+
+func (s *hashSelector) configure() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.replicas = DefaultReplicas
+	if n, ok := s.so.Context.Value(replicasKey{}).(int); ok && n > 0 {
+		s.replicas = n
+	}
+	s.factor = DefaultLoadFactor
+	if f, ok := s.so.Context.Value(loadFactorKey{}).(float64); ok {
+		s.factor = f
+	}
+
+	// the rings are built again with the new settings
+	s.rings = make(map[string]*ring)
+	s.sigs = make(map[string]string)
+}
+
+// ring returns the ring of the services, built again when the nodes changed
+func (s *hashSelector) ring(service string, services []*registry.Service) *ring {
+	sig := signature(services)
+
+	s.Lock()
+	defer s.Unlock()
+
+	if r, ok := s.rings[service]; ok && s.sigs[service] == sig {
+		return r
+	}
+
+	r := newRing(services, s.replicas)
+	s.rings[service] = r
+	s.sigs[service] = sig
+
+	// forget the load of nodes which are gone
+	if load, ok := s.load[service]; ok {
+		for id := range load {
+			if !r.has(id) {
+				delete(load, id)
+			}
+		}
+	}
+
+	return r
+}
+
+// bound returns the most requests a node may have in flight, the caller holds the lock
+func (s *hashSelector) bound(service string, r *ring) int {
+	if s.factor < 1 || len(r.nodes) == 0 {
+		return math.MaxInt32
+	}
+
+	var total int
+	for _, n := range r.nodes {
+		total += s.load[service][n.Id]
+	}
+
+	// include the request being routed
+	return int(math.Ceil(float64(total+1) * s.factor / float64(len(r.nodes))))
+}
+
+// next returns the nodes of the key in ring order, skipping nodes at their bound
+func (s *hashSelector) next(service, key string, r *ring) selector.Next {
+	nodes := r.walk(key)
+	tried := make(map[string]bool, len(nodes))
+
+	return func() (*registry.Node, error) {
+		s.Lock()
+		defer s.Unlock()
+
+		bound := s.bound(service, r)
+
+		var node *registry.Node
+		for _, n := range nodes {
+			if tried[n.Id] {
+				continue
+			}
+			// every node may be at its bound after retries, use the first left
+			if node == nil {
+				node = n
+			}
+			if s.load[service][n.Id] < bound {
+				node = n
+				break
+			}
+		}
+
+		if node == nil {
+			return nil, selector.ErrNoneAvailable
+		}
+
+		tried[node.Id] = true
+		if s.load[service] == nil {
+			s.load[service] = make(map[string]int)
+		}
+		s.load[service][node.Id]++
+
+		return node, nil
+	}
+}
+
+func (s *hashSelector) Init(opts ...selector.Option) error {
+	for _, o := range opts {
+		o(&s.so)
+	}
+	s.configure()
+	return s.Selector.Init(opts...)
+}
+
+func (s *hashSelector) Options() selector.Options {
+	return s.so
+}
+
+func (s *hashSelector) Select(service string, opts ...selector.SelectOption) (selector.Next, error) {
+	var sopts selector.SelectOptions
+	for _, o := range opts {
+		o(&sopts)
+	}
+
+	if sopts.Context == nil {
+		return s.Selector.Select(service, opts...)
+	}
+	key, ok := sopts.Context.Value(hashKey{}).(string)
+	if !ok {
+		return s.Selector.Select(service, opts...)
+	}
+
+	// the registry selector resolves and filters the services, the ring is the strategy
+	strategy := func(services []*registry.Service) selector.Next {
+		return s.next(service, key, s.ring(service, services))
+	}
+
+	return s.Selector.Select(service, append(opts, selector.WithStrategy(strategy))...)
+}
+
+// Mark ends the request to the node
+func (s *hashSelector) Mark(service string, node *registry.Node, err error) {
+	s.Lock()
+	if s.load[service][node.Id] > 0 {
+		s.load[service][node.Id]--
+	}
+	s.Unlock()
+
+	s.Selector.Mark(service, node, err)
+}
+
+func (s *hashSelector) Reset(service string) {
+	s.Lock()
+	delete(s.load, service)
+	delete(s.rings, service)
+	delete(s.sigs, service)
+	s.Unlock()
+
+	s.Selector.Reset(service)
+}
+
+func (s *hashSelector) String() string {
+	return "ringhash"
+}
+
+func NewSelector(opts ...selector.Option) selector.Selector {
+	sopts := selector.Options{
+		Context:  context.TODO(),
+		Registry: registry.DefaultRegistry,
+	}
+
+	for _, opt := range opts {
+		opt(&sopts)
+	}
+
+	s := &hashSelector{
+		so:       sopts,
+		Selector: selector.NewSelector(opts...),
+		load:     make(map[string]map[string]int),
+	}
+	s.configure()
+	return s
+}
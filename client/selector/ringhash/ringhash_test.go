@@ -0,0 +1,151 @@
+package ringhash
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/registry/memory"
+)
+
+func newService(ids ...string) *registry.Service {
+	s := &registry.Service{Name: "foo", Version: "latest"}
+	for _, id := range ids {
+		s.Nodes = append(s.Nodes, &registry.Node{Id: id, Address: id + ":8080"})
+	}
+	return s
+}
+
+func TestRing(t *testing.T) {
+	r := newRing([]*registry.Service{newService("1", "2", "3")}, DefaultReplicas)
+
+	counts := make(map[string]int)
+	owners := make(map[string]string)
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		nodes := r.walk(key)
+		if len(nodes) != 3 {
+			t.Fatalf("expected every node once, got %d", len(nodes))
+		}
+		counts[nodes[0].Id]++
+		owners[key] = nodes[0].Id
+	}
+	for id, n := range counts {
+		if n < 600 || n > 1400 {
+			t.Errorf("node %s got %d of 3000 keys", id, n)
+		}
+	}
+
+	// a new node only takes keys from the others
+	r = newRing([]*registry.Service{newService("1", "2", "3", "4")}, DefaultReplicas)
+	var moved int
+	for key, owner := range owners {
+		if id := r.walk(key)[0].Id; id != owner {
+			if id != "4" {
+				t.Fatalf("key %s moved from %s to %s", key, owner, id)
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > 1500 {
+		t.Errorf("expected about a quarter of the keys to move, %d did", moved)
+	}
+}
+
+func TestSelector(t *testing.T) {
+	r := memory.NewRegistry()
+	if err := r.Register(newService("1", "2", "3")); err != nil {
+		t.Fatal(err)
+	}
+	s := NewSelector(selector.Registry(r))
+
+	next, err := s.Select("foo", WithKey("user-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Mark("foo", first, nil)
+
+	for i := 0; i < 10; i++ {
+		next, err := s.Select("foo", WithKey("user-1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		node, err := next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Mark("foo", node, nil)
+		if node.Id != first.Id {
+			t.Fatalf("expected the key on node %s, got %s", first.Id, node.Id)
+		}
+	}
+
+	// retries go to the other nodes before giving up
+	seen := map[string]bool{first.Id: true}
+	for i := 0; i < 2; i++ {
+		node, err := next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[node.Id] {
+			t.Fatalf("node %s returned twice", node.Id)
+		}
+		seen[node.Id] = true
+	}
+	if _, err := next(); err != selector.ErrNoneAvailable {
+		t.Fatalf("expected %v, got %v", selector.ErrNoneAvailable, err)
+	}
+
+	// requests without a key are left to the registry selector
+	next, err = s.Select("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := next(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBoundedLoad(t *testing.T) {
+	r := memory.NewRegistry()
+	if err := r.Register(newService("1", "2", "3", "4")); err != nil {
+		t.Fatal(err)
+	}
+	s := NewSelector(selector.Registry(r), LoadFactor(1.25))
+
+	// requests for a hot key in flight at once spill over to the other nodes
+	counts := make(map[string]int)
+	var nodes []*registry.Node
+	for i := 0; i < 40; i++ {
+		next, err := s.Select("foo", WithKey("hot"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		node, err := next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[node.Id]++
+		nodes = append(nodes, node)
+	}
+	for id, n := range counts {
+		if n > 13 {
+			t.Errorf("node %s has %d of 40 requests in flight", id, n)
+		}
+	}
+
+	// once the requests end the key is back on its node
+	for _, node := range nodes {
+		s.Mark("foo", node, nil)
+	}
+	owner := newRing([]*registry.Service{newService("1", "2", "3", "4")}, DefaultReplicas).walk("hot")[0]
+	next, _ := s.Select("foo", WithKey("hot"))
+	if node, _ := next(); node.Id != owner.Id {
+		t.Fatalf("expected node %s, got %s", owner.Id, node.Id)
+	}
+}
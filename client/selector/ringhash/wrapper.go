@@ -0,0 +1,41 @@
+package ringhash
+
+import (
+	"context"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/metadata"
+)
+
+type hashWrapper struct {
+	client.Client
+	header string
+}
+
+// options routes the request by the header, a key passed to the call takes precedence
+func (h *hashWrapper) options(ctx context.Context, opts []client.CallOption) []client.CallOption {
+	key, ok := metadata.Get(ctx, h.header)
+	if !ok || len(key) == 0 {
+		return opts
+	}
+	return append([]client.CallOption{Key(key)}, opts...)
+}
+
+func (h *hashWrapper) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	return h.Client.Call(ctx, req, rsp, h.options(ctx, opts)...)
+}
+
+func (h *hashWrapper) Stream(ctx context.Context, req client.Request, opts ...client.CallOption) (client.Stream, error) {
+	return h.Client.Stream(ctx, req, h.options(ctx, opts)...)
+}
+
+// NewClientWrapper returns a client wrapper routing requests by the value of the
+// metadata header, so the key set by a caller upstream is kept along the call chain
+func NewClientWrapper(header string) client.Wrapper {
+	return func(c client.Client) client.Client {
+		return &hashWrapper{
+			Client: c,
+			header: header,
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package static
+
+import (
+	"context"
+	"time"
+
+	"github.com/micro/go-micro/v2/client/selector"
+)
+
+type probeKey struct{}
+type probeIntervalKey struct{}
+type failFastKey struct{}
+type holdTimeoutKey struct{}
+
+func setOption(k, v interface{}) selector.Option {
+	return func(o *selector.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// TCPProbe probes the target by connecting to it
+func TCPProbe() selector.Option {
+	return setOption(probeKey{}, "tcp")
+}
+
+// HTTPProbe probes the target with a GET of the path, the target is up while it
+// responds with a 2xx or 3xx status
+func HTTPProbe(path string) selector.Option {
+	return setOption(probeKey{}, path)
+}
+
+// ProbeInterval sets the time between probes
+func ProbeInterval(d time.Duration) selector.Option {
+	return setOption(probeIntervalKey{}, d)
+}
+
+// FailFast fails calls at once while the target is down rather than holding them
+func FailFast() selector.Option {
+	return setOption(failFastKey{}, true)
+}
+
+// HoldTimeout sets how long calls are held for the target to come up
+func HoldTimeout(d time.Duration) selector.Option {
+	return setOption(holdTimeoutKey{}, d)
+}
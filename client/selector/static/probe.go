@@ -0,0 +1,131 @@
+package static
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTargetDown is returned for calls to a target which is down
+	ErrTargetDown = errors.New("target down")
+)
+
+// target is an address and its state as last probed
+type target struct {
+	address string
+
+	sync.Mutex
+	probed bool
+	up     bool
+	// closed once the state changes
+	changed chan bool
+
+	// probes at once, e.g after a failed call
+	kick chan bool
+	exit chan bool
+}
+
+func newTarget(address string) *target {
+	return &target{
+		address: address,
+		changed: make(chan bool),
+		kick:    make(chan bool, 1),
+		exit:    make(chan bool),
+	}
+}
+
+// probe returns nil when the target is up
+func probe(kind, address string, timeout time.Duration) error {
+	if kind == "tcp" {
+		conn, err := net.DialTimeout("tcp", address, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	c := &http.Client{
+		Timeout: timeout,
+		// redirects mean the target is up
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	rsp, err := c.Get("http://" + address + kind)
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status %d", rsp.StatusCode)
+	}
+	return nil
+}
+
+// set records the state of the target, waking up the calls held
+func (t *target) set(up bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.probed && t.up == up {
+		return
+	}
+	t.probed = true
+	t.up = up
+	close(t.changed)
+	t.changed = make(chan bool)
+}
+
+// run probes the target every interval until stopped
+func (t *target) run(kind string, interval time.Duration) {
+	timeout := interval
+	if timeout > 2*time.Second {
+		timeout = 2 * time.Second
+	}
+
+	for {
+		t.set(probe(kind, t.address, timeout) == nil)
+
+		select {
+		case <-t.exit:
+			return
+		case <-t.kick:
+		case <-time.After(interval):
+		}
+	}
+}
+
+// wait returns whether the target is up, holding up to the timeout for it to come up
+func (t *target) wait(hold time.Duration) bool {
+	deadline := time.After(hold)
+
+	for {
+		t.Lock()
+		up, probed, changed := t.up, t.probed, t.changed
+		t.Unlock()
+
+		if up {
+			return true
+		}
+		// a target never probed is assumed up without holding
+		if !probed && hold == 0 {
+			return true
+		}
+		if hold == 0 {
+			return false
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Lock()
+			up = t.up
+			t.Unlock()
+			return up
+		}
+	}
+}
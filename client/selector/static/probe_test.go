@@ -0,0 +1,107 @@
+package static
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// listen returns the host and port of a listener
+func listen(t *testing.T, l net.Listener) (string, string) {
+	host, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(ENV_STATIC_SELECTOR_DOMAIN_NAME, "")
+	os.Setenv(ENV_STATIC_SELECTOR_PORT_NUMBER, port)
+	return host, port
+}
+
+func TestTCPProbe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, _ := listen(t, l)
+
+	s := NewSelector(TCPProbe(), ProbeInterval(10*time.Millisecond), FailFast())
+	defer s.Close()
+
+	next, err := s.Select(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := next(); err != nil {
+		t.Fatal(err)
+	}
+
+	// fail fast once the target is down
+	l.Close()
+	time.Sleep(50 * time.Millisecond)
+	if _, err := next(); err != ErrTargetDown {
+		t.Fatalf("expected %v, got %v", ErrTargetDown, err)
+	}
+}
+
+func TestHTTPProbe(t *testing.T) {
+	healthy := make(chan bool, 1)
+	healthy <- false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		ok := <-healthy
+		healthy <- ok
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	host, _ := listen(t, srv.Listener)
+
+	s := NewSelector(HTTPProbe("/health"), ProbeInterval(10*time.Millisecond), HoldTimeout(time.Second))
+	defer s.Close()
+
+	next, err := s.Select(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// calls are held until the target comes up
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		<-healthy
+		healthy <- true
+	}()
+	start := time.Now()
+	if _, err := next(); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 40*time.Millisecond {
+		t.Fatal("expected the call to be held while the target is down")
+	}
+}
+
+func TestHoldTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, _ := listen(t, l)
+	l.Close()
+
+	s := NewSelector(TCPProbe(), ProbeInterval(10*time.Millisecond), HoldTimeout(50*time.Millisecond))
+	defer s.Close()
+
+	next, err := s.Select(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := next(); err != ErrTargetDown {
+		t.Fatalf("expected %v, got %v", ErrTargetDown, err)
+	}
+}
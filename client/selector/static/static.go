@@ -3,36 +3,122 @@
 package static
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/micro/go-micro/v2/client/selector"
 	"github.com/micro/go-micro/v2/config/cmd"
+	log "github.com/micro/go-micro/v2/logger"
 	"github.com/micro/go-micro/v2/registry"
 )
 
+/*
+	The target can optionally be probed, over TCP or with an HTTP GET of a health path,
+	for targets without a registry such as external gateways. While the target is down
+	calls are held until it comes up or the hold timeout passes, or failed at once with
+	FailFast. A failed call probes the target again at once.
+*/
+
 const (
-	ENV_STATIC_SELECTOR_DOMAIN_NAME = "STATIC_SELECTOR_DOMAIN_NAME"
-	ENV_STATIC_SELECTOR_PORT_NUMBER = "STATIC_SELECTOR_PORT_NUMBER"
-	DEFAULT_PORT_NUMBER             = "8080"
+	ENV_STATIC_SELECTOR_DOMAIN_NAME    = "STATIC_SELECTOR_DOMAIN_NAME"
+	ENV_STATIC_SELECTOR_PORT_NUMBER    = "STATIC_SELECTOR_PORT_NUMBER"
+	ENV_STATIC_SELECTOR_PROBE          = "STATIC_SELECTOR_PROBE"
+	ENV_STATIC_SELECTOR_PROBE_INTERVAL = "STATIC_SELECTOR_PROBE_INTERVAL"
+	DEFAULT_PORT_NUMBER                = "8080"
+	DEFAULT_PROBE_INTERVAL             = 5 * time.Second
+	DEFAULT_HOLD_TIMEOUT               = 5 * time.Second
 )
 
 type staticSelector struct {
+	so            selector.Options
 	addressSuffix string
 	envDomainName string
 	envPortNumber string
+
+	// probe is tcp or the path of the http probe, empty without probing
+	probe    string
+	interval time.Duration
+	hold     time.Duration
+
+	sync.Mutex
+	targets map[string]*target
 }
 
 func init() {
 	cmd.DefaultSelectors["static"] = NewSelector
 }
 
+// configure sets up probing from the env-vars and options
+func (s *staticSelector) configure() {
+	probe := os.Getenv(ENV_STATIC_SELECTOR_PROBE)
+	if p, ok := s.so.Context.Value(probeKey{}).(string); ok {
+		probe = p
+	}
+	if probe != "" && probe != "tcp" && !strings.HasPrefix(probe, "/") {
+		probe = "/" + probe
+	}
+
+	interval := DEFAULT_PROBE_INTERVAL
+	if v := os.Getenv(ENV_STATIC_SELECTOR_PROBE_INTERVAL); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			interval = d
+		} else {
+			log.Errorf("[static] invalid probe interval %q", v)
+		}
+	}
+	if d, ok := s.so.Context.Value(probeIntervalKey{}).(time.Duration); ok && d > 0 {
+		interval = d
+	}
+
+	hold := DEFAULT_HOLD_TIMEOUT
+	if d, ok := s.so.Context.Value(holdTimeoutKey{}).(time.Duration); ok && d >= 0 {
+		hold = d
+	}
+	if ff, ok := s.so.Context.Value(failFastKey{}).(bool); ok && ff {
+		hold = 0
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	// probe the targets again with the new settings
+	for address, t := range s.targets {
+		close(t.exit)
+		delete(s.targets, address)
+	}
+	s.probe = probe
+	s.interval = interval
+	s.hold = hold
+}
+
+// target returns the target of the address, probed from first use
+func (s *staticSelector) target(address string) *target {
+	s.Lock()
+	defer s.Unlock()
+
+	if t, ok := s.targets[address]; ok {
+		return t
+	}
+	t := newTarget(address)
+	s.targets[address] = t
+	go t.run(s.probe, s.interval)
+	return t
+}
+
 func (s *staticSelector) Init(opts ...selector.Option) error {
+	for _, o := range opts {
+		o(&s.so)
+	}
+	s.configure()
 	return nil
 }
 
 func (s *staticSelector) Options() selector.Options {
-	return selector.Options{}
+	return s.so
 }
 
 func (s *staticSelector) Select(service string, opts ...selector.SelectOption) (selector.Next, error) {
@@ -41,13 +127,42 @@ func (s *staticSelector) Select(service string, opts ...selector.SelectOption) (
 		Address: fmt.Sprintf("%v%v", service, s.addressSuffix),
 	}
 
+	s.Lock()
+	probe, hold := s.probe, s.hold
+	s.Unlock()
+
+	if probe == "" {
+		return func() (*registry.Node, error) {
+			return node, nil
+		}, nil
+	}
+
+	t := s.target(node.Address)
+
 	return func() (*registry.Node, error) {
+		if !t.wait(hold) {
+			return nil, ErrTargetDown
+		}
 		return node, nil
 	}, nil
 }
 
 func (s *staticSelector) Mark(service string, node *registry.Node, err error) {
-	return
+	if err == nil {
+		return
+	}
+
+	s.Lock()
+	t, ok := s.targets[node.Address]
+	s.Unlock()
+
+	// probe at once, the target may have gone down
+	if ok {
+		select {
+		case t.kick <- true:
+		default:
+		}
+	}
 }
 
 func (s *staticSelector) Reset(service string) {
@@ -55,6 +170,13 @@ func (s *staticSelector) Reset(service string) {
 }
 
 func (s *staticSelector) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	for address, t := range s.targets {
+		close(t.exit)
+		delete(s.targets, address)
+	}
 	return nil
 }
 
@@ -66,10 +188,19 @@ func NewSelector(opts ...selector.Option) selector.Selector {
 
 	// Build a new
 	s := &staticSelector{
+		so: selector.Options{
+			Context: context.TODO(),
+		},
 		addressSuffix: "",
 		envDomainName: os.Getenv(ENV_STATIC_SELECTOR_DOMAIN_NAME),
 		envPortNumber: os.Getenv(ENV_STATIC_SELECTOR_PORT_NUMBER),
+		targets:       make(map[string]*target),
+	}
+
+	for _, o := range opts {
+		o(&s.so)
 	}
+	s.configure()
 
 	// Add the dns domain-name (if one was specified by an env-var):
 	if s.envDomainName != "" {
@@ -0,0 +1,38 @@
+package strategy
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type status struct {
+	Default    string            `json:"default"`
+	Services   map[string]string `json:"services"`
+	Strategies []string          `json:"strategies"`
+}
+
+// NewHandler returns an admin handler for the selector. GET returns the active
+// strategies, POST switches the strategy of the service given in the service
+// form value, or the default strategy if none is given, to the strategy form value
+func NewHandler(s Switcher) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost, http.MethodPut:
+			if err := s.Switch(r.FormValue("service"), r.FormValue("strategy")); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status{
+			Default:    s.Active(""),
+			Services:   s.Overrides(),
+			Strategies: Strategies(),
+		})
+	})
+}
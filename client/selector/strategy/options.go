@@ -0,0 +1,35 @@
+package strategy
+
+import (
+	"context"
+
+	"github.com/micro/go-micro/v2/client/selector"
+)
+
+type defaultKey struct{}
+type servicesKey struct{}
+
+// Default sets the strategy used for services without a strategy of their own
+func Default(name string) selector.Option {
+	return func(o *selector.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, defaultKey{}, name)
+	}
+}
+
+// Service sets the strategy used for the given service
+func Service(service, name string) selector.Option {
+	return func(o *selector.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		s, ok := o.Context.Value(servicesKey{}).(map[string]string)
+		if !ok {
+			s = make(map[string]string)
+		}
+		s[service] = name
+		o.Context = context.WithValue(o.Context, servicesKey{}, s)
+	}
+}
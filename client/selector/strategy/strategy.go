@@ -0,0 +1,180 @@
+// Package strategy is a selector which switches between named strategies at runtime
+package strategy
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/config/cmd"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+/*
+	The strategy selector resolves nodes through the registry selector but picks the
+	strategy from a set of named strategies. The strategy can be set per service and
+	switched while running, so routing can be changed e.g from round robin to a latency
+	aware strategy during an incident without a redeploy. Strategies passed to a call
+	with selector.WithStrategy still take precedence.
+*/
+
+var (
+	// DefaultStrategy is used when neither a default nor a service strategy is set
+	DefaultStrategy = "random"
+
+	// ErrUnknownStrategy is returned when switching to a strategy which isn't registered
+	ErrUnknownStrategy = errors.New("unknown strategy")
+
+	mtx        sync.RWMutex
+	strategies = map[string]selector.Strategy{
+		"random":     selector.Random,
+		"roundrobin": selector.RoundRobin,
+	}
+)
+
+// Switcher is implemented by the strategy selector
+type Switcher interface {
+	// Switch sets the strategy of a service, the default strategy if the service is empty
+	Switch(service, name string) error
+	// Active returns the strategy used for a service, the default strategy if the service is empty
+	Active(service string) string
+	// Overrides returns the services with a strategy of their own
+	Overrides() map[string]string
+}
+
+type strategySelector struct {
+	so selector.Options
+	selector.Selector
+
+	sync.RWMutex
+	def      string
+	services map[string]string
+}
+
+func init() {
+	cmd.DefaultSelectors["strategy"] = NewSelector
+}
+
+// Register makes a strategy available under the given name, replacing any
+// strategy registered under the same name
+func Register(name string, s selector.Strategy) {
+	mtx.Lock()
+	strategies[name] = s
+	mtx.Unlock()
+}
+
+// Strategies returns the names of the registered strategies
+func Strategies() []string {
+	mtx.RLock()
+	defer mtx.RUnlock()
+
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookup(name string) (selector.Strategy, bool) {
+	mtx.RLock()
+	defer mtx.RUnlock()
+	s, ok := strategies[name]
+	return s, ok
+}
+
+func (s *strategySelector) configure() {
+	s.Lock()
+	defer s.Unlock()
+
+	if name, ok := s.so.Context.Value(defaultKey{}).(string); ok {
+		s.def = name
+	}
+	if services, ok := s.so.Context.Value(servicesKey{}).(map[string]string); ok {
+		for service, name := range services {
+			s.services[service] = name
+		}
+	}
+}
+
+func (s *strategySelector) Init(opts ...selector.Option) error {
+	for _, o := range opts {
+		o(&s.so)
+	}
+	s.configure()
+	return s.Selector.Init(opts...)
+}
+
+func (s *strategySelector) Options() selector.Options {
+	return s.so
+}
+
+func (s *strategySelector) Select(service string, opts ...selector.SelectOption) (selector.Next, error) {
+	if strategy, ok := lookup(s.Active(service)); ok {
+		opts = append([]selector.SelectOption{selector.WithStrategy(strategy)}, opts...)
+	}
+	return s.Selector.Select(service, opts...)
+}
+
+func (s *strategySelector) Switch(service, name string) error {
+	if _, ok := lookup(name); !ok {
+		return ErrUnknownStrategy
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if len(service) == 0 {
+		s.def = name
+	} else {
+		s.services[service] = name
+	}
+	return nil
+}
+
+func (s *strategySelector) Active(service string) string {
+	s.RLock()
+	defer s.RUnlock()
+
+	if name, ok := s.services[service]; ok {
+		return name
+	}
+	return s.def
+}
+
+func (s *strategySelector) Overrides() map[string]string {
+	s.RLock()
+	defer s.RUnlock()
+
+	services := make(map[string]string, len(s.services))
+	for service, name := range s.services {
+		services[service] = name
+	}
+	return services
+}
+
+func (s *strategySelector) String() string {
+	return "strategy"
+}
+
+func NewSelector(opts ...selector.Option) selector.Selector {
+	sopts := selector.Options{
+		Context:  context.TODO(),
+		Registry: registry.DefaultRegistry,
+	}
+
+	for _, opt := range opts {
+		opt(&sopts)
+	}
+
+	s := &strategySelector{
+		so:       sopts,
+		Selector: selector.NewSelector(opts...),
+		def:      DefaultStrategy,
+		services: make(map[string]string),
+	}
+	s.configure()
+	return s
+}
@@ -0,0 +1,82 @@
+package strategy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/registry/memory"
+)
+
+func TestSwitch(t *testing.T) {
+	r := memory.NewRegistry()
+	r.Register(&registry.Service{
+		Name:    "foo",
+		Version: "1",
+		Nodes: []*registry.Node{
+			{Id: "foo-1", Address: "10.0.0.1:8080"},
+			{Id: "foo-2", Address: "10.0.0.2:8080"},
+		},
+	})
+
+	Register("first", func(services []*registry.Service) selector.Next {
+		return func() (*registry.Node, error) {
+			return &registry.Node{Id: "first"}, nil
+		}
+	})
+
+	s := NewSelector(selector.Registry(r), Default("roundrobin"))
+	sw := s.(Switcher)
+
+	if name := sw.Active("foo"); name != "roundrobin" {
+		t.Fatalf("expected roundrobin, got %s", name)
+	}
+
+	if err := sw.Switch("foo", "unknown"); err != ErrUnknownStrategy {
+		t.Fatalf("expected unknown strategy error, got %v", err)
+	}
+
+	if err := sw.Switch("foo", "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := s.Select("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node, _ := next(); node.Id != "first" {
+		t.Fatalf("expected node selected by the switched strategy, got %s", node.Id)
+	}
+
+	if name := sw.Active("bar"); name != "roundrobin" {
+		t.Fatalf("expected other services to keep the default, got %s", name)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	s := NewSelector(selector.Registry(memory.NewRegistry()))
+	h := NewHandler(s.(Switcher))
+
+	form := url.Values{"service": {"foo"}, "strategy": {"roundrobin"}}
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Form = form
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if name := s.(Switcher).Active("foo"); name != "roundrobin" {
+		t.Fatalf("expected roundrobin, got %s", name)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Form = url.Values{"strategy": {"unknown"}}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,30 @@
+package subset
+
+import (
+	"context"
+
+	"github.com/micro/go-micro/v2/client/selector"
+)
+
+type sizeKey struct{}
+type clientIDKey struct{}
+
+func setOption(k, v interface{}) selector.Option {
+	return func(o *selector.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// Size sets the number of nodes of a service the client calls
+func Size(n int) selector.Option {
+	return setOption(sizeKey{}, n)
+}
+
+// ClientID sets the id the subset of the client is derived from, clients should
+// have distinct ids kept across restarts e.g the pod name
+func ClientID(id string) selector.Option {
+	return setOption(clientIDKey{}, id)
+}
@@ -0,0 +1,166 @@
+// Package subset is a selector calling a small deterministic subset of the nodes of a service
+package subset
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/config/cmd"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+/*
+	With hundreds of callers and hundreds of nodes every client connecting to every
+	node doesn't scale. Each client calls a subset of the nodes instead, picked with
+	the deterministic subsetting of the Google SRE book: the clients are split into
+	rounds, each round shuffles the nodes with its own seed and deals them out in
+	subsets, one per client of the round. Every node is in the subset of about as many
+	clients, and a client keeps its subset while the nodes don't change.
+
+	The subset is a filter, the registry selector picks nodes of the subset with its
+	strategy.
+*/
+
+var (
+	// DefaultSize is the number of nodes per client without Size
+	DefaultSize = 10
+)
+
+type subsetSelector struct {
+	so selector.Options
+	selector.Selector
+
+	sync.RWMutex
+	filter selector.Filter
+}
+
+func init() {
+	cmd.DefaultSelectors["subset"] = NewSelector
+}
+
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// subset returns the ids of the nodes in the subset of the client
+func subset(ids []string, client uint64, size int) []string {
+	if len(ids) <= size {
+		return ids
+	}
+
+	sort.Strings(ids)
+
+	count := uint64(len(ids) / size)
+	round := client / count
+	id := client % count
+
+	r := rand.New(rand.NewSource(int64(round)))
+	r.Shuffle(len(ids), func(i, j int) {
+		ids[i], ids[j] = ids[j], ids[i]
+	})
+
+	return ids[id*uint64(size) : (id+1)*uint64(size)]
+}
+
+// NewFilter returns a filter keeping the nodes in the subset of the client
+func NewFilter(clientID string, size int) selector.Filter {
+	client := hash(clientID)
+
+	return func(services []*registry.Service) []*registry.Service {
+		var ids []string
+		for _, s := range services {
+			for _, n := range s.Nodes {
+				ids = append(ids, n.Id)
+			}
+		}
+
+		keep := make(map[string]bool, size)
+		for _, id := range subset(ids, client, size) {
+			keep[id] = true
+		}
+
+		var filtered []*registry.Service
+		for _, s := range services {
+			var nodes []*registry.Node
+			for _, n := range s.Nodes {
+				if keep[n.Id] {
+					nodes = append(nodes, n)
+				}
+			}
+			if len(nodes) == 0 {
+				continue
+			}
+			// copy the service so we don't modify the registry cache
+			svc := *s
+			svc.Nodes = nodes
+			filtered = append(filtered, &svc)
+		}
+		return filtered
+	}
+}
+
+func (s *subsetSelector) configure() {
+	size := DefaultSize
+	if n, ok := s.so.Context.Value(sizeKey{}).(int); ok && n > 0 {
+		size = n
+	}
+	id, ok := s.so.Context.Value(clientIDKey{}).(string)
+	if !ok || len(id) == 0 {
+		id, _ = os.Hostname()
+	}
+
+	s.Lock()
+	s.filter = NewFilter(id, size)
+	s.Unlock()
+}
+
+func (s *subsetSelector) Init(opts ...selector.Option) error {
+	for _, o := range opts {
+		o(&s.so)
+	}
+	s.configure()
+	return s.Selector.Init(opts...)
+}
+
+func (s *subsetSelector) Options() selector.Options {
+	return s.so
+}
+
+func (s *subsetSelector) Select(service string, opts ...selector.SelectOption) (selector.Next, error) {
+	s.RLock()
+	filter := s.filter
+	s.RUnlock()
+
+	// the subset is taken before any other filter
+	opts = append([]selector.SelectOption{selector.WithFilter(filter)}, opts...)
+	return s.Selector.Select(service, opts...)
+}
+
+func (s *subsetSelector) String() string {
+	return "subset"
+}
+
+func NewSelector(opts ...selector.Option) selector.Selector {
+	sopts := selector.Options{
+		Context:  context.TODO(),
+		Registry: registry.DefaultRegistry,
+	}
+
+	for _, opt := range opts {
+		opt(&sopts)
+	}
+
+	s := &subsetSelector{
+		so:       sopts,
+		Selector: selector.NewSelector(opts...),
+	}
+	s.configure()
+	return s
+}
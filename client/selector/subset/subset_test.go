@@ -0,0 +1,97 @@
+package subset
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/registry/memory"
+)
+
+func TestSubset(t *testing.T) {
+	var ids []string
+	for i := 0; i < 30; i++ {
+		ids = append(ids, fmt.Sprintf("node-%d", i))
+	}
+
+	// every node is in the subset of as many clients
+	counts := make(map[string]int)
+	for client := uint64(0); client < 100; client++ {
+		nodes := subset(append([]string{}, ids...), client, 3)
+		if len(nodes) != 3 {
+			t.Fatalf("expected 3 nodes, got %v", nodes)
+		}
+		for _, id := range nodes {
+			counts[id]++
+		}
+	}
+	for _, id := range ids {
+		if counts[id] != 10 {
+			t.Fatalf("expected node %s in the subset of 10 clients, got %d", id, counts[id])
+		}
+	}
+
+	// the subset doesn't depend on the order of the nodes
+	a := subset(append([]string{}, ids...), 42, 3)
+	b := subset([]string{ids[29], ids[3], ids[17]}, 42, 3)
+	reversed := make([]string, len(ids))
+	for i, id := range ids {
+		reversed[len(ids)-1-i] = id
+	}
+	c := subset(reversed, 42, 3)
+	if fmt.Sprint(a) != fmt.Sprint(c) {
+		t.Fatalf("expected the same subset, got %v and %v", a, c)
+	}
+	if len(b) != 3 {
+		t.Fatalf("expected every node of a small service, got %v", b)
+	}
+}
+
+func TestSelector(t *testing.T) {
+	r := memory.NewRegistry()
+	for v := 0; v < 2; v++ {
+		s := &registry.Service{Name: "foo", Version: fmt.Sprint(v)}
+		for i := 0; i < 20; i++ {
+			s.Nodes = append(s.Nodes, &registry.Node{Id: fmt.Sprintf("node-%d-%d", v, i)})
+		}
+		if err := r.Register(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewSelector(selector.Registry(r), Size(4), ClientID("client-1"))
+	seen := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		next, err := s.Select("foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[n.Id] = true
+	}
+	if len(seen) != 4 {
+		t.Fatalf("expected the calls on a subset of 4 nodes, got %d", len(seen))
+	}
+
+	// other clients get another subset
+	other := NewFilter("client-2", 4)
+	mine := NewFilter("client-1", 4)
+	services, _ := r.GetService("foo")
+	if fmt.Sprint(ids(other(services))) == fmt.Sprint(ids(mine(services))) {
+		t.Fatal("expected clients to get distinct subsets")
+	}
+}
+
+func ids(services []*registry.Service) []string {
+	var ids []string
+	for _, s := range services {
+		for _, n := range s.Nodes {
+			ids = append(ids, n.Id)
+		}
+	}
+	return ids
+}
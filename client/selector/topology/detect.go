@@ -0,0 +1,58 @@
+package topology
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	awsZoneURL = "http://169.254.169.254/latest/meta-data/placement/availability-zone"
+	gcpZoneURL = "http://metadata.google.internal/computeMetadata/v1/instance/zone"
+)
+
+// get returns the body of the metadata url
+func get(c *http.Client, url string, header map[string]string) (string, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rsp, err := c.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return "", nil
+	}
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// detect returns the zone and region of the instance from the cloud metadata service
+func detect() (string, string) {
+	c := &http.Client{Timeout: time.Second}
+
+	// e.g us-east-1a in us-east-1
+	if zone, err := get(c, awsZoneURL, nil); err == nil && len(zone) > 1 {
+		return zone, zone[:len(zone)-1]
+	}
+
+	// e.g projects/123/zones/us-central1-a in us-central1
+	if path, err := get(c, gcpZoneURL, map[string]string{"Metadata-Flavor": "Google"}); err == nil && len(path) > 0 {
+		zone := path[strings.LastIndex(path, "/")+1:]
+		if i := strings.LastIndex(zone, "-"); i > 0 {
+			return zone, zone[:i]
+		}
+		return zone, ""
+	}
+
+	return "", ""
+}
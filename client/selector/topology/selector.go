@@ -0,0 +1,168 @@
+package topology
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/config/cmd"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+/*
+	The selector applies the filter to every call. A node is skipped for a cooldown
+	after a failed call, so it doesn't count as capacity of its zone, and calls move
+	to the region once too few nodes of the zone are left rather than only once every
+	node of the zone failed. Every node is tried again when all of them failed.
+*/
+
+type optionsKey struct{}
+
+// WithOptions sets the topology options of the selector
+func WithOptions(opts ...Option) selector.Option {
+	return func(o *selector.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, optionsKey{}, opts)
+	}
+}
+
+type topologySelector struct {
+	so selector.Options
+	selector.Selector
+
+	sync.Mutex
+	options Options
+	filter  selector.Filter
+	// failed nodes keyed by id, skipped until the time
+	failed map[string]time.Time
+}
+
+func init() {
+	cmd.DefaultSelectors["topology"] = NewSelector
+}
+
+func (s *topologySelector) configure() {
+	opts, _ := s.so.Context.Value(optionsKey{}).([]Option)
+	options := newOptions(opts...)
+
+	s.Lock()
+	s.options = options
+	s.filter = newFilter(options)
+	s.Unlock()
+}
+
+// healthy returns the nodes which didn't fail within the cooldown, every node if all of them did
+func (s *topologySelector) healthy(services []*registry.Service) []*registry.Service {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	nodes := filter(services, func(node *registry.Node) bool {
+		return !s.failed[node.Id].After(now)
+	})
+	if len(nodes) == 0 {
+		return services
+	}
+	return nodes
+}
+
+// Explain tells where the node is relative to the caller
+func (s *topologySelector) Explain(service string, node *registry.Node) string {
+	s.Lock()
+	defer s.Unlock()
+
+	var reason string
+	switch zone, region := zoneOf(node), regionOf(node); {
+	case len(s.options.Zone) > 0 && zone == s.options.Zone:
+		reason = "in zone " + zone
+	case len(s.options.Region) > 0 && region == s.options.Region:
+		reason = "in region " + region
+	case len(s.options.Zone) > 0:
+		reason = "outside zone " + s.options.Zone
+	case len(zone) > 0:
+		reason = "in zone " + zone
+	default:
+		reason = "without a zone"
+	}
+	if s.failed[node.Id].After(time.Now()) {
+		reason += ", failed within the cooldown"
+	}
+	return reason
+}
+
+func (s *topologySelector) Init(opts ...selector.Option) error {
+	for _, o := range opts {
+		o(&s.so)
+	}
+	s.configure()
+	return s.Selector.Init(opts...)
+}
+
+func (s *topologySelector) Options() selector.Options {
+	return s.so
+}
+
+func (s *topologySelector) Select(service string, opts ...selector.SelectOption) (selector.Next, error) {
+	s.Lock()
+	f := s.filter
+	s.Unlock()
+
+	topology := func(services []*registry.Service) []*registry.Service {
+		return f(s.healthy(services))
+	}
+	return s.Selector.Select(service, append(opts, selector.WithFilter(topology))...)
+}
+
+// Mark skips the node for the cooldown after a failed call
+func (s *topologySelector) Mark(service string, node *registry.Node, err error) {
+	s.Lock()
+	if err != nil {
+		now := time.Now()
+		for id, t := range s.failed {
+			if t.Before(now) {
+				delete(s.failed, id)
+			}
+		}
+		s.failed[node.Id] = now.Add(s.options.Cooldown)
+	} else {
+		delete(s.failed, node.Id)
+	}
+	s.Unlock()
+
+	s.Selector.Mark(service, node, err)
+}
+
+func (s *topologySelector) Reset(service string) {
+	s.Lock()
+	s.failed = make(map[string]time.Time)
+	s.Unlock()
+
+	s.Selector.Reset(service)
+}
+
+func (s *topologySelector) String() string {
+	return "topology"
+}
+
+// NewSelector returns a selector keeping calls within the zone and region of the caller
+func NewSelector(opts ...selector.Option) selector.Selector {
+	sopts := selector.Options{
+		Context:  context.TODO(),
+		Registry: registry.DefaultRegistry,
+	}
+
+	for _, opt := range opts {
+		opt(&sopts)
+	}
+
+	s := &topologySelector{
+		so:       sopts,
+		Selector: selector.NewSelector(opts...),
+		failed:   make(map[string]time.Time),
+	}
+	s.configure()
+	return s
+}
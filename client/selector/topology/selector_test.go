@@ -0,0 +1,78 @@
+package topology
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/registry/memory"
+)
+
+func selectNodes(t *testing.T, s selector.Selector, n int) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		next, err := s.Select("foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		node, err := next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[node.Id]++
+	}
+	return counts
+}
+
+func TestSelector(t *testing.T) {
+	r := memory.NewRegistry()
+	err := r.Register(&registry.Service{
+		Name: "foo",
+		Nodes: []*registry.Node{
+			{Id: "a1", Metadata: map[string]string{"zone": "eu-west-1a", "region": "eu-west-1"}},
+			{Id: "a2", Metadata: map[string]string{"zone": "eu-west-1a", "region": "eu-west-1"}},
+			{Id: "b1", Metadata: map[string]string{"zone": "eu-west-1b", "region": "eu-west-1"}},
+			{Id: "b2", Metadata: map[string]string{"zone": "eu-west-1b", "region": "eu-west-1"}},
+			{Id: "c1", Metadata: map[string]string{"zone": "us-east-1a", "region": "us-east-1"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSelector(
+		selector.Registry(r),
+		WithOptions(Zone("eu-west-1a"), Region("eu-west-1"), Overload(0), Cooldown(time.Minute)),
+	)
+
+	counts := selectNodes(t, s, 20)
+	if counts["a1"]+counts["a2"] != 20 {
+		t.Fatalf("expected the calls within the zone, got %v", counts)
+	}
+
+	// a failed node leaves the zone short of capacity before the zone failed as a whole
+	s.Mark("foo", &registry.Node{Id: "a1"}, errors.New("failed"))
+	counts = selectNodes(t, s, 20)
+	if counts["a1"] > 0 || counts["c1"] > 0 {
+		t.Fatalf("expected the calls within the region, got %v", counts)
+	}
+
+	explain := s.(interface {
+		Explain(string, *registry.Node) string
+	}).Explain
+	if r := explain("foo", &registry.Node{Id: "a1", Metadata: map[string]string{"zone": "eu-west-1a"}}); r != "in zone eu-west-1a, failed within the cooldown" {
+		t.Fatalf("unexpected reason %q", r)
+	}
+	if r := explain("foo", &registry.Node{Id: "b1", Metadata: map[string]string{"zone": "eu-west-1b", "region": "eu-west-1"}}); r != "in region eu-west-1" {
+		t.Fatalf("unexpected reason %q", r)
+	}
+
+	s.Mark("foo", &registry.Node{Id: "a1"}, nil)
+	counts = selectNodes(t, s, 20)
+	if counts["a1"]+counts["a2"] != 20 {
+		t.Fatalf("expected the zone once the node recovered, got %v", counts)
+	}
+}
@@ -0,0 +1,297 @@
+// Package topology provides a selector and selector filter for topology aware routing.
+package topology
+
+import (
+	"os"
+	"time"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/client/selector"
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+/*
+   Topology aware routing keeps requests within the zone of the caller, similar to the
+   topology hints used by kube-proxy. The zone and hostname of each node are read from
+   the node metadata populated by the kubernetes registry. Hints are ignored, and all
+   nodes returned, whenever a node has no zone or the local zone holds too few nodes
+   to take its share of the traffic.
+
+   When the zone can't take its share the region of the caller is tried the same way,
+   so calls leave the region only once it lacks the capacity too. The zone and region
+   of nodes outside kubernetes are read from the zone and region metadata.
+
+   The zone is a label of the kubernetes node, which the downward API can't expose to
+   the pod. Unless set, read from TOPOLOGY_ZONE or detected from the AWS or GCP metadata
+   service, the zone of the caller is the zone of the nodes on its kubernetes node,
+   whose name the downward API exposes as NODE_NAME, since the registry reads it from
+   the kubernetes node. The region defaults to TOPOLOGY_REGION or the region of the
+   nodes in the zone of the caller.
+*/
+
+const (
+	// ZoneKey is the node metadata key holding the zone
+	ZoneKey = "topology.kubernetes.io/zone"
+	// RegionKey is the node metadata key holding the region
+	RegionKey = "topology.kubernetes.io/region"
+	// HostnameKey is the node metadata key holding the kubernetes node name
+	HostnameKey = "kubernetes.io/hostname"
+)
+
+var (
+	// DefaultOverload is the default share by which the local zone may be
+	// under-provisioned before traffic is spread across all zones
+	DefaultOverload = 0.2
+	// DefaultMinNodes is the default number of local nodes required
+	DefaultMinNodes = 1
+	// DefaultCooldown is how long the selector skips a node after a failed call
+	DefaultCooldown = 10 * time.Second
+)
+
+type Options struct {
+	// Zone of the caller, defaults to the TOPOLOGY_ZONE env var or the zone of
+	// the nodes on the kubernetes node of the caller
+	Zone string
+	// Region of the caller, defaults to the TOPOLOGY_REGION env var or the
+	// region of the nodes in the zone of the caller
+	Region string
+	// Detect asks the cloud metadata service for the zone when it's not set
+	Detect bool
+	// Hostname of the caller, nodes on the same host are preferred when set
+	Hostname string
+	// MinNodes is the number of nodes required in the local zone
+	MinNodes int
+	// Overload is the share by which the local zone may fall short of an
+	// even split of the nodes across zones
+	Overload float64
+	// Cooldown is how long the selector skips a node after a failed call
+	Cooldown time.Duration
+}
+
+type Option func(*Options)
+
+// Zone sets the zone of the caller
+func Zone(z string) Option {
+	return func(o *Options) {
+		o.Zone = z
+	}
+}
+
+// Region sets the region of the caller
+func Region(r string) Option {
+	return func(o *Options) {
+		o.Region = r
+	}
+}
+
+// Detect asks the instance metadata service of AWS or GCP for the zone of the
+// caller when it's neither set nor in the environment
+func Detect() Option {
+	return func(o *Options) {
+		o.Detect = true
+	}
+}
+
+// Hostname sets the kubernetes node of the caller to prefer nodes on the same host
+func Hostname(h string) Option {
+	return func(o *Options) {
+		o.Hostname = h
+	}
+}
+
+// MinNodes sets the number of nodes required in the local zone
+func MinNodes(n int) Option {
+	return func(o *Options) {
+		o.MinNodes = n
+	}
+}
+
+// Overload sets the share by which the local zone may be under-provisioned
+func Overload(f float64) Option {
+	return func(o *Options) {
+		o.Overload = f
+	}
+}
+
+// Cooldown sets how long the selector skips a node after a failed call
+func Cooldown(d time.Duration) Option {
+	return func(o *Options) {
+		o.Cooldown = d
+	}
+}
+
+// zoneOf returns the zone of the node
+func zoneOf(node *registry.Node) string {
+	if z := node.Metadata[ZoneKey]; len(z) > 0 {
+		return z
+	}
+	return node.Metadata["zone"]
+}
+
+// regionOf returns the region of the node
+func regionOf(node *registry.Node) string {
+	if r := node.Metadata[RegionKey]; len(r) > 0 {
+		return r
+	}
+	return node.Metadata["region"]
+}
+
+func filter(services []*registry.Service, match func(*registry.Node) bool) []*registry.Service {
+	var filtered []*registry.Service
+
+	for _, service := range services {
+		var nodes []*registry.Node
+		for _, node := range service.Nodes {
+			if match(node) {
+				nodes = append(nodes, node)
+			}
+		}
+		if len(nodes) == 0 {
+			continue
+		}
+		// copy the service so we don't modify the registry cache
+		svc := *service
+		svc.Nodes = nodes
+		filtered = append(filtered, &svc)
+	}
+
+	return filtered
+}
+
+// hostZone returns the zone of the nodes on the host, empty if there are none
+func hostZone(services []*registry.Service, host string) string {
+	for _, service := range services {
+		for _, node := range service.Nodes {
+			if node.Metadata[HostnameKey] == host && len(zoneOf(node)) > 0 {
+				return zoneOf(node)
+			}
+		}
+	}
+	return ""
+}
+
+// zoneRegion returns the region of the nodes in the zone, empty if there are none
+func zoneRegion(services []*registry.Service, zone string) string {
+	for _, service := range services {
+		for _, node := range service.Nodes {
+			if zoneOf(node) == zone && len(regionOf(node)) > 0 {
+				return regionOf(node)
+			}
+		}
+	}
+	return ""
+}
+
+// local returns the nodes in the zone or region of the caller, as told by of, or nil
+// when hints should not be used
+func local(services []*registry.Service, of func(*registry.Node) string, want string, opts Options) []*registry.Service {
+	groups := make(map[string]int)
+	var total int
+
+	for _, service := range services {
+		for _, node := range service.Nodes {
+			group := of(node)
+			if len(group) == 0 {
+				// hints require every node to have a zone
+				return nil
+			}
+			groups[group]++
+			total++
+		}
+	}
+
+	count := groups[want]
+	if count == 0 || count < opts.MinNodes {
+		return nil
+	}
+
+	// the local zone must be able to take an even share of the traffic
+	share := float64(total) / float64(len(groups))
+	if float64(count) < share/(1+opts.Overload) {
+		return nil
+	}
+
+	return filter(services, func(node *registry.Node) bool {
+		return of(node) == want
+	})
+}
+
+// newOptions returns the options with the zone and region set from the environment
+func newOptions(opts ...Option) Options {
+	options := Options{
+		Zone:     os.Getenv("TOPOLOGY_ZONE"),
+		Region:   os.Getenv("TOPOLOGY_REGION"),
+		MinNodes: DefaultMinNodes,
+		Overload: DefaultOverload,
+		Cooldown: DefaultCooldown,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	if options.Detect && len(options.Zone) == 0 {
+		zone, region := detect()
+		if len(zone) == 0 {
+			log.Warn("[topology] failed to detect the zone")
+		}
+		options.Zone = zone
+		if len(options.Region) == 0 {
+			options.Region = region
+		}
+	}
+
+	return options
+}
+
+// NewFilter returns a filter which keeps nodes in the zone of the caller
+func NewFilter(opts ...Option) selector.Filter {
+	return newFilter(newOptions(opts...))
+}
+
+func newFilter(options Options) selector.Filter {
+	// the kubernetes node of the caller, exposed by the downward API
+	node := options.Hostname
+	if len(node) == 0 {
+		node = os.Getenv("NODE_NAME")
+	}
+
+	return func(services []*registry.Service) []*registry.Service {
+		if len(options.Hostname) > 0 {
+			host := filter(services, func(node *registry.Node) bool {
+				return node.Metadata[HostnameKey] == options.Hostname
+			})
+			if len(host) > 0 {
+				return host
+			}
+		}
+
+		opts := options
+		if len(opts.Zone) == 0 {
+			opts.Zone = hostZone(services, node)
+		}
+		if len(opts.Zone) > 0 {
+			if zone := local(services, zoneOf, opts.Zone, opts); len(zone) > 0 {
+				return zone
+			}
+		}
+
+		// the zone lacks the capacity, keep the calls within the region
+		if len(opts.Region) == 0 && len(opts.Zone) > 0 {
+			opts.Region = zoneRegion(services, opts.Zone)
+		}
+		if len(opts.Region) == 0 {
+			return services
+		}
+		if region := local(services, regionOf, opts.Region, opts); len(region) > 0 {
+			return region
+		}
+
+		return services
+	}
+}
+
+// WithFilter returns a call option which applies the topology filter
+func WithFilter(opts ...Option) client.CallOption {
+	return client.WithSelectOption(selector.WithFilter(NewFilter(opts...)))
+}
@@ -0,0 +1,103 @@
+package topology
+
+import (
+	"os"
+	"testing"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+func testServices(zones ...string) []*registry.Service {
+	var nodes []*registry.Node
+	for i, zone := range zones {
+		node := &registry.Node{Id: string(rune('a' + i))}
+		if len(zone) > 0 {
+			node.Metadata = map[string]string{
+				ZoneKey:     zone,
+				HostnameKey: "host-" + node.Id,
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	return []*registry.Service{{Name: "foo", Nodes: nodes}}
+}
+
+func count(services []*registry.Service) int {
+	var n int
+	for _, s := range services {
+		n += len(s.Nodes)
+	}
+	return n
+}
+
+func TestFilter(t *testing.T) {
+	testData := []struct {
+		name     string
+		zones    []string
+		opts     []Option
+		expected int
+	}{
+		{"local zone", []string{"a", "a", "b", "b"}, []Option{Zone("a")}, 2},
+		{"no zone set", []string{"a", "a", "b", "b"}, []Option{Zone("")}, 4},
+		{"unknown zone", []string{"a", "a", "b", "b"}, []Option{Zone("c")}, 4},
+		{"missing hints", []string{"a", "a", "", "b"}, []Option{Zone("a")}, 4},
+		{"overloaded zone", []string{"a", "b", "b", "b", "b", "b"}, []Option{Zone("a")}, 6},
+		{"min nodes", []string{"a", "a", "b", "b"}, []Option{Zone("a"), MinNodes(3)}, 4},
+		{"same host", []string{"a", "a", "b", "b"}, []Option{Zone("a"), Hostname("host-b")}, 1},
+	}
+
+	for _, d := range testData {
+		services := testServices(d.zones...)
+		filtered := NewFilter(d.opts...)(services)
+		if n := count(filtered); n != d.expected {
+			t.Fatalf("%s: expected %d nodes got %d", d.name, d.expected, n)
+		}
+		if n := count(services); n != len(d.zones) {
+			t.Fatalf("%s: filter modified the services", d.name)
+		}
+	}
+}
+
+func TestNodeZone(t *testing.T) {
+	// the downward API exposes the kubernetes node of the caller, host-c in zone b
+	os.Setenv("NODE_NAME", "host-c")
+	defer os.Unsetenv("NODE_NAME")
+
+	services := testServices("a", "a", "b", "b")
+	filtered := NewFilter(Zone(""))(services)
+	if n := count(filtered); n != 2 {
+		t.Fatalf("expected the 2 nodes of the zone of the kubernetes node, got %d", n)
+	}
+	for _, node := range filtered[0].Nodes {
+		if node.Metadata[ZoneKey] != "b" {
+			t.Fatalf("expected nodes of zone b, got %s", node.Metadata[ZoneKey])
+		}
+	}
+}
+
+func TestRegion(t *testing.T) {
+	services := []*registry.Service{{Name: "foo", Nodes: []*registry.Node{
+		{Id: "a1", Metadata: map[string]string{ZoneKey: "eu-west-1a", RegionKey: "eu-west-1"}},
+		{Id: "b1", Metadata: map[string]string{"zone": "eu-west-1b", "region": "eu-west-1"}},
+		{Id: "b2", Metadata: map[string]string{"zone": "eu-west-1b", "region": "eu-west-1"}},
+		{Id: "c1", Metadata: map[string]string{"zone": "us-east-1a", "region": "us-east-1"}},
+	}}}
+
+	testData := []struct {
+		name     string
+		opts     []Option
+		expected int
+	}{
+		// the zone holds one node of four across three zones, short of its share
+		{"zone short of capacity", []Option{Zone("eu-west-1a"), Overload(0)}, 3},
+		{"zone with capacity", []Option{Zone("eu-west-1b"), Overload(0)}, 2},
+		{"region without zone", []Option{Zone(""), Region("eu-west-1")}, 3},
+		{"region short of capacity", []Option{Zone("us-east-1a"), MinNodes(2)}, 4},
+	}
+
+	for _, d := range testData {
+		if n := count(NewFilter(d.opts...)(services)); n != d.expected {
+			t.Fatalf("%s: expected %d nodes got %d", d.name, d.expected, n)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Package trace reports the decisions of a selector to hooks and request traces
+package trace
+
+import (
+	"context"
+	"sync"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+/*
+	The selector wraps another one and reports every node it returns as a decision:
+	the candidates left after the filters, the node chosen, the attempt of the call
+	and, from selectors implementing Explainer, why the node was chosen. Decisions
+	go to the hooks of the selector and to hooks passed with the call, which is how
+	the client wrapper adds them to the span of the request.
+*/
+
+// Decision is a node returned by a selector
+type Decision struct {
+	Service  string
+	Selector string
+	// Candidates are the nodes left after the filters, unknown to selectors without filters
+	Candidates []*registry.Node
+	Node       *registry.Node
+	// Attempt of the call, 1 for the first node returned
+	Attempt int
+	// Reason the selector chose the node, empty unless the selector is an Explainer
+	Reason string
+	// Error of the selector, e.g none available
+	Error error
+}
+
+// Hook is called with every decision
+type Hook func(*Decision)
+
+// Explainer is implemented by selectors which can tell why they chose a node
+type Explainer interface {
+	Explain(service string, node *registry.Node) string
+}
+
+type hooksKey struct{}
+
+type traceSelector struct {
+	selector.Selector
+	hooks []Hook
+}
+
+// WithHook reports the decisions of a call to the hook
+func WithHook(h Hook) selector.SelectOption {
+	return func(o *selector.SelectOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		hooks, _ := o.Context.Value(hooksKey{}).([]Hook)
+		hooks = append(append([]Hook{}, hooks...), h)
+		o.Context = context.WithValue(o.Context, hooksKey{}, hooks)
+	}
+}
+
+func (t *traceSelector) Select(service string, opts ...selector.SelectOption) (selector.Next, error) {
+	var sopts selector.SelectOptions
+	for _, o := range opts {
+		o(&sopts)
+	}
+
+	hooks := t.hooks
+	if sopts.Context != nil {
+		if h, ok := sopts.Context.Value(hooksKey{}).([]Hook); ok {
+			hooks = append(append([]Hook{}, hooks...), h...)
+		}
+	}
+	if len(hooks) == 0 {
+		return t.Selector.Select(service, opts...)
+	}
+
+	report := func(d *Decision) {
+		d.Service = service
+		d.Selector = t.Selector.String()
+		for _, h := range hooks {
+			h(d)
+		}
+	}
+
+	// the candidates are those left after every other filter
+	var candidates []*registry.Node
+	record := func(services []*registry.Service) []*registry.Service {
+		candidates = nil
+		for _, s := range services {
+			candidates = append(candidates, s.Nodes...)
+		}
+		return services
+	}
+
+	next, err := t.Selector.Select(service, append(opts, selector.WithFilter(record))...)
+	if err != nil {
+		report(&Decision{Candidates: candidates, Error: err})
+		return nil, err
+	}
+
+	var mtx sync.Mutex
+	var attempt int
+
+	return func() (*registry.Node, error) {
+		node, err := next()
+
+		mtx.Lock()
+		attempt++
+		d := &Decision{
+			Candidates: candidates,
+			Node:       node,
+			Attempt:    attempt,
+			Error:      err,
+		}
+		mtx.Unlock()
+
+		if e, ok := t.Selector.(Explainer); ok && node != nil {
+			d.Reason = e.Explain(service, node)
+		}
+		report(d)
+
+		return node, err
+	}, nil
+}
+
+// NewSelector returns a selector reporting the decisions of the selector to the hooks
+func NewSelector(s selector.Selector, hooks ...Hook) selector.Selector {
+	return &traceSelector{
+		Selector: s,
+		hooks:    hooks,
+	}
+}
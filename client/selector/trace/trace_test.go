@@ -0,0 +1,127 @@
+package trace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/registry/memory"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+type explainer struct {
+	selector.Selector
+}
+
+func (e *explainer) Explain(service string, node *registry.Node) string {
+	return "because " + node.Id
+}
+
+func newRegistry(t *testing.T) registry.Registry {
+	r := memory.NewRegistry()
+	err := r.Register(&registry.Service{
+		Name: "foo",
+		Nodes: []*registry.Node{
+			{Id: "1", Address: "10.0.0.1:8080"},
+			{Id: "2", Address: "10.0.0.2:8080"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestSelector(t *testing.T) {
+	var decisions []*Decision
+	s := NewSelector(
+		&explainer{selector.NewSelector(selector.Registry(newRegistry(t)))},
+		func(d *Decision) { decisions = append(decisions, d) },
+	)
+
+	// keep node 1 only
+	filter := func(services []*registry.Service) []*registry.Service {
+		svc := *services[0]
+		svc.Nodes = svc.Nodes[:1]
+		return []*registry.Service{&svc}
+	}
+
+	var called bool
+	next, err := s.Select("foo", selector.WithFilter(filter), WithHook(func(*Decision) { called = true }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !called {
+		t.Fatal("expected the hook of the call to be called")
+	}
+	if len(decisions) != 1 {
+		t.Fatalf("expected a decision, got %d", len(decisions))
+	}
+	d := decisions[0]
+	if d.Service != "foo" || d.Node != node || d.Attempt != 1 || d.Reason != "because 1" {
+		t.Fatalf("unexpected decision %+v", d)
+	}
+	if len(d.Candidates) != 1 || d.Candidates[0].Id != "1" {
+		t.Fatalf("expected the candidates left by the filter, got %v", d.Candidates)
+	}
+
+	// errors of the selector are reported too
+	if _, err := s.Select("bar"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if d := decisions[len(decisions)-1]; d.Service != "bar" || d.Error == nil {
+		t.Fatalf("expected the error reported, got %+v", d)
+	}
+}
+
+type testClient struct {
+	client.Client
+	s selector.Selector
+}
+
+func (c *testClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	var options client.CallOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	next, err := c.s.Select("foo", options.SelectOptions...)
+	if err != nil {
+		return err
+	}
+	_, err = next()
+	return err
+}
+
+func TestWrapper(t *testing.T) {
+	s := NewSelector(selector.NewSelector(selector.Registry(newRegistry(t))))
+	c := NewClientWrapper()(&testClient{s: s})
+
+	tracer := mocktracer.New()
+	span := tracer.StartSpan("foo.Call")
+	ctx := opentracing.ContextWithSpan(context.Background(), span)
+
+	if err := c.Call(ctx, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	span.Finish()
+
+	logs := tracer.FinishedSpans()[0].Logs()
+	if len(logs) != 1 {
+		t.Fatalf("expected the decision logged, got %d logs", len(logs))
+	}
+	fields := make(map[string]string)
+	for _, f := range logs[0].Fields {
+		fields[f.Key] = f.ValueString
+	}
+	if fields["selector.service"] != "foo" || fields["selector.candidates"] != "1,2" || len(fields["selector.node"]) == 0 {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+}
@@ -0,0 +1,89 @@
+package trace
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/micro/go-micro/v2/client"
+	opentracing "github.com/opentracing/opentracing-go"
+	opentracinglog "github.com/opentracing/opentracing-go/log"
+)
+
+type traceWrapper struct {
+	client.Client
+}
+
+// recorder collects the decisions of a call
+type recorder struct {
+	sync.Mutex
+	decisions []*Decision
+}
+
+func (r *recorder) hook(d *Decision) {
+	r.Lock()
+	r.decisions = append(r.decisions, d)
+	r.Unlock()
+}
+
+// log adds the decisions to the span of the call
+func (r *recorder) log(ctx context.Context) {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	for _, d := range r.decisions {
+		ids := make([]string, 0, len(d.Candidates))
+		for _, n := range d.Candidates {
+			ids = append(ids, n.Id)
+		}
+
+		fields := []opentracinglog.Field{
+			opentracinglog.String("event", "select"),
+			opentracinglog.String("selector", d.Selector),
+			opentracinglog.String("selector.service", d.Service),
+			opentracinglog.String("selector.candidates", strings.Join(ids, ",")),
+			opentracinglog.Int("selector.attempt", d.Attempt),
+		}
+		if d.Node != nil {
+			fields = append(fields,
+				opentracinglog.String("selector.node", d.Node.Id),
+				opentracinglog.String("selector.address", d.Node.Address),
+			)
+		}
+		if len(d.Reason) > 0 {
+			fields = append(fields, opentracinglog.String("selector.reason", d.Reason))
+		}
+		if d.Error != nil {
+			fields = append(fields, opentracinglog.String("selector.error", d.Error.Error()))
+		}
+		span.LogFields(fields...)
+	}
+}
+
+func (t *traceWrapper) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	r := new(recorder)
+	err := t.Client.Call(ctx, req, rsp, append(opts, client.WithSelectOption(WithHook(r.hook)))...)
+	r.log(ctx)
+	return err
+}
+
+func (t *traceWrapper) Stream(ctx context.Context, req client.Request, opts ...client.CallOption) (client.Stream, error) {
+	r := new(recorder)
+	stream, err := t.Client.Stream(ctx, req, append(opts, client.WithSelectOption(WithHook(r.hook)))...)
+	r.log(ctx)
+	return stream, err
+}
+
+// NewClientWrapper returns a client wrapper adding the decisions of the selector to
+// the span of the call. The selector of the client must be wrapped by NewSelector and
+// the wrapper placed after the opentracing wrapper starting the span
+func NewClientWrapper() client.Wrapper {
+	return func(c client.Client) client.Client {
+		return &traceWrapper{c}
+	}
+}
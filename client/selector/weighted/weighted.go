@@ -0,0 +1,135 @@
+// Package weighted is a selector distributing calls in proportion to the weight of nodes
+package weighted
+
+import (
+	"sync"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/config/cmd"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-plugins/client/selector/weighted/v2/internal/weight"
+)
+
+/*
+	The weight of a node is read from its metadata, as set by the consul, etcd and
+	kubernetes registries. Calls are spread with smooth weighted round robin, the
+	algorithm of nginx, which interleaves the nodes rather than sending a burst of
+	calls to the heaviest node before moving on. A canary of weight 5 next to a node
+	of weight 95 takes every twentieth call.
+
+	Nodes of weight 0 are a last resort, they're only picked once every other node
+	was tried. Retries of a call go to nodes it didn't try yet.
+*/
+
+type weightedSelector struct {
+	selector.Selector
+}
+
+// wrr holds the current weights of the nodes across calls, keyed by service and node id
+type wrr struct {
+	sync.Mutex
+	current map[string]map[string]int
+}
+
+func init() {
+	cmd.DefaultSelectors["weighted"] = NewSelector
+}
+
+// pick returns the node of the next turn, the caller holds the lock
+func (s *wrr) pick(current map[string]int, nodes []*registry.Node, tried map[string]bool) *registry.Node {
+	var best *registry.Node
+	var total int
+
+	for _, n := range nodes {
+		if tried[n.Id] {
+			continue
+		}
+		w := weight.Get(n.Metadata)
+		if w == 0 {
+			continue
+		}
+		current[n.Id] += w
+		total += w
+		if best == nil || current[n.Id] > current[best.Id] {
+			best = n
+		}
+	}
+
+	if best != nil {
+		current[best.Id] -= total
+		return best
+	}
+
+	// only nodes of weight 0 are left
+	for _, n := range nodes {
+		if !tried[n.Id] {
+			return n
+		}
+	}
+	return nil
+}
+
+func (s *wrr) next(services []*registry.Service) selector.Next {
+	var nodes []*registry.Node
+	for _, service := range services {
+		nodes = append(nodes, service.Nodes...)
+	}
+
+	var name string
+	if len(services) > 0 {
+		name = services[0].Name
+	}
+
+	s.Lock()
+	current, ok := s.current[name]
+	if !ok {
+		current = make(map[string]int)
+		s.current[name] = current
+	}
+	// forget the nodes which are gone
+	ids := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		ids[n.Id] = true
+	}
+	for id := range current {
+		if !ids[id] {
+			delete(current, id)
+		}
+	}
+	s.Unlock()
+
+	tried := make(map[string]bool, len(nodes))
+
+	return func() (*registry.Node, error) {
+		s.Lock()
+		defer s.Unlock()
+
+		node := s.pick(current, nodes, tried)
+		if node == nil {
+			return nil, selector.ErrNoneAvailable
+		}
+		tried[node.Id] = true
+		return node, nil
+	}
+}
+
+// NewStrategy returns a smooth weighted round robin strategy, e.g to use with
+// selector.SetStrategy. The strategy keeps the turns of the nodes across calls
+func NewStrategy() selector.Strategy {
+	s := &wrr{
+		current: make(map[string]map[string]int),
+	}
+	return s.next
+}
+
+func (w *weightedSelector) String() string {
+	return "weighted"
+}
+
+// NewSelector returns the registry selector with the weighted round robin strategy
+func NewSelector(opts ...selector.Option) selector.Selector {
+	opts = append([]selector.Option{selector.SetStrategy(NewStrategy())}, opts...)
+	return &weightedSelector{
+		Selector: selector.NewSelector(opts...),
+	}
+}
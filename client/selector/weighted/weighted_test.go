@@ -0,0 +1,86 @@
+package weighted
+
+import (
+	"testing"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/registry/memory"
+	"github.com/micro/go-plugins/client/selector/weighted/v2/internal/weight"
+)
+
+func node(id, w string) *registry.Node {
+	n := &registry.Node{Id: id, Address: id + ":8080", Metadata: map[string]string{}}
+	if len(w) > 0 {
+		n.Metadata[weight.Key] = w
+	}
+	return n
+}
+
+func TestWeighted(t *testing.T) {
+	r := memory.NewRegistry()
+	r.Register(&registry.Service{
+		Name:    "foo",
+		Version: "1",
+		Nodes:   []*registry.Node{node("stable", "95")},
+	})
+	r.Register(&registry.Service{
+		Name:    "foo",
+		Version: "2",
+		Nodes:   []*registry.Node{node("canary", "5")},
+	})
+	s := NewSelector(selector.Registry(r))
+
+	counts := make(map[string]int)
+	var last string
+	for i := 0; i < 200; i++ {
+		next, err := s.Select("foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.Id == "canary" && last == "canary" {
+			t.Fatal("expected the canary to be interleaved with the stable node")
+		}
+		counts[n.Id]++
+		last = n.Id
+	}
+	if counts["canary"] != 10 || counts["stable"] != 190 {
+		t.Fatalf("expected 5%% of the calls on the canary, got %v", counts)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	services := []*registry.Service{{
+		Name: "foo",
+		Nodes: []*registry.Node{
+			node("1", "10"),
+			node("2", "0"),
+			node("3", ""),
+			node("4", "invalid"),
+		},
+	}}
+	next := NewStrategy()(services)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		n, err := next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[n.Id] {
+			t.Fatalf("node %s returned twice", n.Id)
+		}
+		seen[n.Id] = true
+		// nodes of weight 0 come last
+		if i < 3 && n.Id == "2" {
+			t.Fatal("expected the node of weight 0 to be the last resort")
+		}
+	}
+	if _, err := next(); err != selector.ErrNoneAvailable {
+		t.Fatalf("expected %v, got %v", selector.ErrNoneAvailable, err)
+	}
+}
@@ -0,0 +1,301 @@
+// Package avro provides an avro codec with schema resolution and the Confluent wire format
+package avro
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/hamba/avro"
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/codec"
+	"github.com/micro/go-micro/v2/server"
+)
+
+/*
+	Avro values don't describe themselves, each type needs the schema it's read and
+	written with. Values written with another schema, set with WriterSchema or found
+	through the id of the wire format, are resolved to the schema read as the Avro
+	specification lays out: fields are matched by name, those missing get their
+	default, numbers are promoted and unions pick their matching branch. The value
+	is resolved to the encoding of the schema read and then decoded, so the types
+	only ever see their own schema.
+
+	As with the json codec the message header travels in the transport headers and
+	only the body is encoded.
+*/
+
+// ContentType is the content type the codec is registered with
+const ContentType = "application/avro"
+
+// magic is the first byte of the Confluent wire format
+const magic = 0
+
+var (
+	// schemas of NewCodec, set with Register
+	defaultSchemas = newSchemas()
+)
+
+func init() {
+	client.DefaultCodecs[ContentType] = NewCodec
+	server.DefaultCodecs[ContentType] = NewCodec
+}
+
+// schemas holds the schemas of the types
+type schemas struct {
+	registry Registry
+
+	sync.RWMutex
+	readers map[reflect.Type]avro.Schema
+	writers map[reflect.Type]avro.Schema
+	// errors of the compatibility checks, keyed by the fingerprints of the schemas
+	checked map[[2][32]byte]error
+}
+
+func newSchemas() *schemas {
+	return &schemas{
+		readers: make(map[reflect.Type]avro.Schema),
+		writers: make(map[reflect.Type]avro.Schema),
+		checked: make(map[[2][32]byte]error),
+	}
+}
+
+// Register sets the schema of the type of the value for NewCodec
+func Register(v interface{}, schema string) error {
+	s, err := avro.Parse(schema)
+	if err != nil {
+		return err
+	}
+	defaultSchemas.Lock()
+	defaultSchemas.readers[typeOf(v)] = s
+	defaultSchemas.Unlock()
+	return nil
+}
+
+// compile parses the schemas of the options
+func compile(opts ...Option) (*schemas, error) {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+
+	s := newSchemas()
+	s.registry = options.Registry
+	for t, schema := range options.Schemas {
+		p, err := avro.Parse(schema)
+		if err != nil {
+			return nil, fmt.Errorf("avro: schema of %s: %v", t, err)
+		}
+		s.readers[t] = p
+	}
+	for t, schema := range options.WriterSchemas {
+		p, err := avro.Parse(schema)
+		if err != nil {
+			return nil, fmt.Errorf("avro: writer schema of %s: %v", t, err)
+		}
+		reader, ok := s.readers[t]
+		if !ok {
+			return nil, fmt.Errorf("avro: writer schema of %s without a schema", t)
+		}
+		if err := s.check(reader, p); err != nil {
+			return nil, err
+		}
+		s.writers[t] = p
+	}
+	return s, nil
+}
+
+// empty returns whether the body carries no value
+func empty(v interface{}) bool {
+	t := typeOf(v)
+	return t == nil || (t.Kind() == reflect.Struct && t.NumField() == 0)
+}
+
+// lookup returns the schema the value is read and written with and the one peers
+// write it with
+func (s *schemas) lookup(v interface{}) (avro.Schema, avro.Schema, error) {
+	t := typeOf(v)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	reader, ok := s.readers[t]
+	if !ok {
+		return nil, nil, fmt.Errorf("avro: no schema for %s", t)
+	}
+	if writer, ok := s.writers[t]; ok {
+		return reader, writer, nil
+	}
+	return reader, reader, nil
+}
+
+// check returns whether values of the writer schema can be read as the reader schema
+func (s *schemas) check(reader, writer avro.Schema) error {
+	key := [2][32]byte{reader.Fingerprint(), writer.Fingerprint()}
+
+	s.RLock()
+	err, ok := s.checked[key]
+	s.RUnlock()
+	if ok {
+		return err
+	}
+
+	err = avro.NewSchemaCompatibility().Compatible(reader, writer)
+	s.Lock()
+	s.checked[key] = err
+	s.Unlock()
+	return err
+}
+
+func (s *schemas) encode(w *avro.Writer, v interface{}) error {
+	schema, _, err := s.lookup(v)
+	if err != nil {
+		return err
+	}
+
+	if s.registry != nil {
+		id, err := s.registry.ID(schema)
+		if err != nil {
+			return err
+		}
+		var h [5]byte
+		h[0] = magic
+		binary.BigEndian.PutUint32(h[1:], uint32(id))
+		w.Write(h[:])
+	}
+
+	w.WriteVal(schema, v)
+	return w.Error
+}
+
+func (s *schemas) decode(r *avro.Reader, v interface{}) error {
+	reader, writer, err := s.lookup(v)
+	if err != nil {
+		return err
+	}
+
+	if s.registry != nil {
+		var h [5]byte
+		r.Read(h[:])
+		if r.Error != nil {
+			return r.Error
+		}
+		if h[0] != magic {
+			return errors.New("avro: unknown magic byte")
+		}
+		writer, err = s.registry.Schema(int(binary.BigEndian.Uint32(h[1:])))
+		if err != nil {
+			return err
+		}
+	}
+
+	if writer.Fingerprint() == reader.Fingerprint() {
+		r.ReadVal(reader, v)
+		return r.Error
+	}
+
+	if err := s.check(reader, writer); err != nil {
+		return err
+	}
+	w := avro.NewWriter(nil, 512)
+	if err := resolve(r, w, writer, reader); err != nil {
+		return err
+	}
+	return avro.Unmarshal(reader, w.Buffer(), v)
+}
+
+type avroCodec struct {
+	conn    io.ReadWriteCloser
+	r       *avro.Reader
+	w       *avro.Writer
+	schemas *schemas
+}
+
+func (c *avroCodec) ReadHeader(m *codec.Message, t codec.MessageType) error {
+	return nil
+}
+
+func (c *avroCodec) ReadBody(b interface{}) error {
+	if empty(b) {
+		return nil
+	}
+	c.r.Error = nil
+	return c.schemas.decode(c.r, b)
+}
+
+func (c *avroCodec) Write(m *codec.Message, b interface{}) error {
+	if empty(b) {
+		return nil
+	}
+	c.w.Error = nil
+	if err := c.schemas.encode(c.w, b); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+func (c *avroCodec) Close() error {
+	return c.conn.Close()
+}
+
+func (c *avroCodec) String() string {
+	return "avro"
+}
+
+func newCodec(conn io.ReadWriteCloser, s *schemas) codec.Codec {
+	return &avroCodec{
+		conn:    conn,
+		r:       avro.NewReader(conn, 1024),
+		w:       avro.NewWriter(conn, 1024),
+		schemas: s,
+	}
+}
+
+// NewCodec returns a codec of the schemas set with Register
+func NewCodec(conn io.ReadWriteCloser) codec.Codec {
+	return newCodec(conn, defaultSchemas)
+}
+
+// NewCodecFunc returns a codec constructor with the options, to be set on the
+// client and server e.g client.Codec(avro.ContentType, fn)
+func NewCodecFunc(opts ...Option) (codec.NewCodec, error) {
+	s, err := compile(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return func(conn io.ReadWriteCloser) codec.Codec {
+		return newCodec(conn, s)
+	}, nil
+}
+
+type marshaler struct {
+	schemas *schemas
+}
+
+func (m *marshaler) Marshal(v interface{}) ([]byte, error) {
+	w := avro.NewWriter(nil, 512)
+	if err := m.schemas.encode(w, v); err != nil {
+		return nil, err
+	}
+	return w.Buffer(), nil
+}
+
+func (m *marshaler) Unmarshal(b []byte, v interface{}) error {
+	return m.schemas.decode(avro.NewReader(nil, 0).Reset(b), v)
+}
+
+func (m *marshaler) String() string {
+	return "avro"
+}
+
+// NewMarshaler returns a marshaler with the options, e.g for brokers writing to Kafka
+func NewMarshaler(opts ...Option) (codec.Marshaler, error) {
+	s, err := compile(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &marshaler{schemas: s}, nil
+}
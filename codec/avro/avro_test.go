@@ -0,0 +1,203 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/micro/go-micro/v2/codec"
+)
+
+type buffer struct {
+	bytes.Buffer
+}
+
+func (b *buffer) Close() error {
+	return nil
+}
+
+const userV1 = `{
+	"type": "record",
+	"name": "User",
+	"namespace": "com.example",
+	"fields": [
+		{"name": "id", "type": "int"},
+		{"name": "name", "type": "string"},
+		{"name": "legacy", "type": "string"},
+		{"name": "kind", "type": {"type": "enum", "name": "Kind", "symbols": ["ADMIN", "MEMBER"]}},
+		{"name": "scores", "type": {"type": "array", "items": "int"}},
+		{"name": "nick", "type": "string"}
+	]
+}`
+
+const userV2 = `{
+	"type": "record",
+	"name": "User",
+	"namespace": "com.example",
+	"fields": [
+		{"name": "name", "type": "string"},
+		{"name": "id", "type": "long"},
+		{"name": "email", "type": ["null", "string"], "default": null},
+		{"name": "active", "type": "boolean", "default": true},
+		{"name": "kind", "type": {"type": "enum", "name": "Kind", "symbols": ["GUEST", "MEMBER", "ADMIN"]}},
+		{"name": "scores", "type": {"type": "array", "items": "double"}},
+		{"name": "nick", "type": ["null", "string"]}
+	]
+}`
+
+type userOld struct {
+	ID     int32   `avro:"id"`
+	Name   string  `avro:"name"`
+	Legacy string  `avro:"legacy"`
+	Kind   string  `avro:"kind"`
+	Scores []int32 `avro:"scores"`
+	Nick   string  `avro:"nick"`
+}
+
+type user struct {
+	Name   string    `avro:"name"`
+	ID     int64     `avro:"id"`
+	Email  *string   `avro:"email"`
+	Active bool      `avro:"active"`
+	Kind   string    `avro:"kind"`
+	Scores []float64 `avro:"scores"`
+	Nick   *string   `avro:"nick"`
+}
+
+var old = &userOld{ID: 7, Name: "john", Legacy: "x", Kind: "ADMIN", Scores: []int32{1, 2}, Nick: "jo"}
+
+func check(t *testing.T, u *user) {
+	t.Helper()
+	if u.Name != "john" || u.ID != 7 || u.Email != nil || !u.Active || u.Kind != "ADMIN" {
+		t.Fatalf("unexpected user %+v", u)
+	}
+	if len(u.Scores) != 2 || u.Scores[1] != 2 || u.Nick == nil || *u.Nick != "jo" {
+		t.Fatalf("unexpected user %+v", u)
+	}
+}
+
+func TestCodec(t *testing.T) {
+	fn, err := NewCodecFunc(Schema(user{}, userV2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(buffer)
+	c := fn(b)
+
+	email := "john@example.com"
+	in := []*user{
+		{Name: "john", ID: 1, Email: &email, Kind: "ADMIN"},
+		{Name: "jane", ID: 2, Active: true, Kind: "GUEST", Scores: []float64{1.5}},
+	}
+	for _, u := range in {
+		if err := c.Write(&codec.Message{Type: codec.Request}, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, u := range in {
+		var out user
+		if err := c.ReadBody(&out); err != nil {
+			t.Fatal(err)
+		}
+		if out.Name != u.Name || out.ID != u.ID || out.Kind != u.Kind || len(out.Scores) != len(u.Scores) {
+			t.Fatalf("expected %+v got %+v", u, out)
+		}
+	}
+
+	if err := c.Write(&codec.Message{Type: codec.Request}, struct{ Foo string }{}); err == nil {
+		t.Fatal("expected types without a schema to fail")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	writer, err := NewMarshaler(Schema(userOld{}, userV1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := writer.Marshal(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewMarshaler(Schema(user{}, userV2), WriterSchema(user{}, userV1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var u user
+	if err := reader.Unmarshal(b, &u); err != nil {
+		t.Fatal(err)
+	}
+	check(t, &u)
+
+	// a field without a default can't be missing
+	required := strings.Replace(userV2, `"type": "boolean", "default": true`, `"type": "boolean"`, 1)
+	if _, err := NewMarshaler(Schema(user{}, required), WriterSchema(user{}, userV1)); err == nil {
+		t.Fatal("expected incompatible schemas to fail")
+	}
+}
+
+// registry serves the schema registry api, the writer schema has id 7
+func registry(calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/subjects/com.example.User/versions":
+			var req struct {
+				Schema string `json:"schema"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !strings.Contains(req.Schema, "legacy") {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]int{"id": 7})
+		case r.Method == "GET" && r.URL.Path == "/schemas/ids/7":
+			json.NewEncoder(w).Encode(map[string]string{"schema": userV1})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error_code": 40403, "message": "Schema not found"})
+		}
+	}))
+}
+
+func TestWireFormat(t *testing.T) {
+	var calls int32
+	srv := registry(&calls)
+	defer srv.Close()
+
+	writer, err := NewMarshaler(Schema(userOld{}, userV1), WireFormat(NewRegistry(srv.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := writer.Marshal(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b, []byte{0, 0, 0, 0, 7}) {
+		t.Fatalf("expected the magic byte and the id got %x", b[:5])
+	}
+
+	// the writer schema is fetched by its id
+	reader, err := NewMarshaler(Schema(user{}, userV2), WireFormat(NewRegistry(srv.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		var u user
+		if err := reader.Unmarshal(b, &u); err != nil {
+			t.Fatal(err)
+		}
+		check(t, &u)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("expected the schemas to be cached got %d calls", n)
+	}
+
+	b[4] = 8
+	if err := reader.Unmarshal(b, new(user)); err == nil || !strings.Contains(err.Error(), "Schema not found") {
+		t.Fatalf("expected unknown ids to fail got %v", err)
+	}
+}
@@ -0,0 +1,8 @@
+module github.com/micro/go-plugins/codec/avro/v2
+
+go 1.13
+
+require (
+	github.com/hamba/avro v1.6.6
+	github.com/micro/go-micro/v2 v2.9.1
+)
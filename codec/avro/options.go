@@ -0,0 +1,56 @@
+package avro
+
+import (
+	"reflect"
+)
+
+type Options struct {
+	// Schemas of the types, the schemas written and read
+	Schemas map[reflect.Type]string
+	// WriterSchemas are the schemas the types were written with by peers, resolved
+	// to those of Schemas when read
+	WriterSchemas map[reflect.Type]string
+	// Registry enables the Confluent wire format, messages carry the id of the
+	// schema they were written with
+	Registry Registry
+}
+
+type Option func(*Options)
+
+// typeOf returns the type of the value, pointers or not
+func typeOf(v interface{}) reflect.Type {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// Schema sets the schema of the type of the value, e.g Schema(User{}, schema)
+func Schema(v interface{}, schema string) Option {
+	return func(o *Options) {
+		if o.Schemas == nil {
+			o.Schemas = make(map[reflect.Type]string)
+		}
+		o.Schemas[typeOf(v)] = schema
+	}
+}
+
+// WriterSchema sets the schema peers write the type of the value with, when it
+// differs from the one set with Schema
+func WriterSchema(v interface{}, schema string) Option {
+	return func(o *Options) {
+		if o.WriterSchemas == nil {
+			o.WriterSchemas = make(map[reflect.Type]string)
+		}
+		o.WriterSchemas[typeOf(v)] = schema
+	}
+}
+
+// WireFormat writes and reads messages in the Confluent wire format, a magic byte
+// and the id of the schema in the registry followed by the value
+func WireFormat(r Registry) Option {
+	return func(o *Options) {
+		o.Registry = r
+	}
+}
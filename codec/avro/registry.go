@@ -0,0 +1,160 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hamba/avro"
+)
+
+// Registry maps schemas to the ids of the Confluent wire format
+type Registry interface {
+	// Schema returns the schema of the id
+	Schema(id int) (avro.Schema, error)
+	// ID returns the id of the schema, registering it if it's new
+	ID(schema avro.Schema) (int, error)
+}
+
+// contentType is the content type of the schema registry api
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+// DefaultTimeout is the timeout of requests to the schema registry without HTTPClient
+var DefaultTimeout = 10 * time.Second
+
+type httpRegistry struct {
+	url     string
+	client  *http.Client
+	subject func(avro.Schema) string
+
+	sync.RWMutex
+	schemas map[int]avro.Schema
+	ids     map[[32]byte]int
+}
+
+// RegistryOption configures the schema registry client
+type RegistryOption func(*httpRegistry)
+
+// HTTPClient sets the http client calling the schema registry
+func HTTPClient(c *http.Client) RegistryOption {
+	return func(r *httpRegistry) {
+		r.client = c
+	}
+}
+
+// Subject sets the subject schemas are registered under, the full name of the
+// schema by default as with the record name strategy
+func Subject(fn func(avro.Schema) string) RegistryOption {
+	return func(r *httpRegistry) {
+		r.subject = fn
+	}
+}
+
+// recordName returns the full name of the schema
+func recordName(s avro.Schema) string {
+	if n, ok := s.(avro.NamedSchema); ok {
+		return n.FullName()
+	}
+	return string(s.Type())
+}
+
+func (r *httpRegistry) do(method, path string, body interface{}, rsp interface{}) error {
+	var b bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&b).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, r.url+path, &b)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", contentType)
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var e struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(res.Body).Decode(&e)
+		return fmt.Errorf("schema registry: %s %s: %d %s", method, path, res.StatusCode, e.Message)
+	}
+	return json.NewDecoder(res.Body).Decode(rsp)
+}
+
+func (r *httpRegistry) Schema(id int) (avro.Schema, error) {
+	r.RLock()
+	s, ok := r.schemas[id]
+	r.RUnlock()
+	if ok {
+		return s, nil
+	}
+
+	var rsp struct {
+		Schema string `json:"schema"`
+	}
+	if err := r.do("GET", "/schemas/ids/"+strconv.Itoa(id), nil, &rsp); err != nil {
+		return nil, err
+	}
+	s, err := avro.Parse(rsp.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Lock()
+	r.schemas[id] = s
+	r.Unlock()
+	return s, nil
+}
+
+func (r *httpRegistry) ID(s avro.Schema) (int, error) {
+	r.RLock()
+	id, ok := r.ids[s.Fingerprint()]
+	r.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	var rsp struct {
+		ID int `json:"id"`
+	}
+	body := map[string]string{"schema": s.String()}
+	path := "/subjects/" + url.PathEscape(r.subject(s)) + "/versions"
+	if err := r.do("POST", path, body, &rsp); err != nil {
+		return 0, err
+	}
+
+	r.Lock()
+	r.ids[s.Fingerprint()] = rsp.ID
+	r.schemas[rsp.ID] = s
+	r.Unlock()
+	return rsp.ID, nil
+}
+
+// NewRegistry returns a client of the Confluent schema registry at the url
+func NewRegistry(addr string, opts ...RegistryOption) Registry {
+	r := &httpRegistry{
+		url:     strings.TrimSuffix(addr, "/"),
+		client:  &http.Client{Timeout: DefaultTimeout},
+		subject: recordName,
+		schemas: make(map[int]avro.Schema),
+		ids:     make(map[[32]byte]int),
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
@@ -0,0 +1,351 @@
+package avro
+
+import (
+	"fmt"
+
+	"github.com/hamba/avro"
+)
+
+// deref returns the schema a reference points to
+func deref(s avro.Schema) avro.Schema {
+	if ref, ok := s.(*avro.RefSchema); ok {
+		return ref.Schema()
+	}
+	return s
+}
+
+// name returns the name of a named schema, empty for others
+func name(s avro.Schema) string {
+	if n, ok := s.(avro.NamedSchema); ok {
+		return n.Name()
+	}
+	return ""
+}
+
+// promotes returns whether values of the writer type can be read as the reader type
+func promotes(writer, reader avro.Type) bool {
+	if writer == reader {
+		return true
+	}
+	switch writer {
+	case avro.Int:
+		return reader == avro.Long || reader == avro.Float || reader == avro.Double
+	case avro.Long:
+		return reader == avro.Float || reader == avro.Double
+	case avro.Float:
+		return reader == avro.Double
+	case avro.String:
+		return reader == avro.Bytes
+	case avro.Bytes:
+		return reader == avro.String
+	}
+	return false
+}
+
+// branch returns the branch of the reader union values of the writer schema are
+// read as, the first of the same type and name or else the first promoted to
+func branch(writer avro.Schema, reader *avro.UnionSchema) (int, avro.Schema, bool) {
+	types := reader.Types()
+	for i, t := range types {
+		t = deref(t)
+		if t.Type() == writer.Type() && name(t) == name(writer) {
+			return i, t, true
+		}
+	}
+	for i, t := range types {
+		t = deref(t)
+		if promotes(writer.Type(), t.Type()) {
+			return i, t, true
+		}
+	}
+	return 0, nil, false
+}
+
+func mismatch(writer, reader avro.Schema) error {
+	return fmt.Errorf("avro: %s written can't be read as %s", writer.Type(), reader.Type())
+}
+
+// resolve reads a value written with the writer schema and writes it as the reader
+// schema, following the schema resolution of the Avro specification
+func resolve(r *avro.Reader, w *avro.Writer, writer, reader avro.Schema) error {
+	writer, reader = deref(writer), deref(reader)
+
+	if ws, ok := writer.(*avro.UnionSchema); ok {
+		i := int(r.ReadLong())
+		if r.Error != nil {
+			return r.Error
+		}
+		if i < 0 || i >= len(ws.Types()) {
+			return fmt.Errorf("avro: union index %d out of range", i)
+		}
+		return resolve(r, w, ws.Types()[i], reader)
+	}
+	if rs, ok := reader.(*avro.UnionSchema); ok {
+		i, t, ok := branch(writer, rs)
+		if !ok {
+			return fmt.Errorf("avro: %s written isn't in the union read", writer.Type())
+		}
+		w.WriteLong(int64(i))
+		return resolve(r, w, writer, t)
+	}
+	if !promotes(writer.Type(), reader.Type()) {
+		return mismatch(writer, reader)
+	}
+
+	switch writer.Type() {
+	case avro.Null:
+	case avro.Boolean:
+		w.WriteBool(r.ReadBool())
+	case avro.Int:
+		v := r.ReadInt()
+		switch reader.Type() {
+		case avro.Int:
+			w.WriteInt(v)
+		case avro.Long:
+			w.WriteLong(int64(v))
+		case avro.Float:
+			w.WriteFloat(float32(v))
+		case avro.Double:
+			w.WriteDouble(float64(v))
+		}
+	case avro.Long:
+		v := r.ReadLong()
+		switch reader.Type() {
+		case avro.Long:
+			w.WriteLong(v)
+		case avro.Float:
+			w.WriteFloat(float32(v))
+		case avro.Double:
+			w.WriteDouble(float64(v))
+		}
+	case avro.Float:
+		v := r.ReadFloat()
+		switch reader.Type() {
+		case avro.Float:
+			w.WriteFloat(v)
+		case avro.Double:
+			w.WriteDouble(float64(v))
+		}
+	case avro.Double:
+		w.WriteDouble(r.ReadDouble())
+	case avro.String, avro.Bytes:
+		// both are written as a length and the bytes
+		w.WriteBytes(r.ReadBytes())
+	case avro.Fixed:
+		ws, rs := writer.(*avro.FixedSchema), reader.(*avro.FixedSchema)
+		if ws.Size() != rs.Size() || ws.Name() != rs.Name() {
+			return fmt.Errorf("avro: fixed %s written can't be read as %s", ws.FullName(), rs.FullName())
+		}
+		b := make([]byte, ws.Size())
+		r.Read(b)
+		w.Write(b)
+	case avro.Enum:
+		return resolveEnum(r, w, writer.(*avro.EnumSchema), reader.(*avro.EnumSchema))
+	case avro.Array:
+		items := reader.(*avro.ArraySchema).Items()
+		return resolveBlocks(r, w, func() error {
+			return resolve(r, w, writer.(*avro.ArraySchema).Items(), items)
+		})
+	case avro.Map:
+		values := reader.(*avro.MapSchema).Values()
+		return resolveBlocks(r, w, func() error {
+			w.WriteString(r.ReadString())
+			return resolve(r, w, writer.(*avro.MapSchema).Values(), values)
+		})
+	case avro.Record:
+		return resolveRecord(r, w, writer.(*avro.RecordSchema), reader.(*avro.RecordSchema))
+	default:
+		return mismatch(writer, reader)
+	}
+	return r.Error
+}
+
+func resolveEnum(r *avro.Reader, w *avro.Writer, writer, reader *avro.EnumSchema) error {
+	i := int(r.ReadInt())
+	if r.Error != nil {
+		return r.Error
+	}
+	if i < 0 || i >= len(writer.Symbols()) {
+		return fmt.Errorf("avro: enum index %d out of range", i)
+	}
+	symbol := writer.Symbols()[i]
+	for j, s := range reader.Symbols() {
+		if s == symbol {
+			w.WriteInt(int32(j))
+			return nil
+		}
+	}
+	return fmt.Errorf("avro: symbol %s isn't in the enum %s read", symbol, reader.FullName())
+}
+
+// resolveBlocks resolves the items of an array or map, block by block
+func resolveBlocks(r *avro.Reader, w *avro.Writer, item func() error) error {
+	for {
+		n, _ := r.ReadBlockHeader()
+		if r.Error != nil {
+			return r.Error
+		}
+		if n == 0 {
+			w.WriteLong(0)
+			return nil
+		}
+		w.WriteLong(n)
+		for i := int64(0); i < n; i++ {
+			if err := item(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// resolveRecord reads the fields in the order written and writes them in the order
+// read, fields which weren't written get their default and those which aren't read
+// are skipped
+func resolveRecord(r *avro.Reader, w *avro.Writer, writer, reader *avro.RecordSchema) error {
+	read := make(map[string]*avro.Field, len(reader.Fields()))
+	for _, f := range reader.Fields() {
+		read[f.Name()] = f
+	}
+
+	values := make(map[string][]byte, len(reader.Fields()))
+	for _, f := range writer.Fields() {
+		fw := avro.NewWriter(nil, 64)
+		rf, ok := read[f.Name()]
+		if !ok {
+			// resolved as written to be skipped
+			if err := resolve(r, fw, f.Type(), f.Type()); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := resolve(r, fw, f.Type(), rf.Type()); err != nil {
+			return fmt.Errorf("%v in field %s", err, f.Name())
+		}
+		values[f.Name()] = fw.Buffer()
+	}
+
+	for _, f := range reader.Fields() {
+		if v, ok := values[f.Name()]; ok {
+			w.Write(v)
+			continue
+		}
+		if !f.HasDefault() {
+			return fmt.Errorf("avro: field %s of %s wasn't written and has no default", f.Name(), reader.FullName())
+		}
+		if err := writeDefault(w, f.Type(), f.Default()); err != nil {
+			return fmt.Errorf("%v in the default of field %s", err, f.Name())
+		}
+	}
+	return nil
+}
+
+// writeDefault writes the default of a field, as parsed from the schema
+func writeDefault(w *avro.Writer, s avro.Schema, def interface{}) error {
+	s = deref(s)
+
+	var ok bool
+	switch s.Type() {
+	case avro.Null:
+		ok = true
+	case avro.Boolean:
+		var v bool
+		if v, ok = def.(bool); ok {
+			w.WriteBool(v)
+		}
+	case avro.Int:
+		var v int
+		if v, ok = def.(int); ok {
+			w.WriteInt(int32(v))
+		}
+	case avro.Long:
+		var v int64
+		if v, ok = def.(int64); ok {
+			w.WriteLong(v)
+		}
+	case avro.Float:
+		var v float32
+		if v, ok = def.(float32); ok {
+			w.WriteFloat(v)
+		}
+	case avro.Double:
+		var v float64
+		if v, ok = def.(float64); ok {
+			w.WriteDouble(v)
+		}
+	case avro.String:
+		var v string
+		if v, ok = def.(string); ok {
+			w.WriteString(v)
+		}
+	case avro.Bytes, avro.Fixed:
+		// the code points of the string are the bytes
+		var v string
+		if v, ok = def.(string); ok {
+			b := make([]byte, 0, len(v))
+			for _, c := range v {
+				b = append(b, byte(c))
+			}
+			if s.Type() == avro.Bytes {
+				w.WriteBytes(b)
+			} else {
+				w.Write(b)
+			}
+		}
+	case avro.Enum:
+		var v string
+		if v, ok = def.(string); ok {
+			ok = false
+			for i, symbol := range s.(*avro.EnumSchema).Symbols() {
+				if symbol == v {
+					w.WriteInt(int32(i))
+					ok = true
+				}
+			}
+		}
+	case avro.Array:
+		var v []interface{}
+		if v, ok = def.([]interface{}); ok {
+			if len(v) > 0 {
+				w.WriteLong(int64(len(v)))
+			}
+			for _, item := range v {
+				if err := writeDefault(w, s.(*avro.ArraySchema).Items(), item); err != nil {
+					return err
+				}
+			}
+			w.WriteLong(0)
+		}
+	case avro.Map:
+		var v map[string]interface{}
+		if v, ok = def.(map[string]interface{}); ok {
+			if len(v) > 0 {
+				w.WriteLong(int64(len(v)))
+			}
+			for k, item := range v {
+				w.WriteString(k)
+				if err := writeDefault(w, s.(*avro.MapSchema).Values(), item); err != nil {
+					return err
+				}
+			}
+			w.WriteLong(0)
+		}
+	case avro.Union:
+		// defaults are of the first type of unions
+		w.WriteLong(0)
+		return writeDefault(w, s.(*avro.UnionSchema).Types()[0], def)
+	case avro.Record:
+		var v map[string]interface{}
+		if v, ok = def.(map[string]interface{}); ok {
+			for _, f := range s.(*avro.RecordSchema).Fields() {
+				if err := writeDefault(w, f.Type(), v[f.Name()]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if !ok {
+		return fmt.Errorf("avro: invalid default %v for %s", def, s.Type())
+	}
+	return nil
+}
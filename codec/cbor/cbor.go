@@ -0,0 +1,114 @@
+// Package cbor provides a cbor codec
+package cbor
+
+import (
+	"io"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/codec"
+	"github.com/micro/go-micro/v2/server"
+)
+
+/*
+	Like the json codec the message header travels in the transport headers and
+	only the body is encoded, one cbor item per message. Structs are encoded by
+	their cbor tags, or json tags without, so generated protobuf types can be sent
+	too. Encoding is deterministic by default, the same value gives the same bytes
+	which lets payloads be hashed, signed or deduplicated.
+*/
+
+// ContentType is the content type the codec is registered with
+const ContentType = "application/cbor"
+
+var (
+	defaultEnc, defaultDec, _ = modes()
+)
+
+func init() {
+	client.DefaultCodecs[ContentType] = NewCodec
+	server.DefaultCodecs[ContentType] = NewCodec
+}
+
+type cborCodec struct {
+	conn io.ReadWriteCloser
+	enc  *cbor.Encoder
+	dec  *cbor.Decoder
+}
+
+func (c *cborCodec) ReadHeader(m *codec.Message, t codec.MessageType) error {
+	return nil
+}
+
+func (c *cborCodec) ReadBody(b interface{}) error {
+	if b == nil {
+		return nil
+	}
+	return c.dec.Decode(b)
+}
+
+func (c *cborCodec) Write(m *codec.Message, b interface{}) error {
+	if b == nil {
+		return nil
+	}
+	return c.enc.Encode(b)
+}
+
+func (c *cborCodec) Close() error {
+	return c.conn.Close()
+}
+
+func (c *cborCodec) String() string {
+	return "cbor"
+}
+
+func newCodec(conn io.ReadWriteCloser, em cbor.EncMode, dm cbor.DecMode) codec.Codec {
+	return &cborCodec{
+		conn: conn,
+		enc:  em.NewEncoder(conn),
+		dec:  dm.NewDecoder(conn),
+	}
+}
+
+// NewCodec returns a codec encoding core deterministic cbor
+func NewCodec(conn io.ReadWriteCloser) codec.Codec {
+	return newCodec(conn, defaultEnc, defaultDec)
+}
+
+// NewCodecFunc returns a codec constructor with the options, to be set on the
+// client and server e.g client.Codec(cbor.ContentType, fn)
+func NewCodecFunc(opts ...Option) (codec.NewCodec, error) {
+	em, dm, err := modes(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return func(conn io.ReadWriteCloser) codec.Codec {
+		return newCodec(conn, em, dm)
+	}, nil
+}
+
+type marshaler struct {
+	enc cbor.EncMode
+	dec cbor.DecMode
+}
+
+func (m *marshaler) Marshal(v interface{}) ([]byte, error) {
+	return m.enc.Marshal(v)
+}
+
+func (m *marshaler) Unmarshal(b []byte, v interface{}) error {
+	return m.dec.Unmarshal(b, v)
+}
+
+func (m *marshaler) String() string {
+	return "cbor"
+}
+
+// NewMarshaler returns a marshaler with the options, e.g for brokers and stores
+func NewMarshaler(opts ...Option) (codec.Marshaler, error) {
+	em, dm, err := modes(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &marshaler{enc: em, dec: dm}, nil
+}
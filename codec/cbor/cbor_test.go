@@ -0,0 +1,112 @@
+package cbor
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/micro/go-micro/v2/codec"
+)
+
+type buffer struct {
+	bytes.Buffer
+}
+
+func (b *buffer) Close() error {
+	return nil
+}
+
+type reading struct {
+	Sensor string  `json:"sensor"`
+	Value  float64 `json:"value"`
+	Tags   map[string]string
+}
+
+func TestCodec(t *testing.T) {
+	b := new(buffer)
+	c := NewCodec(b)
+
+	in := []*reading{
+		{Sensor: "temp-1", Value: 21.5, Tags: map[string]string{"room": "kitchen"}},
+		{Sensor: "temp-2", Value: 19},
+	}
+	for _, r := range in {
+		if err := c.Write(&codec.Message{Type: codec.Request}, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, r := range in {
+		if err := c.ReadHeader(&codec.Message{}, codec.Request); err != nil {
+			t.Fatal(err)
+		}
+		var out reading
+		if err := c.ReadBody(&out); err != nil {
+			t.Fatal(err)
+		}
+		if out.Sensor != r.Sensor || out.Value != r.Value || out.Tags["room"] != r.Tags["room"] {
+			t.Fatalf("expected %+v got %+v", r, out)
+		}
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	m, err := NewMarshaler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := map[string]int{}
+	var first []byte
+	for i := 0; i < 20; i++ {
+		for _, k := range []string{"a", "bb", "c", "dd", "e"} {
+			keys[k] = len(k)
+		}
+		b, err := m.Marshal(keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = b
+		} else if !bytes.Equal(first, b) {
+			t.Fatal("expected the same encoding")
+		}
+	}
+
+	var out map[string]int
+	if err := m.Unmarshal(first, &out); err != nil || out["dd"] != 2 {
+		t.Fatalf("expected the map got %v %v", out, err)
+	}
+
+	// 100 encodes to 1864 and -1 to 20, length first sorts -1 first and
+	// bytewise sorts 100 first
+	ints := map[int]int{100: 1, -1: 2}
+	canonical, err := NewMarshaler(Canonical())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := canonical.Marshal(ints); err != nil || !bytes.HasPrefix(b, []byte{0xa2, 0x20}) {
+		t.Fatalf("expected the keys sorted length first got %x %v", b, err)
+	}
+	if b, err := m.Marshal(ints); err != nil || !bytes.HasPrefix(b, []byte{0xa2, 0x18, 0x64}) {
+		t.Fatalf("expected the keys sorted bytewise got %x %v", b, err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	if _, err := NewCodecFunc(EncOptions(cbor.EncOptions{Sort: 100})); err == nil {
+		t.Fatal("expected invalid options to fail")
+	}
+
+	fn, err := NewCodecFunc(DecOptions(cbor.DecOptions{DupMapKey: cbor.DupMapKeyEnforcedAPF}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(buffer)
+	// a map with the key a twice
+	b.Write([]byte{0xa2, 0x61, 'a', 0x01, 0x61, 'a', 0x02})
+	var out map[string]int
+	if err := fn(b).ReadBody(&out); err == nil {
+		t.Fatal("expected duplicate keys to fail")
+	}
+}
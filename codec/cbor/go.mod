@@ -0,0 +1,8 @@
+module github.com/micro/go-plugins/codec/cbor/v2
+
+go 1.13
+
+require (
+	github.com/fxamacker/cbor/v2 v2.2.0
+	github.com/micro/go-micro/v2 v2.9.1
+)
@@ -0,0 +1,77 @@
+package cbor
+
+import (
+	"github.com/fxamacker/cbor/v2"
+)
+
+type Options struct {
+	// Encoding options, core deterministic by default
+	Enc cbor.EncOptions
+	// Decoding options
+	Dec cbor.DecOptions
+}
+
+type Option func(*Options)
+
+// Canonical encodes as Canonical CBOR of RFC 7049, map keys sorted length first
+func Canonical() Option {
+	return func(o *Options) {
+		o.Enc = cbor.CanonicalEncOptions()
+	}
+}
+
+// CTAP2 encodes as CTAP2 Canonical CBOR, as used by FIDO2 authenticators
+func CTAP2() Option {
+	return func(o *Options) {
+		o.Enc = cbor.CTAP2EncOptions()
+	}
+}
+
+// CoreDeterministic encodes as Core Deterministic CBOR of RFC 7049bis, the default
+func CoreDeterministic() Option {
+	return func(o *Options) {
+		o.Enc = cbor.CoreDetEncOptions()
+	}
+}
+
+// Unsorted encodes with the shortest forms but leaves map keys unsorted, faster
+// for large maps when the encoding doesn't need to be deterministic
+func Unsorted() Option {
+	return func(o *Options) {
+		o.Enc = cbor.PreferredUnsortedEncOptions()
+	}
+}
+
+// EncOptions sets the encoding options
+func EncOptions(e cbor.EncOptions) Option {
+	return func(o *Options) {
+		o.Enc = e
+	}
+}
+
+// DecOptions sets the decoding options
+func DecOptions(d cbor.DecOptions) Option {
+	return func(o *Options) {
+		o.Dec = d
+	}
+}
+
+// modes returns the encoding and decoding modes of the options
+func modes(opts ...Option) (cbor.EncMode, cbor.DecMode, error) {
+	options := Options{
+		Enc: cbor.CoreDetEncOptions(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	em, err := options.Enc.EncMode()
+	if err != nil {
+		return nil, nil, err
+	}
+	dm, err := options.Dec.DecMode()
+	if err != nil {
+		return nil, nil, err
+	}
+	return em, dm, nil
+}
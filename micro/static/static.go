@@ -0,0 +1,244 @@
+// Package static is a micro plugin for serving static assets with single page app fallback
+package static
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/micro/cli/v2"
+	"github.com/micro/micro/v2/plugin"
+)
+
+var (
+	// DefaultIndex is the file served for directories and as the SPA fallback
+	DefaultIndex = "index.html"
+	// DefaultMaxAge is the Cache-Control max-age of assets other than the index
+	DefaultMaxAge = time.Hour
+)
+
+type Options struct {
+	// Prefix is the URL path assets are served under
+	Prefix string
+	// Index is the file served for directories and unknown paths in SPA mode
+	Index string
+	// MaxAge is the Cache-Control max-age of assets, the index is never cached
+	MaxAge time.Duration
+	// SPA serves the index for unknown paths which accept html
+	SPA bool
+}
+
+type Option func(*Options)
+
+// Prefix sets the URL path assets are served under
+func Prefix(p string) Option {
+	return func(o *Options) {
+		o.Prefix = p
+	}
+}
+
+// Index sets the name of the index file
+func Index(name string) Option {
+	return func(o *Options) {
+		o.Index = name
+	}
+}
+
+// MaxAge sets the Cache-Control max-age of assets
+func MaxAge(d time.Duration) Option {
+	return func(o *Options) {
+		o.MaxAge = d
+	}
+}
+
+// SPA enables history mode fallback to the index
+func SPA() Option {
+	return func(o *Options) {
+		o.SPA = true
+	}
+}
+
+type static struct {
+	fs   http.FileSystem
+	opts Options
+}
+
+func (s *static) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "static_dir",
+			Usage:   "Directory to serve static assets from",
+			EnvVars: []string{"STATIC_DIR"},
+		},
+		&cli.StringFlag{
+			Name:    "static_prefix",
+			Usage:   "URL path prefix to serve static assets under e.g /ui",
+			EnvVars: []string{"STATIC_PREFIX"},
+		},
+		&cli.DurationFlag{
+			Name:    "static_max_age",
+			Usage:   "Cache-Control max-age for static assets",
+			EnvVars: []string{"STATIC_MAX_AGE"},
+		},
+		&cli.BoolFlag{
+			Name:    "static_spa",
+			Usage:   "Serve the index for unknown paths to support single page app history mode",
+			EnvVars: []string{"STATIC_SPA"},
+		},
+	}
+}
+
+func (s *static) Commands() []*cli.Command {
+	return nil
+}
+
+// trimPrefix returns the path below the prefix, false unless the prefix ends at a
+// path boundary so /api doesn't match /apiv2
+func trimPrefix(p, prefix string) (string, bool) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if p == prefix {
+		return "", true
+	}
+	if !strings.HasPrefix(p, prefix+"/") {
+		return "", false
+	}
+	return p[len(prefix):], true
+}
+
+func (s *static) Handler() plugin.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			rest, ok := trimPrefix(r.URL.Path, s.opts.Prefix)
+			if !ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			name := path.Clean("/" + rest)
+
+			// serve the asset if it exists
+			if s.serve(w, r, name) {
+				return
+			}
+
+			// fallback to the index for client side routes
+			if s.opts.SPA && path.Ext(name) == "" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+				if s.serve(w, r, "/"+s.opts.Index) {
+					return
+				}
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// serve writes the named file and returns false if it does not exist
+func (s *static) serve(w http.ResponseWriter, r *http.Request, name string) bool {
+	f, err := s.fs.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	if fi.IsDir() {
+		return s.serve(w, r, path.Join(name, s.opts.Index))
+	}
+
+	if path.Base(name) == s.opts.Index {
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(s.opts.MaxAge.Seconds())))
+	}
+
+	// serve a precompressed variant if the client accepts it
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		if gz, err := s.fs.Open(name + ".gz"); err == nil {
+			defer gz.Close()
+			if gzi, err := gz.Stat(); err == nil && !gzi.IsDir() {
+				if ct := mime.TypeByExtension(path.Ext(name)); len(ct) > 0 {
+					w.Header().Set("Content-Type", ct)
+				}
+				w.Header().Set("Content-Encoding", "gzip")
+				w.Header().Add("Vary", "Accept-Encoding")
+				http.ServeContent(w, r, name, gzi.ModTime(), gz)
+				return true
+			}
+		}
+	}
+
+	http.ServeContent(w, r, name, fi.ModTime(), f)
+	return true
+}
+
+func (s *static) Init(ctx *cli.Context) error {
+	if dir := ctx.String("static_dir"); len(dir) > 0 {
+		if _, err := os.Stat(dir); err != nil {
+			return err
+		}
+		s.fs = http.Dir(dir)
+	}
+	if prefix := ctx.String("static_prefix"); len(prefix) > 0 {
+		s.opts.Prefix = prefix
+	}
+	if maxAge := ctx.Duration("static_max_age"); maxAge > 0 {
+		s.opts.MaxAge = maxAge
+	}
+	if ctx.Bool("static_spa") {
+		s.opts.SPA = true
+	}
+
+	if s.fs == nil {
+		return errors.New("static directory not specified")
+	}
+	return nil
+}
+
+func (s *static) String() string {
+	return "static"
+}
+
+func newStatic(fs http.FileSystem, opts ...Option) *static {
+	options := Options{
+		Prefix: "/",
+		Index:  DefaultIndex,
+		MaxAge: DefaultMaxAge,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return &static{
+		fs:   fs,
+		opts: options,
+	}
+}
+
+// NewPlugin creates a new plugin expecting the directory specified via flag
+func NewPlugin(opts ...Option) plugin.Plugin {
+	return newStatic(nil, opts...)
+}
+
+// WithDir creates a static plugin serving the given directory
+func WithDir(dir string, opts ...Option) plugin.Plugin {
+	return newStatic(http.Dir(dir), opts...)
+}
+
+// WithFileSystem creates a static plugin serving an embedded file system
+func WithFileSystem(fs http.FileSystem, opts ...Option) plugin.Plugin {
+	return newStatic(fs, opts...)
+}
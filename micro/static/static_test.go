@@ -0,0 +1,84 @@
+package static
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("index"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte("app"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h := WithDir(dir, SPA()).Handler()(next)
+
+	testData := []struct {
+		path   string
+		accept string
+		status int
+		body   string
+		cache  string
+	}{
+		{"/app.js", "*/*", http.StatusOK, "app", "public, max-age=3600"},
+		{"/", "text/html", http.StatusOK, "index", "no-cache"},
+		{"/users/1", "text/html", http.StatusOK, "index", "no-cache"},
+		{"/users/1", "application/json", http.StatusTeapot, "", ""},
+		{"/missing.js", "*/*", http.StatusTeapot, "", ""},
+	}
+
+	for _, d := range testData {
+		r := httptest.NewRequest("GET", d.path, nil)
+		r.Header.Set("Accept", d.accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != d.status {
+			t.Fatalf("%s: expected status %d got %d", d.path, d.status, w.Code)
+		}
+		if body := w.Body.String(); body != d.body {
+			t.Fatalf("%s: expected body %q got %q", d.path, d.body, body)
+		}
+		if cache := w.Header().Get("Cache-Control"); cache != d.cache {
+			t.Fatalf("%s: expected cache control %q got %q", d.path, d.cache, cache)
+		}
+	}
+}
+
+func TestTrimPrefix(t *testing.T) {
+	testData := []struct {
+		path   string
+		prefix string
+		rest   string
+		match  bool
+	}{
+		{"/app.js", "/", "/app.js", true},
+		{"/ui", "/ui", "", true},
+		{"/ui/app.js", "/ui", "/app.js", true},
+		{"/ui/app.js", "/ui/", "/app.js", true},
+		{"/uiv2/app.js", "/ui", "", false},
+		{"/api", "/ui", "", false},
+	}
+
+	for _, d := range testData {
+		rest, ok := trimPrefix(d.path, d.prefix)
+		if ok != d.match || rest != d.rest {
+			t.Fatalf("%s under %s: expected %q %v got %q %v", d.path, d.prefix, d.rest, d.match, rest, ok)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package grpc
+
+import (
+	"fmt"
+)
+
+// frame is a message passed through as is
+type frame struct {
+	payload []byte
+}
+
+// codec passes frames through without decoding them, named proto so the
+// content type of requests is kept
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	f, ok := v.(*frame)
+	if !ok {
+		return nil, fmt.Errorf("failed to marshal %T, expected a frame", v)
+	}
+	return f.payload, nil
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	f, ok := v.(*frame)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal into %T, expected a frame", v)
+	}
+	// the buffer may be reused once Unmarshal returned
+	f.payload = append(f.payload[:0], data...)
+	return nil
+}
+
+func (codec) Name() string {
+	return "proto"
+}
+
+func (codec) String() string {
+	return "proto"
+}
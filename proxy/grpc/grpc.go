@@ -0,0 +1,497 @@
+// Package grpc provides a server proxying grpc requests to the services of the registry
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/config/cmd"
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/server"
+	"github.com/micro/go-micro/v2/util/addr"
+	"github.com/micro/go-plugins/proxy/grpc/v2/internal/listener"
+	"github.com/micro/go-plugins/proxy/grpc/v2/internal/registrywatch"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+/*
+	Every method is accepted without generated code, the frames are passed through
+	without being decoded. The service of a request is named by the service header,
+	or found in the routes by the grpc service of the method, or is the grpc service
+	itself. A node of the service is picked by the selector and the request is sent
+	to it over a connection kept per node. Nodes are only marked failed when they
+	couldn't be reached, errors of the services are passed on to the callers.
+
+	Connections are closed once their node is deleted from the registry or they
+	weren't used for the idle timeout, connections still streaming are closed
+	once their last stream ended.
+*/
+
+type grpcProxy struct {
+	sync.Mutex
+	opts server.Options
+	srv  *grpc.Server
+	// connections to the nodes, keyed by address
+	conns map[string]*conn
+	exit  chan chan error
+}
+
+// conn is a connection to a node along with its streams in flight
+type conn struct {
+	*grpc.ClientConn
+	streams int
+	used    time.Time
+	evicted bool
+}
+
+func init() {
+	cmd.DefaultServers["grpc-proxy"] = NewServer
+}
+
+// service returns the service of the registry serving the method
+func (g *grpcProxy) service(ctx context.Context, method string) (string, error) {
+	// /greeter.Greeter/Hello
+	parts := strings.Split(strings.TrimPrefix(method, "/"), "/")
+	if len(parts) != 2 || len(parts[0]) == 0 {
+		return "", status.Errorf(codes.Unimplemented, "malformed method %s", method)
+	}
+
+	opts := g.Options()
+
+	header := DefaultServiceHeader
+	if h, ok := opts.Context.Value(serviceHeaderKey{}).(string); ok && len(h) > 0 {
+		header = h
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(header); len(v) > 0 && len(v[0]) > 0 {
+			return v[0], nil
+		}
+	}
+
+	if routes, ok := opts.Context.Value(routesKey{}).(map[string]string); ok {
+		if s, ok := routes[parts[0]]; ok {
+			return s, nil
+		}
+	}
+
+	return parts[0], nil
+}
+
+// conn returns the connection to the node, dialed on first use, it must be released
+// once the stream ended
+func (g *grpcProxy) conn(address string) (*conn, error) {
+	g.Lock()
+	defer g.Unlock()
+
+	if cc, ok := g.conns[address]; ok {
+		cc.streams++
+		return cc, nil
+	}
+
+	dopts, ok := g.opts.Context.Value(dialOptionsKey{}).([]grpc.DialOption)
+	if !ok {
+		dopts = []grpc.DialOption{grpc.WithInsecure()}
+	}
+	c, err := grpc.Dial(address, dopts...)
+	if err != nil {
+		return nil, err
+	}
+	cc := &conn{ClientConn: c, streams: 1}
+	g.conns[address] = cc
+	return cc, nil
+}
+
+// release ends a stream of the connection, closing it if it was evicted meanwhile
+func (g *grpcProxy) release(cc *conn) {
+	g.Lock()
+	defer g.Unlock()
+
+	cc.streams--
+	cc.used = time.Now()
+	if cc.evicted && cc.streams == 0 {
+		cc.Close()
+	}
+}
+
+// evict removes the connection to the address, it's closed once idle
+func (g *grpcProxy) evict(address string) {
+	cc, ok := g.conns[address]
+	if !ok {
+		return
+	}
+	delete(g.conns, address)
+	cc.evicted = true
+	if cc.streams == 0 {
+		cc.Close()
+	}
+}
+
+// deleted evicts the connections to the nodes deleted from the registry
+func (g *grpcProxy) deleted(res *registry.Result) {
+	if res.Action != "delete" {
+		return
+	}
+	g.Lock()
+	for _, node := range res.Service.Nodes {
+		g.evict(node.Address)
+	}
+	g.Unlock()
+}
+
+// sweep evicts the connections which weren't used for the timeout
+func (g *grpcProxy) sweep(timeout time.Duration) {
+	g.Lock()
+	for address, cc := range g.conns {
+		if cc.streams == 0 && time.Since(cc.used) >= timeout {
+			g.evict(address)
+		}
+	}
+	g.Unlock()
+}
+
+func (g *grpcProxy) selector() selector.Selector {
+	opts := g.Options()
+	if s, ok := opts.Context.Value(selectorKey{}).(selector.Selector); ok && s != nil {
+		return s
+	}
+	return selector.NewSelector(selector.Registry(opts.Registry))
+}
+
+// handler proxies the requests of every method
+func (g *grpcProxy) handler(sel selector.Selector) grpc.StreamHandler {
+	return func(srv interface{}, ss grpc.ServerStream) error {
+		method, ok := grpc.MethodFromServerStream(ss)
+		if !ok {
+			return status.Error(codes.Internal, "method of the stream unknown")
+		}
+
+		ctx := ss.Context()
+		service, err := g.service(ctx, method)
+		if err != nil {
+			return err
+		}
+
+		next, err := sel.Select(service, selector.WithFilter(selector.FilterLabel("protocol", "grpc")))
+		if err == selector.ErrNotFound {
+			return status.Errorf(codes.Unavailable, "service %s not found", service)
+		} else if err != nil {
+			return status.Errorf(codes.Unavailable, "failed to select %s: %v", service, err)
+		}
+		node, err := next()
+		if err != nil {
+			return status.Errorf(codes.Unavailable, "failed to select %s: %v", service, err)
+		}
+
+		cc, err := g.conn(node.Address)
+		if err != nil {
+			sel.Mark(service, node, err)
+			return status.Errorf(codes.Unavailable, "failed to dial %s: %v", node.Address, err)
+		}
+		defer g.release(cc)
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		md = md.Copy()
+		delete(md, ":authority")
+		ctx, cancel := context.WithCancel(metadata.NewOutgoingContext(ctx, md))
+		defer cancel()
+
+		desc := &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}
+		cs, err := cc.NewStream(ctx, desc, method, grpc.ForceCodec(codec{}))
+		if err != nil {
+			sel.Mark(service, node, unavailable(err))
+			return err
+		}
+
+		err = forward(ss, cs)
+		sel.Mark(service, node, unavailable(err))
+		return err
+	}
+}
+
+// unavailable returns the error if the node couldn't be reached
+func unavailable(err error) error {
+	if status.Code(err) == codes.Unavailable {
+		return err
+	}
+	return nil
+}
+
+// forward passes the frames of the caller to the node and the frames of the node
+// back, returning once the node ended the stream
+func forward(ss grpc.ServerStream, cs grpc.ClientStream) error {
+	// caller to node
+	c2n := make(chan error, 1)
+	go func() {
+		for {
+			f := new(frame)
+			if err := ss.RecvMsg(f); err != nil {
+				c2n <- err
+				return
+			}
+			if err := cs.SendMsg(f); err != nil {
+				c2n <- err
+				return
+			}
+		}
+	}()
+
+	// node to caller
+	n2c := make(chan error, 1)
+	go func() {
+		for i := 0; ; i++ {
+			f := new(frame)
+			err := cs.RecvMsg(f)
+			// the header is sent before the first frame or the status
+			if i == 0 {
+				if md, herr := cs.Header(); herr == nil {
+					ss.SendHeader(md)
+				}
+			}
+			if err != nil {
+				n2c <- err
+				return
+			}
+			if err := ss.SendMsg(f); err != nil {
+				n2c <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case err := <-c2n:
+			if err != io.EOF {
+				return status.Errorf(codes.Canceled, "failed to receive from the caller: %v", err)
+			}
+			// the caller is done sending, the node may still be
+			cs.CloseSend()
+			c2n = nil
+		case err := <-n2c:
+			ss.SetTrailer(cs.Trailer())
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (g *grpcProxy) Init(opts ...server.Option) error {
+	g.Lock()
+	for _, o := range opts {
+		o(&g.opts)
+	}
+	g.Unlock()
+	return nil
+}
+
+func (g *grpcProxy) Options() server.Options {
+	g.Lock()
+	opts := g.opts
+	g.Unlock()
+	return opts
+}
+
+// Handle is a noop, every request is proxied
+func (g *grpcProxy) Handle(h server.Handler) error {
+	return nil
+}
+
+func (g *grpcProxy) NewHandler(h interface{}, opts ...server.HandlerOption) server.Handler {
+	options := server.HandlerOptions{
+		Metadata: make(map[string]map[string]string),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return &proxyHandler{h: h, opts: options}
+}
+
+func (g *grpcProxy) NewSubscriber(topic string, h interface{}, opts ...server.SubscriberOption) server.Subscriber {
+	return &proxySubscriber{
+		topic: topic,
+		h:     h,
+		opts:  server.NewSubscriberOptions(opts...),
+	}
+}
+
+func (g *grpcProxy) Subscribe(s server.Subscriber) error {
+	return errors.New("grpc proxy does not support subscribers")
+}
+
+// serviceDef returns the service of the proxy itself
+func serviceDef(opts server.Options) (*registry.Service, error) {
+	advt := opts.Address
+	if len(opts.Advertise) > 0 {
+		advt = opts.Advertise
+	}
+
+	host, port, err := net.SplitHostPort(advt)
+	if err != nil {
+		return nil, err
+	}
+	host, err = addr.Extract(host)
+	if err != nil {
+		return nil, err
+	}
+
+	md := make(map[string]string, len(opts.Metadata)+2)
+	for k, v := range opts.Metadata {
+		md[k] = v
+	}
+	md["server"] = "grpc-proxy"
+	md["protocol"] = "grpc"
+
+	return &registry.Service{
+		Name:    opts.Name,
+		Version: opts.Version,
+		Nodes: []*registry.Node{{
+			Id:       opts.Name + "-" + opts.Id,
+			Address:  net.JoinHostPort(host, port),
+			Metadata: md,
+		}},
+	}, nil
+}
+
+func (g *grpcProxy) register() error {
+	opts := g.Options()
+	service, err := serviceDef(opts)
+	if err != nil {
+		return err
+	}
+	return opts.Registry.Register(service, registry.RegisterTTL(opts.RegisterTTL))
+}
+
+func (g *grpcProxy) deregister() error {
+	opts := g.Options()
+	service, err := serviceDef(opts)
+	if err != nil {
+		return err
+	}
+	return opts.Registry.Deregister(service)
+}
+
+func (g *grpcProxy) Start() error {
+	opts := g.Options()
+
+	// the listener is handed over on restart
+	reusePort, _ := opts.Context.Value(reusePortKey{}).(bool)
+	ln, err := listener.Listen(opts.Address, reusePort)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Proxy [grpc] Listening on %s", ln.Addr().String())
+
+	g.Lock()
+	g.opts.Address = ln.Addr().String()
+	g.Unlock()
+
+	sopts, _ := opts.Context.Value(serverOptionsKey{}).([]grpc.ServerOption)
+	sopts = append(sopts,
+		grpc.CustomCodec(codec{}),
+		grpc.UnknownServiceHandler(g.handler(g.selector())),
+	)
+	srv := grpc.NewServer(sopts...)
+
+	g.Lock()
+	g.srv = srv
+	g.Unlock()
+
+	if err := g.register(); err != nil {
+		ln.Close()
+		return err
+	}
+
+	go func() {
+		if err := srv.Serve(ln); err != nil {
+			log.Errorf("Proxy [grpc] failed to serve: %v", err)
+		}
+	}()
+
+	// evict the connections to the nodes deleted from the registry
+	watching := make(chan struct{})
+	go registrywatch.Run("grpc-proxy", watching, opts.Registry.Watch, g.deleted)
+
+	idle := DefaultIdleTimeout
+	if d, ok := opts.Context.Value(idleTimeoutKey{}).(time.Duration); ok && d > 0 {
+		idle = d
+	}
+
+	go func() {
+		t := new(time.Ticker)
+
+		// only process if it exists
+		if opts.RegisterInterval > time.Duration(0) {
+			t = time.NewTicker(opts.RegisterInterval)
+		}
+
+		sweep := time.NewTicker(idle / 2)
+		defer sweep.Stop()
+
+		var ch chan error
+
+	Loop:
+		for {
+			select {
+			// register self on interval
+			case <-t.C:
+				if err := g.register(); err != nil {
+					log.Error("Server register error: ", err)
+				}
+			// close the idle connections
+			case <-sweep.C:
+				g.sweep(idle)
+			// wait for exit
+			case ch = <-g.exit:
+				break Loop
+			}
+		}
+
+		// callers move on to other nodes before the requests are drained
+		err := g.deregister()
+		srv.GracefulStop()
+		close(watching)
+
+		g.Lock()
+		for address := range g.conns {
+			g.evict(address)
+		}
+		g.Unlock()
+
+		ch <- err
+	}()
+
+	return nil
+}
+
+func (g *grpcProxy) Stop() error {
+	ch := make(chan error)
+	g.exit <- ch
+	return <-ch
+}
+
+func (g *grpcProxy) String() string {
+	return "grpc-proxy"
+}
+
+// NewServer returns a server proxying the grpc requests of every method to the
+// services of the registry
+func NewServer(opts ...server.Option) server.Server {
+	return &grpcProxy{
+		opts:  newOptions(opts...),
+		conns: make(map[string]*conn),
+		exit:  make(chan chan error),
+	}
+}
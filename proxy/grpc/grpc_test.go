@@ -0,0 +1,212 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/registry/memory"
+	"github.com/micro/go-micro/v2/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// echo serves every method without generated code, sending back the frames it receives
+func echo(srv interface{}, ss grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(ss)
+	if method == "/echo.Echo/Missing" {
+		return status.Error(codes.NotFound, "missing")
+	}
+
+	md, _ := metadata.FromIncomingContext(ss.Context())
+	ss.SetHeader(metadata.MD{"echo-id": md.Get("id")})
+
+	for {
+		f := new(frame)
+		if err := ss.RecvMsg(f); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := ss.SendMsg(f); err != nil {
+			return err
+		}
+	}
+}
+
+func startBackend(t *testing.T, reg registry.Registry, name string) func() {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := grpc.NewServer(grpc.CustomCodec(codec{}), grpc.UnknownServiceHandler(echo))
+	go srv.Serve(ln)
+
+	if err := reg.Register(&registry.Service{
+		Name: name,
+		Nodes: []*registry.Node{{
+			Id:       name + "-1",
+			Address:  ln.Addr().String(),
+			Metadata: map[string]string{"protocol": "grpc"},
+		}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return srv.Stop
+}
+
+func startProxy(t *testing.T, opts ...server.Option) (server.Server, *grpc.ClientConn) {
+	p := NewServer(append([]server.Option{server.Address("127.0.0.1:0")}, opts...)...)
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	cc, err := grpc.Dial(p.Options().Address, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, cc
+}
+
+func TestProxyUnary(t *testing.T) {
+	reg := memory.NewRegistry()
+	defer startBackend(t, reg, "go.micro.srv.echo")()
+
+	p, cc := startProxy(t, server.Registry(reg), Route("echo.Echo", "go.micro.srv.echo"))
+	defer p.Stop()
+	defer cc.Close()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "id", "1")
+	var header metadata.MD
+	rsp := new(frame)
+	if err := cc.Invoke(ctx, "/echo.Echo/Call", &frame{[]byte("hello")}, rsp, grpc.ForceCodec(codec{}), grpc.Header(&header)); err != nil {
+		t.Fatal(err)
+	}
+	if string(rsp.payload) != "hello" {
+		t.Fatalf("expected hello got %s", rsp.payload)
+	}
+	if v := header.Get("echo-id"); len(v) != 1 || v[0] != "1" {
+		t.Fatalf("expected the metadata and header to be passed on got %v", header)
+	}
+
+	// errors of the service are passed on
+	err := cc.Invoke(ctx, "/echo.Echo/Missing", &frame{[]byte("hello")}, rsp, grpc.ForceCodec(codec{}))
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected %v got %v", codes.NotFound, err)
+	}
+
+	// services which aren't registered
+	err = cc.Invoke(ctx, "/foo.Foo/Call", &frame{[]byte("hello")}, rsp, grpc.ForceCodec(codec{}))
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected %v got %v", codes.Unavailable, err)
+	}
+}
+
+func TestProxyStream(t *testing.T) {
+	reg := memory.NewRegistry()
+	defer startBackend(t, reg, "go.micro.srv.echo")()
+
+	p, cc := startProxy(t, server.Registry(reg))
+	defer p.Stop()
+	defer cc.Close()
+
+	// named by the header rather than a route
+	ctx := metadata.AppendToOutgoingContext(context.Background(), DefaultServiceHeader, "go.micro.srv.echo")
+	desc := &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}
+	cs, err := cc.NewStream(ctx, desc, "/echo.Echo/Stream", grpc.ForceCodec(codec{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, msg := range []string{"a", "b", "c"} {
+		if err := cs.SendMsg(&frame{[]byte(msg)}); err != nil {
+			t.Fatal(err)
+		}
+		f := new(frame)
+		if err := cs.RecvMsg(f); err != nil {
+			t.Fatal(err)
+		}
+		if string(f.payload) != msg {
+			t.Fatalf("expected %s got %s", msg, f.payload)
+		}
+	}
+
+	if err := cs.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.RecvMsg(new(frame)); err != io.EOF {
+		t.Fatalf("expected the stream to end got %v", err)
+	}
+}
+
+func TestProxyRegister(t *testing.T) {
+	reg := memory.NewRegistry()
+	p, cc := startProxy(t, server.Registry(reg), server.Name("go.micro.proxy"))
+	cc.Close()
+
+	services, err := reg.GetService("go.micro.proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || len(services[0].Nodes) != 1 || services[0].Nodes[0].Metadata["protocol"] != "grpc" {
+		t.Fatalf("expected the proxy to be registered got %+v", services)
+	}
+
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.GetService("go.micro.proxy"); err != registry.ErrNotFound {
+		t.Fatalf("expected the proxy to be deregistered got %v", err)
+	}
+}
+
+func TestProxyEvict(t *testing.T) {
+	reg := memory.NewRegistry()
+	defer startBackend(t, reg, "go.micro.srv.echo")()
+
+	for _, idle := range []time.Duration{100 * time.Millisecond, time.Hour} {
+		p, cc := startProxy(t, server.Registry(reg), Route("echo.Echo", "go.micro.srv.echo"), IdleTimeout(idle))
+
+		g := p.(*grpcProxy)
+		conns := func() int {
+			g.Lock()
+			defer g.Unlock()
+			return len(g.conns)
+		}
+
+		if err := cc.Invoke(context.Background(), "/echo.Echo/Call", &frame{[]byte("hello")}, new(frame), grpc.ForceCodec(codec{})); err != nil {
+			t.Fatal(err)
+		}
+		if n := conns(); n != 1 {
+			t.Fatalf("expected a connection to the node, got %d", n)
+		}
+
+		// without the idle timeout passing the node is deleted
+		if idle == time.Hour {
+			services, err := reg.GetService("go.micro.srv.echo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := reg.Deregister(services[0]); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for i := 0; conns() > 0; i++ {
+			if i == 100 {
+				t.Fatalf("expected the connection to be closed with an idle timeout of %v", idle)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		cc.Close()
+		p.Stop()
+	}
+}
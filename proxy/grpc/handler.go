@@ -0,0 +1,50 @@
+package grpc
+
+import (
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/server"
+)
+
+// proxyHandler is accepted so services can be run by the proxy, it's never served
+type proxyHandler struct {
+	h    interface{}
+	opts server.HandlerOptions
+}
+
+func (p *proxyHandler) Name() string {
+	return "proxy"
+}
+
+func (p *proxyHandler) Handler() interface{} {
+	return p.h
+}
+
+func (p *proxyHandler) Endpoints() []*registry.Endpoint {
+	return nil
+}
+
+func (p *proxyHandler) Options() server.HandlerOptions {
+	return p.opts
+}
+
+type proxySubscriber struct {
+	topic string
+	h     interface{}
+	opts  server.SubscriberOptions
+}
+
+func (p *proxySubscriber) Topic() string {
+	return p.topic
+}
+
+func (p *proxySubscriber) Subscriber() interface{} {
+	return p.h
+}
+
+func (p *proxySubscriber) Endpoints() []*registry.Endpoint {
+	return nil
+}
+
+func (p *proxySubscriber) Options() server.SubscriberOptions {
+	return p.opts
+}
@@ -0,0 +1,170 @@
+// Package listener hands listening sockets over to a new process on a graceful restart
+package listener
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+	A graceful restart hands the listening sockets over to a new process. Restart
+	starts the current binary again with the sockets of all open listeners passed
+	as extra files, their listen addresses and descriptors are named in an env var.
+	When the new process listens on one of these addresses it takes over the socket
+	instead of binding a new one, so no connection is refused during the upgrade.
+	The old process should then stop accepting and exit once its requests drained.
+
+	The listeners of the tcp and http transports and of the grpc proxy are all
+	handed over, whichever plugin Restart is called through.
+*/
+
+// Env names the env var listing inherited listeners as addr=fd pairs separated by ;
+const Env = "MICRO_LISTENERS"
+
+var (
+	mtx sync.Mutex
+	// active listeners by the address they were requested with
+	active = make(map[*net.TCPListener]string)
+
+	inheritOnce sync.Once
+	inherited   map[string][]*os.File
+)
+
+// tracked is a listener handed over on restart until it's closed
+type tracked struct {
+	*net.TCPListener
+}
+
+func (t *tracked) Close() error {
+	mtx.Lock()
+	delete(active, t.TCPListener)
+	mtx.Unlock()
+	return t.TCPListener.Close()
+}
+
+// inheritedListener returns a listener passed on by the parent process for the address
+func inheritedListener(addr string) (*net.TCPListener, error) {
+	inheritOnce.Do(func() {
+		inherited = make(map[string][]*os.File)
+		for _, pair := range strings.Split(os.Getenv(Env), ";") {
+			i := strings.LastIndex(pair, "=")
+			if i < 0 {
+				continue
+			}
+			fd, err := strconv.Atoi(pair[i+1:])
+			if err != nil {
+				continue
+			}
+			a := pair[:i]
+			inherited[a] = append(inherited[a], os.NewFile(uintptr(fd), a))
+		}
+		// don't pass them on to our own children
+		os.Unsetenv(Env)
+	})
+
+	mtx.Lock()
+	files := inherited[addr]
+	if len(files) == 0 {
+		mtx.Unlock()
+		return nil, nil
+	}
+	f := files[0]
+	inherited[addr] = files[1:]
+	mtx.Unlock()
+
+	defer f.Close()
+
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, err
+	}
+	tl, ok := l.(*net.TCPListener)
+	if !ok {
+		l.Close()
+		return nil, fmt.Errorf("inherited listener for %s is not tcp", addr)
+	}
+	return tl, nil
+}
+
+// Listen returns a tcp listener on the address, taking over the one passed on by
+// the parent process if any, setting SO_REUSEPORT on a new one if reusePort is set.
+// The listener is handed over on Restart until it's closed
+func Listen(addr string, reusePort bool) (net.Listener, error) {
+	l, err := inheritedListener(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if l == nil {
+		var lc net.ListenConfig
+		if reusePort {
+			lc.Control = reusePortControl
+		}
+		nl, err := lc.Listen(context.Background(), "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		l = nl.(*net.TCPListener)
+	}
+
+	mtx.Lock()
+	active[l] = addr
+	mtx.Unlock()
+
+	return &tracked{l}, nil
+}
+
+// Restart starts a new instance of the running binary, with the same arguments and
+// environment, which takes over the sockets of all open listeners. It is typically
+// called on SIGUSR2, the caller remains responsible for draining and exiting
+func Restart() (*os.Process, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	files := []*os.File{os.Stdin, os.Stdout, os.Stderr}
+	var pairs []string
+
+	// the duplicated descriptors are only needed until the child started
+	defer func() {
+		for _, f := range files[3:] {
+			f.Close()
+		}
+	}()
+
+	for l, addr := range active {
+		f, err := l.File()
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%d", addr, len(files)))
+		files = append(files, f)
+	}
+
+	env := []string{Env + "=" + strings.Join(pairs, ";")}
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, Env+"=") {
+			env = append(env, e)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	return os.StartProcess(path, os.Args, &os.ProcAttr{
+		Dir:   wd,
+		Env:   env,
+		Files: files,
+	})
+}
@@ -0,0 +1,68 @@
+package listener
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestReusePort(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_REUSEPORT test only runs on linux")
+	}
+
+	l1, err := Listen("127.0.0.1:44460", true)
+	if err != nil {
+		t.Fatalf("Did not expect an error, got %s", err)
+	}
+	defer l1.Close()
+
+	l2, err := Listen("127.0.0.1:44460", true)
+	if err != nil {
+		t.Fatalf("Expected second listener to share the port, got %s", err)
+	}
+	l2.Close()
+}
+
+func TestInheritedListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv(Env, fmt.Sprintf("127.0.0.1:0=%d", f.Fd()))
+	inheritOnce = sync.Once{}
+
+	lsn, err := Listen("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatalf("Did not expect an error, got %s", err)
+	}
+
+	if lsn.Addr().String() != l.Addr().String() {
+		t.Fatalf("Expected inherited listener on %s, got %s", l.Addr().String(), lsn.Addr())
+	}
+
+	// open listeners are handed over until closed
+	mtx.Lock()
+	n := len(active)
+	mtx.Unlock()
+	if n != 1 {
+		t.Fatalf("Expected the listener to be tracked, got %d", n)
+	}
+	lsn.Close()
+	mtx.Lock()
+	n = len(active)
+	mtx.Unlock()
+	if n != 0 {
+		t.Fatalf("Expected the closed listener not to be tracked, got %d", n)
+	}
+}
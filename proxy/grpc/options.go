@@ -0,0 +1,132 @@
+package grpc
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/micro/go-micro/v2/client/selector"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/server"
+	"github.com/micro/go-plugins/proxy/grpc/v2/internal/listener"
+	"google.golang.org/grpc"
+)
+
+var (
+	// DefaultServiceHeader is the metadata naming the service of a request
+	DefaultServiceHeader = "micro-service"
+	// DefaultIdleTimeout is how long connections to the nodes are kept unused
+	DefaultIdleTimeout = 5 * time.Minute
+)
+
+type routesKey struct{}
+type serviceHeaderKey struct{}
+type selectorKey struct{}
+type dialOptionsKey struct{}
+type serverOptionsKey struct{}
+type reusePortKey struct{}
+type idleTimeoutKey struct{}
+
+// Route sends the requests of the grpc service, e.g. greeter.Greeter, to the
+// service of the registry, e.g. go.micro.srv.greeter
+func Route(grpcService, service string) server.Option {
+	return func(o *server.Options) {
+		var routes map[string]string
+		if o.Context != nil {
+			routes, _ = o.Context.Value(routesKey{}).(map[string]string)
+		}
+		copied := make(map[string]string, len(routes)+1)
+		for k, v := range routes {
+			copied[k] = v
+		}
+		copied[grpcService] = service
+		setServerOption(routesKey{}, copied)(o)
+	}
+}
+
+// ServiceHeader sets the metadata naming the service of a request, it takes
+// precedence over the routes
+func ServiceHeader(key string) server.Option {
+	return setServerOption(serviceHeaderKey{}, key)
+}
+
+// Selector sets the selector picking the nodes of the services, by default
+// the registry of the server is used
+func Selector(s selector.Selector) server.Option {
+	return setServerOption(selectorKey{}, s)
+}
+
+// DialOptions sets the options dialing the nodes, insecure by default
+func DialOptions(opts ...grpc.DialOption) server.Option {
+	return setServerOption(dialOptionsKey{}, opts)
+}
+
+// ServerOptions sets the options of the grpc server accepting the requests
+func ServerOptions(opts ...grpc.ServerOption) server.Option {
+	return setServerOption(serverOptionsKey{}, opts)
+}
+
+// IdleTimeout sets how long connections to the nodes are kept unused, they're
+// closed once their node is deleted from the registry in any case
+func IdleTimeout(d time.Duration) server.Option {
+	return setServerOption(idleTimeoutKey{}, d)
+}
+
+// ReusePort sets SO_REUSEPORT on the listening socket so a new process can bind
+// the same address while the old one drains. Supported on linux, darwin and the BSDs
+func ReusePort() server.Option {
+	return setServerOption(reusePortKey{}, true)
+}
+
+// Restart starts a new instance of the running binary, with the same arguments and
+// environment, which takes over the sockets of all open listeners. It is typically
+// called on SIGUSR2, the caller remains responsible for draining and exiting
+func Restart() (*os.Process, error) {
+	return listener.Restart()
+}
+
+func setServerOption(k, v interface{}) server.Option {
+	return func(o *server.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+func newOptions(opt ...server.Option) server.Options {
+	opts := server.Options{
+		Metadata: map[string]string{},
+		Context:  context.Background(),
+	}
+
+	for _, o := range opt {
+		o(&opts)
+	}
+
+	if opts.Context == nil {
+		opts.Context = context.Background()
+	}
+
+	if opts.Registry == nil {
+		opts.Registry = registry.DefaultRegistry
+	}
+
+	if len(opts.Address) == 0 {
+		opts.Address = server.DefaultAddress
+	}
+
+	if len(opts.Name) == 0 {
+		opts.Name = server.DefaultName
+	}
+
+	if len(opts.Id) == 0 {
+		opts.Id = server.DefaultId
+	}
+
+	if len(opts.Version) == 0 {
+		opts.Version = server.DefaultVersion
+	}
+
+	return opts
+}
@@ -0,0 +1,228 @@
+// Package audit provides a registry which audits the service churn
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-plugins/registry/audit/v2/internal/registrywatch"
+)
+
+/*
+	Every Register and Deregister, and every delta of a watcher the wrapper runs
+	itself, is written to the sinks with a timestamp and the nodes involved. The
+	events are queued and written in the background so a slow sink never blocks
+	the registry, events are dropped while the queue is full.
+
+	Services register again every interval and watchers send the whole service on
+	every change, so registrations and deltas are diffed against the nodes seen so
+	far. Only the nodes which were added, changed or removed are written, events
+	without any are dropped. Deregistrations and failures are always written.
+*/
+
+var (
+	// DefaultBuffer is the number of events queued without WithBuffer
+	DefaultBuffer = 1024
+)
+
+// Event is a change of the registry
+type Event struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Action is register, deregister or the action of the watch result
+	Action   string           `json:"action"`
+	Registry string           `json:"registry"`
+	Service  string           `json:"service"`
+	Version  string           `json:"version"`
+	Nodes    []*registry.Node `json:"nodes"`
+	// Error is the error of a failed Register or Deregister
+	Error string `json:"error,omitempty"`
+}
+
+type auditRegistry struct {
+	registry.Registry
+	opts   Options
+	events chan *Event
+
+	sync.Mutex
+	// nodes seen keyed by service, version and node id
+	nodes map[string]map[string]map[string]*registry.Node
+}
+
+func copyNode(n *registry.Node) *registry.Node {
+	md := make(map[string]string, len(n.Metadata))
+	for k, v := range n.Metadata {
+		md[k] = v
+	}
+	return &registry.Node{Id: n.Id, Address: n.Address, Metadata: md}
+}
+
+// equal returns whether the nodes have the same address and metadata
+func equal(a, b *registry.Node) bool {
+	if a.Address != b.Address || len(a.Metadata) != len(b.Metadata) {
+		return false
+	}
+	for k, v := range a.Metadata {
+		if w, ok := b.Metadata[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+// diff applies the action to the nodes seen and returns the service with the nodes
+// which were added or changed, or removed by a delete, nil if none were
+func (a *auditRegistry) diff(action string, s *registry.Service) *registry.Service {
+	a.Lock()
+	defer a.Unlock()
+
+	versions, ok := a.nodes[s.Name]
+	if !ok {
+		versions = make(map[string]map[string]*registry.Node)
+		a.nodes[s.Name] = versions
+	}
+	nodes, ok := versions[s.Version]
+	if !ok {
+		nodes = make(map[string]*registry.Node)
+		versions[s.Version] = nodes
+	}
+
+	changed := &registry.Service{Name: s.Name, Version: s.Version}
+	for _, n := range s.Nodes {
+		if n == nil {
+			continue
+		}
+		old, ok := nodes[n.Id]
+		switch action {
+		case "delete", "deregister":
+			if ok {
+				delete(nodes, n.Id)
+				changed.Nodes = append(changed.Nodes, old)
+			}
+		default:
+			if !ok || !equal(old, n) {
+				nodes[n.Id] = copyNode(n)
+				changed.Nodes = append(changed.Nodes, n)
+			}
+		}
+	}
+
+	if len(nodes) == 0 {
+		delete(versions, s.Version)
+	}
+	if len(versions) == 0 {
+		delete(a.nodes, s.Name)
+	}
+	if len(changed.Nodes) == 0 {
+		return nil
+	}
+	return changed
+}
+
+func newEvent(r registry.Registry, action string, s *registry.Service, err error) *Event {
+	e := &Event{
+		Timestamp: time.Now(),
+		Action:    action,
+		Registry:  r.String(),
+		Service:   s.Name,
+		Version:   s.Version,
+	}
+	for _, n := range s.Nodes {
+		if n == nil {
+			continue
+		}
+		e.Nodes = append(e.Nodes, copyNode(n))
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// emit queues the event without blocking
+func (a *auditRegistry) emit(e *Event) {
+	select {
+	case a.events <- e:
+	default:
+		log.Warnf("[audit] dropped the %s event of %s, the buffer is full", e.Action, e.Service)
+	}
+}
+
+// write writes the queued events to the sinks until the context is done
+func (a *auditRegistry) write() {
+	for {
+		select {
+		case <-a.opts.Context.Done():
+			return
+		case e := <-a.events:
+			for _, s := range a.opts.Sinks {
+				if err := s.Write(e); err != nil {
+					log.Errorf("[audit] failed to write the %s event of %s to %s: %v", e.Action, e.Service, s, err)
+				}
+			}
+		}
+	}
+}
+
+// audit emits the event of the watch result if it changed any node
+func (a *auditRegistry) audit(res *registry.Result) {
+	if s := a.diff(res.Action, res.Service); s != nil {
+		a.emit(newEvent(a.Registry, res.Action, s, nil))
+	}
+}
+
+func (a *auditRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	err := a.Registry.Register(s, opts...)
+	if err != nil {
+		a.emit(newEvent(a.Registry, "register", s, err))
+		return err
+	}
+	// registering again without changes isn't audited
+	if changed := a.diff("register", s); changed != nil {
+		a.emit(newEvent(a.Registry, "register", changed, nil))
+	}
+	return nil
+}
+
+func (a *auditRegistry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
+	err := a.Registry.Deregister(s, opts...)
+	if err == nil {
+		a.diff("deregister", s)
+	}
+	a.emit(newEvent(a.Registry, "deregister", s, err))
+	return err
+}
+
+func (a *auditRegistry) String() string {
+	return a.Registry.String()
+}
+
+// NewRegistry returns a registry auditing the changes of r to the sinks
+func NewRegistry(r registry.Registry, opts ...Option) registry.Registry {
+	options := Options{
+		Buffer:  DefaultBuffer,
+		Context: context.Background(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.Buffer <= 0 {
+		options.Buffer = DefaultBuffer
+	}
+
+	a := &auditRegistry{
+		Registry: r,
+		opts:     options,
+		events:   make(chan *Event, options.Buffer),
+		nodes:    make(map[string]map[string]map[string]*registry.Node),
+	}
+
+	go a.write()
+	if !options.NoWatch {
+		go registrywatch.Run("audit", options.Context.Done(), r.Watch, a.audit)
+	}
+
+	return a
+}
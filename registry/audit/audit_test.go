@@ -0,0 +1,223 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+type mockRegistry struct {
+	registry.Registry
+	err     error
+	results chan *registry.Result
+}
+
+func (m *mockRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	return m.err
+}
+
+func (m *mockRegistry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
+	return m.err
+}
+
+func (m *mockRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	return &mockWatcher{results: m.results, exit: make(chan bool)}, nil
+}
+
+func (m *mockRegistry) String() string {
+	return "mock"
+}
+
+type mockWatcher struct {
+	results chan *registry.Result
+	exit    chan bool
+}
+
+func (w *mockWatcher) Next() (*registry.Result, error) {
+	select {
+	case r := <-w.results:
+		return r, nil
+	case <-w.exit:
+		return nil, registry.ErrWatcherStopped
+	}
+}
+
+func (w *mockWatcher) Stop() {
+	close(w.exit)
+}
+
+type chanSink chan *Event
+
+func (s chanSink) Write(e *Event) error {
+	s <- e
+	return nil
+}
+
+func (s chanSink) String() string {
+	return "chan"
+}
+
+func next(t *testing.T, s chanSink) *Event {
+	t.Helper()
+	select {
+	case e := <-s:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an event")
+	}
+	return nil
+}
+
+var service = &registry.Service{
+	Name:    "foo",
+	Version: "1",
+	Nodes: []*registry.Node{{
+		Id:       "foo-1",
+		Address:  "10.0.0.1:8080",
+		Metadata: map[string]string{"zone": "a"},
+	}},
+}
+
+func TestAudit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := &mockRegistry{results: make(chan *registry.Result)}
+	sink := make(chanSink, 8)
+	r := NewRegistry(m, WithSink(sink), WithContext(ctx))
+
+	if err := r.Register(service); err != nil {
+		t.Fatal(err)
+	}
+	e := next(t, sink)
+	if e.Action != "register" || e.Service != "foo" || e.Registry != "mock" || e.Timestamp.IsZero() {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	if len(e.Nodes) != 1 || e.Nodes[0].Id != "foo-1" || e.Nodes[0].Metadata["zone"] != "a" {
+		t.Fatalf("expected the node and its metadata, got %+v", e.Nodes)
+	}
+
+	m.err = errors.New("registry is down")
+	if err := r.Deregister(service); err != m.err {
+		t.Fatalf("expected the error of the registry, got %v", err)
+	}
+	if e := next(t, sink); e.Action != "deregister" || e.Error != "registry is down" {
+		t.Fatalf("expected the failed deregister, got %+v", e)
+	}
+
+	m.results <- &registry.Result{Action: "delete", Service: service}
+	if e := next(t, sink); e.Action != "delete" || len(e.Nodes) != 1 {
+		t.Fatalf("expected the watch delta, got %+v", e)
+	}
+}
+
+func TestAuditChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := &mockRegistry{results: make(chan *registry.Result)}
+	sink := make(chanSink, 8)
+	r := NewRegistry(m, WithSink(sink), WithContext(ctx))
+
+	if err := r.Register(service); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(t, sink); e.Action != "register" {
+		t.Fatalf("expected the register, got %+v", e)
+	}
+
+	// registering again and the delta of the registration change nothing
+	if err := r.Register(service); err != nil {
+		t.Fatal(err)
+	}
+	m.results <- &registry.Result{Action: "create", Service: service}
+	// nor does the delete of an unknown node
+	m.results <- &registry.Result{Action: "delete", Service: &registry.Service{
+		Name:    "foo",
+		Version: "1",
+		Nodes:   []*registry.Node{{Id: "foo-2"}},
+	}}
+
+	moved := &registry.Service{
+		Name:    "foo",
+		Version: "1",
+		Nodes: []*registry.Node{
+			service.Nodes[0],
+			{Id: "foo-3", Address: "10.0.0.3:8080"},
+		},
+	}
+	m.results <- &registry.Result{Action: "update", Service: moved}
+	e := next(t, sink)
+	if e.Action != "update" || len(e.Nodes) != 1 || e.Nodes[0].Id != "foo-3" {
+		t.Fatalf("expected the update of the added node only, got %+v", e)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	s, err := FileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range []string{"register", "deregister"} {
+		if err := s.Write(newEvent(&mockRegistry{}, action, service, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var actions []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		actions = append(actions, e.Action)
+	}
+	if len(actions) != 2 || actions[0] != "register" || actions[1] != "deregister" {
+		t.Fatalf("expected an event per line, got %v", actions)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	events := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		events <- e
+	}))
+	defer srv.Close()
+
+	s := WebhookSink(srv.URL)
+	if err := s.Write(newEvent(&mockRegistry{}, "register", service, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if e := <-events; e.Action != "register" || e.Service != "foo" {
+		t.Fatalf("unexpected event %+v", e)
+	}
+}
@@ -0,0 +1,48 @@
+package audit
+
+import (
+	"context"
+)
+
+type Options struct {
+	// Sinks receive every event
+	Sinks []Sink
+	// Buffer is the number of events queued for the sinks
+	Buffer int
+	// NoWatch disables auditing the watch deltas
+	NoWatch bool
+	// Context stops the watcher once done
+	Context context.Context
+}
+
+type Option func(o *Options)
+
+// WithSink adds sinks the events are written to
+func WithSink(s ...Sink) Option {
+	return func(o *Options) {
+		o.Sinks = append(o.Sinks, s...)
+	}
+}
+
+// WithBuffer sets the number of events queued for the sinks, DefaultBuffer by
+// default. Events are dropped while the buffer is full
+func WithBuffer(n int) Option {
+	return func(o *Options) {
+		o.Buffer = n
+	}
+}
+
+// NoWatch only audits Register and Deregister, the registry isn't watched
+func NoWatch() Option {
+	return func(o *Options) {
+		o.NoWatch = true
+	}
+}
+
+// WithContext stops watching the registry, and writing to the sinks, once the
+// context is done
+func WithContext(ctx context.Context) Option {
+	return func(o *Options) {
+		o.Context = ctx
+	}
+}
@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+)
+
+// Sink receives the audit events
+type Sink interface {
+	Write(e *Event) error
+	String() string
+}
+
+type brokerSink struct {
+	b     broker.Broker
+	topic string
+}
+
+func (s *brokerSink) Write(e *Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.b.Publish(s.topic, &broker.Message{
+		Header: map[string]string{
+			"Content-Type":   "application/json",
+			"Micro-Action":   e.Action,
+			"Micro-Service":  e.Service,
+			"Micro-Registry": e.Registry,
+		},
+		Body: b,
+	})
+}
+
+func (s *brokerSink) String() string {
+	return "broker"
+}
+
+type fileSink struct {
+	sync.Mutex
+	f *os.File
+}
+
+func (s *fileSink) Write(e *Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	_, err = s.f.Write(append(b, '\n'))
+	return err
+}
+
+func (s *fileSink) String() string {
+	return "file"
+}
+
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookSink) Write(e *Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	rsp, err := s.client.Post(s.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return fmt.Errorf("webhook: %s", rsp.Status)
+	}
+	return nil
+}
+
+func (s *webhookSink) String() string {
+	return "webhook"
+}
+
+// BrokerSink publishes the events as json to the topic, the broker must be connected
+func BrokerSink(b broker.Broker, topic string) Sink {
+	return &brokerSink{b: b, topic: topic}
+}
+
+// FileSink appends the events to the file as json, one per line
+func FileSink(path string) (Sink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{f: f}, nil
+}
+
+// WebhookSink posts the events as json to the url
+func WebhookSink(url string) Sink {
+	return &webhookSink{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
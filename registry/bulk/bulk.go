@@ -0,0 +1,42 @@
+// Package bulk registers and deregisters many services at once
+package bulk
+
+import (
+	"github.com/micro/go-micro/v2/registry"
+)
+
+// Registry is implemented by registries which register or deregister many services at once
+type Registry interface {
+	// RegisterAll registers the services in as few round trips as possible
+	RegisterAll(services []*registry.Service, opts ...registry.RegisterOption) error
+	// DeregisterAll deregisters the services in as few round trips as possible
+	DeregisterAll(services []*registry.Service, opts ...registry.DeregisterOption) error
+}
+
+// Register registers the services with RegisterAll if the registry implements it, one
+// by one otherwise
+func Register(r registry.Registry, services []*registry.Service, opts ...registry.RegisterOption) error {
+	if b, ok := r.(Registry); ok {
+		return b.RegisterAll(services, opts...)
+	}
+	for _, s := range services {
+		if err := r.Register(s, opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deregister deregisters the services with DeregisterAll if the registry implements it,
+// one by one otherwise
+func Deregister(r registry.Registry, services []*registry.Service, opts ...registry.DeregisterOption) error {
+	if b, ok := r.(Registry); ok {
+		return b.DeregisterAll(services, opts...)
+	}
+	for _, s := range services {
+		if err := r.Deregister(s, opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package bulk
+
+import (
+	"testing"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+type testRegistry struct {
+	registry.Registry
+	registered []string
+	bulk       int
+}
+
+func (r *testRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	r.registered = append(r.registered, s.Name)
+	return nil
+}
+
+type testBulkRegistry struct {
+	testRegistry
+}
+
+func (r *testBulkRegistry) RegisterAll(services []*registry.Service, opts ...registry.RegisterOption) error {
+	r.bulk++
+	for _, s := range services {
+		r.registered = append(r.registered, s.Name)
+	}
+	return nil
+}
+
+func (r *testBulkRegistry) DeregisterAll(services []*registry.Service, opts ...registry.DeregisterOption) error {
+	return nil
+}
+
+func TestRegister(t *testing.T) {
+	services := []*registry.Service{{Name: "foo"}, {Name: "bar"}}
+
+	r := new(testRegistry)
+	if err := Register(r, services); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.registered) != 2 {
+		t.Fatalf("expected the services to be registered one by one, got %v", r.registered)
+	}
+
+	b := new(testBulkRegistry)
+	if err := Register(b, services); err != nil {
+		t.Fatal(err)
+	}
+	if b.bulk != 1 || len(b.registered) != 2 {
+		t.Fatalf("expected the services to be registered at once, got %d calls for %v", b.bulk, b.registered)
+	}
+}
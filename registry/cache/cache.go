@@ -2,11 +2,206 @@
 package cache
 
 import (
+	"sync"
+	"time"
+
+	log "github.com/micro/go-micro/v2/logger"
 	"github.com/micro/go-micro/v2/registry"
 	"github.com/micro/go-micro/v2/registry/cache"
+	regutil "github.com/micro/go-micro/v2/util/registry"
+	"github.com/micro/go-plugins/registry/cache/v2/internal/registrywatch"
+)
+
+/*
+	Services are served from memory until their TTL expires. Expired services are
+	still served while they are revalidated in the background, and for as long as
+	the registry can't be reached. A single watcher keeps the cached services up to
+	date in between.
+
+	With a snapshot the cached services are persisted to disk and loaded as expired
+	on start, so a service can resolve others while the registry is down.
+*/
+
+var (
+	// DefaultTTL is the TTL of services without WithTTL
+	DefaultTTL = time.Minute
+
+	// DefaultSnapshotInterval is how often changes are persisted without WithSnapshotInterval
+	DefaultSnapshotInterval = time.Second * 30
 )
 
+type entry struct {
+	services []*registry.Service
+	expires  time.Time
+}
+
+// call is a lookup in progress, shared by concurrent callers
+type call struct {
+	done     chan struct{}
+	services []*registry.Service
+	err      error
+}
+
+type registryCache struct {
+	registry.Registry
+	opts Options
+
+	sync.RWMutex
+	entries map[string]*entry
+	calls   map[string]*call
+	// changed since the last snapshot
+	dirty bool
+
+	exit chan struct{}
+	done chan bool
+	once sync.Once
+}
+
+// fetch looks up the service in the registry and caches it
+func (c *registryCache) fetch(name string) ([]*registry.Service, error) {
+	c.Lock()
+	if cl, ok := c.calls[name]; ok {
+		c.Unlock()
+		<-cl.done
+		return cl.services, cl.err
+	}
+	cl := &call{done: make(chan struct{})}
+	c.calls[name] = cl
+	c.Unlock()
+
+	cl.services, cl.err = c.Registry.GetService(name)
+
+	c.Lock()
+	delete(c.calls, name)
+	switch cl.err {
+	case nil:
+		c.entries[name] = &entry{
+			services: regutil.Copy(cl.services),
+			expires:  time.Now().Add(c.opts.TTL),
+		}
+		c.dirty = true
+	case registry.ErrNotFound:
+		if _, ok := c.entries[name]; ok {
+			delete(c.entries, name)
+			c.dirty = true
+		}
+	default:
+		// keep serving what we have
+		log.Debugf("[cache] failed to revalidate %s: %v", name, cl.err)
+	}
+	c.Unlock()
+
+	close(cl.done)
+	return cl.services, cl.err
+}
+
+// update applies the watch result to the cached services
+func (c *registryCache) update(res *registry.Result) {
+	if res == nil || res.Service == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	// only services which are looked up are cached
+	e, ok := c.entries[res.Service.Name]
+	if !ok {
+		return
+	}
+
+	switch res.Action {
+	case "create", "update":
+		e.services = regutil.Merge(e.services, []*registry.Service{res.Service})
+	case "delete":
+		e.services = regutil.Remove(e.services, []*registry.Service{res.Service})
+	default:
+		return
+	}
+	c.dirty = true
+}
+
+func (c *registryCache) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	c.RLock()
+	e, ok := c.entries[name]
+	var (
+		services []*registry.Service
+		expired  bool
+	)
+	if ok && len(e.services) > 0 {
+		services = regutil.Copy(e.services)
+		expired = time.Now().After(e.expires)
+	}
+	c.RUnlock()
+
+	if len(services) > 0 {
+		// serve the stale services while revalidating
+		if expired {
+			go c.fetch(name)
+		}
+		return services, nil
+	}
+
+	services, err := c.fetch(name)
+	if err != nil {
+		return nil, err
+	}
+	return regutil.Copy(services), nil
+}
+
+func (c *registryCache) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
+	services, err := c.Registry.ListServices(opts...)
+	if err == nil {
+		return services, nil
+	}
+
+	// list the cached services while the registry is down
+	c.RLock()
+	defer c.RUnlock()
+
+	if len(c.entries) == 0 {
+		return nil, err
+	}
+
+	services = services[:0]
+	for name := range c.entries {
+		services = append(services, &registry.Service{Name: name})
+	}
+	return services, nil
+}
+
+func (c *registryCache) Stop() {
+	c.once.Do(func() {
+		close(c.exit)
+		<-c.done
+	})
+}
+
+func (c *registryCache) String() string {
+	return "cache"
+}
+
 // New returns a new cache
 func New(r registry.Registry, opts ...cache.Option) cache.Cache {
-	return cache.New(r, opts...)
+	options := newOptions(opts...)
+
+	c := &registryCache{
+		Registry: r,
+		opts:     options,
+		entries:  make(map[string]*entry),
+		calls:    make(map[string]*call),
+		exit:     make(chan struct{}),
+		done:     make(chan bool),
+	}
+
+	if len(options.Snapshot) > 0 {
+		if err := c.load(); err != nil {
+			log.Errorf("[cache] failed to load the snapshot %s: %v", options.Snapshot, err)
+		}
+	}
+
+	go registrywatch.Run("cache", c.exit, c.Registry.Watch, c.update)
+	go c.persist()
+
+	return c
 }
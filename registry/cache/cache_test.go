@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+var errDown = errors.New("registry is down")
+
+type mockRegistry struct {
+	registry.Registry
+
+	sync.Mutex
+	services map[string][]*registry.Service
+	down     bool
+	lookups  int
+	results  chan *registry.Result
+}
+
+func newMockRegistry() *mockRegistry {
+	return &mockRegistry{
+		services: make(map[string][]*registry.Service),
+		results:  make(chan *registry.Result),
+	}
+}
+
+func (m *mockRegistry) set(name string, services []*registry.Service, down bool) {
+	m.Lock()
+	defer m.Unlock()
+	m.services[name] = services
+	m.down = down
+}
+
+func (m *mockRegistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	m.Lock()
+	defer m.Unlock()
+	m.lookups++
+	if m.down {
+		return nil, errDown
+	}
+	services, ok := m.services[name]
+	if !ok {
+		return nil, registry.ErrNotFound
+	}
+	return services, nil
+}
+
+func (m *mockRegistry) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
+	return nil, errDown
+}
+
+func (m *mockRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	return &mockWatcher{results: m.results, exit: make(chan bool)}, nil
+}
+
+type mockWatcher struct {
+	results chan *registry.Result
+	exit    chan bool
+	once    sync.Once
+}
+
+func (w *mockWatcher) Next() (*registry.Result, error) {
+	select {
+	case r := <-w.results:
+		return r, nil
+	case <-w.exit:
+		return nil, registry.ErrWatcherStopped
+	}
+}
+
+func (w *mockWatcher) Stop() {
+	w.once.Do(func() { close(w.exit) })
+}
+
+func service(ids ...string) []*registry.Service {
+	s := &registry.Service{Name: "foo", Version: "1"}
+	for _, id := range ids {
+		s.Nodes = append(s.Nodes, &registry.Node{Id: id, Address: id + ":8080"})
+	}
+	return []*registry.Service{s}
+}
+
+func nodes(t *testing.T, c registry.Registry) int {
+	t.Helper()
+	services, err := c.GetService("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(services[0].Nodes)
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	r := newMockRegistry()
+	r.set("foo", service("a"), false)
+
+	c := New(r, WithTTL(time.Hour))
+	defer c.Stop()
+
+	if n := nodes(t, c); n != 1 {
+		t.Fatalf("expected 1 node, got %d", n)
+	}
+	nodes(t, c)
+	if r.lookups != 1 {
+		t.Fatalf("expected the service to be cached, got %d lookups", r.lookups)
+	}
+
+	// expire the service and take the registry down
+	rc := c.(*registryCache)
+	rc.Lock()
+	rc.entries["foo"].expires = time.Time{}
+	rc.Unlock()
+	r.set("foo", nil, true)
+
+	if n := nodes(t, c); n != 1 {
+		t.Fatalf("expected the stale node while the registry is down, got %d", n)
+	}
+
+	// once the registry is back the service is revalidated in the background
+	r.set("foo", service("a", "b"), false)
+	deadline := time.Now().Add(5 * time.Second)
+	for nodes(t, c) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the service to be revalidated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	services, err := c.ListServices()
+	if err != nil || len(services) != 1 || services[0].Name != "foo" {
+		t.Fatalf("expected the cached services to be listed while the registry is down, got %v %v", services, err)
+	}
+
+	if _, err := c.GetService("bar"); err != registry.ErrNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	r := newMockRegistry()
+	r.set("foo", service("a"), false)
+
+	c := New(r, WithTTL(time.Hour))
+	defer c.Stop()
+
+	nodes(t, c)
+
+	r.results <- &registry.Result{Action: "create", Service: service("b")[0]}
+	r.results <- &registry.Result{Action: "delete", Service: service("a")[0]}
+	// wait for the results to be applied
+	r.results <- &registry.Result{Action: "update", Service: &registry.Service{Name: "bar"}}
+
+	services, err := c.GetService("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services[0].Nodes) != 1 || services[0].Nodes[0].Id != "b" {
+		t.Fatalf("expected node b only, got %+v", services[0].Nodes)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "registry.json")
+
+	r := newMockRegistry()
+	r.set("foo", service("a"), false)
+
+	c := New(r, WithSnapshot(path), WithSnapshotInterval(time.Hour))
+	nodes(t, c)
+	// the snapshot is saved on stop
+	c.Stop()
+
+	// start during an outage
+	down := newMockRegistry()
+	down.set("foo", nil, true)
+
+	c = New(down, WithSnapshot(path))
+	defer c.Stop()
+
+	if n := nodes(t, c); n != 1 {
+		t.Fatalf("expected the node of the snapshot, got %d", n)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	o := newOptions(WithTTL(time.Hour), WithSnapshot("registry.json"), WithSnapshotInterval(time.Second))
+	if o.TTL != time.Hour || o.Snapshot != "registry.json" || o.SnapshotInterval != time.Second {
+		t.Fatalf("unexpected options %+v", o)
+	}
+
+	o = newOptions()
+	if o.TTL != DefaultTTL || len(o.Snapshot) > 0 || o.SnapshotInterval != DefaultSnapshotInterval {
+		t.Fatalf("expected the defaults, got %+v", o)
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if len(pending) > 0 {
+		t.Fatalf("expected no pending options, got %d", len(pending))
+	}
+}
@@ -0,0 +1,77 @@
+// Package registrywatch keeps a registry watched, watching again once the watcher stops
+package registrywatch
+
+import (
+	"math"
+	"time"
+
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+// Backoff returns the time to wait before trying again, 2^attempts * base up to max
+func Backoff(attempts int, base, max time.Duration) time.Duration {
+	if attempts == 0 {
+		return 0
+	}
+	d := time.Duration(math.Pow(2, float64(attempts))) * base
+	if d <= 0 || d > max {
+		return max
+	}
+	return d
+}
+
+// Run watches the registry with the Watch method until exit is closed, calling fn with
+// every result. The registry is watched again with a backoff whenever the watcher
+// fails, name prefixes the log messages
+func Run(name string, exit <-chan struct{}, watch func(...registry.WatchOption) (registry.Watcher, error), fn func(*registry.Result)) {
+	var attempts int
+
+	for {
+		select {
+		case <-exit:
+			return
+		case <-time.After(Backoff(attempts, time.Millisecond*10, time.Minute)):
+		}
+
+		w, err := watch()
+		if err != nil {
+			attempts++
+			log.Debugf("[%s] failed to watch the registry: %v", name, err)
+			continue
+		}
+
+		// reset once the registry can be watched
+		attempts = 0
+
+		if err := next(exit, w, fn); err != nil {
+			attempts++
+			log.Debugf("[%s] watcher stopped: %v", name, err)
+		}
+	}
+}
+
+// next calls fn with the results of the watcher until it fails or exit is closed
+func next(exit <-chan struct{}, w registry.Watcher, fn func(*registry.Result)) error {
+	stop := make(chan bool)
+	defer close(stop)
+
+	go func() {
+		select {
+		case <-exit:
+		case <-stop:
+		}
+		w.Stop()
+	}()
+
+	for {
+		res, err := w.Next()
+		if err != nil {
+			return err
+		}
+		if res == nil || res.Service == nil {
+			continue
+		}
+		fn(res)
+	}
+}
@@ -1,12 +1,85 @@
 package cache
 
 import (
+	"sync"
 	"time"
 
 	"github.com/micro/go-micro/v2/registry/cache"
 )
 
+/*
+	The options of go-micro's cache hold the TTL only. The snapshot options are kept
+	aside, keyed by the options they're applied to, until New picks them up.
+*/
+
+type Options struct {
+	// TTL is how long services are served without revalidating them
+	TTL time.Duration
+	// Snapshot is the file the cached services are persisted to
+	Snapshot string
+	// SnapshotInterval is how often changes are persisted
+	SnapshotInterval time.Duration
+}
+
+var (
+	mtx     sync.Mutex
+	pending = make(map[*cache.Options]*Options)
+)
+
+// pendingOption applies fn to the options kept aside for o
+func pendingOption(fn func(o *Options)) cache.Option {
+	return func(o *cache.Options) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		p, ok := pending[o]
+		if !ok {
+			p = new(Options)
+			pending[o] = p
+		}
+		fn(p)
+	}
+}
+
+func newOptions(opts ...cache.Option) Options {
+	o := cache.Options{TTL: DefaultTTL}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	mtx.Lock()
+	p, ok := pending[&o]
+	delete(pending, &o)
+	mtx.Unlock()
+
+	options := Options{TTL: o.TTL}
+	if ok {
+		options.Snapshot = p.Snapshot
+		options.SnapshotInterval = p.SnapshotInterval
+	}
+	if options.SnapshotInterval <= 0 {
+		options.SnapshotInterval = DefaultSnapshotInterval
+	}
+	return options
+}
+
 // WithTTL sets the cache TTL
 func WithTTL(t time.Duration) cache.Option {
 	return cache.WithTTL(t)
 }
+
+// WithSnapshot persists the cached services to the file, and loads them on start
+// so services can be resolved while the registry is down
+func WithSnapshot(path string) cache.Option {
+	return pendingOption(func(o *Options) {
+		o.Snapshot = path
+	})
+}
+
+// WithSnapshotInterval sets how often changes are persisted, DefaultSnapshotInterval
+// by default. The snapshot is written on Stop as well
+func WithSnapshotInterval(t time.Duration) cache.Option {
+	return pendingOption(func(o *Options) {
+		o.SnapshotInterval = t
+	})
+}
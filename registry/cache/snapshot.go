@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/registry"
+	regutil "github.com/micro/go-micro/v2/util/registry"
+)
+
+type snapshot struct {
+	Services map[string][]*registry.Service `json:"services"`
+	Saved    time.Time                      `json:"saved"`
+}
+
+// load caches the services of the snapshot as expired, a missing snapshot is
+// not an error
+func (c *registryCache) load() error {
+	b, err := ioutil.ReadFile(c.opts.Snapshot)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var s snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	c.Lock()
+	for name, services := range s.Services {
+		c.entries[name] = &entry{services: services}
+	}
+	c.Unlock()
+
+	log.Infof("[cache] loaded %d services saved at %v", len(s.Services), s.Saved)
+	return nil
+}
+
+// save writes the cached services to the snapshot if they changed
+func (c *registryCache) save() error {
+	c.Lock()
+	if !c.dirty {
+		c.Unlock()
+		return nil
+	}
+	s := snapshot{
+		Services: make(map[string][]*registry.Service, len(c.entries)),
+		Saved:    time.Now(),
+	}
+	for name, e := range c.entries {
+		if len(e.services) > 0 {
+			s.Services[name] = regutil.Copy(e.services)
+		}
+	}
+	c.dirty = false
+	c.Unlock()
+
+	err := writeFile(c.opts.Snapshot, s)
+	if err != nil {
+		c.Lock()
+		c.dirty = true
+		c.Unlock()
+	}
+	return err
+}
+
+// writeFile replaces the file atomically, so a crash never leaves half a snapshot
+func writeFile(path string, s snapshot) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// persist saves the snapshot every interval and once stopped
+func (c *registryCache) persist() {
+	defer close(c.done)
+
+	if len(c.opts.Snapshot) == 0 {
+		<-c.exit
+		return
+	}
+
+	t := time.NewTicker(c.opts.SnapshotInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if err := c.save(); err != nil {
+				log.Errorf("[cache] failed to save the snapshot %s: %v", c.opts.Snapshot, err)
+			}
+		case <-c.exit:
+			if err := c.save(); err != nil {
+				log.Errorf("[cache] failed to save the snapshot %s: %v", c.opts.Snapshot, err)
+			}
+			return
+		}
+	}
+}
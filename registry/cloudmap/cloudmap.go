@@ -0,0 +1,440 @@
+// Package cloudmap provides an AWS Cloud Map registry
+package cloudmap
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/servicediscovery"
+	"github.com/aws/aws-sdk-go/service/servicediscovery/servicediscoveryiface"
+	"github.com/micro/go-micro/v2/config/cmd"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+/*
+	Nodes are registered as instances of the Cloud Map service named after the
+	micro service, created in the namespace on first registration when missing.
+	The address of the node goes into the AWS_INSTANCE_IPV4 or AWS_INSTANCE_IPV6
+	and AWS_INSTANCE_PORT attributes, the version and node metadata into custom
+	attributes, so instances registered by ECS service discovery are found too.
+	Cloud Map doesn't push changes, watchers poll DiscoverInstances.
+*/
+
+var (
+	// DefaultNamespace is the namespace without the Namespace option
+	DefaultNamespace = "micro"
+
+	// attributes holding the version and id of the node
+	versionAttr = "micro_version"
+	nodeIDAttr  = "micro_node_id"
+
+	// the longest instance id accepted by Cloud Map
+	maxInstanceID = 64
+)
+
+type cloudMapRegistry struct {
+	opts   registry.Options
+	client servicediscoveryiface.ServiceDiscoveryAPI
+
+	sync.Mutex
+	namespaceID string
+	// ids of the Cloud Map services by name
+	services map[string]string
+}
+
+func init() {
+	cmd.DefaultRegistries["cloudmap"] = NewRegistry
+}
+
+func configure(c *cloudMapRegistry, opts ...registry.Option) error {
+	for _, o := range opts {
+		o(&c.opts)
+	}
+
+	if client, ok := c.opts.Context.Value(clientKey{}).(servicediscoveryiface.ServiceDiscoveryAPI); ok {
+		c.client = client
+	} else {
+		sess := session.Must(session.NewSessionWithOptions(session.Options{
+			SharedConfigState: session.SharedConfigEnable,
+		}))
+		c.client = servicediscovery.New(sess)
+	}
+
+	c.Lock()
+	c.namespaceID = ""
+	c.services = make(map[string]string)
+	c.Unlock()
+	return nil
+}
+
+func (c *cloudMapRegistry) namespace() string {
+	if ns, ok := c.opts.Context.Value(namespaceKey{}).(string); ok && len(ns) > 0 {
+		return ns
+	}
+	return DefaultNamespace
+}
+
+func (c *cloudMapRegistry) context() (context.Context, context.CancelFunc) {
+	timeout := c.opts.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+func isNotFound(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == servicediscovery.ErrCodeServiceNotFound ||
+			aerr.Code() == servicediscovery.ErrCodeNamespaceNotFound
+	}
+	return false
+}
+
+// getNamespaceID looks up the id of the namespace by name
+func (c *cloudMapRegistry) getNamespaceID(ctx context.Context) (string, error) {
+	c.Lock()
+	id := c.namespaceID
+	c.Unlock()
+	if len(id) > 0 {
+		return id, nil
+	}
+
+	name := c.namespace()
+	err := c.client.ListNamespacesPagesWithContext(ctx, &servicediscovery.ListNamespacesInput{},
+		func(out *servicediscovery.ListNamespacesOutput, last bool) bool {
+			for _, ns := range out.Namespaces {
+				if aws.StringValue(ns.Name) == name {
+					id = aws.StringValue(ns.Id)
+					return false
+				}
+			}
+			return true
+		})
+	if err != nil {
+		return "", err
+	}
+	if len(id) == 0 {
+		return "", fmt.Errorf("cloud map namespace %s not found", name)
+	}
+
+	c.Lock()
+	c.namespaceID = id
+	c.Unlock()
+	return id, nil
+}
+
+// listServices returns the ids of the services in the namespace by name
+func (c *cloudMapRegistry) listServices(ctx context.Context) (map[string]string, error) {
+	nsID, err := c.getNamespaceID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	services := make(map[string]string)
+	err = c.client.ListServicesPagesWithContext(ctx, &servicediscovery.ListServicesInput{
+		Filters: []*servicediscovery.ServiceFilter{{
+			Name:      aws.String(servicediscovery.ServiceFilterNameNamespaceId),
+			Values:    []*string{aws.String(nsID)},
+			Condition: aws.String(servicediscovery.FilterConditionEq),
+		}},
+	}, func(out *servicediscovery.ListServicesOutput, last bool) bool {
+		for _, s := range out.Services {
+			services[aws.StringValue(s.Name)] = aws.StringValue(s.Id)
+		}
+		return true
+	})
+	return services, err
+}
+
+// getServiceID returns the id of the service, creating the service when missing
+func (c *cloudMapRegistry) getServiceID(ctx context.Context, name string) (string, error) {
+	c.Lock()
+	id, ok := c.services[name]
+	c.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	services, err := c.listServices(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	id, ok = services[name]
+	if !ok {
+		nsID, err := c.getNamespaceID(ctx)
+		if err != nil {
+			return "", err
+		}
+		out, err := c.client.CreateServiceWithContext(ctx, &servicediscovery.CreateServiceInput{
+			Name:             aws.String(name),
+			NamespaceId:      aws.String(nsID),
+			CreatorRequestId: aws.String(nsID + "/" + name),
+			HealthCheckCustomConfig: &servicediscovery.HealthCheckCustomConfig{
+				FailureThreshold: aws.Int64(1),
+			},
+		})
+		if err != nil {
+			return "", err
+		}
+		id = aws.StringValue(out.Service.Id)
+	}
+
+	c.Lock()
+	c.services[name] = id
+	c.Unlock()
+	return id, nil
+}
+
+// instanceID returns the Cloud Map instance id of the node, ids too long or with
+// characters Cloud Map doesn't accept are hashed
+func instanceID(id string) string {
+	valid := len(id) > 0 && len(id) <= maxInstanceID
+	for _, r := range id {
+		if !valid {
+			break
+		}
+		valid = (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+			strings.ContainsRune("_/:.@-", r)
+	}
+	if valid {
+		return id
+	}
+	sum := sha1.Sum([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// nodeAttributes returns the attributes of the node registered with the version
+func (c *cloudMapRegistry) nodeAttributes(version string, node *registry.Node) (map[string]*string, error) {
+	host, port, err := net.SplitHostPort(node.Address)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("cloud map requires an ip address, got %s", node.Address)
+	}
+
+	attrs := make(map[string]*string)
+	for k, v := range node.Metadata {
+		if !strings.HasPrefix(k, "AWS_") {
+			attrs[k] = aws.String(v)
+		}
+	}
+	if extra, ok := c.opts.Context.Value(attributesKey{}).(map[string]string); ok {
+		for k, v := range extra {
+			attrs[k] = aws.String(v)
+		}
+	}
+
+	if ip.To4() != nil {
+		attrs["AWS_INSTANCE_IPV4"] = aws.String(host)
+	} else {
+		attrs["AWS_INSTANCE_IPV6"] = aws.String(host)
+	}
+	attrs["AWS_INSTANCE_PORT"] = aws.String(port)
+	attrs[versionAttr] = aws.String(version)
+	attrs[nodeIDAttr] = aws.String(node.Id)
+	return attrs, nil
+}
+
+// instancesToServices groups the discovered instances into services by version
+func instancesToServices(name string, instances []*servicediscovery.HttpInstanceSummary) []*registry.Service {
+	services := make(map[string]*registry.Service)
+	var list []*registry.Service
+
+	for _, instance := range instances {
+		attrs := aws.StringValueMap(instance.Attributes)
+
+		host, ok := attrs["AWS_INSTANCE_IPV4"]
+		if !ok {
+			host, ok = attrs["AWS_INSTANCE_IPV6"]
+		}
+		port, pok := attrs["AWS_INSTANCE_PORT"]
+		if !ok || !pok {
+			continue
+		}
+
+		id := aws.StringValue(instance.InstanceId)
+		if v, ok := attrs[nodeIDAttr]; ok {
+			id = v
+		}
+		version := attrs[versionAttr]
+
+		metadata := make(map[string]string)
+		for k, v := range attrs {
+			if strings.HasPrefix(k, "AWS_") || k == versionAttr || k == nodeIDAttr {
+				continue
+			}
+			metadata[k] = v
+		}
+
+		service, ok := services[version]
+		if !ok {
+			service = &registry.Service{Name: name, Version: version}
+			services[version] = service
+			list = append(list, service)
+		}
+		service.Nodes = append(service.Nodes, &registry.Node{
+			Id:       id,
+			Address:  net.JoinHostPort(host, port),
+			Metadata: metadata,
+		})
+	}
+
+	return list
+}
+
+func (c *cloudMapRegistry) Init(opts ...registry.Option) error {
+	return configure(c, opts...)
+}
+
+func (c *cloudMapRegistry) Options() registry.Options {
+	return c.opts
+}
+
+func (c *cloudMapRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("Require at least one node")
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	serviceID, err := c.getServiceID(ctx, s.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range s.Nodes {
+		attrs, err := c.nodeAttributes(s.Version, node)
+		if err != nil {
+			return err
+		}
+
+		_, err = c.client.RegisterInstanceWithContext(ctx, &servicediscovery.RegisterInstanceInput{
+			ServiceId:  aws.String(serviceID),
+			InstanceId: aws.String(instanceID(node.Id)),
+			Attributes: attrs,
+		})
+		if isNotFound(err) {
+			// the service was deleted, look it up again on the next registration
+			c.Lock()
+			delete(c.services, s.Name)
+			c.Unlock()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *cloudMapRegistry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("Require at least one node")
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+
+	serviceID, err := c.getServiceID(ctx, s.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range s.Nodes {
+		_, err := c.client.DeregisterInstanceWithContext(ctx, &servicediscovery.DeregisterInstanceInput{
+			ServiceId:  aws.String(serviceID),
+			InstanceId: aws.String(instanceID(node.Id)),
+		})
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// discover returns the instances of the service with the configured health status
+func (c *cloudMapRegistry) discover(name string) ([]*servicediscovery.HttpInstanceSummary, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	status, _ := c.opts.Context.Value(healthStatusKey{}).(string)
+	if len(status) == 0 {
+		status = servicediscovery.HealthStatusFilterHealthy
+	}
+
+	out, err := c.client.DiscoverInstancesWithContext(ctx, &servicediscovery.DiscoverInstancesInput{
+		NamespaceName: aws.String(c.namespace()),
+		ServiceName:   aws.String(name),
+		HealthStatus:  aws.String(status),
+		MaxResults:    aws.Int64(100),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Instances, nil
+}
+
+func (c *cloudMapRegistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	instances, err := c.discover(name)
+	if isNotFound(err) {
+		return nil, registry.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	services := instancesToServices(name, instances)
+	if len(services) == 0 {
+		return nil, registry.ErrNotFound
+	}
+	return services, nil
+}
+
+func (c *cloudMapRegistry) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	services, err := c.listServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*registry.Service, 0, len(services))
+	for name := range services {
+		list = append(list, &registry.Service{Name: name})
+	}
+	return list, nil
+}
+
+func (c *cloudMapRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	return newWatcher(c, opts...), nil
+}
+
+func (c *cloudMapRegistry) String() string {
+	return "cloudmap"
+}
+
+func NewRegistry(opts ...registry.Option) registry.Registry {
+	c := &cloudMapRegistry{
+		opts: registry.Options{
+			Context: context.Background(),
+		},
+	}
+	configure(c, opts...)
+	return c
+}
@@ -0,0 +1,218 @@
+package cloudmap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/servicediscovery"
+	"github.com/aws/aws-sdk-go/service/servicediscovery/servicediscoveryiface"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+type mockClient struct {
+	servicediscoveryiface.ServiceDiscoveryAPI
+
+	services  map[string]string
+	created   []*servicediscovery.CreateServiceInput
+	instances map[string]*servicediscovery.RegisterInstanceInput
+	health    map[string]string
+}
+
+func newMockClient() *mockClient {
+	return &mockClient{
+		services:  make(map[string]string),
+		instances: make(map[string]*servicediscovery.RegisterInstanceInput),
+		health:    make(map[string]string),
+	}
+}
+
+func (m *mockClient) ListNamespacesPagesWithContext(ctx aws.Context, in *servicediscovery.ListNamespacesInput, fn func(*servicediscovery.ListNamespacesOutput, bool) bool, opts ...request.Option) error {
+	fn(&servicediscovery.ListNamespacesOutput{
+		Namespaces: []*servicediscovery.NamespaceSummary{
+			{Id: aws.String("ns-other"), Name: aws.String("other")},
+			{Id: aws.String("ns-micro"), Name: aws.String("micro")},
+		},
+	}, true)
+	return nil
+}
+
+func (m *mockClient) ListServicesPagesWithContext(ctx aws.Context, in *servicediscovery.ListServicesInput, fn func(*servicediscovery.ListServicesOutput, bool) bool, opts ...request.Option) error {
+	var out servicediscovery.ListServicesOutput
+	for name, id := range m.services {
+		out.Services = append(out.Services, &servicediscovery.ServiceSummary{Id: aws.String(id), Name: aws.String(name)})
+	}
+	fn(&out, true)
+	return nil
+}
+
+func (m *mockClient) CreateServiceWithContext(ctx aws.Context, in *servicediscovery.CreateServiceInput, opts ...request.Option) (*servicediscovery.CreateServiceOutput, error) {
+	m.created = append(m.created, in)
+	id := "srv-" + aws.StringValue(in.Name)
+	m.services[aws.StringValue(in.Name)] = id
+	return &servicediscovery.CreateServiceOutput{Service: &servicediscovery.Service{Id: aws.String(id)}}, nil
+}
+
+func (m *mockClient) RegisterInstanceWithContext(ctx aws.Context, in *servicediscovery.RegisterInstanceInput, opts ...request.Option) (*servicediscovery.RegisterInstanceOutput, error) {
+	m.instances[aws.StringValue(in.ServiceId)+"/"+aws.StringValue(in.InstanceId)] = in
+	return &servicediscovery.RegisterInstanceOutput{}, nil
+}
+
+func (m *mockClient) DeregisterInstanceWithContext(ctx aws.Context, in *servicediscovery.DeregisterInstanceInput, opts ...request.Option) (*servicediscovery.DeregisterInstanceOutput, error) {
+	delete(m.instances, aws.StringValue(in.ServiceId)+"/"+aws.StringValue(in.InstanceId))
+	return &servicediscovery.DeregisterInstanceOutput{}, nil
+}
+
+func (m *mockClient) DiscoverInstancesWithContext(ctx aws.Context, in *servicediscovery.DiscoverInstancesInput, opts ...request.Option) (*servicediscovery.DiscoverInstancesOutput, error) {
+	id, ok := m.services[aws.StringValue(in.ServiceName)]
+	if !ok {
+		return nil, awserr.New(servicediscovery.ErrCodeServiceNotFound, "not found", nil)
+	}
+
+	var out servicediscovery.DiscoverInstancesOutput
+	for key, instance := range m.instances {
+		if !strings.HasPrefix(key, id+"/") {
+			continue
+		}
+		status := m.health[aws.StringValue(instance.InstanceId)]
+		if len(status) == 0 {
+			status = servicediscovery.HealthStatusHealthy
+		}
+		if f := aws.StringValue(in.HealthStatus); f != servicediscovery.HealthStatusFilterAll && f != status {
+			continue
+		}
+		out.Instances = append(out.Instances, &servicediscovery.HttpInstanceSummary{
+			InstanceId:   instance.InstanceId,
+			Attributes:   instance.Attributes,
+			HealthStatus: aws.String(status),
+		})
+	}
+	return &out, nil
+}
+
+func newTestRegistry(c *mockClient, opts ...registry.Option) registry.Registry {
+	return NewRegistry(append([]registry.Option{Client(c)}, opts...)...)
+}
+
+func TestRegister(t *testing.T) {
+	c := newMockClient()
+	r := newTestRegistry(c, Attributes(map[string]string{"team": "shop"}))
+
+	svc := &registry.Service{
+		Name:    "go.micro.srv.foo",
+		Version: "1.0.0",
+		Nodes: []*registry.Node{
+			{Id: "go.micro.srv.foo-6f2a9c1e-4bd3-4f6a-9d2e-1c0b7a8e5f43", Address: "10.0.0.1:8080", Metadata: map[string]string{"protocol": "grpc"}},
+		},
+	}
+	if err := r.Register(svc); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(svc); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.created) != 1 || aws.StringValue(c.created[0].NamespaceId) != "ns-micro" {
+		t.Fatalf("expected the service to be created once in the micro namespace, got %v", c.created)
+	}
+	if len(c.instances) != 1 {
+		t.Fatalf("expected 1 instance, got %d", len(c.instances))
+	}
+	for _, in := range c.instances {
+		if id := aws.StringValue(in.InstanceId); len(id) > maxInstanceID {
+			t.Fatalf("expected the instance id to fit cloud map, got %s", id)
+		}
+		attrs := aws.StringValueMap(in.Attributes)
+		if attrs["AWS_INSTANCE_IPV4"] != "10.0.0.1" || attrs["AWS_INSTANCE_PORT"] != "8080" {
+			t.Fatalf("unexpected address attributes %v", attrs)
+		}
+		if attrs["team"] != "shop" || attrs["protocol"] != "grpc" || attrs[versionAttr] != "1.0.0" {
+			t.Fatalf("unexpected custom attributes %v", attrs)
+		}
+	}
+
+	services, err := r.GetService("go.micro.srv.foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || services[0].Version != "1.0.0" || len(services[0].Nodes) != 1 {
+		t.Fatalf("unexpected services %+v", services)
+	}
+	node := services[0].Nodes[0]
+	if node.Id != svc.Nodes[0].Id || node.Address != "10.0.0.1:8080" || node.Metadata["protocol"] != "grpc" {
+		t.Fatalf("unexpected node %+v", node)
+	}
+
+	if err := r.Deregister(svc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetService("go.micro.srv.foo"); err != registry.ErrNotFound {
+		t.Fatalf("expected not found after deregistering, got %v", err)
+	}
+}
+
+func TestHealthStatus(t *testing.T) {
+	c := newMockClient()
+	r := newTestRegistry(c)
+
+	svc := &registry.Service{
+		Name:  "foo",
+		Nodes: []*registry.Node{{Id: "foo-1", Address: "10.0.0.1:8080"}, {Id: "foo-2", Address: "10.0.0.2:8080"}},
+	}
+	if err := r.Register(svc); err != nil {
+		t.Fatal(err)
+	}
+	c.health["foo-2"] = servicediscovery.HealthStatusUnhealthy
+
+	services, err := r.GetService("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services[0].Nodes) != 1 || services[0].Nodes[0].Id != "foo-1" {
+		t.Fatalf("expected only the healthy node, got %+v", services[0].Nodes)
+	}
+
+	all := newTestRegistry(c, HealthStatus(servicediscovery.HealthStatusFilterAll))
+	services, err = all.GetService("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services[0].Nodes) != 2 {
+		t.Fatalf("expected all nodes, got %d", len(services[0].Nodes))
+	}
+}
+
+func TestWatcherUpdate(t *testing.T) {
+	w := &cloudMapWatcher{
+		next:  make(chan *registry.Result, 10),
+		exit:  make(chan bool),
+		nodes: make(map[string]map[string]*registry.Service),
+	}
+
+	a := &registry.Node{Id: "a", Address: "10.0.0.1:8080"}
+	b := &registry.Node{Id: "b", Address: "10.0.0.2:8080"}
+
+	w.update("foo", []*registry.Service{{Name: "foo", Nodes: []*registry.Node{a}}}, false)
+	if len(w.next) != 0 {
+		t.Fatal("expected the first poll not to send results")
+	}
+
+	w.update("foo", []*registry.Service{{Name: "foo", Nodes: []*registry.Node{b}}}, true)
+	for _, expect := range []string{"create", "delete"} {
+		r := <-w.next
+		if r.Action != expect {
+			t.Fatalf("expected %s, got %s", expect, r.Action)
+		}
+	}
+}
+
+func TestInstanceID(t *testing.T) {
+	if id := instanceID("foo-1"); id != "foo-1" {
+		t.Fatalf("expected valid ids to be kept, got %s", id)
+	}
+	if id := instanceID("foo bar"); id == "foo bar" || len(id) > maxInstanceID {
+		t.Fatalf("expected invalid ids to be hashed, got %s", id)
+	}
+}
@@ -0,0 +1,45 @@
+package cloudmap
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/service/servicediscovery/servicediscoveryiface"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+type clientKey struct{}
+type namespaceKey struct{}
+type healthStatusKey struct{}
+type attributesKey struct{}
+
+func setOption(k, v interface{}) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// Client sets the Cloud Map client used instead of one created from the shared config
+func Client(c servicediscoveryiface.ServiceDiscoveryAPI) registry.Option {
+	return setOption(clientKey{}, c)
+}
+
+// Namespace sets the name of the Cloud Map namespace services are registered and
+// discovered in, by default DefaultNamespace
+func Namespace(name string) registry.Option {
+	return setOption(namespaceKey{}, name)
+}
+
+// HealthStatus sets the health status of discovered instances, HEALTHY by default.
+// UNHEALTHY or ALL can be used for debugging
+func HealthStatus(status string) registry.Option {
+	return setOption(healthStatusKey{}, status)
+}
+
+// Attributes adds custom attributes to every registered instance, next to the
+// metadata of the node
+func Attributes(attrs map[string]string) registry.Option {
+	return setOption(attributesKey{}, attrs)
+}
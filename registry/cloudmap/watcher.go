@@ -0,0 +1,151 @@
+package cloudmap
+
+import (
+	"reflect"
+	"time"
+
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+var (
+	// WatchPollInterval is how often watchers discover the instances of services
+	WatchPollInterval = time.Second * 10
+)
+
+type cloudMapWatcher struct {
+	c       *cloudMapRegistry
+	service string
+	next    chan *registry.Result
+	exit    chan bool
+
+	// nodes of every service by node id, each a service with the node
+	nodes map[string]map[string]*registry.Service
+}
+
+func newWatcher(c *cloudMapRegistry, opts ...registry.WatchOption) registry.Watcher {
+	var wo registry.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	w := &cloudMapWatcher{
+		c:       c,
+		service: wo.Service,
+		next:    make(chan *registry.Result),
+		exit:    make(chan bool),
+		nodes:   make(map[string]map[string]*registry.Service),
+	}
+
+	go w.poll()
+	return w
+}
+
+func (w *cloudMapWatcher) poll() {
+	t := time.NewTicker(WatchPollInterval)
+	defer t.Stop()
+
+	// the first poll only records the nodes
+	notify := false
+
+	for {
+		names := []string{w.service}
+		if len(w.service) == 0 {
+			services, err := w.c.ListServices()
+			if err != nil {
+				log.Errorf("[cloudmap] failed to list services: %v", err)
+			}
+			names = names[:0]
+			for _, s := range services {
+				names = append(names, s.Name)
+			}
+		}
+
+		for _, name := range names {
+			instances, err := w.c.discover(name)
+			if err != nil && !isNotFound(err) {
+				log.Errorf("[cloudmap] failed to discover %s: %v", name, err)
+				continue
+			}
+			if !w.update(name, instancesToServices(name, instances), notify) {
+				return
+			}
+		}
+		notify = true
+
+		select {
+		case <-w.exit:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// update sends the nodes of the service which were created, updated or deleted
+// since the last poll, it returns false once the watcher is stopped
+func (w *cloudMapWatcher) update(name string, services []*registry.Service, notify bool) bool {
+	nodes := make(map[string]*registry.Service)
+	for _, service := range services {
+		for _, node := range service.Nodes {
+			nodes[node.Id] = &registry.Service{
+				Name:    service.Name,
+				Version: service.Version,
+				Nodes:   []*registry.Node{node},
+			}
+		}
+	}
+
+	old := w.nodes[name]
+	w.nodes[name] = nodes
+	if !notify {
+		return true
+	}
+
+	for id, service := range nodes {
+		prev, ok := old[id]
+		switch {
+		case !ok:
+			if !w.send("create", service) {
+				return false
+			}
+		case !reflect.DeepEqual(prev, service):
+			if !w.send("update", service) {
+				return false
+			}
+		}
+	}
+	for id, service := range old {
+		if _, ok := nodes[id]; !ok {
+			if !w.send("delete", service) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (w *cloudMapWatcher) send(action string, service *registry.Service) bool {
+	select {
+	case w.next <- &registry.Result{Action: action, Service: service}:
+		return true
+	case <-w.exit:
+		return false
+	}
+}
+
+func (w *cloudMapWatcher) Next() (*registry.Result, error) {
+	select {
+	case r := <-w.next:
+		return r, nil
+	case <-w.exit:
+		return nil, registry.ErrWatcherStopped
+	}
+}
+
+func (w *cloudMapWatcher) Stop() {
+	select {
+	case <-w.exit:
+	default:
+		close(w.exit)
+	}
+}
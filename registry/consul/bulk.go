@@ -0,0 +1,229 @@
+package consul
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+/*
+	The agent API registers one service per request, so services registered in bulk
+	are written to the catalog through /v1/txn instead, all of them or none in a
+	single request. Agents only manage the services of their own node and remove
+	those they don't know about, the services are registered on a node of their own
+	which is created in the same transaction, micro-bulk-<hostname> by default.
+
+	Agents don't run the checks of such nodes, so with a TTL the services carry the
+	deadline of the registration in their meta instead of a TTL check. Services past
+	their deadline are skipped like critical ones, and RegisterAll deletes those of
+	its node, so the services of a crashed process expire like with Register and are
+	removed once the process registers again. Without a TTL they stay registered
+	until DeregisterAll.
+*/
+
+// the Registry interface of the bulk package, implemented without importing it
+var _ interface {
+	RegisterAll(services []*registry.Service, opts ...registry.RegisterOption) error
+	DeregisterAll(services []*registry.Service, opts ...registry.DeregisterOption) error
+} = (*consulRegistry)(nil)
+
+// maxTxnOps is the default limit of operations in a consul transaction
+var maxTxnOps = 64
+
+// bulkExpiresKey is the service meta key of the deadline of services registered in bulk
+const bulkExpiresKey = "micro-bulk-expires"
+
+// bulkNode returns the catalog node services are registered on in bulk
+func (c *consulRegistry) bulkNode() string {
+	if c.opts.Context != nil {
+		if n, ok := c.opts.Context.Value("consul_bulk_node").(string); ok && len(n) > 0 {
+			return n
+		}
+	}
+	// never the node of the agent, which removes the services it doesn't know about
+	n, _ := os.Hostname()
+	return "micro-bulk-" + n
+}
+
+// expired reports whether the deadline of a service registered in bulk has passed,
+// other services never expire
+func expired(s *consul.AgentService) bool {
+	if s == nil {
+		return false
+	}
+	v, ok := s.Meta[bulkExpiresKey]
+	if !ok {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return false
+	}
+	return time.Now().After(t)
+}
+
+// txn applies the operations in a single transaction
+func (c *consulRegistry) txn(ops consul.TxnOps) error {
+	if len(ops) > maxTxnOps {
+		return fmt.Errorf("%d operations exceed the %d of a transaction", len(ops), maxTxnOps)
+	}
+
+	ok, rsp, _, err := c.Client().Txn().Txn(ops, nil)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+
+	// rolled back
+	var errs []string
+	if rsp != nil {
+		for _, e := range rsp.Errors {
+			errs = append(errs, fmt.Sprintf("operation %d: %s", e.OpIndex, e.What))
+		}
+	}
+	return errors.New("transaction rolled back: " + strings.Join(errs, ", "))
+}
+
+// catalogService returns the catalog entry of the node of the service, expiring at
+// the deadline unless it's zero
+func (c *consulRegistry) catalogService(s *registry.Service, node *registry.Node, deadline time.Time) consul.AgentService {
+	host, pt, _ := net.SplitHostPort(node.Address)
+	if host == "" {
+		host = node.Address
+	}
+	port, _ := strconv.Atoi(pt)
+
+	as := consul.AgentService{
+		ID:        node.Id,
+		Service:   s.Name,
+		Tags:      serviceTags(s, node),
+		Port:      port,
+		Address:   host,
+		Namespace: c.config.Namespace,
+		Partition: c.config.Partition,
+	}
+	if w := agentWeights(node.Metadata); w != nil {
+		as.Weights = *w
+	}
+	if !deadline.IsZero() {
+		as.Meta = map[string]string{bulkExpiresKey: deadline.Format(time.RFC3339Nano)}
+	}
+	return as
+}
+
+// reap returns the operations deleting the expired services of the node, the
+// services being registered are kept
+func (c *consulRegistry) reap(name string, keep map[string]bool) consul.TxnOps {
+	node, _, err := c.Client().Catalog().Node(name, c.queryOptions)
+	if err != nil || node == nil {
+		return nil
+	}
+
+	var ops consul.TxnOps
+	for id, s := range node.Services {
+		if keep[id] || !expired(s) {
+			continue
+		}
+		ops = append(ops, &consul.TxnOp{
+			Service: &consul.ServiceTxnOp{
+				Verb:    consul.ServiceDelete,
+				Node:    name,
+				Service: consul.AgentService{ID: id},
+			},
+		})
+	}
+	return ops
+}
+
+// RegisterAll registers the nodes of the services in the catalog in one transaction,
+// all of them or none. The transaction holds at most 63 nodes. With a TTL the nodes
+// expire unless they're registered again in time, as go-micro does for Register
+func (c *consulRegistry) RegisterAll(services []*registry.Service, opts ...registry.RegisterOption) error {
+	var options registry.RegisterOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	var deadline time.Time
+	if options.TTL > 0 {
+		deadline = time.Now().Add(options.TTL)
+	}
+
+	name := c.bulkNode()
+	keep := make(map[string]bool)
+
+	var ops consul.TxnOps
+	for _, s := range services {
+		if len(s.Nodes) == 0 {
+			return errors.New("Require at least one node")
+		}
+		for _, node := range s.Nodes {
+			// create the node with the first service
+			if len(ops) == 0 {
+				host, _, _ := net.SplitHostPort(node.Address)
+				if host == "" {
+					host = node.Address
+				}
+				ops = append(ops, &consul.TxnOp{
+					Node: &consul.NodeTxnOp{
+						Verb: consul.NodeSet,
+						Node: consul.Node{Node: name, Address: host},
+					},
+				})
+			}
+			ops = append(ops, &consul.TxnOp{
+				Service: &consul.ServiceTxnOp{
+					Verb:    consul.ServiceSet,
+					Node:    name,
+					Service: c.catalogService(s, node, deadline),
+				},
+			})
+			keep[node.Id] = true
+		}
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+
+	// the expired services of the node go in the same transaction, if there's room
+	for _, op := range c.reap(name, keep) {
+		if len(ops) >= maxTxnOps {
+			break
+		}
+		ops = append(ops, op)
+	}
+
+	return c.txn(ops)
+}
+
+// DeregisterAll deregisters the nodes of the services from the catalog in one transaction
+func (c *consulRegistry) DeregisterAll(services []*registry.Service, opts ...registry.DeregisterOption) error {
+	name := c.bulkNode()
+
+	var ops consul.TxnOps
+	for _, s := range services {
+		for _, node := range s.Nodes {
+			ops = append(ops, &consul.TxnOp{
+				Service: &consul.ServiceTxnOp{
+					Verb:    consul.ServiceDelete,
+					Node:    name,
+					Service: consul.AgentService{ID: node.Id},
+				},
+			})
+		}
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+
+	return c.txn(ops)
+}
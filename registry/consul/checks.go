@@ -0,0 +1,159 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	consul "github.com/hashicorp/consul/api"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+var (
+	// DefaultCheckInterval is how often consul runs a health check
+	DefaultCheckInterval = 10 * time.Second
+	// DefaultCheckTimeout is how long consul waits for a health check to respond
+	DefaultCheckTimeout = 5 * time.Second
+)
+
+type healthCheck struct {
+	http     string
+	method   string
+	grpc     string
+	tcp      bool
+	useTLS   bool
+	insecure bool
+
+	interval        time.Duration
+	timeout         time.Duration
+	deregisterAfter time.Duration
+}
+
+// CheckOption configures a health check consul runs against the service
+type CheckOption func(*healthCheck)
+
+// CheckInterval sets how often consul runs the check, defaults to DefaultCheckInterval
+func CheckInterval(d time.Duration) CheckOption {
+	return func(c *healthCheck) {
+		c.interval = d
+	}
+}
+
+// CheckTimeout sets how long consul waits for the check to respond, defaults to DefaultCheckTimeout
+func CheckTimeout(d time.Duration) CheckOption {
+	return func(c *healthCheck) {
+		c.timeout = d
+	}
+}
+
+// CheckDeregisterAfter sets how long the check may be critical before consul
+// deregisters the service, defaults to a minute past the interval
+func CheckDeregisterAfter(d time.Duration) CheckOption {
+	return func(c *healthCheck) {
+		c.deregisterAfter = d
+	}
+}
+
+// CheckTLS checks the service over TLS, optionally without verifying its certificate
+func CheckTLS(skipVerify bool) CheckOption {
+	return func(c *healthCheck) {
+		c.useTLS = true
+		c.insecure = skipVerify
+	}
+}
+
+// CheckMethod sets the method of HTTP checks, defaults to GET
+func CheckMethod(m string) CheckOption {
+	return func(c *healthCheck) {
+		c.method = m
+	}
+}
+
+func setCheck(c *healthCheck, opts []CheckOption) registry.RegisterOption {
+	for _, o := range opts {
+		o(c)
+	}
+	return func(o *registry.RegisterOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		checks, _ := o.Context.Value("consul_checks").([]*healthCheck)
+		o.Context = context.WithValue(o.Context, "consul_checks", append(checks[:len(checks):len(checks)], c))
+	}
+}
+
+// HTTPCheck registers the service with a check requesting the given path of the
+// node address, or the given URL, which passes on a 2xx response
+func HTTPCheck(path string, opts ...CheckOption) registry.RegisterOption {
+	return setCheck(&healthCheck{http: path}, opts)
+}
+
+// GRPCCheck registers the service with a check calling the gRPC health checking
+// protocol of the node for the given service, the empty service is the server
+func GRPCCheck(service string, opts ...CheckOption) registry.RegisterOption {
+	return setCheck(&healthCheck{grpc: service}, opts)
+}
+
+// TCPHealthCheck registers the service with a check connecting to the node address
+func TCPHealthCheck(opts ...CheckOption) registry.RegisterOption {
+	return setCheck(&healthCheck{tcp: true}, opts)
+}
+
+// agentCheck returns the consul check of the node address
+func (c *healthCheck) agentCheck(address string) *consul.AgentServiceCheck {
+	interval := c.interval
+	if interval <= 0 {
+		interval = DefaultCheckInterval
+	}
+	timeout := c.timeout
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	deregister := c.deregisterAfter
+	if deregister <= 0 {
+		deregister = getDeregisterTTL(interval)
+	}
+
+	check := &consul.AgentServiceCheck{
+		Interval:                       interval.String(),
+		Timeout:                        timeout.String(),
+		DeregisterCriticalServiceAfter: deregister.String(),
+		TLSSkipVerify:                  c.insecure,
+	}
+
+	switch {
+	case c.tcp:
+		check.TCP = address
+	case len(c.http) > 0:
+		check.HTTP = c.http
+		if !strings.Contains(c.http, "://") {
+			scheme := "http"
+			if c.useTLS {
+				scheme = "https"
+			}
+			check.HTTP = fmt.Sprintf("%s://%s/%s", scheme, address, strings.TrimPrefix(c.http, "/"))
+		}
+		check.Method = c.method
+	default:
+		check.GRPC = address
+		if len(c.grpc) > 0 {
+			check.GRPC += "/" + c.grpc
+		}
+		check.GRPCUseTLS = c.useTLS
+	}
+
+	return check
+}
+
+// RegisterChecks adds the checks to every registration, for services registered
+// by the go-micro server which doesn't pass register options through e.g
+// consul.RegisterChecks(consul.HTTPCheck("/health"))
+func RegisterChecks(checks ...registry.RegisterOption) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, "consul_register_checks", checks)
+	}
+}
@@ -0,0 +1,48 @@
+package consul
+
+import (
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+func TestHealthChecks(t *testing.T) {
+	var options registry.RegisterOptions
+	for _, o := range []registry.RegisterOption{
+		HTTPCheck("/health", CheckInterval(time.Second), CheckTLS(true)),
+		HTTPCheck("http://10.0.0.2/ready", CheckMethod("HEAD")),
+		GRPCCheck("greeter", CheckDeregisterAfter(time.Hour)),
+		TCPHealthCheck(CheckTimeout(time.Second)),
+	} {
+		o(&options)
+	}
+
+	checks, _ := options.Context.Value("consul_checks").([]*healthCheck)
+	if len(checks) != 4 {
+		t.Fatalf("expected 4 checks, got %d", len(checks))
+	}
+
+	httpsCheck := checks[0].agentCheck("10.0.0.1:8080")
+	if httpsCheck.HTTP != "https://10.0.0.1:8080/health" || !httpsCheck.TLSSkipVerify || httpsCheck.Interval != "1s" || httpsCheck.Timeout != "5s" {
+		t.Fatalf("unexpected http check %+v", httpsCheck)
+	}
+	if httpsCheck.DeregisterCriticalServiceAfter != getDeregisterTTL(time.Second).String() {
+		t.Fatalf("unexpected deregister after %s", httpsCheck.DeregisterCriticalServiceAfter)
+	}
+
+	urlCheck := checks[1].agentCheck("10.0.0.1:8080")
+	if urlCheck.HTTP != "http://10.0.0.2/ready" || urlCheck.Method != "HEAD" {
+		t.Fatalf("unexpected http check %+v", urlCheck)
+	}
+
+	grpcCheck := checks[2].agentCheck("10.0.0.1:8080")
+	if grpcCheck.GRPC != "10.0.0.1:8080/greeter" || grpcCheck.DeregisterCriticalServiceAfter != "1h0m0s" {
+		t.Fatalf("unexpected grpc check %+v", grpcCheck)
+	}
+
+	tcpCheck := checks[3].agentCheck("10.0.0.1:8080")
+	if tcpCheck.TCP != "10.0.0.1:8080" || tcpCheck.Timeout != "1s" || tcpCheck.Interval != DefaultCheckInterval.String() {
+		t.Fatalf("unexpected tcp check %+v", tcpCheck)
+	}
+}
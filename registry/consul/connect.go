@@ -0,0 +1,52 @@
+package consul
+
+import (
+	"net"
+	"sort"
+	"strconv"
+
+	consul "github.com/hashicorp/consul/api"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+// sidecarService returns the registration of the sidecar proxy of a service
+func (c *consulRegistry) sidecarService() *consul.AgentServiceRegistration {
+	var upstreams []consul.Upstream
+	for name, port := range c.upstreams {
+		upstreams = append(upstreams, consul.Upstream{
+			DestinationName:  name,
+			LocalBindAddress: "127.0.0.1",
+			LocalBindPort:    port,
+		})
+	}
+	// keep the registration stable across calls
+	sort.Slice(upstreams, func(i, j int) bool {
+		return upstreams[i].DestinationName < upstreams[j].DestinationName
+	})
+
+	return &consul.AgentServiceRegistration{
+		Port: c.sidecarPort,
+		Proxy: &consul.AgentServiceConnectProxyConfig{
+			Upstreams: upstreams,
+		},
+	}
+}
+
+// localServices replaces the nodes of an upstream with the local sidecar, which
+// balances the connections across the nodes itself
+func localServices(services []*registry.Service, port int) []*registry.Service {
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+
+	for _, s := range services {
+		if len(s.Nodes) == 0 {
+			continue
+		}
+		s.Nodes = []*registry.Node{{
+			Id:       s.Name + "-sidecar-" + strconv.Itoa(port),
+			Address:  address,
+			Metadata: s.Nodes[0].Metadata,
+		}}
+	}
+
+	return services
+}
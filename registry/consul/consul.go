@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"os"
 	"runtime"
 	"strconv"
 	"sync"
@@ -13,6 +14,7 @@ import (
 
 	consul "github.com/hashicorp/consul/api"
 	"github.com/micro/go-micro/v2/config/cmd"
+	"github.com/micro/go-micro/v2/logger"
 	"github.com/micro/go-micro/v2/registry"
 	mnet "github.com/micro/go-micro/v2/util/net"
 	hash "github.com/mitchellh/hashstructure"
@@ -27,6 +29,10 @@ type consulRegistry struct {
 
 	// connect enabled
 	connect bool
+	// register a sidecar proxy, resolving the upstreams through it
+	sidecar     bool
+	sidecarPort int
+	upstreams   map[string]int
 
 	queryOptions *consul.QueryOptions
 
@@ -75,6 +81,20 @@ func newTransport(config *tls.Config) *http.Transport {
 	return t
 }
 
+// setting returns the option with the given key, the value already set or the
+// environment variable, in that order
+func setting(opts registry.Options, key, env, value string) string {
+	if opts.Context != nil {
+		if v, ok := opts.Context.Value(key).(string); ok {
+			return v
+		}
+	}
+	if len(value) > 0 {
+		return value
+	}
+	return os.Getenv(env)
+}
+
 func configure(c *consulRegistry, opts ...registry.Option) {
 	// set opts
 	for _, o := range opts {
@@ -92,6 +112,13 @@ func configure(c *consulRegistry, opts ...registry.Option) {
 		if cn, ok := c.opts.Context.Value("consul_connect").(bool); ok {
 			c.connect = cn
 		}
+		if port, ok := c.opts.Context.Value("consul_sidecar").(int); ok {
+			c.sidecar = true
+			c.sidecarPort = port
+		}
+		if u, ok := c.opts.Context.Value("consul_upstreams").(map[string]int); ok {
+			c.upstreams = u
+		}
 
 		// Use the consul query options passed in the options, if available
 		if qo, ok := c.opts.Context.Value("consul_query_options").(*consul.QueryOptions); ok && qo != nil {
@@ -102,6 +129,11 @@ func configure(c *consulRegistry, opts ...registry.Option) {
 		}
 	}
 
+	// the client applies the token, namespace and partition to every request
+	config.Token = setting(c.opts, "consul_token", consul.HTTPTokenEnvName, config.Token)
+	config.Namespace = setting(c.opts, "consul_namespace", consul.HTTPNamespaceEnvName, config.Namespace)
+	config.Partition = setting(c.opts, "consul_partition", consul.HTTPPartitionEnvName, config.Partition)
+
 	// check if there are any addrs
 	var addrs []string
 
@@ -152,6 +184,39 @@ func configure(c *consulRegistry, opts ...registry.Option) {
 
 func (c *consulRegistry) Init(opts ...registry.Option) error {
 	configure(c, opts...)
+	return c.Validate()
+}
+
+// Validate checks the options for mistakes which would otherwise only surface
+// on the first call to consul, such as addresses which are silently ignored
+func (c *consulRegistry) Validate() error {
+	for _, address := range c.opts.Addrs {
+		_, _, err := net.SplitHostPort(address)
+		if ae, ok := err.(*net.AddrError); ok && ae.Err == "missing port in address" {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("invalid address %q: %v", address, err)
+		}
+	}
+
+	if c.opts.Timeout < 0 {
+		return fmt.Errorf("invalid timeout %v", c.opts.Timeout)
+	}
+
+	if c.config == nil {
+		return nil
+	}
+
+	if auth := c.config.HttpAuth; auth != nil && len(auth.Username) == 0 {
+		return errors.New("http auth requires a username")
+	}
+
+	tc := c.config.TLSConfig
+	if (len(tc.CertFile) > 0) != (len(tc.KeyFile) > 0) {
+		return errors.New("tls config requires both a cert file and key file")
+	}
+
 	return nil
 }
 
@@ -170,6 +235,13 @@ func (c *consulRegistry) Deregister(s *registry.Service, opts ...registry.Deregi
 	return c.Client().Agent().ServiceDeregister(node.Id)
 }
 
+// serviceTags encodes the metadata of the node, the endpoints and the version of the service
+func serviceTags(s *registry.Service, node *registry.Node) []string {
+	tags := encodeMetadata(node.Metadata)
+	tags = append(tags, encodeEndpoints(s.Endpoints)...)
+	return append(tags, encodeVersion(s.Version)...)
+}
+
 func (c *consulRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
 	if len(s.Nodes) == 0 {
 		return errors.New("Require at least one node")
@@ -179,6 +251,11 @@ func (c *consulRegistry) Register(s *registry.Service, opts ...registry.Register
 	var regInterval time.Duration
 
 	var options registry.RegisterOptions
+	if c.opts.Context != nil {
+		if checks, ok := c.opts.Context.Value("consul_register_checks").([]registry.RegisterOption); ok {
+			opts = append(checks[:len(checks):len(checks)], opts...)
+		}
+	}
 	for _, o := range opts {
 		o(&options)
 	}
@@ -190,6 +267,14 @@ func (c *consulRegistry) Register(s *registry.Service, opts ...registry.Register
 		}
 	}
 
+	var healthChecks []*healthCheck
+	if options.Context != nil {
+		healthChecks, _ = options.Context.Value("consul_checks").([]*healthCheck)
+	}
+
+	// consul probes the service, there is no TTL check to pass
+	probed := regTCPCheck || len(healthChecks) > 0
+
 	// create hash of service; uint64
 	h, err := hash.Hash(s, nil)
 	if err != nil {
@@ -207,7 +292,7 @@ func (c *consulRegistry) Register(s *registry.Service, opts ...registry.Register
 
 	// if it's already registered and matches then just pass the check
 	if ok && v == h {
-		if options.TTL == time.Duration(0) {
+		if options.TTL == time.Duration(0) || probed {
 			// ensure that our service hasn't been deregistered by Consul
 			if time.Since(lastChecked) <= getDeregisterTTL(regInterval) {
 				return nil
@@ -229,14 +314,16 @@ func (c *consulRegistry) Register(s *registry.Service, opts ...registry.Register
 		}
 	}
 
-	// encode the tags
-	tags := encodeMetadata(node.Metadata)
-	tags = append(tags, encodeEndpoints(s.Endpoints)...)
-	tags = append(tags, encodeVersion(s.Version)...)
+	tags := serviceTags(s, node)
 
 	var check *consul.AgentServiceCheck
+	var checks consul.AgentServiceChecks
 
-	if regTCPCheck {
+	if len(healthChecks) > 0 {
+		for _, hc := range healthChecks {
+			checks = append(checks, hc.agentCheck(node.Address))
+		}
+	} else if regTCPCheck {
 		deregTTL := getDeregisterTTL(regInterval)
 
 		check = &consul.AgentServiceCheck{
@@ -269,10 +356,19 @@ func (c *consulRegistry) Register(s *registry.Service, opts ...registry.Register
 		Port:    port,
 		Address: host,
 		Check:   check,
+		Checks:  checks,
+		Weights: agentWeights(node.Metadata),
+		// set the tenancy explicitly, the agent applies defaults otherwise
+		Namespace: c.config.Namespace,
+		Partition: c.config.Partition,
 	}
 
-	// Specify consul connect
-	if c.connect {
+	// Specify consul connect, a service is either native or proxied
+	if c.sidecar {
+		asr.Connect = &consul.AgentServiceConnect{
+			SidecarService: c.sidecarService(),
+		}
+	} else if c.connect {
 		asr.Connect = &consul.AgentServiceConnect{
 			Native: true,
 		}
@@ -289,7 +385,7 @@ func (c *consulRegistry) Register(s *registry.Service, opts ...registry.Register
 	c.Unlock()
 
 	// if the TTL is 0 we don't mess with the checks
-	if options.TTL == time.Duration(0) {
+	if options.TTL == time.Duration(0) || probed {
 		return nil
 	}
 
@@ -343,7 +439,8 @@ func (c *consulRegistry) GetService(name string, opts ...registry.GetOption) ([]
 			serviceMap[key] = svc
 		}
 
-		var del bool
+		// nodes registered in bulk past their deadline are gone
+		del := expired(s.Service)
 
 		for _, check := range s.Checks {
 			// delete the node if the status is critical
@@ -361,7 +458,7 @@ func (c *consulRegistry) GetService(name string, opts ...registry.GetOption) ([]
 		svc.Nodes = append(svc.Nodes, &registry.Node{
 			Id:       id,
 			Address:  mnet.HostPort(address, s.Service.Port),
-			Metadata: decodeMetadata(s.Service.Tags),
+			Metadata: setWeight(s, decodeMetadata(s.Service.Tags)),
 		})
 	}
 
@@ -369,6 +466,11 @@ func (c *consulRegistry) GetService(name string, opts ...registry.GetOption) ([]
 	for _, service := range serviceMap {
 		services = append(services, service)
 	}
+
+	// upstreams are reached through the sidecar
+	if port, ok := c.upstreams[name]; ok && c.sidecar {
+		services = localServices(services, port)
+	}
 	return services, nil
 }
 
@@ -439,5 +541,9 @@ func NewRegistry(opts ...registry.Option) registry.Registry {
 		},
 	}
 	configure(cr, opts...)
+	// the registry can't be returned with an error, Init returns it
+	if err := cr.Validate(); err != nil {
+		logger.Errorf("[consul] invalid options: %v", err)
+	}
 	return cr
 }
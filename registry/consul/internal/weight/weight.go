@@ -0,0 +1,34 @@
+// Package weight is the node weight, the consul, etcd and kubernetes registries and
+// the weighted selector use the same key and default
+package weight
+
+import (
+	"strconv"
+)
+
+const (
+	// Key is the node metadata key of the weight, a non-negative integer
+	// relative to the other nodes of the service
+	Key = "weight"
+
+	// Default is the weight of nodes without a valid weight
+	Default = 100
+)
+
+// Get returns the weight of the node metadata, the Default if it has none or it's invalid
+func Get(md map[string]string) int {
+	w, err := strconv.Atoi(md[Key])
+	if err != nil || w < 0 {
+		return Default
+	}
+	return w
+}
+
+// Set returns the metadata with the weight set, creating it if nil
+func Set(md map[string]string, w int) map[string]string {
+	if md == nil {
+		md = make(map[string]string)
+	}
+	md[Key] = strconv.Itoa(w)
+	return md
+}
@@ -0,0 +1,28 @@
+package weight
+
+import (
+	"testing"
+)
+
+func TestWeight(t *testing.T) {
+	testData := []struct {
+		md     map[string]string
+		weight int
+	}{
+		{nil, Default},
+		{map[string]string{Key: "5"}, 5},
+		{map[string]string{Key: "0"}, 0},
+		{map[string]string{Key: "-1"}, Default},
+		{map[string]string{Key: "heavy"}, Default},
+	}
+
+	for _, d := range testData {
+		if w := Get(d.md); w != d.weight {
+			t.Fatalf("Expected weight %d for %v, got %d", d.weight, d.md, w)
+		}
+	}
+
+	if md := Set(nil, 5); md[Key] != "5" {
+		t.Fatalf("Expected the weight to be set, got %v", md)
+	}
+}
@@ -34,7 +34,6 @@ func Config(c *consul.Config) registry.Option {
 // Defaults to true.
 //
 // [1] https://www.consul.io/docs/agent/options.html#allow_stale
-//
 func AllowStale(v bool) registry.Option {
 	return func(o *registry.Options) {
 		if o.Context == nil {
@@ -48,7 +47,6 @@ func AllowStale(v bool) registry.Option {
 // Consul. See `Consul API` for more information [1].
 //
 // [1] https://godoc.org/github.com/hashicorp/consul/api#QueryOptions
-//
 func QueryOptions(q *consul.QueryOptions) registry.Option {
 	return func(o *registry.Options) {
 		if q == nil {
@@ -61,13 +59,11 @@ func QueryOptions(q *consul.QueryOptions) registry.Option {
 	}
 }
 
-//
 // TCPCheck will tell the service provider to check the service address
 // and port every `t` interval. It will enabled only if `t` is greater than 0.
 // See `TCP + Interval` for more information [1].
 //
 // [1] https://www.consul.io/docs/agent/checks.html
-//
 func TCPCheck(t time.Duration) registry.Option {
 	return func(o *registry.Options) {
 		if t <= time.Duration(0) {
@@ -79,3 +75,78 @@ func TCPCheck(t time.Duration) registry.Option {
 		o.Context = context.WithValue(o.Context, "consul_tcp_check", t)
 	}
 }
+
+// Token sets the ACL token of every request to Consul. Without it the token is
+// read from the CONSUL_HTTP_TOKEN environment variable
+func Token(t string) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, "consul_token", t)
+	}
+}
+
+// Namespace sets the Consul Enterprise namespace services are registered in and
+// looked up from. Without it the namespace is read from CONSUL_NAMESPACE
+func Namespace(ns string) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, "consul_namespace", ns)
+	}
+}
+
+// Partition sets the Consul Enterprise admin partition services are registered
+// in and looked up from. Without it the partition is read from CONSUL_PARTITION
+func Partition(p string) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, "consul_partition", p)
+	}
+}
+
+// Sidecar registers services with a Consul Connect sidecar proxy listening on the
+// port, a port of 0 lets consul pick one. The proxy itself, e.g envoy, is started
+// separately with `consul connect envoy -sidecar-for <service id>`
+func Sidecar(port int) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, "consul_sidecar", port)
+	}
+}
+
+// Upstream adds the service as an upstream of the sidecar, bound to the port on
+// localhost. The service then resolves to the sidecar, which connects to it over
+// mTLS subject to the intentions. It requires Sidecar
+func Upstream(service string, port int) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		upstreams, _ := o.Context.Value("consul_upstreams").(map[string]int)
+		u := make(map[string]int, len(upstreams)+1)
+		for k, v := range upstreams {
+			u[k] = v
+		}
+		u[service] = port
+		o.Context = context.WithValue(o.Context, "consul_upstreams", u)
+	}
+}
+
+// BulkNode sets the catalog node RegisterAll registers services on, micro-bulk-<hostname>
+// by default. The node is created with the services, it must not be the node of a
+// Consul agent as the agent removes the services it doesn't know about
+func BulkNode(name string) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, "consul_bulk_node", name)
+	}
+}
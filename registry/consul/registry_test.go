@@ -6,11 +6,15 @@ import (
 	"errors"
 	"net"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	consul "github.com/hashicorp/consul/api"
 	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-plugins/registry/consul/v2/internal/weight"
 )
 
 type mockRegistry struct {
@@ -167,6 +171,30 @@ func TestConsul_GetService_WithUnhealthyServiceNode(t *testing.T) {
 	}
 }
 
+func TestConsul_GetService_WithExpiredBulkNode(t *testing.T) {
+	// nodes registered in bulk have no checks, their deadline passed
+	svcs := []*consul.ServiceEntry{
+		newServiceEntry("node-name-1", "node-address-1", "service-name", "v1.0.0", nil),
+		newServiceEntry("node-name-2", "node-address-2", "service-name", "v1.0.0", nil),
+	}
+	svcs[1].Service.Meta = map[string]string{bulkExpiresKey: time.Now().Add(-time.Second).Format(time.RFC3339Nano)}
+
+	cr, cl := newConsulTestRegistry(&mockRegistry{
+		status: 200,
+		body:   newServiceList(svcs),
+		url:    "/v1/health/service/service-name",
+	})
+	defer cl()
+
+	svc, err := cr.GetService("service-name")
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	if len(svc) != 1 || len(svc[0].Nodes) != 1 || !strings.HasPrefix(svc[0].Nodes[0].Address, "node-address-1") {
+		t.Fatalf("Expected the expired node to be skipped, got %+v", svc)
+	}
+}
+
 func TestConsul_GetService_WithUnhealthyServiceNodes(t *testing.T) {
 	// warning is still seen as healthy, critical is not
 	svcs := []*consul.ServiceEntry{
@@ -206,3 +234,235 @@ func TestConsul_GetService_WithUnhealthyServiceNodes(t *testing.T) {
 		t.Fatalf("Expected len of nodes to be `%d`, got `%d`.", exp, act)
 	}
 }
+
+func TestConsul_Validate(t *testing.T) {
+	testData := []struct {
+		opts  []registry.Option
+		valid bool
+	}{
+		{nil, true},
+		{[]registry.Option{registry.Addrs("127.0.0.1")}, true},
+		{[]registry.Option{registry.Addrs("127.0.0.1:8500:1")}, false},
+		{[]registry.Option{Config(&consul.Config{HttpAuth: &consul.HttpBasicAuth{Password: "pass"}})}, false},
+		{[]registry.Option{Config(&consul.Config{TLSConfig: consul.TLSConfig{CertFile: "cert.pem"}})}, false},
+	}
+
+	for _, d := range testData {
+		r := NewRegistry(d.opts...).(*consulRegistry)
+		if err := r.Validate(); (err == nil) != d.valid {
+			t.Fatalf("expected valid %v, got %v", d.valid, err)
+		}
+	}
+}
+
+func TestConsul_RegisterAll(t *testing.T) {
+	var (
+		mtx sync.Mutex
+		ops consul.TxnOps
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/txn", func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		ops = nil
+		if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		w.Write([]byte(`{"Results": [], "Errors": null}`))
+	})
+	// foo-1 and old-1 expired, foo-1 is registered again
+	past := time.Now().Add(-time.Minute).Format(time.RFC3339Nano)
+	mux.HandleFunc("/v1/catalog/node/micro-host", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&consul.CatalogNode{
+			Node: &consul.Node{Node: "micro-host"},
+			Services: map[string]*consul.AgentService{
+				"foo-1":  {ID: "foo-1", Meta: map[string]string{bulkExpiresKey: past}},
+				"old-1":  {ID: "old-1", Meta: map[string]string{bulkExpiresKey: past}},
+				"live-1": {ID: "live-1", Meta: map[string]string{bulkExpiresKey: time.Now().Add(time.Minute).Format(time.RFC3339Nano)}},
+			},
+		})
+	})
+
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go http.Serve(l, mux)
+
+	cfg := consul.DefaultConfig()
+	cfg.Address = l.Addr().String()
+	cr := &consulRegistry{
+		config:       cfg,
+		Address:      []string{cfg.Address},
+		register:     make(map[string]uint64),
+		lastChecked:  make(map[string]time.Time),
+		queryOptions: &consul.QueryOptions{},
+	}
+	BulkNode("micro-host")(&cr.opts)
+	cr.Client()
+
+	var services []*registry.Service
+	for _, name := range []string{"foo", "bar", "baz"} {
+		services = append(services, &registry.Service{
+			Name:    name,
+			Version: "1.0.0",
+			Nodes: []*registry.Node{
+				{Id: name + "-1", Address: "10.0.0.1:8080"},
+			},
+		})
+	}
+
+	if err := cr.RegisterAll(services, registry.RegisterTTL(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	// the node, the services and the expired service in a single transaction
+	if len(ops) != len(services)+2 {
+		t.Fatalf("Expected %d operations, got %d", len(services)+2, len(ops))
+	}
+	if op := ops[len(ops)-1].Service; op == nil || op.Verb != consul.ServiceDelete || op.Service.ID != "old-1" {
+		t.Fatalf("Expected the expired service to be deleted, got %+v", ops[len(ops)-1])
+	}
+	if ops[0].Node == nil || ops[0].Node.Node.Node != "micro-host" || ops[0].Node.Node.Address != "10.0.0.1" {
+		t.Fatalf("Expected the node to be set first, got %+v", ops[0])
+	}
+	for i, s := range services {
+		op := ops[i+1].Service
+		if op == nil || op.Verb != consul.ServiceSet || op.Node != "micro-host" {
+			t.Fatalf("Expected the service %s to be set on the node, got %+v", s.Name, ops[i+1])
+		}
+		if op.Service.ID != s.Nodes[0].Id || op.Service.Service != s.Name || op.Service.Port != 8080 {
+			t.Fatalf("Unexpected service %+v", op.Service)
+		}
+		if expired(&op.Service) || len(op.Service.Meta[bulkExpiresKey]) == 0 {
+			t.Fatalf("Expected the service to expire after the TTL, got %+v", op.Service.Meta)
+		}
+	}
+
+	mtx.Unlock()
+	if err := cr.DeregisterAll(services); err != nil {
+		t.Fatal(err)
+	}
+	mtx.Lock()
+	if len(ops) != len(services) || ops[0].Service == nil || ops[0].Service.Verb != consul.ServiceDelete {
+		t.Fatalf("Expected the services to be deleted, got %d operations", len(ops))
+	}
+}
+
+func TestConsul_Tenancy(t *testing.T) {
+	os.Setenv(consul.HTTPTokenEnvName, "env-token")
+	os.Setenv(consul.HTTPNamespaceEnvName, "env-ns")
+	defer func() {
+		os.Unsetenv(consul.HTTPTokenEnvName)
+		os.Unsetenv(consul.HTTPNamespaceEnvName)
+	}()
+
+	testData := []struct {
+		opts      []registry.Option
+		token     string
+		namespace string
+		partition string
+	}{
+		{nil, "env-token", "env-ns", ""},
+		{[]registry.Option{Token("token"), Namespace("ns"), Partition("part")}, "token", "ns", "part"},
+		{[]registry.Option{Config(&consul.Config{Token: "config-token"})}, "config-token", "env-ns", ""},
+	}
+
+	for _, d := range testData {
+		r := NewRegistry(d.opts...).(*consulRegistry)
+		if r.config.Token != d.token || r.config.Namespace != d.namespace || r.config.Partition != d.partition {
+			t.Fatalf("expected %s/%s/%s, got %s/%s/%s", d.token, d.namespace, d.partition,
+				r.config.Token, r.config.Namespace, r.config.Partition)
+		}
+	}
+}
+
+func TestConsul_Sidecar(t *testing.T) {
+	svcs := []*consul.ServiceEntry{
+		newServiceEntry("node-name-1", "10.0.0.1", "upstream", "v1.0.0", nil),
+		newServiceEntry("node-name-2", "10.0.0.2", "upstream", "v1.0.0", nil),
+	}
+
+	cr, cl := newConsulTestRegistry(&mockRegistry{
+		status: 200,
+		body:   newServiceList(svcs),
+		url:    "/v1/health/service/upstream",
+	})
+	defer cl()
+	configure(cr, Sidecar(21000), Upstream("upstream", 9191), Upstream("other", 9192))
+
+	svc, err := cr.GetService("upstream")
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	if len(svc) != 1 || len(svc[0].Nodes) != 1 || svc[0].Nodes[0].Address != "127.0.0.1:9191" {
+		t.Fatalf("Expected the upstream to resolve to the sidecar, got %+v", svc)
+	}
+
+	sidecar := cr.sidecarService()
+	if sidecar.Port != 21000 || len(sidecar.Proxy.Upstreams) != 2 {
+		t.Fatalf("Unexpected sidecar %+v", sidecar)
+	}
+	if u := sidecar.Proxy.Upstreams[1]; u.DestinationName != "upstream" || u.LocalBindPort != 9191 {
+		t.Fatalf("Unexpected upstream %+v", u)
+	}
+}
+
+func TestConsul_GetService_Weights(t *testing.T) {
+	passing := newServiceEntry(
+		"node-name-1", "node-address-1", "service-name", "v1.0.0",
+		[]*consul.HealthCheck{newHealthCheck("node-name-1", "service-name", "passing")},
+	)
+	passing.Service.ID = "passing"
+	passing.Service.Weights = consul.AgentWeights{Passing: 10, Warning: 1}
+
+	warning := newServiceEntry(
+		"node-name-2", "node-address-2", "service-name", "v1.0.0",
+		[]*consul.HealthCheck{newHealthCheck("node-name-2", "service-name", "warning")},
+	)
+	warning.Service.ID = "warning"
+	warning.Service.Weights = consul.AgentWeights{Passing: 10, Warning: 1}
+
+	// registered without weights
+	unweighted := newServiceEntry(
+		"node-name-3", "node-address-3", "service-name", "v1.0.0",
+		[]*consul.HealthCheck{newHealthCheck("node-name-3", "service-name", "passing")},
+	)
+	unweighted.Service.ID = "unweighted"
+	unweighted.Service.Weights = consul.AgentWeights{Passing: 1, Warning: 1}
+
+	cr, cl := newConsulTestRegistry(&mockRegistry{
+		status: 200,
+		body:   newServiceList([]*consul.ServiceEntry{passing, warning, unweighted}),
+		url:    "/v1/health/service/service-name",
+	})
+	defer cl()
+
+	svc, err := cr.GetService("service-name")
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+
+	weights := make(map[string]string)
+	for _, n := range svc[0].Nodes {
+		weights[n.Id] = n.Metadata[weight.Key]
+	}
+	if weights["passing"] != "10" || weights["warning"] != "1" || weights["unweighted"] != "100" {
+		t.Fatalf("Expected the weights of the checks, got %v", weights)
+	}
+
+	if w := agentWeights(map[string]string{weight.Key: "5"}); w == nil || w.Passing != 5 {
+		t.Fatalf("Expected the registered weight, got %+v", w)
+	}
+	if w := agentWeights(map[string]string{weight.Key: "heavy"}); w == nil || w.Passing != weight.Default {
+		t.Fatalf("Expected the default weight, got %+v", w)
+	}
+	if w := agentWeights(map[string]string{weight.Key: "0"}); w != nil {
+		t.Fatalf("Expected no weights, got %+v", w)
+	}
+}
@@ -1,22 +1,45 @@
 package consul
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"os"
+	"reflect"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/consul/api"
-	"github.com/hashicorp/consul/api/watch"
+	"github.com/micro/go-micro/v2/logger"
 	"github.com/micro/go-micro/v2/registry"
 	regutil "github.com/micro/go-micro/v2/util/registry"
 )
 
+/*
+	The watcher runs blocking queries, each query waits on the server until the
+	index of the data changes past the index returned by the last one, so changes
+	in between two queries are never missed and an idle cluster costs one request
+	per WatchWaitTime. The catalog is watched for services coming and going and
+	every service, or only the service of the watch options, has a query of its
+	own. Failed queries back off so an unavailable server isn't hammered.
+*/
+
+var (
+	// WatchWaitTime bounds how long a blocking query waits for a change
+	WatchWaitTime = 5 * time.Minute
+	// WatchMinBackoff is the delay before retrying a failed query, doubling up to WatchMaxBackoff
+	WatchMinBackoff = time.Second
+	// WatchMaxBackoff is the longest delay before retrying a failed query
+	WatchMaxBackoff = time.Minute
+)
+
 type consulWatcher struct {
-	r        *consulRegistry
-	wo       registry.WatchOptions
-	wp       *watch.Plan
-	watchers map[string]*watch.Plan
+	r  *consulRegistry
+	wo registry.WatchOptions
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	// watchers cancel the queries of services, only used by the catalog query
+	watchers map[string]context.CancelFunc
 
 	next chan *registry.Result
 	exit chan bool
@@ -31,38 +54,168 @@ func newConsulWatcher(cr *consulRegistry, opts ...registry.WatchOption) (registr
 		o(&wo)
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+
 	cw := &consulWatcher{
 		r:        cr,
 		wo:       wo,
+		ctx:      ctx,
+		cancel:   cancel,
 		exit:     make(chan bool),
 		next:     make(chan *registry.Result, 10),
-		watchers: make(map[string]*watch.Plan),
+		watchers: make(map[string]context.CancelFunc),
 		services: make(map[string][]*registry.Service),
 	}
 
-	wp, err := watch.Parse(map[string]interface{}{"type": "services"})
-	if err != nil {
-		return nil, err
-	}
+	// the client is shared by the queries
+	cr.Client()
 
-	wp.Handler = cw.handle
-	go wp.RunWithClientAndLogger(cr.Client(), log.New(os.Stderr, "", log.LstdFlags))
-	cw.wp = wp
+	// only watch the service we care about
+	if len(wo.Service) > 0 {
+		go cw.watchService(ctx, wo.Service)
+	} else {
+		go cw.watchCatalog()
+	}
 
 	return cw, nil
 }
 
-func (cw *consulWatcher) serviceHandler(idx uint64, data interface{}) {
-	entries, ok := data.([]*api.ServiceEntry)
-	if !ok {
-		return
+// nextIndex returns the index to wait on after a query returned last, the index
+// is reset when it goes backwards e.g after the raft snapshot was restored
+func nextIndex(prev, last uint64) uint64 {
+	if last < prev {
+		return 0
+	}
+	if last == 0 {
+		return 1
+	}
+	return last
+}
+
+// query returns the query options waiting for a change past the index
+func (cw *consulWatcher) query(ctx context.Context, index uint64) *api.QueryOptions {
+	q := api.QueryOptions{}
+	if cw.r.queryOptions != nil {
+		q = *cw.r.queryOptions
+	}
+	q.WaitIndex = index
+	q.WaitTime = WatchWaitTime
+	return q.WithContext(ctx)
+}
+
+// backoff waits before retrying a failed query, it returns false once the query is stopped
+func backoff(ctx context.Context, d *time.Duration) bool {
+	if *d == 0 {
+		*d = WatchMinBackoff
+	} else if *d *= 2; *d > WatchMaxBackoff {
+		*d = WatchMaxBackoff
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(*d):
+		return true
 	}
+}
+
+// watchCatalog runs blocking queries of the services of the catalog
+func (cw *consulWatcher) watchCatalog() {
+	var index uint64
+	var wait time.Duration
+
+	for {
+		services, meta, err := cw.r.Client().Catalog().Services(cw.query(cw.ctx, index))
+		if err != nil {
+			if cw.ctx.Err() != nil {
+				return
+			}
+			logger.Errorf("[consul] failed to watch services: %v", err)
+			if !backoff(cw.ctx, &wait) {
+				return
+			}
+			continue
+		}
+		wait = 0
 
+		// the query timed out without a change
+		if index > 0 && meta.LastIndex == index {
+			continue
+		}
+		index = nextIndex(index, meta.LastIndex)
+
+		cw.handle(services)
+	}
+}
+
+// watchService runs blocking queries of the nodes of the service until cancelled
+func (cw *consulWatcher) watchService(ctx context.Context, service string) {
+	var index uint64
+	var wait time.Duration
+
+	for {
+		var entries []*api.ServiceEntry
+		var meta *api.QueryMeta
+		var err error
+
+		// if we're connect enabled only get connect services
+		if cw.r.connect {
+			entries, meta, err = cw.r.Client().Health().Connect(service, "", false, cw.query(ctx, index))
+		} else {
+			entries, meta, err = cw.r.Client().Health().Service(service, "", false, cw.query(ctx, index))
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Errorf("[consul] failed to watch service %s: %v", service, err)
+			if !backoff(ctx, &wait) {
+				return
+			}
+			continue
+		}
+		wait = 0
+
+		if index > 0 && meta.LastIndex == index {
+			continue
+		}
+		index = nextIndex(index, meta.LastIndex)
+
+		// the service may have been deregistered while the query ran
+		if ctx.Err() != nil {
+			return
+		}
+		cw.update(service, entries)
+	}
+}
+
+// send delivers the result unless the watcher is stopped
+func (cw *consulWatcher) send(r *registry.Result) {
+	select {
+	case cw.next <- r:
+	case <-cw.exit:
+	}
+}
+
+// sortNodes orders the nodes of the services so they can be compared
+func sortNodes(services []*registry.Service) {
+	for _, s := range services {
+		sort.Slice(s.Nodes, func(i, j int) bool {
+			return s.Nodes[i].Id < s.Nodes[j].Id
+		})
+	}
+}
+
+// update sends the changes between the cached versions of the service and the
+// service entries, a service without entries is deleted
+func (cw *consulWatcher) update(serviceName string, entries []*api.ServiceEntry) {
 	serviceMap := map[string]*registry.Service{}
-	serviceName := ""
 
 	for _, e := range entries {
-		serviceName = e.Service.Service
+		if e.Service.Service != serviceName {
+			continue
+		}
+
 		// version is now a tag
 		version, _ := decodeVersion(e.Service.Tags)
 		// service ID is now the node id
@@ -87,7 +240,8 @@ func (cw *consulWatcher) serviceHandler(idx uint64, data interface{}) {
 			serviceMap[key] = svc
 		}
 
-		var del bool
+		// nodes registered in bulk past their deadline are gone
+		del := expired(e.Service)
 
 		for _, check := range e.Checks {
 			// delete the node if the status is critical
@@ -105,151 +259,120 @@ func (cw *consulWatcher) serviceHandler(idx uint64, data interface{}) {
 		svc.Nodes = append(svc.Nodes, &registry.Node{
 			Id:       id,
 			Address:  fmt.Sprintf("%s:%d", address, e.Service.Port),
-			Metadata: decodeMetadata(e.Service.Tags),
+			Metadata: setWeight(e, decodeMetadata(e.Service.Tags)),
 		})
 	}
 
-	cw.RLock()
-	// make a copy
-	rservices := make(map[string][]*registry.Service)
-	for k, v := range cw.services {
-		rservices[k] = v
+	var newServices []*registry.Service
+	for _, s := range serviceMap {
+		newServices = append(newServices, s)
 	}
-	cw.RUnlock()
+	sortNodes(newServices)
 
-	var newServices []*registry.Service
+	// upstreams are reached through the sidecar
+	if port, ok := cw.r.upstreams[serviceName]; ok && cw.r.sidecar {
+		newServices = localServices(newServices, port)
+	}
 
-	// serviceMap is the new set of services keyed by name+version
-	for _, newService := range serviceMap {
-		// append to the new set of cached services
-		newServices = append(newServices, newService)
+	cw.RLock()
+	oldServices, exists := cw.services[serviceName]
+	cw.RUnlock()
 
-		// check if the service exists in the existing cache
-		oldServices, ok := rservices[serviceName]
-		if !ok {
-			// does not exist? then we're creating brand new entries
-			cw.next <- &registry.Result{Action: "create", Service: newService}
-			continue
+	// serviceMap is the new set of services keyed by version
+	for _, newService := range newServices {
+		var oldService *registry.Service
+		for _, s := range oldServices {
+			if s.Version == newService.Version {
+				oldService = s
+				break
+			}
 		}
 
-		// service exists. ok let's figure out what to update and delete version wise
-		action := "create"
+		// does not exist? then we're creating brand new entries
+		if oldService == nil {
+			cw.send(&registry.Result{Action: "create", Service: newService})
+			continue
+		}
 
-		for _, oldService := range oldServices {
-			// does this version exist?
-			// no? then default to create
-			if oldService.Version != newService.Version {
-				continue
-			}
+		// only send updates of versions which changed
+		if reflect.DeepEqual(oldService, newService) {
+			continue
+		}
 
-			// yes? then it's an update
-			action = "update"
-
-			var nodes []*registry.Node
-			// check the old nodes to see if they've been deleted
-			for _, oldNode := range oldService.Nodes {
-				var seen bool
-				for _, newNode := range newService.Nodes {
-					if newNode.Id == oldNode.Id {
-						seen = true
-						break
-					}
-				}
-				// does the old node exist in the new set of nodes
-				// no? then delete that shit
-				if !seen {
-					nodes = append(nodes, oldNode)
+		// check the old nodes to see if they've been deleted
+		var nodes []*registry.Node
+		for _, oldNode := range oldService.Nodes {
+			var seen bool
+			for _, newNode := range newService.Nodes {
+				if newNode.Id == oldNode.Id {
+					seen = true
+					break
 				}
 			}
-
-			// it's an update rather than creation
-			if len(nodes) > 0 {
-				delService := regutil.CopyService(oldService)
-				delService.Nodes = nodes
-				cw.next <- &registry.Result{Action: "delete", Service: delService}
+			if !seen {
+				nodes = append(nodes, oldNode)
 			}
 		}
 
-		cw.next <- &registry.Result{Action: action, Service: newService}
+		if len(nodes) > 0 {
+			delService := regutil.CopyService(oldService)
+			delService.Nodes = nodes
+			cw.send(&registry.Result{Action: "delete", Service: delService})
+		}
+
+		cw.send(&registry.Result{Action: "update", Service: newService})
 	}
 
 	// Now check old versions that may not be in new services map
-	for _, old := range rservices[serviceName] {
-		// old version does not exist in new version map
-		// kill it with fire!
+	for _, old := range oldServices {
 		if _, ok := serviceMap[old.Version]; !ok {
-			cw.next <- &registry.Result{Action: "delete", Service: old}
+			cw.send(&registry.Result{Action: "delete", Service: old})
 		}
 	}
 
 	cw.Lock()
-	cw.services[serviceName] = newServices
+	if exists || len(newServices) > 0 {
+		cw.services[serviceName] = newServices
+	}
 	cw.Unlock()
 }
 
-func (cw *consulWatcher) handle(idx uint64, data interface{}) {
-	services, ok := data.(map[string][]string)
-	if !ok {
-		return
-	}
-
+// handle starts watching services added to the catalog and deletes the services
+// removed from it
+func (cw *consulWatcher) handle(services map[string][]string) {
 	// add new watchers
-	for service, _ := range services {
-		// Filter on watch options
-		// wo.Service: Only watch services we care about
-		if len(cw.wo.Service) > 0 && service != cw.wo.Service {
-			continue
-		}
-
+	for service := range services {
 		if _, ok := cw.watchers[service]; ok {
 			continue
 		}
-		wp, err := watch.Parse(map[string]interface{}{
-			"type":    "service",
-			"service": service,
-		})
-		if err == nil {
-			wp.Handler = cw.serviceHandler
-			go wp.RunWithClientAndLogger(cw.r.Client(), log.New(os.Stderr, "", log.LstdFlags))
-			cw.watchers[service] = wp
-			cw.next <- &registry.Result{Action: "create", Service: &registry.Service{Name: service}}
-		}
-	}
 
-	cw.RLock()
-	// make a copy
-	rservices := make(map[string][]*registry.Service)
-	for k, v := range cw.services {
-		rservices[k] = v
-	}
-	cw.RUnlock()
+		ctx, cancel := context.WithCancel(cw.ctx)
+		cw.watchers[service] = cancel
+		go cw.watchService(ctx, service)
 
-	// remove unknown services from registry
-	// save the things we want to delete
-	deleted := make(map[string][]*registry.Service)
-
-	for service, _ := range rservices {
-		if _, ok := services[service]; !ok {
-			cw.Lock()
-			// save this before deleting
-			deleted[service] = cw.services[service]
-			delete(cw.services, service)
-			cw.Unlock()
-		}
+		cw.send(&registry.Result{Action: "create", Service: &registry.Service{Name: service}})
 	}
 
 	// remove unknown services from watchers
-	for service, w := range cw.watchers {
-		if _, ok := services[service]; !ok {
-			w.Stop()
-			delete(cw.watchers, service)
-			for _, oldService := range deleted[service] {
-				// send a delete for the service nodes that we're removing
-				cw.next <- &registry.Result{Action: "delete", Service: oldService}
-			}
-			// sent the empty list as the last resort to indicate to delete the entire service
-			cw.next <- &registry.Result{Action: "delete", Service: &registry.Service{Name: service}}
+	for service, cancel := range cw.watchers {
+		if _, ok := services[service]; ok {
+			continue
+		}
+
+		cancel()
+		delete(cw.watchers, service)
+
+		cw.Lock()
+		deleted := cw.services[service]
+		delete(cw.services, service)
+		cw.Unlock()
+
+		for _, oldService := range deleted {
+			// send a delete for the service nodes that we're removing
+			cw.send(&registry.Result{Action: "delete", Service: oldService})
 		}
+		// sent the empty list as the last resort to indicate to delete the entire service
+		cw.send(&registry.Result{Action: "delete", Service: &registry.Service{Name: service}})
 	}
 }
 
@@ -263,9 +386,6 @@ func (cw *consulWatcher) Next() (*registry.Result, error) {
 		}
 		return r, nil
 	}
-	// NOTE: This is a dead code path: e.g. it will never be reached
-	// as we return in all previous code paths never leading to this return
-	return nil, registry.ErrWatcherStopped
 }
 
 func (cw *consulWatcher) Stop() {
@@ -274,10 +394,9 @@ func (cw *consulWatcher) Stop() {
 		return
 	default:
 		close(cw.exit)
-		if cw.wp == nil {
-			return
+		if cw.cancel != nil {
+			cw.cancel()
 		}
-		cw.wp.Stop()
 
 		// drain results
 		for {
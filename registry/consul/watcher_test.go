@@ -7,7 +7,7 @@ import (
 	"github.com/micro/go-micro/v2/registry"
 )
 
-func TestHealthyServiceHandler(t *testing.T) {
+func TestHealthyServiceUpdate(t *testing.T) {
 	watcher := newWatcher()
 	serviceEntry := newServiceEntry(
 		"node-name", "node-address", "service-name", "v1.0.0",
@@ -16,14 +16,14 @@ func TestHealthyServiceHandler(t *testing.T) {
 		},
 	)
 
-	watcher.serviceHandler(1234, []*api.ServiceEntry{serviceEntry})
+	watcher.update("service-name", []*api.ServiceEntry{serviceEntry})
 
 	if len(watcher.services["service-name"][0].Nodes) != 1 {
 		t.Errorf("Expected length of the service nodes to be 1")
 	}
 }
 
-func TestUnhealthyServiceHandler(t *testing.T) {
+func TestUnhealthyServiceUpdate(t *testing.T) {
 	watcher := newWatcher()
 	serviceEntry := newServiceEntry(
 		"node-name", "node-address", "service-name", "v1.0.0",
@@ -32,14 +32,14 @@ func TestUnhealthyServiceHandler(t *testing.T) {
 		},
 	)
 
-	watcher.serviceHandler(1234, []*api.ServiceEntry{serviceEntry})
+	watcher.update("service-name", []*api.ServiceEntry{serviceEntry})
 
 	if len(watcher.services["service-name"][0].Nodes) != 0 {
 		t.Errorf("Expected length of the service nodes to be 0")
 	}
 }
 
-func TestUnhealthyNodeServiceHandler(t *testing.T) {
+func TestUnhealthyNodeServiceUpdate(t *testing.T) {
 	watcher := newWatcher()
 	serviceEntry := newServiceEntry(
 		"node-name", "node-address", "service-name", "v1.0.0",
@@ -49,7 +49,7 @@ func TestUnhealthyNodeServiceHandler(t *testing.T) {
 		},
 	)
 
-	watcher.serviceHandler(1234, []*api.ServiceEntry{serviceEntry})
+	watcher.update("service-name", []*api.ServiceEntry{serviceEntry})
 
 	if len(watcher.services["service-name"][0].Nodes) != 0 {
 		t.Errorf("Expected length of the service nodes to be 0")
@@ -58,6 +58,7 @@ func TestUnhealthyNodeServiceHandler(t *testing.T) {
 
 func newWatcher() *consulWatcher {
 	return &consulWatcher{
+		r:        &consulRegistry{},
 		exit:     make(chan bool),
 		next:     make(chan *registry.Result, 10),
 		services: make(map[string][]*registry.Service),
@@ -84,3 +85,65 @@ func newServiceEntry(node, address, name, version string, checks []*api.HealthCh
 		Checks: checks,
 	}
 }
+
+func TestNextIndex(t *testing.T) {
+	testData := []struct {
+		prev, last, expect uint64
+	}{
+		{0, 10, 10},
+		{10, 12, 12},
+		{12, 5, 0},
+		{0, 0, 1},
+	}
+
+	for _, d := range testData {
+		if i := nextIndex(d.prev, d.last); i != d.expect {
+			t.Fatalf("expected index %d after %d and %d, got %d", d.expect, d.prev, d.last, i)
+		}
+	}
+}
+
+func TestServiceUpdates(t *testing.T) {
+	watcher := newWatcher()
+	healthy := []*api.HealthCheck{newHealthCheck("node-name", "service-name", "passing")}
+
+	one := newServiceEntry("node-name", "10.0.0.1", "service-name", "v1.0.0", healthy)
+	one.Service.ID = "one"
+	two := newServiceEntry("node-name", "10.0.0.2", "service-name", "v1.0.0", healthy)
+	two.Service.ID = "two"
+
+	expect := func(actions ...string) {
+		t.Helper()
+		for _, action := range actions {
+			select {
+			case r := <-watcher.next:
+				if r.Action != action {
+					t.Fatalf("expected %s, got %s", action, r.Action)
+				}
+			default:
+				t.Fatalf("expected %s result", action)
+			}
+		}
+		select {
+		case r := <-watcher.next:
+			t.Fatalf("unexpected %s result", r.Action)
+		default:
+		}
+	}
+
+	watcher.update("service-name", []*api.ServiceEntry{one, two})
+	expect("create")
+
+	// the index changed without the nodes changing
+	watcher.update("service-name", []*api.ServiceEntry{two, one})
+	expect()
+
+	watcher.update("service-name", []*api.ServiceEntry{one})
+	expect("delete", "update")
+
+	watcher.update("service-name", nil)
+	expect("delete")
+	if len(watcher.services["service-name"]) != 0 {
+		t.Fatal("expected the service to be removed from the cache")
+	}
+}
@@ -0,0 +1,38 @@
+package consul
+
+import (
+	consul "github.com/hashicorp/consul/api"
+	"github.com/micro/go-plugins/registry/consul/v2/internal/weight"
+)
+
+// agentWeights returns the consul weights of a node, nodes without a weight are
+// registered with the default weight so consul weights compare with other nodes
+func agentWeights(md map[string]string) *consul.AgentWeights {
+	w := weight.Get(md)
+	// consul can't weigh a node 0, the weight is kept in the tags
+	if w < 1 {
+		return nil
+	}
+	// consul keeps the default weight of nodes with warnings
+	return &consul.AgentWeights{Passing: w, Warning: 1}
+}
+
+// setWeight sets the weight of the node from the consul weights, the weight of
+// passing nodes or of nodes with warnings depending on the checks
+func setWeight(e *consul.ServiceEntry, md map[string]string) map[string]string {
+	w := e.Service.Weights
+	// consul before 1.2.3 has no weights and nodes registered without weights
+	// have those of consul, which don't compare with the default weight
+	if w.Passing < 1 || (w.Passing == 1 && w.Warning == 1) {
+		return weight.Set(md, weight.Get(md))
+	}
+
+	n := w.Passing
+	for _, check := range e.Checks {
+		if check.Status == consul.HealthWarning {
+			n = w.Warning
+			break
+		}
+	}
+	return weight.Set(md, n)
+}
@@ -0,0 +1,302 @@
+// Package dns provides a read only registry resolving services from DNS records
+package dns
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/config/cmd"
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+/*
+	Services are resolved from the SRV records of their name, the port and target of
+	every record resolved to the addresses of the nodes. Services without SRV records,
+	e.g. Kubernetes headless services without named ports, fall back to the A and AAAA
+	records of the name with a fixed port.
+
+	Nodes are managed by whatever serves the records, so Register and Deregister don't
+	do anything. Lookups are cached for the TTL and watchers poll at the same interval.
+*/
+
+var (
+	// DefaultTTL is how long lookups are cached without the TTL option
+	DefaultTTL = time.Second * 30
+
+	// DefaultPort is the port of nodes resolved from A and AAAA records
+	DefaultPort = 8080
+
+	// DefaultTimeout is the timeout of lookups without registry.Timeout
+	DefaultTimeout = time.Second * 5
+)
+
+// resolver is the part of net.Resolver used by the registry
+type resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+type cached struct {
+	services []*registry.Service
+	expires  time.Time
+}
+
+type dnsRegistry struct {
+	opts registry.Options
+
+	sync.RWMutex
+	resolver resolver
+	cache    map[string]*cached
+}
+
+func init() {
+	cmd.DefaultRegistries["dns"] = NewRegistry
+}
+
+func configure(d *dnsRegistry, opts ...registry.Option) error {
+	for _, o := range opts {
+		o(&d.opts)
+	}
+
+	var r resolver = net.DefaultResolver
+	if res, ok := d.opts.Context.Value(resolverKey{}).(*net.Resolver); ok {
+		r = res
+	} else if addrs := nameservers(d.opts.Addrs); len(addrs) > 0 {
+		r = newResolver(addrs)
+	}
+
+	d.Lock()
+	d.resolver = r
+	d.cache = make(map[string]*cached)
+	d.Unlock()
+	return nil
+}
+
+// nameservers returns the addresses with the default DNS port where missing
+func nameservers(addrs []string) []string {
+	var servers []string
+	for _, addr := range addrs {
+		if len(addr) == 0 {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "53")
+		}
+		servers = append(servers, addr)
+	}
+	return servers
+}
+
+// newResolver returns a resolver querying the nameservers in turn
+func newResolver(servers []string) *net.Resolver {
+	var (
+		mtx  sync.Mutex
+		next int
+	)
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			mtx.Lock()
+			server := servers[next%len(servers)]
+			next++
+			mtx.Unlock()
+
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+func (d *dnsRegistry) getResolver() resolver {
+	d.RLock()
+	defer d.RUnlock()
+	return d.resolver
+}
+
+func (d *dnsRegistry) ttl() time.Duration {
+	if t, ok := d.opts.Context.Value(ttlKey{}).(time.Duration); ok && t > 0 {
+		return t
+	}
+	return DefaultTTL
+}
+
+func (d *dnsRegistry) port() int {
+	if p, ok := d.opts.Context.Value(portKey{}).(int); ok && p > 0 {
+		return p
+	}
+	return DefaultPort
+}
+
+// host returns the name looked up for the service
+func (d *dnsRegistry) host(name string) string {
+	if domain, ok := d.opts.Context.Value(domainKey{}).(string); ok && len(domain) > 0 {
+		return name + "." + strings.Trim(domain, ".")
+	}
+	return name
+}
+
+func isNotFound(err error) bool {
+	de, ok := err.(*net.DNSError)
+	return ok && de.IsNotFound
+}
+
+// lookup resolves the service, bypassing the cache
+func (d *dnsRegistry) lookup(name string) ([]*registry.Service, error) {
+	timeout := d.opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	r := d.getResolver()
+	host := d.host(name)
+	s, _ := d.opts.Context.Value(srvKey{}).(srv)
+
+	var nodes []*registry.Node
+
+	_, records, err := r.LookupSRV(ctx, s.service, s.proto, host)
+	switch {
+	case err != nil && !isNotFound(err):
+		return nil, err
+	case len(records) > 0:
+		for _, record := range records {
+			target := strings.TrimSuffix(record.Target, ".")
+			addrs, err := r.LookupHost(ctx, target)
+			if err != nil {
+				log.Debugf("[dns] failed to resolve %s of %s: %v", target, name, err)
+				continue
+			}
+			port := strconv.Itoa(int(record.Port))
+			for _, addr := range addrs {
+				address := net.JoinHostPort(addr, port)
+				nodes = append(nodes, &registry.Node{
+					Id:      address,
+					Address: address,
+					Metadata: map[string]string{
+						"target":   target,
+						"priority": strconv.Itoa(int(record.Priority)),
+						"weight":   strconv.Itoa(int(record.Weight)),
+					},
+				})
+			}
+		}
+	default:
+		addrs, err := r.LookupHost(ctx, host)
+		if isNotFound(err) {
+			return nil, registry.ErrNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		port := strconv.Itoa(d.port())
+		for _, addr := range addrs {
+			address := net.JoinHostPort(addr, port)
+			nodes = append(nodes, &registry.Node{
+				Id:       address,
+				Address:  address,
+				Metadata: map[string]string{},
+			})
+		}
+	}
+
+	if len(nodes) == 0 {
+		return nil, registry.ErrNotFound
+	}
+
+	// records are returned in random order
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Id < nodes[j].Id })
+
+	return []*registry.Service{{Name: name, Nodes: nodes}}, nil
+}
+
+// resolve looks up the service and caches the result
+func (d *dnsRegistry) resolve(name string) ([]*registry.Service, error) {
+	services, err := d.lookup(name)
+	if err != nil {
+		d.Lock()
+		delete(d.cache, name)
+		d.Unlock()
+		return nil, err
+	}
+
+	d.Lock()
+	d.cache[name] = &cached{services: services, expires: time.Now().Add(d.ttl())}
+	d.Unlock()
+	return services, nil
+}
+
+func (d *dnsRegistry) Init(opts ...registry.Option) error {
+	return configure(d, opts...)
+}
+
+func (d *dnsRegistry) Options() registry.Options {
+	return d.opts
+}
+
+func (d *dnsRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	return nil
+}
+
+func (d *dnsRegistry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
+	return nil
+}
+
+func (d *dnsRegistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	d.RLock()
+	c, ok := d.cache[name]
+	d.RUnlock()
+	if ok && time.Now().Before(c.expires) {
+		return c.services, nil
+	}
+	return d.resolve(name)
+}
+
+func (d *dnsRegistry) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
+	seen := make(map[string]bool)
+	var services []*registry.Service
+
+	names, _ := d.opts.Context.Value(servicesKey{}).([]string)
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			services = append(services, &registry.Service{Name: name})
+		}
+	}
+
+	// services resolved before are listed as well
+	d.RLock()
+	for name := range d.cache {
+		if !seen[name] {
+			seen[name] = true
+			services = append(services, &registry.Service{Name: name})
+		}
+	}
+	d.RUnlock()
+
+	return services, nil
+}
+
+func (d *dnsRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	return newWatcher(d, opts...), nil
+}
+
+func (d *dnsRegistry) String() string {
+	return "dns"
+}
+
+func NewRegistry(opts ...registry.Option) registry.Registry {
+	d := &dnsRegistry{
+		opts: registry.Options{
+			Context: context.Background(),
+		},
+	}
+	configure(d, opts...)
+	return d
+}
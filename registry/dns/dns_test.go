@@ -0,0 +1,162 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+type mockResolver struct {
+	sync.Mutex
+	srv     map[string][]*net.SRV
+	hosts   map[string][]string
+	lookups int
+}
+
+func (m *mockResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	m.Lock()
+	defer m.Unlock()
+	if len(service) > 0 {
+		name = "_" + service + "._" + proto + "." + name
+	}
+	records, ok := m.srv[name]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return name, records, nil
+}
+
+func (m *mockResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	m.Lock()
+	defer m.Unlock()
+	m.lookups++
+	addrs, ok := m.hosts[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+func newTestRegistry(r *mockResolver, opts ...registry.Option) *dnsRegistry {
+	d := NewRegistry(opts...).(*dnsRegistry)
+	d.resolver = r
+	return d
+}
+
+func TestSRV(t *testing.T) {
+	r := &mockResolver{
+		srv: map[string][]*net.SRV{
+			"_grpc._tcp.foo.default.svc.cluster.local": {
+				{Target: "foo-0.foo.default.svc.cluster.local.", Port: 9090, Priority: 10, Weight: 50},
+				{Target: "foo-1.foo.default.svc.cluster.local.", Port: 9090, Priority: 10, Weight: 50},
+			},
+		},
+		hosts: map[string][]string{
+			"foo-0.foo.default.svc.cluster.local": {"10.0.0.1"},
+			"foo-1.foo.default.svc.cluster.local": {"10.0.0.2"},
+		},
+	}
+	d := newTestRegistry(r, Domain("default.svc.cluster.local."), SRV("grpc", "tcp"))
+
+	services, err := d.GetService("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || len(services[0].Nodes) != 2 {
+		t.Fatalf("unexpected services %+v", services)
+	}
+	node := services[0].Nodes[0]
+	if node.Address != "10.0.0.1:9090" || node.Metadata["target"] != "foo-0.foo.default.svc.cluster.local" || node.Metadata["weight"] != "50" {
+		t.Fatalf("unexpected node %+v", node)
+	}
+
+	if _, err := d.GetService("bar"); err != registry.ErrNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestHostFallback(t *testing.T) {
+	r := &mockResolver{
+		hosts: map[string][]string{"foo.service.consul": {"10.0.0.2", "10.0.0.1"}},
+	}
+	d := newTestRegistry(r, Domain("service.consul"), Port(9000))
+
+	services, err := d.GetService("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := services[0].Nodes
+	if len(nodes) != 2 || nodes[0].Address != "10.0.0.1:9000" || nodes[1].Address != "10.0.0.2:9000" {
+		t.Fatalf("unexpected nodes %+v", nodes)
+	}
+}
+
+func TestCache(t *testing.T) {
+	r := &mockResolver{hosts: map[string][]string{"foo": {"10.0.0.1"}}}
+	d := newTestRegistry(r, TTL(time.Hour), Services("bar"))
+
+	for i := 0; i < 3; i++ {
+		if _, err := d.GetService("foo"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r.lookups != 1 {
+		t.Fatalf("expected lookups to be cached, got %d lookups", r.lookups)
+	}
+
+	services, err := d.ListServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 2 || services[0].Name != "bar" || services[1].Name != "foo" {
+		t.Fatalf("expected the static and resolved services, got %+v", services)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	r := &mockResolver{hosts: map[string][]string{"foo": {"10.0.0.1"}}}
+	d := newTestRegistry(r, TTL(time.Millisecond*10))
+
+	w, err := d.Watch(registry.WatchService("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// change the records once the first poll resolved them
+	for {
+		r.Lock()
+		n := r.lookups
+		r.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	r.Lock()
+	r.hosts["foo"] = []string{"10.0.0.2"}
+	r.Unlock()
+
+	actions := make(map[string]string)
+	for i := 0; i < 2; i++ {
+		res, err := w.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		actions[res.Service.Nodes[0].Id] = res.Action
+	}
+	if actions["10.0.0.2:8080"] != "create" || actions["10.0.0.1:8080"] != "delete" {
+		t.Fatalf("unexpected results %v", actions)
+	}
+}
+
+func TestNameservers(t *testing.T) {
+	servers := nameservers([]string{"10.0.0.10", "", "10.0.0.11:5353"})
+	if len(servers) != 2 || servers[0] != "10.0.0.10:53" || servers[1] != "10.0.0.11:5353" {
+		t.Fatalf("unexpected nameservers %v", servers)
+	}
+}
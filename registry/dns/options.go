@@ -0,0 +1,65 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+type resolverKey struct{}
+type domainKey struct{}
+type srvKey struct{}
+type portKey struct{}
+type ttlKey struct{}
+type servicesKey struct{}
+
+type srv struct {
+	service string
+	proto   string
+}
+
+func setOption(k, v interface{}) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// Resolver sets the resolver used for lookups, by default the nameservers set
+// with registry.Addrs or the resolver of the system
+func Resolver(r *net.Resolver) registry.Option {
+	return setOption(resolverKey{}, r)
+}
+
+// Domain sets the domain appended to service names, e.g. default.svc.cluster.local
+// or service.consul
+func Domain(d string) registry.Option {
+	return setOption(domainKey{}, d)
+}
+
+// SRV sets the service and protocol of SRV lookups, _service._proto.name. By default
+// the SRV records of the name itself are looked up
+func SRV(service, proto string) registry.Option {
+	return setOption(srvKey{}, srv{service: service, proto: proto})
+}
+
+// Port sets the port of nodes resolved from A and AAAA records when a service
+// has no SRV records, DefaultPort by default
+func Port(p int) registry.Option {
+	return setOption(portKey{}, p)
+}
+
+// TTL sets how long lookups are cached and how often watchers poll, DefaultTTL by default
+func TTL(t time.Duration) registry.Option {
+	return setOption(ttlKey{}, t)
+}
+
+// Services sets the names of the services returned by ListServices, since DNS
+// can't list them
+func Services(names ...string) registry.Option {
+	return setOption(servicesKey{}, names)
+}
@@ -0,0 +1,144 @@
+package dns
+
+import (
+	"reflect"
+	"time"
+
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+type dnsWatcher struct {
+	d       *dnsRegistry
+	service string
+	next    chan *registry.Result
+	exit    chan bool
+
+	// nodes of every service by node id, each a service with the node
+	nodes map[string]map[string]*registry.Service
+}
+
+func newWatcher(d *dnsRegistry, opts ...registry.WatchOption) registry.Watcher {
+	var wo registry.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	w := &dnsWatcher{
+		d:       d,
+		service: wo.Service,
+		next:    make(chan *registry.Result),
+		exit:    make(chan bool),
+		nodes:   make(map[string]map[string]*registry.Service),
+	}
+
+	go w.poll(d.ttl())
+	return w
+}
+
+func (w *dnsWatcher) poll(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	// the first poll only records the nodes
+	notify := false
+
+	for {
+		names := []string{w.service}
+		if len(w.service) == 0 {
+			services, _ := w.d.ListServices()
+			names = names[:0]
+			for _, s := range services {
+				names = append(names, s.Name)
+			}
+		}
+
+		for _, name := range names {
+			services, err := w.d.resolve(name)
+			if err != nil && err != registry.ErrNotFound {
+				// keep the nodes rather than deleting them on a failed lookup
+				log.Errorf("[dns] failed to resolve %s: %v", name, err)
+				continue
+			}
+			if !w.update(name, services, notify) {
+				return
+			}
+		}
+		notify = true
+
+		select {
+		case <-w.exit:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// update sends the nodes of the service which were created, updated or deleted
+// since the last poll, it returns false once the watcher is stopped
+func (w *dnsWatcher) update(name string, services []*registry.Service, notify bool) bool {
+	nodes := make(map[string]*registry.Service)
+	for _, service := range services {
+		for _, node := range service.Nodes {
+			nodes[node.Id] = &registry.Service{
+				Name:    service.Name,
+				Version: service.Version,
+				Nodes:   []*registry.Node{node},
+			}
+		}
+	}
+
+	old := w.nodes[name]
+	w.nodes[name] = nodes
+	if !notify {
+		return true
+	}
+
+	for id, service := range nodes {
+		prev, ok := old[id]
+		switch {
+		case !ok:
+			if !w.send("create", service) {
+				return false
+			}
+		case !reflect.DeepEqual(prev, service):
+			if !w.send("update", service) {
+				return false
+			}
+		}
+	}
+	for id, service := range old {
+		if _, ok := nodes[id]; !ok {
+			if !w.send("delete", service) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (w *dnsWatcher) send(action string, service *registry.Service) bool {
+	select {
+	case w.next <- &registry.Result{Action: action, Service: service}:
+		return true
+	case <-w.exit:
+		return false
+	}
+}
+
+func (w *dnsWatcher) Next() (*registry.Result, error) {
+	select {
+	case r := <-w.next:
+		return r, nil
+	case <-w.exit:
+		return nil, registry.ErrWatcherStopped
+	}
+}
+
+func (w *dnsWatcher) Stop() {
+	select {
+	case <-w.exit:
+	default:
+		close(w.exit)
+	}
+}
@@ -2,15 +2,640 @@
 package etcd
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
 	"github.com/micro/go-micro/v2/config/cmd"
+	log "github.com/micro/go-micro/v2/logger"
 	"github.com/micro/go-micro/v2/registry"
-	"github.com/micro/go-micro/v2/registry/etcd"
+	"github.com/micro/go-plugins/registry/etcd/v2/internal/weight"
+)
+
+var (
+	prefix = "/micro/registry/"
+
+	// maxTxnOps is the default limit of operations in an etcd transaction
+	maxTxnOps = 128
 )
 
+// the Registry interface of the bulk package, implemented without importing it
+var _ interface {
+	RegisterAll(services []*registry.Service, opts ...registry.RegisterOption) error
+	DeregisterAll(services []*registry.Service, opts ...registry.DeregisterOption) error
+} = (*etcdRegistry)(nil)
+
+// etcdRegistry is the go-micro etcd registry with bulk registration and tunable
+// leases. Nodes are written in the same layout, so the go-micro registry reads and
+// watches them. A single client serves every call, so the TLS and dial timeout
+// options apply to lookups as well
+type etcdRegistry struct {
+	opts registry.Options
+
+	sync.Mutex
+	client *clientv3.Client
+	// nodes registered by Register keyed by path
+	nodes map[string]*node
+}
+
+// node is a registered node, kept alive until deregistered
+type node struct {
+	value string
+	ttl   time.Duration
+	lease clientv3.LeaseID
+	exit  chan bool
+}
+
 func init() {
-	cmd.DefaultRegistries["etcd"] = etcd.NewRegistry
+	cmd.DefaultRegistries["etcd"] = NewRegistry
+}
+
+func nodePath(s, id string) string {
+	service := strings.Replace(s, "/", "-", -1)
+	node := strings.Replace(id, "/", "-", -1)
+	return path.Join(prefix, service, node)
+}
+
+func servicePath(s string) string {
+	return path.Join(prefix, strings.Replace(s, "/", "-", -1))
+}
+
+// configure applies the options, failing with the error of TLS files which can't be loaded
+func configure(o *registry.Options, opts ...registry.Option) error {
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err, ok := o.Context.Value(tlsErrKey{}).(error); ok {
+		return err
+	}
+	return nil
+}
+
+// validate checks the options for mistakes which would otherwise only surface on
+// the first call to etcd, such as addresses which are silently ignored
+func validate(o registry.Options) error {
+	for _, address := range o.Addrs {
+		if len(address) == 0 {
+			continue
+		}
+		_, _, err := net.SplitHostPort(address)
+		if ae, ok := err.(*net.AddrError); ok && ae.Err == "missing port in address" {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("invalid address %q: %v", address, err)
+		}
+	}
+
+	if o.Timeout < 0 {
+		return fmt.Errorf("invalid timeout %v", o.Timeout)
+	}
+	if d, ok := o.Context.Value(dialTimeoutKey{}).(time.Duration); ok && d < 0 {
+		return fmt.Errorf("invalid dial timeout %v", d)
+	}
+
+	if creds, ok := o.Context.Value(authKey{}).(*authCreds); ok && len(creds.Username) == 0 {
+		return errors.New("auth requires a username")
+	}
+
+	ttl, _ := o.Context.Value(leaseTTLKey{}).(time.Duration)
+	if ttl < 0 {
+		return fmt.Errorf("invalid lease ttl %v", ttl)
+	}
+	if d, ok := o.Context.Value(keepAliveKey{}).(time.Duration); ok && (d < 0 || (ttl > 0 && d >= ttl)) {
+		return fmt.Errorf("invalid keep alive interval %v, it must be shorter than the lease ttl", d)
+	}
+
+	if w, ok := o.Context.Value(weightKey{}).(int); ok && w < 0 {
+		return fmt.Errorf("invalid weight %d", w)
+	}
+
+	return nil
+}
+
+// Validate checks the options, Init returns the error and NewRegistry logs it
+func (e *etcdRegistry) Validate() error {
+	return validate(e.opts)
+}
+
+func (e *etcdRegistry) Init(opts ...registry.Option) error {
+	options := e.opts
+	if err := configure(&options, opts...); err != nil {
+		return err
+	}
+	if err := validate(options); err != nil {
+		return err
+	}
+
+	e.Lock()
+	e.opts = options
+	if e.client != nil {
+		e.client.Close()
+		e.client = nil
+	}
+	for key, n := range e.nodes {
+		close(n.exit)
+		delete(e.nodes, key)
+	}
+	e.Unlock()
+
+	return nil
+}
+
+func (e *etcdRegistry) Options() registry.Options {
+	return e.opts
+}
+
+// getClient returns the client used for registration, created on first use
+func (e *etcdRegistry) getClient() (*clientv3.Client, error) {
+	e.Lock()
+	defer e.Unlock()
+
+	if e.client != nil {
+		return e.client, nil
+	}
+
+	config := clientv3.Config{
+		DialTimeout: e.opts.Timeout,
+	}
+	if d, ok := e.opts.Context.Value(dialTimeoutKey{}).(time.Duration); ok && d > 0 {
+		config.DialTimeout = d
+	}
+	if config.DialTimeout == 0 {
+		config.DialTimeout = 5 * time.Second
+	}
+	if e.opts.Secure || e.opts.TLSConfig != nil {
+		tlsConfig := e.opts.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{
+				InsecureSkipVerify: true,
+			}
+		}
+		config.TLS = tlsConfig
+	}
+	if creds, ok := e.opts.Context.Value(authKey{}).(*authCreds); ok {
+		config.Username = creds.Username
+		config.Password = creds.Password
+	}
+
+	for _, address := range e.opts.Addrs {
+		if len(address) == 0 {
+			continue
+		}
+		addr, port, err := net.SplitHostPort(address)
+		if ae, ok := err.(*net.AddrError); ok && ae.Err == "missing port in address" {
+			port = "2379"
+			addr = address
+		} else if err != nil {
+			continue
+		}
+		config.Endpoints = append(config.Endpoints, net.JoinHostPort(addr, port))
+	}
+	if len(config.Endpoints) == 0 {
+		config.Endpoints = []string{"127.0.0.1:2379"}
+	}
+
+	c, err := clientv3.New(config)
+	if err != nil {
+		return nil, err
+	}
+	e.client = c
+	return c, nil
+}
+
+// encodeNode returns the value of the node, a copy of the service holding only the node
+func encodeNode(s *registry.Service, node *registry.Node) (string, error) {
+	b, err := json.Marshal(&registry.Service{
+		Name:      s.Name,
+		Version:   s.Version,
+		Metadata:  s.Metadata,
+		Endpoints: s.Endpoints,
+		Nodes:     []*registry.Node{node},
+	})
+	return string(b), err
+}
+
+// weigh returns the node with the weight of the Weight option, the node itself
+// if there's none or the node has a weight of its own
+func (e *etcdRegistry) weigh(n *registry.Node) *registry.Node {
+	w, ok := e.opts.Context.Value(weightKey{}).(int)
+	if !ok || w < 0 {
+		return n
+	}
+	if _, ok := n.Metadata[weight.Key]; ok {
+		return n
+	}
+
+	md := make(map[string]string, len(n.Metadata)+1)
+	for k, v := range n.Metadata {
+		md[k] = v
+	}
+	return &registry.Node{Id: n.Id, Address: n.Address, Metadata: weight.Set(md, w)}
+}
+
+// leaseTTL returns the TTL of the lease of registered nodes
+func (e *etcdRegistry) leaseTTL(options registry.RegisterOptions) time.Duration {
+	if d, ok := e.opts.Context.Value(leaseTTLKey{}).(time.Duration); ok && d > 0 {
+		return d
+	}
+	return options.TTL
+}
+
+// Register writes the nodes of the service with a lease of the TTL. Nodes already
+// registered with the same value only have their lease kept alive
+func (e *etcdRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("Require at least one node")
+	}
+
+	var options registry.RegisterOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	c, err := e.getClient()
+	if err != nil {
+		return err
+	}
+
+	for _, n := range s.Nodes {
+		if err := e.registerNode(c, s, e.weigh(n), e.leaseTTL(options)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *etcdRegistry) registerNode(c *clientv3.Client, s *registry.Service, n *registry.Node, ttl time.Duration) error {
+	key := nodePath(s.Name, n.Id)
+	value, err := encodeNode(s, n)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout())
+	defer cancel()
+
+	e.Lock()
+	old, ok := e.nodes[key]
+	var oldLease clientv3.LeaseID
+	if ok {
+		oldLease = old.lease
+	}
+	e.Unlock()
+
+	// unchanged, keep the lease alive rather than writing the node again
+	if ok && old.value == value && oldLease != clientv3.NoLease {
+		if _, err := c.KeepAliveOnce(ctx, oldLease); err == nil {
+			return nil
+		}
+	}
+
+	var putOpts []clientv3.OpOption
+	lease := clientv3.NoLease
+	if ttl.Seconds() > 0 {
+		lgr, err := c.Grant(ctx, int64(ttl.Seconds()))
+		if err != nil {
+			return err
+		}
+		lease = lgr.ID
+		putOpts = append(putOpts, clientv3.WithLease(lease))
+	}
+
+	if _, err := c.Put(ctx, key, value, putOpts...); err != nil {
+		return err
+	}
+
+	e.track(c, key, &node{value: value, ttl: ttl, lease: lease, exit: make(chan bool)})
+
+	// the node changed, the old lease would keep nothing alive but the key is
+	// attached to the new lease now so it isn't deleted with the old one. Leases
+	// shared by nodes registered with RegisterAll are kept for the other nodes
+	if ok && oldLease != clientv3.NoLease && oldLease != lease && !e.leased(oldLease) {
+		if _, err := c.Revoke(ctx, oldLease); err != nil {
+			log.Debugf("[etcd] failed to revoke the lease of %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// track records the registered node, replacing the node of the key, and keeps its
+// lease alive with the KeepAliveInterval
+func (e *etcdRegistry) track(c *clientv3.Client, key string, n *node) {
+	e.Lock()
+	if old, ok := e.nodes[key]; ok {
+		close(old.exit)
+	}
+	e.nodes[key] = n
+	e.Unlock()
+
+	if interval, ok := e.opts.Context.Value(keepAliveKey{}).(time.Duration); ok && interval > 0 && n.lease != clientv3.NoLease {
+		go e.keepAlive(c, key, n, interval)
+	}
+}
+
+// leased returns whether a registered node holds the lease
+func (e *etcdRegistry) leased(lease clientv3.LeaseID) bool {
+	e.Lock()
+	defer e.Unlock()
+
+	for _, n := range e.nodes {
+		if n.lease == lease {
+			return true
+		}
+	}
+	return false
+}
+
+// keepAlive keeps the lease of the node alive every interval until deregistered.
+// The node is written again with a new lease if the lease expired
+func (e *etcdRegistry) keepAlive(c *clientv3.Client, key string, n *node, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-n.exit:
+			return
+		case <-t.C:
+		}
+
+		e.Lock()
+		lease := n.lease
+		e.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), e.timeout())
+		_, err := c.KeepAliveOnce(ctx, lease)
+		if err == rpctypes.ErrLeaseNotFound {
+			var lgr *clientv3.LeaseGrantResponse
+			if lgr, err = c.Grant(ctx, int64(n.ttl.Seconds())); err == nil {
+				_, err = c.Put(ctx, key, n.value, clientv3.WithLease(lgr.ID))
+			}
+			if err == nil {
+				e.Lock()
+				n.lease = lgr.ID
+				e.Unlock()
+			}
+		}
+		cancel()
+
+		if err != nil {
+			log.Errorf("[etcd] failed to keep %s alive: %v", key, err)
+		}
+	}
+}
+
+// Deregister deletes the nodes of the service and stops keeping them alive
+func (e *etcdRegistry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("Require at least one node")
+	}
+
+	c, err := e.getClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout())
+	defer cancel()
+
+	for _, n := range s.Nodes {
+		key := nodePath(s.Name, n.Id)
+
+		e.Lock()
+		if reg, ok := e.nodes[key]; ok {
+			close(reg.exit)
+			delete(e.nodes, key)
+		}
+		e.Unlock()
+
+		if _, err := c.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit applies the operations in transactions of at most maxTxnOps
+func commit(ctx context.Context, c *clientv3.Client, ops []clientv3.Op) error {
+	for len(ops) > 0 {
+		n := len(ops)
+		if n > maxTxnOps {
+			n = maxTxnOps
+		}
+		if _, err := c.Txn(ctx).Then(ops[:n]...).Commit(); err != nil {
+			return err
+		}
+		ops = ops[n:]
+	}
+	return nil
+}
+
+// RegisterAll writes all nodes of the services in a single transaction, sharing one
+// lease when a TTL is set. Transactions are split beyond 128 nodes. The nodes are kept
+// alive with the KeepAliveInterval and deregistered by Deregister like those registered
+// by Register
+func (e *etcdRegistry) RegisterAll(services []*registry.Service, opts ...registry.RegisterOption) error {
+	var options registry.RegisterOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	c, err := e.getClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout())
+	defer cancel()
+
+	ttl := e.leaseTTL(options)
+	lease := clientv3.NoLease
+	var putOpts []clientv3.OpOption
+	if ttl.Seconds() > 0 {
+		lgr, err := c.Grant(ctx, int64(ttl.Seconds()))
+		if err != nil {
+			return err
+		}
+		lease = lgr.ID
+		putOpts = append(putOpts, clientv3.WithLease(lease))
+	}
+
+	var ops []clientv3.Op
+	nodes := make(map[string]*node)
+	for _, s := range services {
+		for _, n := range s.Nodes {
+			value, err := encodeNode(s, e.weigh(n))
+			if err != nil {
+				return err
+			}
+			key := nodePath(s.Name, n.Id)
+			ops = append(ops, clientv3.OpPut(key, value, putOpts...))
+			nodes[key] = &node{value: value, ttl: ttl, lease: lease, exit: make(chan bool)}
+		}
+	}
+
+	if err := commit(ctx, c, ops); err != nil {
+		return err
+	}
+
+	for key, n := range nodes {
+		e.track(c, key, n)
+	}
+	return nil
+}
+
+// DeregisterAll deletes all nodes of the services in a single transaction and stops
+// keeping them alive
+func (e *etcdRegistry) DeregisterAll(services []*registry.Service, opts ...registry.DeregisterOption) error {
+	c, err := e.getClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout())
+	defer cancel()
+
+	var ops []clientv3.Op
+	for _, s := range services {
+		for _, n := range s.Nodes {
+			key := nodePath(s.Name, n.Id)
+
+			e.Lock()
+			if reg, ok := e.nodes[key]; ok {
+				close(reg.exit)
+				delete(e.nodes, key)
+			}
+			e.Unlock()
+
+			ops = append(ops, clientv3.OpDelete(key))
+		}
+	}
+
+	return commit(ctx, c, ops)
+}
+
+// GetService returns the versions of the service with their nodes
+func (e *etcdRegistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	c, err := e.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout())
+	defer cancel()
+
+	rsp, err := c.Get(ctx, servicePath(name)+"/", clientv3.WithPrefix(), clientv3.WithSerializable())
+	if err != nil {
+		return nil, err
+	}
+	if len(rsp.Kvs) == 0 {
+		return nil, registry.ErrNotFound
+	}
+
+	versions := make(map[string]*registry.Service)
+	for _, kv := range rsp.Kvs {
+		sn := decode(kv.Value)
+		if sn == nil {
+			continue
+		}
+		s, ok := versions[sn.Version]
+		if !ok {
+			s = &registry.Service{
+				Name:      sn.Name,
+				Version:   sn.Version,
+				Metadata:  sn.Metadata,
+				Endpoints: sn.Endpoints,
+			}
+			versions[s.Version] = s
+		}
+		s.Nodes = append(s.Nodes, sn.Nodes...)
+	}
+
+	services := make([]*registry.Service, 0, len(versions))
+	for _, s := range versions {
+		services = append(services, s)
+	}
+	return services, nil
+}
+
+// ListServices returns every version of every service with their nodes, sorted by name
+func (e *etcdRegistry) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
+	c, err := e.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout())
+	defer cancel()
+
+	rsp, err := c.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithSerializable())
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]*registry.Service)
+	for _, kv := range rsp.Kvs {
+		sn := decode(kv.Value)
+		if sn == nil {
+			continue
+		}
+		if s, ok := versions[sn.Name+sn.Version]; ok {
+			s.Nodes = append(s.Nodes, sn.Nodes...)
+			continue
+		}
+		versions[sn.Name+sn.Version] = sn
+	}
+
+	services := make([]*registry.Service, 0, len(versions))
+	for _, s := range versions {
+		services = append(services, s)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services, nil
+}
+
+// Watch returns a watcher which recovers from compacted revisions by listing the
+// nodes again and sending what changed
+func (e *etcdRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	return newWatcher(e, opts...)
+}
+
+func (e *etcdRegistry) timeout() time.Duration {
+	if e.opts.Timeout > 0 {
+		return e.opts.Timeout
+	}
+	return 5 * time.Second
+}
+
+func (e *etcdRegistry) String() string {
+	return "etcd"
 }
 
 func NewRegistry(opts ...registry.Option) registry.Registry {
-	return etcd.NewRegistry(opts...)
+	options := registry.Options{
+		Context: context.Background(),
+	}
+	if err := configure(&options, opts...); err != nil {
+		log.Fatalf("[etcd] Registry configuring error: %v", err)
+	}
+	// the registry can't be returned with an error, Init returns it
+	if err := validate(options); err != nil {
+		log.Errorf("[etcd] invalid options: %v", err)
+	}
+
+	return &etcdRegistry{
+		opts:  options,
+		nodes: make(map[string]*node),
+	}
 }
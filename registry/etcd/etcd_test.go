@@ -0,0 +1,176 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-plugins/registry/etcd/v2/internal/weight"
+)
+
+func TestLoadTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "etcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(ca, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadTLS("", "", ""); err != nil {
+		t.Fatalf("expected no files to be valid, got %v", err)
+	}
+	if _, err := loadTLS(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), ""); err == nil {
+		t.Fatal("expected missing client certificate to fail")
+	}
+	if _, err := loadTLS("", "", ca); err == nil {
+		t.Fatal("expected invalid ca certificate to fail")
+	}
+
+	r := NewRegistry()
+	if err := r.Init(TLSFiles("", "", ca)); err == nil {
+		t.Fatal("expected the tls error to fail init")
+	}
+	if r.Options().TLSConfig != nil {
+		t.Fatal("expected the options to be left as they were")
+	}
+}
+
+func TestLeaseTTL(t *testing.T) {
+	r := NewRegistry().(*etcdRegistry)
+	if ttl := r.leaseTTL(registry.RegisterOptions{TTL: time.Minute}); ttl != time.Minute {
+		t.Fatalf("expected the register TTL, got %v", ttl)
+	}
+
+	r = NewRegistry(LeaseTTL(10 * time.Second)).(*etcdRegistry)
+	if ttl := r.leaseTTL(registry.RegisterOptions{TTL: time.Minute}); ttl != 10*time.Second {
+		t.Fatalf("expected the lease TTL, got %v", ttl)
+	}
+}
+
+func TestEncodeNode(t *testing.T) {
+	s := &registry.Service{
+		Name:    "foo",
+		Version: "1.0.0",
+		Nodes: []*registry.Node{
+			{Id: "foo-1", Address: "10.0.0.1:8080"},
+			{Id: "foo-2", Address: "10.0.0.2:8080"},
+		},
+	}
+
+	value, err := encodeNode(s, s.Nodes[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got registry.Service
+	if err := json.Unmarshal([]byte(value), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "foo" || len(got.Nodes) != 1 || got.Nodes[0].Id != "foo-2" {
+		t.Fatalf("unexpected node value %s", value)
+	}
+}
+
+func TestWeigh(t *testing.T) {
+	r := NewRegistry(Weight(5)).(*etcdRegistry)
+
+	n := r.weigh(&registry.Node{Id: "foo-1", Metadata: map[string]string{"zone": "a"}})
+	if n.Metadata[weight.Key] != "5" || n.Metadata["zone"] != "a" {
+		t.Fatalf("expected the weight of the option, got %v", n.Metadata)
+	}
+
+	n = r.weigh(&registry.Node{Id: "foo-2", Metadata: map[string]string{weight.Key: "50"}})
+	if n.Metadata[weight.Key] != "50" {
+		t.Fatalf("expected the weight of the node, got %v", n.Metadata)
+	}
+
+	if n := NewRegistry().(*etcdRegistry).weigh(&registry.Node{Id: "foo-3"}); n.Metadata != nil {
+		t.Fatalf("expected no weight, got %v", n.Metadata)
+	}
+}
+
+// TestRegisterChanged needs an etcd server, set ETCD_ADDRESS to run it
+func TestRegisterChanged(t *testing.T) {
+	addr := os.Getenv("ETCD_ADDRESS")
+	if len(addr) == 0 {
+		t.Skip("ETCD_ADDRESS is undefined")
+	}
+
+	r := NewRegistry(registry.Addrs(addr)).(*etcdRegistry)
+	service := &registry.Service{
+		Name:    "test.changed",
+		Version: "1",
+		Nodes:   []*registry.Node{{Id: "foo-1", Address: "127.0.0.1:8080"}},
+	}
+	if err := r.Register(service, registry.RegisterTTL(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Deregister(service)
+	old := r.nodes[nodePath(service.Name, "foo-1")].lease
+
+	service.Nodes[0].Address = "127.0.0.1:8081"
+	if err := r.Register(service, registry.RegisterTTL(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := r.getClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp, err := c.TimeToLive(context.Background(), old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.TTL != -1 {
+		t.Fatalf("expected the old lease to be revoked, got a TTL of %d", rsp.TTL)
+	}
+
+	svcs, err := r.GetService(service.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(svcs) != 1 || len(svcs[0].Nodes) != 1 || svcs[0].Nodes[0].Address != "127.0.0.1:8081" {
+		t.Fatalf("expected the changed node, got %+v", svcs)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testData := []struct {
+		opts  []registry.Option
+		valid bool
+	}{
+		{nil, true},
+		{[]registry.Option{registry.Addrs("127.0.0.1", "10.0.0.1:2379")}, true},
+		{[]registry.Option{registry.Addrs("127.0.0.1:2379:1")}, false},
+		{[]registry.Option{registry.Timeout(-time.Second)}, false},
+		{[]registry.Option{Auth("", "secret")}, false},
+		{[]registry.Option{LeaseTTL(10 * time.Second), KeepAliveInterval(3 * time.Second)}, true},
+		{[]registry.Option{LeaseTTL(10 * time.Second), KeepAliveInterval(10 * time.Second)}, false},
+		{[]registry.Option{Weight(-1)}, false},
+	}
+
+	for _, d := range testData {
+		r := NewRegistry(d.opts...).(*etcdRegistry)
+		if err := r.Validate(); (err == nil) != d.valid {
+			t.Fatalf("expected valid %v, got %v", d.valid, err)
+		}
+	}
+
+	// init leaves the options as they were
+	r := NewRegistry().(*etcdRegistry)
+	if err := r.Init(registry.Addrs("127.0.0.1:2379:1")); err == nil {
+		t.Fatal("expected the invalid address to fail init")
+	}
+	if len(r.Options().Addrs) != 0 {
+		t.Fatal("expected the options to be left as they were")
+	}
+}
@@ -1,11 +1,110 @@
 package etcd
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"time"
+
 	"github.com/micro/go-micro/v2/registry"
-	"github.com/micro/go-micro/v2/registry/etcd"
 )
 
+type authKey struct{}
+type tlsErrKey struct{}
+type dialTimeoutKey struct{}
+type leaseTTLKey struct{}
+type keepAliveKey struct{}
+type resyncKey struct{}
+type weightKey struct{}
+
+type authCreds struct {
+	Username string
+	Password string
+}
+
 // Auth allows you to specify username/password
 func Auth(username, password string) registry.Option {
-	return etcd.Auth(username, password)
+	return setOption(authKey{}, &authCreds{Username: username, Password: password})
+}
+
+func setOption(k, v interface{}) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// TLSFiles connects to etcd over TLS with the client certificate and key, verifying
+// the server with the CA certificate. Without a CA the system roots are used.
+// Files which can't be loaded fail NewRegistry and Init
+func TLSFiles(certFile, keyFile, caFile string) registry.Option {
+	return func(o *registry.Options) {
+		config, err := loadTLS(certFile, keyFile, caFile)
+		if err != nil {
+			setOption(tlsErrKey{}, err)(o)
+			return
+		}
+		registry.TLSConfig(config)(o)
+	}
+}
+
+func loadTLS(certFile, keyFile, caFile string) (*tls.Config, error) {
+	config := new(tls.Config)
+
+	if len(certFile) > 0 || len(keyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load etcd client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(caFile) > 0 {
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read etcd ca certificate: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+
+	return config, nil
+}
+
+// DialTimeout sets how long to wait for the connection to etcd, by default the
+// registry Timeout or 5 seconds
+func DialTimeout(d time.Duration) registry.Option {
+	return setOption(dialTimeoutKey{}, d)
+}
+
+// LeaseTTL sets the TTL of the lease nodes are registered with, overriding the
+// RegisterTTL of the service. Nodes are removed once their lease expires
+func LeaseTTL(d time.Duration) registry.Option {
+	return setOption(leaseTTLKey{}, d)
+}
+
+// KeepAliveInterval keeps the leases of registered nodes alive every interval,
+// independent of how often the service registers. It must be shorter than the TTL
+func KeepAliveInterval(d time.Duration) registry.Option {
+	return setOption(keepAliveKey{}, d)
+}
+
+// Resync is called by watchers with the nodes listed after the watch failed, such
+// as when its revision was compacted. Each service holds a single node. Changes
+// missed in the meantime have been sent to the watcher as results already
+func Resync(fn func(services []*registry.Service)) registry.Option {
+	return setOption(resyncKey{}, fn)
+}
+
+// Weight sets the weight of the nodes registered, unless the node metadata holds one
+// already. Weighted selectors balance calls by it, e.g a canary of weight 5 next to
+// nodes of the default weight takes about 5% of the calls
+func Weight(w int) registry.Option {
+	return setOption(weightKey{}, w)
 }
@@ -0,0 +1,269 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+/*
+	The watcher lists the nodes under its prefix before watching from the revision
+	of the list, so it knows every node it may be told about. When the revision it
+	watches from has been compacted etcd cancels the watch, the watcher then lists
+	the nodes again and sends the difference to what it knew as results before
+	watching from the new revision. Caches built from the results recover without
+	missing nodes registered or removed while the watch was down.
+*/
+
+var (
+	// ResyncMinBackoff is the delay before listing nodes again after a failed list
+	ResyncMinBackoff = time.Second
+	// ResyncMaxBackoff is the longest delay between failed lists
+	ResyncMaxBackoff = time.Minute
+)
+
+type etcdWatcher struct {
+	e      *etcdRegistry
+	prefix string
+	resync func([]*registry.Service)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	next   chan *registry.Result
+	once   sync.Once
+
+	// known holds the value of every node under the prefix by key
+	known map[string][]byte
+}
+
+func newWatcher(e *etcdRegistry, opts ...registry.WatchOption) (*etcdWatcher, error) {
+	var options registry.WatchOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	c, err := e.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	watchPath := prefix
+	if len(options.Service) > 0 {
+		watchPath = path.Join(prefix, strings.Replace(options.Service, "/", "-", -1)) + "/"
+	}
+
+	resync, _ := e.opts.Context.Value(resyncKey{}).(func([]*registry.Service))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &etcdWatcher{
+		e:      e,
+		prefix: watchPath,
+		resync: resync,
+		ctx:    ctx,
+		cancel: cancel,
+		next:   make(chan *registry.Result),
+		known:  make(map[string][]byte),
+	}
+
+	// the first list only records the nodes, like a plain watch it sends nothing
+	rev, err := w.list(c, false)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	go w.run(rev)
+	return w, nil
+}
+
+func decode(v []byte) *registry.Service {
+	var s *registry.Service
+	if err := json.Unmarshal(v, &s); err != nil {
+		return nil
+	}
+	return s
+}
+
+// send delivers the result to Next, it returns false once the watcher is stopped
+func (w *etcdWatcher) send(action string, v []byte) bool {
+	s := decode(v)
+	if s == nil {
+		return true
+	}
+
+	select {
+	case w.next <- &registry.Result{Action: action, Service: s}:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+// list reads the nodes under the prefix and returns the revision they were read at.
+// With notify set the difference to the known nodes is sent
+func (w *etcdWatcher) list(c *clientv3.Client, notify bool) (int64, error) {
+	ctx, cancel := context.WithTimeout(w.ctx, w.e.timeout())
+	defer cancel()
+
+	rsp, err := c.Get(ctx, w.prefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+
+	nodes := make(map[string][]byte, len(rsp.Kvs))
+	for _, kv := range rsp.Kvs {
+		nodes[string(kv.Key)] = kv.Value
+	}
+
+	if notify {
+		for key, v := range nodes {
+			old, ok := w.known[key]
+			switch {
+			case !ok:
+				if !w.send("create", v) {
+					return 0, context.Canceled
+				}
+			case string(old) != string(v):
+				if !w.send("update", v) {
+					return 0, context.Canceled
+				}
+			}
+		}
+		for key, v := range w.known {
+			if _, ok := nodes[key]; !ok {
+				if !w.send("delete", v) {
+					return 0, context.Canceled
+				}
+			}
+		}
+	}
+	w.known = nodes
+
+	if notify && w.resync != nil {
+		var services []*registry.Service
+		for _, v := range nodes {
+			if s := decode(v); s != nil {
+				services = append(services, s)
+			}
+		}
+		w.resync(services)
+	}
+
+	return rsp.Header.Revision, nil
+}
+
+// watch sends the events after the revision until the watch fails
+func (w *etcdWatcher) watch(c *clientv3.Client, rev int64) error {
+	ch := c.Watch(w.ctx, w.prefix, clientv3.WithPrefix(), clientv3.WithPrevKV(), clientv3.WithRev(rev+1))
+	for wresp := range ch {
+		if err := wresp.Err(); err != nil {
+			return err
+		}
+		for _, ev := range wresp.Events {
+			key := string(ev.Kv.Key)
+			var ok bool
+
+			switch ev.Type {
+			case mvccpb.PUT:
+				action := "update"
+				if ev.IsCreate() {
+					action = "create"
+				}
+				w.known[key] = ev.Kv.Value
+				ok = w.send(action, ev.Kv.Value)
+			case mvccpb.DELETE:
+				v := w.known[key]
+				if ev.PrevKv != nil {
+					v = ev.PrevKv.Value
+				}
+				delete(w.known, key)
+				ok = w.send("delete", v)
+			}
+
+			if !ok {
+				return context.Canceled
+			}
+		}
+	}
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	return errors.New("watch closed")
+}
+
+// wait sleeps for the backoff and doubles it, it returns false once the watcher is stopped
+func (w *etcdWatcher) wait(backoff *time.Duration) bool {
+	select {
+	case <-time.After(*backoff):
+	case <-w.ctx.Done():
+		return false
+	}
+	if *backoff *= 2; *backoff > ResyncMaxBackoff {
+		*backoff = ResyncMaxBackoff
+	}
+	return true
+}
+
+func (w *etcdWatcher) run(rev int64) {
+	backoff := ResyncMinBackoff
+
+	for {
+		started := time.Now()
+		c, err := w.e.getClient()
+		if err == nil {
+			err = w.watch(c, rev)
+		}
+		if w.ctx.Err() != nil {
+			return
+		}
+		log.Warnf("[etcd] watch of %s failed, resyncing: %v", w.prefix, err)
+
+		// a compacted revision is listed again right away, other failures back off
+		if time.Since(started) > ResyncMaxBackoff {
+			backoff = ResyncMinBackoff
+		}
+		if err != rpctypes.ErrCompacted && !w.wait(&backoff) {
+			return
+		}
+
+		// list again, sending what was missed while the watch was down
+		for {
+			if c, err = w.e.getClient(); err == nil {
+				if rev, err = w.list(c, true); err == nil {
+					break
+				}
+			}
+			if w.ctx.Err() != nil {
+				return
+			}
+			log.Errorf("[etcd] failed to list %s: %v", w.prefix, err)
+
+			if !w.wait(&backoff) {
+				return
+			}
+		}
+	}
+}
+
+func (w *etcdWatcher) Next() (*registry.Result, error) {
+	select {
+	case r := <-w.next:
+		return r, nil
+	case <-w.ctx.Done():
+		return nil, registry.ErrWatcherStopped
+	}
+}
+
+func (w *etcdWatcher) Stop() {
+	w.once.Do(w.cancel)
+}
@@ -0,0 +1,100 @@
+package etcd
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+// TestWatchCompacted needs an etcd server, set ETCD_ADDRESS to run it
+func TestWatchCompacted(t *testing.T) {
+	addr := os.Getenv("ETCD_ADDRESS")
+	if len(addr) == 0 {
+		t.Skip("ETCD_ADDRESS is undefined")
+	}
+
+	resynced := make(chan []*registry.Service, 1)
+	r := NewRegistry(registry.Addrs(addr), Resync(func(services []*registry.Service) {
+		resynced <- services
+	})).(*etcdRegistry)
+
+	service := func(id string) *registry.Service {
+		return &registry.Service{
+			Name:  "test.compacted",
+			Nodes: []*registry.Node{{Id: id, Address: "127.0.0.1:8080"}},
+		}
+	}
+
+	if err := r.Register(service("a")); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Deregister(service("a"))
+
+	c, err := r.getClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &etcdWatcher{
+		e:      r,
+		prefix: prefix + "test.compacted/",
+		resync: r.opts.Context.Value(resyncKey{}).(func([]*registry.Service)),
+		ctx:    ctx,
+		cancel: cancel,
+		next:   make(chan *registry.Result),
+		known:  make(map[string][]byte),
+	}
+	defer w.Stop()
+
+	rev, err := w.list(c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// register and compact before watching, so the revision of the list is gone
+	if err := r.Register(service("b")); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Deregister(service("b"))
+
+	rsp, err := c.Get(context.Background(), "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Compact(context.Background(), rsp.Header.Revision); err != nil {
+		t.Fatal(err)
+	}
+
+	go w.run(rev)
+
+	res, err := w.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Action != "create" || res.Service.Nodes[0].Id != "b" {
+		t.Fatalf("expected node b to be created, got %s of %s", res.Action, res.Service.Nodes[0].Id)
+	}
+
+	select {
+	case services := <-resynced:
+		if len(services) != 2 {
+			t.Fatalf("expected 2 nodes listed, got %d", len(services))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the resync callback to be called")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	if s := decode([]byte("{")); s != nil {
+		t.Fatal("expected invalid values to be skipped")
+	}
+	s := decode([]byte(`{"name":"foo","nodes":[{"id":"foo-1"}]}`))
+	if s == nil || s.Name != "foo" || s.Nodes[0].Id != "foo-1" {
+		t.Fatalf("unexpected service %+v", s)
+	}
+}
@@ -2,15 +2,284 @@
 package etcdv3
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
 	"github.com/micro/go-micro/v2/config/cmd"
 	"github.com/micro/go-micro/v2/registry"
 	"github.com/micro/go-micro/v2/registry/etcd"
 )
 
+/*
+	Services are read and watched by the go-micro etcd registry, registration is
+	handled here to survive the failure of etcd endpoints. The client fails over
+	between the endpoints, nodes registered with the same TTL share a lease kept
+	alive by a single stream, and the stream is retried on transient errors. When
+	the lease is lost, after a leader change or while etcd couldn't be reached,
+	a new lease is granted and the nodes written again.
+*/
+
+var (
+	prefix = "/micro/registry/"
+)
+
+type etcdRegistry struct {
+	registry.Registry
+	opts registry.Options
+
+	sync.Mutex
+	client *clientv3.Client
+	// sessions keep the nodes alive, keyed by TTL
+	sessions map[time.Duration]*session
+}
+
 func init() {
-	cmd.DefaultRegistries["etcdv3"] = etcd.NewRegistry
+	cmd.DefaultRegistries["etcdv3"] = NewRegistry
+}
+
+func nodePath(s, id string) string {
+	service := strings.Replace(s, "/", "-", -1)
+	node := strings.Replace(id, "/", "-", -1)
+	return path.Join(prefix, service, node)
+}
+
+// encodeNode returns the value of the node, a copy of the service holding only the node
+func encodeNode(s *registry.Service, node *registry.Node) (string, error) {
+	b, err := json.Marshal(&registry.Service{
+		Name:      s.Name,
+		Version:   s.Version,
+		Metadata:  s.Metadata,
+		Endpoints: s.Endpoints,
+		Nodes:     []*registry.Node{node},
+	})
+	return string(b), err
+}
+
+func (e *etcdRegistry) Init(opts ...registry.Option) error {
+	for _, o := range opts {
+		o(&e.opts)
+	}
+
+	e.Lock()
+	for ttl, s := range e.sessions {
+		close(s.exit)
+		delete(e.sessions, ttl)
+	}
+	if e.client != nil {
+		e.client.Close()
+		e.client = nil
+	}
+	e.Unlock()
+
+	return e.Registry.Init(opts...)
+}
+
+// getClient returns the client used for registration, created on first use
+func (e *etcdRegistry) getClient() (*clientv3.Client, error) {
+	e.Lock()
+	defer e.Unlock()
+
+	if e.client != nil {
+		return e.client, nil
+	}
+
+	config := clientv3.Config{
+		DialTimeout: e.opts.Timeout,
+		// detect dead endpoints so the client fails over to the others
+		DialKeepAliveTime:    10 * time.Second,
+		DialKeepAliveTimeout: 3 * time.Second,
+	}
+	if d, ok := e.opts.Context.Value(dialTimeoutKey{}).(time.Duration); ok && d > 0 {
+		config.DialTimeout = d
+	}
+	if config.DialTimeout == 0 {
+		config.DialTimeout = 5 * time.Second
+	}
+	if e.opts.Secure || e.opts.TLSConfig != nil {
+		tlsConfig := e.opts.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{
+				InsecureSkipVerify: true,
+			}
+		}
+		config.TLS = tlsConfig
+	}
+	if creds, ok := e.opts.Context.Value(authKey{}).(*authCreds); ok {
+		config.Username = creds.Username
+		config.Password = creds.Password
+	}
+
+	for _, address := range e.opts.Addrs {
+		if len(address) == 0 {
+			continue
+		}
+		addr, port, err := net.SplitHostPort(address)
+		if ae, ok := err.(*net.AddrError); ok && ae.Err == "missing port in address" {
+			port = "2379"
+			addr = address
+		} else if err != nil {
+			continue
+		}
+		config.Endpoints = append(config.Endpoints, net.JoinHostPort(addr, port))
+	}
+	if len(config.Endpoints) == 0 {
+		config.Endpoints = []string{"127.0.0.1:2379"}
+	}
+
+	c, err := clientv3.New(config)
+	if err != nil {
+		return nil, err
+	}
+	e.client = c
+	return c, nil
+}
+
+// Register writes the nodes of the service with the lease of the TTL. Nodes already
+// registered with the same value are left to the lease's keep alive
+func (e *etcdRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("Require at least one node")
+	}
+
+	var options registry.RegisterOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	c, err := e.getClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout())
+	defer cancel()
+
+	// without a TTL the nodes are never removed
+	if options.TTL < time.Second {
+		for _, n := range s.Nodes {
+			value, err := encodeNode(s, n)
+			if err != nil {
+				return err
+			}
+			if _, err := c.Put(ctx, nodePath(s.Name, n.Id), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	sess := e.session(c, options.TTL)
+
+	for _, n := range s.Nodes {
+		value, err := encodeNode(s, n)
+		if err != nil {
+			return err
+		}
+		if err := e.put(ctx, c, sess, nodePath(s.Name, n.Id), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// put writes the node with the lease of the session, granting one if the lease was lost
+func (e *etcdRegistry) put(ctx context.Context, c *clientv3.Client, s *session, key, value string) error {
+	e.Lock()
+	unchanged := s.nodes[key] == value && s.lease != clientv3.NoLease
+	// keep the node, so it's written again with a new lease if this fails
+	s.nodes[key] = value
+	lease := s.lease
+	e.Unlock()
+
+	if unchanged {
+		return nil
+	}
+
+	if lease == clientv3.NoLease {
+		if err := e.grant(ctx, c, s); err != nil {
+			return err
+		}
+		e.Lock()
+		lease = s.lease
+		e.Unlock()
+	}
+	if lease == clientv3.NoLease {
+		return errLeaseExpired
+	}
+
+	_, err := c.Put(ctx, key, value, clientv3.WithLease(lease))
+	return err
+}
+
+// Deregister deletes the nodes of the service and stops keeping them alive
+func (e *etcdRegistry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("Require at least one node")
+	}
+
+	c, err := e.getClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout())
+	defer cancel()
+
+	for _, n := range s.Nodes {
+		key := nodePath(s.Name, n.Id)
+
+		var revoke clientv3.LeaseID
+		e.Lock()
+		for ttl, sess := range e.sessions {
+			if _, ok := sess.nodes[key]; !ok {
+				continue
+			}
+			delete(sess.nodes, key)
+			// the last node of the session, stop keeping the lease alive
+			if len(sess.nodes) == 0 {
+				close(sess.exit)
+				delete(e.sessions, ttl)
+				revoke = sess.lease
+			}
+		}
+		e.Unlock()
+
+		if _, err := c.Delete(ctx, key); err != nil {
+			return err
+		}
+		if revoke != clientv3.NoLease {
+			c.Revoke(ctx, revoke)
+		}
+	}
+	return nil
+}
+
+func (e *etcdRegistry) timeout() time.Duration {
+	if e.opts.Timeout > 0 {
+		return e.opts.Timeout
+	}
+	return 5 * time.Second
 }
 
 func NewRegistry(opts ...registry.Option) registry.Registry {
-	return etcd.NewRegistry(opts...)
+	options := registry.Options{
+		Context: context.Background(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return &etcdRegistry{
+		Registry: etcd.NewRegistry(opts...),
+		opts:     options,
+		sessions: make(map[time.Duration]*session),
+	}
 }
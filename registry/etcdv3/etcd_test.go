@@ -0,0 +1,77 @@
+package etcdv3
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+func TestBackoff(t *testing.T) {
+	if d := backoff(0); d != 0 {
+		t.Fatalf("expected no backoff, got %v", d)
+	}
+	if d := backoff(3); d != 800*time.Millisecond {
+		t.Fatalf("expected 800ms, got %v", d)
+	}
+	if d := backoff(100); d != 10*time.Second {
+		t.Fatalf("expected the backoff to be capped, got %v", d)
+	}
+}
+
+// TestLivenessLost needs an etcd server, set ETCD_ADDRESS to run it
+func TestLivenessLost(t *testing.T) {
+	addr := os.Getenv("ETCD_ADDRESS")
+	if len(addr) == 0 {
+		t.Skip("ETCD_ADDRESS is undefined")
+	}
+
+	lost := make(chan error, 1)
+	r := NewRegistry(registry.Addrs(addr), LivenessLost(func(err error) {
+		lost <- err
+	})).(*etcdRegistry)
+
+	service := &registry.Service{
+		Name:  "test.liveness",
+		Nodes: []*registry.Node{{Id: "a", Address: "127.0.0.1:8080"}},
+	}
+	if err := r.Register(service, registry.RegisterTTL(10*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Deregister(service)
+
+	c, err := r.getClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// revoke the lease behind the back of the registry
+	r.Lock()
+	lease := r.sessions[10*time.Second].lease
+	r.Unlock()
+	if _, err := c.Revoke(context.Background(), lease); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-lost:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the registration to be lost")
+	}
+
+	// the node is registered again with a new lease
+	key := nodePath(service.Name, "a")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		rsp, err := c.Get(context.Background(), key)
+		if err == nil && len(rsp.Kvs) == 1 && rsp.Kvs[0].Lease != int64(lease) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the node to be registered again")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -2,4 +2,7 @@ module github.com/micro/go-plugins/registry/etcdv3/v2
 
 go 1.13
 
-require github.com/micro/go-micro/v2 v2.9.1
+require (
+	github.com/coreos/etcd v3.3.18+incompatible
+	github.com/micro/go-micro/v2 v2.9.1
+)
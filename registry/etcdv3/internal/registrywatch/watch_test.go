@@ -0,0 +1,89 @@
+package registrywatch
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+func TestBackoff(t *testing.T) {
+	if d := Backoff(0, time.Millisecond, time.Second); d != 0 {
+		t.Fatalf("expected no backoff, got %v", d)
+	}
+	if d := Backoff(3, time.Millisecond, time.Second); d != 8*time.Millisecond {
+		t.Fatalf("expected 8ms, got %v", d)
+	}
+	if d := Backoff(100, time.Millisecond, time.Second); d != time.Second {
+		t.Fatalf("expected the backoff to be capped, got %v", d)
+	}
+}
+
+type testWatcher struct {
+	results chan *registry.Result
+	exit    chan bool
+	once    sync.Once
+}
+
+func (w *testWatcher) Next() (*registry.Result, error) {
+	select {
+	case r, ok := <-w.results:
+		if !ok {
+			return nil, errors.New("closed")
+		}
+		return r, nil
+	case <-w.exit:
+		return nil, registry.ErrWatcherStopped
+	}
+}
+
+func (w *testWatcher) Stop() {
+	w.once.Do(func() { close(w.exit) })
+}
+
+func TestRun(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		watches int
+	)
+	results := make(chan *registry.Result)
+	watch := func(...registry.WatchOption) (registry.Watcher, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		watches++
+		// the first watch fails
+		if watches == 1 {
+			return nil, errors.New("down")
+		}
+		return &testWatcher{results: results, exit: make(chan bool)}, nil
+	}
+
+	got := make(chan *registry.Result)
+	exit := make(chan struct{})
+	done := make(chan bool)
+	go func() {
+		Run("test", exit, watch, func(r *registry.Result) { got <- r })
+		close(done)
+	}()
+
+	// results without a service are skipped
+	results <- &registry.Result{Action: "create"}
+	results <- &registry.Result{Action: "create", Service: &registry.Service{Name: "foo"}}
+	select {
+	case r := <-got:
+		if r.Service.Name != "foo" {
+			t.Fatalf("expected foo, got %s", r.Service.Name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a result")
+	}
+
+	close(exit)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected Run to return once exit is closed")
+	}
+}
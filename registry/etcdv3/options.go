@@ -1,11 +1,50 @@
 package etcdv3
 
 import (
+	"context"
+	"time"
+
 	"github.com/micro/go-micro/v2/registry"
 	"github.com/micro/go-micro/v2/registry/etcd"
 )
 
+type authKey struct{}
+type dialTimeoutKey struct{}
+type livenessLostKey struct{}
+
+type authCreds struct {
+	Username string
+	Password string
+}
+
 // Auth allows you to specify username/password
 func Auth(username, password string) registry.Option {
-	return etcd.Auth(username, password)
+	return func(o *registry.Options) {
+		etcd.Auth(username, password)(o)
+		// keep our own copy for the registration client
+		o.Context = context.WithValue(o.Context, authKey{}, &authCreds{Username: username, Password: password})
+	}
+}
+
+func setOption(k, v interface{}) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// DialTimeout sets how long to wait for the connection to etcd, by default the
+// registry Timeout or 5 seconds
+func DialTimeout(d time.Duration) registry.Option {
+	return setOption(dialTimeoutKey{}, d)
+}
+
+// LivenessLost is called when the registration is lost, the lease of the nodes
+// expired before it could be kept alive so other services no longer see them.
+// The registry keeps registering the nodes again regardless, the service may
+// alert or exit. It's called from the keep alive goroutine and must not block
+func LivenessLost(fn func(err error)) registry.Option {
+	return setOption(livenessLostKey{}, fn)
 }
@@ -0,0 +1,218 @@
+package etcdv3
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-plugins/registry/etcdv3/v2/internal/registrywatch"
+)
+
+var errLeaseExpired = errors.New("lease expired")
+
+// session is a lease and the nodes it keeps alive
+type session struct {
+	ttl time.Duration
+	// nodes keyed by path
+	nodes map[string]string
+	lease clientv3.LeaseID
+	// deadline is when the lease expires without another keep alive
+	deadline time.Time
+	// lost is set once the lease expired until the nodes are written again
+	lost bool
+	exit chan bool
+
+	// serialises granting leases
+	grantMu sync.Mutex
+}
+
+// backoff returns the time to wait before retrying
+func backoff(attempts int) time.Duration {
+	return registrywatch.Backoff(attempts, time.Millisecond*100, time.Second*10)
+}
+
+// session returns the session of the TTL, started on first use
+func (e *etcdRegistry) session(c *clientv3.Client, ttl time.Duration) *session {
+	e.Lock()
+	defer e.Unlock()
+
+	if s, ok := e.sessions[ttl]; ok {
+		return s
+	}
+
+	s := &session{
+		ttl:   ttl,
+		nodes: make(map[string]string),
+		exit:  make(chan bool),
+	}
+	e.sessions[ttl] = s
+	go e.run(c, s)
+	return s
+}
+
+// grant writes the nodes of the session with a new lease, unless another call did
+func (e *etcdRegistry) grant(ctx context.Context, c *clientv3.Client, s *session) error {
+	s.grantMu.Lock()
+	defer s.grantMu.Unlock()
+
+	e.Lock()
+	if s.lease != clientv3.NoLease {
+		e.Unlock()
+		return nil
+	}
+	nodes := make(map[string]string, len(s.nodes))
+	for k, v := range s.nodes {
+		nodes[k] = v
+	}
+	e.Unlock()
+
+	lgr, err := c.Grant(ctx, int64(s.ttl.Seconds()))
+	if err != nil {
+		return err
+	}
+
+	var ops []clientv3.Op
+	for key, value := range nodes {
+		ops = append(ops, clientv3.OpPut(key, value, clientv3.WithLease(lgr.ID)))
+	}
+	if _, err := c.Txn(ctx).Then(ops...).Commit(); err != nil {
+		c.Revoke(ctx, lgr.ID)
+		return err
+	}
+
+	e.Lock()
+	s.lease = lgr.ID
+	s.deadline = time.Now().Add(time.Duration(lgr.TTL) * time.Second)
+	lost := s.lost
+	s.lost = false
+	e.Unlock()
+
+	if lost {
+		log.Infof("[etcdv3] registered %d nodes again", len(nodes))
+	}
+	return nil
+}
+
+// expire marks the lease of the session lost, notifying once per loss
+func (e *etcdRegistry) expire(s *session, err error) {
+	e.Lock()
+	s.lease = clientv3.NoLease
+	notify := !s.lost
+	s.lost = true
+	e.Unlock()
+
+	if !notify {
+		return
+	}
+
+	log.Errorf("[etcdv3] registration lost: %v", err)
+	if fn, ok := e.opts.Context.Value(livenessLostKey{}).(func(error)); ok && fn != nil {
+		fn(err)
+	}
+}
+
+// check finds out whether the lease is still alive after the keep alive stopped
+func (e *etcdRegistry) check(c *clientv3.Client, s *session) {
+	e.Lock()
+	lease := s.lease
+	deadline := s.deadline
+	e.Unlock()
+
+	if lease == clientv3.NoLease {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout())
+	rsp, err := c.TimeToLive(ctx, lease)
+	cancel()
+
+	switch {
+	case err == nil && rsp.TTL > 0:
+		e.Lock()
+		s.deadline = time.Now().Add(time.Duration(rsp.TTL) * time.Second)
+		e.Unlock()
+	case err == nil || err == rpctypes.ErrLeaseNotFound:
+		e.expire(s, errLeaseExpired)
+	case time.Now().After(deadline):
+		// etcd can't be reached, the nodes expired in the meantime
+		e.expire(s, err)
+	default:
+		log.Debugf("[etcdv3] failed to check lease %x: %v", lease, err)
+	}
+}
+
+// run keeps the lease of the session alive until the session is stopped, granting
+// a new one whenever it's lost
+func (e *etcdRegistry) run(c *clientv3.Client, s *session) {
+	var attempts int
+
+	for {
+		select {
+		case <-s.exit:
+			return
+		case <-time.After(backoff(attempts)):
+		}
+
+		e.Lock()
+		lease := s.lease
+		e.Unlock()
+
+		if lease == clientv3.NoLease {
+			ctx, cancel := context.WithTimeout(context.Background(), e.timeout())
+			err := e.grant(ctx, c, s)
+			cancel()
+			if err != nil {
+				attempts++
+				log.Debugf("[etcdv3] failed to register again: %v", err)
+				continue
+			}
+			e.Lock()
+			lease = s.lease
+			e.Unlock()
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		ch, err := c.KeepAlive(ctx, lease)
+		if err != nil {
+			cancel()
+			attempts++
+			e.check(c, s)
+			continue
+		}
+		attempts = 0
+
+		e.keepAlive(s, ch)
+		cancel()
+
+		select {
+		case <-s.exit:
+			return
+		default:
+		}
+
+		// the stream ends once the lease expired or etcd couldn't be reached for long
+		attempts++
+		e.check(c, s)
+	}
+}
+
+// keepAlive consumes the keep alive responses until the stream ends or the session stops
+func (e *etcdRegistry) keepAlive(s *session, ch <-chan *clientv3.LeaseKeepAliveResponse) {
+	for {
+		select {
+		case <-s.exit:
+			return
+		case rsp, ok := <-ch:
+			if !ok {
+				return
+			}
+			e.Lock()
+			s.deadline = time.Now().Add(time.Duration(rsp.TTL) * time.Second)
+			e.Unlock()
+		}
+	}
+}
@@ -8,6 +8,7 @@ package eureka
 import (
 	"context"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/hudl/fargo"
@@ -29,6 +30,11 @@ type fargoConnection interface {
 type eurekaRegistry struct {
 	conn fargoConnection
 	opts registry.Options
+
+	sync.Mutex
+	// instances registered, heartbeated every HeartbeatInterval
+	instances map[string]*fargo.Instance
+	heartbeat chan bool
 }
 
 func init() {
@@ -59,7 +65,22 @@ func configure(e *eurekaRegistry, opts ...registry.Option) error {
 
 	conn := fargo.NewConn(cAddrs...)
 	conn.PollInterval = time.Second * 5
+	if d, ok := e.opts.Context.Value(pollIntervalKey{}).(time.Duration); ok && d > 0 {
+		conn.PollInterval = d
+	}
+
+	e.Lock()
 	e.conn = &conn
+	if e.heartbeat != nil {
+		close(e.heartbeat)
+		e.heartbeat = nil
+	}
+	if d, ok := e.opts.Context.Value(heartbeatIntervalKey{}).(time.Duration); ok && d > 0 {
+		e.heartbeat = make(chan bool)
+		go e.heartbeatLoop(d, e.heartbeat)
+	}
+	e.Unlock()
+
 	return nil
 }
 
@@ -68,6 +89,7 @@ func newRegistry(opts ...registry.Option) registry.Registry {
 		opts: registry.Options{
 			Context: context.Background(),
 		},
+		instances: make(map[string]*fargo.Instance),
 	}
 	configure(e, opts...)
 	return e
@@ -81,27 +103,100 @@ func (e *eurekaRegistry) Options() registry.Options {
 	return e.opts
 }
 
-func (e *eurekaRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+// instance returns the instance of the service with the lease, zone and port options applied
+func (e *eurekaRegistry) instance(s *registry.Service) (*fargo.Instance, error) {
 	instance, err := serviceToInstance(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if d, ok := e.opts.Context.Value(heartbeatIntervalKey{}).(time.Duration); ok && d >= time.Second {
+		instance.LeaseInfo.RenewalIntervalInSecs = int32(d / time.Second)
+	}
+	if d, ok := e.opts.Context.Value(leaseDurationKey{}).(time.Duration); ok && d >= time.Second {
+		instance.LeaseInfo.DurationInSecs = int32(d / time.Second)
+	}
+
+	zone, _ := e.opts.Context.Value(zoneKey{}).(string)
+	if len(zone) == 0 {
+		zone = s.Nodes[0].Metadata["zone"]
+	}
+	if len(zone) > 0 {
+		instance.SetMetadataString("zone", zone)
+	}
+
+	if secure, _ := e.opts.Context.Value(securePortKey{}).(bool); secure {
+		instance.SecurePort = instance.Port
+		instance.SecurePortEnabled = true
+		instance.PortEnabled = false
+	}
+
+	return instance, nil
+}
+
+func (e *eurekaRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	instance, err := e.instance(s)
 	if err != nil {
 		return err
 	}
 
 	if e.instanceRegistered(instance) {
-		return e.conn.HeartBeatInstance(instance)
+		err = e.conn.HeartBeatInstance(instance)
+	} else {
+		err = e.conn.RegisterInstance(instance)
+	}
+	if err != nil {
+		return err
 	}
 
-	return e.conn.RegisterInstance(instance)
+	e.Lock()
+	e.instances[instance.UniqueID(*instance)] = instance
+	e.Unlock()
+	return nil
 }
 
 func (e *eurekaRegistry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
-	instance, err := serviceToInstance(s)
+	instance, err := e.instance(s)
 	if err != nil {
 		return err
 	}
+
+	e.Lock()
+	delete(e.instances, instance.UniqueID(*instance))
+	e.Unlock()
+
 	return e.conn.DeregisterInstance(instance)
 }
 
+// heartbeatLoop sends heartbeats for the registered instances every interval,
+// registering instances eureka no longer knows again
+func (e *eurekaRegistry) heartbeatLoop(interval time.Duration, exit chan bool) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-exit:
+			return
+		case <-t.C:
+		}
+
+		e.Lock()
+		conn := e.conn
+		instances := make([]*fargo.Instance, 0, len(e.instances))
+		for _, instance := range e.instances {
+			instances = append(instances, instance)
+		}
+		e.Unlock()
+
+		for _, instance := range instances {
+			if err := conn.HeartBeatInstance(instance); err != nil {
+				conn.RegisterInstance(instance)
+			}
+		}
+	}
+}
+
 func (e *eurekaRegistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
 	app, err := e.conn.GetApp(name)
 	if err != nil {
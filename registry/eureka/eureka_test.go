@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/hudl/fargo"
 	"github.com/micro/go-micro/v2/registry"
@@ -72,3 +73,65 @@ func TestSwitchHttpClient(t *testing.T) {
 		t.Errorf("Unexpected fargo.HttpClient: got %v, want %v", fargo.HttpClient, expected)
 	}
 }
+
+func TestInstanceOptions(t *testing.T) {
+	eureka := NewRegistry(
+		LeaseDuration(90*time.Second),
+		Zone("eu-west-1a"),
+		SecurePort(),
+	).(*eurekaRegistry)
+
+	instance, err := eureka.instance(&registry.Service{
+		Name:  "foo",
+		Nodes: []*registry.Node{{Id: "foo-1", Address: "10.0.0.1:8443"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if instance.LeaseInfo.DurationInSecs != 90 {
+		t.Errorf("Unexpected lease duration: want 90, got %d", instance.LeaseInfo.DurationInSecs)
+	}
+	if zone := instance.Metadata.GetMap()["zone"]; zone != "eu-west-1a" {
+		t.Errorf("Unexpected zone: want eu-west-1a, got %v", zone)
+	}
+	if !instance.SecurePortEnabled || instance.SecurePort != 8443 || instance.PortEnabled {
+		t.Errorf("Expected the secure port 8443 to be registered, got %d", instance.SecurePort)
+	}
+}
+
+func TestHeartbeatInterval(t *testing.T) {
+	eureka := NewRegistry(HeartbeatInterval(10 * time.Millisecond)).(*eurekaRegistry)
+	defer eureka.Init(HeartbeatInterval(0))
+
+	mockConn := new(mock.FargoConnection)
+	mockConn.GetInstanceReturns(nil, errors.New("Instance not existing"))
+	eureka.Lock()
+	eureka.conn = mockConn
+	eureka.Unlock()
+
+	service := &registry.Service{
+		Name:  "foo",
+		Nodes: []*registry.Node{{Id: "foo-1", Address: "10.0.0.1:8080"}},
+	}
+	if err := eureka.Register(service); err != nil {
+		t.Fatal(err)
+	}
+
+	instance, _ := eureka.instance(service)
+	if instance.LeaseInfo.RenewalIntervalInSecs != 0 {
+		t.Errorf("Expected intervals below a second not to be registered, got %d", instance.LeaseInfo.RenewalIntervalInSecs)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if mockConn.HeartBeatInstanceCallCount() == 0 {
+		t.Error("Expected heartbeats to be sent")
+	}
+
+	eureka.Deregister(service)
+	calls := mockConn.HeartBeatInstanceCallCount()
+	time.Sleep(50 * time.Millisecond)
+	if mockConn.HeartBeatInstanceCallCount() > calls+1 {
+		t.Error("Expected heartbeats to stop after deregistering")
+	}
+}
@@ -25,7 +25,8 @@ func appToService(app *fargo.Application) []*registry.Service {
 		var endpoints []*registry.Endpoint
 
 		// get version
-		if _, err := instance.Metadata.GetString("version"); err != nil {
+		version, err := instance.Metadata.GetString("version")
+		if err != nil {
 			continue
 		}
 
@@ -37,6 +38,20 @@ func appToService(app *fargo.Application) []*registry.Service {
 			json.Unmarshal([]byte(k), &metadata)
 		}
 
+		// expose the zone to selectors
+		if zone, err := instance.Metadata.GetString("zone"); err == nil && len(zone) > 0 {
+			if metadata == nil {
+				metadata = make(map[string]string)
+			}
+			if _, ok := metadata["zone"]; !ok {
+				metadata["zone"] = zone
+			}
+		}
+
+		if instance.SecurePortEnabled && !instance.PortEnabled {
+			port = instance.SecurePort
+		}
+
 		// get existing service
 		service, ok := serviceMap[version]
 		if !ok {
@@ -48,7 +63,7 @@ func appToService(app *fargo.Application) []*registry.Service {
 			}
 		}
 
-                host, _, _ := net.SplitHostPort(addr)
+		host, _, _ := net.SplitHostPort(addr)
 
 		// append node
 		service.Nodes = append(service.Nodes, &registry.Node{
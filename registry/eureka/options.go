@@ -3,6 +3,7 @@ package eureka
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/micro/go-micro/v2/registry"
 	"golang.org/x/oauth2"
@@ -10,6 +11,11 @@ import (
 )
 
 type contextHttpClient struct{}
+type heartbeatIntervalKey struct{}
+type leaseDurationKey struct{}
+type pollIntervalKey struct{}
+type zoneKey struct{}
+type securePortKey struct{}
 
 var newOAuthClient = func(c clientcredentials.Config) *http.Client {
 	return c.Client(oauth2.NoContext)
@@ -27,3 +33,41 @@ func OAuth2ClientCredentials(clientID, clientSecret, tokenURL string) registry.O
 		o.Context = context.WithValue(o.Context, contextHttpClient{}, newOAuthClient(c))
 	}
 }
+
+func setOption(k, v interface{}) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// HeartbeatInterval sends heartbeats for registered instances every interval and
+// registers it as their lease renewal interval, rather than relying on the service
+// registering again every RegisterInterval
+func HeartbeatInterval(d time.Duration) registry.Option {
+	return setOption(heartbeatIntervalKey{}, d)
+}
+
+// LeaseDuration sets how long eureka keeps instances without heartbeats, by
+// default 90 seconds
+func LeaseDuration(d time.Duration) registry.Option {
+	return setOption(leaseDurationKey{}, d)
+}
+
+// PollInterval sets how often watchers poll eureka for changes, by default 5 seconds
+func PollInterval(d time.Duration) registry.Option {
+	return setOption(pollIntervalKey{}, d)
+}
+
+// Zone registers instances in the zone, set as the zone metadata zone aware load
+// balancers such as Spring Cloud's read. Without it the zone node metadata is used
+func Zone(zone string) registry.Option {
+	return setOption(zoneKey{}, zone)
+}
+
+// SecurePort registers the port of nodes as the secure port, for services serving TLS
+func SecurePort() registry.Option {
+	return setOption(securePortKey{}, true)
+}
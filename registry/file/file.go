@@ -0,0 +1,414 @@
+// Package file provides a registry loading services from a yaml or json file
+package file
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/ghodss/yaml"
+	"github.com/micro/go-micro/v2/config/cmd"
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/registry"
+	regutil "github.com/micro/go-micro/v2/util/registry"
+)
+
+/*
+	The services of the file are served as they are, there are no health checks.
+	The file is watched and loaded again when it changes, watchers receive the
+	nodes which changed. Services registered at runtime are kept in memory on top
+	of the file, so services can find each other in tests without a registry.
+*/
+
+var (
+	// DefaultPath is the file loaded without Path or a registry address
+	DefaultPath = "registry.yaml"
+
+	// DefaultReloadDelay is how long writes to the file settle without ReloadDelay
+	DefaultReloadDelay = 100 * time.Millisecond
+)
+
+// config is the layout of the file
+type config struct {
+	Services []*registry.Service `json:"services"`
+}
+
+type fileRegistry struct {
+	opts registry.Options
+
+	sync.RWMutex
+	// services loaded from the file
+	loaded []*registry.Service
+	// services registered at runtime
+	registered []*registry.Service
+	watchers   map[int]*fileWatcher
+	nextID     int
+
+	// stops watching the file
+	exit chan bool
+}
+
+func init() {
+	cmd.DefaultRegistries["file"] = NewRegistry
+}
+
+// load reads the services of the file, json is valid yaml as well
+func load(path string) ([]*registry.Service, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c config
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+
+	var services []*registry.Service
+	for _, s := range c.Services {
+		if s == nil || len(s.Name) == 0 {
+			continue
+		}
+		for _, n := range s.Nodes {
+			// the address identifies nodes without an id
+			if len(n.Id) == 0 {
+				n.Id = s.Name + "-" + n.Address
+			}
+		}
+		services = merge(services, []*registry.Service{s})
+	}
+	return services, nil
+}
+
+// merge returns a copy of the services with the nodes of add, services are the
+// same if their name and version are. The metadata and endpoints of add win
+func merge(services, add []*registry.Service) []*registry.Service {
+	merged := regutil.Copy(services)
+	for _, a := range add {
+		a = regutil.CopyService(a)
+
+		var m *registry.Service
+		for _, s := range merged {
+			if s.Name == a.Name && s.Version == a.Version {
+				m = s
+				break
+			}
+		}
+		if m == nil {
+			merged = append(merged, a)
+			continue
+		}
+
+		m.Metadata = a.Metadata
+		m.Endpoints = a.Endpoints
+		for _, n := range a.Nodes {
+			var replaced bool
+			for i, o := range m.Nodes {
+				if o.Id == n.Id {
+					m.Nodes[i] = n
+					replaced = true
+					break
+				}
+			}
+			if !replaced {
+				m.Nodes = append(m.Nodes, n)
+			}
+		}
+	}
+	return merged
+}
+
+// remove returns a copy of the services without the nodes of del, services left
+// without nodes are dropped
+func remove(services, del []*registry.Service) []*registry.Service {
+	var remaining []*registry.Service
+	for _, s := range regutil.Copy(services) {
+		for _, d := range del {
+			if s.Name != d.Name || s.Version != d.Version {
+				continue
+			}
+			var nodes []*registry.Node
+			for _, n := range s.Nodes {
+				var deleted bool
+				for _, dn := range d.Nodes {
+					if n.Id == dn.Id {
+						deleted = true
+						break
+					}
+				}
+				if !deleted {
+					nodes = append(nodes, n)
+				}
+			}
+			s.Nodes = nodes
+		}
+		if len(s.Nodes) > 0 {
+			remaining = append(remaining, s)
+		}
+	}
+	return remaining
+}
+
+// diff returns the results turning the old services into the new ones, one
+// result per node
+func diff(old, new []*registry.Service) []*registry.Result {
+	flatten := func(services []*registry.Service) (map[string]*registry.Service, []string) {
+		nodes := make(map[string]*registry.Service)
+		var keys []string
+		for _, s := range services {
+			for _, n := range s.Nodes {
+				key := s.Name + "/" + s.Version + "/" + n.Id
+				nodes[key] = &registry.Service{
+					Name:      s.Name,
+					Version:   s.Version,
+					Metadata:  s.Metadata,
+					Endpoints: s.Endpoints,
+					Nodes:     []*registry.Node{n},
+				}
+				keys = append(keys, key)
+			}
+		}
+		return nodes, keys
+	}
+
+	oldNodes, oldKeys := flatten(old)
+	newNodes, newKeys := flatten(new)
+
+	var results []*registry.Result
+	for _, key := range newKeys {
+		prev, ok := oldNodes[key]
+		switch {
+		case !ok:
+			results = append(results, &registry.Result{Action: "create", Service: newNodes[key]})
+		case !reflect.DeepEqual(prev, newNodes[key]):
+			results = append(results, &registry.Result{Action: "update", Service: newNodes[key]})
+		}
+	}
+	for _, key := range oldKeys {
+		if _, ok := newNodes[key]; !ok {
+			results = append(results, &registry.Result{Action: "delete", Service: oldNodes[key]})
+		}
+	}
+	return results
+}
+
+// services returns the services of the file and those registered, the caller holds the lock
+func (f *fileRegistry) services() []*registry.Service {
+	return merge(f.loaded, f.registered)
+}
+
+// update applies the change and sends the results to the watchers
+func (f *fileRegistry) update(change func()) {
+	f.Lock()
+	old := f.services()
+	change()
+	results := diff(old, f.services())
+	watchers := make([]*fileWatcher, 0, len(f.watchers))
+	for _, w := range f.watchers {
+		watchers = append(watchers, w)
+	}
+	f.Unlock()
+
+	for _, res := range results {
+		for _, w := range watchers {
+			w.send(res)
+		}
+	}
+}
+
+// reload loads the file again, keeping the services of the last good file on error
+func (f *fileRegistry) reload(path string) {
+	services, err := load(path)
+	if err != nil {
+		log.Errorf("[file] failed to load %s: %v", path, err)
+		return
+	}
+	f.update(func() {
+		f.loaded = services
+	})
+}
+
+// watch loads the file again whenever it changes until the registry is configured
+// again. The directory is watched since editors replace the file rather than write
+// it, and a ConfigMap volume swaps the ..data symlink the file points through
+// without any event for the file itself. Any event which changes what the file
+// resolves to loads it again as well
+func (f *fileRegistry) watch(fsw *fsnotify.Watcher, path, target string, exit chan bool, delay time.Duration) {
+	defer fsw.Close()
+
+	name := filepath.Clean(path)
+	var timer <-chan time.Time
+
+	for {
+		select {
+		case <-exit:
+			return
+		case ev, ok := <-fsw.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(ev.Name) != name {
+				t, _ := filepath.EvalSymlinks(path)
+				if t == target {
+					continue
+				}
+				target = t
+			}
+			// wait for the writes to settle
+			timer = time.After(delay)
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return
+			}
+			log.Errorf("[file] failed to watch %s: %v", path, err)
+		case <-timer:
+			timer = nil
+			f.reload(path)
+		}
+	}
+}
+
+func (f *fileRegistry) Init(opts ...registry.Option) error {
+	return configure(f, opts...)
+}
+
+func (f *fileRegistry) Options() registry.Options {
+	return f.opts
+}
+
+func (f *fileRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	f.update(func() {
+		f.registered = merge(f.registered, []*registry.Service{s})
+	})
+	return nil
+}
+
+func (f *fileRegistry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
+	f.update(func() {
+		f.registered = remove(f.registered, []*registry.Service{s})
+	})
+	return nil
+}
+
+func (f *fileRegistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	f.RLock()
+	defer f.RUnlock()
+
+	var services []*registry.Service
+	for _, s := range f.services() {
+		if s.Name == name && len(s.Nodes) > 0 {
+			services = append(services, s)
+		}
+	}
+	if len(services) == 0 {
+		return nil, registry.ErrNotFound
+	}
+	return services, nil
+}
+
+func (f *fileRegistry) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
+	f.RLock()
+	defer f.RUnlock()
+
+	var services []*registry.Service
+	for _, s := range f.services() {
+		if len(s.Nodes) > 0 {
+			services = append(services, &registry.Service{Name: s.Name, Version: s.Version})
+		}
+	}
+	return services, nil
+}
+
+func (f *fileRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	var wo registry.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	f.nextID++
+	w := &fileWatcher{
+		id:   f.nextID,
+		wo:   wo,
+		next: make(chan *registry.Result, 32),
+		exit: make(chan bool),
+		f:    f,
+	}
+	f.watchers[w.id] = w
+	return w, nil
+}
+
+func (f *fileRegistry) String() string {
+	return "file"
+}
+
+func configure(f *fileRegistry, opts ...registry.Option) error {
+	for _, o := range opts {
+		o(&f.opts)
+	}
+
+	path := DefaultPath
+	if len(f.opts.Addrs) > 0 && len(f.opts.Addrs[0]) > 0 {
+		path = f.opts.Addrs[0]
+	}
+	if p, ok := f.opts.Context.Value(pathKey{}).(string); ok && len(p) > 0 {
+		path = p
+	}
+	delay := DefaultReloadDelay
+	if d, ok := f.opts.Context.Value(reloadDelayKey{}).(time.Duration); ok && d > 0 {
+		delay = d
+	}
+
+	f.Lock()
+	if f.exit != nil {
+		close(f.exit)
+	}
+	f.exit = make(chan bool)
+	exit := f.exit
+	f.Unlock()
+
+	// watch the file regardless, it may be created later
+	if fsw, err := fsnotify.NewWatcher(); err != nil {
+		log.Errorf("[file] %s won't be loaded again on change: %v", path, err)
+	} else if err := fsw.Add(filepath.Dir(path)); err != nil {
+		fsw.Close()
+		log.Errorf("[file] %s won't be loaded again on change: %v", path, err)
+	} else {
+		// resolved before loading the file, a swap in between loads it again
+		target, _ := filepath.EvalSymlinks(path)
+		go f.watch(fsw, path, target, exit, delay)
+	}
+
+	services, err := load(path)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %v", path, err)
+	}
+	f.update(func() {
+		f.loaded = services
+	})
+
+	return nil
+}
+
+// NewRegistry returns a registry serving the services of the file
+func NewRegistry(opts ...registry.Option) registry.Registry {
+	f := &fileRegistry{
+		opts: registry.Options{
+			Context: context.Background(),
+		},
+		watchers: make(map[int]*fileWatcher),
+	}
+
+	if err := configure(f, opts...); err != nil {
+		log.Errorf("[file] %v", err)
+	}
+
+	return f
+}
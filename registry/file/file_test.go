@@ -0,0 +1,232 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+const services = `
+services:
+  - name: greeter
+    version: latest
+    nodes:
+      - id: greeter-1
+        address: 10.0.0.1:8080
+        metadata:
+          zone: a
+      - address: 10.0.0.2:8080
+`
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tempFile(t *testing.T, name, data string) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	writeFile(t, path, data)
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestLoad(t *testing.T) {
+	path, cleanup := tempFile(t, "registry.yaml", services)
+	defer cleanup()
+
+	r := NewRegistry(Path(path))
+
+	s, err := r.GetService("greeter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s) != 1 || len(s[0].Nodes) != 2 {
+		t.Fatalf("expected 2 nodes, got %+v", s)
+	}
+	if n := s[0].Nodes[0]; n.Id != "greeter-1" || n.Metadata["zone"] != "a" {
+		t.Fatalf("unexpected node %+v", n)
+	}
+	if n := s[0].Nodes[1]; n.Id != "greeter-10.0.0.2:8080" {
+		t.Fatalf("expected the address to identify the node, got %+v", n)
+	}
+
+	if _, err := r.GetService("missing"); err != registry.ErrNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	// json is loaded as well
+	json, cleanup := tempFile(t, "registry.json", `{"services": [{"name": "foo", "nodes": [{"id": "foo-1", "address": "10.0.0.3:8080"}]}]}`)
+	defer cleanup()
+
+	if err := r.Init(registry.Addrs(json), Path("")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.GetService("foo"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	path, cleanup := tempFile(t, "registry.yaml", services)
+	defer cleanup()
+
+	r := NewRegistry(Path(path))
+
+	local := &registry.Service{
+		Name:    "greeter",
+		Version: "latest",
+		Nodes:   []*registry.Node{{Id: "greeter-3", Address: "127.0.0.1:8080"}},
+	}
+	if err := r.Register(local); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := r.GetService("greeter"); len(s[0].Nodes) != 3 {
+		t.Fatalf("expected the registered node on top of the file, got %+v", s[0].Nodes)
+	}
+
+	// services of the same version are kept apart
+	billing := &registry.Service{
+		Name:    "billing",
+		Version: "latest",
+		Nodes:   []*registry.Node{{Id: "billing-1", Address: "127.0.0.1:8081"}},
+	}
+	if err := r.Register(billing); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := r.GetService("billing"); err != nil || len(s[0].Nodes) != 1 {
+		t.Fatalf("expected the billing node, got %+v %v", s, err)
+	}
+
+	if err := r.Deregister(local); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := r.GetService("greeter"); len(s[0].Nodes) != 2 {
+		t.Fatalf("expected the nodes of the file, got %+v", s[0].Nodes)
+	}
+	if s, err := r.GetService("billing"); err != nil || len(s[0].Nodes) != 1 {
+		t.Fatalf("expected the billing node to be kept, got %+v %v", s, err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path, cleanup := tempFile(t, "registry.yaml", services)
+	defer cleanup()
+
+	r := NewRegistry(Path(path), ReloadDelay(10*time.Millisecond))
+
+	w, err := r.Watch(registry.WatchService("greeter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// greeter-1 moves, the second node is removed
+	writeFile(t, path, `
+services:
+  - name: greeter
+    version: latest
+    nodes:
+      - id: greeter-1
+        address: 10.0.0.4:8080
+`)
+
+	actions := make(map[string]string)
+	results := make(chan *registry.Result)
+	go func() {
+		for {
+			res, err := w.Next()
+			if err != nil {
+				return
+			}
+			results <- res
+		}
+	}()
+
+	for len(actions) < 2 {
+		select {
+		case res := <-results:
+			actions[res.Service.Nodes[0].Id] = res.Action
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected the file to be loaded again, got %v", actions)
+		}
+	}
+	if actions["greeter-1"] != "update" || actions["greeter-10.0.0.2:8080"] != "delete" {
+		t.Fatalf("unexpected results %v", actions)
+	}
+
+	s, err := r.GetService("greeter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s[0].Nodes) != 1 || s[0].Nodes[0].Address != "10.0.0.4:8080" {
+		t.Fatalf("expected the node of the new file, got %+v", s[0].Nodes)
+	}
+}
+
+func TestWatchConfigMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the layout of a ConfigMap volume, the file points through the ..data symlink
+	// to the directory of the current version
+	mkdir := func(version, data string) {
+		if err := os.Mkdir(filepath.Join(dir, version), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, filepath.Join(dir, version, "registry.yaml"), data)
+	}
+	mkdir("..v1", services)
+	if err := os.Symlink("..v1", filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "registry.yaml")
+	if err := os.Symlink(filepath.Join("..data", "registry.yaml"), path); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRegistry(Path(path), ReloadDelay(10*time.Millisecond))
+
+	// kubelet writes the new version and swaps the symlink
+	mkdir("..v2", `
+services:
+  - name: greeter
+    version: latest
+    nodes:
+      - id: greeter-1
+        address: 10.0.0.4:8080
+`)
+	if err := os.Symlink("..v2", filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(dir, "..v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s, err := r.GetService("greeter")
+		if err == nil && len(s[0].Nodes) == 1 && s[0].Nodes[0].Address == "10.0.0.4:8080" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the new version to be loaded, got %+v", s)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,9 @@
+module github.com/micro/go-plugins/registry/file/v2
+
+go 1.13
+
+require (
+	github.com/fsnotify/fsnotify v1.4.7
+	github.com/ghodss/yaml v1.0.0
+	github.com/micro/go-micro/v2 v2.9.1
+)
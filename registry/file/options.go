@@ -0,0 +1,32 @@
+package file
+
+import (
+	"context"
+	"time"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+type pathKey struct{}
+type reloadDelayKey struct{}
+
+func setOption(k, v interface{}) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// Path sets the file the services are loaded from, by default the first registry
+// address or DefaultPath
+func Path(p string) registry.Option {
+	return setOption(pathKey{}, p)
+}
+
+// ReloadDelay sets how long to wait for writes to the file to settle before it's
+// loaded again, DefaultReloadDelay by default
+func ReloadDelay(d time.Duration) registry.Option {
+	return setOption(reloadDelayKey{}, d)
+}
@@ -0,0 +1,50 @@
+package file
+
+import (
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+type fileWatcher struct {
+	id   int
+	wo   registry.WatchOptions
+	next chan *registry.Result
+	exit chan bool
+	f    *fileRegistry
+}
+
+// send queues the result unless the watcher is stopped or too far behind
+func (w *fileWatcher) send(res *registry.Result) {
+	if len(w.wo.Service) > 0 && res.Service.Name != w.wo.Service {
+		return
+	}
+
+	select {
+	case w.next <- res:
+	case <-w.exit:
+	default:
+		log.Warnf("[file] dropped the %s result of %s, the watcher is too far behind", res.Action, res.Service.Name)
+	}
+}
+
+func (w *fileWatcher) Next() (*registry.Result, error) {
+	select {
+	case r := <-w.next:
+		return r, nil
+	case <-w.exit:
+		return nil, registry.ErrWatcherStopped
+	}
+}
+
+func (w *fileWatcher) Stop() {
+	select {
+	case <-w.exit:
+		return
+	default:
+		close(w.exit)
+		// remove self from the registry
+		w.f.Lock()
+		delete(w.f.watchers, w.id)
+		w.f.Unlock()
+	}
+}
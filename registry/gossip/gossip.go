@@ -106,6 +106,7 @@ type gossipRegistry struct {
 
 	connectRetry   bool
 	connectTimeout time.Duration
+	retryInterval  time.Duration
 	sync.RWMutex
 	services map[string][]*registry.Service
 
@@ -115,6 +116,7 @@ type gossipRegistry struct {
 	addrs   []string
 	members map[string]int32
 	done    chan bool
+	keyring *memberlist.Keyring
 }
 
 type update struct {
@@ -133,8 +135,33 @@ var (
 	DefaultSecret = []byte("micro-gossip-key") // exactly 16 bytes
 	ExpiryTick    = time.Second * 1            // needs to be smaller than registry.RegisterTTL
 	MaxPacketSize = 512
+	// DefaultRetryInterval is the default interval between attempts to join members
+	DefaultRetryInterval = time.Second * 1
 )
 
+// newConfig returns the memberlist config of the profile with sane defaults
+func newConfig(profile string) (*memberlist.Config, error) {
+	var c *memberlist.Config
+
+	switch profile {
+	case "", "local":
+		c = memberlist.DefaultLocalConfig()
+	case "lan":
+		c = memberlist.DefaultLANConfig()
+	case "wan":
+		c = memberlist.DefaultWANConfig()
+	default:
+		return nil, fmt.Errorf("[gossip] Registry unknown profile %s", profile)
+	}
+
+	// sane good default options
+	c.LogOutput = ioutil.Discard // log to /dev/null
+	c.PushPullInterval = 0       // disable expensive tcp push/pull
+	c.ProtocolVersion = 4        // suport latest stable features
+
+	return c, nil
+}
+
 func configure(g *gossipRegistry, opts ...registry.Option) error {
 	// loop through address list and get valid entries
 	addrs := func(curAddrs []string) []string {
@@ -163,6 +190,27 @@ func configure(g *gossipRegistry, opts ...registry.Option) error {
 		return nil
 	}
 
+	// create a new default config
+	profile, _ := g.options.Context.Value(profileKey{}).(string)
+	c, err := newConfig(profile)
+	if err != nil {
+		return err
+	}
+
+	// create the keyring if secure
+	var keyring *memberlist.Keyring
+	if g.options.Secure {
+		k, ok := g.options.Context.Value(secretKey{}).([]byte)
+		if !ok {
+			// use the default secret
+			k = DefaultSecret
+		}
+		keys, _ := g.options.Context.Value(secretKeysKey{}).([][]byte)
+		if keyring, err = memberlist.NewKeyring(keys, k); err != nil {
+			return err
+		}
+	}
+
 	// shutdown old member
 	g.Stop()
 
@@ -175,14 +223,6 @@ func configure(g *gossipRegistry, opts ...registry.Option) error {
 	// replace addresses
 	curAddrs = newAddrs
 
-	// create a new default config
-	c := memberlist.DefaultLocalConfig()
-
-	// sane good default options
-	c.LogOutput = ioutil.Discard // log to /dev/null
-	c.PushPullInterval = 0       // disable expensive tcp push/pull
-	c.ProtocolVersion = 4        // suport latest stable features
-
 	// set config from options
 	if config, ok := g.options.Context.Value(configKey{}).(*memberlist.Config); ok && config != nil {
 		c = config
@@ -212,6 +252,10 @@ func configure(g *gossipRegistry, opts ...registry.Option) error {
 				c.AdvertisePort = p
 			}
 			c.AdvertiseAddr = host
+		} else if len(advertise) > 0 {
+			// advertise the bind port
+			c.AdvertiseAddr = advertise
+			c.AdvertisePort = c.BindPort
 		}
 	}
 
@@ -221,15 +265,12 @@ func configure(g *gossipRegistry, opts ...registry.Option) error {
 	// set the name
 	c.Name = strings.Join([]string{"micro", hostname, uuid.New().String()}, "-")
 
-	// set a secret key if secure
-	if g.options.Secure {
-		k, ok := g.options.Context.Value(secretKey{}).([]byte)
-		if !ok {
-			// use the default secret
-			k = DefaultSecret
-		}
-		c.SecretKey = k
+	// set the keyring if secure
+	if keyring != nil {
+		c.SecretKey = nil
+		c.Keyring = keyring
 	}
+	g.keyring = keyring
 
 	// set connect retry
 	if v, ok := g.options.Context.Value(connectRetryKey{}).(bool); ok && v {
@@ -241,6 +282,11 @@ func configure(g *gossipRegistry, opts ...registry.Option) error {
 		g.connectTimeout = td
 	}
 
+	// set connect retry interval
+	if td, ok := g.options.Context.Value(connectRetryIntervalKey{}).(time.Duration); ok && td > 0 {
+		g.retryInterval = td
+	}
+
 	// create a queue
 	queue := &memberlist.TransmitLimitedQueue{
 		NumNodes: func() int {
@@ -263,6 +309,7 @@ func configure(g *gossipRegistry, opts ...registry.Option) error {
 	// create the memberlist
 	m, err := memberlist.Create(c)
 	if err != nil {
+		g.Unlock()
 		return err
 	}
 
@@ -280,6 +327,15 @@ func configure(g *gossipRegistry, opts ...registry.Option) error {
 
 	g.Unlock()
 
+	// start the wan gateway
+	if addr, ok := g.options.Context.Value(gatewayKey{}).(string); ok && len(addr) > 0 {
+		w, err := newWAN(g, addr)
+		if err != nil {
+			return err
+		}
+		go w.run(g.done)
+	}
+
 	log.Infof("[gossip] Registry Listening on %s", m.LocalNode().Address())
 
 	// try connect
@@ -410,7 +466,11 @@ func (g *gossipRegistry) connect(addrs []string) error {
 		timeout = time.After(g.connectTimeout)
 	}
 
-	ticker := time.NewTicker(1 * time.Second)
+	g.RLock()
+	interval := g.retryInterval
+	g.RUnlock()
+
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	fn := func() (int, error) {
@@ -500,8 +560,11 @@ func (g *gossipRegistry) Stop() error {
 
 // connectLoop attempts to reconnect to the memberlist
 func (g *gossipRegistry) connectLoop() {
-	// try every second
-	ticker := time.NewTicker(1 * time.Second)
+	g.RLock()
+	interval := g.retryInterval
+	g.RUnlock()
+
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
@@ -833,12 +896,13 @@ func NewRegistry(opts ...registry.Option) registry.Registry {
 		options: registry.Options{
 			Context: context.Background(),
 		},
-		done:     make(chan bool),
-		events:   make(chan *event, 100),
-		updates:  make(chan *update, 100),
-		services: make(map[string][]*registry.Service),
-		watchers: make(map[string]chan *registry.Result),
-		members:  make(map[string]int32),
+		done:          make(chan bool),
+		events:        make(chan *event, 100),
+		retryInterval: DefaultRetryInterval,
+		updates:       make(chan *update, 100),
+		services:      make(map[string][]*registry.Service),
+		watchers:      make(map[string]chan *registry.Result),
+		members:       make(map[string]int32),
 	}
 	// run the updater
 	go g.run()
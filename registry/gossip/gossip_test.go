@@ -1,6 +1,8 @@
 package gossip
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"os"
 	"sync"
 	"testing"
@@ -214,3 +216,118 @@ func TestGossipRegistryRetry(t *testing.T) {
 	r1.(*gossipRegistry).Stop()
 	r2.(*gossipRegistry).Stop()
 }
+
+func TestGossipWANState(t *testing.T) {
+	g := &gossipRegistry{
+		services: map[string][]*registry.Service{
+			"service.1": {{
+				Name: "service.1",
+				Nodes: []*registry.Node{
+					{Id: "1", Address: "10.0.0.1:8080"},
+					{Id: "2", Address: "10.1.0.1:8080", Metadata: map[string]string{SiteKey: "eu"}},
+				},
+			}},
+			"service.2": {{
+				Name: "service.2",
+				Nodes: []*registry.Node{
+					{Id: "3", Address: "10.1.0.2:8080", Metadata: map[string]string{SiteKey: "eu"}},
+				},
+			}},
+		},
+	}
+
+	block, err := aes.NewCipher(DefaultSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &wan{g: g, site: "us", aead: aead, interval: time.Second}
+
+	b, err := w.encode(w.state())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := w.decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if st.Site != "us" {
+		t.Fatalf("expected site us, got %s", st.Site)
+	}
+	// nodes imported from other sites must not be exported
+	if len(st.Services) != 1 || len(st.Services[0].Nodes) != 1 || st.Services[0].Nodes[0].Id != "1" {
+		t.Fatalf("unexpected state %+v", st.Services)
+	}
+
+	// tampered syncs must be rejected
+	b[len(b)-1] ^= 0xff
+	if _, err := w.decode(b); err == nil {
+		t.Fatal("expected tampered state sync to fail")
+	}
+}
+
+func TestGossipProfile(t *testing.T) {
+	c, err := newConfig("wan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wan := memberlist.DefaultWANConfig(); c.ProbeTimeout != wan.ProbeTimeout || c.PushPullInterval != 0 {
+		t.Fatalf("expected the wan config with push/pull disabled, got %+v", c)
+	}
+	if _, err := newConfig("moon"); err == nil {
+		t.Fatal("expected unknown profiles to fail")
+	}
+}
+
+func TestGossipKeyRotation(t *testing.T) {
+	if tr := os.Getenv("TRAVIS"); len(tr) > 0 {
+		t.Skip()
+	}
+
+	k1 := []byte("0123456789abcdef")
+	k2 := []byte("fedcba9876543210")
+	k3 := []byte("0123456789abcdef01234567")
+
+	r := newRegistry(registry.Secure(true), Secret(k1), SecretKeys(k2), Profile("lan"))
+	defer r.(*gossipRegistry).Stop()
+
+	keys, err := Keys(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || string(keys[0]) != string(k1) {
+		t.Fatalf("expected the secret as primary key of 2 keys, got %q", keys)
+	}
+
+	if err := InstallKey(r, k3); err != nil {
+		t.Fatal(err)
+	}
+	if err := UseKey(r, k3); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveKey(r, k1); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveKey(r, k3); err == nil {
+		t.Fatal("expected the primary key not to be removable")
+	}
+
+	keys, err = Keys(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || string(keys[0]) != string(k3) {
+		t.Fatalf("expected the new primary key of 2 keys, got %q", keys)
+	}
+
+	insecure := newRegistry()
+	defer insecure.(*gossipRegistry).Stop()
+	if _, err := Keys(insecure); err == nil {
+		t.Fatal("expected keys of an insecure registry to fail")
+	}
+}
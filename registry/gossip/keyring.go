@@ -0,0 +1,67 @@
+package gossip
+
+import (
+	"errors"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/micro/go-micro/v2/registry"
+)
+
+/*
+	Rotating the secret of a running cluster takes three steps, each done on every
+	member before the next: install the new key, use it as the primary key for
+	encryption, then remove the old key. Members accept messages encrypted with any
+	installed key, so the cluster keeps working throughout.
+*/
+
+// InstallKey adds a key to the keyring of a secure gossip registry, it's accepted
+// for decryption but not used for encryption
+func InstallKey(r registry.Registry, key []byte) error {
+	k, err := keyring(r)
+	if err != nil {
+		return err
+	}
+	return k.AddKey(key)
+}
+
+// UseKey makes an installed key the primary key used for encryption
+func UseKey(r registry.Registry, key []byte) error {
+	k, err := keyring(r)
+	if err != nil {
+		return err
+	}
+	return k.UseKey(key)
+}
+
+// RemoveKey removes a key from the keyring, the primary key can't be removed
+func RemoveKey(r registry.Registry, key []byte) error {
+	k, err := keyring(r)
+	if err != nil {
+		return err
+	}
+	return k.RemoveKey(key)
+}
+
+// Keys returns the installed keys, the primary key first
+func Keys(r registry.Registry) ([][]byte, error) {
+	k, err := keyring(r)
+	if err != nil {
+		return nil, err
+	}
+	return k.GetKeys(), nil
+}
+
+func keyring(r registry.Registry) (*memberlist.Keyring, error) {
+	g, ok := r.(*gossipRegistry)
+	if !ok {
+		return nil, errors.New("[gossip] Registry is not a gossip registry")
+	}
+
+	g.RLock()
+	defer g.RUnlock()
+
+	if g.keyring == nil {
+		return nil, errors.New("[gossip] Registry is not secure")
+	}
+	return g.keyring, nil
+}
@@ -14,6 +14,9 @@ type configKey struct{}
 type advertiseKey struct{}
 type connectTimeoutKey struct{}
 type connectRetryKey struct{}
+type connectRetryIntervalKey struct{}
+type secretKeysKey struct{}
+type profileKey struct{}
 
 // helper for setting registry options
 func setRegistryOption(k, v interface{}) registry.Option {
@@ -31,6 +34,12 @@ func Secret(k []byte) registry.Option {
 	return setRegistryOption(secretKey{}, k)
 }
 
+// SecretKeys specifies keys accepted for decryption next to the Secret, which is
+// used for encryption. Use them to rotate the secret of a running cluster
+func SecretKeys(keys ...[]byte) registry.Option {
+	return setRegistryOption(secretKeysKey{}, keys)
+}
+
 // Address to bind to - host:port
 func Address(a string) registry.Option {
 	return setRegistryOption(addressKey{}, a)
@@ -41,7 +50,8 @@ func Config(c *memberlist.Config) registry.Option {
 	return setRegistryOption(configKey{}, c)
 }
 
-// The address to advertise for other gossip members to connect to - host:port
+// The address to advertise for other gossip members to connect to - host:port or
+// host to advertise the bind port
 func Advertise(a string) registry.Option {
 	return setRegistryOption(advertiseKey{}, a)
 }
@@ -56,3 +66,48 @@ func ConnectTimeout(td time.Duration) registry.Option {
 func ConnectRetry(v bool) registry.Option {
 	return setRegistryOption(connectRetryKey{}, v)
 }
+
+// ConnectRetryInterval sets how often joining members is retried, every second by default
+func ConnectRetryInterval(td time.Duration) registry.Option {
+	return setRegistryOption(connectRetryIntervalKey{}, td)
+}
+
+// Profile selects the memberlist defaults the config is based on, "local" by default.
+// Use "lan" for a data center and "wan" for members spanning data centers, which
+// tolerates higher latency at the cost of slower failure detection. Ignored with Config
+func Profile(p string) registry.Option {
+	return setRegistryOption(profileKey{}, p)
+}
+
+type gatewayKey struct{}
+type gatewayPeersKey struct{}
+type siteKey struct{}
+type syncIntervalKey struct{}
+type wanSecretKey struct{}
+
+// Gateway makes the node a WAN gateway for its site, accepting state syncs
+// from the gateways of other sites on the address - host:port
+func Gateway(a string) registry.Option {
+	return setRegistryOption(gatewayKey{}, a)
+}
+
+// GatewayPeers are the gateways of other sites to sync state with - host:port
+func GatewayPeers(addrs ...string) registry.Option {
+	return setRegistryOption(gatewayPeersKey{}, addrs)
+}
+
+// Site names the cluster the node belongs to. Required for gateways
+func Site(name string) registry.Option {
+	return setRegistryOption(siteKey{}, name)
+}
+
+// SyncInterval sets how often gateways sync state with their peers
+func SyncInterval(td time.Duration) registry.Option {
+	return setRegistryOption(syncIntervalKey{}, td)
+}
+
+// WANSecret specifies the key encrypting state syncs between gateways. The value
+// should be either 16, 24, or 32 bytes. Defaults to the Secret or DefaultSecret
+func WANSecret(k []byte) registry.Option {
+	return setRegistryOption(wanSecretKey{}, k)
+}
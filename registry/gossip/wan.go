@@ -0,0 +1,332 @@
+package gossip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"time"
+
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/registry"
+	pb "github.com/micro/go-plugins/registry/gossip/v2/proto"
+)
+
+/*
+	WAN federation lets separate gossip clusters, one per site, see each others
+	services without a central registry. A designated gateway in each site
+	periodically pushes the services of its site to the gateways of other sites
+	and pulls theirs in return. Syncs are full state, gzip compressed and sealed
+	with AES-GCM. Imported services are broadcast to the local cluster with an
+	expiry of a few sync intervals, so they disappear once a site is unreachable.
+
+	Nodes imported from another site are tagged with SiteKey in their metadata
+	and never exported again, which prevents state bouncing between sites.
+*/
+
+var (
+	// SiteKey is the node metadata key holding the site a node was imported from
+	SiteKey = "gossip.site"
+	// DefaultSyncInterval is the default interval between WAN state syncs
+	DefaultSyncInterval = time.Second * 30
+	// MaxSyncSize is the max size of a WAN state sync
+	MaxSyncSize = 64 << 20
+)
+
+type wanState struct {
+	Site     string              `json:"site"`
+	Services []*registry.Service `json:"services"`
+}
+
+type wan struct {
+	g        *gossipRegistry
+	site     string
+	peers    []string
+	interval time.Duration
+	aead     cipher.AEAD
+	listener net.Listener
+}
+
+func newWAN(g *gossipRegistry, addr string) (*wan, error) {
+	ctx := g.options.Context
+
+	site, _ := ctx.Value(siteKey{}).(string)
+	if len(site) == 0 {
+		return nil, errors.New("[gossip] Registry gateway requires a site")
+	}
+
+	k, ok := ctx.Value(wanSecretKey{}).([]byte)
+	if !ok {
+		if k, ok = ctx.Value(secretKey{}).([]byte); !ok {
+			k = DefaultSecret
+		}
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := DefaultSyncInterval
+	if td, ok := ctx.Value(syncIntervalKey{}).(time.Duration); ok && td > 0 {
+		interval = td
+	}
+
+	peers, _ := ctx.Value(gatewayPeersKey{}).([]string)
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wan{
+		g:        g,
+		site:     site,
+		peers:    peers,
+		interval: interval,
+		aead:     aead,
+		listener: l,
+	}, nil
+}
+
+// state returns the services of the local site
+func (w *wan) state() *wanState {
+	st := &wanState{Site: w.site}
+
+	w.g.RLock()
+	defer w.g.RUnlock()
+
+	for _, services := range w.g.services {
+		for _, service := range services {
+			var nodes []*registry.Node
+			for _, node := range service.Nodes {
+				if site, ok := node.Metadata[SiteKey]; ok && site != w.site {
+					continue
+				}
+				nodes = append(nodes, node)
+			}
+			if len(nodes) == 0 {
+				continue
+			}
+			srv := *service
+			srv.Nodes = nodes
+			st.Services = append(st.Services, &srv)
+		}
+	}
+
+	return st
+}
+
+// merge imports the services of a remote site
+func (w *wan) merge(st *wanState) {
+	if st.Site == w.site {
+		return
+	}
+
+	expires := uint64(time.Now().Add(w.interval * 3).UnixNano())
+
+	for _, service := range st.Services {
+		srv := *service
+		srv.Nodes = make([]*registry.Node, 0, len(service.Nodes))
+		for _, node := range service.Nodes {
+			n := *node
+			n.Metadata = make(map[string]string, len(node.Metadata)+1)
+			for k, v := range node.Metadata {
+				n.Metadata[k] = v
+			}
+			n.Metadata[SiteKey] = st.Site
+			srv.Nodes = append(srv.Nodes, &n)
+		}
+
+		b, err := json.Marshal(&srv)
+		if err != nil {
+			continue
+		}
+
+		up := &pb.Update{
+			Expires: expires,
+			Action:  actionTypeCreate,
+			Type:    updateTypeService,
+			Metadata: map[string]string{
+				"Content-Type": "application/json",
+			},
+			Data: b,
+		}
+
+		// share with the local cluster
+		w.g.RLock()
+		if w.g.queue != nil {
+			w.g.queue.QueueBroadcast(&broadcast{update: up})
+		}
+		w.g.RUnlock()
+
+		w.g.updates <- &update{
+			Update:  up,
+			Service: &srv,
+		}
+	}
+}
+
+// encode compresses and seals the state
+func (w *wan) encode(st *wanState) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(st); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, w.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return w.aead.Seal(nonce, nonce, buf.Bytes(), nil), nil
+}
+
+// decode opens and decompresses the state
+func (w *wan) decode(b []byte) (*wanState, error) {
+	ns := w.aead.NonceSize()
+	if len(b) < ns {
+		return nil, errors.New("[gossip] Registry state sync too short")
+	}
+	data, err := w.aead.Open(nil, b[:ns], b[ns:], nil)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	data, err = ioutil.ReadAll(io.LimitReader(zr, int64(MaxSyncSize)))
+	if err != nil {
+		return nil, err
+	}
+
+	st := new(wanState)
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func (w *wan) write(conn net.Conn) error {
+	b, err := w.encode(w.state())
+	if err != nil {
+		return err
+	}
+	if len(b) > MaxSyncSize {
+		return fmt.Errorf("[gossip] Registry state sync size %d bigger than MaxSyncSize %d", len(b), MaxSyncSize)
+	}
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(b)))
+	if _, err := conn.Write(size); err != nil {
+		return err
+	}
+	_, err = conn.Write(b)
+	return err
+}
+
+func (w *wan) read(conn net.Conn) error {
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(conn, size); err != nil {
+		return err
+	}
+	l := binary.BigEndian.Uint32(size)
+	if l > uint32(MaxSyncSize) {
+		return fmt.Errorf("[gossip] Registry state sync size %d bigger than MaxSyncSize %d", l, MaxSyncSize)
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(conn, b); err != nil {
+		return err
+	}
+	st, err := w.decode(b)
+	if err != nil {
+		return err
+	}
+	w.merge(st)
+	return nil
+}
+
+// sync pushes the local state to a peer and pulls its state
+func (w *wan) sync(peer string) error {
+	conn, err := net.DialTimeout("tcp", peer, w.interval)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(w.interval))
+
+	if err := w.write(conn); err != nil {
+		return err
+	}
+	return w.read(conn)
+}
+
+func (w *wan) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(w.interval))
+
+	if err := w.read(conn); err != nil {
+		log.Debugf("[gossip] Registry state sync from %s failed: %v", conn.RemoteAddr(), err)
+		return
+	}
+	if err := w.write(conn); err != nil {
+		log.Debugf("[gossip] Registry state sync to %s failed: %v", conn.RemoteAddr(), err)
+	}
+}
+
+func (w *wan) serve() {
+	for {
+		conn, err := w.listener.Accept()
+		if err != nil {
+			return
+		}
+		go w.handle(conn)
+	}
+}
+
+func (w *wan) syncLoop(done chan bool) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, peer := range w.peers {
+			if err := w.sync(peer); err != nil {
+				log.Debugf("[gossip] Registry state sync with %s failed: %v", peer, err)
+			}
+		}
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run serves and syncs state until done is closed
+func (w *wan) run(done chan bool) {
+	log.Infof("[gossip] Registry gateway for site %s listening on %s", w.site, w.listener.Addr())
+
+	go w.serve()
+	go w.syncLoop(done)
+
+	<-done
+	w.listener.Close()
+}
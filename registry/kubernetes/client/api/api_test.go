@@ -49,6 +49,20 @@ var tests = []testcase{
 		Method: "GET",
 		URI:    "/api/v1/namespaces/default/pods/?labelSelector=foo%3Dbar",
 	},
+	testcase{
+		ReqFn: func(opts *Options) *Request {
+			return NewRequest(opts).Get().API("apis/discovery.k8s.io/v1").Namespace("test").Resource("endpointslices")
+		},
+		Method: "GET",
+		URI:    "/apis/discovery.k8s.io/v1/namespaces/test/endpointslices/",
+	},
+	testcase{
+		ReqFn: func(opts *Options) *Request {
+			return NewRequest(opts).Get().Cluster().Resource("nodes").Name("node-1")
+		},
+		Method: "GET",
+		URI:    "/api/v1/nodes/node-1",
+	},
 	testcase{
 		ReqFn: func(opts *Options) *Request {
 			return NewRequest(opts).Post().Resource("services").Name("foo").Body(map[string]string{"foo": "bar"})
@@ -18,7 +18,10 @@ type Request struct {
 	params    url.Values
 	method    string
 	host      string
+	api       string
 	namespace string
+	// cluster scoped resources don't belong to a namespace
+	cluster bool
 
 	resource     string
 	resourceName *string
@@ -66,12 +69,26 @@ func (r *Request) Delete() *Request {
 	return r.verb("DELETE")
 }
 
+// API sets the path of the API group the resource belongs
+// to, such as "apis/discovery.k8s.io/v1". By default "api/v1"
+func (r *Request) API(s string) *Request {
+	r.api = s
+	return r
+}
+
 // Namespace is to set the namespace to operate on
 func (r *Request) Namespace(s string) *Request {
 	r.namespace = s
 	return r
 }
 
+// Cluster is to operate on a cluster scoped resource
+// such as "nodes", which doesn't belong to a namespace
+func (r *Request) Cluster() *Request {
+	r.cluster = true
+	return r
+}
+
 // Resource is the type of resource the operation is
 // for, such as "services", "endpoints" or "pods"
 func (r *Request) Resource(s string) *Request {
@@ -122,7 +139,10 @@ func (r *Request) SetHeader(key, value string) *Request {
 
 // request builds the http.Request from the options
 func (r *Request) request() (*http.Request, error) {
-	url := fmt.Sprintf("%s/api/v1/namespaces/%s/%s/", r.host, r.namespace, r.resource)
+	url := fmt.Sprintf("%s/%s/namespaces/%s/%s/", r.host, r.api, r.namespace, r.resource)
+	if r.cluster {
+		url = fmt.Sprintf("%s/%s/%s/", r.host, r.api, r.resource)
+	}
 
 	// append resourceName if it is present
 	if r.resourceName != nil {
@@ -203,6 +223,7 @@ func NewRequest(opts *Options) *Request {
 		header:    make(http.Header),
 		params:    make(url.Values),
 		client:    opts.Client,
+		api:       "api/v1",
 		namespace: opts.Namespace,
 		host:      opts.Host,
 	}
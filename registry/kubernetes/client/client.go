@@ -16,6 +16,9 @@ import (
 var (
 	serviceAccountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
 
+	// discoveryAPI is the API group of endpoint slices
+	discoveryAPI = "apis/discovery.k8s.io/v1"
+
 	ErrReadNamespace = errors.New("Could not read namespace from service account secret")
 )
 
@@ -24,10 +27,14 @@ type client struct {
 	opts *api.Options
 }
 
-// ListPods ...
-func (c *client) ListPods(labels map[string]string) (*PodList, error) {
+// ListPods lists the pods in the namespace, the namespace of the client when empty
+func (c *client) ListPods(namespace string, labels map[string]string) (*PodList, error) {
 	var pods PodList
-	err := api.NewRequest(c.opts).Get().Resource("pods").Params(&api.Params{LabelSelector: labels}).Do().Into(&pods)
+	req := api.NewRequest(c.opts).Get().Resource("pods")
+	if len(namespace) > 0 {
+		req = req.Namespace(namespace)
+	}
+	err := req.Params(&api.Params{LabelSelector: labels}).Do().Into(&pods)
 	return &pods, err
 }
 
@@ -38,9 +45,42 @@ func (c *client) UpdatePod(name string, p *Pod) (*Pod, error) {
 	return &pod, err
 }
 
-// WatchPods ...
-func (c *client) WatchPods(labels map[string]string) (watch.Watch, error) {
-	return api.NewRequest(c.opts).Get().Resource("pods").Params(&api.Params{LabelSelector: labels}).Watch()
+// WatchPods watches the pods in the namespace, the namespace of the client when empty
+func (c *client) WatchPods(namespace string, labels map[string]string) (watch.Watch, error) {
+	req := api.NewRequest(c.opts).Get().Resource("pods")
+	if len(namespace) > 0 {
+		req = req.Namespace(namespace)
+	}
+	return req.Params(&api.Params{LabelSelector: labels}).Watch()
+}
+
+// ListEndpointSlices lists the endpoint slices in the namespace, the namespace of
+// the client when empty
+func (c *client) ListEndpointSlices(namespace string, labels map[string]string) (*EndpointSliceList, error) {
+	var slices EndpointSliceList
+	req := api.NewRequest(c.opts).Get().API(discoveryAPI).Resource("endpointslices")
+	if len(namespace) > 0 {
+		req = req.Namespace(namespace)
+	}
+	err := req.Params(&api.Params{LabelSelector: labels}).Do().Into(&slices)
+	return &slices, err
+}
+
+// WatchEndpointSlices watches the endpoint slices in the namespace, the namespace
+// of the client when empty
+func (c *client) WatchEndpointSlices(namespace string, labels map[string]string) (watch.Watch, error) {
+	req := api.NewRequest(c.opts).Get().API(discoveryAPI).Resource("endpointslices")
+	if len(namespace) > 0 {
+		req = req.Namespace(namespace)
+	}
+	return req.Params(&api.Params{LabelSelector: labels}).Watch()
+}
+
+// GetNode returns the kubernetes node, reading nodes requires a cluster role
+func (c *client) GetNode(name string) (*Node, error) {
+	var node Node
+	err := api.NewRequest(c.opts).Get().Cluster().Resource("nodes").Name(name).Do().Into(&node)
+	return &node, err
 }
 
 func detectNamespace() (string, error) {
@@ -4,9 +4,17 @@ import "github.com/micro/go-plugins/registry/kubernetes/v2/client/watch"
 
 // Kubernetes ...
 type Kubernetes interface {
-	ListPods(labels map[string]string) (*PodList, error)
+	ListPods(namespace string, labels map[string]string) (*PodList, error)
 	UpdatePod(podName string, pod *Pod) (*Pod, error)
-	WatchPods(labels map[string]string) (watch.Watch, error)
+	WatchPods(namespace string, labels map[string]string) (watch.Watch, error)
+	ListEndpointSlices(namespace string, labels map[string]string) (*EndpointSliceList, error)
+	WatchEndpointSlices(namespace string, labels map[string]string) (watch.Watch, error)
+	GetNode(name string) (*Node, error)
+}
+
+// Node is a kubernetes node, its labels hold its topology
+type Node struct {
+	Metadata *Meta `json:"metadata"`
 }
 
 // PodList ...
@@ -17,18 +25,74 @@ type PodList struct {
 // Pod is the top level item for a pod
 type Pod struct {
 	Metadata *Meta   `json:"metadata"`
+	Spec     *Spec   `json:"spec,omitempty"`
 	Status   *Status `json:"status"`
 }
 
+// Spec ...
+type Spec struct {
+	NodeName string `json:"nodeName,omitempty"`
+}
+
 // Meta ...
 type Meta struct {
 	Name        string             `json:"name,omitempty"`
+	Namespace   string             `json:"namespace,omitempty"`
 	Labels      map[string]*string `json:"labels,omitempty"`
 	Annotations map[string]*string `json:"annotations,omitempty"`
 }
 
 // Status ...
 type Status struct {
-	PodIP string `json:"podIP"`
-	Phase string `json:"phase"`
+	PodIP      string         `json:"podIP"`
+	Phase      string         `json:"phase"`
+	Conditions []PodCondition `json:"conditions,omitempty"`
+}
+
+// PodCondition ...
+type PodCondition struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+// EndpointSliceList ...
+type EndpointSliceList struct {
+	Items []EndpointSlice `json:"items"`
+}
+
+// EndpointSlice holds endpoints of a service, see discovery.k8s.io/v1
+type EndpointSlice struct {
+	Metadata    *Meta          `json:"metadata"`
+	AddressType string         `json:"addressType"`
+	Endpoints   []Endpoint     `json:"endpoints"`
+	Ports       []EndpointPort `json:"ports"`
+}
+
+// Endpoint ...
+type Endpoint struct {
+	Addresses  []string           `json:"addresses"`
+	Conditions EndpointConditions `json:"conditions"`
+	TargetRef  *ObjectReference   `json:"targetRef,omitempty"`
+	NodeName   *string            `json:"nodeName,omitempty"`
+	Zone       *string            `json:"zone,omitempty"`
+}
+
+// EndpointConditions ...
+type EndpointConditions struct {
+	Ready       *bool `json:"ready,omitempty"`
+	Terminating *bool `json:"terminating,omitempty"`
+}
+
+// ObjectReference ...
+type ObjectReference struct {
+	Kind      string `json:"kind,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+// EndpointPort ...
+type EndpointPort struct {
+	Name     *string `json:"name,omitempty"`
+	Port     *int32  `json:"port,omitempty"`
+	Protocol *string `json:"protocol,omitempty"`
 }
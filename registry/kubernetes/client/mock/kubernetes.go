@@ -15,6 +15,13 @@ type Client struct {
 	Pods     map[string]*client.Pod
 	events   chan watch.Event
 	watchers []*mockWatcher
+
+	// EndpointSlices keyed by namespace/name
+	EndpointSlices map[string]*client.EndpointSlice
+	sliceWatchers  []*sliceWatcher
+
+	// Nodes keyed by name
+	Nodes map[string]*client.Node
 }
 
 // UpdatePod ...
@@ -37,11 +44,11 @@ func (m *Client) UpdatePod(podName string, pod *client.Pod) (*client.Pod, error)
 }
 
 // ListPods ...
-func (m *Client) ListPods(labels map[string]string) (*client.PodList, error) {
+func (m *Client) ListPods(namespace string, labels map[string]string) (*client.PodList, error) {
 	var pods []client.Pod
 
 	for _, v := range m.Pods {
-		if labelFilterMatch(v.Metadata.Labels, labels) {
+		if namespaceOf(v.Metadata.Namespace) == namespaceOf(namespace) && labelFilterMatch(v.Metadata.Labels, labels) {
 			pods = append(pods, *v)
 		}
 	}
@@ -51,7 +58,7 @@ func (m *Client) ListPods(labels map[string]string) (*client.PodList, error) {
 }
 
 // WatchPods ...
-func (m *Client) WatchPods(labels map[string]string) (watch.Watch, error) {
+func (m *Client) WatchPods(namespace string, labels map[string]string) (watch.Watch, error) {
 	w := &mockWatcher{
 		results: make(chan watch.Event),
 		stop:    make(chan bool),
@@ -68,6 +75,87 @@ func (m *Client) WatchPods(labels map[string]string) (watch.Watch, error) {
 	return w, nil
 }
 
+// ListEndpointSlices ...
+func (m *Client) ListEndpointSlices(namespace string, labels map[string]string) (*client.EndpointSliceList, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	var slices []client.EndpointSlice
+	for _, v := range m.EndpointSlices {
+		if sliceNamespace(v) == namespaceOf(namespace) && labelFilterMatch(v.Metadata.Labels, labels) {
+			slices = append(slices, *v)
+		}
+	}
+	return &client.EndpointSliceList{
+		Items: slices,
+	}, nil
+}
+
+// WatchEndpointSlices ...
+func (m *Client) WatchEndpointSlices(namespace string, labels map[string]string) (watch.Watch, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	w := &sliceWatcher{
+		mockWatcher: &mockWatcher{
+			results: make(chan watch.Event, 10),
+			stop:    make(chan bool),
+		},
+		namespace: namespace,
+		labels:    labels,
+	}
+	m.sliceWatchers = append(m.sliceWatchers, w)
+	return w, nil
+}
+
+// UpdateEndpointSlice adds or replaces the endpoint slice, notifying watchers
+func (m *Client) UpdateEndpointSlice(s *client.EndpointSlice) {
+	m.Lock()
+	defer m.Unlock()
+
+	key := sliceNamespace(s) + "/" + s.Metadata.Name
+	typ := watch.Modified
+	if _, ok := m.EndpointSlices[key]; !ok {
+		typ = watch.Added
+	}
+	m.EndpointSlices[key] = s
+	m.notifySlice(typ, s)
+}
+
+// DeleteEndpointSlice removes the endpoint slice, notifying watchers
+func (m *Client) DeleteEndpointSlice(s *client.EndpointSlice) {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.EndpointSlices, sliceNamespace(s)+"/"+s.Metadata.Name)
+	m.notifySlice(watch.Deleted, s)
+}
+
+func (m *Client) notifySlice(typ watch.EventType, s *client.EndpointSlice) {
+	b, _ := json.Marshal(s)
+	for _, w := range m.sliceWatchers {
+		if namespaceOf(w.namespace) != sliceNamespace(s) || !labelFilterMatch(s.Metadata.Labels, w.labels) {
+			continue
+		}
+		select {
+		case <-w.stop:
+		case w.results <- watch.Event{Type: typ, Object: json.RawMessage(b)}:
+		}
+	}
+}
+
+// GetNode ...
+func (m *Client) GetNode(name string) (*client.Node, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	n, ok := m.Nodes[name]
+	if !ok {
+		return nil, api.ErrNotFound
+	}
+	return n, nil
+}
+
 // newClient ...
 func newClient() client.Kubernetes {
 	return &Client{}
@@ -76,8 +164,10 @@ func newClient() client.Kubernetes {
 // NewClient ...
 func NewClient() *Client {
 	c := &Client{
-		Pods:   make(map[string]*client.Pod),
-		events: make(chan watch.Event),
+		Pods:           make(map[string]*client.Pod),
+		EndpointSlices: make(map[string]*client.EndpointSlice),
+		Nodes:          make(map[string]*client.Node),
+		events:         make(chan watch.Event),
 	}
 
 	// broadcast events to watchers
@@ -26,6 +26,37 @@ func (w *mockWatcher) Stop() {
 	}
 }
 
+// sliceWatcher only receives events of endpoint slices it selects
+type sliceWatcher struct {
+	*mockWatcher
+	namespace string
+	labels    map[string]string
+}
+
+// Stop only closes the stop channel, events may still be in flight
+func (w *sliceWatcher) Stop() {
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+}
+
+// namespaceOf returns the namespace, default when empty
+func namespaceOf(ns string) string {
+	if len(ns) == 0 {
+		return "default"
+	}
+	return ns
+}
+
+func sliceNamespace(s *client.EndpointSlice) string {
+	if s.Metadata == nil {
+		return namespaceOf("")
+	}
+	return namespaceOf(s.Metadata.Namespace)
+}
+
 func updateMetadata(a, b *client.Meta) {
 	if a == nil || b == nil {
 		return
@@ -7,10 +7,13 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/micro/go-plugins/registry/kubernetes/v2/client"
+	"github.com/micro/go-plugins/registry/kubernetes/v2/internal/weight"
 
 	"github.com/micro/go-micro/v2/config/cmd"
 	"github.com/micro/go-micro/v2/registry"
@@ -20,6 +23,10 @@ type kregistry struct {
 	client  client.Kubernetes
 	timeout time.Duration
 	options registry.Options
+
+	sync.Mutex
+	// topology of the kubernetes nodes keyed by name
+	topologies map[string]*topology
 }
 
 var (
@@ -38,6 +45,9 @@ var (
 	// Pod status
 	podRunning = "Running"
 
+	// the pod annotation holding the weight of its nodes
+	annotationWeightKey = "micro.mu/weight"
+
 	// label name regex
 	labelRe = regexp.MustCompilePOSIX("[-A-Za-z0-9_.]")
 )
@@ -95,6 +105,96 @@ func serviceName(name string) string {
 	return string(aname)
 }
 
+func (c *kregistry) value(k interface{}) interface{} {
+	if c.options.Context == nil {
+		return nil
+	}
+	return c.options.Context.Value(k)
+}
+
+// namespaces returns the namespaces services are discovered in, the empty
+// namespace being the namespace of the client
+func (c *kregistry) namespaces() []string {
+	if ns, ok := c.value(namespacesKey{}).([]string); ok && len(ns) > 0 {
+		return ns
+	}
+	return []string{""}
+}
+
+// serviceNamespaces returns the namespaces the service is looked up in
+func (c *kregistry) serviceNamespaces(service string) []string {
+	if namespaces, ok := c.value(serviceNamespacesKey{}).(map[string]string); ok {
+		if ns, ok := namespaces[service]; ok {
+			return []string{ns}
+		}
+	}
+	return c.namespaces()
+}
+
+// selector adds the labels set with the Selector option to the labels
+func (c *kregistry) selector(labels map[string]string) map[string]string {
+	extra, _ := c.value(selectorKey{}).(map[string]string)
+	if len(extra) == 0 {
+		return labels
+	}
+
+	selector := make(map[string]string, len(labels)+len(extra))
+	for k, v := range extra {
+		selector[k] = v
+	}
+	for k, v := range labels {
+		selector[k] = v
+	}
+	return selector
+}
+
+// annotationPrefix returns the prefix of the service annotations
+func (c *kregistry) annotationPrefix() string {
+	if prefix, ok := c.value(annotationPrefixKey{}).(string); ok && len(prefix) > 0 {
+		return prefix
+	}
+	return annotationServiceKeyPrefix
+}
+
+// ready returns false if the pod reports it isn't ready, e.g failing its readiness probe
+func ready(pod *client.Pod) bool {
+	if pod.Status == nil {
+		return true
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == "Ready" {
+			return c.Status == "True"
+		}
+	}
+	return true
+}
+
+// setWeight sets the weight of the service nodes from the weight annotation of the
+// pod. Pods which aren't ready weigh 0, so they're only called as a last resort
+func setWeight(pod *client.Pod, svc *registry.Service) {
+	var w string
+	if pod.Metadata != nil {
+		if v, ok := pod.Metadata.Annotations[annotationWeightKey]; ok && v != nil {
+			if n, err := strconv.Atoi(*v); err == nil && n >= 0 {
+				w = *v
+			}
+		}
+	}
+	if !ready(pod) {
+		w = "0"
+	}
+	if len(w) == 0 {
+		return
+	}
+
+	for _, node := range svc.Nodes {
+		if node.Metadata == nil {
+			node.Metadata = make(map[string]string)
+		}
+		node.Metadata[weight.Key] = w
+	}
+}
+
 // Init allows reconfig of options
 func (c *kregistry) Init(opts ...registry.Option) error {
 	return configure(c, opts...)
@@ -112,6 +212,11 @@ func (c *kregistry) Register(s *registry.Service, opts ...registry.RegisterOptio
 		return errors.New("you must register at least one node")
 	}
 
+	// the kubernetes Service selects the pods itself
+	if c.endpointSlices() {
+		return nil
+	}
+
 	// TODO: grab podname from somewhere better than this.
 	podName := os.Getenv("HOSTNAME")
 	svcName := s.Name
@@ -130,7 +235,7 @@ func (c *kregistry) Register(s *registry.Service, opts ...registry.RegisterOptio
 				svcSelectorPrefix + serviceName(svcName): &svcSelectorValue,
 			},
 			Annotations: map[string]*string{
-				annotationServiceKeyPrefix + serviceName(svcName): &svc,
+				c.annotationPrefix() + serviceName(svcName): &svc,
 			},
 		},
 	}
@@ -149,6 +254,10 @@ func (c *kregistry) Deregister(s *registry.Service, opts ...registry.DeregisterO
 		return errors.New("you must deregister at least one node")
 	}
 
+	if c.endpointSlices() {
+		return nil
+	}
+
 	// TODO: grab podname from somewhere better than this.
 	podName := os.Getenv("HOSTNAME")
 	svcName := s.Name
@@ -159,7 +268,7 @@ func (c *kregistry) Deregister(s *registry.Service, opts ...registry.DeregisterO
 				svcSelectorPrefix + serviceName(svcName): nil,
 			},
 			Annotations: map[string]*string{
-				annotationServiceKeyPrefix + serviceName(svcName): nil,
+				c.annotationPrefix() + serviceName(svcName): nil,
 			},
 		},
 	}
@@ -175,14 +284,22 @@ func (c *kregistry) Deregister(s *registry.Service, opts ...registry.DeregisterO
 // GetService will get all the pods with the given service selector,
 // and build services from the annotations.
 func (c *kregistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
-	pods, err := c.client.ListPods(map[string]string{
-		svcSelectorPrefix + serviceName(name): svcSelectorValue,
-	})
-	if err != nil {
-		return nil, err
+	if c.endpointSlices() {
+		return c.getSliceService(name)
 	}
 
-	if len(pods.Items) == 0 {
+	var pods []client.Pod
+	for _, ns := range c.serviceNamespaces(name) {
+		list, err := c.client.ListPods(ns, c.selector(map[string]string{
+			svcSelectorPrefix + serviceName(name): svcSelectorValue,
+		}))
+		if err != nil {
+			return nil, err
+		}
+		pods = append(pods, list.Items...)
+	}
+
+	if len(pods) == 0 {
 		return nil, registry.ErrNotFound
 	}
 
@@ -190,12 +307,12 @@ func (c *kregistry) GetService(name string, opts ...registry.GetOption) ([]*regi
 	svcs := make(map[string]*registry.Service)
 
 	// loop through items
-	for _, pod := range pods.Items {
+	for _, pod := range pods {
 		if pod.Status.Phase != podRunning {
 			continue
 		}
 		// get serialised service from annotation
-		svcStr, ok := pod.Metadata.Annotations[annotationServiceKeyPrefix+serviceName(name)]
+		svcStr, ok := pod.Metadata.Annotations[c.annotationPrefix()+serviceName(name)]
 		if !ok {
 			continue
 		}
@@ -207,6 +324,9 @@ func (c *kregistry) GetService(name string, opts ...registry.GetOption) ([]*regi
 			return nil, fmt.Errorf("could not unmarshal service '%s' from pod annotation", name)
 		}
 
+		c.setTopology(&pod, &svc)
+		setWeight(&pod, &svc)
+
 		// merge up pod service & ip with versioned service.
 		vs, ok := svcs[svc.Version]
 		if !ok {
@@ -226,20 +346,28 @@ func (c *kregistry) GetService(name string, opts ...registry.GetOption) ([]*regi
 
 // ListServices will list all the service names
 func (c *kregistry) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
-	pods, err := c.client.ListPods(podSelector)
-	if err != nil {
-		return nil, err
+	if c.endpointSlices() {
+		return c.listSliceServices()
+	}
+
+	var pods []client.Pod
+	for _, ns := range c.namespaces() {
+		list, err := c.client.ListPods(ns, c.selector(podSelector))
+		if err != nil {
+			return nil, err
+		}
+		pods = append(pods, list.Items...)
 	}
 
 	// svcs mapped by name
 	svcs := make(map[string]bool)
 
-	for _, pod := range pods.Items {
+	for _, pod := range pods {
 		if pod.Status.Phase != podRunning {
 			continue
 		}
 		for k, v := range pod.Metadata.Annotations {
-			if !strings.HasPrefix(k, annotationServiceKeyPrefix) {
+			if !strings.HasPrefix(k, c.annotationPrefix()) {
 				continue
 			}
 
@@ -262,6 +390,9 @@ func (c *kregistry) ListServices(opts ...registry.ListOption) ([]*registry.Servi
 
 // Watch returns a kubernetes watcher
 func (c *kregistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	if c.endpointSlices() {
+		return newSliceWatcher(c, opts...)
+	}
 	return newWatcher(c, opts...)
 }
 
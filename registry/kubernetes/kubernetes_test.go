@@ -14,6 +14,7 @@ import (
 	"github.com/micro/go-micro/v2/router"
 	"github.com/micro/go-plugins/registry/kubernetes/v2/client"
 	"github.com/micro/go-plugins/registry/kubernetes/v2/client/mock"
+	"github.com/micro/go-plugins/registry/kubernetes/v2/internal/weight"
 )
 
 var (
@@ -70,10 +71,14 @@ func teardownRegistry() {
 }
 
 func setupRegistry(opts ...registry.Option) registry.Registry {
-	return &kregistry{
+	k := &kregistry{
 		client:  mockClient,
 		timeout: time.Second * 1,
 	}
+	for _, o := range opts {
+		o(&k.options)
+	}
+	return k
 }
 
 //
@@ -423,6 +428,65 @@ func TestListServices(t *testing.T) {
 
 }
 
+func TestScoping(t *testing.T) {
+	defer teardownRegistry()
+
+	shop := "shop"
+	for _, p := range []struct {
+		name      string
+		namespace string
+		labels    map[string]*string
+	}{
+		{"scoped-1", "team-a", map[string]*string{"app.kubernetes.io/part-of": &shop}},
+		{"scoped-2", "team-a", map[string]*string{}},
+		{"scoped-3", "", map[string]*string{"app.kubernetes.io/part-of": &shop}},
+	} {
+		pod := setupPod(p.name)
+		pod.Metadata.Namespace = p.namespace
+		for k, v := range p.labels {
+			pod.Metadata.Labels[k] = v
+		}
+	}
+
+	r := setupRegistry(
+		Namespaces("team-a"),
+		Selector(map[string]string{"app.kubernetes.io/part-of": "shop"}),
+		AnnotationPrefix("shop.mu/service-"),
+	)
+	for _, pod := range []string{"scoped-1", "scoped-2", "scoped-3"} {
+		register(r, pod, &registry.Service{Name: "scoped.service", Version: "1"})
+	}
+
+	if _, ok := mockClient.Pods["scoped-1"].Metadata.Annotations["shop.mu/service-scoped.service"]; !ok {
+		t.Fatal("expected the service to be annotated with the prefix")
+	}
+
+	svcs, err := r.GetService("scoped.service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(svcs) != 1 || len(svcs[0].Nodes) != 1 || svcs[0].Nodes[0].Id != "scoped.service:scoped-1" {
+		t.Fatalf("expected only the node in the namespace matching the selector, got %+v", svcs)
+	}
+
+	services, err := r.ListServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasServices(services, []*registry.Service{{Name: "scoped.service"}}) {
+		t.Fatalf("expected the scoped service to be listed, got %+v", services)
+	}
+
+	// a deployment with the default prefix doesn't see the service
+	svcs, err = setupRegistry().GetService("scoped.service")
+	if err != nil && err != registry.ErrNotFound {
+		t.Fatal(err)
+	}
+	if len(svcs) != 0 {
+		t.Fatalf("expected no services with the default prefix, got %+v", svcs)
+	}
+}
+
 func TestWatcher(t *testing.T) {
 	r := setupRegistry()
 	rtr := router.NewRouter(router.Registry(r))
@@ -495,3 +559,70 @@ func hasServices(a, b []*registry.Service) bool {
 	}
 	return found == len(b)
 }
+
+func TestWeight(t *testing.T) {
+	r := setupRegistry()
+	defer teardownRegistry()
+
+	register(r, "pod-1", &registry.Service{Name: "foo.service"})
+	register(r, "pod-2", &registry.Service{Name: "foo.service"})
+
+	w := "5"
+	mockClient.Pods["pod-1"].Metadata.Annotations[annotationWeightKey] = &w
+	mockClient.Pods["pod-2"].Status.Conditions = []client.PodCondition{{Type: "Ready", Status: "False"}}
+
+	service, err := r.GetService("foo.service")
+	if err != nil {
+		t.Fatalf("did not expect GetService to fail %v", err)
+	}
+
+	weights := make(map[string]string)
+	for _, n := range service[0].Nodes {
+		weights[n.Id] = n.Metadata[weight.Key]
+	}
+	if weights["foo.service:pod-1"] != "5" || weights["foo.service:pod-2"] != "0" {
+		t.Fatalf("expected the weight of the annotation and of the unready pod, got %v", weights)
+	}
+}
+
+func TestTopology(t *testing.T) {
+	r := setupRegistry()
+	defer teardownRegistry()
+
+	register(r, "pod-1", &registry.Service{Name: "foo.service"})
+	register(r, "pod-2", &registry.Service{Name: "foo.service"})
+
+	// the zone of pod-1 is the label of its node, pod-2 is on a node which can't be
+	// read and carries the label itself
+	zone, region, labelled := "zone-a", "region-a", "zone-b"
+	mockClient.Lock()
+	mockClient.Nodes["node-1"] = &client.Node{Metadata: &client.Meta{
+		Name: "node-1",
+		Labels: map[string]*string{
+			topologyZoneKey:   &zone,
+			topologyRegionKey: &region,
+		},
+	}}
+	mockClient.Unlock()
+	defer func() {
+		mockClient.Lock()
+		delete(mockClient.Nodes, "node-1")
+		mockClient.Unlock()
+	}()
+	mockClient.Pods["pod-1"].Spec = &client.Spec{NodeName: "node-1"}
+	mockClient.Pods["pod-2"].Spec = &client.Spec{NodeName: "node-2"}
+	mockClient.Pods["pod-2"].Metadata.Labels[topologyZoneKey] = &labelled
+
+	service, err := r.GetService("foo.service")
+	if err != nil {
+		t.Fatalf("did not expect GetService to fail %v", err)
+	}
+
+	zones := make(map[string]string)
+	for _, n := range service[0].Nodes {
+		zones[n.Id] = n.Metadata[topologyZoneKey] + "/" + n.Metadata[topologyHostnameKey]
+	}
+	if zones["foo.service:pod-1"] != "zone-a/node-1" || zones["foo.service:pod-2"] != "zone-b/node-2" {
+		t.Fatalf("expected the zones of the node and of the pod label, got %v", zones)
+	}
+}
@@ -0,0 +1,71 @@
+package kubernetes
+
+import (
+	"context"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+type endpointSlicesKey struct{}
+type namespacesKey struct{}
+type serviceNamespacesKey struct{}
+type portNameKey struct{}
+type selectorKey struct{}
+type annotationPrefixKey struct{}
+
+func setOption(k, v interface{}) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// EndpointSlices discovers nodes from the EndpointSlices of the kubernetes Service
+// named after the micro service instead of pod annotations, only ready endpoints
+// are returned. Register and Deregister do nothing, so pods don't need to be
+// allowed to patch themselves
+func EndpointSlices() registry.Option {
+	return setOption(endpointSlicesKey{}, true)
+}
+
+// Namespaces restricts discovery to the namespaces, by default the namespace of the pod
+func Namespaces(ns ...string) registry.Option {
+	return setOption(namespacesKey{}, ns)
+}
+
+// ServiceNamespace looks up the service in the namespace rather than the Namespaces
+func ServiceNamespace(service, namespace string) registry.Option {
+	return func(o *registry.Options) {
+		namespaces := map[string]string{service: namespace}
+		if o.Context != nil {
+			if v, ok := o.Context.Value(serviceNamespacesKey{}).(map[string]string); ok {
+				for k, ns := range v {
+					if _, ok := namespaces[k]; !ok {
+						namespaces[k] = ns
+					}
+				}
+			}
+		}
+		setOption(serviceNamespacesKey{}, namespaces)(o)
+	}
+}
+
+// PortName sets the name of the EndpointSlice port nodes are addressed on, by
+// default the first port
+func PortName(name string) registry.Option {
+	return setOption(portNameKey{}, name)
+}
+
+// Selector restricts discovery to pods, or EndpointSlices, which also match the labels
+func Selector(labels map[string]string) registry.Option {
+	return setOption(selectorKey{}, labels)
+}
+
+// AnnotationPrefix sets the prefix of the pod annotations services are registered
+// under, by default micro.mu/service-. Deployments using another prefix don't see
+// each others services
+func AnnotationPrefix(prefix string) registry.Option {
+	return setOption(annotationPrefixKey{}, prefix)
+}
@@ -0,0 +1,330 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-plugins/registry/kubernetes/v2/client"
+	"github.com/micro/go-plugins/registry/kubernetes/v2/client/watch"
+)
+
+var (
+	// label set by kubernetes on endpoint slices to the name of their service
+	sliceServiceNameKey = "kubernetes.io/service-name"
+)
+
+// endpointSlices reports whether nodes are discovered from endpoint slices
+func (c *kregistry) endpointSlices() bool {
+	v, _ := c.value(endpointSlicesKey{}).(bool)
+	return v
+}
+
+// kubeServiceName returns the kubernetes Service name of the micro service, a
+// DNS label such as go-micro-srv-foo for go.micro.srv.foo
+func kubeServiceName(name string) string {
+	b := []byte(strings.ToLower(name))
+	for i, r := range b {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			b[i] = '-'
+		}
+	}
+	return strings.Trim(string(b), "-")
+}
+
+// sliceService returns the name of the service of a kubernetes Service, the
+// service set with ServiceNamespace which translates to it if any. Other micro
+// names can't be recovered, their kubernetes name is used and looks them up too
+func (c *kregistry) sliceService(kubeName string) string {
+	if namespaces, ok := c.value(serviceNamespacesKey{}).(map[string]string); ok {
+		for service := range namespaces {
+			if kubeServiceName(service) == kubeName {
+				return service
+			}
+		}
+	}
+	return kubeName
+}
+
+// sliceNamespaces returns the namespaces the service is looked up in, by any
+// name translating to the same kubernetes Service
+func (c *kregistry) sliceNamespaces(name string) []string {
+	return c.serviceNamespaces(c.sliceService(kubeServiceName(name)))
+}
+
+// slicePort returns the port of the slice with the name, the first port if empty
+func slicePort(slice *client.EndpointSlice, name string) (int, bool) {
+	for _, p := range slice.Ports {
+		if p.Port == nil {
+			continue
+		}
+		if len(name) == 0 || (p.Name != nil && *p.Name == name) {
+			return int(*p.Port), true
+		}
+	}
+	return 0, false
+}
+
+// sliceNodes returns the ready endpoints of the slice as nodes of the service,
+// their ids are the same whichever name the service is known by
+func (c *kregistry) sliceNodes(service string, slice *client.EndpointSlice) []*registry.Node {
+	portName, _ := c.value(portNameKey{}).(string)
+	port, ok := slicePort(slice, portName)
+	if !ok {
+		return nil
+	}
+
+	var nodes []*registry.Node
+	for _, ep := range slice.Endpoints {
+		// an unknown readiness is treated as ready
+		if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+			continue
+		}
+		if len(ep.Addresses) == 0 {
+			continue
+		}
+
+		id := ep.Addresses[0]
+		if ep.TargetRef != nil && len(ep.TargetRef.Name) > 0 {
+			id = ep.TargetRef.Name
+		}
+
+		node := &registry.Node{
+			Id:       kubeServiceName(service) + "-" + id,
+			Address:  net.JoinHostPort(ep.Addresses[0], strconv.Itoa(port)),
+			Metadata: make(map[string]string),
+		}
+		if ep.Zone != nil {
+			node.Metadata[topologyZoneKey] = *ep.Zone
+		}
+		if ep.NodeName != nil {
+			node.Metadata[topologyHostnameKey] = *ep.NodeName
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// getSliceService builds the service from the endpoint slices of its kubernetes Service
+func (c *kregistry) getSliceService(name string) ([]*registry.Service, error) {
+	svc := &registry.Service{Name: name}
+	for _, ns := range c.sliceNamespaces(name) {
+		slices, err := c.client.ListEndpointSlices(ns, c.selector(map[string]string{
+			sliceServiceNameKey: kubeServiceName(name),
+		}))
+		if err != nil {
+			return nil, err
+		}
+		for i := range slices.Items {
+			svc.Nodes = append(svc.Nodes, c.sliceNodes(name, &slices.Items[i])...)
+		}
+	}
+	if len(svc.Nodes) == 0 {
+		return nil, registry.ErrNotFound
+	}
+	return []*registry.Service{svc}, nil
+}
+
+// listSliceServices lists the kubernetes Services with endpoint slices in the namespaces
+func (c *kregistry) listSliceServices() ([]*registry.Service, error) {
+	svcs := make(map[string]bool)
+	var list []*registry.Service
+
+	for _, ns := range c.namespaces() {
+		slices, err := c.client.ListEndpointSlices(ns, c.selector(nil))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, slice := range slices.Items {
+			if slice.Metadata == nil {
+				continue
+			}
+			name, ok := slice.Metadata.Labels[sliceServiceNameKey]
+			if !ok || name == nil || svcs[*name] {
+				continue
+			}
+			svcs[*name] = true
+			list = append(list, &registry.Service{Name: c.sliceService(*name)})
+		}
+	}
+	return list, nil
+}
+
+type sliceWatcher struct {
+	registry *kregistry
+	service  string
+	watcher  watch.Watch
+	next     chan *registry.Result
+	exit     chan bool
+
+	// nodes of every slice keyed by namespace/name
+	slices map[string][]*registry.Node
+}
+
+func sliceKey(slice *client.EndpointSlice) string {
+	return slice.Metadata.Namespace + "/" + slice.Metadata.Name
+}
+
+// serviceOf returns the name of the service the slice belongs to
+func (k *sliceWatcher) serviceOf(slice *client.EndpointSlice) string {
+	if len(k.service) > 0 {
+		return k.service
+	}
+	if name, ok := slice.Metadata.Labels[sliceServiceNameKey]; ok && name != nil {
+		return k.registry.sliceService(*name)
+	}
+	return ""
+}
+
+func (k *sliceWatcher) send(r *registry.Result) bool {
+	select {
+	case k.next <- r:
+		return true
+	case <-k.exit:
+		return false
+	}
+}
+
+// handleEvent sends the nodes of the slice which changed and deletes the nodes
+// which are gone or no longer ready
+func (k *sliceWatcher) handleEvent(event watch.Event) {
+	var slice client.EndpointSlice
+	if err := json.Unmarshal([]byte(event.Object), &slice); err != nil || slice.Metadata == nil {
+		log.Error("K8s Watcher: Couldnt unmarshal event object from endpoint slice")
+		return
+	}
+
+	service := k.serviceOf(&slice)
+	if len(service) == 0 {
+		return
+	}
+
+	key := sliceKey(&slice)
+	old := k.slices[key]
+
+	var nodes []*registry.Node
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		nodes = k.registry.sliceNodes(service, &slice)
+		k.slices[key] = nodes
+	case watch.Deleted:
+		delete(k.slices, key)
+	default:
+		return
+	}
+
+	if len(nodes) > 0 && !reflect.DeepEqual(old, nodes) {
+		action := "update"
+		if old == nil {
+			action = "create"
+		}
+		if !k.send(&registry.Result{Action: action, Service: &registry.Service{Name: service, Nodes: nodes}}) {
+			return
+		}
+	}
+
+	ids := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		ids[n.Id] = true
+	}
+	var gone []*registry.Node
+	for _, n := range old {
+		if !ids[n.Id] {
+			gone = append(gone, n)
+		}
+	}
+	if len(gone) > 0 {
+		k.send(&registry.Result{Action: "delete", Service: &registry.Service{Name: service, Nodes: gone}})
+	}
+}
+
+func (k *sliceWatcher) run() {
+	for {
+		select {
+		case event, ok := <-k.watcher.ResultChan():
+			if !ok {
+				k.Stop()
+				return
+			}
+			k.handleEvent(event)
+		case <-k.exit:
+			return
+		}
+	}
+}
+
+// Next will block until a new result comes in
+func (k *sliceWatcher) Next() (*registry.Result, error) {
+	select {
+	case r := <-k.next:
+		return r, nil
+	case <-k.exit:
+		return nil, registry.ErrWatcherStopped
+	}
+}
+
+// Stop will cancel the watch request
+func (k *sliceWatcher) Stop() {
+	select {
+	case <-k.exit:
+	default:
+		close(k.exit)
+		k.watcher.Stop()
+	}
+}
+
+func newSliceWatcher(kr *kregistry, opts ...registry.WatchOption) (registry.Watcher, error) {
+	var wo registry.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	namespaces := kr.namespaces()
+	selector := kr.selector(nil)
+	if len(wo.Service) > 0 {
+		namespaces = kr.sliceNamespaces(wo.Service)
+		selector = kr.selector(map[string]string{sliceServiceNameKey: kubeServiceName(wo.Service)})
+	}
+
+	watcher, err := watchNamespaces(namespaces, func(ns string) (watch.Watch, error) {
+		return kr.client.WatchEndpointSlices(ns, selector)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	k := &sliceWatcher{
+		registry: kr,
+		service:  wo.Service,
+		watcher:  watcher,
+		next:     make(chan *registry.Result),
+		exit:     make(chan bool),
+		slices:   make(map[string][]*registry.Node),
+	}
+
+	// cache the current nodes, but dont emit them
+	for _, ns := range namespaces {
+		slices, err := kr.client.ListEndpointSlices(ns, selector)
+		if err != nil {
+			watcher.Stop()
+			return nil, err
+		}
+		for i := range slices.Items {
+			slice := &slices.Items[i]
+			if slice.Metadata == nil {
+				continue
+			}
+			if service := k.serviceOf(slice); len(service) > 0 {
+				k.slices[sliceKey(slice)] = kr.sliceNodes(service, slice)
+			}
+		}
+	}
+
+	go k.run()
+	return k, nil
+}
@@ -0,0 +1,188 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-plugins/registry/kubernetes/v2/client"
+)
+
+func setupSliceRegistry(opts ...registry.Option) registry.Registry {
+	return setupRegistry(append([]registry.Option{EndpointSlices()}, opts...)...)
+}
+
+func newSlice(namespace, name, service string, ready ...bool) *client.EndpointSlice {
+	port := int32(8080)
+	portName := "grpc"
+	zone := "eu-west-1a"
+
+	slice := &client.EndpointSlice{
+		Metadata: &client.Meta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]*string{sliceServiceNameKey: &service},
+		},
+		AddressType: "IPv4",
+		Ports:       []client.EndpointPort{{Name: &portName, Port: &port}},
+	}
+	for i, r := range ready {
+		r := r
+		slice.Endpoints = append(slice.Endpoints, client.Endpoint{
+			Addresses:  []string{"10.1.0." + string(rune('1'+i))},
+			Conditions: client.EndpointConditions{Ready: &r},
+			TargetRef:  &client.ObjectReference{Kind: "Pod", Name: name + "-" + string(rune('a'+i))},
+			Zone:       &zone,
+		})
+	}
+	return slice
+}
+
+func TestKubeServiceName(t *testing.T) {
+	for name, expect := range map[string]string{
+		"go.micro.srv.foo": "go-micro-srv-foo",
+		"Foo_Bar":          "foo-bar",
+		"foo":              "foo",
+	} {
+		if got := kubeServiceName(name); got != expect {
+			t.Fatalf("expected %s for %s, got %s", expect, name, got)
+		}
+	}
+}
+
+func TestSliceGetService(t *testing.T) {
+	r := setupSliceRegistry(ServiceNamespace("go.micro.srv.bar", "other"))
+
+	foo := newSlice("", "go-micro-srv-foo-1", "go-micro-srv-foo", true, false, true)
+	bar := newSlice("other", "go-micro-srv-bar-1", "go-micro-srv-bar", true)
+	mockClient.UpdateEndpointSlice(foo)
+	mockClient.UpdateEndpointSlice(bar)
+	defer mockClient.DeleteEndpointSlice(foo)
+	defer mockClient.DeleteEndpointSlice(bar)
+
+	svcs, err := r.GetService("go.micro.srv.foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(svcs) != 1 || len(svcs[0].Nodes) != 2 {
+		t.Fatalf("expected the 2 ready nodes, got %+v", svcs)
+	}
+	node := svcs[0].Nodes[0]
+	if node.Address != "10.1.0.1:8080" || node.Id != "go-micro-srv-foo-go-micro-srv-foo-1-a" {
+		t.Fatalf("unexpected node %+v", node)
+	}
+	if node.Metadata[topologyZoneKey] != "eu-west-1a" {
+		t.Fatalf("expected the zone in the node metadata, got %v", node.Metadata)
+	}
+
+	// looked up in the namespace set for the service
+	svcs, err = r.GetService("go.micro.srv.bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(svcs[0].Nodes) != 1 {
+		t.Fatalf("expected 1 node in the other namespace, got %d", len(svcs[0].Nodes))
+	}
+
+	if _, err := setupSliceRegistry().GetService("go.micro.srv.bar"); err != registry.ErrNotFound {
+		t.Fatalf("expected bar not to be found in the default namespace, got %v", err)
+	}
+
+	// registering doesn't touch pods
+	if err := r.Register(&registry.Service{Name: "go.micro.srv.foo", Nodes: []*registry.Node{{Id: "foo"}}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSliceWatcher(t *testing.T) {
+	r := setupSliceRegistry()
+
+	foo := newSlice("", "go-micro-srv-foo-2", "go-micro-srv-foo", true)
+	mockClient.UpdateEndpointSlice(foo)
+	defer mockClient.DeleteEndpointSlice(foo)
+
+	w, err := r.Watch(registry.WatchService("go.micro.srv.foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// the second endpoint becomes ready
+	mockClient.UpdateEndpointSlice(newSlice("", "go-micro-srv-foo-2", "go-micro-srv-foo", true, true))
+
+	res, err := w.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Action != "update" || len(res.Service.Nodes) != 2 {
+		t.Fatalf("expected an update with 2 nodes, got %s with %d", res.Action, len(res.Service.Nodes))
+	}
+
+	// the first endpoint is no longer ready
+	mockClient.UpdateEndpointSlice(newSlice("", "go-micro-srv-foo-2", "go-micro-srv-foo", false, true))
+
+	res, err = w.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Action != "update" || len(res.Service.Nodes) != 1 {
+		t.Fatalf("expected an update with 1 node, got %s with %d", res.Action, len(res.Service.Nodes))
+	}
+	res, err = w.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Action != "delete" || res.Service.Nodes[0].Id != "go-micro-srv-foo-go-micro-srv-foo-2-a" {
+		t.Fatalf("expected the unready node to be deleted, got %s of %+v", res.Action, res.Service.Nodes)
+	}
+}
+
+func TestSliceWatchLookup(t *testing.T) {
+	r := setupSliceRegistry(ServiceNamespace("go.micro.srv.foo", ""))
+
+	w, err := r.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	foo := newSlice("", "go-micro-srv-foo-3", "go-micro-srv-foo", true)
+	baz := newSlice("", "baz-1", "baz", true)
+	mockClient.UpdateEndpointSlice(foo)
+	defer mockClient.DeleteEndpointSlice(foo)
+
+	for _, expect := range []string{"go.micro.srv.foo", "baz"} {
+		if expect == "baz" {
+			mockClient.UpdateEndpointSlice(baz)
+			defer mockClient.DeleteEndpointSlice(baz)
+		}
+
+		res, err := w.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Action != "create" || res.Service.Name != expect {
+			t.Fatalf("expected %s to be created, got %s of %s", expect, res.Action, res.Service.Name)
+		}
+
+		// the watched service is looked up by its name
+		svcs, err := r.GetService(res.Service.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(svcs[0].Nodes) != 1 || svcs[0].Nodes[0].Id != res.Service.Nodes[0].Id {
+			t.Fatalf("expected the watched node %s, got %+v", res.Service.Nodes[0].Id, svcs[0].Nodes)
+		}
+	}
+
+	svcs, err := r.ListServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, s := range svcs {
+		names[s.Name] = true
+	}
+	if !names["go.micro.srv.foo"] || !names["baz"] {
+		t.Fatalf("expected the services by the names they're watched by, got %v", names)
+	}
+}
@@ -0,0 +1,101 @@
+package kubernetes
+
+import (
+	"time"
+
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-plugins/registry/kubernetes/v2/client"
+)
+
+/*
+	The zone and region of a pod are the labels of the kubernetes node it's scheduled
+	on, pods don't carry them. The node is read once in a while and its topology
+	cached. Reading nodes requires a cluster role allowing to get them, without one
+	the labels of the pod are used, e.g set by an admission controller.
+*/
+
+var (
+	// topology labels copied into node metadata
+	topologyZoneKey     = "topology.kubernetes.io/zone"
+	topologyRegionKey   = "topology.kubernetes.io/region"
+	topologyHostnameKey = "kubernetes.io/hostname"
+
+	// topologyTTL is how long the topology of a node is cached, nodes which
+	// can't be read are tried again after it
+	topologyTTL = time.Minute * 10
+)
+
+// topology is the zone and region of a kubernetes node
+type topology struct {
+	labels  map[string]string
+	expires time.Time
+}
+
+// nodeTopology returns the zone and region labels of the kubernetes node, nil if
+// it can't be read
+func (c *kregistry) nodeTopology(name string) map[string]string {
+	c.Lock()
+	t, ok := c.topologies[name]
+	c.Unlock()
+	if ok && time.Now().Before(t.expires) {
+		return t.labels
+	}
+
+	t = &topology{expires: time.Now().Add(topologyTTL)}
+	node, err := c.client.GetNode(name)
+	if err != nil {
+		log.Debugf("[kubernetes] failed to read the topology of node %s: %v", name, err)
+	} else if node.Metadata != nil {
+		t.labels = make(map[string]string)
+		for _, key := range []string{topologyZoneKey, topologyRegionKey} {
+			if v, ok := node.Metadata.Labels[key]; ok && v != nil {
+				t.labels[key] = *v
+			}
+		}
+	}
+
+	c.Lock()
+	if c.topologies == nil {
+		c.topologies = make(map[string]*topology)
+	}
+	c.topologies[name] = t
+	c.Unlock()
+
+	return t.labels
+}
+
+// setTopology copies the topology of the pod into the metadata of the service nodes
+// so selectors can route based on zone and host. The zone and region are taken from
+// the node the pod is scheduled on, or the pod labels if the node can't be read
+func (c *kregistry) setTopology(pod *client.Pod, svc *registry.Service) {
+	topology := make(map[string]string)
+	if pod.Metadata != nil {
+		for _, key := range []string{topologyZoneKey, topologyRegionKey} {
+			if v, ok := pod.Metadata.Labels[key]; ok && v != nil {
+				topology[key] = *v
+			}
+		}
+	}
+	if pod.Spec != nil && len(pod.Spec.NodeName) > 0 {
+		topology[topologyHostnameKey] = pod.Spec.NodeName
+		for k, v := range c.nodeTopology(pod.Spec.NodeName) {
+			topology[k] = v
+		}
+	}
+	if len(topology) == 0 {
+		return
+	}
+
+	for _, node := range svc.Nodes {
+		if node.Metadata == nil {
+			node.Metadata = make(map[string]string)
+		}
+		for k, v := range topology {
+			// values registered by the service itself take precedence
+			if _, ok := node.Metadata[k]; !ok {
+				node.Metadata[k] = v
+			}
+		}
+	}
+}
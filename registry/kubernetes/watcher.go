@@ -18,31 +18,98 @@ type k8sWatcher struct {
 	next     chan *registry.Result
 
 	sync.RWMutex
+	// pods keyed by namespace/name
 	pods map[string]*client.Pod
 }
 
-// build a cache of pods when the watcher starts.
-func (k *k8sWatcher) updateCache() ([]*registry.Result, error) {
-	podList, err := k.registry.client.ListPods(podSelector)
-	if err != nil {
-		return nil, err
+// multiWatch fans the events of watches in many namespaces into one channel
+type multiWatch struct {
+	watches []watch.Watch
+	results chan watch.Event
+	exit    chan bool
+	once    sync.Once
+}
+
+func (m *multiWatch) ResultChan() <-chan watch.Event {
+	return m.results
+}
+
+func (m *multiWatch) Stop() {
+	m.once.Do(func() {
+		close(m.exit)
+		for _, w := range m.watches {
+			w.Stop()
+		}
+	})
+}
+
+// watchNamespaces starts a watch in every namespace, returned as a single watch
+func watchNamespaces(namespaces []string, fn func(ns string) (watch.Watch, error)) (watch.Watch, error) {
+	if len(namespaces) == 1 {
+		return fn(namespaces[0])
 	}
 
-	k.RLock()
-	k.RUnlock()
+	m := &multiWatch{
+		results: make(chan watch.Event),
+		exit:    make(chan bool),
+	}
+	for _, ns := range namespaces {
+		w, err := fn(ns)
+		if err != nil {
+			m.Stop()
+			return nil, err
+		}
+		m.watches = append(m.watches, w)
+	}
 
-	var results []*registry.Result
+	var wg sync.WaitGroup
+	for _, w := range m.watches {
+		wg.Add(1)
+		go func(w watch.Watch) {
+			defer wg.Done()
+			for event := range w.ResultChan() {
+				select {
+				case m.results <- event:
+				case <-m.exit:
+					return
+				}
+			}
+		}(w)
+	}
+	go func() {
+		wg.Wait()
+		close(m.results)
+	}()
 
-	for _, pod := range podList.Items {
-		rslts := k.buildPodResults(&pod, nil)
+	return m, nil
+}
+
+func podKey(pod *client.Pod) string {
+	return pod.Metadata.Namespace + "/" + pod.Metadata.Name
+}
 
-		for _, r := range rslts {
-			results = append(results, r)
+// build a cache of pods when the watcher starts.
+func (k *k8sWatcher) updateCache(namespaces []string) ([]*registry.Result, error) {
+	var results []*registry.Result
+
+	for _, ns := range namespaces {
+		podList, err := k.registry.client.ListPods(ns, k.registry.selector(podSelector))
+		if err != nil {
+			return nil, err
 		}
 
-		k.Lock()
-		k.pods[pod.Metadata.Name] = &pod
-		k.Unlock()
+		for _, pod := range podList.Items {
+			pod := pod
+			rslts := k.buildPodResults(&pod, nil)
+
+			for _, r := range rslts {
+				results = append(results, r)
+			}
+
+			k.Lock()
+			k.pods[podKey(&pod)] = &pod
+			k.Unlock()
+		}
 	}
 
 	return results, nil
@@ -57,7 +124,7 @@ func (k *k8sWatcher) buildPodResults(pod *client.Pod, cache *client.Pod) []*regi
 	if pod.Metadata != nil {
 		for ak, av := range pod.Metadata.Annotations {
 			// check this annotation kv is a service notation
-			if !strings.HasPrefix(ak, annotationServiceKeyPrefix) {
+			if !strings.HasPrefix(ak, k.registry.annotationPrefix()) {
 				continue
 			}
 
@@ -95,6 +162,11 @@ func (k *k8sWatcher) buildPodResults(pod *client.Pod, cache *client.Pod) []*regi
 				continue
 			}
 
+			if rslt.Service != nil {
+				k.registry.setTopology(pod, rslt.Service)
+				setWeight(pod, rslt.Service)
+			}
+
 			results = append(results, rslt)
 		}
 	}
@@ -108,7 +180,7 @@ func (k *k8sWatcher) buildPodResults(pod *client.Pod, cache *client.Pod) []*regi
 			}
 
 			// check this annotation kv is a service notation
-			if !strings.HasPrefix(ak, annotationServiceKeyPrefix) {
+			if !strings.HasPrefix(ak, k.registry.annotationPrefix()) {
 				continue
 			}
 
@@ -140,7 +212,7 @@ func (k *k8sWatcher) handleEvent(event watch.Event) {
 		// Pod was modified
 
 		k.RLock()
-		cache := k.pods[pod.Metadata.Name]
+		cache := k.pods[podKey(&pod)]
 		k.RUnlock()
 
 		// service could have been added, edited or removed.
@@ -162,7 +234,7 @@ func (k *k8sWatcher) handleEvent(event watch.Event) {
 		}
 
 		k.Lock()
-		k.pods[pod.Metadata.Name] = &pod
+		k.pods[podKey(&pod)] = &pod
 		k.Unlock()
 		return
 
@@ -177,7 +249,7 @@ func (k *k8sWatcher) handleEvent(event watch.Event) {
 		}
 
 		k.Lock()
-		delete(k.pods, pod.Metadata.Name)
+		delete(k.pods, podKey(&pod))
 		k.Unlock()
 		return
 	}
@@ -211,15 +283,19 @@ func newWatcher(kr *kregistry, opts ...registry.WatchOption) (registry.Watcher,
 		o(&wo)
 	}
 
-	selector := podSelector
+	namespaces := kr.namespaces()
+	selector := kr.selector(podSelector)
 	if len(wo.Service) > 0 {
-		selector = map[string]string{
+		namespaces = kr.serviceNamespaces(wo.Service)
+		selector = kr.selector(map[string]string{
 			svcSelectorPrefix + serviceName(wo.Service): svcSelectorValue,
-		}
+		})
 	}
 
 	// Create watch request
-	watcher, err := kr.client.WatchPods(selector)
+	watcher, err := watchNamespaces(namespaces, func(ns string) (watch.Watch, error) {
+		return kr.client.WatchPods(ns, selector)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -232,7 +308,7 @@ func newWatcher(kr *kregistry, opts ...registry.WatchOption) (registry.Watcher,
 	}
 
 	// update cache, but dont emit changes
-	if _, err := k.updateCache(); err != nil {
+	if _, err := k.updateCache(namespaces); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,175 @@
+package mdns
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+/*
+	The service, version, endpoints and node metadata are stored as zlib compressed
+	JSON, hex encoded and split into TXT strings of at most 255 bytes, the record
+	of the mdns registry of go-micro so both decode each other.
+
+	Resolvers and reflectors don't have to keep the order of the strings though,
+	with the IndexedRecords option the JSON is base64 encoded and every chunk is
+	prefixed by its index, e.g. "0=eJy...", and the record starts with "txtvers=2".
+	Both records are decoded, go-micro only decodes the hex one.
+*/
+
+const (
+	txtVersion = "txtvers=2"
+
+	// max length of a single TXT string
+	maxTXTLength = 255
+)
+
+type mdnsTxt struct {
+	Service   string
+	Version   string
+	Endpoints []*registry.Endpoint
+	Metadata  map[string]string
+}
+
+// compress returns the zlib compressed JSON of the txt
+func compress(txt *mdnsTxt) ([]byte, error) {
+	b, err := json.Marshal(txt)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encode returns the hex record of go-micro
+func encode(txt *mdnsTxt) ([]string, error) {
+	b, err := compress(txt)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := hex.EncodeToString(b)
+
+	var record []string
+	for len(encoded) > maxTXTLength {
+		record = append(record, encoded[:maxTXTLength])
+		encoded = encoded[maxTXTLength:]
+	}
+	return append(record, encoded), nil
+}
+
+// encodeIndexed returns the record of indexed base64 chunks
+func encodeIndexed(txt *mdnsTxt) ([]string, error) {
+	b, err := compress(txt)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := base64.RawStdEncoding.EncodeToString(b)
+
+	record := []string{txtVersion}
+	for i := 0; len(encoded) > 0; i++ {
+		prefix := strconv.Itoa(i) + "="
+		n := maxTXTLength - len(prefix)
+		if n > len(encoded) {
+			n = len(encoded)
+		}
+		record = append(record, prefix+encoded[:n])
+		encoded = encoded[n:]
+	}
+
+	return record, nil
+}
+
+func decode(record []string) (*mdnsTxt, error) {
+	var (
+		b   []byte
+		err error
+	)
+
+	if len(record) > 0 && contains(record, txtVersion) {
+		b, err = decodeChunks(record)
+	} else {
+		b, err = hex.DecodeString(strings.Join(record, ""))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	rbuf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var txt *mdnsTxt
+	if err := json.Unmarshal(rbuf, &txt); err != nil {
+		return nil, err
+	}
+	return txt, nil
+}
+
+// decodeChunks joins the indexed chunks in order
+func decodeChunks(record []string) ([]byte, error) {
+	chunks := make(map[int]string, len(record))
+	var indexes []int
+
+	for _, s := range record {
+		parts := strings.SplitN(s, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		i, err := strconv.Atoi(parts[0])
+		if err != nil {
+			// txtvers and other keys
+			continue
+		}
+		if _, ok := chunks[i]; !ok {
+			indexes = append(indexes, i)
+		}
+		chunks[i] = parts[1]
+	}
+
+	sort.Ints(indexes)
+
+	var encoded strings.Builder
+	for n, i := range indexes {
+		if n != i {
+			return nil, errors.New("missing chunk " + strconv.Itoa(n))
+		}
+		encoded.WriteString(chunks[i])
+	}
+
+	return base64.RawStdEncoding.DecodeString(encoded.String())
+}
+
+func contains(s []string, e string) bool {
+	for _, a := range s {
+		if a == e {
+			return true
+		}
+	}
+	return false
+}
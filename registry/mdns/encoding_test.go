@@ -0,0 +1,127 @@
+package mdns
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+func TestEncoding(t *testing.T) {
+	var endpoints []*registry.Endpoint
+	for i := 0; i < 50; i++ {
+		endpoints = append(endpoints, &registry.Endpoint{
+			Name:     "Foo.Method" + strconv.Itoa(i),
+			Request:  &registry.Value{Name: "Request", Type: "Request"},
+			Response: &registry.Value{Name: "Response", Type: "Response"},
+			Metadata: map[string]string{"stream": "true", "handler": "rpc", "description": strings.Repeat("x", i)},
+		})
+	}
+
+	txt := &mdnsTxt{
+		Service:   "go.micro.srv.foo",
+		Version:   "1.0.0",
+		Endpoints: endpoints,
+		Metadata:  map[string]string{"protocol": "grpc"},
+	}
+
+	record, err := encodeIndexed(txt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(record) < 3 || record[0] != txtVersion {
+		t.Fatalf("expected a versioned record of several chunks, got %d strings", len(record))
+	}
+	for _, s := range record {
+		if len(s) > maxTXTLength {
+			t.Fatalf("expected strings of at most %d bytes, got %d", maxTXTLength, len(s))
+		}
+	}
+
+	// reflectors don't have to keep the order
+	shuffled := append([]string{}, record[1:]...)
+	for i, j := 0, len(shuffled)-1; i < j; i, j = i+1, j-1 {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	shuffled = append(shuffled, record[0])
+
+	decoded, err := decode(shuffled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Service != txt.Service || decoded.Version != txt.Version || decoded.Metadata["protocol"] != "grpc" {
+		t.Fatalf("unexpected txt %+v", decoded)
+	}
+	if len(decoded.Endpoints) != 50 || decoded.Endpoints[49].Metadata["description"] != strings.Repeat("x", 49) {
+		t.Fatal("expected the endpoints with their metadata")
+	}
+
+	if _, err := decode(append(record[:1], record[2:]...)); err == nil {
+		t.Fatal("expected records with a missing chunk to fail")
+	}
+}
+
+func TestDecodeLegacy(t *testing.T) {
+	b, err := json.Marshal(&mdnsTxt{Service: "foo", Version: "latest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+
+	encoded := hex.EncodeToString(buf.Bytes())
+	txt, err := decode([]string{encoded[:10], encoded[10:]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txt.Service != "foo" || txt.Version != "latest" {
+		t.Fatalf("unexpected txt %+v", txt)
+	}
+}
+
+func TestEncodeLegacy(t *testing.T) {
+	txt := &mdnsTxt{
+		Service:  "foo",
+		Version:  "latest",
+		Metadata: map[string]string{"description": strings.Repeat("x", 1000)},
+	}
+	for i := 0; i < 50; i++ {
+		txt.Metadata[strconv.Itoa(i)] = strconv.Itoa(i * i * i)
+	}
+
+	record, err := encode(txt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(record) < 2 {
+		t.Fatalf("expected a record of several strings, got %d", len(record))
+	}
+
+	// decoded the way go-micro does, joining the strings
+	b, err := hex.DecodeString(strings.Join(record, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded *mdnsTxt
+	if err := json.NewDecoder(r).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Service != "foo" || decoded.Metadata["49"] != "117649" {
+		t.Fatalf("unexpected txt %+v", decoded)
+	}
+
+	if decoded, err = decode(record); err != nil || decoded.Service != "foo" {
+		t.Fatalf("expected the record to decode, got %v", err)
+	}
+}
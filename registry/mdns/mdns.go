@@ -2,21 +2,486 @@
 package mdns
 
 import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
 	"github.com/micro/go-micro/v2/config/cmd"
+	log "github.com/micro/go-micro/v2/logger"
 	"github.com/micro/go-micro/v2/registry"
-	"github.com/micro/go-micro/v2/registry/mdns"
+	"github.com/micro/go-micro/v2/util/mdns"
+)
+
+var (
+	// DefaultDomain is the mdns domain without the Domain option
+	DefaultDomain = "local"
 )
 
+type mdnsEntry struct {
+	id   string
+	node *mdns.Server
+}
+
+type mdnsRegistry struct {
+	opts   registry.Options
+	domain string
+	iface  *net.Interface
+
+	sync.Mutex
+	services map[string][]*mdnsEntry
+
+	mtx sync.RWMutex
+	// watchers
+	watchers map[string]*mdnsWatcher
+	// listener
+	listener chan *mdns.ServiceEntry
+}
+
 func init() {
 	cmd.DefaultRegistries["mdns"] = NewRegistry
 }
 
+func configure(m *mdnsRegistry, opts ...registry.Option) error {
+	for _, o := range opts {
+		o(&m.opts)
+	}
+
+	domain := DefaultDomain
+	if d, ok := m.opts.Context.Value(domainKey{}).(string); ok && len(strings.Trim(d, ".")) > 0 {
+		domain = strings.Trim(d, ".")
+	}
+
+	var iface *net.Interface
+	if name, ok := m.opts.Context.Value(interfaceKey{}).(string); ok && len(name) > 0 {
+		i, err := net.InterfaceByName(name)
+		if err != nil {
+			return err
+		}
+		iface = i
+	}
+
+	m.Lock()
+	m.domain = domain
+	m.iface = iface
+	m.Unlock()
+	return nil
+}
+
+// ips returns the addresses the node is announced with
+func (m *mdnsRegistry) ips(host string) ([]net.IP, error) {
+	ip := net.ParseIP(host)
+	switch {
+	case ip != nil && !ip.IsUnspecified():
+		return []net.IP{ip}, nil
+	case ip == nil && len(host) > 0:
+		return net.LookupIP(host)
+	}
+
+	// without an interface the addresses of the hostname are announced
+	if m.iface == nil {
+		return nil, nil
+	}
+
+	addrs, err := m.iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []net.IP
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok {
+			ips = append(ips, ipnet.IP)
+		}
+	}
+	return ips, nil
+}
+
+// address returns the address of the entry, preferring ipv4
+func address(e *mdns.ServiceEntry) (string, bool) {
+	var ip net.IP
+	switch {
+	case len(e.AddrV4) > 0:
+		ip = e.AddrV4
+	case len(e.AddrV6) > 0:
+		ip = e.AddrV6
+	default:
+		return "", false
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(e.Port)), true
+}
+
+func (m *mdnsRegistry) newServer(instance, service string, port int, ips []net.IP, txt []string) (*mdns.Server, error) {
+	s, err := mdns.NewMDNSService(instance, service, m.domain+".", "", port, ips, txt)
+	if err != nil {
+		return nil, err
+	}
+
+	return mdns.NewServer(&mdns.Config{
+		Zone:              s,
+		Iface:             m.iface,
+		LocalhostChecking: true,
+	})
+}
+
+func (m *mdnsRegistry) query(service string, entries chan *mdns.ServiceEntry) (*mdns.QueryParam, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.opts.Timeout)
+
+	return &mdns.QueryParam{
+		Service:   service,
+		Domain:    m.domain,
+		Context:   ctx,
+		Timeout:   m.opts.Timeout,
+		Interface: m.iface,
+		Entries:   entries,
+	}, cancel
+}
+
+func (m *mdnsRegistry) Init(opts ...registry.Option) error {
+	return configure(m, opts...)
+}
+
+func (m *mdnsRegistry) Options() registry.Options {
+	return m.opts
+}
+
+func (m *mdnsRegistry) Register(service *registry.Service, opts ...registry.RegisterOption) error {
+	m.Lock()
+	defer m.Unlock()
+
+	entries, ok := m.services[service.Name]
+	// first entry, create wildcard used for list queries
+	if !ok {
+		srv, err := m.newServer(service.Name, "_services", 9999, []net.IP{net.ParseIP("0.0.0.0")}, nil)
+		if err != nil {
+			return err
+		}
+
+		// append the wildcard entry
+		entries = append(entries, &mdnsEntry{id: "*", node: srv})
+	}
+
+	var gerr error
+
+	for _, node := range service.Nodes {
+		var seen bool
+		for _, entry := range entries {
+			if node.Id == entry.id {
+				seen = true
+				break
+			}
+		}
+
+		// already registered, continue
+		if seen {
+			continue
+		}
+
+		enc := encode
+		if v, ok := m.opts.Context.Value(indexedRecordsKey{}).(bool); ok && v {
+			enc = encodeIndexed
+		}
+		txt, err := enc(&mdnsTxt{
+			Service:   service.Name,
+			Version:   service.Version,
+			Endpoints: service.Endpoints,
+			Metadata:  node.Metadata,
+		})
+		if err != nil {
+			gerr = err
+			continue
+		}
+
+		host, pt, err := net.SplitHostPort(node.Address)
+		if err != nil {
+			gerr = err
+			continue
+		}
+		port, err := strconv.Atoi(pt)
+		if err != nil {
+			gerr = err
+			continue
+		}
+
+		ips, err := m.ips(host)
+		if err != nil {
+			gerr = err
+			continue
+		}
+
+		srv, err := m.newServer(node.Id, service.Name, port, ips, txt)
+		if err != nil {
+			gerr = err
+			continue
+		}
+
+		entries = append(entries, &mdnsEntry{id: node.Id, node: srv})
+	}
+
+	// save
+	m.services[service.Name] = entries
+
+	return gerr
+}
+
+func (m *mdnsRegistry) Deregister(service *registry.Service, opts ...registry.DeregisterOption) error {
+	m.Lock()
+	defer m.Unlock()
+
+	var newEntries []*mdnsEntry
+
+	// loop existing entries, check if any match, shutdown those that do
+	for _, entry := range m.services[service.Name] {
+		var remove bool
+
+		for _, node := range service.Nodes {
+			if node.Id == entry.id {
+				entry.node.Shutdown()
+				remove = true
+				break
+			}
+		}
+
+		// keep it?
+		if !remove {
+			newEntries = append(newEntries, entry)
+		}
+	}
+
+	// last entry is the wildcard for list queries. Remove it.
+	if len(newEntries) == 1 && newEntries[0].id == "*" {
+		newEntries[0].node.Shutdown()
+		delete(m.services, service.Name)
+	} else {
+		m.services[service.Name] = newEntries
+	}
+
+	return nil
+}
+
+func (m *mdnsRegistry) GetService(service string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	serviceMap := make(map[string]*registry.Service)
+	entries := make(chan *mdns.ServiceEntry, 10)
+	done := make(chan bool)
+
+	p, cancel := m.query(service, entries)
+	defer cancel()
+
+	suffix := "." + service + "." + p.Domain + "."
+
+	go func() {
+		for {
+			select {
+			case e := <-entries:
+				if e.TTL == 0 {
+					continue
+				}
+
+				txt, err := decode(e.InfoFields)
+				if err != nil {
+					log.Debugf("[mdns] failed to decode %s: %v", e.Name, err)
+					continue
+				}
+
+				if txt.Service != service {
+					continue
+				}
+
+				addr, ok := address(e)
+				if !ok {
+					continue
+				}
+
+				s, ok := serviceMap[txt.Version]
+				if !ok {
+					s = &registry.Service{
+						Name:      txt.Service,
+						Version:   txt.Version,
+						Endpoints: txt.Endpoints,
+					}
+					serviceMap[txt.Version] = s
+				}
+
+				s.Nodes = append(s.Nodes, &registry.Node{
+					Id:       strings.TrimSuffix(e.Name, suffix),
+					Address:  addr,
+					Metadata: txt.Metadata,
+				})
+			case <-p.Context.Done():
+				close(done)
+				return
+			}
+		}
+	}()
+
+	// execute the query
+	if err := mdns.Query(p); err != nil {
+		return nil, err
+	}
+
+	// wait for completion
+	<-done
+
+	if len(serviceMap) == 0 {
+		return nil, registry.ErrNotFound
+	}
+
+	// create list and return
+	services := make([]*registry.Service, 0, len(serviceMap))
+	for _, service := range serviceMap {
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
+func (m *mdnsRegistry) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
+	serviceMap := make(map[string]bool)
+	entries := make(chan *mdns.ServiceEntry, 10)
+	done := make(chan bool)
+
+	p, cancel := m.query("_services", entries)
+	defer cancel()
+
+	var services []*registry.Service
+
+	go func() {
+		for {
+			select {
+			case e := <-entries:
+				if e.TTL == 0 {
+					continue
+				}
+
+				name := strings.TrimSuffix(e.Name, "."+p.Service+"."+p.Domain+".")
+				if !serviceMap[name] {
+					serviceMap[name] = true
+					services = append(services, &registry.Service{Name: name})
+				}
+			case <-p.Context.Done():
+				close(done)
+				return
+			}
+		}
+	}()
+
+	// execute query
+	if err := mdns.Query(p); err != nil {
+		return nil, err
+	}
+
+	// wait till done
+	<-done
+
+	return services, nil
+}
+
+func (m *mdnsRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	var wo registry.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	md := &mdnsWatcher{
+		id:       uuid.New().String(),
+		wo:       wo,
+		ch:       make(chan *mdns.ServiceEntry, 32),
+		exit:     make(chan struct{}),
+		domain:   m.domain,
+		registry: m,
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	// save the watcher
+	m.watchers[md.id] = md
+
+	// check of the listener exists
+	if m.listener != nil {
+		return md, nil
+	}
+
+	// start the listener
+	m.listener = make(chan *mdns.ServiceEntry, 32)
+	go m.listen(m.listener)
+
+	return md, nil
+}
+
+// listen sends the entries announced on the network to the watchers, until
+// there are no watchers left
+func (m *mdnsRegistry) listen(ch chan *mdns.ServiceEntry) {
+	exit := make(chan struct{})
+
+	go func() {
+		for e := range ch {
+			m.mtx.RLock()
+			for _, w := range m.watchers {
+				select {
+				case w.ch <- e:
+				default:
+				}
+			}
+			m.mtx.RUnlock()
+		}
+	}()
+
+	go func() {
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+
+		for range t.C {
+			m.mtx.Lock()
+			if len(m.watchers) > 0 {
+				m.mtx.Unlock()
+				continue
+			}
+			// new watchers start a new listener
+			if m.listener == ch {
+				m.listener = nil
+			}
+			m.mtx.Unlock()
+			close(exit)
+			return
+		}
+	}()
+
+	// blocks until exit is closed
+	if err := mdns.Listen(ch, exit); err != nil {
+		log.Errorf("[mdns] failed to listen: %v", err)
+	}
+
+	m.mtx.Lock()
+	if m.listener == ch {
+		m.listener = nil
+	}
+	m.mtx.Unlock()
+	close(ch)
+}
+
+func (m *mdnsRegistry) String() string {
+	return "mdns"
+}
+
 // NewRegistry returns a new mdns registry
 func NewRegistry(opts ...registry.Option) registry.Registry {
-	return registry.NewRegistry(opts...)
-}
+	m := &mdnsRegistry{
+		opts: registry.Options{
+			Context: context.Background(),
+			Timeout: time.Millisecond * 100,
+		},
+		domain:   DefaultDomain,
+		services: make(map[string][]*mdnsEntry),
+		watchers: make(map[string]*mdnsWatcher),
+	}
+
+	if err := configure(m, opts...); err != nil {
+		log.Errorf("[mdns] failed to configure: %v", err)
+	}
 
-// Domain sets the mdnsDomain
-func Domain(d string) registry.Option {
-	return mdns.Domain(d)
+	return m
 }
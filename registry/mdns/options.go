@@ -0,0 +1,40 @@
+package mdns
+
+import (
+	"context"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+type domainKey struct{}
+type interfaceKey struct{}
+type indexedRecordsKey struct{}
+
+func setOption(k, v interface{}) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// Domain sets the mdns domain, "local" by default. Other domains are only
+// resolved by members using the same domain, or through a reflector serving it
+func Domain(d string) registry.Option {
+	return setOption(domainKey{}, d)
+}
+
+// Interface binds the registry to the network interface, e.g. eth0. Services are
+// announced and queried on the interface only, nodes without an address are
+// announced with the addresses of the interface
+func Interface(name string) registry.Option {
+	return setOption(interfaceKey{}, name)
+}
+
+// IndexedRecords announces the TXT records as indexed chunks, which are decoded
+// whatever order resolvers and reflectors return them in. The mdns registry of
+// go-micro can't decode them, so every service on the network should use the plugin
+func IndexedRecords() registry.Option {
+	return setOption(indexedRecordsKey{}, true)
+}
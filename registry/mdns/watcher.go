@@ -0,0 +1,85 @@
+package mdns
+
+import (
+	"strings"
+
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/util/mdns"
+)
+
+type mdnsWatcher struct {
+	id   string
+	wo   registry.WatchOptions
+	ch   chan *mdns.ServiceEntry
+	exit chan struct{}
+	// the mdns domain
+	domain string
+	// the registry
+	registry *mdnsRegistry
+}
+
+func (m *mdnsWatcher) Next() (*registry.Result, error) {
+	for {
+		select {
+		case e := <-m.ch:
+			txt, err := decode(e.InfoFields)
+			if err != nil {
+				continue
+			}
+
+			if len(txt.Service) == 0 || len(txt.Version) == 0 {
+				continue
+			}
+
+			// only keep services we care about
+			if len(m.wo.Service) > 0 && txt.Service != m.wo.Service {
+				continue
+			}
+
+			// skip anything without the domain we care about
+			suffix := "." + txt.Service + "." + m.domain + "."
+			if !strings.HasSuffix(e.Name, suffix) {
+				continue
+			}
+
+			addr, ok := address(e)
+			if !ok {
+				continue
+			}
+
+			action := "create"
+			if e.TTL == 0 {
+				action = "delete"
+			}
+
+			return &registry.Result{
+				Action: action,
+				Service: &registry.Service{
+					Name:      txt.Service,
+					Version:   txt.Version,
+					Endpoints: txt.Endpoints,
+					Nodes: []*registry.Node{{
+						Id:       strings.TrimSuffix(e.Name, suffix),
+						Address:  addr,
+						Metadata: txt.Metadata,
+					}},
+				},
+			}, nil
+		case <-m.exit:
+			return nil, registry.ErrWatcherStopped
+		}
+	}
+}
+
+func (m *mdnsWatcher) Stop() {
+	select {
+	case <-m.exit:
+		return
+	default:
+		close(m.exit)
+		// remove self from the registry
+		m.registry.mtx.Lock()
+		delete(m.registry.watchers, m.id)
+		m.registry.mtx.Unlock()
+	}
+}
@@ -1,216 +1,179 @@
+// Package multi provides a registry composing several registries
 package multi
 
 import (
 	"context"
+	"sort"
 	"sync"
 
 	log "github.com/micro/go-micro/v2/logger"
 	"github.com/micro/go-micro/v2/registry"
 )
 
+/*
+	Services are registered with every write registry and looked up in every
+	registry, e.g. to migrate from consul to kubernetes without a cutover. The
+	results are merged in priority order, a node served by several registries,
+	with the same id or address, is taken from the registry with the highest
+	priority. Registries which fail are skipped as long as one of them answers.
+*/
+
 type multiRegistry struct {
 	r    []registry.Registry
 	w    []registry.Registry
 	opts registry.Options
 }
 
-func (m *multiRegistry) Init(opts ...registry.Option) error {
-	return configure(m, opts...)
-}
-
-func (m *multiRegistry) Options() registry.Options {
-	return m.opts
-}
-
-func (m *multiRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+// each calls fn for every registry concurrently, it returns the errors in order
+func each(rs []registry.Registry, fn func(int, registry.Registry) error) []error {
 	var wg sync.WaitGroup
-	var errs []error
-
-	done := make(chan bool)
-	cerr := make(chan error)
-
-	wg.Add(len(m.w))
-
-	go func() {
-		for {
-			select {
-			case <-done:
-				return
-			case err := <-cerr:
-				errs = append(errs, err)
-				wg.Done()
-			}
-		}
-	}()
-
-	for _, mw := range m.w {
-		go func(w registry.Registry) {
-			if err := w.Register(s, opts...); err != nil {
-				cerr <- err
-			} else {
-				wg.Done()
-			}
-		}(mw)
+	errs := make([]error, len(rs))
+
+	for i, r := range rs {
+		wg.Add(1)
+		go func(i int, r registry.Registry) {
+			defer wg.Done()
+			errs[i] = fn(i, r)
+		}(i, r)
 	}
 
 	wg.Wait()
-	defer close(done)
+	return errs
+}
 
-	if len(errs) > 0 {
-		return errs[0]
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
 	}
-
 	return nil
-
 }
 
-func (m *multiRegistry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
-	var wg sync.WaitGroup
-	var errs []error
+// merge combines the services of the registries ordered by priority
+func merge(results [][]*registry.Service) []*registry.Service {
+	seen := make(map[string]bool)
+	versions := make(map[string]*registry.Service)
+	var services []*registry.Service
 
-	done := make(chan bool)
-	cerr := make(chan error)
+	for _, result := range results {
+		for _, s := range result {
+			if s == nil {
+				continue
+			}
 
-	wg.Add(len(m.w))
+			service, ok := versions[s.Version]
+			if !ok {
+				service = &registry.Service{
+					Name:      s.Name,
+					Version:   s.Version,
+					Metadata:  s.Metadata,
+					Endpoints: s.Endpoints,
+				}
+				versions[s.Version] = service
+				services = append(services, service)
+			}
+			if len(service.Endpoints) == 0 {
+				service.Endpoints = s.Endpoints
+			}
 
-	go func() {
-		for {
-			select {
-			case <-done:
-				return
-			case err := <-cerr:
-				errs = append(errs, err)
-				wg.Done()
+			for _, node := range s.Nodes {
+				// the node is served by a registry with a higher priority
+				if seen["id:"+node.Id] || (len(node.Address) > 0 && seen["address:"+node.Address]) {
+					continue
+				}
+				seen["id:"+node.Id] = true
+				if len(node.Address) > 0 {
+					seen["address:"+node.Address] = true
+				}
+				service.Nodes = append(service.Nodes, node)
 			}
 		}
-	}()
-
-	for _, mw := range m.w {
-		go func(w registry.Registry) {
-			if err := w.Deregister(s); err != nil {
-				cerr <- err
-			} else {
-				wg.Done()
-			}
-		}(mw)
 	}
 
-	wg.Wait()
-	defer close(done)
+	return services
+}
 
-	if len(errs) > 0 {
-		return errs[0]
-	}
+func (m *multiRegistry) Init(opts ...registry.Option) error {
+	return configure(m, opts...)
+}
 
-	return nil
+func (m *multiRegistry) Options() registry.Options {
+	return m.opts
+}
+
+func (m *multiRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	return firstError(each(m.w, func(_ int, r registry.Registry) error {
+		return r.Register(s, opts...)
+	}))
+}
+
+func (m *multiRegistry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
+	return firstError(each(m.w, func(_ int, r registry.Registry) error {
+		return r.Deregister(s, opts...)
+	}))
 }
 
 func (m *multiRegistry) GetService(n string, opts ...registry.GetOption) ([]*registry.Service, error) {
-	var wg sync.WaitGroup
-	var errs []error
-	var svcs []*registry.Service
-	var mu sync.Mutex
-
-	done := make(chan bool)
-	cerr := make(chan error)
-	csvc := make(chan []*registry.Service)
-
-	wg.Add(len(m.r))
-
-	go func() {
-		for {
-			select {
-			case <-done:
-				return
-			case err := <-cerr:
-				errs = append(errs, err)
-				wg.Done()
-			case svc := <-csvc:
-				mu.Lock()
-				svcs = append(svcs, svc...)
-				mu.Unlock()
-				wg.Done()
-			}
+	results := make([][]*registry.Service, len(m.r))
+
+	errs := each(m.r, func(i int, r registry.Registry) error {
+		services, err := r.GetService(n, opts...)
+		results[i] = services
+		return err
+	})
+
+	var failed []error
+	for i, err := range errs {
+		if err != nil && err != registry.ErrNotFound {
+			log.Debugf("[multi] failed to get %s from %s: %v", n, m.r[i], err)
+			failed = append(failed, err)
 		}
-	}()
-
-	for _, mr := range m.r {
-		go func(r registry.Registry) {
-			svc, err := r.GetService(n)
-			if err != nil && err != registry.ErrNotFound {
-				cerr <- err
-			} else {
-				csvc <- svc
-			}
-		}(mr)
 	}
 
-	wg.Wait()
-	defer close(done)
-
-	if len(errs) > 0 {
-		return nil, errs[0]
+	// every registry failed
+	if len(m.r) > 0 && len(failed) == len(m.r) {
+		return nil, failed[0]
 	}
 
-	mu.Lock()
-	if len(svcs) == 0 {
+	services := merge(results)
+	if len(services) == 0 {
 		return nil, registry.ErrNotFound
 	}
-	mu.Unlock()
-
-	return svcs, nil
+	return services, nil
 }
 
 func (m *multiRegistry) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
-	var wg sync.WaitGroup
-	var errs []error
-	var svcs []*registry.Service
-	var mu sync.Mutex
-
-	done := make(chan bool)
-	cerr := make(chan error)
-	csvc := make(chan []*registry.Service)
-
-	wg.Add(len(m.r))
-
-	go func() {
-		for {
-			select {
-			case <-done:
-				return
-			case err := <-cerr:
-				errs = append(errs, err)
-				wg.Done()
-			case svc := <-csvc:
-				mu.Lock()
-				svcs = append(svcs, svc...)
-				mu.Unlock()
-				wg.Done()
-			}
+	results := make([][]*registry.Service, len(m.r))
+
+	errs := each(m.r, func(i int, r registry.Registry) error {
+		services, err := r.ListServices(opts...)
+		results[i] = services
+		return err
+	})
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
 		}
-	}()
-
-	for _, mr := range m.r {
-		go func(r registry.Registry) {
-			if svc, err := r.ListServices(); err != nil {
-				cerr <- err
-			} else {
-				csvc <- svc
-			}
-		}(mr)
 	}
-
-	wg.Wait()
-	defer close(done)
-
-	if len(errs) > 0 {
-		return nil, errs[0]
+	if len(m.r) > 0 && len(failed) == len(m.r) {
+		return nil, failed[0]
 	}
 
-	mu.Lock()
-	ret := svcs
-	mu.Unlock()
-	return ret, nil
+	seen := make(map[string]bool)
+	var services []*registry.Service
+	for _, result := range results {
+		for _, s := range result {
+			if s == nil || seen[s.Name+":"+s.Version] {
+				continue
+			}
+			seen[s.Name+":"+s.Version] = true
+			services = append(services, s)
+		}
+	}
+	return services, nil
 }
 
 func (m *multiRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
@@ -245,10 +208,30 @@ func configure(m *multiRegistry, opts ...registry.Option) error {
 		m.w = w
 	}
 
-	m.r = m.w
+	m.r = append([]registry.Registry{}, m.w...)
 
 	if r, ok := m.opts.Context.Value(readKey{}).([]registry.Registry); ok && r != nil {
-		m.r = append(m.r, r...)
+		for _, rr := range r {
+			if !contains(m.r, rr) {
+				m.r = append(m.r, rr)
+			}
+		}
 	}
+
+	// highest priority first, then in the order of the options
+	priorities, _ := m.opts.Context.Value(priorityKey{}).(map[registry.Registry]int)
+	sort.SliceStable(m.r, func(i, j int) bool {
+		return priorities[m.r[i]] > priorities[m.r[j]]
+	})
+
 	return nil
 }
+
+func contains(rs []registry.Registry, r registry.Registry) bool {
+	for _, rr := range rs {
+		if rr == r {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package multi
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+type mockRegistry struct {
+	registry.Registry
+
+	name       string
+	services   []*registry.Service
+	err        error
+	registered []*registry.Service
+	results    chan *registry.Result
+}
+
+func (m *mockRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	m.registered = append(m.registered, s)
+	return m.err
+}
+
+func (m *mockRegistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if len(m.services) == 0 {
+		return nil, registry.ErrNotFound
+	}
+	return m.services, nil
+}
+
+func (m *mockRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	return &mockWatcher{results: m.results, exit: make(chan bool)}, nil
+}
+
+func (m *mockRegistry) String() string {
+	return m.name
+}
+
+type mockWatcher struct {
+	results chan *registry.Result
+	exit    chan bool
+}
+
+func (w *mockWatcher) Next() (*registry.Result, error) {
+	select {
+	case r := <-w.results:
+		return r, nil
+	case <-w.exit:
+		return nil, registry.ErrWatcherStopped
+	}
+}
+
+func (w *mockWatcher) Stop() {
+	close(w.exit)
+}
+
+func node(id, address string, md string) *registry.Node {
+	return &registry.Node{Id: id, Address: address, Metadata: map[string]string{"registry": md}}
+}
+
+func TestGetService(t *testing.T) {
+	consul := &mockRegistry{name: "consul", services: []*registry.Service{{
+		Name: "foo", Version: "1",
+		Nodes: []*registry.Node{node("foo-1", "10.0.0.1:8080", "consul"), node("foo-2", "10.0.0.2:8080", "consul")},
+	}}}
+	kubernetes := &mockRegistry{name: "kubernetes", services: []*registry.Service{{
+		Name: "foo", Version: "1",
+		Nodes: []*registry.Node{node("foo-1", "10.0.0.1:8080", "kubernetes"), node("pod-3", "10.0.0.3:8080", "kubernetes")},
+	}}}
+
+	r := NewRegistry(WriteRegistry(consul), ReadRegistry(kubernetes), Priority(kubernetes, 1))
+
+	services, err := r.GetService("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 1 || len(services[0].Nodes) != 3 {
+		t.Fatalf("expected 3 nodes of 1 version, got %+v", services)
+	}
+
+	registries := make(map[string]string)
+	for _, n := range services[0].Nodes {
+		registries[n.Id] = n.Metadata["registry"]
+	}
+	expect := map[string]string{"foo-1": "kubernetes", "pod-3": "kubernetes", "foo-2": "consul"}
+	for id, name := range expect {
+		if registries[id] != name {
+			t.Fatalf("expected %s from %s, got %v", id, name, registries)
+		}
+	}
+
+	// nodes with the same address are the same node
+	kubernetes.services = append(kubernetes.services, &registry.Service{
+		Name: "foo", Version: "2",
+		Nodes: []*registry.Node{node("pod-4", "10.0.0.2:8080", "kubernetes")},
+	})
+	services, err = r.GetService("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 2 || len(services[0].Nodes) != 2 || services[1].Nodes[0].Id != "pod-4" {
+		t.Fatalf("expected foo-2 to be served by kubernetes as pod-4, got %+v", services)
+	}
+
+	// lookups succeed while one registry is down
+	consul.err = errors.New("consul is down")
+	if services, err := r.GetService("foo"); err != nil || len(services) != 2 {
+		t.Fatalf("expected the services of kubernetes, got %v %v", services, err)
+	}
+
+	kubernetes.err = errors.New("kubernetes is down")
+	if _, err := r.GetService("foo"); err == nil || err == registry.ErrNotFound {
+		t.Fatalf("expected an error when every registry is down, got %v", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	consul := &mockRegistry{name: "consul"}
+	kubernetes := &mockRegistry{name: "kubernetes"}
+	etcd := &mockRegistry{name: "etcd"}
+
+	r := NewRegistry(WriteRegistry(consul, kubernetes), ReadRegistry(etcd))
+	if err := r.Register(&registry.Service{Name: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(consul.registered) != 1 || len(kubernetes.registered) != 1 || len(etcd.registered) != 0 {
+		t.Fatal("expected the service to be registered with the write registries only")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	consul := &mockRegistry{name: "consul", results: make(chan *registry.Result)}
+	kubernetes := &mockRegistry{name: "kubernetes", results: make(chan *registry.Result)}
+
+	r := NewRegistry(WriteRegistry(consul), ReadRegistry(kubernetes))
+	w, err := r.Watch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	go func() {
+		consul.results <- &registry.Result{Action: "create", Service: &registry.Service{Name: "foo"}}
+		kubernetes.results <- &registry.Result{Action: "delete", Service: &registry.Service{Name: "bar"}}
+	}()
+
+	actions := make(map[string]string)
+	for i := 0; i < 2; i++ {
+		res, err := w.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		actions[res.Service.Name] = res.Action
+	}
+	if actions["foo"] != "create" || actions["bar"] != "delete" {
+		t.Fatalf("unexpected results %v", actions)
+	}
+}
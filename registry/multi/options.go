@@ -8,6 +8,7 @@ import (
 
 type writeKey struct{}
 type readKey struct{}
+type priorityKey struct{}
 
 // helper for setting registry options
 func setRegistryOption(k, v interface{}) registry.Option {
@@ -28,3 +29,22 @@ func WriteRegistry(w ...registry.Registry) registry.Option {
 func ReadRegistry(r ...registry.Registry) registry.Option {
 	return setRegistryOption(readKey{}, r)
 }
+
+// Priority sets the priority of a registry, nodes served by several registries are
+// taken from the one with the highest priority. Registries default to 0, those
+// with the same priority are ordered by the options, write registries first
+func Priority(r registry.Registry, p int) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		priorities := make(map[registry.Registry]int)
+		if prev, ok := o.Context.Value(priorityKey{}).(map[registry.Registry]int); ok {
+			for k, v := range prev {
+				priorities[k] = v
+			}
+		}
+		priorities[r] = p
+		o.Context = context.WithValue(o.Context, priorityKey{}, priorities)
+	}
+}
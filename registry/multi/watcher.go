@@ -6,11 +6,18 @@ import (
 	"github.com/micro/go-micro/v2/registry"
 )
 
+type result struct {
+	res *registry.Result
+	err error
+}
+
+// multiWatcher fans in the results of the watchers of every registry
 type multiWatcher struct {
 	wo   registry.WatchOptions
 	w    []registry.Watcher
-	next chan *registry.Result
+	next chan result
 	stop chan bool
+	once sync.Once
 }
 
 func newMultiWatcher(r []registry.Registry, opts ...registry.WatchOption) (registry.Watcher, error) {
@@ -21,67 +28,72 @@ func newMultiWatcher(r []registry.Registry, opts ...registry.WatchOption) (regis
 
 	mw := &multiWatcher{
 		wo:   wo,
-		next: make(chan *registry.Result),
+		next: make(chan result),
 		stop: make(chan bool),
 	}
 
 	for _, wr := range r {
 		w, err := wr.Watch(opts...)
 		if err != nil {
+			mw.Stop()
 			return nil, err
 		}
 		mw.w = append(mw.w, w)
 	}
 
+	for _, w := range mw.w {
+		go mw.run(w)
+	}
+
 	return mw, nil
 }
 
-func (mw *multiWatcher) Next() (*registry.Result, error) {
-	cerr := make(chan error)
-
-	for _, wt := range mw.w {
-		go func(w registry.Watcher) {
-			r, err := w.Next()
-			if err != nil && err != registry.ErrNotFound {
-				cerr <- err
-			}
-			mw.next <- r
-		}(wt)
-	}
-
+// run forwards the results of the watcher until it fails or is stopped
+func (mw *multiWatcher) run(w registry.Watcher) {
 	for {
+		r, err := w.Next()
+		if err == nil && r == nil {
+			continue
+		}
+
 		select {
-		case err := <-cerr:
-			return nil, err
-		case r, ok := <-mw.next:
-			if !ok {
-				return nil, registry.ErrWatcherStopped
-			}
-			nr := &registry.Result{}
-			*nr = *r
-			return nr, nil
+		case mw.next <- result{res: r, err: err}:
 		case <-mw.stop:
-			return nil, registry.ErrWatcherStopped
+			return
 		}
-	}
-}
 
-func (mw *multiWatcher) Stop() {
-	var wg sync.WaitGroup
-	wg.Add(len(mw.w))
-
-	for _, w := range mw.w {
-		go func(w registry.Watcher) {
-			w.Stop()
-			wg.Done()
-		}(w)
+		if err != nil {
+			return
+		}
 	}
+}
 
-	wg.Wait()
+func (mw *multiWatcher) Next() (*registry.Result, error) {
 	select {
+	case r := <-mw.next:
+		if r.err != nil {
+			return nil, r.err
+		}
+		nr := &registry.Result{}
+		*nr = *r.res
+		return nr, nil
 	case <-mw.stop:
-		return
-	default:
-		close(mw.stop)
+		return nil, registry.ErrWatcherStopped
 	}
 }
+
+func (mw *multiWatcher) Stop() {
+	mw.once.Do(func() {
+		close(mw.stop)
+
+		var wg sync.WaitGroup
+		for _, w := range mw.w {
+			wg.Add(1)
+			go func(w registry.Watcher) {
+				defer wg.Done()
+				w.Stop()
+			}(w)
+		}
+		wg.Wait()
+	})
+}
@@ -0,0 +1,8 @@
+module github.com/micro/go-plugins/registry/nacos/v2
+
+go 1.13
+
+require (
+	github.com/micro/go-micro/v2 v2.9.1
+	github.com/nacos-group/nacos-sdk-go v1.0.8
+)
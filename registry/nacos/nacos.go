@@ -0,0 +1,322 @@
+// Package nacos provides a nacos registry
+package nacos
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/config/cmd"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/nacos-group/nacos-sdk-go/clients"
+	"github.com/nacos-group/nacos-sdk-go/common/constant"
+	"github.com/nacos-group/nacos-sdk-go/model"
+	"github.com/nacos-group/nacos-sdk-go/vo"
+)
+
+/*
+	Every node is registered as an ephemeral nacos instance, kept alive by the
+	heartbeats of the nacos client. The version of the service is stored in the
+	instance metadata next to the metadata of the node, so services registered by
+	Spring Cloud Alibaba are discovered with an empty version.
+*/
+
+var (
+	// DefaultGroup is the group of services without the Group option
+	DefaultGroup = "DEFAULT_GROUP"
+
+	// metadata key of the service version
+	versionKey = "version"
+
+	// page size when listing services
+	pageSize = 500
+)
+
+// namingClient is the part of the nacos naming client used by the registry
+type namingClient interface {
+	RegisterInstance(param vo.RegisterInstanceParam) (bool, error)
+	DeregisterInstance(param vo.DeregisterInstanceParam) (bool, error)
+	SelectInstances(param vo.SelectInstancesParam) ([]model.Instance, error)
+	GetAllServicesInfo(param vo.GetAllServiceInfoParam) (model.ServiceList, error)
+	Subscribe(param *vo.SubscribeParam) error
+	Unsubscribe(param *vo.SubscribeParam) error
+}
+
+type nacosRegistry struct {
+	sync.RWMutex
+	client namingClient
+	opts   registry.Options
+}
+
+func init() {
+	cmd.DefaultRegistries["nacos"] = NewRegistry
+}
+
+func configure(n *nacosRegistry, opts ...registry.Option) error {
+	for _, o := range opts {
+		o(&n.opts)
+	}
+
+	var servers []constant.ServerConfig
+	for _, address := range n.opts.Addrs {
+		if len(address) == 0 {
+			continue
+		}
+		host, port, err := net.SplitHostPort(address)
+		if ae, ok := err.(*net.AddrError); ok && ae.Err == "missing port in address" {
+			host, port = address, "8848"
+		} else if err != nil {
+			return err
+		}
+		p, err := strconv.ParseUint(port, 10, 64)
+		if err != nil {
+			return err
+		}
+		servers = append(servers, constant.ServerConfig{
+			IpAddr:      host,
+			Port:        p,
+			ContextPath: "/nacos",
+		})
+	}
+	if len(servers) == 0 {
+		servers = []constant.ServerConfig{{IpAddr: "127.0.0.1", Port: 8848, ContextPath: "/nacos"}}
+	}
+
+	config := constant.ClientConfig{
+		TimeoutMs:           5000,
+		NotLoadCacheAtStart: true,
+	}
+	if n.opts.Timeout > 0 {
+		config.TimeoutMs = uint64(n.opts.Timeout / time.Millisecond)
+	}
+	config.NamespaceId = n.namespace()
+	if creds, ok := n.opts.Context.Value(authKey{}).(*authCreds); ok {
+		config.Username = creds.Username
+		config.Password = creds.Password
+	}
+
+	client, err := clients.CreateNamingClient(map[string]interface{}{
+		"serverConfigs": servers,
+		"clientConfig":  config,
+	})
+	if err != nil {
+		return err
+	}
+
+	n.Lock()
+	n.client = client
+	n.Unlock()
+	return nil
+}
+
+func (n *nacosRegistry) getClient() namingClient {
+	n.RLock()
+	defer n.RUnlock()
+	return n.client
+}
+
+func (n *nacosRegistry) namespace() string {
+	ns, _ := n.opts.Context.Value(namespaceKey{}).(string)
+	return ns
+}
+
+func (n *nacosRegistry) group() string {
+	if g, ok := n.opts.Context.Value(groupKey{}).(string); ok && len(g) > 0 {
+		return g
+	}
+	return DefaultGroup
+}
+
+func (n *nacosRegistry) cluster() string {
+	c, _ := n.opts.Context.Value(clusterKey{}).(string)
+	return c
+}
+
+func (n *nacosRegistry) clusters() []string {
+	if c := n.cluster(); len(c) > 0 {
+		return []string{c}
+	}
+	return nil
+}
+
+func splitAddress(address string) (string, uint64, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, err
+	}
+	p, err := strconv.ParseUint(port, 10, 64)
+	if err != nil {
+		return "", 0, err
+	}
+	return host, p, nil
+}
+
+// instancesToServices groups the healthy instances into services by version
+func instancesToServices(name string, instances []model.Instance) []*registry.Service {
+	services := make(map[string]*registry.Service)
+	var list []*registry.Service
+
+	for _, instance := range instances {
+		if !instance.Enable || !instance.Healthy {
+			continue
+		}
+
+		metadata := make(map[string]string, len(instance.Metadata))
+		for k, v := range instance.Metadata {
+			metadata[k] = v
+		}
+		version := metadata[versionKey]
+		delete(metadata, versionKey)
+
+		service, ok := services[version]
+		if !ok {
+			service = &registry.Service{Name: name, Version: version}
+			services[version] = service
+			list = append(list, service)
+		}
+		service.Nodes = append(service.Nodes, &registry.Node{
+			Id:       instance.InstanceId,
+			Address:  net.JoinHostPort(instance.Ip, strconv.FormatUint(instance.Port, 10)),
+			Metadata: metadata,
+		})
+	}
+
+	return list
+}
+
+func (n *nacosRegistry) Init(opts ...registry.Option) error {
+	return configure(n, opts...)
+}
+
+func (n *nacosRegistry) Options() registry.Options {
+	return n.opts
+}
+
+func (n *nacosRegistry) Register(s *registry.Service, opts ...registry.RegisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("Require at least one node")
+	}
+
+	for _, node := range s.Nodes {
+		host, port, err := splitAddress(node.Address)
+		if err != nil {
+			return err
+		}
+
+		metadata := make(map[string]string, len(node.Metadata)+1)
+		for k, v := range node.Metadata {
+			metadata[k] = v
+		}
+		metadata[versionKey] = s.Version
+
+		ok, err := n.getClient().RegisterInstance(vo.RegisterInstanceParam{
+			Ip:          host,
+			Port:        port,
+			Weight:      1,
+			Enable:      true,
+			Healthy:     true,
+			Ephemeral:   true,
+			Metadata:    metadata,
+			ClusterName: n.cluster(),
+			ServiceName: s.Name,
+			GroupName:   n.group(),
+		})
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("nacos refused to register " + node.Address)
+		}
+	}
+
+	return nil
+}
+
+func (n *nacosRegistry) Deregister(s *registry.Service, opts ...registry.DeregisterOption) error {
+	if len(s.Nodes) == 0 {
+		return errors.New("Require at least one node")
+	}
+
+	for _, node := range s.Nodes {
+		host, port, err := splitAddress(node.Address)
+		if err != nil {
+			return err
+		}
+
+		if _, err := n.getClient().DeregisterInstance(vo.DeregisterInstanceParam{
+			Ip:          host,
+			Port:        port,
+			Cluster:     n.cluster(),
+			ServiceName: s.Name,
+			GroupName:   n.group(),
+			Ephemeral:   true,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (n *nacosRegistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	instances, err := n.getClient().SelectInstances(vo.SelectInstancesParam{
+		ServiceName: name,
+		GroupName:   n.group(),
+		Clusters:    n.clusters(),
+		HealthyOnly: true,
+	})
+	// the client returns an error when there are no instances
+	if err != nil && len(instances) == 0 {
+		return nil, registry.ErrNotFound
+	}
+
+	services := instancesToServices(name, instances)
+	if len(services) == 0 {
+		return nil, registry.ErrNotFound
+	}
+	return services, nil
+}
+
+func (n *nacosRegistry) ListServices(opts ...registry.ListOption) ([]*registry.Service, error) {
+	var services []*registry.Service
+
+	for page := 1; ; page++ {
+		list, err := n.getClient().GetAllServicesInfo(vo.GetAllServiceInfoParam{
+			NameSpace: n.namespace(),
+			GroupName: n.group(),
+			PageNo:    uint32(page),
+			PageSize:  uint32(pageSize),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range list.Doms {
+			services = append(services, &registry.Service{Name: name})
+		}
+		if len(list.Doms) < pageSize || int64(len(services)) >= list.Count {
+			return services, nil
+		}
+	}
+}
+
+func (n *nacosRegistry) Watch(opts ...registry.WatchOption) (registry.Watcher, error) {
+	return newWatcher(n, opts...)
+}
+
+func (n *nacosRegistry) String() string {
+	return "nacos"
+}
+
+func NewRegistry(opts ...registry.Option) registry.Registry {
+	n := &nacosRegistry{
+		opts: registry.Options{
+			Context: context.Background(),
+		},
+	}
+	configure(n, opts...)
+	return n
+}
@@ -0,0 +1,162 @@
+package nacos
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/nacos-group/nacos-sdk-go/model"
+	"github.com/nacos-group/nacos-sdk-go/vo"
+)
+
+type mockClient struct {
+	sync.Mutex
+	registered []vo.RegisterInstanceParam
+	instances  []model.Instance
+	subs       []*vo.SubscribeParam
+}
+
+func (m *mockClient) RegisterInstance(param vo.RegisterInstanceParam) (bool, error) {
+	m.Lock()
+	defer m.Unlock()
+	m.registered = append(m.registered, param)
+	return true, nil
+}
+
+func (m *mockClient) DeregisterInstance(param vo.DeregisterInstanceParam) (bool, error) {
+	return true, nil
+}
+
+func (m *mockClient) SelectInstances(param vo.SelectInstancesParam) ([]model.Instance, error) {
+	if len(m.instances) == 0 {
+		return nil, errors.New("instance list is empty!")
+	}
+	return m.instances, nil
+}
+
+func (m *mockClient) GetAllServicesInfo(param vo.GetAllServiceInfoParam) (model.ServiceList, error) {
+	return model.ServiceList{Count: 1, Doms: []string{"foo"}}, nil
+}
+
+func (m *mockClient) Subscribe(param *vo.SubscribeParam) error {
+	m.Lock()
+	defer m.Unlock()
+	m.subs = append(m.subs, param)
+	return nil
+}
+
+func (m *mockClient) Unsubscribe(param *vo.SubscribeParam) error {
+	return nil
+}
+
+func newTestRegistry(c *mockClient, opts ...registry.Option) *nacosRegistry {
+	n := &nacosRegistry{
+		client: c,
+		opts:   registry.Options{Context: context.Background()},
+	}
+	for _, o := range opts {
+		o(&n.opts)
+	}
+	return n
+}
+
+func TestRegister(t *testing.T) {
+	c := new(mockClient)
+	n := newTestRegistry(c, Group("shop"), Cluster("eu"))
+
+	err := n.Register(&registry.Service{
+		Name:    "foo",
+		Version: "1.0.0",
+		Nodes: []*registry.Node{
+			{Id: "foo-1", Address: "10.0.0.1:8080", Metadata: map[string]string{"protocol": "grpc"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.registered) != 1 {
+		t.Fatalf("expected 1 instance to be registered, got %d", len(c.registered))
+	}
+	p := c.registered[0]
+	if p.Ip != "10.0.0.1" || p.Port != 8080 || p.GroupName != "shop" || p.ClusterName != "eu" || !p.Ephemeral {
+		t.Fatalf("unexpected registration %+v", p)
+	}
+	if p.Metadata["version"] != "1.0.0" || p.Metadata["protocol"] != "grpc" {
+		t.Fatalf("unexpected metadata %v", p.Metadata)
+	}
+}
+
+func TestGetService(t *testing.T) {
+	c := new(mockClient)
+	n := newTestRegistry(c)
+
+	if _, err := n.GetService("foo"); err != registry.ErrNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	c.instances = []model.Instance{
+		{InstanceId: "a", Ip: "10.0.0.1", Port: 8080, Enable: true, Healthy: true, Metadata: map[string]string{"version": "1"}},
+		{InstanceId: "b", Ip: "10.0.0.2", Port: 8080, Enable: true, Healthy: true, Metadata: map[string]string{"version": "2"}},
+		{InstanceId: "c", Ip: "10.0.0.3", Port: 8080, Enable: true, Healthy: false, Metadata: map[string]string{"version": "1"}},
+	}
+
+	services, err := n.GetService("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 2 {
+		t.Fatalf("expected 2 versions, got %d", len(services))
+	}
+	for _, s := range services {
+		if len(s.Nodes) != 1 {
+			t.Fatalf("expected the unhealthy node to be skipped, got %d nodes of %s", len(s.Nodes), s.Version)
+		}
+		if _, ok := s.Nodes[0].Metadata["version"]; ok {
+			t.Fatal("expected the version to be removed from the node metadata")
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	c := new(mockClient)
+	n := newTestRegistry(c)
+
+	w, err := n.Watch(registry.WatchService("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	if len(c.subs) != 1 || c.subs[0].ServiceName != "foo" || c.subs[0].GroupName != DefaultGroup {
+		t.Fatalf("expected a subscription to foo, got %+v", c.subs)
+	}
+	push := c.subs[0].SubscribeCallback
+
+	a := model.SubscribeService{InstanceId: "a", Ip: "10.0.0.1", Port: 8080, Enable: true, Valid: true}
+	b := model.SubscribeService{InstanceId: "b", Ip: "10.0.0.2", Port: 8080, Enable: true, Valid: true}
+
+	expect := func(action, id string) {
+		t.Helper()
+		r, err := w.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Action != action || r.Service.Nodes[0].Id != id {
+			t.Fatalf("expected %s of %s, got %s of %s", action, id, r.Action, r.Service.Nodes[0].Id)
+		}
+	}
+
+	go push([]model.SubscribeService{a}, nil)
+	expect("create", "a")
+
+	go push([]model.SubscribeService{a, b}, nil)
+	expect("create", "b")
+
+	// a turns unhealthy
+	a.Valid = false
+	go push([]model.SubscribeService{a, b}, nil)
+	expect("delete", "a")
+}
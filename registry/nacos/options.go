@@ -0,0 +1,48 @@
+package nacos
+
+import (
+	"context"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+type namespaceKey struct{}
+type groupKey struct{}
+type clusterKey struct{}
+type authKey struct{}
+
+type authCreds struct {
+	Username string
+	Password string
+}
+
+func setOption(k, v interface{}) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// Namespace sets the id of the nacos namespace services are registered and
+// discovered in, by default the public namespace
+func Namespace(id string) registry.Option {
+	return setOption(namespaceKey{}, id)
+}
+
+// Group sets the group services are registered and discovered in, by default
+// DEFAULT_GROUP
+func Group(group string) registry.Option {
+	return setOption(groupKey{}, group)
+}
+
+// Cluster sets the cluster instances are registered in and restricts discovery to it
+func Cluster(name string) registry.Option {
+	return setOption(clusterKey{}, name)
+}
+
+// Auth sets the username and password of nacos servers with auth enabled
+func Auth(username, password string) registry.Option {
+	return setOption(authKey{}, &authCreds{Username: username, Password: password})
+}
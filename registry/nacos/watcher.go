@@ -0,0 +1,199 @@
+package nacos
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/nacos-group/nacos-sdk-go/model"
+	"github.com/nacos-group/nacos-sdk-go/vo"
+)
+
+var (
+	// WatchPollInterval is how often watchers of all services look for new services
+	WatchPollInterval = time.Second * 10
+)
+
+type nacosWatcher struct {
+	n    *nacosRegistry
+	next chan *registry.Result
+	exit chan bool
+
+	sync.Mutex
+	// nodes of every subscribed service by node id, each a service with the node
+	nodes map[string]map[string]*registry.Service
+	subs  map[string]*vo.SubscribeParam
+}
+
+func newWatcher(n *nacosRegistry, opts ...registry.WatchOption) (registry.Watcher, error) {
+	var wo registry.WatchOptions
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	w := &nacosWatcher{
+		n:     n,
+		next:  make(chan *registry.Result),
+		exit:  make(chan bool),
+		nodes: make(map[string]map[string]*registry.Service),
+		subs:  make(map[string]*vo.SubscribeParam),
+	}
+
+	// watch a single service
+	if len(wo.Service) > 0 {
+		if err := w.subscribe(wo.Service); err != nil {
+			return nil, err
+		}
+		return w, nil
+	}
+
+	// watch all services
+	go w.poll()
+	return w, nil
+}
+
+// subscribe has nacos push the instances of the service on every change
+func (w *nacosWatcher) subscribe(name string) error {
+	w.Lock()
+	if _, ok := w.subs[name]; ok {
+		w.Unlock()
+		return nil
+	}
+	param := &vo.SubscribeParam{
+		ServiceName: name,
+		GroupName:   w.n.group(),
+		Clusters:    w.n.clusters(),
+		SubscribeCallback: func(instances []model.SubscribeService, err error) {
+			if err != nil {
+				log.Errorf("[nacos] subscription to %s failed: %v", name, err)
+				return
+			}
+			w.update(name, instances)
+		},
+	}
+	w.subs[name] = param
+	w.Unlock()
+
+	if err := w.n.getClient().Subscribe(param); err != nil {
+		w.Lock()
+		delete(w.subs, name)
+		w.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (w *nacosWatcher) poll() {
+	t := time.NewTicker(WatchPollInterval)
+	defer t.Stop()
+
+	for {
+		services, err := w.n.ListServices()
+		if err != nil {
+			log.Errorf("[nacos] failed to list services: %v", err)
+		}
+		for _, service := range services {
+			if err := w.subscribe(service.Name); err != nil {
+				log.Errorf("[nacos] failed to subscribe to %s: %v", service.Name, err)
+			}
+		}
+
+		select {
+		case <-w.exit:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// update sends the nodes of the service which were created, updated or deleted
+// since the last push
+func (w *nacosWatcher) update(name string, pushed []model.SubscribeService) {
+	instances := make([]model.Instance, 0, len(pushed))
+	for _, s := range pushed {
+		instances = append(instances, model.Instance{
+			InstanceId: s.InstanceId,
+			Ip:         s.Ip,
+			Port:       s.Port,
+			Metadata:   s.Metadata,
+			Enable:     s.Enable,
+			Healthy:    s.Valid,
+		})
+	}
+
+	nodes := make(map[string]*registry.Service)
+	for _, service := range instancesToServices(name, instances) {
+		for _, node := range service.Nodes {
+			nodes[node.Id] = &registry.Service{
+				Name:    service.Name,
+				Version: service.Version,
+				Nodes:   []*registry.Node{node},
+			}
+		}
+	}
+
+	w.Lock()
+	defer w.Unlock()
+
+	old := w.nodes[name]
+	w.nodes[name] = nodes
+
+	for id, service := range nodes {
+		prev, ok := old[id]
+		switch {
+		case !ok:
+			if !w.send("create", service) {
+				return
+			}
+		case !reflect.DeepEqual(prev, service):
+			if !w.send("update", service) {
+				return
+			}
+		}
+	}
+	for id, service := range old {
+		if _, ok := nodes[id]; !ok {
+			if !w.send("delete", service) {
+				return
+			}
+		}
+	}
+}
+
+func (w *nacosWatcher) send(action string, service *registry.Service) bool {
+	select {
+	case w.next <- &registry.Result{Action: action, Service: service}:
+		return true
+	case <-w.exit:
+		return false
+	}
+}
+
+func (w *nacosWatcher) Next() (*registry.Result, error) {
+	select {
+	case r := <-w.next:
+		return r, nil
+	case <-w.exit:
+		return nil, registry.ErrWatcherStopped
+	}
+}
+
+func (w *nacosWatcher) Stop() {
+	select {
+	case <-w.exit:
+		return
+	default:
+		close(w.exit)
+	}
+
+	w.Lock()
+	subs := w.subs
+	w.subs = make(map[string]*vo.SubscribeParam)
+	w.Unlock()
+
+	for _, param := range subs {
+		w.n.getClient().Unsubscribe(param)
+	}
+}
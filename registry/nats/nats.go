@@ -10,6 +10,7 @@ import (
 
 	"github.com/micro/go-micro/v2/config/cmd"
 	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-plugins/registry/nats/v2/internal/natsdiscovery"
 	"github.com/nats-io/nats.go"
 )
 
@@ -17,6 +18,7 @@ type natsRegistry struct {
 	addrs      []string
 	opts       registry.Options
 	nopts      nats.Options
+	pool       *natsdiscovery.Pool
 	queryTopic string
 	watchTopic string
 
@@ -77,6 +79,9 @@ func configure(n *natsRegistry, opts ...registry.Option) error {
 	n.addrs = n.opts.Addrs
 	n.nopts = natsOptions
 	n.queryTopic = queryTopic
+
+	pin, _ := n.opts.Context.Value(pinSeedServersKey{}).(bool)
+	n.pool = natsdiscovery.NewPool(n.addrs, pin)
 	n.watchTopic = watchTopic
 
 	return nil
@@ -109,6 +114,8 @@ func (n *natsRegistry) newConn() (*nats.Conn, error) {
 		opts.Secure = true
 	}
 
+	n.pool.Apply(&opts)
+
 	return opts.Connect()
 }
 
@@ -11,6 +11,7 @@ type contextQuorumKey struct{}
 type optionsKey struct{}
 type watchTopicKey struct{}
 type queryTopicKey struct{}
+type pinSeedServersKey struct{}
 
 var (
 	DefaultQuorum = 0
@@ -70,3 +71,14 @@ func WatchTopic(s string) registry.Option {
 		o.Context = context.WithValue(o.Context, watchTopicKey{}, s)
 	}
 }
+
+// PinSeedServers only connects to the configured servers, servers of the cluster
+// discovered through the nats INFO protocol are ignored
+func PinSeedServers() registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, pinSeedServersKey{}, true)
+	}
+}
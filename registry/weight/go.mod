@@ -0,0 +1,3 @@
+module github.com/micro/go-plugins/registry/weight/v2
+
+go 1.13
@@ -0,0 +1,37 @@
+package zookeeper
+
+import (
+	"context"
+	"time"
+
+	"github.com/micro/go-micro/v2/registry"
+)
+
+type sessionTimeoutKey struct{}
+type authKey struct{}
+
+type authCreds struct {
+	user     string
+	password string
+}
+
+func setOption(k, v interface{}) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// SessionTimeout sets the zookeeper session timeout, after which the nodes of an
+// unreachable service are removed. It takes precedence over registry.Timeout
+func SessionTimeout(d time.Duration) registry.Option {
+	return setOption(sessionTimeoutKey{}, d)
+}
+
+// Auth authenticates with digest credentials, nodes are created with a digest
+// ACL only the same credentials have access to
+func Auth(user, password string) registry.Option {
+	return setOption(authKey{}, authCreds{user: user, password: password})
+}
@@ -2,6 +2,7 @@
 package zookeeper
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
@@ -14,6 +15,13 @@ import (
 	hash "github.com/mitchellh/hashstructure"
 )
 
+/*
+	Nodes are ephemeral, zookeeper removes them when the session of the registry
+	expires. The connection gets a new session once zookeeper is reachable again, the
+	registry then creates the nodes registered before again, without waiting for the
+	service to register again.
+*/
+
 var (
 	prefix = "/micro-registry"
 )
@@ -23,6 +31,8 @@ type zookeeperRegistry struct {
 	options registry.Options
 	sync.Mutex
 	register map[string]uint64
+	// data of the registered nodes by path
+	nodes map[string][]byte
 }
 
 func init() {
@@ -59,23 +69,127 @@ func configure(z *zookeeperRegistry, opts ...registry.Option) error {
 		cAddrs = []string{"127.0.0.1:2181"}
 	}
 
+	timeout := time.Second * z.options.Timeout
+	if t, ok := z.value(sessionTimeoutKey{}).(time.Duration); ok && t > 0 {
+		timeout = t
+	}
+
 	// connect to zookeeper
-	c, _, err := zk.Connect(cAddrs, time.Second*z.options.Timeout)
+	c, events, err := zk.Connect(cAddrs, timeout)
 	if err != nil {
 		log.Error(err.Error())
 		return err
 	}
 
+	if creds, ok := z.value(authKey{}).(authCreds); ok {
+		if err := c.AddAuth("digest", []byte(creds.user+":"+creds.password)); err != nil {
+			c.Close()
+			log.Error(err.Error())
+			return err
+		}
+	}
+
 	// create our prefix path
-	if err := createPath(prefix, []byte{}, c); err != nil {
+	if err := createPath(prefix, []byte{}, 0, z.acl(), c); err != nil {
+		c.Close()
 		log.Error(err.Error())
 		return err
 	}
 
+	old := z.client
 	z.client = c
+	go z.monitor(events)
+
+	// move the registered nodes to the new connection
+	if old != nil {
+		old.Close()
+		z.reregister()
+	}
+
 	return nil
 }
 
+func (z *zookeeperRegistry) value(k interface{}) interface{} {
+	if z.options.Context == nil {
+		return nil
+	}
+	return z.options.Context.Value(k)
+}
+
+func (z *zookeeperRegistry) acl() []zk.ACL {
+	if creds, ok := z.value(authKey{}).(authCreds); ok {
+		return zk.DigestACL(zk.PermAll, creds.user, creds.password)
+	}
+	return zk.WorldACL(zk.PermAll)
+}
+
+// monitor registers the nodes again when the session expired, until the
+// connection is closed
+func (z *zookeeperRegistry) monitor(events <-chan zk.Event) {
+	expired := false
+
+	for e := range events {
+		if e.Type != zk.EventSession {
+			continue
+		}
+
+		switch e.State {
+		case zk.StateExpired:
+			log.Warnf("[zookeeper] session expired, registered nodes were removed")
+			expired = true
+			// the service has to register again as well
+			z.Lock()
+			z.register = make(map[string]uint64)
+			z.Unlock()
+		case zk.StateHasSession:
+			if expired {
+				expired = false
+				z.reregister()
+			}
+		}
+	}
+}
+
+// reregister creates the registered nodes which are missing
+func (z *zookeeperRegistry) reregister() {
+	z.Lock()
+	nodes := make(map[string][]byte, len(z.nodes))
+	for path, data := range z.nodes {
+		nodes[path] = data
+	}
+	z.Unlock()
+
+	for path, data := range nodes {
+		if err := z.createNode(path, data); err != nil {
+			log.Errorf("[zookeeper] failed to register %s again: %v", path, err)
+			continue
+		}
+		log.Infof("[zookeeper] registered %s again", path)
+	}
+}
+
+// createNode creates the ephemeral node in the current session, replacing nodes
+// of an older session or persistent nodes of earlier versions of the registry
+func (z *zookeeperRegistry) createNode(path string, data []byte) error {
+	exists, stat, err := z.client.Exists(path)
+	if err != nil {
+		return err
+	}
+
+	if exists && stat.EphemeralOwner == z.client.SessionID() {
+		_, err := z.client.Set(path, data, -1)
+		return err
+	}
+
+	if exists {
+		if err := z.client.Delete(path, -1); err != nil && err != zk.ErrNoNode {
+			return err
+		}
+	}
+
+	return createPath(path, data, zk.FlagEphemeral, z.acl(), z.client)
+}
+
 func (z *zookeeperRegistry) Init(opts ...registry.Option) error {
 	return configure(z, opts...)
 }
@@ -95,6 +209,10 @@ func (z *zookeeperRegistry) Deregister(s *registry.Service, opts ...registry.Der
 	z.Unlock()
 
 	for _, node := range s.Nodes {
+		z.Lock()
+		delete(z.nodes, nodePath(s.Name, node.Id))
+		z.Unlock()
+
 		err := z.client.Delete(nodePath(s.Name, node.Id), -1)
 		if err != nil {
 			return err
@@ -139,27 +257,19 @@ func (z *zookeeperRegistry) Register(s *registry.Service, opts ...registry.Regis
 
 	for _, node := range s.Nodes {
 		service.Nodes = []*registry.Node{node}
-		exists, _, err := z.client.Exists(nodePath(service.Name, node.Id))
-		if err != nil {
-			return err
-		}
 
 		srv, err := encode(service)
 		if err != nil {
 			return err
 		}
 
-		if exists {
-			_, err := z.client.Set(nodePath(service.Name, node.Id), srv, -1)
-			if err != nil {
-				return err
-			}
-		} else {
-			err := createPath(nodePath(service.Name, node.Id), srv, z.client)
-			if err != nil {
-				return err
-			}
+		if err := z.createNode(nodePath(service.Name, node.Id), srv); err != nil {
+			return err
 		}
+
+		z.Lock()
+		z.nodes[nodePath(service.Name, node.Id)] = srv
+		z.Unlock()
 	}
 
 	// save our hash of the service
@@ -276,43 +386,17 @@ func (z *zookeeperRegistry) Watch(opts ...registry.WatchOption) (registry.Watche
 }
 
 func NewRegistry(opts ...registry.Option) registry.Registry {
-	var options registry.Options
-	for _, o := range opts {
-		o(&options)
-	}
-
-	if options.Timeout == 0 {
-		options.Timeout = 5
-	}
-
-	cAddrs := make([]string, 0, len(options.Addrs))
-	for _, addr := range options.Addrs {
-		if len(addr) == 0 {
-			continue
-		}
-		cAddrs = append(cAddrs, addr)
-	}
-
-	if len(cAddrs) == 0 {
-		cAddrs = []string{"127.0.0.1:2181"}
-	}
-
-	// connect to zookeeper
-	c, _, err := zk.Connect(cAddrs, time.Second*options.Timeout)
-	if err != nil {
-		log.Error(err.Error())
-		return nil
+	z := &zookeeperRegistry{
+		options: registry.Options{
+			Context: context.Background(),
+		},
+		register: make(map[string]uint64),
+		nodes:    make(map[string][]byte),
 	}
 
-	// create our prefix path
-	if err := createPath(prefix, []byte{}, c); err != nil {
-		log.Error(err.Error())
+	if err := configure(z, opts...); err != nil {
 		return nil
 	}
 
-	return &zookeeperRegistry{
-		client:   c,
-		options:  options,
-		register: make(map[string]uint64),
-	}
+	return z
 }
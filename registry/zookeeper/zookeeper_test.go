@@ -0,0 +1,67 @@
+package zookeeper
+
+import (
+	"os"
+	"testing"
+
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+// TestReregister needs a zookeeper server, set ZOOKEEPER_ADDRESS to run it
+func TestReregister(t *testing.T) {
+	addr := os.Getenv("ZOOKEEPER_ADDRESS")
+	if len(addr) == 0 {
+		t.Skip("ZOOKEEPER_ADDRESS is undefined")
+	}
+
+	r := NewRegistry(registry.Addrs(addr), Auth("micro", "secret"))
+	if r == nil {
+		t.Fatal("failed to connect to zookeeper")
+	}
+	z := r.(*zookeeperRegistry)
+
+	service := &registry.Service{
+		Name:  "test.reregister",
+		Nodes: []*registry.Node{{Id: "a", Address: "127.0.0.1:8080"}},
+	}
+	if err := z.Register(service); err != nil {
+		t.Fatal(err)
+	}
+	defer z.Deregister(service)
+
+	path := nodePath(service.Name, "a")
+	_, stat, err := z.client.Exists(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.EphemeralOwner != z.client.SessionID() {
+		t.Fatal("expected the node to be ephemeral")
+	}
+
+	// the node is gone with the expired session
+	if err := z.client.Delete(path, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan zk.Event, 2)
+	events <- zk.Event{Type: zk.EventSession, State: zk.StateExpired}
+	events <- zk.Event{Type: zk.EventSession, State: zk.StateHasSession}
+	close(events)
+	z.monitor(events)
+
+	exists, _, err := z.client.Exists(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Fatal("expected the node to be registered again")
+	}
+
+	z.Lock()
+	registered := len(z.register)
+	z.Unlock()
+	if registered != 0 {
+		t.Fatal("expected the service to register again after the session expired")
+	}
+}
@@ -44,6 +44,9 @@ func serviceDef(opts server.Options) *registry.Service {
 	node.Metadata["broker"] = opts.Broker.String()
 	node.Metadata["registry"] = opts.Registry.String()
 	node.Metadata["protocol"] = "http"
+	if opts.TLSConfig != nil {
+		node.Metadata["secure"] = "true"
+	}
 
 	return &registry.Service{
 		Name:    opts.Name,
@@ -0,0 +1,112 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// hijacked tracks the connections taken over from the server, by websockets or
+// HTTP/2 over h2c, which Shutdown doesn't wait for
+type hijacked struct {
+	sync.Mutex
+	wg    sync.WaitGroup
+	conns map[net.Conn]bool
+}
+
+type hijackedConn struct {
+	net.Conn
+	h    *hijacked
+	once sync.Once
+}
+
+type hijackWriter struct {
+	http.ResponseWriter
+	h *hijacked
+}
+
+func newHijacked() *hijacked {
+	return &hijacked{
+		conns: make(map[net.Conn]bool),
+	}
+}
+
+func (h *hijacked) add(c net.Conn) net.Conn {
+	h.Lock()
+	h.conns[c] = true
+	h.wg.Add(1)
+	h.Unlock()
+	return &hijackedConn{Conn: c, h: h}
+}
+
+func (h *hijacked) remove(c net.Conn) {
+	h.Lock()
+	if h.conns[c] {
+		delete(h.conns, c)
+		h.wg.Done()
+	}
+	h.Unlock()
+}
+
+// handler tracks the connections hijacked by HTTP/1 requests
+func (h *hijacked) handler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 1 {
+			w = &hijackWriter{ResponseWriter: w, h: h}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// wait waits for the hijacked connections to be closed, closing them once the
+// context is done
+func (h *hijacked) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	h.Lock()
+	for c := range h.conns {
+		c.Close()
+		delete(h.conns, c)
+		h.wg.Done()
+	}
+	h.Unlock()
+	return ctx.Err()
+}
+
+func (c *hijackedConn) Close() error {
+	c.once.Do(func() {
+		c.h.remove(c.Conn)
+	})
+	return c.Conn.Close()
+}
+
+func (w *hijackWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("http.Hijacker not implemented")
+	}
+	c, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return w.h.add(c), rw, nil
+}
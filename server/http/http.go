@@ -2,11 +2,14 @@
 package http
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -18,6 +21,8 @@ import (
 	log "github.com/micro/go-micro/v2/logger"
 	"github.com/micro/go-micro/v2/registry"
 	"github.com/micro/go-micro/v2/server"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 var (
@@ -30,6 +35,20 @@ var (
 	}
 )
 
+/*
+	Stop deregisters the node before anything else, so clients move on to other
+	nodes, then shuts the server down right away. The listener and the idle
+	connections are closed while the active requests are served. Shutdown doesn't
+	wait for hijacked connections, websockets and HTTP/2 over h2c, so these are
+	tracked and waited for separately. Requests and connections still active after
+	the drain timeout are cut off.
+*/
+
+var (
+	// DefaultDrainTimeout is how long Stop waits for active requests without DrainTimeout
+	DefaultDrainTimeout = 10 * time.Second
+)
+
 type httpServer struct {
 	sync.Mutex
 	opts         server.Options
@@ -261,7 +280,21 @@ func (h *httpServer) Start() error {
 		return err
 	}
 
-	go http.Serve(ln, handler)
+	if opts.Context != nil {
+		if max, ok := opts.Context.Value(deadlineKey{}).(time.Duration); ok {
+			handler = deadlineHandler(handler, max)
+		}
+	}
+
+	conns := newHijacked()
+	srv := newHTTPServer(opts, handler)
+	srv.Handler = conns.handler(srv.Handler)
+
+	if srv.TLSConfig != nil {
+		go srv.ServeTLS(ln, "", "")
+	} else {
+		go srv.Serve(ln)
+	}
 
 	go func() {
 		t := new(time.Ticker)
@@ -289,17 +322,132 @@ func (h *httpServer) Start() error {
 			}
 		}
 
-		ch <- ln.Close()
-
 		// deregister
 		h.Deregister()
 
+		ch <- drain(srv, conns, drainTimeout(opts))
+
 		opts.Broker.Disconnect()
 	}()
 
 	return nil
 }
 
+// newHTTPServer returns the http.Server of the options, serving HTTP/2 over TLS
+// or without when H2C is set
+func newHTTPServer(opts server.Options, handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Handler:   handler,
+		TLSConfig: opts.TLSConfig,
+	}
+
+	if c := opts.Context; c != nil {
+		if d, ok := c.Value(readTimeoutKey{}).(time.Duration); ok {
+			srv.ReadTimeout = d
+		}
+		if d, ok := c.Value(readHeaderTimeoutKey{}).(time.Duration); ok {
+			srv.ReadHeaderTimeout = d
+		}
+		if d, ok := c.Value(writeTimeoutKey{}).(time.Duration); ok {
+			srv.WriteTimeout = d
+		}
+		if d, ok := c.Value(idleTimeoutKey{}).(time.Duration); ok {
+			srv.IdleTimeout = d
+		}
+		if n, ok := c.Value(maxHeaderBytesKey{}).(int); ok {
+			srv.MaxHeaderBytes = n
+		}
+		if b, ok := c.Value(h2cKey{}).(bool); ok && b && srv.TLSConfig == nil {
+			h2s := &http2.Server{IdleTimeout: srv.IdleTimeout}
+			// shuts down the HTTP/2 connections along with the server
+			if err := http2.ConfigureServer(srv, h2s); err != nil {
+				log.Errorf("Failed to configure HTTP/2: %v", err)
+			}
+			srv.TLSConfig = nil
+			srv.Handler = h2c.NewHandler(handler, h2s)
+		}
+	}
+
+	return srv
+}
+
+// deadlineHandler cancels the context of requests once the timeout of the client in
+// the Timeout header expired, capped by max unless it's 0
+func deadlineHandler(handler http.Handler, max time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := max
+		if n, err := strconv.ParseInt(r.Header.Get("Timeout"), 10, 64); err == nil && n > 0 {
+			if max <= 0 || time.Duration(n) < max {
+				d = time.Duration(n)
+			}
+		}
+		if d <= 0 {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		dw := &deadlineWriter{ResponseWriter: w}
+		handler.ServeHTTP(dw, r.WithContext(ctx))
+
+		// reply for the handler which gave up at the deadline, as wrapper/deadline does
+		if !dw.wrote && ctx.Err() == context.DeadlineExceeded {
+			http.Error(w, "deadline exceeded", http.StatusRequestTimeout)
+		}
+	})
+}
+
+// deadlineWriter tells if the handler replied, passing flushes and hijacks through
+type deadlineWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (w *deadlineWriter) WriteHeader(code int) {
+	w.wrote = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *deadlineWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *deadlineWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wrote = true
+		f.Flush()
+	}
+}
+
+func (w *deadlineWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("http.Hijacker not implemented")
+	}
+	w.wrote = true
+	return hj.Hijack()
+}
+
+// drain shuts the server down, waiting for the active requests and hijacked
+// connections until the timeout expired and cutting them off after
+func drain(srv *http.Server, conns *hijacked, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Info("Drain timeout expired, closing the active requests")
+		conns.wait(ctx)
+		return srv.Close()
+	}
+	if err := conns.wait(ctx); err != nil {
+		log.Info("Drain timeout expired, closing the hijacked connections")
+	}
+	return nil
+}
+
 func (h *httpServer) Stop() error {
 	ch := make(chan error)
 	h.exit <- ch
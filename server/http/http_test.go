@@ -1,13 +1,19 @@
 package http
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/micro/go-micro/v2/registry"
 	"github.com/micro/go-micro/v2/registry/memory"
 	"github.com/micro/go-micro/v2/server"
+	"golang.org/x/net/http2"
 )
 
 func TestHTTPServer(t *testing.T) {
@@ -70,3 +76,354 @@ func TestHTTPServer(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestHTTPServerDrain(t *testing.T) {
+	reg := memory.NewRegistry()
+
+	srv := NewServer(server.Registry(reg), DrainTimeout(5*time.Second))
+
+	started := make(chan bool)
+	release := make(chan bool)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte(`hello world`))
+	})
+
+	if err := srv.Handle(srv.NewHandler(mux)); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		body string
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		rsp, err := http.Get(fmt.Sprintf("http://%s", srv.Options().Address))
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer rsp.Body.Close()
+		b, err := ioutil.ReadAll(rsp.Body)
+		results <- result{string(b), err}
+	}()
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- srv.Stop()
+	}()
+
+	// deregistered while the request is active
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := reg.GetService(server.DefaultName); err == registry.ErrNotFound {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the node to be deregistered before the request is done")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case err := <-stopped:
+		t.Fatalf("Expected stop to wait for the active request, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+
+	if r := <-results; r.err != nil || r.body != "hello world" {
+		t.Fatalf("Expected response %s, got %s %v", "hello world", r.body, r.err)
+	}
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHTTPServerDrainHijacked(t *testing.T) {
+	srv := NewServer(server.Registry(memory.NewRegistry()), DrainTimeout(5*time.Second))
+
+	started := make(chan bool)
+	release := make(chan bool)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		close(started)
+		<-release
+		conn.Close()
+	})
+
+	if err := srv.Handle(srv.NewHandler(mux)); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	addr := srv.Options().Address
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\n\r\n", addr)
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- srv.Stop()
+	}()
+
+	// the listener is closed right away
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		c.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the listener to be closed while draining")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case err := <-stopped:
+		t.Fatalf("Expected stop to wait for the hijacked connection, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHTTPServerDrainTimeout(t *testing.T) {
+	srv := NewServer(server.Registry(memory.NewRegistry()), DrainTimeout(100*time.Millisecond))
+
+	started := make(chan bool)
+	release := make(chan bool)
+	defer close(release)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	if err := srv.Handle(srv.NewHandler(mux)); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		rsp, err := http.Get(fmt.Sprintf("http://%s", srv.Options().Address))
+		if err == nil {
+			rsp.Body.Close()
+		}
+		errs <- err
+	}()
+	<-started
+
+	if err := srv.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("Expected the active request to be cut off")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the active request to be cut off after the drain timeout")
+	}
+}
+
+func startProto(t *testing.T, opts ...server.Option) server.Server {
+	srv := NewServer(append([]server.Option{server.Registry(memory.NewRegistry())}, opts...)...)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+
+	if err := srv.Handle(srv.NewHandler(mux)); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+func getProto(t *testing.T, c *http.Client, url string) string {
+	rsp, err := c.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestHTTPServerH2C(t *testing.T) {
+	srv := startProto(t, H2C(), ReadHeaderTimeout(time.Second))
+	defer srv.Stop()
+
+	c := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}
+	url := fmt.Sprintf("http://%s", srv.Options().Address)
+	if p := getProto(t, c, url); p != "HTTP/2.0" {
+		t.Fatalf("Expected HTTP/2.0, got %s", p)
+	}
+	if p := getProto(t, http.DefaultClient, url); p != "HTTP/1.1" {
+		t.Fatalf("Expected HTTP/1.1, got %s", p)
+	}
+}
+
+func TestHTTPServerTLS(t *testing.T) {
+	// borrow the certificate and client of a test server
+	ts := httptest.NewTLSServer(nil)
+	config := &tls.Config{Certificates: ts.TLS.Certificates}
+	c := ts.Client()
+	c.Transport.(*http.Transport).ForceAttemptHTTP2 = true
+	ts.Close()
+
+	reg := memory.NewRegistry()
+	srv := startProto(t, server.Registry(reg), server.Address("127.0.0.1:0"), server.TLSConfig(config))
+	defer srv.Stop()
+
+	if p := getProto(t, c, fmt.Sprintf("https://%s", srv.Options().Address)); p != "HTTP/2.0" {
+		t.Fatalf("Expected HTTP/2.0 over TLS, got %s", p)
+	}
+
+	service, err := reg.GetService(server.DefaultName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md := service[0].Nodes[0].Metadata; md["secure"] != "true" {
+		t.Fatalf("Expected the node to be secure, got %v", md)
+	}
+}
+
+func TestNewHTTPServer(t *testing.T) {
+	opts := newOptions(
+		ReadTimeout(time.Second),
+		WriteTimeout(2*time.Second),
+		IdleTimeout(3*time.Second),
+		MaxHeaderBytes(1024),
+	)
+	srv := newHTTPServer(opts, http.NotFoundHandler())
+	if srv.ReadTimeout != time.Second || srv.WriteTimeout != 2*time.Second || srv.IdleTimeout != 3*time.Second || srv.MaxHeaderBytes != 1024 {
+		t.Fatalf("Expected the options to be applied, got %+v", srv)
+	}
+}
+
+func TestHTTPServerDeadline(t *testing.T) {
+	srv := NewServer(server.Registry(memory.NewRegistry()), EnforceDeadline(time.Minute))
+
+	release := make(chan bool)
+	defer close(release)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+
+	if err := srv.Handle(srv.NewHandler(mux)); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s", srv.Options().Address), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Timeout", fmt.Sprintf("%d", 50*time.Millisecond))
+
+	start := time.Now()
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusRequestTimeout {
+		t.Fatalf("Expected status %d, got %d", http.StatusRequestTimeout, rsp.StatusCode)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("Expected the request to be aborted at the deadline")
+	}
+}
+
+func TestHTTPServerDeadlineStream(t *testing.T) {
+	srv := NewServer(server.Registry(memory.NewRegistry()), EnforceDeadline(time.Minute))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Hijacker); !ok {
+			t.Error("Expected the response writer to be a http.Hijacker")
+		}
+		// the partial response streams out and stays the response past the deadline
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+
+	if err := srv.Handle(srv.NewHandler(mux)); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s", srv.Options().Address), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Timeout", fmt.Sprintf("%d", 50*time.Millisecond))
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.StatusCode != http.StatusOK || string(b) != "partial" {
+		t.Fatalf("Expected the partial response, got %d %s", rsp.StatusCode, b)
+	}
+}
@@ -2,6 +2,7 @@ package http
 
 import (
 	"context"
+	"time"
 
 	"github.com/micro/go-micro/v2/broker"
 	"github.com/micro/go-micro/v2/codec"
@@ -46,3 +47,75 @@ func newOptions(opt ...server.Option) server.Options {
 
 	return opts
 }
+
+type drainTimeoutKey struct{}
+type readTimeoutKey struct{}
+type readHeaderTimeoutKey struct{}
+type writeTimeoutKey struct{}
+type idleTimeoutKey struct{}
+type maxHeaderBytesKey struct{}
+type h2cKey struct{}
+type deadlineKey struct{}
+
+// DrainTimeout sets how long Stop waits for active requests to be served
+// before closing their connections, zero closes them right away
+func DrainTimeout(d time.Duration) server.Option {
+	return setServerOption(drainTimeoutKey{}, d)
+}
+
+// ReadTimeout sets the http.Server ReadTimeout, the time to read a whole request
+func ReadTimeout(d time.Duration) server.Option {
+	return setServerOption(readTimeoutKey{}, d)
+}
+
+// ReadHeaderTimeout sets the http.Server ReadHeaderTimeout, the time to read the
+// headers of a request
+func ReadHeaderTimeout(d time.Duration) server.Option {
+	return setServerOption(readHeaderTimeoutKey{}, d)
+}
+
+// WriteTimeout sets the http.Server WriteTimeout, the time to write a response
+func WriteTimeout(d time.Duration) server.Option {
+	return setServerOption(writeTimeoutKey{}, d)
+}
+
+// IdleTimeout sets the http.Server IdleTimeout, how long idle connections are kept
+func IdleTimeout(d time.Duration) server.Option {
+	return setServerOption(idleTimeoutKey{}, d)
+}
+
+// MaxHeaderBytes sets the http.Server MaxHeaderBytes, the max size of request headers
+func MaxHeaderBytes(n int) server.Option {
+	return setServerOption(maxHeaderBytesKey{}, n)
+}
+
+// H2C serves HTTP/2 without TLS alongside HTTP/1. With server.TLSConfig HTTP/2
+// is negotiated anyway
+func H2C() server.Option {
+	return setServerOption(h2cKey{}, true)
+}
+
+// EnforceDeadline cancels the context of requests once the timeout sent by the
+// client in the Timeout header expired, replying 408 unless the handler replied.
+// Timeouts are capped by max unless it's 0
+func EnforceDeadline(max time.Duration) server.Option {
+	return setServerOption(deadlineKey{}, max)
+}
+
+func setServerOption(k, v interface{}) server.Option {
+	return func(o *server.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+func drainTimeout(opts server.Options) time.Duration {
+	if opts.Context != nil {
+		if d, ok := opts.Context.Value(drainTimeoutKey{}).(time.Duration); ok && d >= 0 {
+			return d
+		}
+	}
+	return DefaultDrainTimeout
+}
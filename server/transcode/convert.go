@@ -0,0 +1,121 @@
+package transcode
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var stringer = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+// names returns the names of the field in json, those of its json and protobuf tags
+func names(f reflect.StructField) []string {
+	var names []string
+	if tag := strings.Split(f.Tag.Get("json"), ",")[0]; len(tag) > 0 && tag != "-" {
+		names = append(names, tag)
+	}
+	for _, part := range strings.Split(f.Tag.Get("protobuf"), ",") {
+		if strings.HasPrefix(part, "name=") || strings.HasPrefix(part, "json=") {
+			names = append(names, part[5:])
+		}
+	}
+	return names
+}
+
+// fieldType returns the type of the field of the request, nested fields are
+// separated by dots
+func fieldType(t reflect.Type, field string) (reflect.Type, bool) {
+	for _, name := range strings.Split(field, ".") {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return nil, false
+		}
+
+		var next reflect.Type
+		for i := 0; i < t.NumField() && next == nil; i++ {
+			f := t.Field(i)
+			if len(f.PkgPath) > 0 {
+				continue
+			}
+			for _, n := range append(names(f), f.Name) {
+				if n == name {
+					next = f.Type
+					break
+				}
+			}
+		}
+		if next == nil {
+			return nil, false
+		}
+		t = next
+	}
+	return t, true
+}
+
+// convert returns the value as the json value of the type, enums may be named
+func convert(t reflect.Type, v string) (interface{}, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return strconv.ParseBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(v, 10, t.Bits())
+		if err != nil && t.Implements(stringer) {
+			return v, nil
+		}
+		return i, err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(v, 10, t.Bits())
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(v, t.Bits())
+		if err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			// json has no numbers for these, the json codec of proto messages takes strings
+			return v, nil
+		}
+		return f, err
+	}
+	return v, nil
+}
+
+// value returns the values of the path or query as the json value of the field of
+// the request, values of repeated fields as an array. Without the request or the
+// field the values are strings
+func value(request interface{}, field string, values []string) (interface{}, error) {
+	var t reflect.Type
+	if request != nil {
+		t, _ = fieldType(reflect.TypeOf(request), field)
+	}
+
+	if t == nil {
+		if len(values) == 1 {
+			return values[0], nil
+		}
+		return values, nil
+	}
+
+	repeated := t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8
+	if repeated {
+		t = t.Elem()
+	}
+
+	var converted []interface{}
+	for _, v := range values {
+		c, err := convert(t, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for field %s", v, field)
+		}
+		converted = append(converted, c)
+	}
+
+	if !repeated && len(converted) == 1 {
+		return converted[0], nil
+	}
+	return converted, nil
+}
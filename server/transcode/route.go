@@ -0,0 +1,157 @@
+package transcode
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Route maps a http method and path to the endpoint of a service
+type Route struct {
+	// Method is the http method, e.g. GET
+	Method string
+	// Path is the pattern of the path, e.g. /v1/users/{id}. Segments in braces bind
+	// the field of the request named, nested fields are separated by dots
+	Path string
+	// Service is the name of the service, e.g. go.micro.srv.user
+	Service string
+	// Endpoint is the endpoint of the service, e.g. User.Get
+	Endpoint string
+	// Body is the field of the request the body is bound to, * for the request
+	// itself. The body is ignored without
+	Body string
+	// Request is a value of the request type of the endpoint, e.g. &user.GetRequest{}.
+	// The values of the path and query are converted to the type of their field,
+	// they're passed as strings without
+	Request interface{}
+}
+
+// segment is a part of the path, either a literal or the field it binds
+type segment struct {
+	literal string
+	field   string
+}
+
+type route struct {
+	Route
+	segments []segment
+}
+
+func split(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+func compile(r Route) (*route, error) {
+	if len(r.Service) == 0 || len(r.Endpoint) == 0 {
+		return nil, fmt.Errorf("route %s %s requires a service and endpoint", r.Method, r.Path)
+	}
+
+	var segments []segment
+	for _, s := range split(r.Path) {
+		switch {
+		case strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") && len(s) > 2:
+			segments = append(segments, segment{field: s[1 : len(s)-1]})
+		case strings.ContainsAny(s, "{}"):
+			return nil, fmt.Errorf("route %s %s has a malformed segment %s", r.Method, r.Path, s)
+		default:
+			segments = append(segments, segment{literal: s})
+		}
+	}
+
+	return &route{Route: r, segments: segments}, nil
+}
+
+// match returns the fields bound by the path, false if it doesn't match
+func (r *route) match(path string) (map[string]string, bool) {
+	parts := split(path)
+	if len(parts) != len(r.segments) {
+		return nil, false
+	}
+
+	fields := make(map[string]string)
+	for i, s := range r.segments {
+		if len(s.field) == 0 {
+			if parts[i] != s.literal {
+				return nil, false
+			}
+			continue
+		}
+		if len(parts[i]) == 0 {
+			return nil, false
+		}
+		fields[s.field] = parts[i]
+	}
+	return fields, true
+}
+
+// set sets the field, creating the messages of nested fields, unless it's set already
+func set(m map[string]interface{}, field string, v interface{}) {
+	names := strings.Split(field, ".")
+	for _, name := range names[:len(names)-1] {
+		next, ok := m[name].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			m[name] = next
+		}
+		m = next
+	}
+	if _, ok := m[names[len(names)-1]]; !ok {
+		m[names[len(names)-1]] = v
+	}
+}
+
+// bind returns the request of the endpoint, binding the fields of the path, then
+// the body and then the query
+func (r *route) bind(req *http.Request, fields map[string]string) (json.RawMessage, error) {
+	m := make(map[string]interface{})
+
+	for field, v := range fields {
+		c, err := value(r.Request, field, []string{v})
+		if err != nil {
+			return nil, err
+		}
+		set(m, field, c)
+	}
+
+	if len(r.Body) > 0 && req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(b)) > 0 {
+			d := json.NewDecoder(bytes.NewReader(b))
+			d.UseNumber()
+
+			var body interface{}
+			if err := d.Decode(&body); err != nil && err != io.EOF {
+				return nil, fmt.Errorf("malformed body: %v", err)
+			}
+
+			if r.Body == "*" {
+				fields, ok := body.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("malformed body: expected an object")
+				}
+				for k, v := range fields {
+					set(m, k, v)
+				}
+			} else {
+				set(m, r.Body, body)
+			}
+		}
+	}
+
+	for k, v := range req.URL.Query() {
+		c, err := value(r.Request, k, v)
+		if err != nil {
+			return nil, err
+		}
+		set(m, k, c)
+	}
+
+	return json.Marshal(m)
+}
@@ -0,0 +1,143 @@
+// Package transcode provides a http handler exposing the endpoints of services as JSON routes
+package transcode
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/errors"
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/metadata"
+)
+
+/*
+	Requests are transcoded with the route table rather than descriptors of the
+	services. The values of the path and query are converted to the type of their
+	field in the request type of the route, found by reflection on its json and
+	protobuf tags, and are passed on as strings without. The request is sent to
+	the service as raw json, like the rpc handler of the micro api, headers as
+	metadata. Errors of the services are replied with their code as status.
+*/
+
+type Options struct {
+	// Client calls the services, client.DefaultClient by default
+	Client client.Client
+	// Routes map the http requests to the endpoints of services
+	Routes []Route
+}
+
+type Option func(*Options)
+
+// Client sets the client calling the services
+func Client(c client.Client) Option {
+	return func(o *Options) {
+		o.Client = c
+	}
+}
+
+// Routes adds routes mapping http requests to the endpoints of services
+func Routes(routes ...Route) Option {
+	return func(o *Options) {
+		o.Routes = append(o.Routes, routes...)
+	}
+}
+
+type transcoder struct {
+	opts   Options
+	routes []*route
+}
+
+// writeError replies the error with its code as status
+func writeError(w http.ResponseWriter, err error) {
+	ce := errors.Parse(err.Error())
+	if ce.Code < 100 || ce.Code > 599 {
+		ce.Code = http.StatusInternalServerError
+	}
+	if len(ce.Status) == 0 {
+		ce.Status = http.StatusText(int(ce.Code))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(int(ce.Code))
+	w.Write([]byte(ce.Error()))
+}
+
+func (t *transcoder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var rt *route
+	var fields map[string]string
+	var pathMatched bool
+
+	for _, candidate := range t.routes {
+		f, ok := candidate.match(r.URL.Path)
+		if !ok {
+			continue
+		}
+		pathMatched = true
+		if strings.EqualFold(candidate.Method, r.Method) {
+			rt, fields = candidate, f
+			break
+		}
+	}
+
+	switch {
+	case rt == nil && pathMatched:
+		writeError(w, errors.New("go.micro.transcode", "method not allowed", http.StatusMethodNotAllowed))
+		return
+	case rt == nil:
+		writeError(w, errors.NotFound("go.micro.transcode", "no route for %s", r.URL.Path))
+		return
+	}
+
+	request, err := rt.bind(r, fields)
+	if err != nil {
+		writeError(w, errors.BadRequest("go.micro.transcode", err.Error()))
+		return
+	}
+
+	md := make(metadata.Metadata)
+	for k, v := range r.Header {
+		md[k] = strings.Join(v, ",")
+	}
+	ctx := metadata.NewContext(r.Context(), md)
+
+	req := t.opts.Client.NewRequest(rt.Service, rt.Endpoint, &request, client.WithContentType("application/json"))
+
+	var response json.RawMessage
+	if err := t.opts.Client.Call(ctx, req, &response); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if len(response) == 0 {
+		response = json.RawMessage("{}")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// NewHandler returns a http handler calling the endpoints of services mapped by
+// the routes, binding the fields of the path, body and query to their requests.
+// Invalid routes are skipped
+func NewHandler(opts ...Option) http.Handler {
+	options := Options{
+		Client: client.DefaultClient,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	t := &transcoder{opts: options}
+	for _, r := range options.Routes {
+		rt, err := compile(r)
+		if err != nil {
+			log.Errorf("[transcode] %v", err)
+			continue
+		}
+		t.routes = append(t.routes, rt)
+	}
+
+	return t
+}
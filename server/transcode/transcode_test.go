@@ -0,0 +1,215 @@
+package transcode
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/errors"
+	"github.com/micro/go-micro/v2/metadata"
+)
+
+type testRequest struct {
+	client.Request
+	service  string
+	endpoint string
+	body     interface{}
+}
+
+func (r *testRequest) Service() string {
+	return r.service
+}
+
+func (r *testRequest) Endpoint() string {
+	return r.endpoint
+}
+
+func (r *testRequest) Body() interface{} {
+	return r.body
+}
+
+// testClient replies the request it was sent along with the metadata
+type testClient struct {
+	client.Client
+	err error
+}
+
+func (c *testClient) NewRequest(service, endpoint string, req interface{}, opts ...client.RequestOption) client.Request {
+	return &testRequest{service: service, endpoint: endpoint, body: req}
+}
+
+func (c *testClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	if c.err != nil {
+		return c.err
+	}
+	md, _ := metadata.FromContext(ctx)
+	b, err := json.Marshal(map[string]interface{}{
+		"service":  req.Service(),
+		"endpoint": req.Endpoint(),
+		"request":  req.Body(),
+		"token":    md["Authorization"],
+	})
+	if err != nil {
+		return err
+	}
+	*rsp.(*json.RawMessage) = b
+	return nil
+}
+
+type testResponse struct {
+	Service  string                 `json:"service"`
+	Endpoint string                 `json:"endpoint"`
+	Request  map[string]interface{} `json:"request"`
+	Token    string                 `json:"token"`
+}
+
+var routes = []Route{
+	{Method: "GET", Path: "/v1/users/{id}", Service: "go.micro.srv.user", Endpoint: "User.Get"},
+	{Method: "POST", Path: "/v1/users", Service: "go.micro.srv.user", Endpoint: "User.Create", Body: "*"},
+	{Method: "PUT", Path: "/v1/users/{user.id}/profile", Service: "go.micro.srv.user", Endpoint: "User.Update", Body: "profile"},
+}
+
+func serve(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestTranscode(t *testing.T) {
+	h := NewHandler(Client(&testClient{}), Routes(routes...))
+
+	testData := []struct {
+		method, path, body string
+		endpoint           string
+		request            string
+	}{
+		{"GET", "/v1/users/1?fields=name&tags=a&tags=b", "", "User.Get", `{"fields":"name","id":"1","tags":["a","b"]}`},
+		// the path takes precedence over the query
+		{"GET", "/v1/users/1?id=2", "", "User.Get", `{"id":"1"}`},
+		{"POST", "/v1/users", `{"name":"john","age":30}`, "User.Create", `{"age":30,"name":"john"}`},
+		{"PUT", "/v1/users/1/profile", `{"bio":"hello"}`, "User.Update", `{"profile":{"bio":"hello"},"user":{"id":"1"}}`},
+	}
+
+	for _, d := range testData {
+		w := serve(h, d.method, d.path, d.body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: expected status 200 got %d %s", d.method, d.path, w.Code, w.Body.String())
+		}
+
+		var rsp testResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil {
+			t.Fatal(err)
+		}
+		if rsp.Service != "go.micro.srv.user" || rsp.Endpoint != d.endpoint {
+			t.Fatalf("%s %s: expected %s got %s %s", d.method, d.path, d.endpoint, rsp.Service, rsp.Endpoint)
+		}
+		if rsp.Token != "Bearer token" {
+			t.Fatalf("%s %s: expected the headers as metadata got %q", d.method, d.path, rsp.Token)
+		}
+		b, _ := json.Marshal(rsp.Request)
+		if string(b) != d.request {
+			t.Fatalf("%s %s: expected request %s got %s", d.method, d.path, d.request, b)
+		}
+	}
+}
+
+func TestTranscodeErrors(t *testing.T) {
+	h := NewHandler(Client(&testClient{}), Routes(routes...))
+
+	testData := []struct {
+		method, path, body string
+		code               int
+	}{
+		{"GET", "/v1/foo", "", http.StatusNotFound},
+		{"DELETE", "/v1/users/1", "", http.StatusMethodNotAllowed},
+		{"POST", "/v1/users", `[1, 2]`, http.StatusBadRequest},
+		{"POST", "/v1/users", `{`, http.StatusBadRequest},
+	}
+
+	for _, d := range testData {
+		if w := serve(h, d.method, d.path, d.body); w.Code != d.code {
+			t.Fatalf("%s %s: expected status %d got %d", d.method, d.path, d.code, w.Code)
+		}
+	}
+
+	// errors of the services are translated
+	h = NewHandler(Client(&testClient{err: errors.Forbidden("go.micro.srv.user", "denied")}), Routes(routes...))
+	w := serve(h, "GET", "/v1/users/1", "")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d got %d", http.StatusForbidden, w.Code)
+	}
+	b, _ := ioutil.ReadAll(w.Body)
+	if ce := errors.Parse(string(b)); ce.Detail != "denied" {
+		t.Fatalf("expected the error of the service got %s", b)
+	}
+}
+
+type testEnum int32
+
+func (e testEnum) String() string {
+	return "ACTIVE"
+}
+
+type testFilter struct {
+	Active bool `protobuf:"varint,1,opt,name=active,proto3" json:"active,omitempty"`
+}
+
+type testListRequest struct {
+	Org      int64       `protobuf:"varint,1,opt,name=org,proto3" json:"org,omitempty"`
+	PageSize uint32      `protobuf:"varint,2,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	Score    float64     `protobuf:"fixed64,3,opt,name=score,proto3" json:"score,omitempty"`
+	State    testEnum    `protobuf:"varint,4,opt,name=state,proto3,enum=test.State" json:"state,omitempty"`
+	Ids      []int64     `protobuf:"varint,5,rep,packed,name=ids,proto3" json:"ids,omitempty"`
+	Filter   *testFilter `protobuf:"bytes,6,opt,name=filter,proto3" json:"filter,omitempty"`
+	Name     string      `protobuf:"bytes,7,opt,name=name,proto3" json:"name,omitempty"`
+}
+
+func TestTranscodeTypes(t *testing.T) {
+	h := NewHandler(Client(&testClient{}), Routes(Route{
+		Method:   "GET",
+		Path:     "/v1/orgs/{org}/users",
+		Service:  "go.micro.srv.user",
+		Endpoint: "User.List",
+		Request:  &testListRequest{},
+	}))
+
+	testData := []struct {
+		path    string
+		code    int
+		request string
+	}{
+		{"/v1/orgs/1/users?filter.active=true&pageSize=10&score=1.5&name=1", 200, `{"filter":{"active":true},"name":"1","org":1,"pageSize":10,"score":1.5}`},
+		// enums by name or number, repeated fields as arrays
+		{"/v1/orgs/1/users?state=ACTIVE&ids=2", 200, `{"ids":[2],"org":1,"state":"ACTIVE"}`},
+		{"/v1/orgs/1/users?state=1&ids=2&ids=3&unknown=4", 200, `{"ids":[2,3],"org":1,"state":1,"unknown":"4"}`},
+		{"/v1/orgs/foo/users", 400, ""},
+		{"/v1/orgs/1/users?filter.active=maybe", 400, ""},
+		{"/v1/orgs/1/users?page_size=-1", 400, ""},
+	}
+
+	for _, d := range testData {
+		w := serve(h, "GET", d.path, "")
+		if w.Code != d.code {
+			t.Fatalf("%s: expected status %d got %d %s", d.path, d.code, w.Code, w.Body.String())
+		}
+		if d.code != 200 {
+			continue
+		}
+
+		var rsp testResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil {
+			t.Fatal(err)
+		}
+		b, _ := json.Marshal(rsp.Request)
+		if string(b) != d.request {
+			t.Fatalf("%s: expected request %s got %s", d.path, d.request, b)
+		}
+	}
+}
@@ -2,4 +2,7 @@ module github.com/micro/go-plugins/transport/http/v2
 
 go 1.13
 
-require github.com/micro/go-micro/v2 v2.9.1
+require (
+	github.com/micro/go-micro/v2 v2.9.1
+	golang.org/x/net v0.0.0-20200520182314-0ba52f642ac2
+)
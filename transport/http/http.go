@@ -2,15 +2,89 @@
 package http
 
 import (
+	"crypto/tls"
+	"net"
+
 	"github.com/micro/go-micro/v2/config/cmd"
 	"github.com/micro/go-micro/v2/transport"
+	maddr "github.com/micro/go-micro/v2/util/addr"
+	mnet "github.com/micro/go-micro/v2/util/net"
+	mls "github.com/micro/go-micro/v2/util/tls"
+	"github.com/micro/go-plugins/transport/http/v2/internal/listener"
 )
 
+type httpTransport struct {
+	transport.Transport
+}
+
 func init() {
 	cmd.DefaultTransports["http"] = NewTransport
 }
 
+func (h *httpTransport) Listen(addr string, opts ...transport.ListenOption) (transport.Listener, error) {
+	options := h.Options()
+
+	var reusePort bool
+	if options.Context != nil {
+		reusePort, _ = options.Context.Value(reusePortKey{}).(bool)
+	}
+
+	// the listener is handed over on restart
+	listen := func(addr string) (net.Listener, error) {
+		return listener.Listen(addr, reusePort)
+	}
+
+	var l net.Listener
+	var err error
+
+	if options.Secure || options.TLSConfig != nil {
+		config := options.TLSConfig
+
+		fn := func(addr string) (net.Listener, error) {
+			if config == nil {
+				hosts := []string{addr}
+
+				// check if its a valid host:port
+				if host, _, err := net.SplitHostPort(addr); err == nil {
+					if len(host) == 0 {
+						hosts = maddr.IPs()
+					} else {
+						hosts = []string{host}
+					}
+				}
+
+				// generate a certificate
+				cert, err := mls.Certificate(hosts...)
+				if err != nil {
+					return nil, err
+				}
+				config = &tls.Config{Certificates: []tls.Certificate{cert}}
+			}
+			l, err := listen(addr)
+			if err != nil {
+				return nil, err
+			}
+			return tls.NewListener(l, config), nil
+		}
+
+		l, err = mnet.Listen(addr, fn)
+	} else {
+		l, err = mnet.Listen(addr, listen)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &httpTransportListener{
+		opts:     options,
+		listener: l,
+	}, nil
+}
+
 // NewTransport returns a new http transport using net/http and supporting http2
 func NewTransport(opts ...transport.Option) transport.Transport {
-	return transport.NewTransport(opts...)
+	return &httpTransport{
+		Transport: transport.NewTransport(opts...),
+	}
 }
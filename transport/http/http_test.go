@@ -0,0 +1,76 @@
+package http
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/micro/go-micro/v2/transport"
+)
+
+func TestHTTPTransportCommunication(t *testing.T) {
+	tr := NewTransport()
+
+	l, err := tr.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected listen err: %v", err)
+	}
+	defer l.Close()
+
+	go l.Accept(func(sock transport.Socket) {
+		for {
+			var m transport.Message
+			if err := sock.Recv(&m); err != nil {
+				return
+			}
+			m.Body = append([]byte("echo "), m.Body...)
+			if err := sock.Send(&m); err != nil {
+				return
+			}
+		}
+	})
+
+	c, err := tr.Dial(l.Addr())
+	if err != nil {
+		t.Fatalf("Unexpected dial err: %v", err)
+	}
+	defer c.Close()
+
+	// the connection keeps exchanging messages
+	for i := 0; i < 3; i++ {
+		m := transport.Message{
+			Header: map[string]string{"Content-Type": "application/json"},
+			Body:   []byte(`{"message": "Hello World"}`),
+		}
+		if err := c.Send(&m); err != nil {
+			t.Fatalf("Unexpected send err: %v", err)
+		}
+
+		var rm transport.Message
+		if err := c.Recv(&rm); err != nil {
+			t.Fatalf("Unexpected recv err: %v", err)
+		}
+		if string(rm.Body) != "echo "+string(m.Body) {
+			t.Fatalf("Expected %s, got %s", "echo "+string(m.Body), rm.Body)
+		}
+	}
+}
+
+func TestHTTPTransportReusePort(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_REUSEPORT test only runs on linux")
+	}
+
+	tr := NewTransport(ReusePort())
+
+	l1, err := tr.Listen("127.0.0.1:44461")
+	if err != nil {
+		t.Fatalf("Did not expect an error, got %s", err)
+	}
+	defer l1.Close()
+
+	l2, err := tr.Listen("127.0.0.1:44461")
+	if err != nil {
+		t.Fatalf("Expected second listener to share the port, got %s", err)
+	}
+	l2.Close()
+}
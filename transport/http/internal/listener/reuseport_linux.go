@@ -0,0 +1,4 @@
+package listener
+
+// soReusePort is missing from the syscall package on linux
+const soReusePort = 0xf
@@ -0,0 +1,286 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/transport"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+/*
+	The go-micro http transport binds its listeners itself, so they can't be handed
+	over to a new process. The transport serves its listeners here instead, speaking
+	the same protocol as the go-micro one: HTTP/1 connections are hijacked and keep
+	exchanging requests, HTTP/2 requests stream their bodies. Dialing is left to the
+	go-micro transport.
+*/
+
+type httpTransportListener struct {
+	opts     transport.Options
+	listener net.Listener
+}
+
+type httpTransportSocket struct {
+	timeout time.Duration
+	w       http.ResponseWriter
+	r       *http.Request
+	rw      *bufio.ReadWriter
+
+	mtx sync.RWMutex
+
+	// the hijacked when using http 1
+	conn net.Conn
+	// for the first request
+	ch chan *http.Request
+
+	// h2 things
+	buf *bufio.Reader
+	// indicate if socket is closed
+	closed chan bool
+
+	// local/remote ip
+	local  string
+	remote string
+}
+
+func (h *httpTransportSocket) Local() string {
+	return h.local
+}
+
+func (h *httpTransportSocket) Remote() string {
+	return h.remote
+}
+
+// header copies the header of the request to the message
+func header(m *transport.Message, hdr http.Header) {
+	for k, v := range hdr {
+		if len(v) > 0 {
+			m.Header[k] = v[0]
+		} else {
+			m.Header[k] = ""
+		}
+	}
+}
+
+func (h *httpTransportSocket) Recv(m *transport.Message) error {
+	if m == nil {
+		return errors.New("message passed in is nil")
+	}
+	if m.Header == nil {
+		m.Header = make(map[string]string, len(h.r.Header))
+	}
+
+	// process http 1
+	if h.r.ProtoMajor == 1 {
+		// set timeout if its greater than 0
+		if h.timeout > time.Duration(0) {
+			h.conn.SetDeadline(time.Now().Add(h.timeout))
+		}
+
+		var r *http.Request
+
+		select {
+		// get first request
+		case r = <-h.ch:
+		// read next request
+		default:
+			rr, err := http.ReadRequest(h.rw.Reader)
+			if err != nil {
+				return err
+			}
+			r = rr
+		}
+
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		r.Body.Close()
+		m.Body = b
+		header(m, r.Header)
+		return nil
+	}
+
+	// only process if the socket is open
+	select {
+	case <-h.closed:
+		return io.EOF
+	default:
+	}
+
+	// read the streaming body of http2
+	buf := make([]byte, 4*1024*1024)
+	n, err := h.buf.Read(buf)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		m.Body = buf[:n]
+	}
+	header(m, h.r.Header)
+	m.Header[":path"] = h.r.URL.Path
+
+	return nil
+}
+
+func (h *httpTransportSocket) Send(m *transport.Message) error {
+	if h.r.ProtoMajor == 1 {
+		// make copy of header
+		hdr := make(http.Header)
+		for k, v := range h.r.Header {
+			hdr[k] = v
+		}
+
+		rsp := &http.Response{
+			Header:        hdr,
+			Body:          ioutil.NopCloser(bytes.NewReader(m.Body)),
+			Status:        "200 OK",
+			StatusCode:    200,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			ContentLength: int64(len(m.Body)),
+		}
+
+		for k, v := range m.Header {
+			rsp.Header.Set(k, v)
+		}
+
+		// set timeout if its greater than 0
+		if h.timeout > time.Duration(0) {
+			h.conn.SetDeadline(time.Now().Add(h.timeout))
+		}
+
+		return rsp.Write(h.conn)
+	}
+
+	// only process if the socket is open
+	select {
+	case <-h.closed:
+		return io.EOF
+	default:
+	}
+
+	// we need to lock to protect the write
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	for k, v := range m.Header {
+		h.w.Header().Set(k, v)
+	}
+
+	_, err := h.w.Write(m.Body)
+
+	// flush the trailers
+	h.w.(http.Flusher).Flush()
+
+	return err
+}
+
+func (h *httpTransportSocket) Close() error {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	select {
+	case <-h.closed:
+		return nil
+	default:
+		close(h.closed)
+		h.r.Body.Close()
+		if h.r.ProtoMajor == 1 {
+			return h.conn.Close()
+		}
+	}
+
+	return nil
+}
+
+func (h *httpTransportListener) Addr() string {
+	return h.listener.Addr().String()
+}
+
+func (h *httpTransportListener) Close() error {
+	return h.listener.Close()
+}
+
+func (h *httpTransportListener) Accept(fn func(transport.Socket)) error {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		var buf *bufio.ReadWriter
+		var con net.Conn
+
+		// read a regular request
+		if r.ProtoMajor == 1 {
+			b, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+			hj, ok := w.(http.Hijacker)
+			if !ok {
+				http.Error(w, "cannot serve conn", http.StatusInternalServerError)
+				return
+			}
+
+			conn, bufrw, err := hj.Hijack()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer conn.Close()
+			buf = bufrw
+			con = conn
+		}
+
+		// save the request
+		ch := make(chan *http.Request, 1)
+		ch <- r
+
+		sock := &httpTransportSocket{
+			timeout: h.opts.Timeout,
+			w:       w,
+			r:       r,
+			rw:      buf,
+			buf:     bufio.NewReader(r.Body),
+			ch:      ch,
+			conn:    con,
+			local:   h.Addr(),
+			remote:  r.RemoteAddr,
+			closed:  make(chan bool),
+		}
+
+		fn(sock)
+	})
+
+	// handlers set with Handle
+	if h.opts.Context != nil {
+		handlers, ok := h.opts.Context.Value("http_handlers").(map[string]http.Handler)
+		if ok {
+			for pattern, handler := range handlers {
+				mux.Handle(pattern, handler)
+			}
+		}
+	}
+
+	srv := &http.Server{
+		Handler: mux,
+	}
+
+	// insecure connection use h2c
+	if !(h.opts.Secure || h.opts.TLSConfig != nil) {
+		srv.Handler = h2c.NewHandler(mux, &http2.Server{})
+	}
+
+	return srv.Serve(h.listener)
+}
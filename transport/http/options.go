@@ -1,13 +1,36 @@
 package http
 
 import (
+	"context"
 	"net/http"
+	"os"
 
 	"github.com/micro/go-micro/v2/transport"
 	thttp "github.com/micro/go-micro/v2/transport/http"
+	"github.com/micro/go-plugins/transport/http/v2/internal/listener"
 )
 
+type reusePortKey struct{}
+
 // Handle registers the handler for the given pattern.
 func Handle(pattern string, handler http.Handler) transport.Option {
 	return thttp.Handle(pattern, handler)
 }
+
+// ReusePort sets SO_REUSEPORT on listening sockets so a new process can bind the
+// same address while the old one drains. Supported on linux, darwin and the BSDs
+func ReusePort() transport.Option {
+	return func(o *transport.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, reusePortKey{}, true)
+	}
+}
+
+// Restart starts a new instance of the running binary, with the same arguments and
+// environment, which takes over the sockets of all open listeners. It is typically
+// called on SIGUSR2, the caller remains responsible for draining and exiting
+func Restart() (*os.Process, error) {
+	return listener.Restart()
+}
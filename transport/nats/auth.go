@@ -0,0 +1,149 @@
+package nats
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/transport"
+	"github.com/nats-io/nkeys"
+)
+
+/*
+	NKey authentication signs every message a client sends with the NKey seed of
+	the client. The listener verifies the signature against a set of trusted public
+	keys and drops messages which aren't signed by one of them. The signature covers
+	a nonce, the time of signing, the reply subject and the body, so a signature
+	can't be moved to another message or replayed once it is older than MaxSkew.
+*/
+
+const (
+	// NkeyHeader holds the public key of the signing client
+	NkeyHeader = "Micro-Nkey"
+	// NonceHeader holds the nonce and time of signing
+	NonceHeader = "Micro-Nkey-Nonce"
+	// SignatureHeader holds the signature
+	SignatureHeader = "Micro-Nkey-Signature"
+)
+
+var (
+	// MaxSkew is how old a signature may be, it also bounds how long nonces are remembered
+	MaxSkew = time.Minute
+
+	errUnauthenticated = errors.New("message is not signed by a trusted nkey")
+)
+
+// signedData returns the bytes covered by the signature
+func signedData(nonce, reply string, body []byte) []byte {
+	h := sha256.Sum256(body)
+	return []byte(nonce + "." + reply + "." + base64.RawURLEncoding.EncodeToString(h[:]))
+}
+
+// sign returns a copy of the message carrying the signature headers
+func sign(kp nkeys.KeyPair, reply string, m *transport.Message) (*transport.Message, error) {
+	pub, err := kp.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	n := make([]byte, 16)
+	if _, err := rand.Read(n); err != nil {
+		return nil, err
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(n) + "." + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	sig, err := kp.Sign(signedData(nonce, reply, m.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	header := make(map[string]string, len(m.Header)+3)
+	for k, v := range m.Header {
+		header[k] = v
+	}
+	header[NkeyHeader] = pub
+	header[NonceHeader] = nonce
+	header[SignatureHeader] = base64.RawURLEncoding.EncodeToString(sig)
+
+	return &transport.Message{Header: header, Body: m.Body}, nil
+}
+
+// verifier checks signatures against the trusted keys and remembers recent nonces
+type verifier struct {
+	keys map[string]nkeys.KeyPair
+
+	sync.Mutex
+	nonces map[string]time.Time
+	purged time.Time
+}
+
+func newVerifier(pubs []string) (*verifier, error) {
+	keys := make(map[string]nkeys.KeyPair, len(pubs))
+	for _, pub := range pubs {
+		kp, err := nkeys.FromPublicKey(pub)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted nkey %s: %v", pub, err)
+		}
+		keys[pub] = kp
+	}
+	return &verifier{
+		keys:   keys,
+		nonces: make(map[string]time.Time),
+		purged: time.Now(),
+	}, nil
+}
+
+func (v *verifier) verify(reply string, m *transport.Message) error {
+	kp, ok := v.keys[m.Header[NkeyHeader]]
+	if !ok {
+		return errUnauthenticated
+	}
+
+	nonce := m.Header[NonceHeader]
+	parts := strings.Split(nonce, ".")
+	if len(parts) != 2 {
+		return errUnauthenticated
+	}
+	ts, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return errUnauthenticated
+	}
+	signed := time.Unix(0, ts)
+	if d := time.Since(signed); d > MaxSkew || d < -MaxSkew {
+		return errUnauthenticated
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(m.Header[SignatureHeader])
+	if err != nil {
+		return errUnauthenticated
+	}
+	if err := kp.Verify(signedData(nonce, reply, m.Body), sig); err != nil {
+		return errUnauthenticated
+	}
+
+	v.Lock()
+	defer v.Unlock()
+
+	now := time.Now()
+	if now.Sub(v.purged) > MaxSkew {
+		for n, t := range v.nonces {
+			if now.Sub(t) > 2*MaxSkew {
+				delete(v.nonces, n)
+			}
+		}
+		v.purged = now
+	}
+
+	if _, ok := v.nonces[nonce]; ok {
+		return errUnauthenticated
+	}
+	v.nonces[nonce] = signed
+
+	return nil
+}
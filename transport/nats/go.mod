@@ -6,4 +6,5 @@ require (
 	github.com/go-log/log v0.2.0
 	github.com/micro/go-micro/v2 v2.9.1
 	github.com/nats-io/nats.go v1.9.2
+	github.com/nats-io/nkeys v0.1.4
 )
@@ -4,22 +4,33 @@ package nats
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/micro/go-micro/v2/codec/json"
 	"github.com/micro/go-micro/v2/config/cmd"
+	"github.com/micro/go-micro/v2/logger"
 	"github.com/micro/go-micro/v2/server"
 	"github.com/micro/go-micro/v2/transport"
+	"github.com/micro/go-plugins/transport/nats/v2/internal/natsdiscovery"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
 )
 
 type ntport struct {
 	addrs []string
 	opts  transport.Options
 	nopts nats.Options
+	pool  *natsdiscovery.Pool
+
+	// signer signs outgoing messages, verifier authenticates incoming ones
+	signer   nkeys.KeyPair
+	verifier *verifier
+	authErr  error
 }
 
 type ntportClient struct {
@@ -30,6 +41,7 @@ type ntportClient struct {
 	remote string
 	sub    *nats.Subscription
 	opts   transport.Options
+	signer nkeys.KeyPair
 }
 
 type ntportSocket struct {
@@ -42,6 +54,12 @@ type ntportSocket struct {
 	sync.Mutex
 	bl []*nats.Msg
 
+	// idle closes the socket when there was no traffic for idleTimeout, it's
+	// paused from receiving a request until the handler sends a response
+	idle        *time.Timer
+	idleTimeout time.Duration
+	busy        bool
+
 	opts   transport.Options
 	local  string
 	remote string
@@ -55,7 +73,9 @@ type ntportListener struct {
 	sync.RWMutex
 	so map[string]*ntportSocket
 
-	opts transport.Options
+	opts        transport.Options
+	idleTimeout time.Duration
+	verifier    *verifier
 }
 
 var (
@@ -96,6 +116,25 @@ func configure(n *ntport, opts ...transport.Option) {
 	n.opts.Addrs = setAddrs(n.opts.Addrs)
 	n.nopts = natsOptions
 	n.addrs = n.opts.Addrs
+
+	pin, _ := n.opts.Context.Value(pinSeedServersKey{}).(bool)
+	n.pool = natsdiscovery.NewPool(n.addrs, pin)
+
+	n.signer, n.verifier, n.authErr = nil, nil, nil
+	if seed, ok := n.opts.Context.Value(signingKeyKey{}).([]byte); ok {
+		kp, err := nkeys.FromSeed(seed)
+		if err != nil {
+			n.authErr = fmt.Errorf("invalid signing key: %v", err)
+		}
+		n.signer = kp
+	}
+	if keys, ok := n.opts.Context.Value(trustedKeysKey{}).([]string); ok {
+		v, err := newVerifier(keys)
+		if err != nil {
+			n.authErr = err
+		}
+		n.verifier = v
+	}
 }
 
 func setAddrs(addrs []string) []string {
@@ -124,6 +163,14 @@ func (n *ntportClient) Remote() string {
 }
 
 func (n *ntportClient) Send(m *transport.Message) error {
+	if n.signer != nil {
+		sm, err := sign(n.signer, n.id, m)
+		if err != nil {
+			return err
+		}
+		m = sm
+	}
+
 	b, err := n.opts.Codec.Marshal(m)
 	if err != nil {
 		return err
@@ -192,14 +239,17 @@ func (n *ntportSocket) Recv(m *transport.Message) error {
 	var ok bool
 
 	// if there's a deadline we use it
+	var deadline <-chan time.Time
 	if n.opts.Timeout > time.Duration(0) {
-		select {
-		case r, ok = <-n.r:
-		case <-time.After(n.opts.Timeout):
-			return errors.New("deadline exceeded")
-		}
-	} else {
-		r, ok = <-n.r
+		deadline = time.After(n.opts.Timeout)
+	}
+
+	select {
+	case r, ok = <-n.r:
+	case <-n.close:
+		return io.EOF
+	case <-deadline:
+		return errors.New("deadline exceeded")
 	}
 
 	if !ok {
@@ -207,6 +257,11 @@ func (n *ntportSocket) Recv(m *transport.Message) error {
 	}
 
 	n.Lock()
+	// the handler may take longer than the idle timeout to respond
+	n.busy = true
+	if n.idle != nil {
+		n.idle.Stop()
+	}
 	if len(n.bl) > 0 {
 		select {
 		case n.r <- n.bl[0]:
@@ -228,6 +283,11 @@ func (n *ntportSocket) Send(m *transport.Message) error {
 		return err
 	}
 
+	n.Lock()
+	n.busy = false
+	n.Unlock()
+	n.touch()
+
 	// no deadline
 	if n.opts.Timeout == time.Duration(0) {
 		return n.conn.Publish(n.m.Reply, b)
@@ -248,13 +308,29 @@ func (n *ntportSocket) Send(m *transport.Message) error {
 	}
 }
 
+// touch resets the idle timer after traffic on the socket, unless a request is
+// being handled
+func (n *ntportSocket) touch() {
+	n.Lock()
+	defer n.Unlock()
+	if n.idle != nil && !n.busy {
+		n.idle.Reset(n.idleTimeout)
+	}
+}
+
 func (n *ntportSocket) Close() error {
+	n.Lock()
+	defer n.Unlock()
+
 	select {
 	case <-n.close:
 		return nil
 	default:
 		close(n.close)
 	}
+	if n.idle != nil {
+		n.idle.Stop()
+	}
 	return nil
 }
 
@@ -287,6 +363,17 @@ func (n *ntportListener) Accept(fn func(transport.Socket)) error {
 			return err
 		}
 
+		if n.verifier != nil {
+			var msg transport.Message
+			if err := n.opts.Codec.Unmarshal(m.Data, &msg); err != nil {
+				continue
+			}
+			if err := n.verifier.verify(m.Reply, &msg); err != nil {
+				logger.Warnf("Dropping message from %s on %s: %v", m.Reply, n.addr, err)
+				continue
+			}
+		}
+
 		n.RLock()
 		sock, ok := n.so[m.Reply]
 		n.RUnlock()
@@ -301,6 +388,12 @@ func (n *ntportListener) Accept(fn func(transport.Socket)) error {
 				local:  n.Addr(),
 				remote: m.Reply,
 			}
+			if n.idleTimeout > 0 {
+				sock.idleTimeout = n.idleTimeout
+				sock.idle = time.AfterFunc(n.idleTimeout, func() {
+					sock.Close()
+				})
+			}
 			n.Lock()
 			n.so[m.Reply] = sock
 			n.Unlock()
@@ -329,6 +422,8 @@ func (n *ntportListener) Accept(fn func(transport.Socket)) error {
 		default:
 		}
 
+		sock.touch()
+
 		sock.Lock()
 		sock.bl = append(sock.bl, m)
 		select {
@@ -350,6 +445,10 @@ func (n *ntport) Dial(addr string, dialOpts ...transport.DialOption) (transport.
 		o(&dopts)
 	}
 
+	if err := n.Validate(); err != nil {
+		return nil, err
+	}
+
 	opts := n.nopts
 	opts.Servers = n.addrs
 	opts.Secure = n.opts.Secure
@@ -361,6 +460,8 @@ func (n *ntport) Dial(addr string, dialOpts ...transport.DialOption) (transport.
 		opts.Secure = true
 	}
 
+	n.pool.Apply(&opts)
+
 	c, err := opts.Connect()
 	if err != nil {
 		return nil, err
@@ -378,12 +479,27 @@ func (n *ntport) Dial(addr string, dialOpts ...transport.DialOption) (transport.
 		id:     id,
 		sub:    sub,
 		opts:   n.opts,
+		signer: n.signer,
 		local:  id,
 		remote: addr,
 	}, nil
 }
 
 func (n *ntport) Listen(addr string, listenOpts ...transport.ListenOption) (transport.Listener, error) {
+	var lopts transport.ListenOptions
+	for _, o := range listenOpts {
+		o(&lopts)
+	}
+
+	if err := n.Validate(); err != nil {
+		return nil, err
+	}
+
+	var idleTimeout time.Duration
+	if lopts.Context != nil {
+		idleTimeout, _ = lopts.Context.Value(idleTimeoutKey{}).(time.Duration)
+	}
+
 	opts := n.nopts
 	opts.Servers = n.addrs
 	opts.Secure = n.opts.Secure
@@ -394,6 +510,8 @@ func (n *ntport) Listen(addr string, listenOpts ...transport.ListenOption) (tran
 		opts.Secure = true
 	}
 
+	n.pool.Apply(&opts)
+
 	c, err := opts.Connect()
 	if err != nil {
 		return nil, err
@@ -421,11 +539,60 @@ func (n *ntport) Listen(addr string, listenOpts ...transport.ListenOption) (tran
 		exit: make(chan bool, 1),
 		so:   make(map[string]*ntportSocket),
 		opts: n.opts,
+
+		idleTimeout: idleTimeout,
+		verifier:    n.verifier,
 	}, nil
 }
 
 func (n *ntport) Init(opts ...transport.Option) error {
 	configure(n, opts...)
+	return n.Validate()
+}
+
+// Validate checks the options for mistakes which would otherwise only surface
+// when dialing or listening, such as malformed addresses or conflicting auth modes
+func (n *ntport) Validate() error {
+	for _, addr := range n.addrs {
+		u, err := url.Parse(addr)
+		if err != nil {
+			return fmt.Errorf("invalid address %q: %v", addr, err)
+		}
+		// a scheme other than nats:// ends up in the path e.g nats://tls://host
+		if len(u.Hostname()) == 0 || (len(u.Path) > 0 && u.Path != "/") {
+			return fmt.Errorf("invalid address %q", addr)
+		}
+	}
+
+	if n.opts.Timeout < 0 {
+		return fmt.Errorf("invalid timeout %v", n.opts.Timeout)
+	}
+
+	if n.authErr != nil {
+		return n.authErr
+	}
+
+	var modes []string
+	if len(n.nopts.User) > 0 || len(n.nopts.Password) > 0 {
+		modes = append(modes, "user/password")
+	}
+	if len(n.nopts.Token) > 0 || n.nopts.TokenHandler != nil {
+		modes = append(modes, "token")
+	}
+	if len(n.nopts.Nkey) > 0 {
+		modes = append(modes, "nkey")
+	}
+	if n.nopts.UserJWT != nil {
+		modes = append(modes, "jwt")
+	}
+	if len(modes) > 1 {
+		return fmt.Errorf("conflicting auth modes: %s", strings.Join(modes, ", "))
+	}
+
+	if (len(n.nopts.Nkey) > 0 || n.nopts.UserJWT != nil) && n.nopts.SignatureCB == nil {
+		return errors.New("nkey and jwt auth require a signature callback")
+	}
+
 	return nil
 }
 
@@ -449,5 +616,9 @@ func NewTransport(opts ...transport.Option) transport.Transport {
 		opts: options,
 	}
 	configure(nt, opts...)
+	// the transport can't be returned with an error, Init, Dial and Listen return it
+	if err := nt.Validate(); err != nil {
+		logger.Errorf("[nats] invalid options: %v", err)
+	}
 	return nt
 }
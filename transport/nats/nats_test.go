@@ -4,11 +4,14 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-log/log"
+	"github.com/micro/go-micro/v2/codec/json"
 	"github.com/micro/go-micro/v2/server"
 	"github.com/micro/go-micro/v2/transport"
 	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
 )
 
 var addrTestCases = []struct {
@@ -133,3 +136,128 @@ func TestListenAddr(t *testing.T) {
 		})
 	}
 }
+
+func TestValidate(t *testing.T) {
+	testData := []struct {
+		name  string
+		opts  []transport.Option
+		valid bool
+	}{
+		{"default", nil, true},
+		{"addrs", []transport.Option{transport.Addrs("127.0.0.1:4222")}, true},
+		{"scheme", []transport.Option{transport.Addrs("tls://127.0.0.1:4222")}, false},
+		{"auth", []transport.Option{Options(nats.Options{User: "user", Password: "pass", Token: "token"})}, false},
+		{"nkey", []transport.Option{Options(nats.Options{Nkey: "UABC"})}, false},
+		{"signingKey", []transport.Option{SigningKey([]byte("SUABC"))}, false},
+		{"trustedKeys", []transport.Option{TrustedKeys("UABC")}, false},
+	}
+
+	for _, d := range testData {
+		t.Run(d.name, func(t *testing.T) {
+			tr := NewTransport(d.opts...)
+			err := tr.(*ntport).Validate()
+			if d.valid && err != nil {
+				t.Fatalf("expected options to be valid, got %v", err)
+			}
+			if !d.valid && err == nil {
+				t.Fatal("expected options to be invalid")
+			}
+		})
+	}
+}
+
+func TestNkeyAuth(t *testing.T) {
+	user, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _ := user.PublicKey()
+
+	v, err := newVerifier([]string{pub})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &transport.Message{Header: map[string]string{"Micro-Endpoint": "Foo.Bar"}, Body: []byte("hello")}
+
+	sm, err := sign(user, "_INBOX.1", m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Header) != 1 {
+		t.Fatal("expected the original message to be left untouched")
+	}
+	if err := v.verify("_INBOX.1", sm); err != nil {
+		t.Fatalf("expected signed message to verify, got %v", err)
+	}
+	if err := v.verify("_INBOX.1", sm); err == nil {
+		t.Fatal("expected replayed message to be rejected")
+	}
+
+	sm, _ = sign(user, "_INBOX.1", m)
+	if err := v.verify("_INBOX.2", sm); err == nil {
+		t.Fatal("expected message with another reply subject to be rejected")
+	}
+
+	sm, _ = sign(user, "_INBOX.1", m)
+	sm.Body = []byte("tampered")
+	if err := v.verify("_INBOX.1", sm); err == nil {
+		t.Fatal("expected tampered message to be rejected")
+	}
+
+	sm, _ = sign(other, "_INBOX.1", m)
+	if err := v.verify("_INBOX.1", sm); err == nil {
+		t.Fatal("expected message signed by an untrusted key to be rejected")
+	}
+
+	if err := v.verify("_INBOX.1", m); err == nil {
+		t.Fatal("expected unsigned message to be rejected")
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	codec := json.Marshaler{}
+	b, err := codec.Marshal(&transport.Message{Body: []byte("foo")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sock := &ntportSocket{
+		r:           make(chan *nats.Msg, 1),
+		close:       make(chan bool),
+		opts:        transport.Options{Codec: codec},
+		idleTimeout: 20 * time.Millisecond,
+	}
+	sock.idle = time.AfterFunc(sock.idleTimeout, func() {
+		sock.Close()
+	})
+
+	// the timer is paused while the request is handled
+	sock.r <- &nats.Msg{Data: b}
+	var m transport.Message
+	if err := sock.Recv(&m); err != nil {
+		t.Fatal(err)
+	}
+	sock.touch()
+	time.Sleep(3 * sock.idleTimeout)
+	select {
+	case <-sock.close:
+		t.Fatal("expected the socket to stay open while the request is handled")
+	default:
+	}
+
+	// and resumes once the response is sent
+	sock.Lock()
+	sock.busy = false
+	sock.Unlock()
+	sock.touch()
+	select {
+	case <-sock.close:
+	case <-time.After(time.Second):
+		t.Fatal("expected the idle socket to be closed")
+	}
+}
@@ -2,12 +2,17 @@ package nats
 
 import (
 	"context"
+	"time"
 
 	"github.com/micro/go-micro/v2/transport"
 	"github.com/nats-io/nats.go"
 )
 
 type optionsKey struct{}
+type idleTimeoutKey struct{}
+type signingKeyKey struct{}
+type trustedKeysKey struct{}
+type pinSeedServersKey struct{}
 
 // Options allow to inject a nats.Options struct for configuring
 // the nats connection
@@ -19,3 +24,48 @@ func Options(nopts nats.Options) transport.Option {
 		o.Context = context.WithValue(o.Context, optionsKey{}, nopts)
 	}
 }
+
+// IdleTimeout closes sockets accepted by the listener which have seen no traffic
+// for the given duration. The time from receiving a request until the handler sends
+// its response isn't counted. The handler observes io.EOF from Recv
+func IdleTimeout(d time.Duration) transport.ListenOption {
+	return func(o *transport.ListenOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, idleTimeoutKey{}, d)
+	}
+}
+
+// SigningKey signs every message sent by clients with the given NKey seed so
+// listeners configured with TrustedKeys can authenticate the sender
+func SigningKey(seed []byte) transport.Option {
+	return func(o *transport.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, signingKeyKey{}, seed)
+	}
+}
+
+// TrustedKeys makes listeners drop messages which aren't signed by one of the
+// given public NKeys. Signatures older than MaxSkew or replayed are rejected too
+func TrustedKeys(keys ...string) transport.Option {
+	return func(o *transport.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, trustedKeysKey{}, keys)
+	}
+}
+
+// PinSeedServers only connects to the configured servers, servers of the cluster
+// discovered through the nats INFO protocol are ignored
+func PinSeedServers() transport.Option {
+	return func(o *transport.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, pinSeedServersKey{}, true)
+	}
+}
@@ -0,0 +1,21 @@
+package rabbitmq
+
+import (
+	"context"
+	"time"
+
+	"github.com/micro/go-micro/v2/transport"
+)
+
+type idleTimeoutKey struct{}
+
+// IdleTimeout closes sockets accepted by the listener which have seen no traffic
+// for the given duration. The handler observes io.EOF from Recv
+func IdleTimeout(d time.Duration) transport.ListenOption {
+	return func(o *transport.ListenOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, idleTimeoutKey{}, d)
+	}
+}
@@ -51,6 +51,10 @@ type rmqtportSocket struct {
 	sync.Mutex
 	r  chan *amqp.Delivery
 	bl []*amqp.Delivery
+
+	// idle closes the socket when there was no traffic for idleTimeout
+	idle        *time.Timer
+	idleTimeout time.Duration
 }
 
 type rmqtportListener struct {
@@ -61,6 +65,8 @@ type rmqtportListener struct {
 
 	sync.RWMutex
 	so map[string]*rmqtportSocket
+
+	idleTimeout time.Duration
 }
 
 var (
@@ -162,20 +168,25 @@ func (r *rmqtportSocket) Recv(m *transport.Message) error {
 	var d *amqp.Delivery
 	var ok bool
 
+	var timeout <-chan time.Time
 	if r.rt.opts.Timeout > time.Duration(0) {
-		select {
-		case d, ok = <-r.r:
-		case <-time.After(r.rt.opts.Timeout):
-			return errors.New("timed out")
-		}
-	} else {
-		d, ok = <-r.r
+		timeout = time.After(r.rt.opts.Timeout)
+	}
+
+	select {
+	case d, ok = <-r.r:
+	case <-r.close:
+		return io.EOF
+	case <-timeout:
+		return errors.New("timed out")
 	}
 
 	if !ok {
 		return io.EOF
 	}
 
+	r.touch()
+
 	r.Lock()
 	if len(r.bl) > 0 {
 		select {
@@ -211,6 +222,8 @@ func (r *rmqtportSocket) Send(m *transport.Message) error {
 		msg.Headers[k] = v
 	}
 
+	r.touch()
+
 	// no timeout
 	if r.rt.opts.Timeout == time.Duration(0) {
 		return r.conn.Publish("", r.d.ReplyTo, msg)
@@ -231,13 +244,26 @@ func (r *rmqtportSocket) Send(m *transport.Message) error {
 	}
 }
 
+// touch resets the idle timer after traffic on the socket
+func (r *rmqtportSocket) touch() {
+	if r.idle != nil {
+		r.idle.Reset(r.idleTimeout)
+	}
+}
+
 func (r *rmqtportSocket) Close() error {
+	r.Lock()
+	defer r.Unlock()
+
 	select {
 	case <-r.close:
 		return nil
 	default:
 		close(r.close)
 	}
+	if r.idle != nil {
+		r.idle.Stop()
+	}
 	return nil
 }
 
@@ -300,6 +326,12 @@ func (r *rmqtportListener) accept(fn func(transport.Socket)) (bool, error) {
 					local:  r.Addr(),
 					remote: d.CorrelationId,
 				}
+				if r.idleTimeout > 0 {
+					sock.idleTimeout = r.idleTimeout
+					sock.idle = time.AfterFunc(r.idleTimeout, func() {
+						sock.Close()
+					})
+				}
 				r.Lock()
 				r.so[sock.d.CorrelationId] = sock
 				r.Unlock()
@@ -320,6 +352,8 @@ func (r *rmqtportListener) accept(fn func(transport.Socket)) (bool, error) {
 			default:
 			}
 
+			sock.touch()
+
 			sock.Lock()
 			sock.bl = append(sock.bl, &d)
 			select {
@@ -402,6 +436,16 @@ func (r *rmqtport) Dial(addr string, opts ...transport.DialOption) (transport.Cl
 }
 
 func (r *rmqtport) Listen(addr string, opts ...transport.ListenOption) (transport.Listener, error) {
+	var options transport.ListenOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	var idleTimeout time.Duration
+	if options.Context != nil {
+		idleTimeout, _ = options.Context.Value(idleTimeoutKey{}).(time.Duration)
+	}
+
 	if len(addr) == 0 || addr == ":0" {
 		id, err := uuid.NewRandom()
 		if err != nil {
@@ -419,6 +463,8 @@ func (r *rmqtport) Listen(addr string, opts ...transport.ListenOption) (transpor
 		conn: conn,
 		exit: make(chan bool, 1),
 		so:   make(map[string]*rmqtportSocket),
+
+		idleTimeout: idleTimeout,
 	}, nil
 }
 
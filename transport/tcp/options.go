@@ -0,0 +1,29 @@
+package tcp
+
+import (
+	"context"
+	"os"
+
+	"github.com/micro/go-micro/v2/transport"
+	"github.com/micro/go-plugins/transport/tcp/v2/internal/listener"
+)
+
+type reusePortKey struct{}
+
+// ReusePort sets SO_REUSEPORT on listening sockets so a new process can bind the
+// same address while the old one drains. Supported on linux, darwin and the BSDs
+func ReusePort() transport.Option {
+	return func(o *transport.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, reusePortKey{}, true)
+	}
+}
+
+// Restart starts a new instance of the running binary, with the same arguments and
+// environment, which takes over the sockets of all open listeners. It is typically
+// called on SIGUSR2, the caller remains responsible for draining and exiting
+func Restart() (*os.Process, error) {
+	return listener.Restart()
+}
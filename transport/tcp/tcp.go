@@ -15,6 +15,7 @@ import (
 	maddr "github.com/micro/go-micro/v2/util/addr"
 	mnet "github.com/micro/go-micro/v2/util/net"
 	mls "github.com/micro/go-micro/v2/util/tls"
+	"github.com/micro/go-plugins/transport/tcp/v2/internal/listener"
 )
 
 type tcpTransport struct {
@@ -213,10 +214,19 @@ func (t *tcpTransport) Listen(addr string, opts ...transport.ListenOption) (tran
 		o(&options)
 	}
 
+	var reusePort bool
+	if t.opts.Context != nil {
+		reusePort, _ = t.opts.Context.Value(reusePortKey{}).(bool)
+	}
+
+	// the listener is handed over on restart
+	listen := func(addr string) (net.Listener, error) {
+		return listener.Listen(addr, reusePort)
+	}
+
 	var l net.Listener
 	var err error
 
-	// TODO: support use of listen options
 	if t.opts.Secure || t.opts.TLSConfig != nil {
 		config := t.opts.TLSConfig
 
@@ -240,16 +250,16 @@ func (t *tcpTransport) Listen(addr string, opts ...transport.ListenOption) (tran
 				}
 				config = &tls.Config{Certificates: []tls.Certificate{cert}}
 			}
-			return tls.Listen("tcp", addr, config)
+			l, err := listen(addr)
+			if err != nil {
+				return nil, err
+			}
+			return tls.NewListener(l, config), nil
 		}
 
 		l, err = mnet.Listen(addr, fn)
 	} else {
-		fn := func(addr string) (net.Listener, error) {
-			return net.Listen("tcp", addr)
-		}
-
-		l, err = mnet.Listen(addr, fn)
+		l, err = mnet.Listen(addr, listen)
 	}
 
 	if err != nil {
@@ -2,6 +2,7 @@ package tcp
 
 import (
 	"io"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
@@ -229,3 +230,23 @@ func TestTCPTransportTimeout(t *testing.T) {
 
 	<-done
 }
+
+func TestTCPTransportReusePort(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SO_REUSEPORT test only runs on linux")
+	}
+
+	tp := NewTransport(ReusePort())
+
+	lsn1, err := tp.Listen("127.0.0.1:44460")
+	if err != nil {
+		t.Fatalf("Did not expect an error, got %s", err)
+	}
+	defer lsn1.Close()
+
+	lsn2, err := tp.Listen("127.0.0.1:44460")
+	if err != nil {
+		t.Fatalf("Expected second listener to share the port, got %s", err)
+	}
+	lsn2.Close()
+}
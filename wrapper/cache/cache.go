@@ -0,0 +1,263 @@
+// Package cache provides a client wrapper which caches the responses of idempotent endpoints
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/metadata"
+)
+
+/*
+	Responses are cached by service, endpoint and a hash of the request, along with
+	the metadata the responses vary by. They're kept encoded and decoded into the
+	response of every call, so callers never share a response. Concurrent calls
+	missing the cache for the same key wait for the first one rather than calling
+	the service as well. Calls which failed are served the expired response while
+	it's not older than the stale if error duration.
+*/
+
+var (
+	// DefaultTTL is how long responses are fresh without TTL
+	DefaultTTL = time.Minute
+
+	// DefaultMaxEntries is how many responses are kept without MaxEntries
+	DefaultMaxEntries = 1024
+)
+
+type Options struct {
+	// Endpoints are the idempotent endpoints cached, e.g. Greeter.Hello
+	Endpoints []string
+	// TTL is how long responses are fresh
+	TTL time.Duration
+	// MaxEntries is how many responses are kept, the least recently used are evicted
+	MaxEntries int
+	// StaleIfError is how long after expiring responses are served to failed calls
+	StaleIfError time.Duration
+	// Vary are the metadata keys responses differ by, e.g. Authorization
+	Vary []string
+}
+
+type Option func(*Options)
+
+// Endpoints sets the endpoints cached, only idempotent reads should be
+func Endpoints(eps ...string) Option {
+	return func(o *Options) {
+		o.Endpoints = append(o.Endpoints, eps...)
+	}
+}
+
+// TTL sets how long responses are fresh
+func TTL(d time.Duration) Option {
+	return func(o *Options) {
+		o.TTL = d
+	}
+}
+
+// MaxEntries sets how many responses are kept
+func MaxEntries(n int) Option {
+	return func(o *Options) {
+		o.MaxEntries = n
+	}
+}
+
+// StaleIfError serves responses to failed calls for up to d after they expired
+func StaleIfError(d time.Duration) Option {
+	return func(o *Options) {
+		o.StaleIfError = d
+	}
+}
+
+// Vary sets the metadata keys responses differ by, calls with other values are
+// cached apart
+func Vary(keys ...string) Option {
+	return func(o *Options) {
+		o.Vary = append(o.Vary, keys...)
+	}
+}
+
+type bypassKey struct{}
+
+// Bypass skips the cache for the call, its response is cached still
+func Bypass() client.CallOption {
+	return func(o *client.CallOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, bypassKey{}, true)
+	}
+}
+
+// call is a call in flight other calls of the same key wait for
+type call struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+type cacheWrapper struct {
+	client.Client
+	opts      Options
+	endpoints map[string]bool
+	entries   *lru
+
+	sync.Mutex
+	calls map[string]*call
+}
+
+func marshal(v interface{}) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Marshal(m)
+	}
+	return json.Marshal(v)
+}
+
+func unmarshal(b []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(b, m)
+	}
+	return json.Unmarshal(b, v)
+}
+
+// key returns the key of the request, false if it can't be cached
+func (c *cacheWrapper) key(ctx context.Context, req client.Request) (string, bool) {
+	b, err := marshal(req.Body())
+	if err != nil {
+		return "", false
+	}
+
+	h := sha256.New()
+	h.Write([]byte(req.Service()))
+	h.Write([]byte{0})
+	h.Write([]byte(req.Endpoint()))
+	h.Write([]byte{0})
+	h.Write(b)
+
+	if len(c.opts.Vary) > 0 {
+		keys := append([]string(nil), c.opts.Vary...)
+		sort.Strings(keys)
+		for _, k := range keys {
+			v, _ := metadata.Get(ctx, k)
+			h.Write([]byte{0})
+			h.Write([]byte(k + "=" + v))
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// fetch calls the service, sharing the response with concurrent calls of the key.
+// The response is only returned to the calls which waited, rsp is set otherwise
+func (c *cacheWrapper) fetch(ctx context.Context, key string, req client.Request, rsp interface{}, opts []client.CallOption) ([]byte, error) {
+	c.Lock()
+	if cl, ok := c.calls[key]; ok {
+		c.Unlock()
+		select {
+		case <-cl.done:
+			if cl.err != nil {
+				return nil, cl.err
+			}
+			return cl.data, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	cl := &call{done: make(chan struct{})}
+	c.calls[key] = cl
+	c.Unlock()
+
+	defer func() {
+		c.Lock()
+		delete(c.calls, key)
+		c.Unlock()
+		close(cl.done)
+	}()
+
+	if cl.err = c.Client.Call(ctx, req, rsp, opts...); cl.err != nil {
+		return nil, cl.err
+	}
+	if cl.data, cl.err = marshal(rsp); cl.err != nil {
+		return nil, cl.err
+	}
+
+	now := time.Now()
+	c.entries.set(&entry{
+		key:     key,
+		data:    cl.data,
+		expires: now.Add(c.opts.TTL),
+		stale:   now.Add(c.opts.TTL + c.opts.StaleIfError),
+	})
+	return nil, nil
+}
+
+func (c *cacheWrapper) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	if !c.endpoints[req.Endpoint()] || req.Stream() {
+		return c.Client.Call(ctx, req, rsp, opts...)
+	}
+
+	key, ok := c.key(ctx, req)
+	if !ok {
+		return c.Client.Call(ctx, req, rsp, opts...)
+	}
+
+	var options client.CallOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	bypass := false
+	if options.Context != nil {
+		bypass, _ = options.Context.Value(bypassKey{}).(bool)
+	}
+
+	e, cached := c.entries.get(key)
+	if cached && !bypass && time.Now().Before(e.expires) {
+		return unmarshal(e.data, rsp)
+	}
+
+	data, err := c.fetch(ctx, key, req, rsp, opts)
+	if err != nil {
+		// serve the expired response while it's not stale
+		if cached {
+			return unmarshal(e.data, rsp)
+		}
+		return err
+	}
+	if data != nil {
+		return unmarshal(data, rsp)
+	}
+	return nil
+}
+
+// NewClientWrapper returns a client wrapper caching the responses of the endpoints
+// set with Endpoints for the TTL
+func NewClientWrapper(opts ...Option) client.Wrapper {
+	options := Options{
+		TTL:        DefaultTTL,
+		MaxEntries: DefaultMaxEntries,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	endpoints := make(map[string]bool, len(options.Endpoints))
+	for _, ep := range options.Endpoints {
+		endpoints[ep] = true
+	}
+
+	return func(c client.Client) client.Client {
+		return &cacheWrapper{
+			Client:    c,
+			opts:      options,
+			endpoints: endpoints,
+			entries:   newLRU(options.MaxEntries),
+			calls:     make(map[string]*call),
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/metadata"
+)
+
+type testRequest struct {
+	client.Request
+	endpoint string
+	body     interface{}
+}
+
+func (r *testRequest) Service() string {
+	return "go.micro.srv.foo"
+}
+
+func (r *testRequest) Endpoint() string {
+	return r.endpoint
+}
+
+func (r *testRequest) Body() interface{} {
+	return r.body
+}
+
+func (r *testRequest) Stream() bool {
+	return false
+}
+
+type testResponse struct {
+	Calls int64
+}
+
+// testClient counts the calls, replying the count
+type testClient struct {
+	client.Client
+	calls int64
+	err   error
+	// blocks the calls until closed
+	release chan bool
+}
+
+func (c *testClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	n := atomic.AddInt64(&c.calls, 1)
+	if c.release != nil {
+		<-c.release
+	}
+	if c.err != nil {
+		return c.err
+	}
+	rsp.(*testResponse).Calls = n
+	return nil
+}
+
+func get(t *testing.T, c client.Client, endpoint string, body interface{}, opts ...client.CallOption) int64 {
+	return getCtx(t, context.Background(), c, endpoint, body, opts...)
+}
+
+func getCtx(t *testing.T, ctx context.Context, c client.Client, endpoint string, body interface{}, opts ...client.CallOption) int64 {
+	rsp := new(testResponse)
+	if err := c.Call(ctx, &testRequest{endpoint: endpoint, body: body}, rsp, opts...); err != nil {
+		t.Fatal(err)
+	}
+	return rsp.Calls
+}
+
+func TestCache(t *testing.T) {
+	tc := &testClient{}
+	c := NewClientWrapper(Endpoints("Foo.Get"), TTL(50*time.Millisecond))(tc)
+
+	if n := get(t, c, "Foo.Get", map[string]string{"id": "1"}); n != 1 {
+		t.Fatalf("expected the first call got %d", n)
+	}
+	if n := get(t, c, "Foo.Get", map[string]string{"id": "1"}); n != 1 {
+		t.Fatalf("expected the cached response got %d", n)
+	}
+	// other requests and endpoints are called
+	if n := get(t, c, "Foo.Get", map[string]string{"id": "2"}); n != 2 {
+		t.Fatalf("expected another request to be called got %d", n)
+	}
+	if n := get(t, c, "Foo.Update", map[string]string{"id": "1"}); n != 3 {
+		t.Fatalf("expected other endpoints to be called got %d", n)
+	}
+	// bypassed calls are cached still
+	if n := get(t, c, "Foo.Get", map[string]string{"id": "1"}, Bypass()); n != 4 {
+		t.Fatalf("expected the cache to be bypassed got %d", n)
+	}
+	if n := get(t, c, "Foo.Get", map[string]string{"id": "1"}); n != 4 {
+		t.Fatalf("expected the response of the bypass got %d", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if n := get(t, c, "Foo.Get", map[string]string{"id": "1"}); n != 5 {
+		t.Fatalf("expected the response to expire got %d", n)
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	tc := &testClient{}
+	c := NewClientWrapper(Endpoints("Foo.Get"), Vary("Authorization"))(tc)
+
+	alice := metadata.Set(context.Background(), "Authorization", "alice")
+	bob := metadata.Set(context.Background(), "Authorization", "bob")
+
+	getCtx(t, alice, c, "Foo.Get", nil)
+	if n := getCtx(t, bob, c, "Foo.Get", nil); n != 2 {
+		t.Fatalf("expected other metadata to be cached apart got %d", n)
+	}
+	if n := getCtx(t, alice, c, "Foo.Get", nil); n != 1 {
+		t.Fatalf("expected the cached response got %d", n)
+	}
+}
+
+func TestCacheStaleIfError(t *testing.T) {
+	tc := &testClient{}
+	c := NewClientWrapper(Endpoints("Foo.Get"), TTL(10*time.Millisecond), StaleIfError(time.Minute))(tc)
+
+	get(t, c, "Foo.Get", nil)
+	time.Sleep(20 * time.Millisecond)
+
+	tc.err = errors.New("unavailable")
+	if n := get(t, c, "Foo.Get", nil); n != 1 {
+		t.Fatalf("expected the stale response got %d", n)
+	}
+
+	// without a response to serve the error is returned
+	if err := c.Call(context.Background(), &testRequest{endpoint: "Foo.Get", body: "other"}, new(testResponse)); err != tc.err {
+		t.Fatalf("expected %v got %v", tc.err, err)
+	}
+}
+
+func TestCacheMaxEntries(t *testing.T) {
+	tc := &testClient{}
+	c := NewClientWrapper(Endpoints("Foo.Get"), MaxEntries(2))(tc)
+
+	for _, id := range []string{"1", "2", "3"} {
+		get(t, c, "Foo.Get", id)
+	}
+	if l := c.(*cacheWrapper).entries.len(); l != 2 {
+		t.Fatalf("expected 2 entries got %d", l)
+	}
+	// the least recently used was evicted
+	if n := get(t, c, "Foo.Get", "1"); n != 4 {
+		t.Fatalf("expected the evicted response to be called got %d", n)
+	}
+}
+
+func TestCacheCoalesce(t *testing.T) {
+	tc := &testClient{release: make(chan bool)}
+	c := NewClientWrapper(Endpoints("Foo.Get"))(tc)
+
+	var wg sync.WaitGroup
+	results := make(chan int64, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rsp := new(testResponse)
+			if err := c.Call(context.Background(), &testRequest{endpoint: "Foo.Get"}, rsp); err == nil {
+				results <- rsp.Calls
+			}
+		}()
+	}
+
+	// let the calls pile up behind the first
+	time.Sleep(20 * time.Millisecond)
+	close(tc.release)
+	wg.Wait()
+	close(results)
+
+	if n := atomic.LoadInt64(&tc.calls); n != 1 {
+		t.Fatalf("expected a single call got %d", n)
+	}
+	for n := range results {
+		if n != 1 {
+			t.Fatalf("expected the shared response got %d", n)
+		}
+	}
+}
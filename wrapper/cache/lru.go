@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// entry is a cached response
+type entry struct {
+	key string
+	// encoded response
+	data []byte
+	// expires is when the entry is no longer fresh
+	expires time.Time
+	// stale is when the entry is no longer served on errors either
+	stale time.Time
+}
+
+// lru holds up to max entries, evicting the least recently used
+type lru struct {
+	sync.Mutex
+	max     int
+	ll      *list.List
+	entries map[string]*list.Element
+}
+
+func newLRU(max int) *lru {
+	return &lru{
+		max:     max,
+		ll:      list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (l *lru) get(key string) (*entry, bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	el, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if time.Now().After(e.stale) {
+		l.ll.Remove(el)
+		delete(l.entries, key)
+		return nil, false
+	}
+	l.ll.MoveToFront(el)
+	return e, true
+}
+
+func (l *lru) set(e *entry) {
+	l.Lock()
+	defer l.Unlock()
+
+	if el, ok := l.entries[e.key]; ok {
+		el.Value = e
+		l.ll.MoveToFront(el)
+		return
+	}
+
+	l.entries[e.key] = l.ll.PushFront(e)
+	for l.max > 0 && l.ll.Len() > l.max {
+		el := l.ll.Back()
+		l.ll.Remove(el)
+		delete(l.entries, el.Value.(*entry).key)
+	}
+}
+
+func (l *lru) len() int {
+	l.Lock()
+	defer l.Unlock()
+	return l.ll.Len()
+}
@@ -0,0 +1,349 @@
+// Package conformance provides a handler wrapper which checks requests and responses
+// against the endpoint schemas the service declares in the registry
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/errors"
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/server"
+)
+
+/*
+	The endpoint schemas are the registry values extracted from the handler types
+	on registration. Bodies are encoded to json and compared with them, fields the
+	schema doesn't declare and values of the wrong kind are mismatches. Missing fields
+	aren't, as zero values are omitted. Types the schema doesn't describe such as
+	maps, enums or well known types are skipped, so the check errs on the side of
+	false negatives. Encoding every body is expensive, the wrapper is meant for
+	development and staging.
+*/
+
+var (
+	// DefaultRefresh is how often the endpoints of a service are looked up again
+	DefaultRefresh = time.Minute
+)
+
+const (
+	// Request is the direction of mismatches in requests
+	Request = "request"
+	// Response is the direction of mismatches in responses
+	Response = "response"
+)
+
+// Mismatch describes a body which doesn't conform to the endpoint schema
+type Mismatch struct {
+	Service  string
+	Endpoint string
+	// Direction is either Request or Response
+	Direction string
+	// Path is the field of the body e.g greeting.name
+	Path string
+	// Reason describes the mismatch
+	Reason string
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s %s.%s: %s %s", m.Direction, m.Service, m.Endpoint, m.Path, m.Reason)
+}
+
+// MismatchFunc is called for every mismatch e.g to record metrics
+type MismatchFunc func(ctx context.Context, m Mismatch)
+
+type Options struct {
+	// Registry is where the endpoints are looked up
+	Registry registry.Registry
+	// Endpoints are declared endpoints used instead of the registry
+	Endpoints []*registry.Endpoint
+	// Strict fails requests and responses which don't conform
+	Strict bool
+	// OnMismatch is called for every mismatch
+	OnMismatch MismatchFunc
+}
+
+type Option func(*Options)
+
+// Registry sets the registry the endpoints are looked up in
+func Registry(r registry.Registry) Option {
+	return func(o *Options) {
+		o.Registry = r
+	}
+}
+
+// Endpoints declares the endpoint schemas instead of looking them up in the registry
+func Endpoints(eps ...*registry.Endpoint) Option {
+	return func(o *Options) {
+		o.Endpoints = append(o.Endpoints, eps...)
+	}
+}
+
+// Strict fails requests which don't conform with a 400 and responses with a 500 error
+func Strict() Option {
+	return func(o *Options) {
+		o.Strict = true
+	}
+}
+
+// OnMismatch sets a func called for every mismatch
+func OnMismatch(fn MismatchFunc) Option {
+	return func(o *Options) {
+		o.OnMismatch = fn
+	}
+}
+
+type endpoints struct {
+	eps     map[string]*registry.Endpoint
+	updated time.Time
+}
+
+// lookup is a lookup of the endpoints in progress, shared by concurrent callers
+type lookup struct {
+	done chan struct{}
+	e    *endpoints
+}
+
+type checker struct {
+	opts Options
+
+	sync.Mutex
+	services map[string]*endpoints
+	lookups  map[string]*lookup
+}
+
+// endpoint returns the declared endpoint, nil if unknown. Endpoints due a refresh
+// are served while they're looked up again in the background
+func (c *checker) endpoint(service, name string) *registry.Endpoint {
+	c.Lock()
+	e, ok := c.services[service]
+	_, inflight := c.lookups[service]
+	c.Unlock()
+
+	if ok {
+		if !inflight && time.Since(e.updated) >= DefaultRefresh {
+			go c.lookup(service)
+		}
+		return e.eps[name]
+	}
+
+	if e = c.lookup(service); e == nil {
+		return nil
+	}
+	return e.eps[name]
+}
+
+// lookup looks up the endpoints of the service without holding the lock, concurrent
+// lookups of the service share a single call. The endpoints looked up before are
+// returned if the lookup fails
+func (c *checker) lookup(service string) *endpoints {
+	c.Lock()
+	if l, ok := c.lookups[service]; ok {
+		c.Unlock()
+		<-l.done
+		return l.e
+	}
+	l := &lookup{done: make(chan struct{})}
+	c.lookups[service] = l
+	c.Unlock()
+
+	services, err := c.opts.Registry.GetService(service)
+
+	c.Lock()
+	delete(c.lookups, service)
+	if err != nil {
+		log.Debugf("[conformance] failed to look up %s: %v", service, err)
+		l.e = c.services[service]
+	} else {
+		e := &endpoints{
+			eps:     make(map[string]*registry.Endpoint),
+			updated: time.Now(),
+		}
+		for _, s := range services {
+			for _, ep := range s.Endpoints {
+				if _, ok := e.eps[ep.Name]; !ok {
+					e.eps[ep.Name] = ep
+				}
+			}
+		}
+		c.services[service] = e
+		l.e = e
+	}
+	c.Unlock()
+
+	close(l.done)
+	return l.e
+}
+
+// check compares the body with the schema and returns the mismatches
+func check(schema *registry.Value, body interface{}) ([]Mismatch, error) {
+	if schema == nil || body == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	var data interface{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+
+	var m []Mismatch
+	checkValue("", schema, data, &m)
+	return m, nil
+}
+
+func join(path, name string) string {
+	if len(path) == 0 {
+		return name
+	}
+	return path + "." + name
+}
+
+func checkValue(path string, v *registry.Value, data interface{}, m *[]Mismatch) {
+	if data == nil {
+		return
+	}
+
+	mismatch := func(format string, args ...interface{}) {
+		p := path
+		if len(p) == 0 {
+			p = "body"
+		}
+		*m = append(*m, Mismatch{Path: p, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case strings.HasPrefix(v.Type, "[]"):
+		// byte slices are encoded as base64
+		if v.Type == "[]uint8" || v.Type == "[]byte" {
+			if _, ok := data.(string); !ok {
+				mismatch("expected bytes, got %T", data)
+			}
+			return
+		}
+		items, ok := data.([]interface{})
+		if !ok {
+			mismatch("expected %s, got %T", v.Type, data)
+			return
+		}
+		if len(v.Values) == 0 {
+			return
+		}
+		elem := &registry.Value{Type: strings.TrimPrefix(v.Type, "[]"), Values: v.Values}
+		for i, item := range items {
+			checkValue(fmt.Sprintf("%s[%d]", path, i), elem, item, m)
+		}
+	case len(v.Values) > 0:
+		fields, ok := data.(map[string]interface{})
+		if !ok {
+			mismatch("expected %s, got %T", v.Type, data)
+			return
+		}
+		declared := make(map[string]*registry.Value, len(v.Values))
+		for _, f := range v.Values {
+			declared[f.Name] = f
+		}
+		for name, fv := range fields {
+			f, ok := declared[name]
+			if !ok {
+				*m = append(*m, Mismatch{Path: join(path, name), Reason: "is not declared"})
+				continue
+			}
+			checkValue(join(path, name), f, fv, m)
+		}
+	case v.Type == "string":
+		if _, ok := data.(string); !ok {
+			mismatch("expected string, got %T", data)
+		}
+	case v.Type == "bool":
+		if _, ok := data.(bool); !ok {
+			mismatch("expected bool, got %T", data)
+		}
+	case strings.HasPrefix(v.Type, "int"), strings.HasPrefix(v.Type, "uint"), strings.HasPrefix(v.Type, "float"):
+		if _, ok := data.(float64); !ok {
+			mismatch("expected %s, got %T", v.Type, data)
+		}
+	}
+}
+
+// NewHandlerWrapper returns a handler wrapper which checks requests and responses of
+// unary endpoints against the schemas declared in the registry. Mismatches are logged
+// and passed to OnMismatch, with Strict the request fails. Streaming requests and
+// endpoints without a declared schema aren't checked
+func NewHandlerWrapper(opts ...Option) server.HandlerWrapper {
+	options := Options{
+		Registry: registry.DefaultRegistry,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	c := &checker{
+		opts:     options,
+		services: make(map[string]*endpoints),
+		lookups:  make(map[string]*lookup),
+	}
+
+	declared := make(map[string]*registry.Endpoint, len(options.Endpoints))
+	for _, ep := range options.Endpoints {
+		declared[ep.Name] = ep
+	}
+
+	// report reports the mismatches and returns whether any were found
+	report := func(ctx context.Context, req server.Request, dir string, schema *registry.Value, body interface{}) bool {
+		m, err := check(schema, body)
+		if err != nil {
+			log.Debugf("[conformance] failed to check %s of %s.%s: %v", dir, req.Service(), req.Endpoint(), err)
+			return false
+		}
+		for _, mm := range m {
+			mm.Service = req.Service()
+			mm.Endpoint = req.Endpoint()
+			mm.Direction = dir
+			log.Warnf("[conformance] %s", mm)
+			if options.OnMismatch != nil {
+				options.OnMismatch(ctx, mm)
+			}
+		}
+		return len(m) > 0
+	}
+
+	return func(h server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, rsp interface{}) error {
+			if req.Stream() {
+				return h(ctx, req, rsp)
+			}
+
+			var ep *registry.Endpoint
+			if len(options.Endpoints) > 0 {
+				ep = declared[req.Endpoint()]
+			} else {
+				ep = c.endpoint(req.Service(), req.Endpoint())
+			}
+			if ep == nil {
+				return h(ctx, req, rsp)
+			}
+
+			if report(ctx, req, Request, ep.Request, req.Body()) && options.Strict {
+				return errors.BadRequest(req.Service(), "request does not conform to %s", req.Endpoint())
+			}
+
+			if err := h(ctx, req, rsp); err != nil {
+				return err
+			}
+
+			if report(ctx, req, Response, ep.Response, rsp) && options.Strict {
+				return errors.InternalServerError(req.Service(), "response does not conform to %s", req.Endpoint())
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package conformance
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/errors"
+	"github.com/micro/go-micro/v2/registry"
+	"github.com/micro/go-micro/v2/registry/memory"
+	"github.com/micro/go-micro/v2/server"
+)
+
+type testRequest struct {
+	server.Request
+	body interface{}
+}
+
+func (r *testRequest) Service() string {
+	return "greeter"
+}
+
+func (r *testRequest) Endpoint() string {
+	return "Greeter.Hello"
+}
+
+func (r *testRequest) Stream() bool {
+	return false
+}
+
+func (r *testRequest) Body() interface{} {
+	return r.body
+}
+
+type request struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+type driftedRequest struct {
+	Name  int    `json:"name"`
+	Extra string `json:"extra"`
+}
+
+type response struct {
+	Msg string `json:"msg"`
+}
+
+func TestHandlerWrapper(t *testing.T) {
+	r := memory.NewRegistry()
+	err := r.Register(&registry.Service{
+		Name:    "greeter",
+		Version: "latest",
+		Nodes:   []*registry.Node{{Id: "greeter-1", Address: "127.0.0.1:8080"}},
+		Endpoints: []*registry.Endpoint{{
+			Name: "Greeter.Hello",
+			Request: &registry.Value{Name: "Request", Type: "Request", Values: []*registry.Value{
+				{Name: "name", Type: "string"},
+				{Name: "tags", Type: "[]string"},
+			}},
+			Response: &registry.Value{Name: "Response", Type: "Response", Values: []*registry.Value{
+				{Name: "msg", Type: "string"},
+			}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mismatches []Mismatch
+
+	fn := func(ctx context.Context, req server.Request, rsp interface{}) error {
+		rsp.(*response).Msg = "hello"
+		return nil
+	}
+
+	h := NewHandlerWrapper(
+		Registry(r),
+		Strict(),
+		OnMismatch(func(ctx context.Context, m Mismatch) {
+			mismatches = append(mismatches, m)
+		}),
+	)(fn)
+
+	req := &testRequest{body: &request{Name: "john", Tags: []string{"a"}}}
+	if err := h(context.Background(), req, &response{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 0 {
+		t.Fatalf("expected no mismatches, got %v", mismatches)
+	}
+
+	req = &testRequest{body: &driftedRequest{Name: 1, Extra: "x"}}
+	err = h(context.Background(), req, &response{})
+	if merr := errors.Parse(err.Error()); merr.Code != 400 {
+		t.Fatalf("expected 400 error, got %v", err)
+	}
+	if len(mismatches) != 2 {
+		t.Fatalf("expected 2 mismatches, got %v", mismatches)
+	}
+	for _, m := range mismatches {
+		if m.Direction != Request || (m.Path != "name" && m.Path != "extra") {
+			t.Fatalf("unexpected mismatch %v", m)
+		}
+	}
+}
+
+type blockingRegistry struct {
+	registry.Registry
+	mtx     sync.Mutex
+	lookups map[string]int
+	release chan bool
+}
+
+func (r *blockingRegistry) GetService(name string, opts ...registry.GetOption) ([]*registry.Service, error) {
+	r.mtx.Lock()
+	r.lookups[name]++
+	r.mtx.Unlock()
+	if name == "slow" {
+		<-r.release
+	}
+	return []*registry.Service{{Name: name, Endpoints: []*registry.Endpoint{{Name: "Foo.Bar"}}}}, nil
+}
+
+func TestEndpointLookup(t *testing.T) {
+	r := &blockingRegistry{lookups: make(map[string]int), release: make(chan bool)}
+	c := &checker{
+		opts:     Options{Registry: r},
+		services: make(map[string]*endpoints),
+		lookups:  make(map[string]*lookup),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if c.endpoint("slow", "Foo.Bar") == nil {
+				t.Error("expected the endpoint of slow")
+			}
+		}()
+	}
+
+	// a slow lookup doesn't hold up the lookups of other services
+	done := make(chan bool)
+	go func() {
+		c.endpoint("fast", "Foo.Bar")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected fast to be looked up while slow is")
+	}
+
+	close(r.release)
+	wg.Wait()
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if n := r.lookups["slow"]; n != 1 {
+		t.Fatalf("expected concurrent lookups to share a call, got %d", n)
+	}
+}
@@ -0,0 +1,104 @@
+// Package deadline provides a handler wrapper which enforces the timeout sent by the client
+package deadline
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/micro/go-micro/v2/errors"
+	"github.com/micro/go-micro/v2/metadata"
+	"github.com/micro/go-micro/v2/server"
+)
+
+/*
+	Clients send their request timeout in nanoseconds with the Timeout metadata,
+	the deadline of the request is set from it unless the context has an earlier
+	one already, like the deadline of a grpc request. Go can't stop a handler, so
+	once the deadline passed the error is returned while the handler goes on in the
+	background with a cancelled context, its response is dropped. Streams only get
+	the deadline, they end when the handler returns.
+*/
+
+var (
+	// TimeoutKey is the metadata holding the timeout of the client in nanoseconds
+	TimeoutKey = "Timeout"
+
+	// ErrDeadlineExceeded is returned for requests whose deadline passed before the handler returned
+	ErrDeadlineExceeded = errors.New("go.micro.server", "deadline exceeded", 408)
+)
+
+type Options struct {
+	// Default is the timeout of requests without one, 0 is none
+	Default time.Duration
+	// Max caps the timeout sent by clients, 0 is no cap
+	Max time.Duration
+}
+
+type Option func(*Options)
+
+// Default sets the timeout of requests sent without one
+func Default(d time.Duration) Option {
+	return func(o *Options) {
+		o.Default = d
+	}
+}
+
+// Max caps the timeout sent by clients
+func Max(d time.Duration) Option {
+	return func(o *Options) {
+		o.Max = d
+	}
+}
+
+// timeout returns the timeout of the request, 0 if it has none
+func timeout(ctx context.Context, opts Options) time.Duration {
+	d := opts.Default
+	if v, ok := metadata.Get(ctx, TimeoutKey); ok {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			d = time.Duration(n)
+		}
+	}
+	if opts.Max > 0 && (d <= 0 || d > opts.Max) {
+		d = opts.Max
+	}
+	return d
+}
+
+// NewHandlerWrapper returns a handler wrapper which sets the deadline of requests
+// from the timeout of the client and returns ErrDeadlineExceeded once it passed
+func NewHandlerWrapper(opts ...Option) server.HandlerWrapper {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return func(fn server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, rsp interface{}) error {
+			if d := timeout(ctx, options); d > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, d)
+				defer cancel()
+			}
+
+			if _, ok := ctx.Deadline(); !ok || req.Stream() {
+				return fn(ctx, req, rsp)
+			}
+
+			done := make(chan error, 1)
+			go func() {
+				done <- fn(ctx, req, rsp)
+			}()
+
+			select {
+			case err := <-done:
+				return err
+			case <-ctx.Done():
+				if ctx.Err() == context.DeadlineExceeded {
+					return ErrDeadlineExceeded
+				}
+				return errors.New("go.micro.server", ctx.Err().Error(), 408)
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package deadline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/metadata"
+	"github.com/micro/go-micro/v2/server"
+)
+
+type testRequest struct {
+	server.Request
+	stream bool
+}
+
+func (r *testRequest) Stream() bool {
+	return r.stream
+}
+
+func TestTimeout(t *testing.T) {
+	testData := []struct {
+		md   string
+		opts Options
+		want time.Duration
+	}{
+		{"", Options{}, 0},
+		{"1000", Options{}, time.Microsecond},
+		{"", Options{Default: time.Second}, time.Second},
+		{"invalid", Options{Default: time.Second}, time.Second},
+		{"5000000000", Options{Max: time.Second}, time.Second},
+		{"", Options{Max: time.Second}, time.Second},
+		{"1000", Options{Max: time.Second}, time.Microsecond},
+	}
+
+	for _, d := range testData {
+		ctx := context.Background()
+		if len(d.md) > 0 {
+			ctx = metadata.NewContext(ctx, metadata.Metadata{TimeoutKey: d.md})
+		}
+		if got := timeout(ctx, d.opts); got != d.want {
+			t.Fatalf("expected %v for %q with %+v got %v", d.want, d.md, d.opts, got)
+		}
+	}
+}
+
+func TestDeadlineExceeded(t *testing.T) {
+	release := make(chan bool)
+	defer close(release)
+
+	fn := func(ctx context.Context, req server.Request, rsp interface{}) error {
+		<-release
+		return nil
+	}
+
+	ctx := metadata.NewContext(context.Background(), metadata.Metadata{
+		TimeoutKey: "10000000",
+	})
+
+	start := time.Now()
+	err := NewHandlerWrapper()(fn)(ctx, &testRequest{}, nil)
+	if err != ErrDeadlineExceeded {
+		t.Fatalf("expected %v got %v", ErrDeadlineExceeded, err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("expected the handler to be aborted at the deadline")
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	fn := func(ctx context.Context, req server.Request, rsp interface{}) error {
+		d, ok := ctx.Deadline()
+		if !ok || time.Until(d) > time.Second {
+			t.Fatalf("expected the deadline of the client got %v %v", d, ok)
+		}
+		return nil
+	}
+
+	ctx := metadata.NewContext(context.Background(), metadata.Metadata{
+		TimeoutKey: "1000000000",
+	})
+
+	for _, stream := range []bool{false, true} {
+		if err := NewHandlerWrapper()(fn)(ctx, &testRequest{stream: stream}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Package delay provides a broker wrapper delivering messages after a delay on any broker
+package delay
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+	log "github.com/micro/go-micro/v2/logger"
+)
+
+/*
+	Brokers supporting delays natively are passed the delay through their own
+	option. Elsewhere delayed messages are parked on a topic with the time they are
+	due and their topic in the header. The relay subscribes to the parked messages
+	in a queue shared by all its instances, holds each message without acking it
+	until it's due and publishes it to its topic before acking, so a relay failing
+	in between leaves the message to be redelivered by the broker. Messages due
+	after MaxHold are parked again instead of being held past the ack deadline.
+*/
+
+var (
+	// DueKey is the header holding the time a parked message is due
+	DueKey = "Micro-Deliver-At"
+	// TopicKey is the header holding the topic of a parked message
+	TopicKey = "Micro-Deliver-Topic"
+)
+
+type delayBroker struct {
+	broker.Broker
+	opts Options
+
+	sync.Mutex
+	relay broker.Subscriber
+	exit  chan bool
+}
+
+func (d *delayBroker) Connect() error {
+	if err := d.Broker.Connect(); err != nil {
+		return err
+	}
+	if d.opts.NoRelay {
+		return nil
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	if d.relay != nil {
+		return nil
+	}
+
+	exit := make(chan bool)
+	sub, err := d.Broker.Subscribe(d.opts.Topic, func(e broker.Event) error {
+		return d.hold(e, exit)
+	}, broker.Queue(d.opts.Topic), broker.DisableAutoAck())
+	if err != nil {
+		return err
+	}
+	d.relay = sub
+	d.exit = exit
+	return nil
+}
+
+func (d *delayBroker) Disconnect() error {
+	d.Lock()
+	if d.relay != nil {
+		d.relay.Unsubscribe()
+		// held messages aren't acked, the broker redelivers them
+		close(d.exit)
+		d.relay = nil
+	}
+	d.Unlock()
+
+	return d.Broker.Disconnect()
+}
+
+func (d *delayBroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	options := broker.PublishOptions{
+		Context: context.Background(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	due, ok := options.Context.Value(deliverAtKey{}).(time.Time)
+	if !ok {
+		return d.Broker.Publish(topic, msg, opts...)
+	}
+
+	wait := time.Until(due)
+	if wait <= 0 {
+		return d.Broker.Publish(topic, msg, opts...)
+	}
+	if d.opts.Native != nil && (d.opts.MaxNative == 0 || wait <= d.opts.MaxNative) {
+		return d.Broker.Publish(topic, msg, append(opts, d.opts.Native(wait))...)
+	}
+
+	header := make(map[string]string, len(msg.Header)+2)
+	for k, v := range msg.Header {
+		header[k] = v
+	}
+	header[DueKey] = due.UTC().Format(time.RFC3339Nano)
+	header[TopicKey] = topic
+
+	return d.Broker.Publish(d.opts.Topic, &broker.Message{Header: header, Body: msg.Body}, opts...)
+}
+
+// hold delivers the parked message once due, the message is acked once published
+func (d *delayBroker) hold(e broker.Event, exit chan bool) error {
+	msg := e.Message()
+
+	topic := msg.Header[TopicKey]
+	due, err := time.Parse(time.RFC3339Nano, msg.Header[DueKey])
+	if err != nil || len(topic) == 0 {
+		log.Errorf("[delay] dropping parked message with invalid headers %v", msg.Header)
+		return e.Ack()
+	}
+
+	wait := time.Until(due)
+	park := wait > d.opts.MaxHold
+	if park {
+		wait = d.opts.MaxHold
+	}
+
+	go func() {
+		select {
+		case <-exit:
+			return
+		case <-time.After(wait):
+		}
+
+		var err error
+		if park {
+			err = d.Broker.Publish(d.opts.Topic, msg)
+		} else {
+			header := make(map[string]string, len(msg.Header))
+			for k, v := range msg.Header {
+				if k == DueKey || k == TopicKey {
+					continue
+				}
+				header[k] = v
+			}
+			err = d.Broker.Publish(topic, &broker.Message{Header: header, Body: msg.Body})
+		}
+		if err != nil {
+			log.Errorf("[delay] failed to relay message to %s: %v", topic, err)
+			return
+		}
+		if err := e.Ack(); err != nil {
+			log.Errorf("[delay] failed to ack parked message: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+func (d *delayBroker) String() string {
+	return d.Broker.String()
+}
+
+// NewBroker returns a broker delaying messages published with DeliverAfter or
+// DeliverAt, natively when the broker supports it and through a topic of parked
+// messages otherwise
+func NewBroker(b broker.Broker, opts ...Option) broker.Broker {
+	options := Options{
+		Topic:   DefaultTopic,
+		MaxHold: DefaultMaxHold,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return &delayBroker{
+		Broker: b,
+		opts:   options,
+	}
+}
@@ -0,0 +1,88 @@
+package delay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+	"github.com/micro/go-micro/v2/broker/memory"
+)
+
+func TestDeliverAfter(t *testing.T) {
+	b := NewBroker(memory.NewBroker(), MaxHold(20*time.Millisecond))
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Disconnect()
+
+	got := make(chan *broker.Message, 2)
+	if _, err := b.Subscribe("test", func(e broker.Event) error {
+		got <- e.Message()
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	msg := &broker.Message{Header: map[string]string{"Foo": "Bar"}, Body: []byte("hello")}
+	// parked again once as the delay exceeds MaxHold
+	if err := b.Publish("test", msg, DeliverAfter(50*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Publish("test", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if m := <-got; len(m.Header[DueKey]) > 0 {
+		t.Fatal("expected the undelayed message first")
+	}
+
+	select {
+	case m := <-got:
+		if time.Since(start) < 50*time.Millisecond {
+			t.Fatal("expected the message to be delayed")
+		}
+		if string(m.Body) != "hello" || m.Header["Foo"] != "Bar" || len(m.Header[DueKey]) > 0 || len(m.Header[TopicKey]) > 0 {
+			t.Fatalf("unexpected message %v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the delayed message to be delivered")
+	}
+}
+
+func TestNative(t *testing.T) {
+	var delays []time.Duration
+	native := func(d time.Duration) broker.PublishOption {
+		delays = append(delays, d)
+		return func(*broker.PublishOptions) {}
+	}
+
+	m := memory.NewBroker()
+	b := NewBroker(m, Native(native, time.Minute), NoRelay())
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	var parked int
+	if _, err := m.Subscribe(DefaultTopic, func(e broker.Event) error {
+		parked++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &broker.Message{Body: []byte("hello")}
+	if err := b.Publish("test", msg, DeliverAfter(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Publish("test", msg, DeliverAfter(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(delays) != 1 || delays[0] > time.Second || delays[0] < 900*time.Millisecond {
+		t.Fatalf("expected a native delay of a second, got %v", delays)
+	}
+	if parked != 1 {
+		t.Fatalf("expected the delay beyond the native maximum to be parked, got %d", parked)
+	}
+}
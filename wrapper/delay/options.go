@@ -0,0 +1,78 @@
+package delay
+
+import (
+	"context"
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+)
+
+var (
+	// DefaultTopic is the topic delayed messages are parked on
+	DefaultTopic = "micro.delay"
+	// DefaultMaxHold is how long the relay holds a message before parking it again
+	DefaultMaxHold = 30 * time.Second
+)
+
+type deliverAtKey struct{}
+
+type Options struct {
+	// Native returns the option delaying a message natively, nil if the broker doesn't support it
+	Native func(d time.Duration) broker.PublishOption
+	// MaxNative is the longest delay supported natively, 0 is unbounded
+	MaxNative time.Duration
+	// Topic is the topic delayed messages are parked on
+	Topic string
+	// MaxHold is how long the relay holds a message before parking it again
+	MaxHold time.Duration
+	// NoRelay disables the relay, another service relays the parked messages
+	NoRelay bool
+}
+
+type Option func(*Options)
+
+// Native delays messages with the option of the broker e.g rabbitmq.Delay, delays
+// longer than max are emulated. A max of 0 is unbounded
+func Native(fn func(d time.Duration) broker.PublishOption, max time.Duration) Option {
+	return func(o *Options) {
+		o.Native = fn
+		o.MaxNative = max
+	}
+}
+
+// Topic sets the topic delayed messages are parked on
+func Topic(t string) Option {
+	return func(o *Options) {
+		o.Topic = t
+	}
+}
+
+// MaxHold sets how long the relay holds a message before parking it again, it must
+// be shorter than the time the broker waits for an ack before redelivering
+func MaxHold(d time.Duration) Option {
+	return func(o *Options) {
+		o.MaxHold = d
+	}
+}
+
+// NoRelay disables the relay, parked messages are relayed by another service
+func NoRelay() Option {
+	return func(o *Options) {
+		o.NoRelay = true
+	}
+}
+
+// DeliverAfter delays the delivery of the message by the given duration
+func DeliverAfter(d time.Duration) broker.PublishOption {
+	return DeliverAt(time.Now().Add(d))
+}
+
+// DeliverAt delays the delivery of the message until the given time
+func DeliverAt(t time.Time) broker.PublishOption {
+	return func(o *broker.PublishOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, deliverAtKey{}, t)
+	}
+}
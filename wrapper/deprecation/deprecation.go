@@ -0,0 +1,197 @@
+// Package deprecation provides a handler wrapper which signals the deprecation of endpoints
+package deprecation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/errors"
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/metadata"
+	"github.com/micro/go-micro/v2/server"
+	"google.golang.org/grpc"
+	gmetadata "google.golang.org/grpc/metadata"
+)
+
+var (
+	// DeprecationKey is the metadata key marking a request to a deprecated endpoint
+	DeprecationKey = "Deprecation"
+	// SunsetKey is the metadata key holding the sunset date of a deprecated endpoint
+	SunsetKey = "Sunset"
+	// FromServiceKey is the metadata key identifying the calling service
+	FromServiceKey = "Micro-From-Service"
+)
+
+// Deprecation describes a deprecated endpoint
+type Deprecation struct {
+	// Endpoint is the deprecated endpoint e.g Greeter.Hello
+	Endpoint string
+	// Sunset is when the endpoint is removed, the zero time if unknown
+	Sunset time.Time
+	// Message is an optional hint for callers e.g the replacing endpoint
+	Message string
+}
+
+// Call describes a request to a deprecated endpoint
+type Call struct {
+	Deprecation
+	// Service is the service receiving the call
+	Service string
+	// Caller is the calling service, empty if unknown
+	Caller string
+	// Rejected is true when the call was rejected after the sunset
+	Rejected bool
+}
+
+// CallFunc is called for every request to a deprecated endpoint e.g to record metrics
+type CallFunc func(ctx context.Context, c Call)
+
+type Options struct {
+	// Endpoints maps endpoints to their deprecation
+	Endpoints map[string]Deprecation
+	// Reject fails requests to endpoints past their sunset
+	Reject bool
+	// OnCall is called for every request to a deprecated endpoint
+	OnCall CallFunc
+}
+
+type Option func(*Options)
+
+// Deprecate marks the endpoint as deprecated, use the zero time if there's no sunset date
+func Deprecate(endpoint string, sunset time.Time, msg string) Option {
+	return func(o *Options) {
+		if o.Endpoints == nil {
+			o.Endpoints = make(map[string]Deprecation)
+		}
+		o.Endpoints[endpoint] = Deprecation{
+			Endpoint: endpoint,
+			Sunset:   sunset,
+			Message:  msg,
+		}
+	}
+}
+
+// Reject fails requests to deprecated endpoints past their sunset with a 410 Gone error
+func Reject() Option {
+	return func(o *Options) {
+		o.Reject = true
+	}
+}
+
+// OnCall sets a func called for every request to a deprecated endpoint
+func OnCall(fn CallFunc) Option {
+	return func(o *Options) {
+		o.OnCall = fn
+	}
+}
+
+// deprecations signals the deprecation of the endpoints of the options
+type deprecations struct {
+	opts Options
+	// callers which were already logged, keyed by endpoint and caller
+	seen sync.Map
+}
+
+func newDeprecations(opts ...Option) *deprecations {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+	return &deprecations{opts: options}
+}
+
+// call records a call of the endpoint, returning its deprecation and the error of
+// calls past the sunset when they're rejected
+func (d *deprecations) call(ctx context.Context, service, endpoint, caller string) (Deprecation, bool, error) {
+	dep, ok := d.opts.Endpoints[endpoint]
+	if !ok {
+		return dep, false, nil
+	}
+
+	sunset := !dep.Sunset.IsZero() && time.Now().After(dep.Sunset)
+	c := Call{
+		Deprecation: dep,
+		Service:     service,
+		Caller:      caller,
+		Rejected:    sunset && d.opts.Reject,
+	}
+	if d.opts.OnCall != nil {
+		d.opts.OnCall(ctx, c)
+	}
+
+	if _, ok := d.seen.LoadOrStore(dep.Endpoint+"/"+caller, true); !ok {
+		if len(caller) == 0 {
+			caller = "unknown caller"
+		}
+		log.Warnf("[deprecation] %s called deprecated endpoint %s.%s", caller, service, dep.Endpoint)
+	}
+
+	if c.Rejected {
+		msg := fmt.Sprintf("%s was removed on %s", dep.Endpoint, dep.Sunset.Format(time.RFC3339))
+		if len(dep.Message) > 0 {
+			msg += ": " + dep.Message
+		}
+		return dep, true, errors.New(service, msg, http.StatusGone)
+	}
+	return dep, true, nil
+}
+
+// headers returns the response headers signalling the deprecation
+func headers(d Deprecation) map[string]string {
+	h := map[string]string{
+		DeprecationKey: "true",
+	}
+	if !d.Sunset.IsZero() {
+		h[SunsetKey] = d.Sunset.UTC().Format(http.TimeFormat)
+	}
+	return h
+}
+
+// NewHandlerWrapper returns a handler wrapper which signals the deprecation of endpoints.
+// The Deprecation and Sunset keys are sent to the caller in the response headers of the
+// grpc server, the first call from every caller is logged and requests past the sunset
+// are rejected when Reject is set. RPC responses of other servers carry no metadata
+func NewHandlerWrapper(opts ...Option) server.HandlerWrapper {
+	d := newDeprecations(opts...)
+
+	return func(h server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, rsp interface{}) error {
+			caller, _ := metadata.Get(ctx, FromServiceKey)
+			dep, ok, err := d.call(ctx, req.Service(), req.Endpoint(), caller)
+			if err != nil {
+				return err
+			}
+			if ok {
+				// sent with the response, outside a grpc server there's no stream to set them on
+				grpc.SetHeader(ctx, gmetadata.New(headers(dep)))
+			}
+			return h(ctx, req, rsp)
+		}
+	}
+}
+
+// NewHTTPWrapper returns an http middleware which signals the deprecation of endpoints,
+// the paths of the requests, with the Deprecation and Sunset response headers e.g for
+// the http server. Requests past the sunset are rejected with 410 Gone when Reject is set
+func NewHTTPWrapper(opts ...Option) func(http.Handler) http.Handler {
+	d := newDeprecations(opts...)
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			dep, ok, err := d.call(r.Context(), r.Host, r.URL.Path, r.Header.Get(FromServiceKey))
+			if err != nil {
+				http.Error(w, err.(*errors.Error).Detail, http.StatusGone)
+				return
+			}
+			if ok {
+				for k, v := range headers(dep) {
+					w.Header().Set(k, v)
+				}
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
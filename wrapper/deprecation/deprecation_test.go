@@ -0,0 +1,186 @@
+package deprecation
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/errors"
+	"github.com/micro/go-micro/v2/metadata"
+	"github.com/micro/go-micro/v2/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	gmetadata "google.golang.org/grpc/metadata"
+)
+
+// rawCodec passes the bytes of requests and responses through
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *(v.(*[]byte)), nil
+}
+
+func (rawCodec) Unmarshal(b []byte, v interface{}) error {
+	*(v.(*[]byte)) = b
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "raw"
+}
+
+func init() {
+	encoding.RegisterCodec(rawCodec{})
+}
+
+type testRequest struct {
+	server.Request
+	endpoint string
+}
+
+func (r *testRequest) Service() string {
+	return "greeter"
+}
+
+func (r *testRequest) Endpoint() string {
+	return r.endpoint
+}
+
+func TestHandlerWrapper(t *testing.T) {
+	var calls []Call
+
+	fn := func(ctx context.Context, req server.Request, rsp interface{}) error {
+		return nil
+	}
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	h := NewHandlerWrapper(
+		Deprecate("Greeter.Old", past, "use Greeter.Hello"),
+		Deprecate("Greeter.Legacy", future, ""),
+		Reject(),
+		OnCall(func(ctx context.Context, c Call) {
+			calls = append(calls, c)
+		}),
+	)(fn)
+
+	ctx := metadata.Set(context.Background(), FromServiceKey, "caller")
+
+	if err := h(ctx, &testRequest{endpoint: "Greeter.Hello"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 0 {
+		t.Fatalf("expected no deprecated calls, got %d", len(calls))
+	}
+
+	if err := h(ctx, &testRequest{endpoint: "Greeter.Legacy"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	err := h(ctx, &testRequest{endpoint: "Greeter.Old"}, nil)
+	if merr := errors.Parse(err.Error()); merr.Code != 410 {
+		t.Fatalf("expected 410 error, got %v", err)
+	}
+
+	if len(calls) != 2 || calls[0].Caller != "caller" || calls[0].Rejected || !calls[1].Rejected {
+		t.Fatalf("unexpected calls %+v", calls)
+	}
+}
+
+func TestHandlerWrapperHeaders(t *testing.T) {
+	sunset := time.Now().Add(time.Hour)
+
+	h := NewHandlerWrapper(
+		Deprecate("Greeter.Legacy", sunset, ""),
+	)(func(ctx context.Context, req server.Request, rsp interface{}) error {
+		return nil
+	})
+
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		var req []byte
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		method, _ := grpc.MethodFromServerStream(stream)
+		endpoint := "Greeter.Hello"
+		if method == "/greeter.Greeter/Legacy" {
+			endpoint = "Greeter.Legacy"
+		}
+		if err := h(stream.Context(), &testRequest{endpoint: endpoint}, nil); err != nil {
+			return err
+		}
+		return stream.SendMsg(&req)
+	}))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	defer srv.Stop()
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	call := func(method string) gmetadata.MD {
+		var md gmetadata.MD
+		req, rsp := []byte("hello"), []byte{}
+		if err := conn.Invoke(context.Background(), method, &req, &rsp, grpc.CallContentSubtype("raw"), grpc.Header(&md)); err != nil {
+			t.Fatal(err)
+		}
+		return md
+	}
+
+	if md := call("/greeter.Greeter/Hello"); len(md.Get(DeprecationKey)) > 0 {
+		t.Fatalf("unexpected deprecation header %v", md)
+	}
+
+	md := call("/greeter.Greeter/Legacy")
+	if v := md.Get(DeprecationKey); len(v) != 1 || v[0] != "true" {
+		t.Fatalf("expected deprecation header, got %v", md)
+	}
+	if v := md.Get(SunsetKey); len(v) != 1 || v[0] != sunset.UTC().Format(http.TimeFormat) {
+		t.Fatalf("expected sunset header, got %v", md)
+	}
+}
+
+func TestHTTPWrapper(t *testing.T) {
+	sunset := time.Now().Add(time.Hour)
+
+	h := NewHTTPWrapper(
+		Deprecate("/greeter/legacy", sunset, ""),
+		Deprecate("/greeter/old", time.Now().Add(-time.Hour), ""),
+		Reject(),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL + "/greeter/legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK || rsp.Header.Get(DeprecationKey) != "true" {
+		t.Fatalf("expected deprecation header, got %d %v", rsp.StatusCode, rsp.Header)
+	}
+	if v := rsp.Header.Get(SunsetKey); v != sunset.UTC().Format(http.TimeFormat) {
+		t.Fatalf("expected sunset header, got %q", v)
+	}
+
+	rsp, err = http.Get(srv.URL + "/greeter/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusGone {
+		t.Fatalf("expected 410, got %d", rsp.StatusCode)
+	}
+}
@@ -0,0 +1,206 @@
+// Package encrypt provides a broker wrapper which encrypts message bodies end to end
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/micro/go-micro/v2/broker"
+)
+
+/*
+	Bodies are sealed with AES-GCM before they reach the broker so they are only
+	readable by services holding the key, whatever the transport or the cluster.
+	The sealed body is the random nonce followed by the ciphertext, the key id is
+	carried in a header and authenticated as additional data so rotating keys only
+	requires subscribers to hold the retired keys until messages in flight drained.
+	The topic is authenticated too, a body replayed to another topic fails to open.
+	Headers are left in the clear, brokers and other wrappers route on them.
+*/
+
+var (
+	// KeyIdKey is the header holding the id of the key the body is encrypted with
+	KeyIdKey = "Micro-Encryption-Key-Id"
+	// AlgorithmKey is the header holding the algorithm the body is encrypted with
+	AlgorithmKey = "Micro-Encryption"
+	// Algorithm is the value of the algorithm header
+	Algorithm = "aes-gcm"
+	// DefaultEnvPrefix is the prefix of the environment keyring used without a keyring
+	DefaultEnvPrefix = "MICRO_ENCRYPTION_KEY"
+
+	// ErrPlaintext is returned to the broker for messages which aren't encrypted
+	ErrPlaintext = errors.New("message is not encrypted")
+)
+
+type Options struct {
+	// Keyring holds the keys messages are encrypted with
+	Keyring Keyring
+	// AllowPlaintext delivers messages which aren't encrypted as is
+	AllowPlaintext bool
+}
+
+type Option func(*Options)
+
+// WithKeyring sets the keyring holding the keys
+func WithKeyring(k Keyring) Option {
+	return func(o *Options) {
+		o.Keyring = k
+	}
+}
+
+// AllowPlaintext delivers messages which aren't encrypted as is, useful while
+// publishers are migrated. By default they are rejected with ErrPlaintext
+func AllowPlaintext() Option {
+	return func(o *Options) {
+		o.AllowPlaintext = true
+	}
+}
+
+type encryptBroker struct {
+	broker.Broker
+	opts Options
+	// err is why there is no keyring
+	err error
+}
+
+type event struct {
+	broker.Event
+	msg *broker.Message
+}
+
+func (e *event) Message() *broker.Message {
+	return e.msg
+}
+
+// additionalData returns the data authenticated along with the body, the key id
+// and the topic separated by a byte neither contains
+func additionalData(id, topic string) []byte {
+	return []byte(id + "\x00" + topic)
+}
+
+func seal(key []byte, id, topic string, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData(id, topic)), nil
+}
+
+func open(key []byte, id, topic string, sealed []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted body too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData(id, topic))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (e *encryptBroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	if e.err != nil {
+		return e.err
+	}
+
+	id, key, err := e.opts.Keyring.Current()
+	if err != nil {
+		return fmt.Errorf("failed to get the current encryption key: %v", err)
+	}
+
+	body, err := seal(key, id, topic, msg.Body)
+	if err != nil {
+		return err
+	}
+
+	header := make(map[string]string, len(msg.Header)+2)
+	for k, v := range msg.Header {
+		header[k] = v
+	}
+	header[KeyIdKey] = id
+	header[AlgorithmKey] = Algorithm
+
+	return e.Broker.Publish(topic, &broker.Message{Header: header, Body: body}, opts...)
+}
+
+func (e *encryptBroker) Subscribe(topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	return e.Broker.Subscribe(topic, func(ev broker.Event) error {
+		msg := ev.Message()
+
+		if _, ok := msg.Header[AlgorithmKey]; !ok {
+			if e.opts.AllowPlaintext {
+				return h(ev)
+			}
+			return ErrPlaintext
+		}
+		if alg := msg.Header[AlgorithmKey]; alg != Algorithm {
+			return fmt.Errorf("unsupported encryption %s", alg)
+		}
+
+		if e.err != nil {
+			return e.err
+		}
+
+		id := msg.Header[KeyIdKey]
+		key, err := e.opts.Keyring.Key(id)
+		if err != nil {
+			return fmt.Errorf("failed to get encryption key %s: %v", id, err)
+		}
+
+		body, err := open(key, id, ev.Topic(), msg.Body)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt message: %v", err)
+		}
+
+		header := make(map[string]string, len(msg.Header))
+		for k, v := range msg.Header {
+			if k == KeyIdKey || k == AlgorithmKey {
+				continue
+			}
+			header[k] = v
+		}
+
+		return h(&event{Event: ev, msg: &broker.Message{Header: header, Body: body}})
+	}, opts...)
+}
+
+func (e *encryptBroker) String() string {
+	return e.Broker.String()
+}
+
+// NewBroker returns a broker encrypting the bodies of published messages and
+// decrypting them for subscribers with the keys of the keyring. Without a keyring
+// the keys are read from the environment with DefaultEnvPrefix
+func NewBroker(b broker.Broker, opts ...Option) broker.Broker {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+
+	e := &encryptBroker{
+		Broker: b,
+		opts:   options,
+	}
+	if e.opts.Keyring == nil {
+		if e.opts.Keyring, e.err = EnvKeys(DefaultEnvPrefix); e.err != nil {
+			e.err = fmt.Errorf("no encryption keyring: %v", e.err)
+		}
+	}
+	return e
+}
@@ -0,0 +1,168 @@
+package encrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+	"github.com/micro/go-micro/v2/broker/memory"
+)
+
+func TestEncrypt(t *testing.T) {
+	v1 := bytes.Repeat([]byte{1}, 32)
+	v2 := bytes.Repeat([]byte{2}, 32)
+
+	m := memory.NewBroker()
+	pub := NewBroker(m, WithKeyring(StaticKeys("v1", map[string][]byte{"v1": v1})))
+	sub := NewBroker(m, WithKeyring(StaticKeys("v2", map[string][]byte{"v1": v1, "v2": v2})))
+
+	if err := m.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	var raw, got []*broker.Message
+	if _, err := m.Subscribe("test", func(e broker.Event) error {
+		raw = append(raw, e.Message())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sub.Subscribe("test", func(e broker.Event) error {
+		got = append(got, e.Message())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// published with the retired key, decrypted after rotation
+	msg := &broker.Message{Header: map[string]string{"Content-Type": "application/json"}, Body: []byte(`{"ssn":"123"}`)}
+	if err := pub.Publish("test", msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Publish("test", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(raw) != 2 || len(got) != 2 {
+		t.Fatalf("expected 2 messages, got %d raw and %d decrypted", len(raw), len(got))
+	}
+	for i, id := range []string{"v1", "v2"} {
+		if raw[i].Header[KeyIdKey] != id || bytes.Contains(raw[i].Body, []byte("ssn")) {
+			t.Fatalf("expected message encrypted with %s, got %v", id, raw[i])
+		}
+		if string(got[i].Body) != string(msg.Body) || got[i].Header["Content-Type"] != "application/json" {
+			t.Fatalf("unexpected decrypted message %v", got[i])
+		}
+		if _, ok := got[i].Header[KeyIdKey]; ok {
+			t.Fatal("expected the encryption headers to be removed")
+		}
+	}
+	if len(msg.Header) != 1 {
+		t.Fatal("expected the published message to be left untouched")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 16)
+
+	sealed, err := seal(key, "v1", "orders", []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := open(key, "v1", "orders", sealed); err != nil || string(b) != "hello" {
+		t.Fatalf("expected hello, got %q, %v", b, err)
+	}
+	if _, err := open(key, "v2", "orders", sealed); err == nil {
+		t.Fatal("expected a changed key id to be rejected")
+	}
+	if _, err := open(key, "v1", "payments", sealed); err == nil {
+		t.Fatal("expected a body replayed to another topic to be rejected")
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := open(key, "v1", "orders", sealed); err == nil {
+		t.Fatal("expected a tampered body to be rejected")
+	}
+	if _, err := open(key, "v1", "orders", []byte("x")); err == nil {
+		t.Fatal("expected a short body to be rejected")
+	}
+}
+
+func TestEnvKeys(t *testing.T) {
+	os.Setenv("TEST_KEY_ID", "v2")
+	os.Setenv("TEST_KEY_V1", base64.StdEncoding.EncodeToString([]byte("1111111111111111")))
+	os.Setenv("TEST_KEY_V2", base64.StdEncoding.EncodeToString([]byte("2222222222222222")))
+	defer func() {
+		os.Unsetenv("TEST_KEY_ID")
+		os.Unsetenv("TEST_KEY_V1")
+		os.Unsetenv("TEST_KEY_V2")
+	}()
+
+	k, err := EnvKeys("TEST_KEY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, key, err := k.Current()
+	if err != nil || id != "v2" || string(key) != "2222222222222222" {
+		t.Fatalf("unexpected current key %s %q %v", id, key, err)
+	}
+	if _, err := k.Key("v1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Key("v3"); err != ErrKeyNotFound {
+		t.Fatalf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	if _, err := EnvKeys("TEST_MISSING"); err == nil {
+		t.Fatal("expected an error without a current key")
+	}
+}
+
+func TestVaultKeys(t *testing.T) {
+	var reads int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reads++
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var data map[string]string
+		switch r.URL.Path {
+		case "/v1/secret/data/orders":
+			data = map[string]string{"id": "v1"}
+		case "/v1/secret/data/orders/v1":
+			data = map[string]string{"key": base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 16))}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"data": data},
+		})
+	}))
+	defer srv.Close()
+
+	k := VaultKeys(srv.URL, "token", "secret/data/orders", time.Minute)
+
+	id, key, err := k.Current()
+	if err != nil || id != "v1" || len(key) != 16 {
+		t.Fatalf("unexpected current key %s %q %v", id, key, err)
+	}
+
+	// unknown keys are cached too
+	reads = 0
+	for i := 0; i < 3; i++ {
+		if _, err := k.Key("v9"); err != ErrKeyNotFound {
+			t.Fatalf("expected ErrKeyNotFound, got %v", err)
+		}
+	}
+	if reads != 1 {
+		t.Fatalf("expected the unknown key to be read once, got %d", reads)
+	}
+}
@@ -0,0 +1,222 @@
+package encrypt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrKeyNotFound is returned by a keyring which doesn't hold the key
+	ErrKeyNotFound = errors.New("encryption key not found")
+
+	// DefaultNegativeTTL is how long FuncKeys remembers keys which weren't found, at most its ttl
+	DefaultNegativeTTL = 10 * time.Second
+	// DefaultVaultTimeout is the timeout of requests to Vault
+	DefaultVaultTimeout = 10 * time.Second
+)
+
+// Keyring holds the keys messages are encrypted with. Keys are 16, 24 or 32 bytes
+// selecting AES-128, AES-192 or AES-256
+type Keyring interface {
+	// Current returns the key new messages are encrypted with
+	Current() (id string, key []byte, err error)
+	// Key returns the key with the given id
+	Key(id string) ([]byte, error)
+}
+
+type staticKeyring struct {
+	current string
+	keys    map[string][]byte
+}
+
+func (s *staticKeyring) Current() (string, []byte, error) {
+	key, err := s.Key(s.current)
+	return s.current, key, err
+}
+
+func (s *staticKeyring) Key(id string) ([]byte, error) {
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+// StaticKeys returns a keyring holding the given keys, new messages are encrypted
+// with the current key. Retired keys are kept to decrypt messages in flight
+func StaticKeys(current string, keys map[string][]byte) Keyring {
+	return &staticKeyring{current: current, keys: keys}
+}
+
+// EnvKeys returns a keyring reading base64 encoded keys from the environment.
+// The id of the current key is read from PREFIX_ID, the key with id foo from
+// PREFIX_FOO e.g MICRO_ENCRYPTION_KEY_ID=v2 and MICRO_ENCRYPTION_KEY_V2=...
+func EnvKeys(prefix string) (Keyring, error) {
+	current := os.Getenv(prefix + "_ID")
+	if len(current) == 0 {
+		return nil, fmt.Errorf("%s_ID is not set", prefix)
+	}
+
+	keys := make(map[string][]byte)
+	for _, env := range os.Environ() {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], prefix+"_") || parts[0] == prefix+"_ID" {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s is not base64 encoded: %v", parts[0], err)
+		}
+		keys[strings.ToLower(strings.TrimPrefix(parts[0], prefix+"_"))] = key
+	}
+
+	current = strings.ToLower(current)
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("%s_%s is not set", prefix, strings.ToUpper(current))
+	}
+	return StaticKeys(current, keys), nil
+}
+
+type funcKeyring struct {
+	current func() (string, error)
+	fetch   func(id string) ([]byte, error)
+	ttl     time.Duration
+
+	sync.Mutex
+	cache   map[string]cached
+	id      string
+	refresh time.Time
+}
+
+type cached struct {
+	key     []byte
+	err     error
+	expires time.Time
+}
+
+func (f *funcKeyring) Current() (string, []byte, error) {
+	f.Lock()
+	id, refresh := f.id, f.refresh
+	f.Unlock()
+
+	if len(id) == 0 || time.Now().After(refresh) {
+		var err error
+		if id, err = f.current(); err != nil {
+			return "", nil, err
+		}
+		f.Lock()
+		f.id, f.refresh = id, time.Now().Add(f.ttl)
+		f.Unlock()
+	}
+
+	key, err := f.Key(id)
+	return id, key, err
+}
+
+func (f *funcKeyring) Key(id string) ([]byte, error) {
+	f.Lock()
+	c, ok := f.cache[id]
+	f.Unlock()
+
+	if ok && time.Now().Before(c.expires) {
+		return c.key, c.err
+	}
+
+	key, err := f.fetch(id)
+	if err == ErrKeyNotFound {
+		// messages with an unknown key id shouldn't each hit the store
+		ttl := DefaultNegativeTTL
+		if f.ttl < ttl {
+			ttl = f.ttl
+		}
+		f.Lock()
+		f.cache[id] = cached{err: err, expires: time.Now().Add(ttl)}
+		f.Unlock()
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f.Lock()
+	f.cache[id] = cached{key: key, expires: time.Now().Add(f.ttl)}
+	f.Unlock()
+	return key, nil
+}
+
+// FuncKeys returns a keyring fetching keys from an external store such as a KMS,
+// keys and the current id are cached for the ttl to keep the store off the hot path.
+// Unknown ids, which fetch reports with ErrKeyNotFound, are cached for DefaultNegativeTTL
+func FuncKeys(current func() (string, error), fetch func(id string) ([]byte, error), ttl time.Duration) Keyring {
+	return &funcKeyring{
+		current: current,
+		fetch:   fetch,
+		ttl:     ttl,
+		cache:   make(map[string]cached),
+	}
+}
+
+// VaultKeys returns a keyring reading keys from the Vault KV version 2 secrets
+// engine, path includes the mount e.g secret/data/orders. The secret at path holds the id of the current key in the field id,
+// the key with id foo is read from the field key of the secret at path/foo. Requests
+// time out after DefaultVaultTimeout
+func VaultKeys(addr, token, path string, ttl time.Duration) Keyring {
+	client := &http.Client{Timeout: DefaultVaultTimeout}
+
+	read := func(p string) (map[string]string, error) {
+		req, err := http.NewRequest("GET", strings.TrimSuffix(addr, "/")+"/v1/"+p, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Vault-Token", token)
+
+		rsp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer rsp.Body.Close()
+
+		if rsp.StatusCode == http.StatusNotFound {
+			return nil, ErrKeyNotFound
+		}
+		if rsp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("vault returned %s reading %s", rsp.Status, p)
+		}
+
+		var secret struct {
+			Data struct {
+				Data map[string]string `json:"data"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(rsp.Body).Decode(&secret); err != nil {
+			return nil, err
+		}
+		return secret.Data.Data, nil
+	}
+
+	path = strings.Trim(path, "/")
+
+	return FuncKeys(func() (string, error) {
+		data, err := read(path)
+		if err != nil {
+			return "", err
+		}
+		if len(data["id"]) == 0 {
+			return "", fmt.Errorf("%s has no id", path)
+		}
+		return data["id"], nil
+	}, func(id string) ([]byte, error) {
+		data, err := read(path + "/" + id)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(data["key"])
+	}, ttl)
+}
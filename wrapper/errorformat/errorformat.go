@@ -0,0 +1,342 @@
+// Package errorformat converts errors between micro errors, grpc status and RFC 7807 problem details
+package errorformat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/micro/go-micro/v2/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+	Micro errors are the common format, errors of the other formats are parsed into
+	them and rendered from them. Http status codes and grpc codes are mapped onto
+	each other the way grpc-gateway does where the mapping is unambiguous. The status
+	message of grpc errors is the detail, unless it holds a micro error itself as
+	sent by the micro grpc server, which is taken as is to keep its id and code.
+
+	Micro errors can't hold the details of grpc status errors, so errors with details
+	are an Error, the micro error along with the details, and problems list them in
+	the details extension member. The micro error is attached as the first detail of
+	the grpc status built from it, the way the micro grpc server does, the micro grpc
+	client returns it from calls.
+*/
+
+// ProblemContentType is the content type of problem details
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object, the id of the micro error is an extension member
+type Problem struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	ID       string `json:"id,omitempty"`
+	// Details are the details of the grpc status
+	Details []*any.Any `json:"details,omitempty"`
+}
+
+func (p *Problem) Error() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+// Error is a micro error along with the details of the grpc status it was parsed from
+type Error struct {
+	Err     *errors.Error
+	Details []*any.Any
+}
+
+// Error returns the json of the micro error with the details added
+func (e *Error) Error() string {
+	b, _ := json.Marshal(struct {
+		*errors.Error
+		Details []*any.Any `json:"details,omitempty"`
+	}{e.Err, e.Details})
+	return string(b)
+}
+
+// Unwrap returns the micro error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+var grpcToHTTP = map[codes.Code]int32{
+	codes.Canceled:           499,
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusPreconditionFailed,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
+
+var httpToGRPC = map[int32]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusMethodNotAllowed:    codes.Unimplemented,
+	http.StatusRequestTimeout:      codes.DeadlineExceeded,
+	http.StatusConflict:            codes.Aborted,
+	http.StatusGone:                codes.NotFound,
+	http.StatusPreconditionFailed:  codes.FailedPrecondition,
+	http.StatusTooManyRequests:     codes.ResourceExhausted,
+	499:                            codes.Canceled,
+	http.StatusInternalServerError: codes.Internal,
+	http.StatusNotImplemented:      codes.Unimplemented,
+	http.StatusBadGateway:          codes.Unavailable,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusGatewayTimeout:      codes.DeadlineExceeded,
+}
+
+// HTTPCode returns the http status code of the grpc code
+func HTTPCode(c codes.Code) int32 {
+	if c == codes.OK {
+		return http.StatusOK
+	}
+	if code, ok := grpcToHTTP[c]; ok {
+		return code
+	}
+	return http.StatusInternalServerError
+}
+
+// GRPCCode returns the grpc code of the http status code
+func GRPCCode(code int32) codes.Code {
+	if c, ok := httpToGRPC[code]; ok {
+		return c
+	}
+	switch {
+	case code < 400:
+		return codes.OK
+	case code < 500:
+		return codes.FailedPrecondition
+	default:
+		return codes.Unknown
+	}
+}
+
+func statusText(code int32) string {
+	if code == 499 {
+		return "Client Closed Request"
+	}
+	return http.StatusText(int(code))
+}
+
+// parseJSON parses micro errors and problem details encoded as json
+func parseJSON(s string) (*errors.Error, bool) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") {
+		return nil, false
+	}
+
+	// the status of micro errors is a string and of problems a number
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, false
+	}
+
+	var e errors.Error
+	if _, ok := raw["code"]; ok {
+		if err := json.Unmarshal([]byte(s), &e); err != nil || e.Code == 0 {
+			return nil, false
+		}
+		return &e, true
+	}
+
+	var p Problem
+	if err := json.Unmarshal([]byte(s), &p); err != nil || p.Status == 0 {
+		return nil, false
+	}
+	return FromProblem(&p), true
+}
+
+// parseDetails returns the details of micro errors and problems encoded as json
+func parseDetails(s string) []*any.Any {
+	var v struct {
+		Details []*any.Any `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil
+	}
+	return v.Details
+}
+
+// statusDetails returns the details of the status but the micro error attached to it
+func statusDetails(s *status.Status) []*any.Any {
+	var details []*any.Any
+	for _, d := range s.Proto().GetDetails() {
+		if !ptypes.Is(d, &errors.Error{}) {
+			details = append(details, d)
+		}
+	}
+	return details
+}
+
+// withDetails returns the micro error, as an Error if there are details
+func withDetails(e *errors.Error, details []*any.Any) error {
+	if len(details) == 0 {
+		return e
+	}
+	return &Error{Err: e, Details: details}
+}
+
+// Parse returns the micro error of err, which may be a micro error, a grpc status
+// error, problem details or either encoded as json. Other errors are internal errors
+func Parse(err error) *errors.Error {
+	if err == nil {
+		return nil
+	}
+
+	switch e := err.(type) {
+	case *errors.Error:
+		return e
+	case *Problem:
+		return FromProblem(e)
+	}
+
+	if s, ok := status.FromError(err); ok {
+		return FromStatus(s)
+	}
+	if e, ok := parseJSON(err.Error()); ok {
+		return e
+	}
+
+	switch err {
+	case context.DeadlineExceeded:
+		return &errors.Error{Code: http.StatusRequestTimeout, Detail: err.Error(), Status: statusText(http.StatusRequestTimeout)}
+	case context.Canceled:
+		return &errors.Error{Code: 499, Detail: err.Error(), Status: statusText(499)}
+	}
+	return &errors.Error{Code: http.StatusInternalServerError, Detail: err.Error(), Status: statusText(http.StatusInternalServerError)}
+}
+
+// Details returns the grpc status details of the error, whichever format it is in
+func Details(err error) []*any.Any {
+	switch e := err.(type) {
+	case nil, *errors.Error:
+		return nil
+	case *Error:
+		return e.Details
+	case *Problem:
+		return e.Details
+	}
+	if s, ok := status.FromError(err); ok {
+		return statusDetails(s)
+	}
+	return parseDetails(err.Error())
+}
+
+// FromStatus returns the micro error of the grpc status
+func FromStatus(s *status.Status) *errors.Error {
+	if s == nil || s.Code() == codes.OK {
+		return nil
+	}
+	for _, d := range s.Details() {
+		if e, ok := d.(*errors.Error); ok {
+			return e
+		}
+	}
+	if e, ok := parseJSON(s.Message()); ok {
+		return e
+	}
+	code := HTTPCode(s.Code())
+	return &errors.Error{
+		Code:   code,
+		Detail: s.Message(),
+		Status: statusText(code),
+	}
+}
+
+// ToStatus returns the grpc status of the error, grpc status errors are returned as is
+func ToStatus(err error) *status.Status {
+	if err == nil {
+		return nil
+	}
+	if s, ok := status.FromError(err); ok {
+		return s
+	}
+	e := Parse(err)
+	if e == nil {
+		return nil
+	}
+	p := status.New(GRPCCode(e.Code), e.Detail).Proto()
+	if a, err := ptypes.MarshalAny(e); err == nil {
+		p.Details = append(p.Details, a)
+	}
+	p.Details = append(p.Details, Details(err)...)
+	return status.FromProto(p)
+}
+
+// FromProblem returns the micro error of the problem details
+func FromProblem(p *Problem) *errors.Error {
+	code := int32(p.Status)
+	if code == 0 {
+		code = http.StatusInternalServerError
+	}
+	e := &errors.Error{
+		Id:     p.ID,
+		Code:   code,
+		Detail: p.Detail,
+		Status: p.Title,
+	}
+	if len(e.Detail) == 0 {
+		e.Detail = p.Title
+	}
+	if len(e.Status) == 0 {
+		e.Status = statusText(code)
+	}
+	return e
+}
+
+// ToProblem returns the problem details of the error
+func ToProblem(err error) *Problem {
+	e := Parse(err)
+	if e == nil {
+		return nil
+	}
+	code := e.Code
+	if code == 0 {
+		code = http.StatusInternalServerError
+	}
+	title := e.Status
+	if len(title) == 0 {
+		title = statusText(code)
+	}
+	return &Problem{
+		Type:    "about:blank",
+		Title:   title,
+		Status:  int(code),
+		Detail:  e.Detail,
+		ID:      e.Id,
+		Details: Details(err),
+	}
+}
+
+// WriteProblem writes the error as problem details
+func WriteProblem(w http.ResponseWriter, err error) {
+	p := ToProblem(err)
+	if p == nil {
+		return
+	}
+	b, _ := json.Marshal(p)
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	w.Write(b)
+}
@@ -0,0 +1,158 @@
+package errorformat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/micro/go-micro/v2/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParse(t *testing.T) {
+	notFound := errors.NotFound("go.micro.srv.greeter", "user 1 not found")
+
+	testData := []struct {
+		err    error
+		id     string
+		code   int32
+		detail string
+	}{
+		{notFound, "go.micro.srv.greeter", 404, "user 1 not found"},
+		{stderrors.New(notFound.Error()), "go.micro.srv.greeter", 404, "user 1 not found"},
+		{status.Error(codes.PermissionDenied, "no access"), "", 403, "no access"},
+		// the micro grpc server sends micro errors as the status message
+		{status.Error(codes.NotFound, notFound.Error()), "go.micro.srv.greeter", 404, "user 1 not found"},
+		{&Problem{Title: "Conflict", Status: 409, Detail: "exists", ID: "svc"}, "svc", 409, "exists"},
+		{stderrors.New(`{"type":"about:blank","title":"Too Many Requests","status":429}`), "", 429, "Too Many Requests"},
+		{context.DeadlineExceeded, "", 408, context.DeadlineExceeded.Error()},
+		{stderrors.New("boom"), "", 500, "boom"},
+	}
+
+	for _, d := range testData {
+		e := Parse(d.err)
+		if e.Id != d.id || e.Code != d.code || e.Detail != d.detail {
+			t.Fatalf("unexpected error %+v parsed from %v", e, d.err)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, code := range []int32{400, 401, 403, 404, 412, 429, 499, 500, 501, 503, 504} {
+		e := &errors.Error{Code: code, Detail: "detail"}
+		if c := FromStatus(ToStatus(e)).Code; c != code {
+			t.Fatalf("expected code %d after grpc round trip, got %d", code, c)
+		}
+		if c := Parse(ToProblem(e)).Code; c != code {
+			t.Fatalf("expected code %d after problem round trip, got %d", code, c)
+		}
+	}
+}
+
+func TestHTTPHandler(t *testing.T) {
+	h := NewHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(404)
+		w.Write([]byte(errors.NotFound("go.micro.api", "not found").Error()))
+	}))
+
+	r := httptest.NewRequest("GET", "/greeter/hello", nil)
+	r.Header.Set("Accept", ProblemContentType)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != 404 || w.Header().Get("Content-Type") != ProblemContentType {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != 404 || p.Detail != "not found" || p.ID != "go.micro.api" {
+		t.Fatalf("unexpected problem %+v", p)
+	}
+}
+
+func TestDetails(t *testing.T) {
+	notFound := errors.NotFound("go.micro.srv.greeter", "user 1 not found").(*errors.Error)
+	info, err := ptypes.MarshalAny(ptypes.DurationProto(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := status.New(codes.NotFound, "user 1 not found").WithDetails(notFound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := s.Proto()
+	p.Details = append(p.Details, info)
+	withInfo := status.FromProto(p).Err()
+
+	// the micro error attached by the micro grpc server isn't a detail of its own
+	if e := Parse(withInfo); e.Id != notFound.Id || e.Code != 404 {
+		t.Fatalf("unexpected error %+v", e)
+	}
+	details := Details(withInfo)
+	if len(details) != 1 || details[0].TypeUrl != info.TypeUrl {
+		t.Fatalf("unexpected details %v", details)
+	}
+
+	// the details survive the conversion into any format and back
+	e := translate(withInfo)
+	for _, err := range []error{e, stderrors.New(e.Error()), ToProblem(e), stderrors.New(ToProblem(e).Error()), ToStatus(e).Err()} {
+		if d := Details(err); len(d) != 1 || d[0].TypeUrl != info.TypeUrl || !bytes.Equal(d[0].Value, info.Value) {
+			t.Fatalf("expected the details to survive in %v, got %v", err, d)
+		}
+		if e := Parse(err); e.Id != notFound.Id || e.Code != 404 || e.Detail != notFound.Detail {
+			t.Fatalf("unexpected error %+v parsed from %v", e, err)
+		}
+	}
+
+	// status errors are kept as they are
+	if len(ToStatus(withInfo).Proto().Details) != 2 {
+		t.Fatal("expected the status to be kept")
+	}
+	if _, ok := translate(notFound).(*errors.Error); !ok {
+		t.Fatal("expected micro errors without details to stay micro errors")
+	}
+}
+
+func TestHTTPHandlerHijack(t *testing.T) {
+	h := NewHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer c.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n\r\n")
+		rw.Flush()
+	}))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	c, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fmt.Fprintf(c, "GET / HTTP/1.1\r\nHost: test\r\nAccept: %s\r\n\r\n", ProblemContentType)
+	line, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(line, "HTTP/1.1 101") {
+		t.Fatalf("unexpected response %q", line)
+	}
+}
@@ -0,0 +1,139 @@
+package errorformat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	stderrors "errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/server"
+)
+
+// translate returns the micro error of err, as an Error if it has details
+func translate(err error) error {
+	return withDetails(Parse(err), Details(err))
+}
+
+type clientWrapper struct {
+	client.Client
+}
+
+func (c *clientWrapper) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	if err := c.Client.Call(ctx, req, rsp, opts...); err != nil {
+		return translate(err)
+	}
+	return nil
+}
+
+func (c *clientWrapper) Stream(ctx context.Context, req client.Request, opts ...client.CallOption) (client.Stream, error) {
+	s, err := c.Client.Stream(ctx, req, opts...)
+	if err != nil {
+		return nil, translate(err)
+	}
+	return s, nil
+}
+
+// NewClientWrapper returns a client wrapper which turns the errors of calls into
+// micro errors, whichever format the server or transport returned them in
+func NewClientWrapper() client.Wrapper {
+	return func(c client.Client) client.Client {
+		return &clientWrapper{c}
+	}
+}
+
+// NewHandlerWrapper returns a handler wrapper which turns the errors of handlers into
+// micro errors, so grpc status errors and problems keep their code on any server
+func NewHandlerWrapper() server.HandlerWrapper {
+	return func(h server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, rsp interface{}) error {
+			if err := h(ctx, req, rsp); err != nil {
+				return translate(err)
+			}
+			return nil
+		}
+	}
+}
+
+// problemWriter holds back error responses to rewrite them as problem details
+type problemWriter struct {
+	http.ResponseWriter
+	code     int
+	buf      bytes.Buffer
+	hijacked bool
+}
+
+func (w *problemWriter) WriteHeader(code int) {
+	w.code = code
+	if code < 400 {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *problemWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.code < 400 {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.buf.Write(b)
+}
+
+// Flush flushes responses which aren't errors, those are held back until the handler returned
+func (w *problemWriter) Flush() {
+	if w.code >= 400 {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection over to the handler, e.g for websockets
+func (w *problemWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, stderrors.New("http.Hijacker not implemented")
+	}
+	c, rw, err := hj.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return c, rw, err
+}
+
+// flush writes the held back error response, as problem details if it is an error
+func (w *problemWriter) flush() {
+	if w.hijacked || w.code < 400 {
+		return
+	}
+	if e, ok := parseJSON(w.buf.String()); ok {
+		if e.Code != int32(w.code) {
+			e.Code = int32(w.code)
+			e.Status = statusText(e.Code)
+		}
+		w.Header().Del("Content-Length")
+		WriteProblem(w.ResponseWriter, withDetails(e, parseDetails(w.buf.String())))
+		return
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+	w.ResponseWriter.Write(w.buf.Bytes())
+}
+
+// NewHTTPHandler returns a handler which rewrites the micro errors returned by the
+// handler e.g the api gateway as problem details, for requests accepting them
+func NewHTTPHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept"), ProblemContentType) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		pw := &problemWriter{ResponseWriter: w}
+		h.ServeHTTP(pw, r)
+		pw.flush()
+	})
+}
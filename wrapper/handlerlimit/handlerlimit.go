@@ -0,0 +1,179 @@
+// Package handlerlimit provides a handler wrapper which limits the concurrency of requests globally and per endpoint
+package handlerlimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/micro/go-micro/v2/errors"
+	"github.com/micro/go-micro/v2/server"
+)
+
+/*
+	A request takes a slot of its endpoint before a slot of the server, so requests
+	waiting on a busy endpoint don't hold server slots other endpoints could use.
+	Without a queue requests beyond the limit are rejected right away, with one they
+	wait for a slot until the queue is full, the queue timeout expired or the caller
+	gave up. Streams hold their slots until the handler returns.
+*/
+
+var (
+	// ErrLimitExceeded is returned for requests which found no free slot
+	ErrLimitExceeded = errors.New("go.micro.server", "too many concurrent requests", 503)
+)
+
+type Options struct {
+	// MaxConcurrent is how many requests are handled at once, 0 is unlimited
+	MaxConcurrent int
+	// Endpoints holds how many requests of an endpoint are handled at once
+	Endpoints map[string]int
+	// QueueSize is how many requests wait for a slot, 0 rejects them right away
+	QueueSize int
+	// QueueTimeout is how long requests wait for a slot, 0 waits until the deadline of the request
+	QueueTimeout time.Duration
+}
+
+type Option func(*Options)
+
+// MaxConcurrent limits how many requests are handled at once across endpoints
+func MaxConcurrent(n int) Option {
+	return func(o *Options) {
+		o.MaxConcurrent = n
+	}
+}
+
+// Endpoint limits how many requests of the endpoint, e.g. Greeter.Hello, are
+// handled at once
+func Endpoint(name string, n int) Option {
+	return func(o *Options) {
+		if o.Endpoints == nil {
+			o.Endpoints = make(map[string]int)
+		}
+		o.Endpoints[name] = n
+	}
+}
+
+// Queue lets up to size requests of each limit wait for a slot for up to timeout
+func Queue(size int, timeout time.Duration) Option {
+	return func(o *Options) {
+		o.QueueSize = size
+		o.QueueTimeout = timeout
+	}
+}
+
+// limiter hands out the slots of a limit
+type limiter struct {
+	slots   chan struct{}
+	waiting int64
+}
+
+func newLimiter(n int) *limiter {
+	if n <= 0 {
+		return nil
+	}
+	return &limiter{
+		slots: make(chan struct{}, n),
+	}
+}
+
+// acquire takes a slot, waiting in the queue when there's none
+func (l *limiter) acquire(ctx context.Context, opts Options) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if atomic.AddInt64(&l.waiting, 1) > int64(opts.QueueSize) {
+		atomic.AddInt64(&l.waiting, -1)
+		return ErrLimitExceeded
+	}
+	defer atomic.AddInt64(&l.waiting, -1)
+
+	var timeout <-chan time.Time
+	if opts.QueueTimeout > 0 {
+		t := time.NewTimer(opts.QueueTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-timeout:
+		return ErrLimitExceeded
+	case <-ctx.Done():
+		return errors.Timeout("go.micro.server", "%v", ctx.Err())
+	}
+}
+
+func (l *limiter) release() {
+	<-l.slots
+}
+
+type handlerLimit struct {
+	opts      Options
+	server    *limiter
+	endpoints map[string]*limiter
+}
+
+// acquire takes the slots of the request, returning the func releasing them
+func (h *handlerLimit) acquire(ctx context.Context, endpoint string) (func(), error) {
+	var held []*limiter
+	release := func() {
+		for _, l := range held {
+			l.release()
+		}
+	}
+
+	for _, l := range []*limiter{h.endpoints[endpoint], h.server} {
+		if l == nil {
+			continue
+		}
+		if err := l.acquire(ctx, h.opts); err != nil {
+			release()
+			return nil, err
+		}
+		held = append(held, l)
+	}
+
+	return release, nil
+}
+
+func newHandlerLimit(opts ...Option) *handlerLimit {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+
+	h := &handlerLimit{
+		opts:      options,
+		server:    newLimiter(options.MaxConcurrent),
+		endpoints: make(map[string]*limiter),
+	}
+	for name, n := range options.Endpoints {
+		if l := newLimiter(n); l != nil {
+			h.endpoints[name] = l
+		}
+	}
+	return h
+}
+
+func (h *handlerLimit) wrap(fn server.HandlerFunc) server.HandlerFunc {
+	return func(ctx context.Context, req server.Request, rsp interface{}) error {
+		release, err := h.acquire(ctx, req.Endpoint())
+		if err != nil {
+			return err
+		}
+		defer release()
+		return fn(ctx, req, rsp)
+	}
+}
+
+// NewHandlerWrapper returns a handler wrapper which limits how many requests are
+// handled at once, by the server with MaxConcurrent and per endpoint with Endpoint.
+// Requests beyond the limits are rejected with ErrLimitExceeded or queued with Queue
+func NewHandlerWrapper(opts ...Option) server.HandlerWrapper {
+	return newHandlerLimit(opts...).wrap
+}
@@ -0,0 +1,124 @@
+package handlerlimit
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/server"
+)
+
+type testRequest struct {
+	server.Request
+	endpoint string
+}
+
+func (r *testRequest) Endpoint() string {
+	return r.endpoint
+}
+
+// block returns a handler blocking until release is closed, signalling started once running
+func block(started chan bool, release chan bool) server.HandlerFunc {
+	return func(ctx context.Context, req server.Request, rsp interface{}) error {
+		started <- true
+		<-release
+		return nil
+	}
+}
+
+func TestEndpointLimit(t *testing.T) {
+	started := make(chan bool, 8)
+	release := make(chan bool)
+	defer close(release)
+
+	fn := NewHandlerWrapper(Endpoint("Foo.Heavy", 1))(block(started, release))
+
+	go fn(context.Background(), &testRequest{endpoint: "Foo.Heavy"}, nil)
+	<-started
+
+	if err := fn(context.Background(), &testRequest{endpoint: "Foo.Heavy"}, nil); err != ErrLimitExceeded {
+		t.Fatalf("expected %v got %v", ErrLimitExceeded, err)
+	}
+
+	// other endpoints are not affected
+	go fn(context.Background(), &testRequest{endpoint: "Foo.Light"}, nil)
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("expected the other endpoint to be handled")
+	}
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	started := make(chan bool, 8)
+	release := make(chan bool)
+	defer close(release)
+
+	fn := NewHandlerWrapper(MaxConcurrent(2))(block(started, release))
+
+	for _, ep := range []string{"Foo.A", "Foo.B"} {
+		go fn(context.Background(), &testRequest{endpoint: ep}, nil)
+		<-started
+	}
+
+	if err := fn(context.Background(), &testRequest{endpoint: "Foo.C"}, nil); err != ErrLimitExceeded {
+		t.Fatalf("expected %v got %v", ErrLimitExceeded, err)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	started := make(chan bool, 8)
+	release := make(chan bool)
+
+	h := newHandlerLimit(MaxConcurrent(1), Queue(1, time.Minute))
+	fn := h.wrap(block(started, release))
+
+	go fn(context.Background(), &testRequest{endpoint: "Foo.A"}, nil)
+	<-started
+
+	queued := make(chan error, 1)
+	go func() {
+		queued <- fn(context.Background(), &testRequest{endpoint: "Foo.A"}, nil)
+	}()
+
+	// wait for the request to be queued
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&h.server.waiting) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the request to be queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the queue is full
+	if err := fn(context.Background(), &testRequest{endpoint: "Foo.A"}, nil); err != ErrLimitExceeded {
+		t.Fatalf("expected %v got %v", ErrLimitExceeded, err)
+	}
+
+	// the queued request runs once the first is done
+	close(release)
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("expected the queued request to be handled")
+	}
+	if err := <-queued; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueueTimeout(t *testing.T) {
+	started := make(chan bool, 8)
+	release := make(chan bool)
+	defer close(release)
+
+	fn := NewHandlerWrapper(MaxConcurrent(1), Queue(1, 10*time.Millisecond))(block(started, release))
+
+	go fn(context.Background(), &testRequest{endpoint: "Foo.A"}, nil)
+	<-started
+
+	if err := fn(context.Background(), &testRequest{endpoint: "Foo.A"}, nil); err != ErrLimitExceeded {
+		t.Fatalf("expected %v got %v", ErrLimitExceeded, err)
+	}
+}
@@ -0,0 +1,8 @@
+module github.com/micro/go-plugins/wrapper/interceptor/v2
+
+go 1.13
+
+require (
+	github.com/micro/go-micro/v2 v2.9.1
+	google.golang.org/grpc v1.26.0
+)
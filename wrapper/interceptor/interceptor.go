@@ -0,0 +1,211 @@
+// Package interceptor provides a handler wrapper running grpc server interceptors
+package interceptor
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/micro/go-micro/v2/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+/*
+	The micro grpc server serves every service with an unknown service handler, which
+	grpc doesn't run unary interceptors for, and its handler wrappers see micro requests
+	rather than grpc ones. The wrapper runs the interceptors around the handler instead,
+	so they work on any micro server: unary interceptors get the body of the request,
+	the body they pass on is the one the handler gets, and streaming ones a grpc.ServerStream over the micro stream. The context is that of
+	the handler, on the grpc server it carries the incoming metadata and the peer, and
+	the context an interceptor passes on is the one the handler gets.
+
+	Interceptors return grpc status errors, errorformat.NewHandlerWrapper turns them
+	into micro errors for servers other than grpc.
+*/
+
+type Options struct {
+	// Unary interceptors run around unary requests, the first is the outermost
+	Unary []grpc.UnaryServerInterceptor
+	// Stream interceptors run around streaming requests, the first is the outermost
+	Stream []grpc.StreamServerInterceptor
+}
+
+type Option func(*Options)
+
+// Unary adds interceptors run around unary requests
+func Unary(i ...grpc.UnaryServerInterceptor) Option {
+	return func(o *Options) {
+		o.Unary = append(o.Unary, i...)
+	}
+}
+
+// Stream adds interceptors run around streaming requests
+func Stream(i ...grpc.StreamServerInterceptor) Option {
+	return func(o *Options) {
+		o.Stream = append(o.Stream, i...)
+	}
+}
+
+// fullMethod returns the grpc method of the request e.g /helloworld.Greeter/SayHello,
+// built from the endpoint when the server isn't grpc
+func fullMethod(ctx context.Context, req server.Request) string {
+	if m, ok := grpc.Method(ctx); ok {
+		return m
+	}
+	parts := strings.SplitN(req.Endpoint(), ".", 2)
+	if len(parts) != 2 {
+		return "/" + req.Service() + "/" + req.Endpoint()
+	}
+	return "/" + parts[0] + "/" + parts[1]
+}
+
+// chainUnary returns the interceptors as one
+func chainUnary(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, h := interceptors[i], next
+			next = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, h)
+			}
+		}
+		return next(ctx, req)
+	}
+}
+
+// chainStream returns the interceptors as one
+func chainStream(interceptors []grpc.StreamServerInterceptor) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, h := interceptors[i], next
+			next = func(srv interface{}, ss grpc.ServerStream) error {
+				return interceptor(srv, ss, info, h)
+			}
+		}
+		return next(srv, ss)
+	}
+}
+
+// serverStream is a grpc.ServerStream over a micro stream
+type serverStream struct {
+	ctx    context.Context
+	stream server.Stream
+}
+
+func (s *serverStream) SetHeader(md metadata.MD) error {
+	return grpc.SetHeader(s.ctx, md)
+}
+
+func (s *serverStream) SendHeader(md metadata.MD) error {
+	return grpc.SendHeader(s.ctx, md)
+}
+
+func (s *serverStream) SetTrailer(md metadata.MD) {
+	grpc.SetTrailer(s.ctx, md)
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	return s.stream.Send(m)
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	return s.stream.Recv(m)
+}
+
+// stream is a micro stream over the grpc.ServerStream an interceptor passed on
+type stream struct {
+	server.Stream
+	ss grpc.ServerStream
+}
+
+func (s *stream) Context() context.Context {
+	return s.ss.Context()
+}
+
+func (s *stream) Send(m interface{}) error {
+	return s.ss.SendMsg(m)
+}
+
+func (s *stream) Recv(m interface{}) error {
+	return s.ss.RecvMsg(m)
+}
+
+// request is a micro request with the body an interceptor passed on
+type request struct {
+	server.Request
+	body interface{}
+}
+
+func (r *request) Body() interface{} {
+	return r.body
+}
+
+// set copies a body or response an interceptor passed on into the one of the request,
+// e.g a response returned from a cache without calling the handler. The micro servers
+// call the handler with the body they decoded rather than the one of the request
+func set(dst, v interface{}) {
+	if v == nil || v == dst {
+		return
+	}
+	d, src := reflect.ValueOf(dst), reflect.ValueOf(v)
+	if d.Kind() != reflect.Ptr || d.IsNil() || src.Type() != d.Type() || src.IsNil() {
+		return
+	}
+	d.Elem().Set(src.Elem())
+}
+
+// NewHandlerWrapper returns a handler wrapper running the grpc interceptors around
+// the handler, so interceptors such as those of go-grpc-middleware can be reused
+func NewHandlerWrapper(opts ...Option) server.HandlerWrapper {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+
+	unary := chainUnary(options.Unary)
+	streaming := chainStream(options.Stream)
+
+	return func(h server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, rsp interface{}) error {
+			if req.Stream() {
+				s, ok := rsp.(server.Stream)
+				if !ok || len(options.Stream) == 0 {
+					return h(ctx, req, rsp)
+				}
+				info := &grpc.StreamServerInfo{
+					FullMethod:     fullMethod(ctx, req),
+					IsClientStream: true,
+					IsServerStream: true,
+				}
+				return streaming(nil, &serverStream{ctx: ctx, stream: s}, info, func(srv interface{}, ss grpc.ServerStream) error {
+					return h(ss.Context(), req, &stream{Stream: s, ss: ss})
+				})
+			}
+
+			if len(options.Unary) == 0 {
+				return h(ctx, req, rsp)
+			}
+			info := &grpc.UnaryServerInfo{
+				FullMethod: fullMethod(ctx, req),
+			}
+			v, err := unary(ctx, req.Body(), info, func(ctx context.Context, body interface{}) (interface{}, error) {
+				set(req.Body(), body)
+				if err := h(ctx, &request{Request: req, body: body}, rsp); err != nil {
+					return nil, err
+				}
+				return rsp, nil
+			})
+			if err != nil {
+				return err
+			}
+			set(rsp, v)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micro/go-micro/v2/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type testRequest struct {
+	server.Request
+	stream bool
+	body   interface{}
+}
+
+func (r *testRequest) Service() string {
+	return "greeter"
+}
+
+func (r *testRequest) Endpoint() string {
+	return "Greeter.Hello"
+}
+
+func (r *testRequest) Body() interface{} {
+	return r.body
+}
+
+func (r *testRequest) Stream() bool {
+	return r.stream
+}
+
+type testResponse struct {
+	Msg string
+}
+
+type testStream struct {
+	server.Stream
+	msgs []string
+}
+
+func (s *testStream) Recv(m interface{}) error {
+	if len(s.msgs) == 0 {
+		return context.Canceled
+	}
+	m.(*testResponse).Msg, s.msgs = s.msgs[0], s.msgs[1:]
+	return nil
+}
+
+type ctxKey struct{}
+
+func TestUnary(t *testing.T) {
+	var order []string
+	trace := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if info.FullMethod != "/Greeter/Hello" {
+				t.Fatalf("unexpected method %s", info.FullMethod)
+			}
+			order = append(order, name)
+			return handler(context.WithValue(ctx, ctxKey{}, name), req)
+		}
+	}
+
+	w := NewHandlerWrapper(Unary(trace("first"), trace("second")))
+	h := w(func(ctx context.Context, req server.Request, rsp interface{}) error {
+		rsp.(*testResponse).Msg = "hello " + ctx.Value(ctxKey{}).(string)
+		return nil
+	})
+
+	rsp := new(testResponse)
+	if err := h(context.Background(), &testRequest{body: "john"}, rsp); err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+		t.Fatalf("expected the interceptors in order got %v", order)
+	}
+	if rsp.Msg != "hello second" {
+		t.Fatalf("expected the context of the last interceptor got %q", rsp.Msg)
+	}
+}
+
+func TestUnaryReject(t *testing.T) {
+	auth := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if req != "admin" {
+			return nil, status.Error(codes.PermissionDenied, "forbidden")
+		}
+		return handler(ctx, req)
+	}
+	var called bool
+	h := NewHandlerWrapper(Unary(auth))(func(ctx context.Context, req server.Request, rsp interface{}) error {
+		called = true
+		return nil
+	})
+
+	err := h(context.Background(), &testRequest{body: "john"}, new(testResponse))
+	if status.Code(err) != codes.PermissionDenied || called {
+		t.Fatalf("expected the request to be rejected got %v", err)
+	}
+}
+
+func TestUnaryResponse(t *testing.T) {
+	cached := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return &testResponse{Msg: "cached"}, nil
+	}
+	h := NewHandlerWrapper(Unary(cached))(func(ctx context.Context, req server.Request, rsp interface{}) error {
+		t.Fatal("unexpected call of the handler")
+		return nil
+	})
+
+	rsp := new(testResponse)
+	if err := h(context.Background(), &testRequest{}, rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Msg != "cached" {
+		t.Fatalf("expected the response of the interceptor got %q", rsp.Msg)
+	}
+}
+
+func TestUnaryBody(t *testing.T) {
+	redact := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(ctx, &testResponse{Msg: "redacted"})
+	}
+
+	var got string
+	h := NewHandlerWrapper(Unary(redact))(func(ctx context.Context, req server.Request, rsp interface{}) error {
+		got = req.Body().(*testResponse).Msg
+		return nil
+	})
+
+	body := &testResponse{Msg: "secret"}
+	if err := h(context.Background(), &testRequest{body: body}, new(testResponse)); err != nil {
+		t.Fatal(err)
+	}
+	if got != "redacted" {
+		t.Fatalf("expected the body of the interceptor got %q", got)
+	}
+	// the servers call the handler with the body they decoded
+	if body.Msg != "redacted" {
+		t.Fatalf("expected the body of the interceptor to be copied into the request got %q", body.Msg)
+	}
+}
+
+type upperStream struct {
+	grpc.ServerStream
+}
+
+func (s *upperStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	m.(*testResponse).Msg += "!"
+	return nil
+}
+
+func TestStream(t *testing.T) {
+	wrap := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if info.FullMethod != "/Greeter/Hello" {
+			t.Fatalf("unexpected method %s", info.FullMethod)
+		}
+		return handler(srv, &upperStream{ss})
+	}
+
+	var msgs []string
+	h := NewHandlerWrapper(Stream(wrap))(func(ctx context.Context, req server.Request, rsp interface{}) error {
+		s := rsp.(server.Stream)
+		for {
+			m := new(testResponse)
+			if err := s.Recv(m); err != nil {
+				return nil
+			}
+			msgs = append(msgs, m.Msg)
+		}
+	})
+
+	s := &testStream{msgs: []string{"a", "b"}}
+	if err := h(context.Background(), &testRequest{stream: true}, s); err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0] != "a!" || msgs[1] != "b!" {
+		t.Fatalf("expected the messages through the interceptor got %v", msgs)
+	}
+}
@@ -0,0 +1,289 @@
+// Package mirror provides a client wrapper which mirrors requests to a shadow service
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"time"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/errors"
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/metadata"
+)
+
+/*
+	The shadow call starts along with the call mirrored so it sees the same state,
+	it gets the metadata of the call and the shadow header so the shadow service
+	can skip side effects, and the call options except those selecting the nodes
+	of the service mirrored, such as WithAddress. Its response is never returned, it's compared with the
+	response of the call once both are done and written to the sinks if they
+	differ, errors by code and detail as their id names the service. Shadow calls beyond MaxInFlight are dropped rather than queued so a
+	slow shadow service can't hold up the client.
+*/
+
+var (
+	// ShadowKey is the metadata marking shadow calls
+	ShadowKey = "Micro-Shadow"
+
+	// DefaultTimeout is how long shadow calls take without Timeout
+	DefaultTimeout = 5 * time.Second
+
+	// DefaultMaxInFlight is how many shadow calls run at once without MaxInFlight
+	DefaultMaxInFlight = 100
+)
+
+// Diff is the result of a shadow call differing from the call mirrored
+type Diff struct {
+	Service        string          `json:"service"`
+	Shadow         string          `json:"shadow"`
+	Endpoint       string          `json:"endpoint"`
+	Timestamp      time.Time       `json:"timestamp"`
+	Error          string          `json:"error,omitempty"`
+	ShadowError    string          `json:"shadow_error,omitempty"`
+	Response       json.RawMessage `json:"response,omitempty"`
+	ShadowResponse json.RawMessage `json:"shadow_response,omitempty"`
+	Latency        time.Duration   `json:"latency"`
+	ShadowLatency  time.Duration   `json:"shadow_latency"`
+}
+
+type Options struct {
+	// Services maps the services mirrored to their shadows
+	Services map[string]string
+	// Percent is the share of calls mirrored, from 0 to 100
+	Percent float64
+	// Endpoints limits the endpoints mirrored, all are without
+	Endpoints []string
+	// Sinks receive the diffs
+	Sinks []Sink
+	// Timeout is how long shadow calls take
+	Timeout time.Duration
+	// MaxInFlight is how many shadow calls run at once
+	MaxInFlight int
+}
+
+type Option func(*Options)
+
+// Shadow mirrors the calls of the service to the shadow service
+func Shadow(service, shadow string) Option {
+	return func(o *Options) {
+		if o.Services == nil {
+			o.Services = make(map[string]string)
+		}
+		o.Services[service] = shadow
+	}
+}
+
+// Percent sets the share of calls mirrored, from 0 to 100
+func Percent(p float64) Option {
+	return func(o *Options) {
+		o.Percent = p
+	}
+}
+
+// Endpoints limits the endpoints mirrored
+func Endpoints(eps ...string) Option {
+	return func(o *Options) {
+		o.Endpoints = append(o.Endpoints, eps...)
+	}
+}
+
+// WithSink adds a sink receiving the diffs
+func WithSink(s Sink) Option {
+	return func(o *Options) {
+		o.Sinks = append(o.Sinks, s)
+	}
+}
+
+// Timeout sets how long shadow calls take
+func Timeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = d
+	}
+}
+
+// MaxInFlight sets how many shadow calls run at once
+func MaxInFlight(n int) Option {
+	return func(o *Options) {
+		o.MaxInFlight = n
+	}
+}
+
+// result is the outcome of a call
+type result struct {
+	rsp     json.RawMessage
+	err     error
+	latency time.Duration
+}
+
+type mirrorClient struct {
+	client.Client
+	opts      Options
+	endpoints map[string]bool
+	inFlight  chan struct{}
+}
+
+// shadow returns the shadow service of the call, false if it's not mirrored
+func (m *mirrorClient) shadow(req client.Request) (string, bool) {
+	if req.Stream() {
+		return "", false
+	}
+	shadow, ok := m.opts.Services[req.Service()]
+	if !ok {
+		return "", false
+	}
+	if len(m.endpoints) > 0 && !m.endpoints[req.Endpoint()] {
+		return "", false
+	}
+	if m.opts.Percent < 100 && rand.Float64()*100 >= m.opts.Percent {
+		return "", false
+	}
+	return shadow, true
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// sameError compares the errors by code and detail, the id names the service
+// which differs between the call and the shadow call
+func sameError(a, b error) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	ea, eb := errors.Parse(a.Error()), errors.Parse(b.Error())
+	return ea.Code == eb.Code && ea.Detail == eb.Detail
+}
+
+// shadowOptions returns the call options of the call for the shadow call, except
+// those routing to the nodes of the service mirrored
+func shadowOptions(opts []client.CallOption) client.CallOption {
+	return func(o *client.CallOptions) {
+		addrs, sopts := o.Address, o.SelectOptions
+		for _, opt := range opts {
+			opt(o)
+		}
+		o.Address, o.SelectOptions = addrs, sopts
+	}
+}
+
+// compare writes the diff of the results to the sinks if they differ
+func (m *mirrorClient) compare(req client.Request, shadow string, r, s result) {
+	if sameError(r.err, s.err) && bytes.Equal(r.rsp, s.rsp) {
+		return
+	}
+
+	d := &Diff{
+		Service:        req.Service(),
+		Shadow:         shadow,
+		Endpoint:       req.Endpoint(),
+		Timestamp:      time.Now(),
+		Error:          errString(r.err),
+		ShadowError:    errString(s.err),
+		Response:       r.rsp,
+		ShadowResponse: s.rsp,
+		Latency:        r.latency,
+		ShadowLatency:  s.latency,
+	}
+	for _, sink := range m.opts.Sinks {
+		if err := sink.Write(d); err != nil {
+			log.Errorf("[mirror] failed to write diff to %s: %v", sink.String(), err)
+		}
+	}
+}
+
+// call makes the shadow call, detached from the caller
+func (m *mirrorClient) call(ctx context.Context, req client.Request, shadow string, rsp interface{}, opts []client.CallOption) result {
+	// FromContext returns a copy, the metadata of the call is left as it is
+	md, ok := metadata.FromContext(ctx)
+	if !ok {
+		md = make(metadata.Metadata)
+	}
+	md[ShadowKey] = "true"
+
+	ctx, cancel := context.WithTimeout(metadata.NewContext(context.Background(), md), m.opts.Timeout)
+	defer cancel()
+
+	// a response of the same type as the one of the call
+	srsp := rsp
+	if t := reflect.TypeOf(rsp); t != nil && t.Kind() == reflect.Ptr {
+		srsp = reflect.New(t.Elem()).Interface()
+	}
+
+	sreq := m.Client.NewRequest(shadow, req.Endpoint(), req.Body(), client.WithContentType(req.ContentType()))
+
+	start := time.Now()
+	err := m.Client.Call(ctx, sreq, srsp, shadowOptions(opts))
+	r := result{err: err, latency: time.Since(start)}
+	if err == nil {
+		r.rsp, _ = json.Marshal(srsp)
+	}
+	return r
+}
+
+func (m *mirrorClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	shadow, ok := m.shadow(req)
+	if !ok {
+		return m.Client.Call(ctx, req, rsp, opts...)
+	}
+
+	select {
+	case m.inFlight <- struct{}{}:
+	default:
+		// too many shadow calls, drop this one
+		return m.Client.Call(ctx, req, rsp, opts...)
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			<-m.inFlight
+		}()
+		s := m.call(ctx, req, shadow, rsp, opts)
+		m.compare(req, shadow, <-done, s)
+	}()
+
+	start := time.Now()
+	err := m.Client.Call(ctx, req, rsp, opts...)
+	r := result{err: err, latency: time.Since(start)}
+	if err == nil {
+		// encoded before returning, the caller owns the response then
+		r.rsp, _ = json.Marshal(rsp)
+	}
+	done <- r
+
+	return err
+}
+
+// NewClientWrapper returns a client wrapper mirroring the calls of the services set
+// with Shadow to their shadow services, writing the results which differ to the sinks
+func NewClientWrapper(opts ...Option) client.Wrapper {
+	options := Options{
+		Percent:     100,
+		Timeout:     DefaultTimeout,
+		MaxInFlight: DefaultMaxInFlight,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	endpoints := make(map[string]bool, len(options.Endpoints))
+	for _, ep := range options.Endpoints {
+		endpoints[ep] = true
+	}
+
+	return func(c client.Client) client.Client {
+		return &mirrorClient{
+			Client:    c,
+			opts:      options,
+			endpoints: endpoints,
+			inFlight:  make(chan struct{}, options.MaxInFlight),
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/client"
+	merrors "github.com/micro/go-micro/v2/errors"
+	"github.com/micro/go-micro/v2/metadata"
+)
+
+type testRequest struct {
+	client.Request
+	service  string
+	endpoint string
+	body     interface{}
+}
+
+func (r *testRequest) Service() string {
+	return r.service
+}
+
+func (r *testRequest) Endpoint() string {
+	return r.endpoint
+}
+
+func (r *testRequest) Body() interface{} {
+	return r.body
+}
+
+func (r *testRequest) ContentType() string {
+	return "application/json"
+}
+
+func (r *testRequest) Stream() bool {
+	return false
+}
+
+type testResponse struct {
+	Greeting string
+}
+
+// testClient replies the greetings of the services, recording the shadow calls
+type testClient struct {
+	client.Client
+	greetings map[string]string
+	errs      map[string]error
+	shadows   chan metadata.Metadata
+	// blocks the calls to the service until closed
+	release chan bool
+	// calls blocked on release
+	blocked int32
+}
+
+func (c *testClient) NewRequest(service, endpoint string, req interface{}, opts ...client.RequestOption) client.Request {
+	return &testRequest{service: service, endpoint: endpoint, body: req}
+}
+
+func (c *testClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	if md, ok := metadata.FromContext(ctx); ok && md[ShadowKey] == "true" {
+		var options client.CallOptions
+		for _, o := range opts {
+			o(&options)
+		}
+		md["Address"] = strings.Join(options.Address, ",")
+		defer func() {
+			c.shadows <- md
+		}()
+	} else if c.release != nil {
+		atomic.AddInt32(&c.blocked, 1)
+		<-c.release
+	}
+	if err := c.errs[req.Service()]; err != nil {
+		return err
+	}
+	rsp.(*testResponse).Greeting = c.greetings[req.Service()]
+	return nil
+}
+
+type chanSink chan *Diff
+
+func (s chanSink) Write(d *Diff) error {
+	s <- d
+	return nil
+}
+
+func (s chanSink) String() string {
+	return "chan"
+}
+
+func call(t *testing.T, c client.Client, service, endpoint string) string {
+	t.Helper()
+	ctx := metadata.NewContext(context.Background(), metadata.Metadata{"User": "john"})
+	rsp := new(testResponse)
+	if err := c.Call(ctx, &testRequest{service: service, endpoint: endpoint}, rsp); err != nil {
+		t.Fatal(err)
+	}
+	return rsp.Greeting
+}
+
+func TestMirror(t *testing.T) {
+	tc := &testClient{
+		greetings: map[string]string{"foo": "hello", "foo-v2": "hello"},
+		shadows:   make(chan metadata.Metadata, 8),
+	}
+	sink := make(chanSink, 8)
+	c := NewClientWrapper(Shadow("foo", "foo-v2"), WithSink(sink))(tc)
+
+	if g := call(t, c, "foo", "Foo.Hello"); g != "hello" {
+		t.Fatalf("expected the response of the service got %q", g)
+	}
+	select {
+	case md := <-tc.shadows:
+		if md["User"] != "john" {
+			t.Fatalf("expected the metadata of the call got %v", md)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a shadow call")
+	}
+
+	// the responses match so nothing is written
+	select {
+	case d := <-sink:
+		t.Fatalf("unexpected diff %+v", d)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// other services aren't mirrored
+	call(t, c, "bar", "Bar.Hello")
+	select {
+	case <-tc.shadows:
+		t.Fatal("unexpected shadow call")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMirrorDiff(t *testing.T) {
+	tc := &testClient{
+		greetings: map[string]string{"foo": "hello", "foo-v2": "hi"},
+		errs:      map[string]error{},
+		shadows:   make(chan metadata.Metadata, 8),
+	}
+	sink := make(chanSink, 8)
+	c := NewClientWrapper(Shadow("foo", "foo-v2"), WithSink(sink))(tc)
+
+	call(t, c, "foo", "Foo.Hello")
+	select {
+	case d := <-sink:
+		if d.Shadow != "foo-v2" || d.Endpoint != "Foo.Hello" ||
+			string(d.Response) != `{"Greeting":"hello"}` || string(d.ShadowResponse) != `{"Greeting":"hi"}` {
+			t.Fatalf("unexpected diff %+v", d)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a diff")
+	}
+
+	// the errors of the shadow are written but never returned
+	tc.errs["foo-v2"] = errors.New("not implemented")
+	tc.greetings["foo-v2"] = "hello"
+	if g := call(t, c, "foo", "Foo.Hello"); g != "hello" {
+		t.Fatalf("expected the response of the service got %q", g)
+	}
+	select {
+	case d := <-sink:
+		if d.ShadowError != "not implemented" || len(d.Error) > 0 {
+			t.Fatalf("unexpected diff %+v", d)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a diff")
+	}
+
+	// the same error of both services isn't a diff
+	tc.errs["foo"] = merrors.NotFound("foo", "not found")
+	tc.errs["foo-v2"] = merrors.NotFound("foo-v2", "not found")
+	rsp := new(testResponse)
+	if err := c.Call(context.Background(), &testRequest{service: "foo", endpoint: "Foo.Hello"}, rsp); err == nil {
+		t.Fatal("expected the error of the service")
+	}
+	<-tc.shadows
+	select {
+	case d := <-sink:
+		t.Fatalf("unexpected diff %+v", d)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMirrorOptions(t *testing.T) {
+	tc := &testClient{
+		greetings: map[string]string{"foo": "hello", "foo-v2": "hello"},
+		shadows:   make(chan metadata.Metadata, 8),
+	}
+	c := NewClientWrapper(Shadow("foo", "foo-v2"))(tc)
+
+	rsp := new(testResponse)
+	if err := c.Call(context.Background(), &testRequest{service: "foo", endpoint: "Foo.Hello"}, rsp,
+		client.WithAddress("10.0.0.1:8080"), client.WithRequestTimeout(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case md := <-tc.shadows:
+		if len(md["Address"]) > 0 {
+			t.Fatalf("expected the address of the service to be stripped got %s", md["Address"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a shadow call")
+	}
+}
+
+func TestMirrorFilter(t *testing.T) {
+	tc := &testClient{
+		greetings: map[string]string{"foo": "hello"},
+		shadows:   make(chan metadata.Metadata, 8),
+	}
+	c := NewClientWrapper(Shadow("foo", "foo-v2"), Endpoints("Foo.Get"))(tc)
+	call(t, c, "foo", "Foo.Hello")
+
+	c = NewClientWrapper(Shadow("foo", "foo-v2"), Percent(0))(tc)
+	call(t, c, "foo", "Foo.Hello")
+
+	select {
+	case <-tc.shadows:
+		t.Fatal("unexpected shadow call")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMaxInFlight(t *testing.T) {
+	tc := &testClient{
+		greetings: map[string]string{"foo": "hello"},
+		shadows:   make(chan metadata.Metadata, 8),
+		release:   make(chan bool),
+	}
+	c := NewClientWrapper(Shadow("foo", "foo-v2"), MaxInFlight(1))(tc)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		call(t, c, "foo", "Foo.Hello")
+	}()
+
+	// the shadow call of the blocked call holds the only slot
+	<-tc.shadows
+	mc := c.(*mirrorClient)
+	if len(mc.inFlight) != 1 {
+		t.Fatalf("expected a shadow call in flight got %d", len(mc.inFlight))
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		call(t, c, "foo", "Foo.Hello")
+	}()
+	// the second call passed the slot check once it's blocked too
+	for atomic.LoadInt32(&tc.blocked) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(tc.release)
+	wg.Wait()
+
+	select {
+	case <-tc.shadows:
+		t.Fatal("expected the shadow call to be dropped")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,62 @@
+package mirror
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	log "github.com/micro/go-micro/v2/logger"
+)
+
+// Sink receives the results of the shadow calls differing from the calls mirrored
+type Sink interface {
+	Write(d *Diff) error
+	String() string
+}
+
+type logSink struct{}
+
+func (s *logSink) Write(d *Diff) error {
+	log.Infof("[mirror] %s %s differs from %s: error %q, shadow error %q, response %s, shadow response %s",
+		d.Shadow, d.Endpoint, d.Service, d.Error, d.ShadowError, d.Response, d.ShadowResponse)
+	return nil
+}
+
+func (s *logSink) String() string {
+	return "log"
+}
+
+type fileSink struct {
+	sync.Mutex
+	f *os.File
+}
+
+func (s *fileSink) Write(d *Diff) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	_, err = s.f.Write(append(b, '\n'))
+	return err
+}
+
+func (s *fileSink) String() string {
+	return "file"
+}
+
+// LogSink logs the diffs
+func LogSink() Sink {
+	return &logSink{}
+}
+
+// FileSink appends the diffs to the file as json, one per line
+func FileSink(path string) (Sink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{f: f}, nil
+}
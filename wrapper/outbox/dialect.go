@@ -0,0 +1,97 @@
+package outbox
+
+import (
+	"strconv"
+)
+
+// Dialect holds the sql which differs between databases
+type Dialect struct {
+	// Placeholder returns the placeholder of the nth argument, starting at 1
+	Placeholder func(n int) string
+	// Lock is appended to the select of pending messages so concurrent relays
+	// wait for the relay publishing them rather than publishing later messages
+	Lock string
+	// CreateOutbox creates the outbox table named by %s
+	CreateOutbox string
+	// CreateInbox creates the inbox table named by %s
+	CreateInbox string
+	// InsertInbox inserts the id and processed time into the inbox table named by %s
+	// unless the id is present, the placeholders are filled in by the broker
+	InsertInbox string
+}
+
+var (
+	// Postgres is the dialect of PostgreSQL
+	Postgres = Dialect{
+		Placeholder: func(n int) string {
+			return "$" + strconv.Itoa(n)
+		},
+		Lock: "FOR UPDATE",
+		CreateOutbox: `CREATE TABLE IF NOT EXISTS %s (
+			seq BIGSERIAL PRIMARY KEY,
+			id VARCHAR(64) NOT NULL,
+			topic VARCHAR(255) NOT NULL,
+			header TEXT NOT NULL,
+			body BYTEA,
+			created_at TIMESTAMP NOT NULL
+		)`,
+		CreateInbox: `CREATE TABLE IF NOT EXISTS %s (
+			id VARCHAR(64) PRIMARY KEY,
+			processed_at TIMESTAMP NOT NULL
+		)`,
+		InsertInbox: "INSERT INTO %s (id, processed_at) VALUES (%s) ON CONFLICT DO NOTHING",
+	}
+
+	// MySQL is the dialect of MySQL 8 and later
+	MySQL = Dialect{
+		Placeholder: func(n int) string {
+			return "?"
+		},
+		Lock: "FOR UPDATE",
+		CreateOutbox: `CREATE TABLE IF NOT EXISTS %s (
+			seq BIGINT AUTO_INCREMENT PRIMARY KEY,
+			id VARCHAR(64) NOT NULL,
+			topic VARCHAR(255) NOT NULL,
+			header TEXT NOT NULL,
+			body LONGBLOB,
+			created_at DATETIME(6) NOT NULL
+		)`,
+		CreateInbox: `CREATE TABLE IF NOT EXISTS %s (
+			id VARCHAR(64) PRIMARY KEY,
+			processed_at DATETIME(6) NOT NULL
+		)`,
+		InsertInbox: "INSERT IGNORE INTO %s (id, processed_at) VALUES (%s)",
+	}
+
+	// SQLite is the dialect of SQLite, which locks the whole database on write
+	SQLite = Dialect{
+		Placeholder: func(n int) string {
+			return "?"
+		},
+		CreateOutbox: `CREATE TABLE IF NOT EXISTS %s (
+			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			id VARCHAR(64) NOT NULL,
+			topic VARCHAR(255) NOT NULL,
+			header TEXT NOT NULL,
+			body BLOB,
+			created_at TIMESTAMP NOT NULL
+		)`,
+		CreateInbox: `CREATE TABLE IF NOT EXISTS %s (
+			id VARCHAR(64) PRIMARY KEY,
+			processed_at TIMESTAMP NOT NULL
+		)`,
+		InsertInbox: "INSERT OR IGNORE INTO %s (id, processed_at) VALUES (%s)",
+	}
+)
+
+// placeholders returns the placeholders of n arguments separated by commas
+func (d Dialect) placeholders(from, n int) string {
+	s := ""
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			s += ", "
+		}
+		s += d.Placeholder(from + i)
+	}
+	return s
+}
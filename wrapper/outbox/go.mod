@@ -0,0 +1,8 @@
+module github.com/micro/go-plugins/wrapper/outbox/v2
+
+go 1.13
+
+require (
+	github.com/mattn/go-sqlite3 v1.14.0
+	github.com/micro/go-micro/v2 v2.9.1
+)
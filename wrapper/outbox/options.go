@@ -0,0 +1,84 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+var (
+	// DefaultTable is the outbox table
+	DefaultTable = "micro_outbox"
+	// DefaultInboxTable is the table of processed messages
+	DefaultInboxTable = "micro_inbox"
+	// DefaultInterval is how often the relay polls the outbox
+	DefaultInterval = time.Second
+	// DefaultBatchSize is how many messages the relay publishes per transaction
+	DefaultBatchSize = 100
+	// IDKey is the header holding the id of a message
+	IDKey = "Micro-Outbox-Id"
+)
+
+type Options struct {
+	// Dialect is the sql dialect of the database
+	Dialect Dialect
+	// Table is the outbox table
+	Table string
+	// Inbox deduplicates received messages in the inbox table
+	Inbox bool
+	// InboxTable is the table of processed messages
+	InboxTable string
+	// Interval is how often the relay polls the outbox
+	Interval time.Duration
+	// BatchSize is how many messages the relay publishes per transaction
+	BatchSize int
+}
+
+type Option func(*Options)
+
+// WithDialect sets the sql dialect, Postgres by default
+func WithDialect(d Dialect) Option {
+	return func(o *Options) {
+		o.Dialect = d
+	}
+}
+
+// Table sets the outbox table
+func Table(name string) Option {
+	return func(o *Options) {
+		o.Table = name
+	}
+}
+
+// Inbox skips received messages whose id is in the inbox table and records
+// the ids of messages handled successfully
+func Inbox(table string) Option {
+	return func(o *Options) {
+		o.Inbox = true
+		if len(table) > 0 {
+			o.InboxTable = table
+		}
+	}
+}
+
+// Interval sets how often the relay polls the outbox
+func Interval(d time.Duration) Option {
+	return func(o *Options) {
+		o.Interval = d
+	}
+}
+
+// BatchSize sets how many messages the relay publishes per transaction
+func BatchSize(n int) Option {
+	return func(o *Options) {
+		o.BatchSize = n
+	}
+}
+
+type txKey struct{}
+
+// WithTx returns a context writing published messages to the outbox in the given
+// transaction, pass it to the publish e.g through client.Publish or broker.PublishContext
+func WithTx(ctx context.Context, tx *sql.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
@@ -0,0 +1,294 @@
+// Package outbox provides a broker wrapper which publishes messages through a transactional outbox
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+	log "github.com/micro/go-micro/v2/logger"
+)
+
+/*
+	Publishing writes the message to the outbox table, in the transaction of the
+	publish context if there is one, so the message is published if and only if the
+	transaction commits. The relay publishes pending messages in the order of their
+	sequence and deletes them in the same transaction which locked them, concurrent
+	relays wait on the lock so they take turns rather than overtake each other. The
+	sequence is assigned on insert, a transaction committing after a later one had
+	its messages relayed has its messages published after them, so messages are
+	ordered as written only within a transaction and between transactions which
+	don't overlap.
+
+	A relay crashing between the publish and the commit relays the message again,
+	messages carry a stable id and subscribers with the inbox enabled insert the id
+	into the inbox in a transaction around the handler. A redelivery conflicts with
+	the id and is skipped once the transaction committed, while a failed handler
+	rolls the id back so the message is processed again.
+*/
+
+type outboxBroker struct {
+	broker.Broker
+	db   *sql.DB
+	opts Options
+
+	sync.Mutex
+	exit   chan bool
+	done   chan bool
+	notify chan bool
+}
+
+type pending struct {
+	seq    int64
+	id     string
+	topic  string
+	header string
+	body   []byte
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// CreateTables creates the outbox table and the inbox table if enabled
+func (o *outboxBroker) CreateTables(ctx context.Context) error {
+	if _, err := o.db.ExecContext(ctx, fmt.Sprintf(o.opts.Dialect.CreateOutbox, o.opts.Table)); err != nil {
+		return err
+	}
+	if !o.opts.Inbox {
+		return nil
+	}
+	_, err := o.db.ExecContext(ctx, fmt.Sprintf(o.opts.Dialect.CreateInbox, o.opts.InboxTable))
+	return err
+}
+
+func (o *outboxBroker) Connect() error {
+	if err := o.Broker.Connect(); err != nil {
+		return err
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	if o.exit != nil {
+		return nil
+	}
+	o.exit = make(chan bool)
+	o.done = make(chan bool)
+	go o.relay(o.exit, o.done)
+	return nil
+}
+
+func (o *outboxBroker) Disconnect() error {
+	o.Lock()
+	if o.exit != nil {
+		close(o.exit)
+		<-o.done
+		o.exit = nil
+	}
+	o.Unlock()
+
+	return o.Broker.Disconnect()
+}
+
+// Publish writes the message to the outbox, the relay publishes it asynchronously
+func (o *outboxBroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	options := broker.PublishOptions{
+		Context: context.Background(),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	header := make(map[string]string, len(msg.Header)+1)
+	for k, v := range msg.Header {
+		header[k] = v
+	}
+	if len(header[IDKey]) == 0 {
+		header[IDKey] = newID()
+	}
+	hb, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	var ex execer = o.db
+	if tx, ok := options.Context.Value(txKey{}).(*sql.Tx); ok {
+		ex = tx
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (id, topic, header, body, created_at) VALUES (%s)",
+		o.opts.Table, o.opts.Dialect.placeholders(1, 5))
+	if _, err := ex.ExecContext(options.Context, query, header[IDKey], topic, string(hb), msg.Body, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	// wake the relay, messages of transactions are picked up once committed
+	select {
+	case o.notify <- true:
+	default:
+	}
+	return nil
+}
+
+func (o *outboxBroker) relay(exit, done chan bool) {
+	defer close(done)
+
+	t := time.NewTicker(o.opts.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-exit:
+			return
+		case <-t.C:
+		case <-o.notify:
+		}
+
+		// relay batches until the outbox is drained
+		for {
+			n, err := o.relayBatch()
+			if err != nil {
+				log.Errorf("[outbox] failed to relay messages: %v", err)
+				break
+			}
+			if n < o.opts.BatchSize {
+				break
+			}
+		}
+	}
+}
+
+// relayBatch publishes a batch of pending messages and returns how many it published
+func (o *outboxBroker) relayBatch() (int, error) {
+	ctx := context.Background()
+
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("SELECT seq, id, topic, header, body FROM %s ORDER BY seq LIMIT %d %s",
+		o.opts.Table, o.opts.BatchSize, o.opts.Dialect.Lock)
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	var batch []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.seq, &p.id, &p.topic, &p.header, &p.body); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	del := fmt.Sprintf("DELETE FROM %s WHERE seq = %s", o.opts.Table, o.opts.Dialect.Placeholder(1))
+
+	var published int
+	var perr error
+	for _, p := range batch {
+		var header map[string]string
+		if err := json.Unmarshal([]byte(p.header), &header); err != nil {
+			log.Errorf("[outbox] dropping message %s with invalid header: %v", p.id, err)
+		} else if perr = o.Broker.Publish(p.topic, &broker.Message{Header: header, Body: p.body}); perr != nil {
+			// keep the order, the rest of the batch is relayed on the next attempt
+			break
+		}
+		if _, err := tx.ExecContext(ctx, del, p.seq); err != nil {
+			return 0, err
+		}
+		published++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return published, perr
+}
+
+func (o *outboxBroker) Subscribe(topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	if !o.opts.Inbox {
+		return o.Broker.Subscribe(topic, h, opts...)
+	}
+
+	insert := fmt.Sprintf(o.opts.Dialect.InsertInbox, o.opts.InboxTable, o.opts.Dialect.placeholders(1, 2))
+
+	return o.Broker.Subscribe(topic, func(e broker.Event) error {
+		id := e.Message().Header[IDKey]
+		if len(id) == 0 {
+			return h(e)
+		}
+
+		ctx := context.Background()
+		tx, err := o.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		// a concurrent delivery of the message waits on the id until this one is done
+		res, err := tx.ExecContext(ctx, insert, id, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			// processed already
+			return nil
+		}
+
+		if err := h(e); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}, opts...)
+}
+
+// NewBroker returns a broker which writes published messages to the outbox table of
+// the database and relays them to the broker once connected. The returned broker
+// implements Tables
+func NewBroker(b broker.Broker, db *sql.DB, opts ...Option) broker.Broker {
+	options := Options{
+		Dialect:    Postgres,
+		Table:      DefaultTable,
+		InboxTable: DefaultInboxTable,
+		Interval:   DefaultInterval,
+		BatchSize:  DefaultBatchSize,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return &outboxBroker{
+		Broker: b,
+		db:     db,
+		opts:   options,
+		notify: make(chan bool, 1),
+	}
+}
+
+// Tables is implemented by the outbox broker to create its tables
+type Tables interface {
+	CreateTables(ctx context.Context) error
+}
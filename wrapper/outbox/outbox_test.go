@@ -0,0 +1,185 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+	"github.com/micro/go-micro/v2/broker/memory"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", "file::memory:?cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the in memory database lives as long as a connection to it
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func newBroker(t *testing.T, db *sql.DB, opts ...Option) (broker.Broker, broker.Broker) {
+	mb := memory.NewBroker()
+	b := NewBroker(mb, db, append([]Option{WithDialect(SQLite), Interval(10 * time.Millisecond)}, opts...)...)
+	if err := b.(Tables).CreateTables(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return b, mb
+}
+
+func TestPlaceholders(t *testing.T) {
+	testData := []struct {
+		dialect Dialect
+		from    int
+		n       int
+		expect  string
+	}{
+		{Postgres, 1, 5, "$1, $2, $3, $4, $5"},
+		{Postgres, 3, 2, "$3, $4"},
+		{MySQL, 1, 3, "?, ?, ?"},
+		{SQLite, 2, 1, "?"},
+		{SQLite, 1, 0, ""},
+	}
+
+	for _, d := range testData {
+		if s := d.dialect.placeholders(d.from, d.n); s != d.expect {
+			t.Fatalf("expected %q, got %q", d.expect, s)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	b := NewBroker(nil, nil, WithDialect(MySQL), Table("events"), Inbox(""), BatchSize(10))
+
+	o := b.(*outboxBroker).opts
+	if o.Table != "events" || o.BatchSize != 10 || o.Dialect.Placeholder(1) != "?" {
+		t.Fatalf("unexpected options %+v", o)
+	}
+	if !o.Inbox || o.InboxTable != DefaultInboxTable {
+		t.Fatalf("expected the inbox to be enabled with the default table, got %+v", o)
+	}
+	if _, ok := b.(Tables); !ok {
+		t.Fatal("expected the broker to implement Tables")
+	}
+}
+
+func TestNewID(t *testing.T) {
+	a, b := newID(), newID()
+	if len(a) != 32 || a == b {
+		t.Fatalf("expected unique ids, got %s and %s", a, b)
+	}
+}
+
+func TestRelay(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	b, mb := newBroker(t, db)
+	if err := mb.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	var mtx sync.Mutex
+	var received []string
+	if _, err := mb.Subscribe("orders", func(e broker.Event) error {
+		mtx.Lock()
+		received = append(received, string(e.Message().Body))
+		mtx.Unlock()
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// written before the relay runs, published in order once connected
+	for _, body := range []string{"1", "2", "3"} {
+		if err := b.Publish("orders", &broker.Message{Body: []byte(body)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Publish("orders", &broker.Message{Body: []byte("rolled back")}, broker.PublishContext(WithTx(context.Background(), tx))); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer b.Disconnect()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		mtx.Lock()
+		n := len(received)
+		mtx.Unlock()
+		if n >= 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if len(received) != 3 || received[0] != "1" || received[1] != "2" || received[2] != "3" {
+		t.Fatalf("expected messages 1, 2 and 3 in order, got %v", received)
+	}
+
+	var pending int
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + DefaultTable).Scan(&pending); err != nil {
+		t.Fatal(err)
+	}
+	if pending != 0 {
+		t.Fatalf("expected the outbox to be drained, got %d pending", pending)
+	}
+}
+
+func TestInbox(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	b, mb := newBroker(t, db, Inbox(""))
+	if err := mb.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+	fail := true
+	if _, err := b.Subscribe("orders", func(e broker.Event) error {
+		calls++
+		if fail {
+			fail = false
+			return errors.New("failed")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &broker.Message{Header: map[string]string{IDKey: "1"}}
+
+	// the failed delivery doesn't record the id, the redelivery is processed
+	mb.Publish("orders", msg)
+	if err := mb.Publish("orders", msg); err != nil {
+		t.Fatal(err)
+	}
+	// processed already
+	if err := mb.Publish("orders", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 2 {
+		t.Fatalf("expected the handler to be called twice, got %d", calls)
+	}
+}
@@ -0,0 +1,211 @@
+// Package profile provides wrappers which label handler goroutines for pprof
+package profile
+
+import (
+	"context"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/micro/go-micro/v2/server"
+)
+
+var (
+	// DefaultSampleInterval is the minimum interval between allocation samples of an endpoint
+	DefaultSampleInterval = time.Second
+
+	mu     sync.Mutex
+	allocs = make(map[string]*AllocStats)
+	// last sample of every endpoint
+	sampled = make(map[string]time.Time)
+
+	// requests in flight and started, the memory stats are process wide so
+	// samples are only recorded while a single request is served
+	inflight int64
+	started  uint64
+)
+
+// AllocStats holds the allocations recorded while serving an endpoint. Requests
+// are only sampled while no other request is in flight, allocations of goroutines
+// other than handlers, e.g. of the transport, are still counted
+type AllocStats struct {
+	// Requests is the number of requests sampled
+	Requests uint64
+	// Bytes is the cumulative number of bytes allocated
+	Bytes uint64
+	// Objects is the cumulative number of heap objects allocated
+	Objects uint64
+}
+
+type Options struct {
+	// Service overrides the service label, defaults to the request service for
+	// handlers and the server name for subscribers
+	Service string
+	// TrackAllocations records allocation deltas per endpoint
+	TrackAllocations bool
+	// SampleInterval is the minimum interval between allocation samples of an endpoint
+	SampleInterval time.Duration
+}
+
+type Option func(*Options)
+
+// ServiceName sets the value of the service label
+func ServiceName(name string) Option {
+	return func(o *Options) {
+		o.Service = name
+	}
+}
+
+// TrackAllocations toggles recording of per endpoint allocation deltas. Requests
+// are sampled at most once per sample interval and endpoint, as runtime.ReadMemStats
+// stops the world
+func TrackAllocations(b bool) Option {
+	return func(o *Options) {
+		o.TrackAllocations = b
+	}
+}
+
+// SampleInterval sets the minimum interval between allocation samples of an endpoint
+func SampleInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.SampleInterval = d
+	}
+}
+
+// Allocations returns a snapshot of the allocations recorded per endpoint
+func Allocations() map[string]AllocStats {
+	mu.Lock()
+	defer mu.Unlock()
+
+	stats := make(map[string]AllocStats, len(allocs))
+	for k, v := range allocs {
+		stats[k] = *v
+	}
+	return stats
+}
+
+// ResetAllocations clears the recorded allocations
+func ResetAllocations() {
+	mu.Lock()
+	allocs = make(map[string]*AllocStats)
+	sampled = make(map[string]time.Time)
+	mu.Unlock()
+}
+
+// sample reports whether a request of the endpoint is due to be sampled
+func sample(key string, interval time.Duration) bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	if last, ok := sampled[key]; ok && now.Sub(last) < interval {
+		return false
+	}
+	sampled[key] = now
+	return true
+}
+
+func record(key string, before, after *runtime.MemStats) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	s, ok := allocs[key]
+	if !ok {
+		s = &AllocStats{}
+		allocs[key] = s
+	}
+	s.Requests++
+	s.Bytes += after.TotalAlloc - before.TotalAlloc
+	s.Objects += after.Mallocs - before.Mallocs
+}
+
+// run executes fn with the given labels applied to the current goroutine
+func run(ctx context.Context, options Options, key string, labels pprof.LabelSet, fn func(context.Context) error) error {
+	var err error
+
+	n := atomic.AddUint64(&started, 1)
+	alone := atomic.AddInt64(&inflight, 1) == 1
+	defer atomic.AddInt64(&inflight, -1)
+
+	if !options.TrackAllocations || !alone || !sample(key, options.SampleInterval) {
+		pprof.Do(ctx, labels, func(ctx context.Context) {
+			err = fn(ctx)
+		})
+		return err
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	pprof.Do(ctx, labels, func(ctx context.Context) {
+		err = fn(ctx)
+	})
+	runtime.ReadMemStats(&after)
+
+	// the allocations of a request started in the meantime would be counted too
+	if atomic.LoadUint64(&started) == n {
+		record(key, &before, &after)
+	}
+
+	return err
+}
+
+// serverName returns the name of the server in the context, messages carry no
+// service so the default server, which services use unless passed another, is used
+func serverName(ctx context.Context) string {
+	if s, ok := server.FromContext(ctx); ok {
+		return s.Options().Name
+	}
+	return server.DefaultServer.Options().Name
+}
+
+// NewHandlerWrapper returns a handler wrapper which labels requests with the
+// service and endpoint being served
+func NewHandlerWrapper(opts ...Option) server.HandlerWrapper {
+	options := Options{
+		SampleInterval: DefaultSampleInterval,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return func(h server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, rsp interface{}) error {
+			service := options.Service
+			if len(service) == 0 {
+				service = req.Service()
+			}
+			labels := pprof.Labels("service", service, "endpoint", req.Endpoint())
+
+			return run(ctx, options, req.Endpoint(), labels, func(ctx context.Context) error {
+				return h(ctx, req, rsp)
+			})
+		}
+	}
+}
+
+// NewSubscriberWrapper returns a subscriber wrapper which labels messages with
+// the service and topic being handled
+func NewSubscriberWrapper(opts ...Option) server.SubscriberWrapper {
+	options := Options{
+		SampleInterval: DefaultSampleInterval,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return func(h server.SubscriberFunc) server.SubscriberFunc {
+		return func(ctx context.Context, msg server.Message) error {
+			service := options.Service
+			if len(service) == 0 {
+				service = serverName(ctx)
+			}
+			labels := pprof.Labels("service", service, "topic", msg.Topic())
+
+			return run(ctx, options, msg.Topic(), labels, func(ctx context.Context) error {
+				return h(ctx, msg)
+			})
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package profile
+
+import (
+	"context"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/micro/go-micro/v2/codec"
+	"github.com/micro/go-micro/v2/server"
+)
+
+type testMessage struct {
+	topic string
+}
+
+func (m *testMessage) Topic() string             { return m.topic }
+func (m *testMessage) Payload() interface{}      { return nil }
+func (m *testMessage) ContentType() string       { return "application/json" }
+func (m *testMessage) Header() map[string]string { return nil }
+func (m *testMessage) Body() []byte              { return nil }
+func (m *testMessage) Codec() codec.Reader       { return nil }
+
+func TestSubscriberWrapper(t *testing.T) {
+	ResetAllocations()
+
+	fn := func(ctx context.Context, msg server.Message) error {
+		if v, _ := pprof.Label(ctx, "topic"); v != "foo" {
+			t.Fatalf("expected topic label foo, got %q", v)
+		}
+		if v, _ := pprof.Label(ctx, "service"); v != "test" {
+			t.Fatalf("expected service label test, got %q", v)
+		}
+		_ = make([]byte, 1024)
+		return nil
+	}
+
+	w := NewSubscriberWrapper(ServiceName("test"), TrackAllocations(true))
+	for i := 0; i < 3; i++ {
+		if err := w(fn)(context.Background(), &testMessage{topic: "foo"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, ok := Allocations()["foo"]
+	if !ok {
+		t.Fatal("expected allocations to be recorded for foo")
+	}
+	if stats.Requests != 1 {
+		t.Fatalf("expected 1 sampled request, got %d", stats.Requests)
+	}
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	ResetAllocations()
+
+	// a request in flight makes the memory stats useless for others
+	block, done, exit := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	w := NewSubscriberWrapper(TrackAllocations(true))
+	go func() {
+		defer close(exit)
+		w(func(ctx context.Context, msg server.Message) error {
+			close(block)
+			<-done
+			return nil
+		})(context.Background(), &testMessage{topic: "bar"})
+	}()
+	<-block
+
+	fn := func(ctx context.Context, msg server.Message) error {
+		if v, _ := pprof.Label(ctx, "service"); v != server.DefaultServer.Options().Name {
+			t.Fatalf("expected the server name as service label, got %q", v)
+		}
+		return nil
+	}
+	if err := w(fn)(context.Background(), &testMessage{topic: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	close(done)
+	<-exit
+
+	if _, ok := Allocations()["foo"]; ok {
+		t.Fatal("expected no allocations to be recorded while another request is in flight")
+	}
+}
@@ -0,0 +1,269 @@
+// Package retry provides a client wrapper retrying and hedging calls by their error codes
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"time"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/errors"
+)
+
+/*
+	The wrapper retries calls failing with a retryable error code, with an exponential
+	backoff and full jitter between the attempts, up to MaxAttempts in total. The grpc
+	client turns grpc status errors into micro errors before any wrapper sees them, so
+	the policy is driven by micro error codes and works the same on any client. Errors
+	of the client failing to reach a node, 500s from go.micro.client, are retried too.
+	The client doesn't retry on its own while the wrapper does.
+
+	Calls to the endpoints set as idempotent are hedged: another attempt starts when
+	none replied within the hedge delay, the first reply wins and the others are
+	cancelled. Every attempt decodes into a response of its own, the winning one is
+	copied to the response of the call. Streams aren't retried.
+*/
+
+var (
+	// DefaultCodes are the error codes retried without Codes
+	DefaultCodes = []int32{408, 502, 503, 504}
+	// DefaultMaxAttempts is how many attempts a call gets without MaxAttempts
+	DefaultMaxAttempts = 3
+	// DefaultBackoff is the backoff before the first retry without Backoff
+	DefaultBackoff = 100 * time.Millisecond
+	// DefaultMaxBackoff is the longest backoff without Backoff
+	DefaultMaxBackoff = 2 * time.Second
+)
+
+type Options struct {
+	// Codes are the error codes retried
+	Codes []int32
+	// MaxAttempts is how many attempts a call gets, the first included
+	MaxAttempts int
+	// Backoff before the first retry, doubled after each attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// HedgeDelay is how long an attempt runs before another starts alongside
+	HedgeDelay time.Duration
+	// Idempotent endpoints are hedged, e.g Greeter.Hello
+	Idempotent []string
+}
+
+type Option func(*Options)
+
+// Codes sets the error codes retried
+func Codes(codes ...int32) Option {
+	return func(o *Options) {
+		o.Codes = codes
+	}
+}
+
+// MaxAttempts sets how many attempts a call gets, the first included
+func MaxAttempts(n int) Option {
+	return func(o *Options) {
+		o.MaxAttempts = n
+	}
+}
+
+// Backoff sets the backoff before the first retry and the longest one
+func Backoff(base, max time.Duration) Option {
+	return func(o *Options) {
+		o.Backoff = base
+		o.MaxBackoff = max
+	}
+}
+
+// Hedge starts another attempt of calls to the idempotent endpoints when none
+// replied within the delay
+func Hedge(delay time.Duration, endpoints ...string) Option {
+	return func(o *Options) {
+		o.HedgeDelay = delay
+		o.Idempotent = append(o.Idempotent, endpoints...)
+	}
+}
+
+type policyKey struct{}
+
+// WithPolicy is a call option overriding the options of the wrapper for the call
+func WithPolicy(opts ...Option) client.CallOption {
+	return func(o *client.CallOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, policyKey{}, opts)
+	}
+}
+
+// retryable tells if the error is worth another attempt
+func (o Options) retryable(err error) bool {
+	e := errors.Parse(err.Error())
+	if e.Code == 500 && e.Id == "go.micro.client" {
+		return true
+	}
+	for _, c := range o.Codes {
+		if e.Code == c {
+			return true
+		}
+	}
+	return false
+}
+
+// hedged tells if calls to the endpoint are hedged
+func (o Options) hedged(endpoint string) bool {
+	if o.HedgeDelay <= 0 {
+		return false
+	}
+	for _, ep := range o.Idempotent {
+		if ep == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the jittered backoff before the attempt following the attempts made
+func (o Options) backoff(attempts int) time.Duration {
+	d := o.Backoff
+	for i := 1; i < attempts && d < o.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > o.MaxBackoff {
+		d = o.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+type result struct {
+	rsp interface{}
+	err error
+}
+
+type retryClient struct {
+	client.Client
+	opts Options
+}
+
+// options returns the options of the wrapper overridden by those of the call
+func (r *retryClient) options(opts []client.CallOption) Options {
+	var co client.CallOptions
+	for _, o := range opts {
+		o(&co)
+	}
+	options := r.opts
+	if co.Context != nil {
+		policy, _ := co.Context.Value(policyKey{}).([]Option)
+		for _, o := range policy {
+			o(&options)
+		}
+	}
+	return options
+}
+
+func (r *retryClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	options := r.options(opts)
+	opts = append(opts, client.WithRetries(0))
+
+	if t := reflect.TypeOf(rsp); options.hedged(req.Endpoint()) && t != nil && t.Kind() == reflect.Ptr {
+		return r.hedge(ctx, req, rsp, options, opts)
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = r.Client.Call(ctx, req, rsp, opts...)
+		if err == nil || attempt >= options.MaxAttempts || !options.retryable(err) {
+			return err
+		}
+
+		t := time.NewTimer(options.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
+
+// hedge runs the attempts of the call alongside, the first reply wins
+func (r *retryClient) hedge(ctx context.Context, req client.Request, rsp interface{}, options Options, opts []client.CallOption) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan result, options.MaxAttempts)
+	var started, inFlight int
+	start := func() {
+		hrsp := reflect.New(reflect.TypeOf(rsp).Elem()).Interface()
+		started++
+		inFlight++
+		go func() {
+			results <- result{hrsp, r.Client.Call(ctx, req, hrsp, opts...)}
+		}()
+	}
+
+	start()
+	next := time.After(options.HedgeDelay)
+	done := ctx.Done()
+
+	var err error
+	for {
+		select {
+		case res := <-results:
+			inFlight--
+			if res.err == nil {
+				reflect.ValueOf(rsp).Elem().Set(reflect.ValueOf(res.rsp).Elem())
+				return nil
+			}
+			err = res.err
+			if !options.retryable(err) {
+				return err
+			}
+			if started >= options.MaxAttempts {
+				if inFlight == 0 {
+					return err
+				}
+				continue
+			}
+			if inFlight == 0 {
+				// nothing left to wait for, back off before the next attempt
+				next = time.After(options.backoff(started))
+			}
+		case <-next:
+			next = nil
+			if started < options.MaxAttempts {
+				start()
+				next = time.After(options.HedgeDelay)
+			}
+		case <-done:
+			if inFlight == 0 {
+				return err
+			}
+			// the attempts in flight fail with the context
+			done = nil
+		}
+	}
+}
+
+// NewClientWrapper returns a client wrapper retrying calls failing with the error
+// codes set, hedging those to idempotent endpoints
+func NewClientWrapper(opts ...Option) client.Wrapper {
+	options := Options{
+		Codes:       DefaultCodes,
+		MaxAttempts: DefaultMaxAttempts,
+		Backoff:     DefaultBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return func(c client.Client) client.Client {
+		return &retryClient{
+			Client: c,
+			opts:   options,
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package retry
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/client"
+	"github.com/micro/go-micro/v2/errors"
+)
+
+type testRequest struct {
+	client.Request
+	endpoint string
+}
+
+func (r *testRequest) Endpoint() string {
+	return r.endpoint
+}
+
+type testResponse struct {
+	Attempt int
+}
+
+// testClient replies to the attempts in order, with the error or after the delay of the attempt
+type testClient struct {
+	client.Client
+
+	sync.Mutex
+	errs    []error
+	delays  []time.Duration
+	retries []int
+	calls   int
+}
+
+func (c *testClient) Call(ctx context.Context, req client.Request, rsp interface{}, opts ...client.CallOption) error {
+	var co client.CallOptions
+	for _, o := range opts {
+		o(&co)
+	}
+
+	c.Lock()
+	attempt := c.calls
+	c.calls++
+	c.retries = append(c.retries, co.Retries)
+	var err error
+	if attempt < len(c.errs) {
+		err = c.errs[attempt]
+	}
+	var delay time.Duration
+	if attempt < len(c.delays) {
+		delay = c.delays[attempt]
+	}
+	c.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return errors.Timeout("go.micro.client", "%v", ctx.Err())
+	case <-time.After(delay):
+	}
+	if err != nil {
+		return err
+	}
+	rsp.(*testResponse).Attempt = attempt
+	return nil
+}
+
+func (c *testClient) count() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.calls
+}
+
+func TestRetry(t *testing.T) {
+	testData := []struct {
+		name     string
+		errs     []error
+		opts     []client.CallOption
+		calls    int
+		attempt  int
+		expected int32
+	}{
+		{"success", nil, nil, 1, 0, 0},
+		{"unavailable", []error{errors.New("foo", "down", 503)}, nil, 2, 1, 0},
+		{"unreachable", []error{errors.InternalServerError("go.micro.client", "connection error")}, nil, 2, 1, 0},
+		{"application error", []error{errors.BadRequest("foo", "invalid")}, nil, 1, 0, 400},
+		{"internal error", []error{errors.InternalServerError("foo", "failed")}, nil, 1, 0, 500},
+		{"max attempts", []error{
+			errors.New("foo", "down", 503),
+			errors.New("foo", "down", 503),
+			errors.New("foo", "down", 503),
+		}, nil, 3, 0, 503},
+		{"call policy", []error{errors.BadRequest("foo", "invalid")}, []client.CallOption{WithPolicy(Codes(400))}, 2, 1, 0},
+	}
+
+	for _, d := range testData {
+		c := &testClient{errs: d.errs}
+		w := NewClientWrapper(Backoff(time.Millisecond, 5*time.Millisecond))(c)
+
+		var rsp testResponse
+		err := w.Call(context.Background(), &testRequest{endpoint: "Foo.Bar"}, &rsp, d.opts...)
+		if d.expected == 0 && err != nil {
+			t.Fatalf("%s: unexpected error %v", d.name, err)
+		}
+		if d.expected != 0 && (err == nil || errors.Parse(err.Error()).Code != d.expected) {
+			t.Fatalf("%s: expected code %d, got %v", d.name, d.expected, err)
+		}
+		if c.calls != d.calls {
+			t.Fatalf("%s: expected %d calls, got %d", d.name, d.calls, c.calls)
+		}
+		if err == nil && rsp.Attempt != d.attempt {
+			t.Fatalf("%s: expected the reply of attempt %d, got %d", d.name, d.attempt, rsp.Attempt)
+		}
+		for _, r := range c.retries {
+			if r != 0 {
+				t.Fatalf("%s: expected the client not to retry, got %d retries", d.name, r)
+			}
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	o := Options{Backoff: 10 * time.Millisecond, MaxBackoff: 25 * time.Millisecond}
+	expected := map[int]time.Duration{
+		1: 10 * time.Millisecond,
+		2: 20 * time.Millisecond,
+		3: 25 * time.Millisecond,
+		4: 25 * time.Millisecond,
+	}
+	for attempts, max := range expected {
+		for i := 0; i < 20; i++ {
+			if d := o.backoff(attempts); d <= 0 || d > max {
+				t.Fatalf("expected a backoff up to %v after %d attempts, got %v", max, attempts, d)
+			}
+		}
+	}
+}
+
+func TestHedge(t *testing.T) {
+	// the first attempt hangs, the hedged one replies
+	c := &testClient{delays: []time.Duration{time.Second, 0}}
+	w := NewClientWrapper(Hedge(20*time.Millisecond, "Foo.Get"))(c)
+
+	var rsp testResponse
+	start := time.Now()
+	if err := w.Call(context.Background(), &testRequest{endpoint: "Foo.Get"}, &rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Attempt != 1 {
+		t.Fatalf("expected the reply of the hedged attempt, got %d", rsp.Attempt)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("expected the hedged attempt to win")
+	}
+
+	// endpoints which aren't idempotent are never hedged
+	c = &testClient{delays: []time.Duration{50 * time.Millisecond}}
+	w = NewClientWrapper(Hedge(10*time.Millisecond, "Foo.Get"))(c)
+	if err := w.Call(context.Background(), &testRequest{endpoint: "Foo.Update"}, &rsp); err != nil {
+		t.Fatal(err)
+	}
+	if n := c.count(); n != 1 {
+		t.Fatalf("expected a single attempt, got %d", n)
+	}
+
+	// failed attempts are retried while hedging, up to the max attempts
+	c = &testClient{errs: []error{
+		errors.New("foo", "down", 503),
+		errors.New("foo", "down", 503),
+		errors.New("foo", "down", 503),
+	}}
+	w = NewClientWrapper(Hedge(time.Second, "Foo.Get"), Backoff(time.Millisecond, time.Millisecond))(c)
+	err := w.Call(context.Background(), &testRequest{endpoint: "Foo.Get"}, &rsp)
+	if err == nil || errors.Parse(err.Error()).Code != 503 {
+		t.Fatalf("expected the error of the last attempt, got %v", err)
+	}
+	if n := c.count(); n != 3 {
+		t.Fatalf("expected 3 attempts, got %d", n)
+	}
+}
@@ -0,0 +1,176 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultTTL is how long the latest schema of a subject is cached
+	DefaultTTL = time.Minute
+)
+
+// Schema is a registered schema
+type Schema struct {
+	ID int
+	// Type is the schema type e.g JSON, AVRO or PROTOBUF
+	Type string
+	// Schema is the schema definition
+	Schema string
+}
+
+// Registry looks up schemas
+type Registry interface {
+	// Schema returns the schema with the given id
+	Schema(ctx context.Context, id int) (*Schema, error)
+	// Latest returns the latest schema registered for the subject
+	Latest(ctx context.Context, subject string) (*Schema, error)
+}
+
+type latest struct {
+	s       *Schema
+	fetched time.Time
+}
+
+// confluentRegistry is a client of the Confluent Schema Registry REST API
+type confluentRegistry struct {
+	url      string
+	client   *http.Client
+	user     string
+	password string
+
+	sync.RWMutex
+	ids      map[int]*Schema
+	subjects map[string]latest
+}
+
+type schemaResponse struct {
+	ID         int    `json:"id"`
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType"`
+}
+
+type errorResponse struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// RegistryOption configures the confluent registry client
+type RegistryOption func(*confluentRegistry)
+
+// BasicAuth sets the credentials of the schema registry
+func BasicAuth(user, password string) RegistryOption {
+	return func(r *confluentRegistry) {
+		r.user = user
+		r.password = password
+	}
+}
+
+// HTTPClient sets the http client used to talk to the schema registry
+func HTTPClient(c *http.Client) RegistryOption {
+	return func(r *confluentRegistry) {
+		r.client = c
+	}
+}
+
+// NewConfluentRegistry returns a client of the Confluent Schema Registry at the given url.
+// Schemas are immutable and cached forever, the latest schema of subjects for DefaultTTL
+func NewConfluentRegistry(addr string, opts ...RegistryOption) Registry {
+	r := &confluentRegistry{
+		url:      strings.TrimSuffix(addr, "/"),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		ids:      make(map[int]*Schema),
+		subjects: make(map[string]latest),
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+func (r *confluentRegistry) get(ctx context.Context, path string) (*Schema, error) {
+	req, err := http.NewRequest(http.MethodGet, r.url+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if len(r.user) > 0 {
+		req.SetBasicAuth(r.user, r.password)
+	}
+
+	rsp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		var e errorResponse
+		if err := json.NewDecoder(rsp.Body).Decode(&e); err == nil && len(e.Message) > 0 {
+			return nil, fmt.Errorf("schema registry: %s (%d)", e.Message, e.ErrorCode)
+		}
+		return nil, fmt.Errorf("schema registry: %s", rsp.Status)
+	}
+
+	var sr schemaResponse
+	if err := json.NewDecoder(rsp.Body).Decode(&sr); err != nil {
+		return nil, err
+	}
+
+	// the type is omitted for avro schemas
+	if len(sr.SchemaType) == 0 {
+		sr.SchemaType = "AVRO"
+	}
+	return &Schema{
+		ID:     sr.ID,
+		Type:   sr.SchemaType,
+		Schema: sr.Schema,
+	}, nil
+}
+
+func (r *confluentRegistry) Schema(ctx context.Context, id int) (*Schema, error) {
+	r.RLock()
+	s, ok := r.ids[id]
+	r.RUnlock()
+	if ok {
+		return s, nil
+	}
+
+	s, err := r.get(ctx, fmt.Sprintf("/schemas/ids/%d", id))
+	if err != nil {
+		return nil, err
+	}
+	s.ID = id
+
+	r.Lock()
+	r.ids[id] = s
+	r.Unlock()
+	return s, nil
+}
+
+func (r *confluentRegistry) Latest(ctx context.Context, subject string) (*Schema, error) {
+	r.RLock()
+	l, ok := r.subjects[subject]
+	r.RUnlock()
+	if ok && time.Since(l.fetched) < DefaultTTL {
+		return l.s, nil
+	}
+
+	s, err := r.get(ctx, "/subjects/"+url.PathEscape(subject)+"/versions/latest")
+	if err != nil {
+		return nil, err
+	}
+
+	r.Lock()
+	r.ids[s.ID] = s
+	r.subjects[subject] = latest{s: s, fetched: time.Now()}
+	r.Unlock()
+	return s, nil
+}
@@ -0,0 +1,267 @@
+// Package schema provides a broker wrapper which validates messages against schemas of a schema registry
+package schema
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/micro/go-micro/v2/broker"
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+/*
+	Publishers validate the body against the latest schema of the subject of the
+	topic and frame it in the Confluent wire format, a zero magic byte and the big
+	endian schema id ahead of the payload, so the messages can be read by other
+	clients of the registry. Subscribers validate the payload against the schema
+	of the frame and pass the unframed payload to the handler, so messages of
+	publishers which don't validate or use an unknown schema are caught before it.
+	Rejected messages are dead-lettered when a dead-letter topic is set and failed
+	otherwise, leaving it to the broker to redeliver or drop them.
+*/
+
+var (
+	// DefaultErrorKey is the header holding why a dead-lettered message was rejected
+	DefaultErrorKey = "Micro-Schema-Error"
+
+	// ErrNoSchema is returned for messages which aren't framed with a schema id
+	ErrNoSchema = errors.New("message has no schema id")
+	// ErrNoRegistry is returned when no schema registry was set
+	ErrNoRegistry = errors.New("no schema registry")
+)
+
+// Validator validates a body against a schema definition
+type Validator func(schema string, body []byte) error
+
+type Options struct {
+	// Registry is where schemas are looked up
+	Registry Registry
+	// Subject returns the subject of the topic
+	Subject func(topic string) string
+	// Validators maps schema types to their validator
+	Validators map[string]Validator
+	// DeadLetter returns the dead-letter topic of the topic, empty to fail rejected messages
+	DeadLetter func(topic string) string
+	// AllowUntagged passes messages without a schema id to the handler
+	AllowUntagged bool
+}
+
+type Option func(*Options)
+
+// WithRegistry sets the schema registry
+func WithRegistry(r Registry) Option {
+	return func(o *Options) {
+		o.Registry = r
+	}
+}
+
+// Subject sets the func returning the subject of a topic, by default topic-value
+func Subject(fn func(topic string) string) Option {
+	return func(o *Options) {
+		o.Subject = fn
+	}
+}
+
+// WithValidator sets the validator of a schema type e.g AVRO
+func WithValidator(schemaType string, v Validator) Option {
+	return func(o *Options) {
+		o.Validators[schemaType] = v
+	}
+}
+
+// DeadLetter publishes rejected messages to the topic returned by fn instead of failing them
+func DeadLetter(fn func(topic string) string) Option {
+	return func(o *Options) {
+		o.DeadLetter = fn
+	}
+}
+
+// AllowUntagged passes messages without a schema id to the handler without validation
+func AllowUntagged() Option {
+	return func(o *Options) {
+		o.AllowUntagged = true
+	}
+}
+
+type schemaBroker struct {
+	broker.Broker
+	opts Options
+
+	sync.RWMutex
+	// compiled json schemas by id
+	compiled map[int]*gojsonschema.Schema
+}
+
+// validateJSON is the validator of json schemas, compiled schemas are cached by id
+func (s *schemaBroker) validateJSON(sc *Schema, body []byte) error {
+	s.RLock()
+	js, ok := s.compiled[sc.ID]
+	s.RUnlock()
+
+	if !ok {
+		var err error
+		js, err = gojsonschema.NewSchema(gojsonschema.NewStringLoader(sc.Schema))
+		if err != nil {
+			return fmt.Errorf("invalid schema %d: %v", sc.ID, err)
+		}
+		s.Lock()
+		s.compiled[sc.ID] = js
+		s.Unlock()
+	}
+
+	res, err := js.Validate(gojsonschema.NewBytesLoader(body))
+	if err != nil {
+		return err
+	}
+	if res.Valid() {
+		return nil
+	}
+
+	var errs []string
+	for _, e := range res.Errors() {
+		errs = append(errs, e.String())
+	}
+	return errors.New(strings.Join(errs, "; "))
+}
+
+func (s *schemaBroker) validate(sc *Schema, body []byte) error {
+	if v, ok := s.opts.Validators[sc.Type]; ok {
+		return v(sc.Schema, body)
+	}
+	if sc.Type == "JSON" {
+		return s.validateJSON(sc, body)
+	}
+	return fmt.Errorf("no validator for %s schema %d", sc.Type, sc.ID)
+}
+
+func (s *schemaBroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	options := broker.PublishOptions{
+		Context: context.Background(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	if s.opts.Registry == nil {
+		return ErrNoRegistry
+	}
+
+	sc, err := s.opts.Registry.Latest(options.Context, s.opts.Subject(topic))
+	if err != nil {
+		return err
+	}
+	if err := s.validate(sc, msg.Body); err != nil {
+		return fmt.Errorf("message does not conform to schema %d of %s: %v", sc.ID, topic, err)
+	}
+
+	return s.Broker.Publish(topic, &broker.Message{
+		Header: msg.Header,
+		Body:   frame(sc.ID, msg.Body),
+	}, opts...)
+}
+
+// frame prepends the magic byte and schema id of the Confluent wire format to the payload
+func frame(id int, payload []byte) []byte {
+	b := make([]byte, 5+len(payload))
+	binary.BigEndian.PutUint32(b[1:5], uint32(id))
+	copy(b[5:], payload)
+	return b
+}
+
+// unframe splits a body in the Confluent wire format into the schema id and payload
+func unframe(b []byte) (int, []byte, bool) {
+	if len(b) < 5 || b[0] != 0 {
+		return 0, nil, false
+	}
+	return int(binary.BigEndian.Uint32(b[1:5])), b[5:], true
+}
+
+// check validates the message against the schema of its frame, returning the payload
+func (s *schemaBroker) check(m *broker.Message) ([]byte, error) {
+	id, payload, ok := unframe(m.Body)
+	if !ok {
+		if s.opts.AllowUntagged {
+			return m.Body, nil
+		}
+		return nil, ErrNoSchema
+	}
+
+	if s.opts.Registry == nil {
+		return nil, ErrNoRegistry
+	}
+
+	sc, err := s.opts.Registry.Schema(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validate(sc, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// event passes the unframed payload of a message to the handler
+type event struct {
+	broker.Event
+	m *broker.Message
+}
+
+func (e *event) Message() *broker.Message {
+	return e.m
+}
+
+func (s *schemaBroker) Subscribe(topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	return s.Broker.Subscribe(topic, func(e broker.Event) error {
+		m := e.Message()
+		payload, err := s.check(m)
+		if err == nil {
+			return h(&event{
+				Event: e,
+				m:     &broker.Message{Header: m.Header, Body: payload},
+			})
+		}
+
+		log.Warnf("[schema] rejected message on %s: %v", topic, err)
+
+		if s.opts.DeadLetter == nil {
+			return err
+		}
+
+		header := make(map[string]string, len(m.Header)+1)
+		for k, v := range m.Header {
+			header[k] = v
+		}
+		header[DefaultErrorKey] = err.Error()
+
+		// dead-letter through the wrapped broker, the message failed validation already
+		return s.Broker.Publish(s.opts.DeadLetter(topic), &broker.Message{
+			Header: header,
+			Body:   m.Body,
+		})
+	}, opts...)
+}
+
+// NewBroker returns a broker validating published and received messages against
+// the schemas of the registry
+func NewBroker(b broker.Broker, opts ...Option) broker.Broker {
+	options := Options{
+		Subject: func(topic string) string {
+			return topic + "-value"
+		},
+		Validators: make(map[string]Validator),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return &schemaBroker{
+		Broker:   b,
+		opts:     options,
+		compiled: make(map[int]*gojsonschema.Schema),
+	}
+}
@@ -0,0 +1,105 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micro/go-micro/v2/broker"
+	"github.com/micro/go-micro/v2/broker/memory"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"properties": {"id": {"type": "string"}},
+	"required": ["id"]
+}`
+
+func newRegistry(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/subjects/orders-value/versions/latest":
+			json.NewEncoder(w).Encode(schemaResponse{ID: 7, Schema: orderSchema, SchemaType: "JSON"})
+		case "/schemas/ids/7":
+			json.NewEncoder(w).Encode(schemaResponse{Schema: orderSchema, SchemaType: "JSON"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(errorResponse{ErrorCode: 40403, Message: "Schema not found"})
+		}
+	}))
+}
+
+func TestBroker(t *testing.T) {
+	srv := newRegistry(t)
+	defer srv.Close()
+
+	mb := memory.NewBroker()
+	if err := mb.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer mb.Disconnect()
+
+	b := NewBroker(mb,
+		WithRegistry(NewConfluentRegistry(srv.URL)),
+		DeadLetter(func(topic string) string {
+			return topic + ".dlq"
+		}),
+	)
+
+	var received, deadLettered []*broker.Message
+	if _, err := b.Subscribe("orders", func(e broker.Event) error {
+		received = append(received, e.Message())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mb.Subscribe("orders.dlq", func(e broker.Event) error {
+		deadLettered = append(deadLettered, e.Message())
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Publish("orders", &broker.Message{Body: []byte(`{"id": "1"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Publish("orders", &broker.Message{Body: []byte(`{"name": "1"}`)}); err == nil {
+		t.Fatal("expected message without id to be rejected on publish")
+	}
+	if err := b.Publish("invoices", &broker.Message{Body: []byte(`{}`)}); err == nil {
+		t.Fatal("expected topic without schema to be rejected on publish")
+	}
+
+	// publishers bypassing the validation are caught by subscribers
+	if err := mb.Publish("orders", &broker.Message{Body: []byte(`{"id": "2"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mb.Publish("orders", &broker.Message{Body: frame(7, []byte(`{"id": 3}`))}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received) != 1 || string(received[0].Body) != `{"id": "1"}` {
+		t.Fatalf("unexpected received messages %+v", received)
+	}
+	if len(deadLettered) != 2 || len(deadLettered[0].Header[DefaultErrorKey]) == 0 {
+		t.Fatalf("unexpected dead-lettered messages %+v", deadLettered)
+	}
+}
+
+func TestFrame(t *testing.T) {
+	b := frame(7, []byte(`{}`))
+	if !bytes.Equal(b, []byte{0, 0, 0, 0, 7, '{', '}'}) {
+		t.Fatalf("unexpected frame %v", b)
+	}
+
+	id, payload, ok := unframe(b)
+	if !ok || id != 7 || string(payload) != `{}` {
+		t.Fatalf("unexpected unframe %d %q %v", id, payload, ok)
+	}
+
+	if _, _, ok := unframe([]byte(`{"id": "1"}`)); ok {
+		t.Fatal("expected unframed body to have no schema id")
+	}
+}
@@ -0,0 +1,206 @@
+// Package streamlimit provides a handler wrapper which limits the cost of streaming requests
+package streamlimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/micro/go-micro/v2/errors"
+	"github.com/micro/go-micro/v2/server"
+)
+
+var (
+	// ErrMaxFrames is returned once a stream sent and received more frames than allowed
+	ErrMaxFrames = errors.New("go.micro.server", "stream exceeded max frames", 429)
+	// ErrMaxBytes is returned once a stream transferred more bytes than allowed
+	ErrMaxBytes = errors.New("go.micro.server", "stream exceeded max bytes", 429)
+	// ErrMaxDuration is returned once a stream was open for longer than allowed
+	ErrMaxDuration = errors.New("go.micro.server", "stream exceeded max duration", 408)
+)
+
+type Options struct {
+	// MaxFrames is the number of messages sent and received, 0 is unlimited
+	MaxFrames int64
+	// MaxBytes is the cumulative size of proto messages sent and received, 0 is unlimited
+	MaxBytes int64
+	// MaxDuration is how long the stream may stay open, 0 is unlimited
+	MaxDuration time.Duration
+}
+
+type Option func(*Options)
+
+// MaxFrames limits the number of frames sent and received on a stream
+func MaxFrames(n int64) Option {
+	return func(o *Options) {
+		o.MaxFrames = n
+	}
+}
+
+// MaxBytes limits the cumulative size of messages sent and received on a stream.
+// Only proto messages and byte slices are counted
+func MaxBytes(n int64) Option {
+	return func(o *Options) {
+		o.MaxBytes = n
+	}
+}
+
+// MaxDuration limits how long a stream may stay open. The handler context is
+// cancelled and the stream closed once the duration passes, so handlers blocked
+// in Recv or Send return
+func MaxDuration(d time.Duration) Option {
+	return func(o *Options) {
+		o.MaxDuration = d
+	}
+}
+
+type stream struct {
+	server.Stream
+	ctx  context.Context
+	opts Options
+	// parent is the context of the request, its own deadline isn't the max duration
+	parent context.Context
+
+	mtx    sync.Mutex
+	frames int64
+	bytes  int64
+	err    error
+}
+
+func size(msg interface{}) int64 {
+	switch m := msg.(type) {
+	case proto.Message:
+		return int64(proto.Size(m))
+	case []byte:
+		return int64(len(m))
+	case *[]byte:
+		return int64(len(*m))
+	}
+	return 0
+}
+
+// timedOut reports whether the max duration passed, rather than a deadline of the request
+func (s *stream) timedOut() bool {
+	return s.ctx.Err() == context.DeadlineExceeded && s.parent.Err() == nil
+}
+
+// check records a frame and returns the limit it exceeded, if any
+func (s *stream) check(msg interface{}) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	if s.timedOut() {
+		s.err = ErrMaxDuration
+		return s.err
+	}
+
+	s.frames++
+	if s.opts.MaxFrames > 0 && s.frames > s.opts.MaxFrames {
+		s.err = ErrMaxFrames
+		return s.err
+	}
+
+	s.bytes += size(msg)
+	if s.opts.MaxBytes > 0 && s.bytes > s.opts.MaxBytes {
+		s.err = ErrMaxBytes
+		return s.err
+	}
+
+	return nil
+}
+
+func (s *stream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *stream) Send(msg interface{}) error {
+	if err := s.check(msg); err != nil {
+		return err
+	}
+	if err := s.Stream.Send(msg); err != nil {
+		if lerr := s.exceeded(); lerr != nil {
+			return lerr
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *stream) Recv(msg interface{}) error {
+	if err := s.Stream.Recv(msg); err != nil {
+		// the stream was closed as it ran out of time
+		if lerr := s.exceeded(); lerr != nil {
+			return lerr
+		}
+		return err
+	}
+	return s.check(msg)
+}
+
+// expire ends the stream once the max duration passed, handlers blocked in Recv
+// or Send don't watch the context and only return once the stream is closed
+func (s *stream) expire() {
+	s.mtx.Lock()
+	if s.err == nil {
+		s.err = ErrMaxDuration
+	}
+	s.mtx.Unlock()
+	s.Stream.Close()
+}
+
+// exceeded returns the limit the stream ran into, if any
+func (s *stream) exceeded() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.err == nil && s.timedOut() {
+		s.err = ErrMaxDuration
+	}
+	return s.err
+}
+
+// NewHandlerWrapper returns a handler wrapper which terminates streams exceeding
+// the configured limits. Unary requests are passed through untouched
+func NewHandlerWrapper(opts ...Option) server.HandlerWrapper {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return func(h server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, rsp interface{}) error {
+			st, ok := rsp.(server.Stream)
+			if !req.Stream() || !ok {
+				return h(ctx, req, rsp)
+			}
+
+			parent := ctx
+			if options.MaxDuration > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, options.MaxDuration)
+				defer cancel()
+			}
+
+			s := &stream{
+				Stream: st,
+				ctx:    ctx,
+				opts:   options,
+				parent: parent,
+			}
+			if options.MaxDuration > 0 {
+				t := time.AfterFunc(options.MaxDuration, s.expire)
+				defer t.Stop()
+			}
+
+			err := h(ctx, req, s)
+			if lerr := s.exceeded(); lerr != nil {
+				return lerr
+			}
+			return err
+		}
+	}
+}
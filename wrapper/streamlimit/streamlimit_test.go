@@ -0,0 +1,115 @@
+package streamlimit
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/server"
+)
+
+type testRequest struct {
+	server.Request
+}
+
+func (r *testRequest) Stream() bool {
+	return true
+}
+
+type testStream struct {
+	server.Stream
+	sent   int
+	closed chan bool
+}
+
+func newTestStream() *testStream {
+	return &testStream{closed: make(chan bool)}
+}
+
+func (s *testStream) Send(msg interface{}) error {
+	s.sent++
+	return nil
+}
+
+// Recv blocks until the stream is closed
+func (s *testStream) Recv(msg interface{}) error {
+	<-s.closed
+	return io.EOF
+}
+
+func (s *testStream) Close() error {
+	close(s.closed)
+	return nil
+}
+
+func TestMaxFrames(t *testing.T) {
+	st := newTestStream()
+	fn := func(ctx context.Context, req server.Request, rsp interface{}) error {
+		stream := rsp.(server.Stream)
+		for i := 0; i < 3; i++ {
+			if err := stream.Send([]byte("frame")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := NewHandlerWrapper(MaxFrames(2))(fn)(context.Background(), &testRequest{}, st)
+	if err != ErrMaxFrames {
+		t.Fatalf("expected %v got %v", ErrMaxFrames, err)
+	}
+	if st.sent != 2 {
+		t.Fatalf("expected 2 frames to be sent got %d", st.sent)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	fn := func(ctx context.Context, req server.Request, rsp interface{}) error {
+		return rsp.(server.Stream).Send(make([]byte, 11))
+	}
+
+	err := NewHandlerWrapper(MaxBytes(10))(fn)(context.Background(), &testRequest{}, newTestStream())
+	if err != ErrMaxBytes {
+		t.Fatalf("expected %v got %v", ErrMaxBytes, err)
+	}
+}
+
+func TestMaxDuration(t *testing.T) {
+	fn := func(ctx context.Context, req server.Request, rsp interface{}) error {
+		<-ctx.Done()
+		return nil
+	}
+
+	err := NewHandlerWrapper(MaxDuration(10*time.Millisecond))(fn)(context.Background(), &testRequest{}, newTestStream())
+	if err != ErrMaxDuration {
+		t.Fatalf("expected %v got %v", ErrMaxDuration, err)
+	}
+}
+
+func TestParentDeadline(t *testing.T) {
+	fn := func(ctx context.Context, req server.Request, rsp interface{}) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := NewHandlerWrapper(MaxDuration(time.Second))(fn)(ctx, &testRequest{}, newTestStream())
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected %v got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestMaxDurationRecv(t *testing.T) {
+	fn := func(ctx context.Context, req server.Request, rsp interface{}) error {
+		var msg []byte
+		return rsp.(server.Stream).Recv(&msg)
+	}
+
+	err := NewHandlerWrapper(MaxDuration(10*time.Millisecond))(fn)(context.Background(), &testRequest{}, newTestStream())
+	if err != ErrMaxDuration {
+		t.Fatalf("expected %v got %v", ErrMaxDuration, err)
+	}
+}
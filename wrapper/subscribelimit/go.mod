@@ -0,0 +1,5 @@
+module github.com/micro/go-plugins/wrapper/subscribelimit/v2
+
+go 1.13
+
+require github.com/micro/go-micro/v2 v2.9.1
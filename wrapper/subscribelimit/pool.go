@@ -0,0 +1,77 @@
+package subscribelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Pool limits how many handlers run at once and how many messages they are passed
+// per second. A pool may be shared by several subscriptions to limit them together
+type Pool struct {
+	sem    chan struct{}
+	bucket *bucket
+}
+
+// bucket is a token bucket refilled at rate tokens per second up to burst
+type bucket struct {
+	sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// wait takes a token, waiting for it to be refilled when the bucket is empty
+func (b *bucket) wait() {
+	b.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	// reserve the token, callers queue up behind each other
+	b.tokens--
+	tokens := b.tokens
+	b.Unlock()
+
+	if tokens < 0 {
+		time.Sleep(time.Duration(-tokens / b.rate * float64(time.Second)))
+	}
+}
+
+// Do runs fn once a handler slot and a token are available
+func (p *Pool) Do(fn func() error) error {
+	if p.bucket != nil {
+		p.bucket.wait()
+	}
+	if p.sem != nil {
+		p.sem <- struct{}{}
+		defer func() {
+			<-p.sem
+		}()
+	}
+	return fn()
+}
+
+// NewPool returns a pool running up to concurrency handlers at once, passing them
+// up to rate messages per second with bursts of up to burst messages. A limit of
+// 0 is unlimited
+func NewPool(concurrency int, rate float64, burst int) *Pool {
+	p := new(Pool)
+	if concurrency > 0 {
+		p.sem = make(chan struct{}, concurrency)
+	}
+	if rate > 0 {
+		if burst < 1 {
+			burst = 1
+		}
+		p.bucket = &bucket{
+			rate:   rate,
+			burst:  float64(burst),
+			tokens: float64(burst),
+			last:   time.Now(),
+		}
+	}
+	return p
+}
@@ -0,0 +1,52 @@
+package subscribelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolConcurrency(t *testing.T) {
+	p := NewPool(2, 0, 0)
+
+	var running, max int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Do(func() error {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&max)
+					if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				atomic.AddInt32(&running, -1)
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	if max != 2 {
+		t.Fatalf("expected 2 handlers to run at once, got %d", max)
+	}
+}
+
+func TestPoolRate(t *testing.T) {
+	p := NewPool(0, 100, 5)
+
+	start := time.Now()
+	for i := 0; i < 15; i++ {
+		p.Do(func() error { return nil })
+	}
+
+	// the burst is free, the other 10 messages take 100ms
+	if d := time.Since(start); d < 90*time.Millisecond || d > 500*time.Millisecond {
+		t.Fatalf("expected 15 messages to take about 100ms, took %v", d)
+	}
+}
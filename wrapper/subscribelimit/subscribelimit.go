@@ -0,0 +1,135 @@
+// Package subscribelimit provides a broker wrapper which limits the concurrency and rate of subscribers
+package subscribelimit
+
+import (
+	"context"
+
+	"github.com/micro/go-micro/v2/broker"
+)
+
+/*
+	Handlers wait for a slot of the pool before they run, blocking the delivery of
+	the broker rather than queueing messages in memory. Brokers which deliver from
+	a loop, like the kafka partition consumers, stop fetching until a slot frees up
+	so a burst is left on the broker instead of spinning up a goroutine per message.
+	Waiting for a token happens before taking a slot so rate limited handlers don't
+	hold slots idle.
+*/
+
+type concurrencyKey struct{}
+type rateKey struct{}
+type poolKey struct{}
+
+type rateLimit struct {
+	rate  float64
+	burst int
+}
+
+type Options struct {
+	// Concurrency is how many handlers of a subscription run at once, 0 is unlimited
+	Concurrency int
+	// Rate is how many messages per second a subscription handles, 0 is unlimited
+	Rate float64
+	// Burst is how many messages a subscription handles at once after being idle
+	Burst int
+}
+
+type Option func(*Options)
+
+// Concurrency sets how many handlers of a subscription run at once, for every
+// subscription without a limit of its own
+func Concurrency(n int) Option {
+	return func(o *Options) {
+		o.Concurrency = n
+	}
+}
+
+// Rate sets how many messages per second a subscription handles, for every
+// subscription without a limit of its own
+func Rate(perSecond float64, burst int) Option {
+	return func(o *Options) {
+		o.Rate = perSecond
+		o.Burst = burst
+	}
+}
+
+func setSubscribeOption(k, v interface{}) broker.SubscribeOption {
+	return func(o *broker.SubscribeOptions) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
+
+// MaxConcurrent limits how many handlers of the subscription run at once
+func MaxConcurrent(n int) broker.SubscribeOption {
+	return setSubscribeOption(concurrencyKey{}, n)
+}
+
+// MaxRate limits how many messages per second the subscription handles, with
+// bursts of up to burst messages after being idle
+func MaxRate(perSecond float64, burst int) broker.SubscribeOption {
+	return setSubscribeOption(rateKey{}, rateLimit{perSecond, burst})
+}
+
+// WithPool limits the subscription with the given pool, shared with the other
+// subscriptions using it. Overrides MaxConcurrent and MaxRate
+func WithPool(p *Pool) broker.SubscribeOption {
+	return setSubscribeOption(poolKey{}, p)
+}
+
+type limitBroker struct {
+	broker.Broker
+	opts Options
+}
+
+func (l *limitBroker) Subscribe(topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	options := broker.SubscribeOptions{
+		Context: context.Background(),
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	pool, ok := options.Context.Value(poolKey{}).(*Pool)
+	if !ok {
+		concurrency := l.opts.Concurrency
+		if n, ok := options.Context.Value(concurrencyKey{}).(int); ok {
+			concurrency = n
+		}
+		limit := rateLimit{l.opts.Rate, l.opts.Burst}
+		if r, ok := options.Context.Value(rateKey{}).(rateLimit); ok {
+			limit = r
+		}
+		if concurrency <= 0 && limit.rate <= 0 {
+			return l.Broker.Subscribe(topic, h, opts...)
+		}
+		pool = NewPool(concurrency, limit.rate, limit.burst)
+	}
+
+	return l.Broker.Subscribe(topic, func(e broker.Event) error {
+		return pool.Do(func() error {
+			return h(e)
+		})
+	}, opts...)
+}
+
+func (l *limitBroker) String() string {
+	return l.Broker.String()
+}
+
+// NewBroker returns a broker limiting the concurrency and rate of the handlers of
+// subscriptions. Limits are set per subscription with MaxConcurrent, MaxRate and
+// WithPool, the options set the limits of subscriptions without limits of their own
+func NewBroker(b broker.Broker, opts ...Option) broker.Broker {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return &limitBroker{
+		Broker: b,
+		opts:   options,
+	}
+}
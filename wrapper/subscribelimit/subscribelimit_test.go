@@ -0,0 +1,91 @@
+package subscribelimit
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+	"github.com/micro/go-micro/v2/broker/memory"
+)
+
+func TestSubscribe(t *testing.T) {
+	b := NewBroker(memory.NewBroker(), Rate(1, 1))
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	var mtx sync.Mutex
+	var limited, unlimited int
+	if _, err := b.Subscribe("limited", func(broker.Event) error {
+		mtx.Lock()
+		limited++
+		mtx.Unlock()
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Subscribe("unlimited", func(broker.Event) error {
+		mtx.Lock()
+		unlimited++
+		mtx.Unlock()
+		return nil
+	}, MaxRate(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &broker.Message{Body: []byte("hello")}
+	for i := 0; i < 3; i++ {
+		go b.Publish("limited", msg)
+		if err := b.Publish("unlimited", msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if limited != 1 {
+		t.Fatalf("expected 1 message within the burst, got %d", limited)
+	}
+	if unlimited != 3 {
+		t.Fatalf("expected the subscription overriding the rate to be unlimited, got %d", unlimited)
+	}
+}
+
+func TestSharedPool(t *testing.T) {
+	p := NewPool(1, 0, 0)
+	b := NewBroker(memory.NewBroker())
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan bool)
+	for _, topic := range []string{"a", "b"} {
+		if _, err := b.Subscribe(topic, func(broker.Event) error {
+			<-release
+			return nil
+		}, WithPool(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan bool, 2)
+	for _, topic := range []string{"a", "b"} {
+		go func(topic string) {
+			b.Publish(topic, &broker.Message{})
+			done <- true
+		}(topic)
+	}
+
+	release <- true
+	<-done
+	select {
+	case <-done:
+		t.Fatal("expected the second subscription to wait for the shared slot")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release <- true
+	<-done
+}
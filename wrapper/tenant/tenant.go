@@ -0,0 +1,428 @@
+// Package tenant provides a broker wrapper which partitions topics by tenant
+package tenant
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/v2/broker"
+	log "github.com/micro/go-micro/v2/logger"
+	"github.com/micro/go-micro/v2/metadata"
+)
+
+/*
+	Messages of a tenant are published to a topic of their own, so every tenant is
+	delivered through a subscription of its own and a tenant flooding its topic
+	can't hold up the messages of others. Subscribers fan the tenant topics back in.
+
+	By default only the Tenants passed up front get a topic of their own, the
+	messages of other tenants stay on the topic. Publishers and subscribers must
+	be passed the same tenants, a subscriber doesn't know about the topic of a
+	tenant it wasn't passed.
+
+	With Announce subscribers learn about tenants from announcements publishers
+	send on the first message of a tenant and every AnnounceInterval after, and
+	subscribers ask publishers to announce their tenants again when they start.
+	The subscriber only subscribes to the tenant once it handled the announcement,
+	so the first messages of a tenant are published before anyone subscribed to
+	its topic. Only brokers retaining messages for subscriptions made later, like
+	kafka, JetStream or redis streams, deliver them. On brokers delivering to
+	existing subscriptions only, like nats or the http broker, they're lost, so
+	Announce mustn't be used with them.
+
+	Tenants become part of topic names, so they're restricted to letters, digits,
+	dashes and underscores. Wildcards like > and * of nats or # and + of mqtt
+	would subscribe to the topics of other tenants.
+*/
+
+var (
+	// DefaultKey is the header and metadata key holding the tenant
+	DefaultKey = "Micro-Tenant"
+	// DefaultAnnounceInterval is how often publishers announce their tenants
+	DefaultAnnounceInterval = time.Minute
+	// DefaultConcurrency is how many messages of a tenant are handled at once
+	DefaultConcurrency = 1
+
+	// ErrInvalidTenant is returned for tenants with characters other than letters,
+	// digits, dashes and underscores
+	ErrInvalidTenant = errors.New("invalid tenant")
+
+	validTenant = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+type Options struct {
+	// Key is the header and metadata key holding the tenant
+	Key string
+	// Tenants get a topic of their own, the messages of other tenants stay on
+	// the topic unless Announce is set
+	Tenants []string
+	// Announce gives every tenant a topic of their own and announces them to
+	// subscribers, the broker must retain messages for subscriptions made later
+	Announce bool
+	// Concurrency is how many messages of a tenant are handled at once
+	Concurrency int
+	// AnnounceInterval is how often publishers announce their tenants
+	AnnounceInterval time.Duration
+	// Topic returns the topic of the tenant
+	Topic func(topic, tenant string) string
+}
+
+type Option func(*Options)
+
+// Key sets the header and metadata key holding the tenant
+func Key(k string) Option {
+	return func(o *Options) {
+		o.Key = k
+	}
+}
+
+// Tenants gives the tenants a topic of their own, publishers and subscribers must
+// be passed the same tenants
+func Tenants(tenants ...string) Option {
+	return func(o *Options) {
+		o.Tenants = append(o.Tenants, tenants...)
+	}
+}
+
+// Announce gives every tenant a topic of their own and announces new tenants to
+// subscribers. The first messages of a tenant are published before subscribers
+// handled the announcement, so it must only be used with brokers retaining messages
+// for subscriptions made later, like kafka, and not with nats or the http broker
+func Announce() Option {
+	return func(o *Options) {
+		o.Announce = true
+	}
+}
+
+// Concurrency sets how many messages of a tenant are handled at once
+func Concurrency(n int) Option {
+	return func(o *Options) {
+		o.Concurrency = n
+	}
+}
+
+// AnnounceInterval sets how often publishers announce their tenants
+func AnnounceInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.AnnounceInterval = d
+	}
+}
+
+// Topic sets the func returning the topic of a tenant, by default topic.tenant
+func Topic(fn func(topic, tenant string) string) Option {
+	return func(o *Options) {
+		o.Topic = fn
+	}
+}
+
+type tenantBroker struct {
+	broker.Broker
+	opts    Options
+	tenants map[string]bool
+
+	sync.Mutex
+	// announced holds when the tenants of a topic were last announced
+	announced map[string]map[string]time.Time
+	// syncs are the subscriptions to subscribers asking for announcements, by topic
+	syncs map[string]broker.Subscriber
+}
+
+type subscriber struct {
+	b     *tenantBroker
+	topic string
+	h     broker.Handler
+	opts  []broker.SubscribeOption
+
+	sync.Mutex
+	announcements broker.Subscriber
+	subs          map[string]broker.Subscriber
+	closed        bool
+}
+
+type event struct {
+	broker.Event
+	topic string
+}
+
+func (e *event) Topic() string {
+	return e.topic
+}
+
+// announceTopic is where the tenants of the topic are announced
+func announceTopic(topic string) string {
+	return "micro.tenants." + topic
+}
+
+// syncTopic is where subscribers ask for the tenants of the topic to be announced
+func syncTopic(topic string) string {
+	return "micro.tenants.sync." + topic
+}
+
+// validate returns ErrInvalidTenant for tenants unsafe to use in topic names
+func validate(tenant string) error {
+	if !validTenant.MatchString(tenant) {
+		return ErrInvalidTenant
+	}
+	return nil
+}
+
+// sync announces the tenants of the topic again once a subscriber asks for it
+func (t *tenantBroker) sync(topic string) error {
+	t.Lock()
+	_, ok := t.syncs[topic]
+	t.Unlock()
+	if ok {
+		return nil
+	}
+
+	sub, err := t.Broker.Subscribe(syncTopic(topic), func(e broker.Event) error {
+		var tenants []string
+		t.Lock()
+		for tenant := range t.announced[topic] {
+			tenants = append(tenants, tenant)
+		}
+		t.Unlock()
+
+		for _, tenant := range tenants {
+			if err := t.publishAnnouncement(topic, tenant); err != nil {
+				log.Errorf("[tenant] failed to announce tenant %s of %s: %v", tenant, topic, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	if _, ok := t.syncs[topic]; ok {
+		return sub.Unsubscribe()
+	}
+	t.syncs[topic] = sub
+	return nil
+}
+
+func (t *tenantBroker) announce(topic, tenant string) error {
+	t.Lock()
+	last, ok := t.announced[topic][tenant]
+	t.Unlock()
+	if ok && time.Since(last) < t.opts.AnnounceInterval {
+		return nil
+	}
+
+	if err := t.sync(topic); err != nil {
+		return err
+	}
+	return t.publishAnnouncement(topic, tenant)
+}
+
+func (t *tenantBroker) publishAnnouncement(topic, tenant string) error {
+	err := t.Broker.Publish(announceTopic(topic), &broker.Message{
+		Header: map[string]string{t.opts.Key: tenant},
+	})
+	if err != nil {
+		return err
+	}
+
+	t.Lock()
+	if t.announced[topic] == nil {
+		t.announced[topic] = make(map[string]time.Time)
+	}
+	t.announced[topic][tenant] = time.Now()
+	t.Unlock()
+	return nil
+}
+
+func (t *tenantBroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	var options broker.PublishOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	tenant := msg.Header[t.opts.Key]
+	if len(tenant) == 0 && options.Context != nil {
+		tenant, _ = metadata.Get(options.Context, t.opts.Key)
+	}
+	// messages without a tenant stay on the topic
+	if len(tenant) == 0 {
+		return t.Broker.Publish(topic, msg, opts...)
+	}
+	if err := validate(tenant); err != nil {
+		return err
+	}
+
+	physical := topic
+	if t.opts.Announce {
+		if err := t.announce(topic, tenant); err != nil {
+			return err
+		}
+		physical = t.opts.Topic(topic, tenant)
+	} else if t.tenants[tenant] {
+		physical = t.opts.Topic(topic, tenant)
+	}
+
+	header := make(map[string]string, len(msg.Header)+1)
+	for k, v := range msg.Header {
+		header[k] = v
+	}
+	header[t.opts.Key] = tenant
+
+	return t.Broker.Publish(physical, &broker.Message{
+		Header: header,
+		Body:   msg.Body,
+	}, opts...)
+}
+
+func (t *tenantBroker) Subscribe(topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	s := &subscriber{
+		b:     t,
+		topic: topic,
+		h:     h,
+		opts:  opts,
+		subs:  make(map[string]broker.Subscriber),
+	}
+
+	tenants := append([]string{""}, t.opts.Tenants...)
+	for _, tenant := range tenants {
+		if err := s.add(tenant); err != nil {
+			s.Unsubscribe()
+			return nil, err
+		}
+	}
+
+	if !t.opts.Announce {
+		return s, nil
+	}
+
+	// every subscriber learns about tenants, so announcements aren't queued
+	a, err := t.Broker.Subscribe(announceTopic(topic), func(e broker.Event) error {
+		if tenant := e.Message().Header[t.opts.Key]; len(tenant) > 0 {
+			if err := s.add(tenant); err != nil {
+				log.Errorf("[tenant] failed to subscribe to tenant %s of %s: %v", tenant, topic, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.Unsubscribe()
+		return nil, err
+	}
+	s.Lock()
+	s.announcements = a
+	s.Unlock()
+
+	// publishers announce their tenants again rather than after AnnounceInterval
+	if err := t.Broker.Publish(syncTopic(topic), &broker.Message{Header: map[string]string{}}); err != nil {
+		log.Errorf("[tenant] failed to ask for the tenants of %s: %v", topic, err)
+	}
+
+	return s, nil
+}
+
+func (t *tenantBroker) String() string {
+	return t.Broker.String()
+}
+
+// add subscribes to the topic of the tenant, the empty tenant is the topic itself
+func (s *subscriber) add(tenant string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.subs[tenant]; ok || s.closed {
+		return nil
+	}
+
+	topic := s.topic
+	if len(tenant) > 0 {
+		if err := validate(tenant); err != nil {
+			return err
+		}
+		topic = s.b.opts.Topic(s.topic, tenant)
+	}
+
+	// isolate the tenants from each other
+	sem := make(chan struct{}, s.b.opts.Concurrency)
+	sub, err := s.b.Broker.Subscribe(topic, func(e broker.Event) error {
+		sem <- struct{}{}
+		defer func() {
+			<-sem
+		}()
+		return s.h(&event{Event: e, topic: s.topic})
+	}, s.opts...)
+	if err != nil {
+		return err
+	}
+	s.subs[tenant] = sub
+	return nil
+}
+
+func (s *subscriber) Options() broker.SubscribeOptions {
+	var options broker.SubscribeOptions
+	for _, o := range s.opts {
+		o(&options)
+	}
+	return options
+}
+
+func (s *subscriber) Topic() string {
+	return s.topic
+}
+
+func (s *subscriber) Unsubscribe() error {
+	s.Lock()
+	announcements := s.announcements
+	s.Unlock()
+	if announcements != nil {
+		announcements.Unsubscribe()
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.closed = true
+
+	var err error
+	for tenant, sub := range s.subs {
+		if uerr := sub.Unsubscribe(); uerr != nil {
+			err = uerr
+		}
+		delete(s.subs, tenant)
+	}
+	return err
+}
+
+// NewBroker returns a broker which publishes messages to the topic of their tenant,
+// taken from the message header or the metadata of the publish context, and fans
+// the tenant topics of subscriptions back in
+func NewBroker(b broker.Broker, opts ...Option) broker.Broker {
+	options := Options{
+		Key:              DefaultKey,
+		Concurrency:      DefaultConcurrency,
+		AnnounceInterval: DefaultAnnounceInterval,
+		Topic: func(topic, tenant string) string {
+			return topic + "." + tenant
+		},
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.Concurrency < 1 {
+		options.Concurrency = 1
+	}
+
+	tenants := make(map[string]bool, len(options.Tenants))
+	for _, tenant := range options.Tenants {
+		tenants[tenant] = true
+	}
+
+	return &tenantBroker{
+		Broker:    b,
+		opts:      options,
+		tenants:   tenants,
+		announced: make(map[string]map[string]time.Time),
+		syncs:     make(map[string]broker.Subscriber),
+	}
+}
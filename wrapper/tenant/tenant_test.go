@@ -0,0 +1,179 @@
+package tenant
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/micro/go-micro/v2/broker"
+	"github.com/micro/go-micro/v2/broker/memory"
+	"github.com/micro/go-micro/v2/metadata"
+)
+
+func TestBroker(t *testing.T) {
+	mb := memory.NewBroker()
+	if err := mb.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer mb.Disconnect()
+
+	b := NewBroker(mb, Announce())
+
+	var mtx sync.Mutex
+	received := make(map[string]int)
+
+	sub, err := b.Subscribe("orders", func(e broker.Event) error {
+		if e.Topic() != "orders" {
+			t.Errorf("expected topic orders, got %s", e.Topic())
+		}
+		mtx.Lock()
+		received[e.Message().Header[DefaultKey]]++
+		mtx.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the tenant is taken from the header or the metadata of the context
+	ctx := metadata.Set(context.Background(), DefaultKey, "bar")
+	msgs := []struct {
+		msg  *broker.Message
+		opts []broker.PublishOption
+	}{
+		{&broker.Message{Header: map[string]string{DefaultKey: "foo"}}, nil},
+		{&broker.Message{Header: map[string]string{}}, []broker.PublishOption{broker.PublishContext(ctx)}},
+		{&broker.Message{Header: map[string]string{}}, nil},
+	}
+	for _, m := range msgs {
+		if err := b.Publish("orders", m.msg, m.opts...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the physical topics hold the messages of their tenant only
+	var direct int
+	dsub, err := mb.Subscribe("orders.foo", func(e broker.Event) error {
+		direct++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dsub.Unsubscribe()
+	if err := b.Publish("orders", &broker.Message{Header: map[string]string{DefaultKey: "foo"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if received["foo"] != 2 || received["bar"] != 1 || received[""] != 1 || direct != 1 {
+		t.Fatalf("unexpected deliveries %v, direct %d", received, direct)
+	}
+
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTenants(t *testing.T) {
+	mb := memory.NewBroker()
+	if err := mb.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer mb.Disconnect()
+
+	b := NewBroker(mb, Tenants("foo"))
+
+	received := make(map[string]string)
+	sub, err := b.Subscribe("orders", func(e broker.Event) error {
+		received[e.Message().Header[DefaultKey]] = e.Topic()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	// only the tenants passed up front get a topic of their own
+	topics := make(map[string]bool)
+	for _, topic := range []string{"orders", "orders.foo", "orders.bar"} {
+		topic := topic
+		dsub, err := mb.Subscribe(topic, func(e broker.Event) error {
+			topics[topic] = true
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dsub.Unsubscribe()
+	}
+
+	for _, tenant := range []string{"foo", "bar"} {
+		if err := b.Publish("orders", &broker.Message{Header: map[string]string{DefaultKey: tenant}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if received["foo"] != "orders" || received["bar"] != "orders" {
+		t.Fatalf("unexpected deliveries %v", received)
+	}
+	if !topics["orders.foo"] || !topics["orders"] || topics["orders.bar"] {
+		t.Fatalf("unexpected topics %v", topics)
+	}
+}
+
+func TestInvalidTenant(t *testing.T) {
+	mb := memory.NewBroker()
+	if err := mb.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer mb.Disconnect()
+
+	b := NewBroker(mb, Announce())
+
+	// wildcards would subscribe to the topics of other tenants
+	for _, tenant := range []string{">", "*", "#", "+", "foo.bar", "foo/bar"} {
+		err := b.Publish("orders", &broker.Message{Header: map[string]string{DefaultKey: tenant}})
+		if err != ErrInvalidTenant {
+			t.Fatalf("expected %v for tenant %s, got %v", ErrInvalidTenant, tenant, err)
+		}
+	}
+
+	if _, err := NewBroker(mb, Tenants(">")).Subscribe("orders", func(broker.Event) error {
+		return nil
+	}); err != ErrInvalidTenant {
+		t.Fatalf("expected %v, got %v", ErrInvalidTenant, err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	mb := memory.NewBroker()
+	if err := mb.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer mb.Disconnect()
+
+	b := NewBroker(mb, Announce())
+	if err := b.Publish("orders", &broker.Message{Header: map[string]string{DefaultKey: "foo"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a subscriber started after the announcement doesn't wait for the next one
+	var received int
+	sub, err := b.Subscribe("orders", func(e broker.Event) error {
+		received++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	if err := b.Publish("orders", &broker.Message{Header: map[string]string{DefaultKey: "foo"}}); err != nil {
+		t.Fatal(err)
+	}
+	if received != 1 {
+		t.Fatalf("expected 1 message, got %d", received)
+	}
+}
@@ -0,0 +1,182 @@
+// Package opentelemetry provides wrappers for OpenTelemetry
+package opentelemetry
+
+import (
+	"context"
+	"strings"
+
+	"github.com/micro/go-micro/v2/broker"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+	The span context travels in the message header so the spans of subscribers
+	join the trace of the publisher, however many brokers and services a flow
+	passes through. The header handed to subscribers carries the span of the
+	handler, the go-micro server turns the header into the metadata of the
+	subscriber context so publishing from a handler continues the trace.
+*/
+
+// instrumentationName is the name of the tracer
+const instrumentationName = "github.com/micro/go-plugins/wrapper/trace/opentelemetry"
+
+type otelBroker struct {
+	broker.Broker
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+type event struct {
+	broker.Event
+	msg *broker.Message
+}
+
+func (e *event) Message() *broker.Message {
+	return e.msg
+}
+
+// headerCarrier adapts a message header to the propagation.TextMapCarrier interface
+type headerCarrier map[string]string
+
+func (h headerCarrier) Get(key string) string {
+	if v, ok := h[key]; ok {
+		return v
+	}
+	// the go-micro server title cases metadata keys
+	for k, v := range h {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+func (h headerCarrier) Set(key, value string) {
+	for k := range h {
+		if strings.EqualFold(k, key) {
+			delete(h, k)
+		}
+	}
+	h[key] = value
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func copyHeader(header map[string]string) headerCarrier {
+	h := make(headerCarrier, len(header)+2)
+	for k, v := range header {
+		h[k] = v
+	}
+	return h
+}
+
+func (o *otelBroker) attributes(topic string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("messaging.system", o.Broker.String()),
+		attribute.String("messaging.destination", topic),
+		attribute.String("messaging.destination_kind", "topic"),
+	}
+}
+
+func (o *otelBroker) Publish(topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	options := broker.PublishOptions{
+		Context: context.Background(),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	header := copyHeader(msg.Header)
+
+	// the go-micro client passes the span context in the header rather than the context
+	ctx := options.Context
+	if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		ctx = o.propagator.Extract(ctx, header)
+	}
+
+	ctx, span := o.tracer.Start(ctx, topic+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(o.attributes(topic)...),
+	)
+	defer span.End()
+
+	o.propagator.Inject(ctx, header)
+
+	err := o.Broker.Publish(topic, &broker.Message{Header: header, Body: msg.Body}, opts...)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+func (o *otelBroker) Subscribe(topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	return o.Broker.Subscribe(topic, func(e broker.Event) error {
+		msg := e.Message()
+		header := copyHeader(msg.Header)
+
+		ctx := o.propagator.Extract(context.Background(), header)
+		ctx, span := o.tracer.Start(ctx, topic+" process",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(o.attributes(topic)...),
+		)
+		defer span.End()
+
+		o.propagator.Inject(ctx, header)
+
+		err := h(&event{Event: e, msg: &broker.Message{Header: header, Body: msg.Body}})
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}, opts...)
+}
+
+func (o *otelBroker) String() string {
+	return o.Broker.String()
+}
+
+// ContextFromHeader returns a context carrying the span context of the message
+// header, for handlers starting spans of their own
+func ContextFromHeader(ctx context.Context, header map[string]string, opts ...Option) context.Context {
+	options := newOptions(opts...)
+	return options.Propagator.Extract(ctx, headerCarrier(header))
+}
+
+func newOptions(opts ...Option) Options {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+	if options.TracerProvider == nil {
+		options.TracerProvider = otel.GetTracerProvider()
+	}
+	if options.Propagator == nil {
+		options.Propagator = otel.GetTextMapPropagator()
+	}
+	return options
+}
+
+// NewBroker returns a broker starting a producer span around every publish and a
+// consumer span around every handler, propagating the span context through the
+// message header
+func NewBroker(b broker.Broker, opts ...Option) broker.Broker {
+	options := newOptions(opts...)
+
+	return &otelBroker{
+		Broker:     b,
+		tracer:     options.TracerProvider.Tracer(instrumentationName),
+		propagator: options.Propagator,
+	}
+}
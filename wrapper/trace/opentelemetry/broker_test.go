@@ -0,0 +1,81 @@
+package opentelemetry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/micro/go-micro/v2/broker"
+	"github.com/micro/go-micro/v2/broker/memory"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/oteltest"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestBroker(t *testing.T) {
+	sr := new(oteltest.SpanRecorder)
+	tp := oteltest.NewTracerProvider(oteltest.WithSpanRecorder(sr))
+
+	b := NewBroker(memory.NewBroker(), WithTracerProvider(tp), WithPropagator(propagation.TraceContext{}))
+	if err := b.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	var handled trace.SpanContext
+	if _, err := b.Subscribe("test", func(e broker.Event) error {
+		ctx := ContextFromHeader(context.Background(), e.Message().Header, WithPropagator(propagation.TraceContext{}))
+		handled = trace.RemoteSpanContextFromContext(ctx)
+		return errors.New("failed")
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	msg := &broker.Message{Header: map[string]string{"Foo": "Bar"}, Body: []byte("hello")}
+	// the memory broker handles the message on publish and returns the handler error
+	if err := b.Publish("test", msg, broker.PublishContext(ctx)); err == nil || err.Error() != "failed" {
+		t.Fatalf("expected the handler error, got %v", err)
+	}
+	parent.End()
+
+	if len(msg.Header) != 1 {
+		t.Fatal("expected the published message to be left untouched")
+	}
+
+	spans := make(map[string]*oteltest.Span)
+	for _, s := range sr.Completed() {
+		spans[s.Name()] = s
+	}
+	send, process := spans["test send"], spans["test process"]
+	if send == nil || process == nil {
+		t.Fatalf("expected send and process spans, got %v", spans)
+	}
+
+	if send.SpanKind() != trace.SpanKindProducer || process.SpanKind() != trace.SpanKindConsumer {
+		t.Fatalf("unexpected span kinds %v and %v", send.SpanKind(), process.SpanKind())
+	}
+	if send.ParentSpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("expected the send span to be a child of the publishing span")
+	}
+	if process.ParentSpanID() != send.SpanContext().SpanID() || process.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+		t.Fatal("expected the process span to be a child of the send span")
+	}
+	if handled.SpanID() != process.SpanContext().SpanID() {
+		t.Fatal("expected the handler to see the process span")
+	}
+	if process.StatusCode() != codes.Error {
+		t.Fatal("expected the handler error to be recorded")
+	}
+}
+
+func TestHeaderCarrier(t *testing.T) {
+	h := headerCarrier{"Traceparent": "a"}
+	if v := h.Get("traceparent"); v != "a" {
+		t.Fatalf("expected a, got %s", v)
+	}
+	h.Set("traceparent", "b")
+	if len(h) != 1 || h["traceparent"] != "b" {
+		t.Fatalf("expected the title cased key to be replaced, got %v", h)
+	}
+}
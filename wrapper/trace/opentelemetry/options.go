@@ -0,0 +1,29 @@
+package opentelemetry
+
+import (
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Options struct {
+	// TracerProvider creates the tracer spans are started with, the global provider by default
+	TracerProvider trace.TracerProvider
+	// Propagator carries the span context in message headers, the global propagator by default
+	Propagator propagation.TextMapPropagator
+}
+
+type Option func(*Options)
+
+// WithTracerProvider sets the provider of the tracer spans are started with
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *Options) {
+		o.TracerProvider = tp
+	}
+}
+
+// WithPropagator sets the propagator carrying the span context in message headers
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(o *Options) {
+		o.Propagator = p
+	}
+}
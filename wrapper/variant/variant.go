@@ -0,0 +1,124 @@
+// Package variant provides a wrapper which routes requests to alternative handler implementations
+package variant
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/micro/go-micro/v2/metadata"
+	"github.com/micro/go-micro/v2/server"
+)
+
+var (
+	// DefaultKey is the metadata key selecting the variant
+	DefaultKey = "Micro-Variant"
+
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+type Options struct {
+	// Key is the metadata key holding the variant name
+	Key string
+	// Variants maps variant names to handler implementations
+	Variants map[string]interface{}
+}
+
+type Option func(*Options)
+
+// Key sets the metadata key used to select a variant
+func Key(k string) Option {
+	return func(o *Options) {
+		o.Key = k
+	}
+}
+
+// Variant registers an alternative handler served when the metadata key has the
+// given value. The handler must have the same methods as the registered handler
+// e.g func (g *Greeter) Hello(ctx context.Context, req *pb.Request, rsp *pb.Response) error
+func Variant(name string, handler interface{}) Option {
+	return func(o *Options) {
+		if o.Variants == nil {
+			o.Variants = make(map[string]interface{})
+		}
+		o.Variants[name] = handler
+	}
+}
+
+// methods returns the handler methods matching the rpc handler signature
+func methods(handler interface{}) map[string]reflect.Value {
+	v := reflect.ValueOf(handler)
+	t := v.Type()
+	m := make(map[string]reflect.Value)
+
+	for i := 0; i < t.NumMethod(); i++ {
+		mt := t.Method(i).Type
+		// receiver, context, request and response
+		if mt.NumIn() != 4 || mt.NumOut() != 1 {
+			continue
+		}
+		if mt.In(1) != typeOfContext || mt.Out(0) != typeOfError {
+			continue
+		}
+		m[t.Method(i).Name] = v.Method(i)
+	}
+
+	return m
+}
+
+// NewHandlerWrapper returns a handler wrapper which serves requests carrying a
+// variant in their metadata with the matching handler. Requests without a variant,
+// with an unknown one or for a method the variant doesn't implement are served by
+// the registered handler. Streaming requests are always served by the registered handler
+func NewHandlerWrapper(opts ...Option) server.HandlerWrapper {
+	options := Options{
+		Key: DefaultKey,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	variants := make(map[string]map[string]reflect.Value, len(options.Variants))
+	for name, handler := range options.Variants {
+		variants[name] = methods(handler)
+	}
+
+	return func(h server.HandlerFunc) server.HandlerFunc {
+		return func(ctx context.Context, req server.Request, rsp interface{}) error {
+			if req.Stream() {
+				return h(ctx, req, rsp)
+			}
+
+			name, ok := metadata.Get(ctx, options.Key)
+			if !ok {
+				return h(ctx, req, rsp)
+			}
+
+			// endpoints are of the form Handler.Method
+			parts := strings.Split(req.Endpoint(), ".")
+			method, ok := variants[name][parts[len(parts)-1]]
+			if !ok {
+				return h(ctx, req, rsp)
+			}
+
+			body := reflect.ValueOf(req.Body())
+			if !body.IsValid() || !body.Type().AssignableTo(method.Type().In(1)) {
+				return h(ctx, req, rsp)
+			}
+			if rsp == nil || !reflect.TypeOf(rsp).AssignableTo(method.Type().In(2)) {
+				return h(ctx, req, rsp)
+			}
+
+			out := method.Call([]reflect.Value{
+				reflect.ValueOf(ctx),
+				body,
+				reflect.ValueOf(rsp),
+			})
+			if err := out[0].Interface(); err != nil {
+				return err.(error)
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package variant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micro/go-micro/v2/metadata"
+	"github.com/micro/go-micro/v2/server"
+)
+
+type testRequest struct {
+	server.Request
+	endpoint string
+	body     interface{}
+}
+
+func (r *testRequest) Endpoint() string {
+	return r.endpoint
+}
+
+func (r *testRequest) Body() interface{} {
+	return r.body
+}
+
+func (r *testRequest) Stream() bool {
+	return false
+}
+
+type request struct {
+	Name string
+}
+
+type response struct {
+	Msg string
+}
+
+type greeterB struct{}
+
+func (g *greeterB) Hello(ctx context.Context, req *request, rsp *response) error {
+	rsp.Msg = "b " + req.Name
+	return nil
+}
+
+func TestHandlerWrapper(t *testing.T) {
+	fn := func(ctx context.Context, req server.Request, rsp interface{}) error {
+		rsp.(*response).Msg = "a " + req.Body().(*request).Name
+		return nil
+	}
+	h := NewHandlerWrapper(Variant("b", &greeterB{}))(fn)
+
+	testData := []struct {
+		variant  string
+		endpoint string
+		expected string
+	}{
+		{"", "Greeter.Hello", "a john"},
+		{"b", "Greeter.Hello", "b john"},
+		{"c", "Greeter.Hello", "a john"},
+		{"b", "Greeter.Goodbye", "a john"},
+	}
+
+	for _, d := range testData {
+		ctx := context.Background()
+		if len(d.variant) > 0 {
+			ctx = metadata.NewContext(ctx, metadata.Metadata{DefaultKey: d.variant})
+		}
+
+		rsp := &response{}
+		req := &testRequest{endpoint: d.endpoint, body: &request{Name: "john"}}
+		if err := h(ctx, req, rsp); err != nil {
+			t.Fatal(err)
+		}
+		if rsp.Msg != d.expected {
+			t.Fatalf("variant %q: expected %q got %q", d.variant, d.expected, rsp.Msg)
+		}
+	}
+}